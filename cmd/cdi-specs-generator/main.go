@@ -17,6 +17,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -149,7 +150,7 @@ func handleGPUDevices(cdiCache *cdiapi.Cache, namingStyle string, dryRun bool) e
 	fmt.Println("Scanning for GPUs")
 
 	// Ignore whether the device details were discovered.
-	detectedDevices := gpuDiscovery.DiscoverDevices(sysfsDir, namingStyle, false)
+	detectedDevices := gpuDiscovery.DiscoverDevices(context.Background(), sysfsDir, namingStyle, false, gpuDevice.SupportedKernelDrivers, false, helpers.DefaultDiscoveryTimeout, nil)
 	if len(detectedDevices) == 0 {
 		fmt.Println("No supported devices detected")
 	}
@@ -176,7 +177,7 @@ func handleGaudiDevices(cdiCache *cdiapi.Cache, namingStyle string, dryRun bool)
 
 	fmt.Println("Scanning for Gaudi accelerators")
 
-	detectedDevices := gaudiDiscovery.DiscoverDevices(sysfsDir, namingStyle)
+	detectedDevices := gaudiDiscovery.DiscoverDevices(context.Background(), sysfsDir, namingStyle, nil, helpers.DefaultDiscoveryTimeout)
 	if len(detectedDevices) == 0 {
 		fmt.Println("No supported devices detected")
 	}
@@ -190,7 +191,7 @@ func handleGaudiDevices(cdiCache *cdiapi.Cache, namingStyle string, dryRun bool)
 		return nil
 	}
 
-	if err := gaudiCdihelpers.AddDetectedDevicesToCDIRegistry(cdiCache, detectedDevices); err != nil {
+	if err := gaudiCdihelpers.AddDetectedDevicesToCDIRegistry(cdiCache, detectedDevices, helpers.DeviceNodePermissions{}); err != nil {
 		fmt.Printf("unable to add detected devices to CDI registry: %v", err)
 		return err
 	}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	resourcev1 "k8s.io/api/resource/v1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+var claimParametersType = helpers.ClaimParametersType{
+	APIVersion: device.DriverName + "/v1alpha1",
+	Kind:       "GaudiConfig",
+}
+
+// ClaimParameters are Gaudi-specific opaque device configuration parameters in
+// ResourceClaim or DeviceClass, e.g.
+// {"apiVersion": "gaudi.intel.com/v1alpha1", "kind": "GaudiConfig", "controlOnly": true}.
+type ClaimParameters struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	// ControlOnly adds only the accel_controlD node to the container, without
+	// the accel and uverbs nodes. Defaults to false.
+	ControlOnly *bool `json:"controlOnly,omitempty"`
+}
+
+// requestedControlOnly returns whether only the control node is requested for
+// the claim request. DeviceClass configuration comes first in the claim
+// allocation results, so ResourceClaim configuration overrides it.
+func requestedControlOnly(claim *resourcev1.ResourceClaim, request string) (bool, error) {
+	controlOnly := false
+	parametersList, err := helpers.RequestClaimParameters[ClaimParameters](claim, device.DriverName, claimParametersType, request)
+	if err != nil {
+		return false, err
+	}
+
+	for _, parameters := range parametersList {
+		if parameters.ControlOnly != nil {
+			controlOnly = *parameters.ControlOnly
+		}
+	}
+
+	return controlOnly, nil
+}
@@ -18,16 +18,15 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"path"
 	"time"
 
 	resourceapi "k8s.io/api/resource/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/runtime"
 	coreclientset "k8s.io/client-go/kubernetes"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
 	"k8s.io/klog/v2"
 
 	hlml "github.com/HabanaAI/gohlml"
@@ -44,6 +43,24 @@ type driver struct {
 	helper *kubeletplugin.Helper
 	// If HLML monitoring is running - it will need to be stopped.
 	hlmlShutdown context.CancelFunc
+	// Records every claim preparation and unpreparation, nil when disabled.
+	auditLog *helpers.AuditLog
+	// Notifies an external system of every claim preparation and unpreparation, nil when disabled.
+	allocationHook *helpers.AllocationHook
+	// Claims with more devices are rejected, 0 means no limit.
+	maxDevicesPerClaim int
+	// Publish attribute names prefixed with the driver name.
+	qualifiedAttributeNames bool
+	// Republishes resources after recoverable kubelet plugin errors.
+	errorHandler *helpers.ErrorHandler
+	// Devices reserved with a Node annotation, nil in oneshot mode.
+	reservations *helpers.Reservations
+	// Withholds devices whose device nodes do not exist yet, nil when disabled and in oneshot mode.
+	readiness *helpers.DeviceReadiness
+	// Republishes resources that changed since last published, nil when disabled and in oneshot mode.
+	republisher *helpers.Republisher
+	// Devices withheld from DRA, nil when nothing is excluded.
+	excludeFilter *discovery.DeviceFilter
 }
 
 func getGaudiFlags(someFlags interface{}) (*GaudiFlags, error) {
@@ -59,9 +76,30 @@ func getGaudiFlags(someFlags interface{}) (*GaudiFlags, error) {
 			gaudiFlags.HealthcareInterval, HealthcareIntervalFlagMin, HealthcareIntervalFlagMax)
 	}
 
+	switch gaudiFlags.HLVisibleDevicesBy {
+	case "":
+		gaudiFlags.HLVisibleDevicesBy = HLVisibleDevicesByDefault
+	case HLVisibleDevicesByIndex, HLVisibleDevicesByModule, HLVisibleDevicesByUUID:
+	default:
+		return gaudiFlags, fmt.Errorf("unsupported HL_VISIBLE_DEVICES identifier %v. Should be one of: %v, %v, %v",
+			gaudiFlags.HLVisibleDevicesBy, HLVisibleDevicesByIndex, HLVisibleDevicesByModule, HLVisibleDevicesByUUID)
+	}
+
 	return gaudiFlags, nil
 }
 
+// checkDeviceSerials fails when a device has no serial number for
+// HL_VISIBLE_DEVICES.
+func checkDeviceSerials(devices device.DevicesInfo) error {
+	for _, gaudi := range devices {
+		if gaudi.Serial == "" {
+			return fmt.Errorf("HL_VISIBLE_DEVICES identifier %v requires health monitoring, device %v has no serial number in sysfs", HLVisibleDevicesByUUID, gaudi.UID)
+		}
+	}
+
+	return nil
+}
+
 func newDriver(ctx context.Context, config *helpers.Config) (helpers.Driver, error) {
 	driverVersion.PrintDriverVersion(device.DriverName)
 	sysfsDir := helpers.GetSysfsRoot(device.SysfsDriverPath)
@@ -72,39 +110,76 @@ func newDriver(ctx context.Context, config *helpers.Config) (helpers.Driver, err
 		return nil, fmt.Errorf("getGaudiFlags: %w", err)
 	}
 
-	detectedDevices := discovery.DiscoverDevices(sysfsDir, device.DefaultNamingStyle)
+	deviceNodePermissions, err := gaudiFlags.DeviceNode.Permissions()
+	if err != nil {
+		return nil, err
+	}
+
+	excludeFilter, err := discovery.NewDeviceFilter(gaudiFlags.ExcludeModules, gaudiFlags.ExcludePCI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device exclusion: %v", err)
+	}
+
+	detectedDevices := discovery.DiscoverDevices(ctx, sysfsDir, device.DefaultNamingStyle, excludeFilter, config.CommonFlags.DiscoveryTimeout)
 	if len(detectedDevices) == 0 {
 		klog.Info("No supported devices detected")
 	}
 
+	if gaudiFlags.StrictModuleIDs {
+		if err := discovery.ValidateModuleIDs(detectedDevices); err != nil {
+			return nil, fmt.Errorf("device discovery: %v", err)
+		}
+	}
+
+	// Without serials from sysfs, only HLML used for health monitoring can provide them.
+	if gaudiFlags.HLVisibleDevicesBy == HLVisibleDevicesByUUID && !gaudiFlags.Healthcare {
+		if err := checkDeviceSerials(detectedDevices); err != nil {
+			return nil, err
+		}
+	}
+
 	klog.V(3).Info("Creating new NodeState")
-	state, err := newNodeState(detectedDevices, config.CommonFlags.CdiRoot, preparedClaimsFilePath, config.CommonFlags.NodeName, gaudiFlags.GaudiHookPath, gaudiFlags.GaudinetPath)
+	state, err := newNodeState(detectedDevices, config.CommonFlags.CdiRoot, preparedClaimsFilePath, config.CommonFlags.NodeName, gaudiFlags.GaudiHookPath, gaudiFlags.GaudinetPath, gaudiFlags.HLVisibleDevicesBy, config.CommonFlags.CDISyncTimeout, deviceNodePermissions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new NodeState: %v", err)
 	}
 
+	state.SysfsRoot = sysfsDir
+
 	driver := &driver{
-		state:  *state,
-		client: config.Coreclient,
-	}
-
-	klog.Infof(`Starting DRA resource-driver kubelet-plugin
-RegistrarDirectoryPath: %v
-PluginDataDirectoryPath: %v`,
-		config.CommonFlags.KubeletPluginsRegistryDir,
-		config.CommonFlags.KubeletPluginDir)
-
-	helper, err := kubeletplugin.Start(
-		ctx,
-		driver,
-		kubeletplugin.KubeClient(config.Coreclient),
-		kubeletplugin.NodeName(config.CommonFlags.NodeName),
-		kubeletplugin.DriverName(device.DriverName),
-		kubeletplugin.RegistrarDirectoryPath(config.CommonFlags.KubeletPluginsRegistryDir),
-		kubeletplugin.PluginDataDirectoryPath(config.CommonFlags.KubeletPluginDir),
-	)
+		state:                   *state,
+		client:                  config.Coreclient,
+		auditLog:                helpers.NewAuditLog(config.CommonFlags.AuditLogPath, config.CommonFlags.AuditLogMaxSizeMiB),
+		allocationHook:          helpers.NewAllocationHook(config.CommonFlags.AllocationHook, device.DriverName, config.CommonFlags.AllocationHookTimeout),
+		maxDevicesPerClaim:      config.CommonFlags.MaxDevicesPerClaim,
+		qualifiedAttributeNames: config.CommonFlags.QualifiedAttributeNames,
+		excludeFilter:           excludeFilter,
+	}
+
+	driver.errorHandler = helpers.NewErrorHandler(driver.PublishResourceSlice, config.ShutdownOnFatalError())
+
+	// Nothing is started in oneshot mode, resources are only printed.
+	if config.CommonFlags.Oneshot {
+		return driver, nil
+	}
+
+	helpers.RegisterPreparedClaimsMetrics(metricsNamespace, driver.state.PreparedClaimTimes)
+	helpers.RegisterClaimOperationMetrics(metricsNamespace)
+	helpers.RegisterInventoryMetrics(metricsNamespace)
+
+	startupRetry := helpers.NewAPIStartupRetry(config.CommonFlags.APIStartupTimeout)
+	driver.reservations = helpers.NewReservations(device.DriverName)
+	if err := startupRetry.Do(ctx, "load device reservations", func(ctx context.Context) error {
+		return driver.reservations.Load(ctx, config.Coreclient, config.CommonFlags.NodeName)
+	}); err != nil {
+		return nil, fmt.Errorf("could not load device reservations: %v", err)
+	}
+	driver.readiness = helpers.NewDeviceReadiness(driver.state.CdiCache, device.CDIKind, config.CommonFlags.DeviceReadinessInterval)
+	driver.republisher = helpers.NewRepublisher(config.CommonFlags.RepublishInterval)
+
+	helper, err := helpers.StartKubeletPlugin(ctx, driver, device.DriverName, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start kubelet-plugin: %v", err)
+		return nil, err
 	}
 
 	driver.helper = helper
@@ -128,6 +203,24 @@ PluginDataDirectoryPath: %v`,
 		go driver.startHealthMonitor(hlmlListenerContext, gaudiFlags.HealthcareInterval)
 	}
 
+	go driver.reservations.Watch(ctx, config.Coreclient, config.CommonFlags.NodeName, func() {
+		if err := driver.PublishResourceSlice(ctx); err != nil {
+			klog.Errorf("Could not publish device reservations: %v", err)
+		}
+	})
+
+	go driver.readiness.Watch(ctx, func() {
+		if err := driver.PublishResourceSlice(ctx); err != nil {
+			klog.Errorf("Could not publish devices that became ready: %v", err)
+		}
+	})
+
+	go driver.republisher.Run(ctx, driver.GetResources, driver.PublishResourceSlice)
+
+	go helpers.RunReconciler(ctx, config.CommonFlags.ReconcileInterval, driver.state.reconcileCDI)
+
+	helpers.LogStartupSummary(driver.startupSummary())
+
 	klog.V(3).Info("Finished creating new driver")
 	return driver, nil
 }
@@ -138,7 +231,9 @@ func (d *driver) PrepareResourceClaims(ctx context.Context, claims []*resourceap
 	response := map[types.UID]kubeletplugin.PrepareResult{}
 
 	for _, claim := range claims {
+		start := time.Now()
 		response[claim.UID] = d.prepareResourceClaim(ctx, claim)
+		helpers.ObserveClaimOperation(helpers.ClaimOperationPrepare, start, response[claim.UID].Err)
 	}
 
 	return response, nil
@@ -147,18 +242,40 @@ func (d *driver) PrepareResourceClaims(ctx context.Context, claims []*resourceap
 func (d *driver) prepareResourceClaim(ctx context.Context, claim *resourceapi.ResourceClaim) kubeletplugin.PrepareResult {
 	klog.V(5).Infof("NodePrepareResource is called: request: %+v", claim)
 
-	if claimPreparation, found := d.state.Prepared[string(claim.UID)]; found {
+	d.state.Lock()
+	claimPreparation, found := d.state.Prepared[string(claim.UID)]
+	d.state.Unlock()
+	if found {
 		klog.V(3).Infof("Claim %s was already prepared, nothing to do", claim.UID)
 		return claimPreparation
 	}
 
+	if err := helpers.CheckClaimDeviceCount(claim, device.DriverName, d.maxDevicesPerClaim); err != nil {
+		return kubeletplugin.PrepareResult{
+			Err: err,
+		}
+	}
+
+	if err := d.reservations.CheckClaim(claim); err != nil {
+		return kubeletplugin.PrepareResult{
+			Err: err,
+		}
+	}
+
 	if err := d.state.Prepare(ctx, claim); err != nil {
 		return kubeletplugin.PrepareResult{
 			Err: err,
 		}
 	}
 
-	return d.state.Prepared[string(claim.UID)]
+	d.state.Lock()
+	prepareResult := d.state.Prepared[string(claim.UID)]
+	d.state.Unlock()
+
+	d.auditLog.RecordPrepareResult(helpers.AuditActionPrepare, string(claim.UID), claim.Namespace, prepareResult, "")
+	d.allocationHook.NotifyPrepareResult(ctx, helpers.AuditActionPrepare, string(claim.UID), claim.Namespace, prepareResult)
+
+	return prepareResult
 }
 
 func (d *driver) UnprepareResourceClaims(ctx context.Context, claims []kubeletplugin.NamespacedObject) (map[types.UID]error, error) {
@@ -166,33 +283,108 @@ func (d *driver) UnprepareResourceClaims(ctx context.Context, claims []kubeletpl
 	response := map[types.UID]error{}
 
 	for _, claim := range claims {
-
-		if err := d.state.Unprepare(ctx, string(claim.UID)); err != nil {
+		start := time.Now()
+		d.state.Lock()
+		prepareResult, prepared := d.state.Prepared[string(claim.UID)]
+		err := d.state.RemovePreparedClaim(string(claim.UID))
+		d.state.Unlock()
+		helpers.ObserveClaimOperation(helpers.ClaimOperationUnprepare, start, err)
+		if err != nil {
 			response[claim.UID] = fmt.Errorf("error freeing devices: %v", err)
 			continue
 		}
 
 		// Cleanup special CDI devices that hold only env variables.
 		if err := cdihelpers.DeleteBlankDevices(d.state.CdiCache, string(claim.UID)); err != nil {
-			response[claim.UID] = fmt.Errorf("error deleting CDI device: %v", err)
+			response[claim.UID] = fmt.Errorf("error deleting CDI device: %w", err)
 			continue
 		}
 
 		response[claim.UID] = nil
 		klog.V(3).Infof("Freed devices for claim '%v'", claim.UID)
+		if prepared {
+			d.auditLog.RecordPrepareResult(helpers.AuditActionUnprepare, string(claim.UID), claim.Namespace, prepareResult, "")
+			d.allocationHook.NotifyPrepareResult(ctx, helpers.AuditActionUnprepare, string(claim.UID), claim.Namespace, prepareResult)
+		}
 
 	}
 
+	// Blank devices of claims that failed cleanup earlier would otherwise stay in the spec forever.
+	d.state.Lock()
+	if err := d.state.removeStaleCDIDevices(); err != nil {
+		klog.Errorf("failed to remove stale CDI devices: %v", err)
+	}
+	d.state.Unlock()
+
 	return response, nil
 }
 
+// GetResources returns the resources published in ResourceSlice.
+func (d *driver) GetResources() resourceslice.DriverResources {
+	resources := d.readiness.Apply(d.reservations.Apply(d.state.GetResources()))
+	if d.qualifiedAttributeNames {
+		return helpers.QualifyAttributeNames(resources, device.DriverName)
+	}
+
+	return resources
+}
+
+// Topology returns the device topology served on the metrics port.
+func (d *driver) Topology() helpers.Topology {
+	return d.state.Topology()
+}
+
+// Snapshot returns the node state served on the metrics port.
+func (d *driver) Snapshot() helpers.NodeStateSnapshot {
+	return d.state.Snapshot()
+}
+
+// Capabilities returns the driver capabilities served on the metrics port.
+func (d *driver) Capabilities() helpers.Capabilities {
+	return helpers.NewCapabilities(device.DriverName, map[string]bool{
+		helpers.FeatureAuditLog:                d.auditLog != nil,
+		helpers.FeatureAllocationHook:          d.allocationHook != nil,
+		helpers.FeatureQualifiedAttributeNames: d.qualifiedAttributeNames,
+		helpers.FeatureHealthMonitoring:        d.hlmlShutdown != nil,
+		"deviceExclusion":                      d.excludeFilter != nil,
+	})
+}
+
+// startupSummary returns the summary of the driver state after startup.
+func (d *driver) startupSummary() helpers.StartupSummary {
+	summary := helpers.StartupSummary{
+		NodeName:     d.state.NodeName,
+		Capabilities: d.Capabilities(),
+	}
+
+	d.state.Lock()
+	defer d.state.Unlock()
+
+	allocatableDevices, _ := d.state.Allocatable.(map[string]*device.DeviceInfo)
+	modules := map[uint64]bool{}
+	for _, gaudi := range allocatableDevices {
+		model := gaudi.ModelName
+		if model == "" {
+			model = gaudi.Model
+		}
+		summary.Devices = append(summary.Devices, helpers.SummaryDevice{Type: "gaudi", Model: model, Health: helpers.SummaryHealth(gaudi.Healthy)})
+		modules[gaudi.ModuleIdx] = true
+	}
+	summary.CDIDevices = helpers.CountCDIDevices(d.state.CdiCache, device.CDIKind)
+	summary.PreparedClaims = len(d.state.Prepared)
+	summary.Details = []any{"modules", len(modules)}
+
+	return summary
+}
+
 func (d *driver) PublishResourceSlice(ctx context.Context) error {
-	resources := d.state.GetResources()
+	resources := d.GetResources()
 	klog.FromContext(ctx).Info("Publishing resources", "len", len(resources.Pools[d.state.NodeName].Slices[0].Devices))
 	klog.V(5).Infof("devices: %+v", resources.Pools[d.state.NodeName].Slices[0].Devices)
 	if err := d.helper.PublishResources(ctx, resources); err != nil {
-		return fmt.Errorf("error publishing resources: %v", err)
+		return fmt.Errorf("error publishing resources: %w", err)
 	}
+	d.republisher.Published(resources)
 
 	return nil
 }
@@ -206,34 +398,27 @@ func (d *driver) PublishResourceSlice(ctx context.Context) error {
 // - dropped fields (see [resourceslice.DroppedFieldsError])
 // - validation errors (see [apierrors.IsInvalid]).
 func (d *driver) HandleError(ctx context.Context, err error, message string) {
-	if errors.Is(err, kubeletplugin.ErrRecoverable) {
-		// TODO: FIXME: error is ignored ATM, handle it properly.
-		klog.FromContext(ctx).Error(err, "DRAPlugin encountered an error.")
-	} else {
-		klog.FromContext(ctx).Error(err, "Unrecoverable error.")
-	}
-
-	runtime.HandleErrorWithContext(ctx, err, message)
+	d.errorHandler.HandleError(ctx, err, message)
 }
 
 func (d *driver) Shutdown(ctx context.Context) error {
 	klog.V(5).Info("Shutting down driver")
 
-	d.helper.Stop()
+	return helpers.Drain(ctx, func() {
+		d.helper.Stop()
 
-	// When health monitoring with HLML was initiated, d.hlmlShutdown will get
-	// context cancel function, which we can call to signal health monitoring
-	// goroutine to stop.
-	if d.hlmlShutdown != nil {
-		d.hlmlShutdown()
+		// When health monitoring with HLML was initiated, d.hlmlShutdown will get
+		// context cancel function, which we can call to signal health monitoring
+		// goroutine to stop.
+		if d.hlmlShutdown != nil {
+			d.hlmlShutdown()
 
-		time.Sleep(1 * time.Second)
+			time.Sleep(1 * time.Second)
 
-		err := hlml.Shutdown()
-		if err != nil {
-			klog.Errorf("failed to shutdown HLML: %v", err)
+			err := hlml.Shutdown()
+			if err != nil {
+				klog.Errorf("failed to shutdown HLML: %v", err)
+			}
 		}
-	}
-
-	return nil
+	})
 }
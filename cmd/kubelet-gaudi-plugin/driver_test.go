@@ -23,14 +23,18 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"slices"
 	"testing"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	resourcev1 "k8s.io/api/resource/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	kubefake "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
@@ -74,23 +78,26 @@ func TestGaudiFakeSysfs(t *testing.T) {
 }
 
 func getFakeDriver(testDirs testhelpers.TestDirsType, healthcare bool) (*driver, error) {
-	nodeName := "node1"
-	gaudiFlags := GaudiFlags{
+	return getFakeDriverWithFlags(testDirs, &GaudiFlags{
 		Healthcare:         healthcare,
 		HealthcareInterval: 1,
 		GaudiHookPath:      path.Join(testDirs.TestRoot, "hookbin"),
 		GaudinetPath:       path.Join(testDirs.TestRoot, "gaudinet"),
-	}
+	})
+}
 
+func getFakeDriverWithFlags(testDirs testhelpers.TestDirsType, gaudiFlags *GaudiFlags) (*driver, error) {
+	nodeName := "node1"
 	config := &helpers.Config{
 		CommonFlags: &helpers.Flags{
 			NodeName:                  nodeName,
 			CdiRoot:                   testDirs.CdiRoot,
 			KubeletPluginDir:          testDirs.KubeletPluginDir,
 			KubeletPluginsRegistryDir: testDirs.KubeletPluginRegistryDir,
+			CDISyncTimeout:            helpers.DefaultCDISyncTimeout,
 		},
 		Coreclient:  kubefake.NewClientset(),
-		DriverFlags: &gaudiFlags,
+		DriverFlags: gaudiFlags,
 	}
 
 	os.Setenv("SYSFS_ROOT", testDirs.SysfsRoot)
@@ -113,6 +120,89 @@ func getFakeDriver(testDirs testhelpers.TestDirsType, healthcare bool) (*driver,
 	return driver, err
 }
 
+// newClaimWithParameters returns a claim allocated with Gaudi opaque configuration parameters.
+func newClaimWithParameters(claimName, claimUID, request, deviceUID, parameters string) *resourcev1.ResourceClaim {
+	claim := testhelpers.NewClaim("default", claimName, claimUID, request, device.DriverName, "node1", []string{deviceUID}, false)
+	claim.Status.Allocation.Devices.Config = []resourcev1.DeviceAllocationConfiguration{
+		{
+			Source: resourcev1.AllocationConfigSourceClaim,
+			DeviceConfiguration: resourcev1.DeviceConfiguration{
+				Opaque: &resourcev1.OpaqueDeviceConfiguration{
+					Driver:     device.DriverName,
+					Parameters: runtime.RawExtension{Raw: []byte(parameters)},
+				},
+			},
+		},
+	}
+
+	return claim
+}
+
+func TestGetGaudiFlags(t *testing.T) {
+	testcases := []struct {
+		name        string
+		flags       GaudiFlags
+		expectedErr bool
+	}{
+		{name: "defaults", flags: GaudiFlags{Healthcare: true, HealthcareInterval: 5}},
+		{name: "index without health monitoring", flags: GaudiFlags{HealthcareInterval: 5, HLVisibleDevicesBy: HLVisibleDevicesByIndex}},
+		{name: "uuid with health monitoring", flags: GaudiFlags{Healthcare: true, HealthcareInterval: 5, HLVisibleDevicesBy: HLVisibleDevicesByUUID}},
+		{name: "uuid without health monitoring", flags: GaudiFlags{HealthcareInterval: 5, HLVisibleDevicesBy: HLVisibleDevicesByUUID}},
+		{name: "unknown identifier", flags: GaudiFlags{Healthcare: true, HealthcareInterval: 5, HLVisibleDevicesBy: "serial"}, expectedErr: true},
+		{name: "interval out of range", flags: GaudiFlags{Healthcare: true, HealthcareInterval: 0}, expectedErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := getGaudiFlags(&tc.flags)
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestHLVisibleDevicesByUUID(t *testing.T) {
+	testcases := []struct {
+		name        string
+		serial      string
+		expectedErr bool
+	}{
+		{name: "serial in sysfs", serial: "AN12345678"},
+		{name: "no serial in sysfs", expectedErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+			defer testhelpers.CleanupTest(t, "TestHLVisibleDevicesByUUID", testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("setup error: %v", err)
+			}
+
+			fakeGaudis := device.DevicesInfo{
+				"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, UID: "0000-0f-00-0-0x1020", PCIRoot: "pci0000:01", Serial: tc.serial},
+			}
+			if err := fakesysfs.FakeSysFsGaudiContents(testDirs.TestRoot, testDirs.SysfsRoot, testDirs.DevfsRoot, fakeGaudis, false); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			driver, err := getFakeDriverWithFlags(testDirs, &GaudiFlags{HealthcareInterval: 1, HLVisibleDevicesBy: HLVisibleDevicesByUUID})
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error %v, got %v", tc.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+			if identifier := driver.state.hlVisibleDevice(driver.state.AllocatableByPCIAddress("0000:0f:00.0")); identifier != tc.serial {
+				t.Errorf("expected HL_VISIBLE_DEVICES identifier %v, got %v", tc.serial, identifier)
+			}
+		})
+	}
+}
+
 func TestGaudiPrepareResourceClaims(t *testing.T) {
 	type testCase struct {
 		name                   string
@@ -172,6 +262,35 @@ func TestGaudiPrepareResourceClaims(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "control node only",
+			request: []*resourcev1.ResourceClaim{
+				newClaimWithParameters("claim6", "uid6", "request6", "0000-00-03-0-0x1020", `{"apiVersion":"gaudi.intel.com/v1alpha1","kind":"GaudiConfig","controlOnly":true}`),
+			},
+			expectedResponse: map[types.UID]kubeletplugin.PrepareResult{
+				"uid6": {
+					Devices: []kubeletplugin.Device{
+						{Requests: []string{"request6"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-03-0-0x1020-control", "intel.com/gaudi=uid6"}},
+					},
+				},
+			},
+			expectedPreparedClaims: helpers.ClaimPreparations{
+				"uid6": {
+					Devices: []kubeletplugin.Device{
+						{Requests: []string{"request6"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-03-0-0x1020-control", "intel.com/gaudi=uid6"}},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid claim parameters",
+			request: []*resourcev1.ResourceClaim{
+				newClaimWithParameters("claim7", "uid7", "request7", "0000-00-03-0-0x1020", `{"controlOnly":true,"cardNode":false}`),
+			},
+			expectedResponse: map[types.UID]kubeletplugin.PrepareResult{
+				"uid7": {Err: fmt.Errorf("invalid gaudi.intel.com parameters for request 'request7': json: unknown field \"cardNode\"")},
+			},
+		},
 		{
 			name: "single unavailable device",
 			request: []*resourcev1.ResourceClaim{
@@ -385,3 +504,102 @@ func TestGaudiUnprepareResourceClaims(t *testing.T) {
 		}
 	}
 }
+
+func TestGaudiReconcileCDI(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestGaudiReconcileCDI", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGaudiContents(
+		testDirs.TestRoot,
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-b3-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:b3:00.0", DeviceIdx: 0, UID: "0000-b3-00-0-0x1020", PCIRoot: "pci0000:01"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	// Blank devices of the claims are missing and the device of uid2 is gone.
+	preparedClaimFilePath := path.Join(testDirs.KubeletPluginDir, "preparedClaims.json")
+	if err := helpers.WritePreparedClaimsToFile(preparedClaimFilePath, helpers.ClaimPreparations{
+		"uid1": {Devices: []kubeletplugin.Device{{Requests: []string{"request1"}, PoolName: "node1", DeviceName: "0000-b3-00-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-b3-00-0-0x1020", "intel.com/gaudi=uid1"}}}},
+		"uid2": {Devices: []kubeletplugin.Device{{Requests: []string{"request1"}, PoolName: "node1", DeviceName: "0000-ff-00-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-ff-00-0-0x1020", "intel.com/gaudi=uid2"}}}},
+	}); err != nil {
+		t.Fatalf("setup error: could not write prepared claims: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs, NoHealthcare)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	result, err := driver.state.reconcileCDI()
+	if err != nil {
+		t.Fatalf("unexpected reconcile error: %v", err)
+	}
+	if expected := (helpers.ReconcileResult{RecreatedClaims: 1, DroppedClaims: 1}); result != expected {
+		t.Errorf("expected reconcile result %+v, got %+v", expected, result)
+	}
+
+	preparedClaims, err := helpers.ReadPreparedClaimsFromFile(preparedClaimFilePath)
+	if err != nil {
+		t.Fatalf("could not read prepared claims: %v", err)
+	}
+	if _, found := preparedClaims["uid2"]; found || len(preparedClaims) != 1 {
+		t.Errorf("expected only claim uid1 to stay prepared, got %v", preparedClaims)
+	}
+
+	// The CDI cache picks up written specs asynchronously.
+	waitForCDIDevices(driver.state.CdiCache, "intel.com/gaudi=0000-b3-00-0-0x1020", "intel.com/gaudi=0000-b3-00-0-0x1020-control", "intel.com/gaudi=uid1")
+	blankDevice := driver.state.CdiCache.GetDevice("intel.com/gaudi=uid1")
+	if blankDevice == nil {
+		t.Fatal("expected blank CDI device of claim uid1 to be recreated")
+	}
+	if env := blankDevice.ContainerEdits.Env; len(env) == 0 || env[0] != device.VisibleDevicesEnvVarName+"=0" {
+		t.Errorf("unexpected blank CDI device env: %v", env)
+	}
+
+	// Specs removed manually are written again with the blank device.
+	specFiles, err := os.ReadDir(testDirs.CdiRoot)
+	if err != nil {
+		t.Fatalf("could not list CDI specs: %v", err)
+	}
+	for _, specFile := range specFiles {
+		if err := os.Remove(path.Join(testDirs.CdiRoot, specFile.Name())); err != nil {
+			t.Fatalf("could not remove CDI spec: %v", err)
+		}
+	}
+	waitForCDIDevices(driver.state.CdiCache)
+
+	result, err = driver.state.reconcileCDI()
+	if err != nil {
+		t.Fatalf("unexpected reconcile error: %v", err)
+	}
+	if expected := (helpers.ReconcileResult{RecreatedClaims: 1}); result != expected {
+		t.Errorf("expected reconcile result %+v, got %+v", expected, result)
+	}
+	waitForCDIDevices(driver.state.CdiCache, "intel.com/gaudi=0000-b3-00-0-0x1020", "intel.com/gaudi=0000-b3-00-0-0x1020-control", "intel.com/gaudi=uid1")
+	for _, cdiDevice := range []string{"intel.com/gaudi=0000-b3-00-0-0x1020", "intel.com/gaudi=uid1"} {
+		if driver.state.CdiCache.GetDevice(cdiDevice) == nil {
+			t.Errorf("expected CDI device %v to be recreated", cdiDevice)
+		}
+	}
+}
+
+// waitForCDIDevices waits for a while until the CDI cache lists exactly the
+// given devices.
+func waitForCDIDevices(cdiCache *cdiapi.Cache, cdiDevices ...string) {
+	slices.Sort(cdiDevices)
+	for range 50 {
+		if slices.Equal(cdiCache.ListDevices(), cdiDevices) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
 
 const (
@@ -69,11 +70,19 @@ func (d *driver) initHLML() error {
 			return fmt.Errorf("failed to get PCI bus ID of device at index %d: %v", i, err)
 		}
 
+		if d.excludeFilter.ExcludedPCIAddress(pciAddress) {
+			klog.V(5).Infof("Skipping excluded device %v", pciAddress)
+			continue
+		}
+
 		gaudi := d.state.AllocatableByPCIAddress(pciAddress)
 		if gaudi == nil {
 			return fmt.Errorf("could not find allocatable device with PCI address %v", pciAddress)
 		}
-		gaudi.Serial = serial
+		// sysfs serial is preferred, HLML fills in for older kernel drivers.
+		if gaudi.Serial == "" {
+			gaudi.Serial = serial
+		}
 	}
 
 	return nil
@@ -116,7 +125,9 @@ func (d *driver) updateHealth(ctx context.Context, healthy bool, uid string) {
 	}
 
 	d.createTaintRuleMaybe(ctx, uid)
+	before := d.state.AllocatableDevices()
 	foundDevice.Healthy = healthy
+	helpers.LogInventoryDiff(before, d.state.AllocatableDevices())
 	d.state.Unlock()
 
 	// Health is updated from a go routine, nothing we can do when publishing
@@ -31,6 +31,13 @@ type GaudiFlags struct {
 	GaudinetPath       string
 	Healthcare         bool
 	HealthcareInterval int
+	HLVisibleDevicesBy string
+	// Fail startup when several devices report the same module_id.
+	StrictModuleIDs bool
+	// Comma-separated module IDs and PCI addresses of devices withheld from DRA.
+	ExcludeModules string
+	ExcludePCI     string
+	DeviceNode     helpers.DeviceNodeConfig
 }
 
 const (
@@ -38,6 +45,15 @@ const (
 	HealthcareIntervalFlagMin     = 1
 	HealthcareIntervalFlagMax     = 3600
 	HealthcareIntervalFlagDefault = 5
+
+	// HL_VISIBLE_DEVICES identifier types.
+	HLVisibleDevicesByIndex   = "index"
+	HLVisibleDevicesByModule  = "module"
+	HLVisibleDevicesByUUID    = "uuid"
+	HLVisibleDevicesByDefault = HLVisibleDevicesByIndex
+
+	// metricsNamespace prefixes the driver metrics, e.g. gaudi_prepared_claims.
+	metricsNamespace = "gaudi"
 )
 
 func main() {
@@ -46,6 +62,7 @@ func main() {
 		GaudinetPath:       gaudi.DefaultGaudinetPath,
 		Healthcare:         HealthCareFlagDefault,
 		HealthcareInterval: HealthcareIntervalFlagDefault,
+		HLVisibleDevicesBy: HLVisibleDevicesByDefault,
 	}
 	cliFlags := []cli.Flag{
 		&cli.StringFlag{
@@ -80,7 +97,35 @@ func main() {
 			Destination: &gaudiFlags.HealthcareInterval,
 			EnvVars:     []string{"HEALTH_INTERVAL"},
 		},
+		&cli.StringFlag{
+			Name: "hl-visible-devices-by",
+			Usage: fmt.Sprintf("Identifier used in HL_VISIBLE_DEVICES: %v (accel device path), %v (module_id) or %v (device serial, startup fails when a device has no serial in sysfs and health-monitoring is disabled). Module and UUID are stable across reboots",
+				HLVisibleDevicesByIndex, HLVisibleDevicesByModule, HLVisibleDevicesByUUID),
+			Value:       HLVisibleDevicesByDefault,
+			Destination: &gaudiFlags.HLVisibleDevicesBy,
+			EnvVars:     []string{"HL_VISIBLE_DEVICES_BY"},
+		},
+		&cli.BoolFlag{
+			Name:        "strict-module-ids",
+			Usage:       "Fail startup when several devices report the same module_id (OAM slot) instead of only logging an error.",
+			Value:       false,
+			Destination: &gaudiFlags.StrictModuleIDs,
+			EnvVars:     []string{"STRICT_MODULE_IDS"},
+		},
+		&cli.StringFlag{
+			Name:        "exclude-modules",
+			Usage:       "Comma-separated list of module_id (OAM slot) numbers of devices that are not published in ResourceSlice, e.g. \"0,7\"",
+			Destination: &gaudiFlags.ExcludeModules,
+			EnvVars:     []string{"EXCLUDE_MODULES"},
+		},
+		&cli.StringFlag{
+			Name:        "exclude-pci",
+			Usage:       "Comma-separated list of PCI addresses of devices that are not published in ResourceSlice, e.g. \"0000:0f:00.0\"",
+			Destination: &gaudiFlags.ExcludePCI,
+			EnvVars:     []string{"EXCLUDE_PCI"},
+		},
 	}
+	cliFlags = append(cliFlags, gaudiFlags.DeviceNode.Flags()...)
 
 	if err := helpers.NewApp(gaudi.DriverName, newDriver, cliFlags, &gaudiFlags).Run(os.Args); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -19,7 +19,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"maps"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -41,25 +44,33 @@ type nodeState struct {
 	*helpers.NodeState
 	gaudiHookPath string
 	gaudiNetPath  string
+	// Type of device identifiers in HL_VISIBLE_DEVICES: index, module or uuid.
+	hlVisibleDevicesBy string
+	// Maximum time to wait for written CDI specs to show up in the CDI cache.
+	cdiSyncTimeout time.Duration
+	// deviceNodePermissions are set on the device nodes in CDI specs.
+	deviceNodePermissions helpers.DeviceNodePermissions
 }
 
-func newNodeState(detectedDevices map[string]*device.DeviceInfo, cdiRoot, preparedClaimsFilePath, nodeName, gaudiHookPath, gaudiNetPath string) (*nodeState, error) {
+func newNodeState(detectedDevices map[string]*device.DeviceInfo, cdiRoot, preparedClaimsFilePath, nodeName, gaudiHookPath, gaudiNetPath, hlVisibleDevicesBy string, cdiSyncTimeout time.Duration, deviceNodePermissions helpers.DeviceNodePermissions) (*nodeState, error) {
 	for ddev := range detectedDevices {
 		klog.V(3).Infof("new device: %+v", ddev)
 	}
 
 	klog.V(5).Info("Refreshing CDI registry")
 	if err := cdiapi.Configure(cdiapi.WithSpecDirs(cdiRoot)); err != nil {
-		return nil, fmt.Errorf("unable to refresh the CDI registry: %v", err)
+		return nil, helpers.NewCDIError(helpers.CDIRegistryRefreshFailed, "", err)
 	}
 
 	cdiCache := cdiapi.GetDefaultCache()
 
-	if err := cdihelpers.AddDetectedDevicesToCDIRegistry(cdiCache, detectedDevices); err != nil {
-		return nil, fmt.Errorf("unable to add detected devices to CDI registry: %v", err)
+	if err := cdihelpers.AddDetectedDevicesToCDIRegistry(cdiCache, detectedDevices, deviceNodePermissions); err != nil {
+		return nil, fmt.Errorf("unable to add detected devices to CDI registry: %w", err)
 	}
 
-	time.Sleep(250 * time.Millisecond)
+	if err := helpers.WaitForCDIDevices(cdiCache, device.CDIKind, slices.Collect(maps.Keys(detectedDevices)), cdiSyncTimeout); err != nil {
+		klog.Warningf("CDI cache not in sync with written CDI specs: %v", err)
+	}
 
 	klog.V(5).Info("Allocatable devices after CDI registry refresh:")
 	for duid, ddev := range detectedDevices {
@@ -67,7 +78,7 @@ func newNodeState(detectedDevices map[string]*device.DeviceInfo, cdiRoot, prepar
 	}
 
 	// TODO: should be only create prepared claims, discard old preparations. Do we even need the snapshot?
-	preparedClaims, err := helpers.GetOrCreatePreparedClaims(preparedClaimsFilePath)
+	preparedClaims, preparedAt, err := helpers.GetOrCreatePreparedClaims(preparedClaimsFilePath)
 	if err != nil {
 		klog.Errorf("failed to get prepared claims: %v", err)
 		return nil, fmt.Errorf("failed to get prepared claims: %v", err)
@@ -80,11 +91,15 @@ func newNodeState(detectedDevices map[string]*device.DeviceInfo, cdiRoot, prepar
 			CdiCache:               cdiCache,
 			Allocatable:            detectedDevices,
 			Prepared:               preparedClaims,
+			PreparedAt:             preparedAt,
 			PreparedClaimsFilePath: preparedClaimsFilePath,
 			NodeName:               nodeName,
 		},
-		gaudiHookPath: gaudiHookPath,
-		gaudiNetPath:  gaudiNetPath,
+		gaudiHookPath:         gaudiHookPath,
+		gaudiNetPath:          gaudiNetPath,
+		hlVisibleDevicesBy:    hlVisibleDevicesBy,
+		cdiSyncTimeout:        cdiSyncTimeout,
+		deviceNodePermissions: deviceNodePermissions,
 	}
 
 	allocatableDevices, ok := state.Allocatable.(map[string]*device.DeviceInfo)
@@ -92,6 +107,10 @@ func newNodeState(detectedDevices map[string]*device.DeviceInfo, cdiRoot, prepar
 		return nil, fmt.Errorf("unexpected type for state.Allocatable")
 	}
 
+	if err := state.removeStaleCDIDevices(); err != nil {
+		klog.Errorf("failed to remove stale CDI devices: %v", err)
+	}
+
 	klog.V(5).Infof("Synced state with CDI and GaudiAllocationState: %+v", state)
 	for duid, ddev := range allocatableDevices {
 		klog.V(5).Infof("Allocatable device: %v : %+v", duid, ddev)
@@ -100,6 +119,65 @@ func newNodeState(detectedDevices map[string]*device.DeviceInfo, cdiRoot, prepar
 	return &state, nil
 }
 
+// removeStaleCDIDevices removes Gaudi CDI devices that are neither allocatable
+// devices nor blank devices of prepared claims.
+func (s *nodeState) removeStaleCDIDevices() error {
+	_, err := helpers.RemoveStaleCDIDevices(s.CdiCache, device.CDIKind, s.IsValidCDIDevice)
+
+	return err
+}
+
+// Snapshot returns the current node state for debugging.
+func (s *nodeState) Snapshot() helpers.NodeStateSnapshot {
+	return s.NodeState.Snapshot(s)
+}
+
+// AllocatableDevices implements helpers.SnapshotAdapter.
+func (s *nodeState) AllocatableDevices() []helpers.DeviceSnapshot {
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	devices := []helpers.DeviceSnapshot{}
+	for uid, gaudi := range allocatableDevices {
+		devices = append(devices, helpers.DeviceSnapshot{
+			UID: uid,
+			Attributes: map[string]string{
+				"model":      gaudi.ModelName,
+				"pciAddress": gaudi.PCIAddress,
+				"serial":     gaudi.Serial,
+				"healthy":    strconv.FormatBool(gaudi.Healthy),
+			},
+		})
+	}
+
+	return devices
+}
+
+// Allocations implements helpers.SnapshotAdapter, Gaudi devices are only
+// tracked through prepared claims.
+func (s *nodeState) Allocations() map[string][]string {
+	return nil
+}
+
+// Topology returns the devices with their location on the node.
+func (s *nodeState) Topology() helpers.Topology {
+	s.Lock()
+	defer s.Unlock()
+
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	devices := []helpers.TopologyDevice{}
+	for uid, gaudi := range allocatableDevices {
+		module := gaudi.ModuleIdx
+		devices = append(devices, helpers.TopologyDevice{
+			UID:        uid,
+			PCIAddress: gaudi.PCIAddress,
+			PCIRoot:    gaudi.PCIRoot,
+			NUMANode:   helpers.ReadNUMANode(path.Join(s.SysfsRoot, helpers.SysfsPCIDevicesPath, gaudi.PCIAddress)),
+			Module:     &module,
+		})
+	}
+
+	return helpers.NewTopology(s.NodeName, devices)
+}
+
 func (s *nodeState) GetResources() resourceslice.DriverResources {
 	s.Lock()
 	defer s.Unlock()
@@ -120,6 +198,9 @@ func (s *nodeState) GetResources() resourceslice.DriverResources {
 				"serial": {
 					StringValue: &gaudi.Serial,
 				},
+				"pciAddress": {
+					StringValue: &gaudi.PCIAddress,
+				},
 				"healthy": {
 					BoolValue: &gaudi.Healthy,
 				},
@@ -153,11 +234,11 @@ func (s *nodeState) GetResources() resourceslice.DriverResources {
 
 // cdiHabanaEnvVar ensures there is a CDI device with name == claimUID, that has
 // only env vars for Habana Runtime, without device nodes.
-func (s *nodeState) cdiHabanaEnvVar(claimUID string, visibleDevices string, visibleModules string, hlVisibleDevices string) error {
+func (s *nodeState) cdiHabanaEnvVar(claimUID string, envVars []string) error {
 	cdidev := s.CdiCache.GetDevice(claimUID)
 	if cdidev != nil { // overwrite the contents
 		cdidev.ContainerEdits = cdiSpecs.ContainerEdits{
-			Env: []string{visibleDevices, visibleModules, hlVisibleDevices},
+			Env: envVars,
 		}
 
 		// Save into the same spec where the device was found.
@@ -174,12 +255,12 @@ func (s *nodeState) cdiHabanaEnvVar(claimUID string, visibleDevices string, visi
 	newDevice := cdiSpecs.Device{
 		Name: claimUID,
 		ContainerEdits: cdiSpecs.ContainerEdits{
-			Env: []string{visibleDevices, visibleModules, hlVisibleDevices},
+			Env: envVars,
 		},
 	}
 
 	if err := cdihelpers.NewBlankDevice(s.CdiCache, newDevice, s.gaudiHookPath, s.gaudiNetPath); err != nil {
-		return fmt.Errorf("could not add CDI device into CDI registry: %v", err)
+		return fmt.Errorf("could not add CDI device into CDI registry: %w", err)
 	}
 
 	return nil
@@ -199,9 +280,9 @@ func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim
 		return err
 	}
 
-	s.Prepared[string(claim.UID)] = allocatedDevices
+	s.AddPreparedClaim(string(claim.UID), allocatedDevices)
 
-	if err = helpers.WritePreparedClaimsToFile(s.PreparedClaimsFilePath, s.Prepared); err != nil {
+	if err = s.WritePreparedClaims(); err != nil {
 		klog.Errorf("failed to write prepared claims to file: %v", err)
 		return fmt.Errorf("failed to write prepared claims to file: %v", err)
 	}
@@ -212,9 +293,7 @@ func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim
 
 func (s *nodeState) prepareAllocatedDevices(ctx context.Context, claim *resourcev1.ResourceClaim) (allocatedDevices kubeletplugin.PrepareResult, err error) {
 	allocatedDevices = kubeletplugin.PrepareResult{}
-	visibleDeviceIndices := []string{}
-	visibleModuleIndices := []string{}
-	hlVisibleDevicePaths := []string{}
+	gaudis := []*device.DeviceInfo{}
 	for _, allocatedDevice := range claim.Status.Allocation.Devices.Results {
 		// ATM the only pool is cluster node's pool: all devices on current node.
 		if allocatedDevice.Driver != device.DriverName || allocatedDevice.Pool != s.NodeName {
@@ -229,25 +308,28 @@ func (s *nodeState) prepareAllocatedDevices(ctx context.Context, claim *resource
 			return allocatedDevices, fmt.Errorf("could not find allocatable device %v (pool %v)", allocatedDevice.Device, allocatedDevice.Pool)
 		}
 
+		controlOnly, err := requestedControlOnly(claim, allocatedDevice.Request)
+		if err != nil {
+			return allocatedDevices, err
+		}
+		cdiName := allocatableDevice.CDIName()
+		if controlOnly {
+			cdiName = allocatableDevice.ControlOnlyCDIName()
+		}
+
 		newDevice := kubeletplugin.Device{
 			Requests:     []string{allocatedDevice.Request},
 			PoolName:     allocatedDevice.Pool,
 			DeviceName:   allocatedDevice.Device,
-			CDIDeviceIDs: []string{allocatableDevice.CDIName()},
+			CDIDeviceIDs: []string{cdiName},
 		}
 		allocatedDevices.Devices = append(allocatedDevices.Devices, newDevice)
 
-		visibleDeviceIndices = append(visibleDeviceIndices, fmt.Sprintf("%d", allocatableDevice.DeviceIdx))
-		visibleModuleIndices = append(visibleModuleIndices, fmt.Sprintf("%d", allocatableDevice.ModuleIdx))
-		hlVisibleDevicePaths = append(hlVisibleDevicePaths, fmt.Sprintf("/dev/accel/accel%d", allocatableDevice.DeviceIdx))
+		gaudis = append(gaudis, allocatableDevice)
 	}
 
 	if len(allocatedDevices.Devices) > 0 {
-		visibleDevicesEnvVar := fmt.Sprintf("%s=%s", device.VisibleDevicesEnvVarName, strings.Join(visibleDeviceIndices, ","))
-		visibleModulesEnvVar := fmt.Sprintf("%s=%s", device.VisibleModulesEnvVarName, strings.Join(visibleModuleIndices, ","))
-		hlVisibleDevicesEnvVar := fmt.Sprintf("%s=%s", device.HLVisibleDevicesEnvVarName, strings.Join(hlVisibleDevicePaths, ","))
-
-		if err := s.cdiHabanaEnvVar(string(claim.UID), visibleDevicesEnvVar, visibleModulesEnvVar, hlVisibleDevicesEnvVar); err != nil {
+		if err := s.cdiHabanaEnvVar(string(claim.UID), s.habanaEnvVars(gaudis)); err != nil {
 			return allocatedDevices, fmt.Errorf("failed to ensure Habana Runtime specific CDI device: %v", err)
 		}
 
@@ -258,6 +340,40 @@ func (s *nodeState) prepareAllocatedDevices(ctx context.Context, claim *resource
 	return allocatedDevices, nil
 }
 
+// habanaEnvVars returns the Habana Runtime env variables selecting the devices.
+func (s *nodeState) habanaEnvVars(gaudis []*device.DeviceInfo) []string {
+	visibleDeviceIndices := []string{}
+	visibleModuleIndices := []string{}
+	hlVisibleDevicePaths := []string{}
+	for _, gaudi := range gaudis {
+		visibleDeviceIndices = append(visibleDeviceIndices, fmt.Sprintf("%d", gaudi.DeviceIdx))
+		visibleModuleIndices = append(visibleModuleIndices, fmt.Sprintf("%d", gaudi.ModuleIdx))
+		hlVisibleDevicePaths = append(hlVisibleDevicePaths, s.hlVisibleDevice(gaudi))
+	}
+
+	return []string{
+		fmt.Sprintf("%s=%s", device.VisibleDevicesEnvVarName, strings.Join(visibleDeviceIndices, ",")),
+		fmt.Sprintf("%s=%s", device.VisibleModulesEnvVarName, strings.Join(visibleModuleIndices, ",")),
+		fmt.Sprintf("%s=%s", device.HLVisibleDevicesEnvVarName, strings.Join(hlVisibleDevicePaths, ",")),
+	}
+}
+
+// hlVisibleDevice returns the identifier of the device for HL_VISIBLE_DEVICES.
+// Accel device index can change after reboot, module_id and serial can not.
+func (s *nodeState) hlVisibleDevice(gaudi *device.DeviceInfo) string {
+	switch s.hlVisibleDevicesBy {
+	case HLVisibleDevicesByModule:
+		return fmt.Sprintf("%d", gaudi.ModuleIdx)
+	case HLVisibleDevicesByUUID:
+		if gaudi.Serial != "" {
+			return gaudi.Serial
+		}
+		klog.Warningf("device %v serial is unknown, falling back to accel index in %v", gaudi.UID, device.HLVisibleDevicesEnvVarName)
+	}
+
+	return fmt.Sprintf("/dev/accel/accel%d", gaudi.DeviceIdx)
+}
+
 func (s *nodeState) AllocatableByPCIAddress(pciAddress string) *device.DeviceInfo {
 	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
 	for _, device := range allocatableDevices {
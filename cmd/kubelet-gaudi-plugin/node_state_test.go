@@ -17,10 +17,13 @@
 package main
 
 import (
+	"os"
+	"path"
 	"reflect"
 	"testing"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
 
 func TestDeviceInfoDeepCopy(t *testing.T) {
@@ -35,3 +38,82 @@ func TestDeviceInfoDeepCopy(t *testing.T) {
 		t.Fatalf("device infos %v and %v do not match", di, dc)
 	}
 }
+
+func TestHLVisibleDevice(t *testing.T) {
+	gaudi := &device.DeviceInfo{UID: "0000-00-02-0-0x1020", DeviceIdx: 3, ModuleIdx: 5, Serial: "AN12345678"}
+	noSerial := &device.DeviceInfo{UID: "0000-00-03-0-0x1020", DeviceIdx: 4, ModuleIdx: 6}
+
+	tests := []struct {
+		name               string
+		hlVisibleDevicesBy string
+		gaudi              *device.DeviceInfo
+		expected           string
+	}{
+		{name: "index", hlVisibleDevicesBy: HLVisibleDevicesByIndex, gaudi: gaudi, expected: "/dev/accel/accel3"},
+		{name: "module", hlVisibleDevicesBy: HLVisibleDevicesByModule, gaudi: gaudi, expected: "5"},
+		{name: "uuid", hlVisibleDevicesBy: HLVisibleDevicesByUUID, gaudi: gaudi, expected: "AN12345678"},
+		{name: "uuid without serial falls back to index", hlVisibleDevicesBy: HLVisibleDevicesByUUID, gaudi: noSerial, expected: "/dev/accel/accel4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &nodeState{hlVisibleDevicesBy: tt.hlVisibleDevicesBy}
+			if got := s.hlVisibleDevice(tt.gaudi); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetResourcesPCIAddress(t *testing.T) {
+	s := &nodeState{
+		NodeState: &helpers.NodeState{
+			NodeName: "node1",
+			Allocatable: map[string]*device.DeviceInfo{
+				"0000-0f-00-0-0x1020": {UID: "0000-0f-00-0-0x1020", PCIAddress: "0000:0f:00.0", Healthy: true},
+			},
+		},
+	}
+
+	devices := s.GetResources().Pools["node1"].Slices[0].Devices
+	if len(devices) != 1 {
+		t.Fatalf("expected 1 device, got %d", len(devices))
+	}
+	if pciAddress := devices[0].Attributes["pciAddress"].StringValue; pciAddress == nil || *pciAddress != "0000:0f:00.0" {
+		t.Errorf("unexpected pciAddress attribute %v", pciAddress)
+	}
+}
+
+func TestTopology(t *testing.T) {
+	sysfsRoot := t.TempDir()
+	deviceDir := path.Join(sysfsRoot, helpers.SysfsPCIDevicesPath, "0000:0f:00.0")
+	if err := os.MkdirAll(deviceDir, 0755); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if err := os.WriteFile(path.Join(deviceDir, "numa_node"), []byte("1\n"), 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	s := &nodeState{
+		NodeState: &helpers.NodeState{
+			NodeName:  "node1",
+			SysfsRoot: sysfsRoot,
+			Allocatable: map[string]*device.DeviceInfo{
+				"0000-0f-00-0-0x1020": {UID: "0000-0f-00-0-0x1020", PCIAddress: "0000:0f:00.0", PCIRoot: "pci0000:0e", ModuleIdx: 3},
+				"0000-1f-00-0-0x1020": {UID: "0000-1f-00-0-0x1020", PCIAddress: "0000:1f:00.0", PCIRoot: "pci0000:1e", ModuleIdx: 0},
+			},
+		},
+	}
+
+	module3, module0 := uint64(3), uint64(0)
+	expected := helpers.Topology{
+		NodeName: "node1",
+		Devices: []helpers.TopologyDevice{
+			{UID: "0000-0f-00-0-0x1020", PCIAddress: "0000:0f:00.0", PCIRoot: "pci0000:0e", NUMANode: 1, Module: &module3},
+			{UID: "0000-1f-00-0-0x1020", PCIAddress: "0000:1f:00.0", PCIRoot: "pci0000:1e", NUMANode: helpers.NUMANodeUnknown, Module: &module0},
+		},
+	}
+	if topology := s.Topology(); !reflect.DeepEqual(topology, expected) {
+		t.Errorf("expected topology %+v, got %+v", expected, topology)
+	}
+}
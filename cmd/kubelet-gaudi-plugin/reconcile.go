@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	cdiparser "tags.cncf.io/container-device-interface/pkg/parser"
+
+	cdihelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/cdihelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+// reconcileCDI repairs drift between prepared claims and Gaudi CDI specs.
+func (s *nodeState) reconcileCDI() (helpers.ReconcileResult, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return helpers.ReconcileCDI(s.CdiCache, device.CDIKind, s)
+}
+
+// PreparedCDIDevices implements helpers.ReconcileAdapter.
+func (s *nodeState) PreparedCDIDevices() map[string][]string {
+	cdiDevices := map[string][]string{}
+	for claimUID, prepareResult := range s.Prepared {
+		for _, preparedDevice := range prepareResult.Devices {
+			cdiDevices[claimUID] = append(cdiDevices[claimUID], preparedDevice.CDIDeviceIDs...)
+		}
+	}
+
+	return cdiDevices
+}
+
+// PreparedClaimBacked implements helpers.ReconcileAdapter.
+func (s *nodeState) PreparedClaimBacked(claimUID string) bool {
+	_, err := s.preparedGaudis(claimUID)
+	return err == nil
+}
+
+// RecreateCDIDevices implements helpers.ReconcileAdapter. Rewriting the
+// device specs drops the blank devices, so then blank devices of all prepared
+// claims are recreated, otherwise only the blank device of the claim.
+func (s *nodeState) RecreateCDIDevices(claimUID string, missing []string) error {
+	blankDevice := cdiparser.QualifiedName(device.CDIVendor, device.CDIClass, claimUID)
+	claimUIDs := []string{claimUID}
+	if len(missing) != 1 || missing[0] != blankDevice {
+		allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+		if err := cdihelpers.AddDetectedDevicesToCDIRegistry(s.CdiCache, allocatableDevices, s.deviceNodePermissions); err != nil {
+			return fmt.Errorf("could not write CDI devices of claim %v: %w", claimUID, err)
+		}
+		// blank devices are added to the spec found in the CDI cache
+		if err := helpers.WaitForCDIDevices(s.CdiCache, device.CDIKind, slices.Collect(maps.Keys(allocatableDevices)), s.cdiSyncTimeout); err != nil {
+			klog.Warningf("CDI cache not in sync with written CDI specs: %v", err)
+		}
+		claimUIDs = slices.Collect(maps.Keys(s.Prepared))
+	}
+
+	for _, uid := range claimUIDs {
+		gaudis, err := s.preparedGaudis(uid)
+		if err != nil {
+			return err
+		}
+		if err := s.cdiHabanaEnvVar(uid, s.habanaEnvVars(gaudis)); err != nil {
+			return fmt.Errorf("could not recreate Habana Runtime specific CDI device of claim %v: %v", uid, err)
+		}
+	}
+
+	return nil
+}
+
+// DropPreparedClaim implements helpers.ReconcileAdapter.
+func (s *nodeState) DropPreparedClaim(claimUID string) error {
+	if err := cdihelpers.DeleteBlankDevices(s.CdiCache, claimUID); err != nil {
+		return fmt.Errorf("could not delete CDI device of claim %v: %w", claimUID, err)
+	}
+
+	delete(s.Prepared, claimUID)
+
+	if err := s.WritePreparedClaims(); err != nil {
+		return fmt.Errorf("failed to write prepared claims to file: %v", err)
+	}
+
+	return nil
+}
+
+// IsValidCDIDevice implements helpers.ReconcileAdapter, Gaudi CDI devices are
+// valid when backed by an allocatable device, or blank devices of prepared
+// claims.
+func (s *nodeState) IsValidCDIDevice(deviceName string) bool {
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	_, isAllocatable := allocatableDevices[strings.TrimSuffix(deviceName, device.CDIControlOnlySuffix)]
+	_, isPreparedClaim := s.Prepared[deviceName]
+
+	return isAllocatable || isPreparedClaim
+}
+
+// preparedGaudis returns the allocatable devices prepared for the claim, in
+// the order they were prepared in.
+func (s *nodeState) preparedGaudis(claimUID string) ([]*device.DeviceInfo, error) {
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	gaudis := []*device.DeviceInfo{}
+	for _, preparedDevice := range s.Prepared[claimUID].Devices {
+		gaudi, found := allocatableDevices[preparedDevice.DeviceName]
+		if !found {
+			return nil, fmt.Errorf("device %v of claim %v is gone", preparedDevice.DeviceName, claimUID)
+		}
+		gaudis = append(gaudis, gaudi)
+	}
+
+	return gaudis, nil
+}
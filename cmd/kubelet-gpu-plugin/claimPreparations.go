@@ -20,11 +20,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
 
 const (
@@ -43,6 +46,8 @@ type PreparedClaimsCheckpoint struct {
 type ClaimPreparations map[types.UID]ClaimPreparation
 type ClaimPreparation struct {
 	PreparedDevices []PreparedDevice
+	// PreparedAt is when the claim was prepared, zero in older checkpoints.
+	PreparedAt time.Time
 }
 
 type PreparedDevices []PreparedDevice
@@ -96,13 +101,43 @@ func UnmarshalClaimPreparations(data []byte) (ClaimPreparations, error) {
 }
 
 // GetOrCreatePreparedClaims reads a PreparedClaim from a file and deserializes it or creates the file.
+// An existing file is never overwritten, see helpers.CreateFileIfNotExists.
 func GetOrCreatePreparedClaims(preparedClaimFilePath string) (ClaimPreparations, error) {
-	if _, err := os.Stat(preparedClaimFilePath); os.IsNotExist(err) {
-		klog.V(5).Infof("could not find file %v. Creating file", preparedClaimFilePath)
-		return ClaimPreparations{}, WritePreparedClaimsToFile(preparedClaimFilePath, ClaimPreparations{})
+	if helpers.PreparedClaimsInMemory() {
+		if _, err := os.Stat(preparedClaimFilePath); os.IsNotExist(err) {
+			return ClaimPreparations{}, nil
+		}
+	}
+
+	emptyCheckpoint, err := encodePreparedClaims(ClaimPreparations{})
+	if err != nil {
+		return nil, err
 	}
 
-	return readPreparedClaimsFromFile(preparedClaimFilePath)
+	created, err := helpers.CreateFileIfNotExists(preparedClaimFilePath, emptyCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		klog.V(5).Infof("empty prepared claims file created %v", preparedClaimFilePath)
+		return ClaimPreparations{}, nil
+	}
+
+	preparedClaims, err := readPreparedClaimsFromFile(preparedClaimFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claims from checkpoints without prepare times count as prepared now.
+	now := time.Now()
+	for claimUID, claimPreparation := range preparedClaims {
+		if claimPreparation.PreparedAt.IsZero() {
+			claimPreparation.PreparedAt = now
+			preparedClaims[claimUID] = claimPreparation
+		}
+	}
+
+	return preparedClaims, nil
 }
 
 // readPreparedClaimsFromFile returns unmarshaled content for given prepared claims JSON file.
@@ -127,6 +162,15 @@ func readPreparedClaimsFromFile(preparedClaimFilePath string) (ClaimPreparations
 // WritePreparedClaimsToFile wraps PreparedClaims into versioned struct, serializes it
 // and writes it to a file.
 func WritePreparedClaimsToFile(preparedClaimFilePath string, preparedClaims ClaimPreparations) error {
+	encodedPreparedClaims, err := encodePreparedClaims(preparedClaims)
+	if err != nil {
+		return err
+	}
+	return helpers.WritePreparedClaimsBytes(preparedClaimFilePath, encodedPreparedClaims)
+}
+
+// encodePreparedClaims wraps PreparedClaims into versioned struct and serializes it.
+func encodePreparedClaims(preparedClaims ClaimPreparations) ([]byte, error) {
 	if preparedClaims == nil {
 		preparedClaims = ClaimPreparations{}
 	}
@@ -140,7 +184,7 @@ func WritePreparedClaimsToFile(preparedClaimFilePath string, preparedClaims Clai
 
 	encodedPreparedClaims, err := json.Marshal(newCheckpoint)
 	if err != nil {
-		return fmt.Errorf("prepared claims JSON encoding failed. Err: %v", err)
+		return nil, fmt.Errorf("prepared claims JSON encoding failed. Err: %v", err)
 	}
-	return os.WriteFile(preparedClaimFilePath, encodedPreparedClaims, 0600)
+	return encodedPreparedClaims, nil
 }
@@ -0,0 +1,47 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	resourcev1 "k8s.io/api/resource/v1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+var claimParametersType = helpers.ClaimParametersType{
+	APIVersion: device.DriverName + "/v1alpha1",
+	Kind:       "GPUConfig",
+}
+
+// ClaimParameters are GPU-specific opaque device configuration parameters in
+// ResourceClaim or DeviceClass, e.g.
+// {"apiVersion": "gpu.intel.com/v1alpha1", "kind": "GPUConfig", "cardNode": false}.
+type ClaimParameters struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	// CardNode controls whether the card control node is added to the container
+	// next to the render node. Defaults to true.
+	CardNode *bool `json:"cardNode,omitempty"`
+}
+
+// requestedCardNode returns whether the card control node is requested for the
+// claim request. DeviceClass configuration comes first in the claim allocation
+// results, so ResourceClaim configuration overrides it.
+func requestedCardNode(claim *resourcev1.ResourceClaim, request string) (bool, error) {
+	cardNode := true
+	parametersList, err := helpers.RequestClaimParameters[ClaimParameters](claim, device.DriverName, claimParametersType, request)
+	if err != nil {
+		return false, err
+	}
+
+	for _, parameters := range parametersList {
+		if parameters.CardNode != nil {
+			cardNode = *parameters.CardNode
+		}
+	}
+
+	return cardNode, nil
+}
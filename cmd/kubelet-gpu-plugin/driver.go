@@ -18,20 +18,21 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/containers/nri-plugins/pkg/udev"
 	resourceapi "k8s.io/api/resource/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/runtime"
 	coreclientset "k8s.io/client-go/kubernetes"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
 	"k8s.io/klog/v2"
 	drahealthv1alpha1 "k8s.io/kubelet/pkg/apis/dra-health/v1alpha1"
 
@@ -45,10 +46,28 @@ type driver struct {
 	client coreclientset.Interface
 	state  *nodeState
 	helper *kubeletplugin.Helper
+	// Records every claim preparation and unpreparation, nil when disabled.
+	auditLog *helpers.AuditLog
+	// Notifies an external system of every claim preparation and unpreparation, nil when disabled.
+	allocationHook *helpers.AllocationHook
+	// Claims with more devices are rejected, 0 means no limit.
+	maxDevicesPerClaim int
+	// Publish attribute names prefixed with the driver name.
+	qualifiedAttributeNames bool
+	// Republishes resources after recoverable kubelet plugin errors.
+	errorHandler *helpers.ErrorHandler
+	// Devices reserved with a Node annotation, nil in oneshot mode.
+	reservations *helpers.Reservations
+	// Withholds devices whose device nodes do not exist yet, nil when disabled and in oneshot mode.
+	readiness *helpers.DeviceReadiness
+	// Republishes resources that changed since last published, nil when disabled and in oneshot mode.
+	republisher *helpers.Republisher
 
 	// Flag to stop XPUMD listener and prevent it from attempting to connect to XPUMD.
 	stopXPUMDListener   bool
 	ignoreHealthWarning bool // true if devices with health warnings should still be considered as healthy.
+	// Per health type severities making devices unhealthy, overriding ignoreHealthWarning.
+	healthSeverities healthSeverities
 
 	// Health streaming support
 	healthStreams      map[int]chan *drahealthv1alpha1.NodeWatchResourcesResponse
@@ -56,6 +75,13 @@ type driver struct {
 	healthStreamID     int
 	healthcheck        *healthcheck
 
+	// Health backends and their latest reports, keyed by backend name.
+	healthBackends     []HealthBackend
+	healthReports      map[string]device.DevicesInfo
+	healthReportsMutex sync.Mutex
+	// Shuts the driver down gracefully, e.g. when the only health backend fails.
+	shutdown func(err error)
+
 	// Embed unimplemented server for forward compatibility
 	drahealthv1alpha1.UnimplementedDRAResourceHealthServer
 }
@@ -77,6 +103,31 @@ func newDriver(ctx context.Context, config *helpers.Config) (helpers.Driver, err
 		return nil, fmt.Errorf("get GPU flags: %w", err)
 	}
 
+	kernelDrivers, err := device.KernelDriverNames(gpuFlags.KernelDriver)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --gpu-driver: %v", err)
+	}
+
+	if gpuFlags.SharedDeviceClaims < 0 {
+		return nil, fmt.Errorf("invalid --shared-device-claims %v, must not be negative", gpuFlags.SharedDeviceClaims)
+	}
+
+	healthSeverities, err := parseHealthSeverities(gpuFlags.HealthSeverity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --health-severity: %v", err)
+	}
+
+	modelMillicores, err := device.ParseModelMillicores(gpuFlags.ModelMillicores)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --model-millicores: %v", err)
+	}
+
+	if gpuFlags.RuntimeConfig != "" {
+		helpers.CheckCDIRoot(config.CommonFlags.CdiRoot, strings.Split(gpuFlags.RuntimeConfig, ","))
+	}
+
+	registerMetrics()
+
 	driver := &driver{
 		client: config.Coreclient,
 		state: &nodeState{
@@ -84,47 +135,93 @@ func newDriver(ctx context.Context, config *helpers.Config) (helpers.Driver, err
 			SysfsRoot:              helpers.GetSysfsRoot(device.SysfsDRMpath),
 			NodeName:               config.CommonFlags.NodeName,
 		},
-		healthStreams:       make(map[int]chan *drahealthv1alpha1.NodeWatchResourcesResponse),
-		ignoreHealthWarning: gpuFlags.IgnoreHealthWarning,
+		healthStreams:           make(map[int]chan *drahealthv1alpha1.NodeWatchResourcesResponse),
+		ignoreHealthWarning:     gpuFlags.IgnoreHealthWarning,
+		healthSeverities:        healthSeverities,
+		auditLog:                helpers.NewAuditLog(config.CommonFlags.AuditLogPath, config.CommonFlags.AuditLogMaxSizeMiB),
+		allocationHook:          helpers.NewAllocationHook(config.CommonFlags.AllocationHook, device.DriverName, config.CommonFlags.AllocationHookTimeout),
+		maxDevicesPerClaim:      config.CommonFlags.MaxDevicesPerClaim,
+		qualifiedAttributeNames: config.CommonFlags.QualifiedAttributeNames,
+		shutdown:                config.Shutdown,
+	}
+
+	if gpuFlags.Healthcare {
+		gpuFlags.HealthBackends = preflightHealthBackends(gpuFlags.HealthBackends, gpuFlags.XPUMDSocketFilePath)
+		if strings.Trim(gpuFlags.HealthBackends, ", ") == "" {
+			klog.Error("No health backends left with sufficient privileges, disabling health monitoring")
+			gpuFlags.Healthcare = false
+		}
 	}
 
 	// If we run in privileged mode, device details can be obtained from devfs, otherwise XPUMD has
 	// to supply the details after at some point later when it's up.
-	detectedDevices := discovery.DiscoverDevices(driver.state.SysfsRoot, device.DefaultNamingStyle, gpuFlags.Healthcare)
+	detectedDevices := discovery.DiscoverDevices(ctx, driver.state.SysfsRoot, device.DefaultNamingStyle, gpuFlags.Healthcare, kernelDrivers, gpuFlags.DiscreteOnly, config.CommonFlags.DiscoveryTimeout, modelMillicores)
 	if len(detectedDevices) == 0 {
 		klog.Warning("No supported devices detected on this node")
 	}
+	preflightSRIOV(driver.state.SysfsRoot, detectedDevices)
 
-	if !gpuFlags.Healthcare {
+	if gpuFlags.Healthcare {
+		driver.healthBackends, err = newHealthBackends(driver, gpuFlags.HealthBackends, gpuFlags.XPUMDSocketFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure health backends: %v", err)
+		}
+	} else {
 		klog.V(5).Info("Healthcare is disabled, setting all device health to HealthUnknown")
 		for _, dev := range detectedDevices {
 			dev.Health = device.HealthUnknown
 		}
 	}
 
+	if selfTest := newSelfTest(gpuFlags.SelfTestCommand, gpuFlags.SelfTestTimeout); selfTest != nil {
+		klog.Infof("Running self-test of %d devices", len(detectedDevices))
+		selfTest.runAll(ctx, detectedDevices)
+	}
+
 	klog.V(3).Info("Creating new NodeState")
-	driver.state, err = newNodeState(detectedDevices, config.CommonFlags.CdiRoot, driver.state.PreparedClaimsFilePath, driver.state.SysfsRoot, driver.state.NodeName)
+	driver.state, err = newNodeState(detectedDevices, config.CommonFlags.CdiRoot, driver.state.PreparedClaimsFilePath, driver.state.SysfsRoot, driver.state.NodeName, config.CommonFlags.CDISyncTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new NodeState: %v", err)
 	}
+	driver.state.MemoryBytesAttribute = gpuFlags.MemoryBytesAttribute
+	driver.state.DiagnosticAttributes = gpuFlags.DiagnosticAttributes
+	driver.state.MaxClaimsPerDevice = gpuFlags.SharedDeviceClaims
+	driver.state.HealthObserveOnly = gpuFlags.HealthObserveOnly
+	driver.state.PoolPerModel = gpuFlags.PoolPerModel
+	driver.state.ModelMillicores = modelMillicores
+
+	driver.errorHandler = helpers.NewErrorHandler(driver.PublishResourceSlice, config.ShutdownOnFatalError())
+
+	// Nothing is started in oneshot mode, resources are only printed.
+	if config.CommonFlags.Oneshot {
+		return driver, nil
+	}
+
+	helpers.RegisterPreparedClaimsMetrics(metricsNamespace, driver.state.PreparedClaimTimes)
+	helpers.RegisterClaimOperationMetrics(metricsNamespace)
+	helpers.RegisterInventoryMetrics(metricsNamespace)
+
+	startupRetry := helpers.NewAPIStartupRetry(config.CommonFlags.APIStartupTimeout)
+	driver.reservations = helpers.NewReservations(device.DriverName)
+	if err := startupRetry.Do(ctx, "load device reservations", func(ctx context.Context) error {
+		return driver.reservations.Load(ctx, config.Coreclient, config.CommonFlags.NodeName)
+	}); err != nil {
+		return nil, fmt.Errorf("could not load device reservations: %v", err)
+	}
+	driver.readiness = helpers.NewDeviceReadiness(driver.state.CdiCache, device.CDIKind, config.CommonFlags.DeviceReadinessInterval)
+	driver.republisher = helpers.NewRepublisher(config.CommonFlags.RepublishInterval)
+	if gpuFlags.ReserveDisplayGPUs {
+		for deviceName, gpu := range detectedDevices {
+			if gpu.ActiveDisplay {
+				klog.Infof("Reserving GPU %v driving a connected display", deviceName)
+				driver.reservations.Pin(deviceName)
+			}
+		}
+	}
 
-	klog.Infof(`Starting DRA kubelet-plugin
-RegistrarDirectoryPath: %v
-PluginDataDirectoryPath: %v`,
-		config.CommonFlags.KubeletPluginsRegistryDir,
-		config.CommonFlags.KubeletPluginDir)
-
-	helper, err := kubeletplugin.Start(
-		ctx,
-		driver,
-		kubeletplugin.KubeClient(config.Coreclient),
-		kubeletplugin.NodeName(config.CommonFlags.NodeName),
-		kubeletplugin.DriverName(device.DriverName),
-		kubeletplugin.RegistrarDirectoryPath(config.CommonFlags.KubeletPluginsRegistryDir),
-		kubeletplugin.PluginDataDirectoryPath(config.CommonFlags.KubeletPluginDir),
-	)
+	helper, err := helpers.StartKubeletPlugin(ctx, driver, device.DriverName, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start kubelet-plugin: %v", err)
+		return nil, err
 	}
 	driver.helper = helper
 
@@ -143,27 +240,126 @@ PluginDataDirectoryPath: %v`,
 	}
 	driver.healthcheck = hc
 
-	// Enable monitoring health stream from xpumd 2.0+.
+	// Enable monitoring health from xpumd 2.0+ stream and / or sysfs.
 	if gpuFlags.Healthcare {
 		klog.Info("Starting health monitoring")
-		go driver.xpumdListen(ctx, gpuFlags.XPUMDSocketFilePath)
+		go driver.watchGPUHealthStatuses(ctx)
 
 		// Start device change watcher
 		go driver.watchDevices(ctx)
 	}
 
+	go driver.reservations.Watch(ctx, config.Coreclient, config.CommonFlags.NodeName, func() {
+		if err := driver.PublishResourceSlice(ctx); err != nil {
+			klog.Errorf("Could not publish device reservations: %v", err)
+		}
+	})
+
+	go driver.readiness.Watch(ctx, func() {
+		if err := driver.PublishResourceSlice(ctx); err != nil {
+			klog.Errorf("Could not publish devices that became ready: %v", err)
+		}
+	})
+
+	go driver.republisher.Run(ctx, driver.GetResources, driver.PublishResourceSlice)
+
+	go helpers.RunReconciler(ctx, config.CommonFlags.ReconcileInterval, driver.state.reconcileCDI)
+
+	helpers.LogStartupSummary(driver.startupSummary(gpuFlags))
+
 	klog.V(3).Info("Finished creating new driver")
 	return driver, nil
 }
 
+// GetResources returns the resources published in ResourceSlice.
+func (d *driver) GetResources() resourceslice.DriverResources {
+	resources := d.readiness.Apply(d.reservations.Apply(d.state.GetResources()))
+	if d.qualifiedAttributeNames {
+		return helpers.QualifyAttributeNames(resources, device.DriverName)
+	}
+
+	return resources
+}
+
+// Topology returns the device topology served on the metrics port.
+func (d *driver) Topology() helpers.Topology {
+	return d.state.Topology()
+}
+
+// Snapshot returns the node state served on the metrics port.
+func (d *driver) Snapshot() helpers.NodeStateSnapshot {
+	return d.state.Snapshot()
+}
+
+// Capabilities returns the driver capabilities served on the metrics port.
+func (d *driver) Capabilities() helpers.Capabilities {
+	features := map[string]bool{
+		helpers.FeatureAuditLog:                d.auditLog != nil,
+		helpers.FeatureAllocationHook:          d.allocationHook != nil,
+		helpers.FeatureQualifiedAttributeNames: d.qualifiedAttributeNames,
+		helpers.FeatureHealthMonitoring:        len(d.healthBackends) > 0,
+		"healthObserveOnly":                    d.state.HealthObserveOnly,
+		"timeSharing":                          d.state.MaxClaimsPerDevice > 1,
+		"sriov":                                d.state.sriovCapable(),
+	}
+	for _, backendName := range healthBackendPrecedence {
+		features[backendName+"Health"] = false
+	}
+	for _, backend := range d.healthBackends {
+		features[backend.Name()+"Health"] = true
+	}
+
+	return helpers.NewCapabilities(device.DriverName, features)
+}
+
+// startupSummary returns the summary of the driver state after startup.
+func (d *driver) startupSummary(gpuFlags *GPUFlags) helpers.StartupSummary {
+	// Capabilities locks the state itself, so get it before locking.
+	summary := helpers.StartupSummary{
+		NodeName:     d.state.NodeName,
+		Capabilities: d.Capabilities(),
+	}
+
+	d.state.Lock()
+	defer d.state.Unlock()
+
+	allocatableDevices, _ := d.state.Allocatable.(map[string]*device.DeviceInfo)
+	for _, gpu := range allocatableDevices {
+		model := gpu.ModelName
+		if model == "" {
+			model = gpu.Model
+		}
+		summary.Devices = append(summary.Devices, helpers.SummaryDevice{Type: gpu.DeviceType, Model: model, Health: gpu.GetHealthState()})
+	}
+	summary.CDIDevices = helpers.CountCDIDevices(d.state.CdiCache, device.CDIKind)
+	summary.PreparedClaims = len(d.state.Prepared)
+
+	xpumdAvailable := false
+	if gpuFlags.Healthcare {
+		_, err := os.Stat(gpuFlags.XPUMDSocketFilePath)
+		xpumdAvailable = err == nil
+	}
+	summary.Details = []any{"xpumdAvailable", xpumdAvailable}
+
+	return summary
+}
+
 func (d *driver) PublishResourceSlice(ctx context.Context) error {
-	resources := d.state.GetResources()
+	resources := d.GetResources()
+
+	devices := []resourceapi.Device{}
+	for _, pool := range resources.Pools {
+		for _, slice := range pool.Slices {
+			devices = append(devices, slice.Devices...)
+		}
+	}
 
-	klog.FromContext(ctx).Info("Publishing resources", "len", len(resources.Pools[d.state.NodeName].Slices[0].Devices))
-	klog.V(5).Infof("devices: %+v", resources.Pools[d.state.NodeName].Slices[0].Devices)
+	klog.FromContext(ctx).Info("Publishing resources", "pools", len(resources.Pools), "len", len(devices))
+	klog.V(5).Infof("devices: %+v", devices)
 	if err := d.helper.PublishResources(ctx, resources); err != nil {
-		return fmt.Errorf("error publishing resources: %v", err)
+		return fmt.Errorf("error publishing resources: %w", err)
 	}
+	d.republisher.Published(resources)
 
 	return nil
 }
@@ -173,50 +369,129 @@ func (d *driver) PrepareResourceClaims(ctx context.Context, claims []*resourceap
 
 	response := map[types.UID]kubeletplugin.PrepareResult{}
 
+	var updateFound bool
 	for _, claim := range claims {
-		response[claim.UID] = d.prepareResourceClaim(ctx, claim)
+		var updated bool
+		start := time.Now()
+		response[claim.UID], updated = d.prepareResourceClaim(ctx, claim)
+		helpers.ObserveClaimOperation(helpers.ClaimOperationPrepare, start, response[claim.UID].Err)
+		updateFound = updateFound || updated
+	}
+
+	// Allocated attribute and remaining share capacity changed.
+	if updateFound {
+		if err := d.PublishResourceSlice(ctx); err != nil {
+			klog.Errorf("could not publish updated resource slice: %v", err)
+		}
 	}
 
 	return response, nil
 }
 
-func (d *driver) prepareResourceClaim(ctx context.Context, claim *resourceapi.ResourceClaim) kubeletplugin.PrepareResult {
+// prepareResourceClaim returns the prepare result of the claim, and true if
+// the claim was prepared now, changing the published resources.
+func (d *driver) prepareResourceClaim(ctx context.Context, claim *resourceapi.ResourceClaim) (kubeletplugin.PrepareResult, bool) {
 	klog.V(5).Infof("NodePrepareResource is called for claim %v", claim.UID)
 
-	if claimPreparation, found := d.state.Prepared[claim.UID]; found {
+	d.state.Lock()
+	claimPreparation, found := d.state.Prepared[claim.UID]
+	d.state.Unlock()
+	if found {
 		klog.V(3).Infof("Claim %v was already prepared, nothing to do", claim.UID)
-		return claimPreparation.PrepareResult()
+		return claimPreparation.PrepareResult(), false
+	}
+
+	if err := helpers.CheckClaimDeviceCount(claim, device.DriverName, d.maxDevicesPerClaim); err != nil {
+		return kubeletplugin.PrepareResult{
+			Err: fmt.Errorf("error preparing devices for claim %v: %v", claim.UID, err),
+		}, false
+	}
+
+	if err := d.reservations.CheckClaim(claim); err != nil {
+		return kubeletplugin.PrepareResult{
+			Err: fmt.Errorf("error preparing devices for claim %v: %v", claim.UID, err),
+		}, false
 	}
 
 	prepareResult, err := d.state.Prepare(ctx, claim)
 	if err != nil {
 		return kubeletplugin.PrepareResult{
 			Err: fmt.Errorf("error preparing devices for claim %v: %v", claim.UID, err),
-		}
+		}, false
 	}
 
-	return prepareResult
+	d.auditLog.RecordPrepareResult(helpers.AuditActionPrepare, string(claim.UID), claim.Namespace, prepareResult, "")
+	d.allocationHook.NotifyPrepareResult(ctx, helpers.AuditActionPrepare, string(claim.UID), claim.Namespace, prepareResult)
+
+	return prepareResult, true
 }
 
 func (d *driver) UnprepareResourceClaims(ctx context.Context, claims []kubeletplugin.NamespacedObject) (map[types.UID]error, error) {
 	klog.V(5).Infof("NodeUnprepareResource is called: number of claims: %d", len(claims))
 	response := map[types.UID]error{}
 
+	var updateFound bool
 	for _, claim := range claims {
-		if err := d.state.Unprepare(ctx, claim.UID); err != nil {
+		start := time.Now()
+		d.state.Lock()
+		claimPreparation, prepared := d.state.Prepared[claim.UID]
+		err := d.state.removePreparedClaim(claim.UID)
+		d.state.Unlock()
+		helpers.ObserveClaimOperation(helpers.ClaimOperationUnprepare, start, err)
+		if err != nil {
 			response[claim.UID] = fmt.Errorf("could not unprepare resource: %v", err)
-		} else {
-			response[claim.UID] = nil
+			continue
+		}
+
+		response[claim.UID] = nil
+		if prepared {
+			updateFound = true
+			d.auditLog.RecordPrepareResult(helpers.AuditActionUnprepare, string(claim.UID), claim.Namespace, claimPreparation.PrepareResult(), "")
+			d.allocationHook.NotifyPrepareResult(ctx, helpers.AuditActionUnprepare, string(claim.UID), claim.Namespace, claimPreparation.PrepareResult())
+		}
+	}
+
+	// Allocated attribute and remaining share capacity changed.
+	if updateFound {
+		if err := d.PublishResourceSlice(ctx); err != nil {
+			klog.Errorf("could not publish updated resource slice: %v", err)
 		}
 	}
 
 	return response, nil
 }
 
+// preflightSRIOV disables VF provisioning on the SR-IOV capable GPUs whose
+// sriov_numvfs the driver lacks the privileges to write, so that they are not
+// announced with the sriov attribute.
+func preflightSRIOV(sysfsRoot string, devices map[string]*device.DeviceInfo) {
+	checks := []helpers.PreflightCheck{}
+	gpus := []*device.DeviceInfo{}
+	for _, gpu := range devices {
+		if gpu.MaxVFs == 0 {
+			continue
+		}
+		checks = append(checks, helpers.PreflightCheck{
+			Feature: fmt.Sprintf("SR-IOV VF provisioning of GPU '%s'", gpu.PCIAddress),
+			Paths:   []string{path.Join(sysfsRoot, device.SysfsPCIBuspath, gpu.Driver, gpu.PCIAddress, "sriov_numvfs")},
+			Hint:    "Run the driver container privileged with /sys mounted writable.",
+		})
+		gpus = append(gpus, gpu)
+	}
+	failed := helpers.Preflight(checks)
+
+	for i, gpu := range gpus {
+		if _, found := failed[checks[i].Feature]; found {
+			gpu.MaxVFs = 0
+		}
+	}
+}
+
 func (d *driver) Shutdown(ctx context.Context) error {
-	d.healthcheck.stop()
-	d.helper.Stop()
-	return nil
+	return helpers.Drain(ctx, func() {
+		d.healthcheck.stop()
+		d.helper.Stop()
+	})
 }
 
 // HandleError is called by Kubelet when an error occures asyncronously, and
@@ -228,14 +503,7 @@ func (d *driver) Shutdown(ctx context.Context) error {
 // - dropped fields (see [resourceslice.DroppedFieldsError])
 // - validation errors (see [apierrors.IsInvalid]).
 func (d *driver) HandleError(ctx context.Context, err error, message string) {
-	if errors.Is(err, kubeletplugin.ErrRecoverable) {
-		// TODO: FIXME: error is ignored ATM, handle it properly.
-		klog.FromContext(ctx).Error(err, "DRAPlugin encountered an error.")
-	} else {
-		klog.Errorf("Unrecoverable error: %v", err)
-	}
-
-	runtime.HandleErrorWithContext(ctx, err, message)
+	d.errorHandler.HandleError(ctx, err, message)
 }
 
 // NodeWatchResources implements the DRAResourceHealth gRPC service.
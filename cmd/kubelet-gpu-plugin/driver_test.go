@@ -28,9 +28,12 @@ import (
 
 	core "k8s.io/api/core/v1"
 	resourceapi "k8s.io/api/resource/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 
 	"github.com/containers/nri-plugins/pkg/udev"
@@ -68,6 +71,10 @@ func TestGPUFakeSysfs(t *testing.T) {
 }
 
 func getFakeDriver(testDirs testhelpers.TestDirsType) (*driver, error) {
+	return getFakeDriverWithFlags(testDirs, &GPUFlags{})
+}
+
+func getFakeDriverWithFlags(testDirs testhelpers.TestDirsType, gpuFlags *GPUFlags) (*driver, error) {
 	nodeName := "node1"
 	config := &helpers.Config{
 		CommonFlags: &helpers.Flags{
@@ -75,9 +82,10 @@ func getFakeDriver(testDirs testhelpers.TestDirsType) (*driver, error) {
 			CdiRoot:                   testDirs.CdiRoot,
 			KubeletPluginDir:          testDirs.KubeletPluginDir,
 			KubeletPluginsRegistryDir: testDirs.KubeletPluginRegistryDir,
+			CDISyncTimeout:            helpers.DefaultCDISyncTimeout,
 		},
 		Coreclient:  kubefake.NewClientset(),
-		DriverFlags: &GPUFlags{}, // ensure correct type to avoid nil type assertion failure
+		DriverFlags: gpuFlags,
 	}
 
 	if err := os.MkdirAll(config.CommonFlags.KubeletPluginDir, 0755); err != nil {
@@ -424,7 +432,13 @@ func TestPrepareResourceClaims(t *testing.T) {
 			expectedPreparedClaims = ClaimPreparations{}
 		}
 
-		if !reflect.DeepEqual(expectedPreparedClaims, preparedClaims) {
+		for claimUID, claimPreparation := range preparedClaims {
+			if _, initial := testcase.initialPreparedClaims[claimUID]; !initial && claimPreparation.PreparedAt.IsZero() {
+				t.Errorf("%v: claim %v has no prepare time", testcase.name, claimUID)
+			}
+		}
+
+		if !reflect.DeepEqual(expectedPreparedClaims, withoutPreparedAt(preparedClaims)) {
 			t.Errorf(
 				"%v: unexpected PreparedClaims:%v, expected PreparedClaims: %v",
 				testcase.name, preparedClaims, expectedPreparedClaims,
@@ -560,7 +574,7 @@ func TestNodeUnprepareResources(t *testing.T) {
 			t.Errorf("%v: unexpected response: %+v, expected response: %v", testcase.name, response, testcase.expectedResponse)
 		}
 
-		if !reflect.DeepEqual(testcase.expectedPreparedClaims, preparedClaims) {
+		if !reflect.DeepEqual(testcase.expectedPreparedClaims, withoutPreparedAt(preparedClaims)) {
 			t.Errorf(
 				"%v: unexpected PreparedClaims: %+v, expected PreparedClaims: %+v",
 				testcase.name, preparedClaims, testcase.expectedPreparedClaims,
@@ -631,6 +645,7 @@ func TestRefreshDeviceOnDriverEvent(t *testing.T) {
 			Health:     device.HealthUnknown,
 		},
 	}
+	drv.state.ModelMillicores = device.ModelMillicores{"0x56c0": 2000}
 	//nolint:forcetypeassert
 	allocatable := drv.state.Allocatable.(map[string]*device.DeviceInfo)
 	drv.state.Unlock()
@@ -723,6 +738,7 @@ func TestRefreshDeviceOnDriverEvent(t *testing.T) {
 		allocatable[deviceUID].CurrentDriver = testcase.innitialCurrentDriver
 		allocatable[deviceUID].CardIdx = testcase.initialCardIdx
 		allocatable[deviceUID].RenderdIdx = testcase.initialRenderdIdx
+		allocatable[deviceUID].Millicores = device.DefaultMillicores
 		drv.state.PreparedClaimsFilePath = preparedClaimsFilePath
 		drv.state.SysfsRoot = testDirs.SysfsRoot
 
@@ -758,6 +774,9 @@ func TestRefreshDeviceOnDriverEvent(t *testing.T) {
 			t.Errorf("expected RenderdIdx to be %d, got %d", testcase.expectedRenderdIdx, updated.RenderdIdx)
 		}
 
+		if updated.Millicores != 2000 {
+			t.Errorf("expected model millicores to be applied to refreshed device, got %d", updated.Millicores)
+		}
 	}
 }
 
@@ -924,6 +943,163 @@ func TestShouldPublishResourceSlice(t *testing.T) {
 	}
 }
 
+func TestCapabilities(t *testing.T) {
+	d := &driver{
+		state: &nodeState{
+			Allocatable: map[string]*device.DeviceInfo{
+				"0000-00-02-0-0x56c0": {UID: "0000-00-02-0-0x56c0", MaxVFs: 8},
+			},
+			MaxClaimsPerDevice: 2,
+		},
+		healthBackends: []HealthBackend{&sysfsHealthBackend{}},
+	}
+
+	capabilities := d.Capabilities()
+	if capabilities.Driver != device.DriverName {
+		t.Errorf("expected driver %v, got %v", device.DriverName, capabilities.Driver)
+	}
+	expected := map[string]bool{
+		helpers.FeatureAuditLog:                false,
+		helpers.FeatureAllocationHook:          false,
+		helpers.FeatureQualifiedAttributeNames: false,
+		helpers.FeatureHealthMonitoring:        true,
+		"healthObserveOnly":                    false,
+		"timeSharing":                          true,
+		"sriov":                                true,
+		"xpumdHealth":                          false,
+		"sysfsHealth":                          true,
+	}
+	if !reflect.DeepEqual(capabilities.Features, expected) {
+		t.Errorf("expected features %v, got %v", expected, capabilities.Features)
+	}
+}
+
+func TestPreflightSRIOV(t *testing.T) {
+	sysfsRoot := t.TempDir()
+	devices := map[string]*device.DeviceInfo{
+		"0000-01-00-0-0x56c0": {PCIAddress: "0000:01:00.0", Driver: "i915", MaxVFs: 8},
+		"0000-02-00-0-0x56c0": {PCIAddress: "0000:02:00.0", Driver: "i915", MaxVFs: 8},
+	}
+
+	// sriov_numvfs below a regular file cannot be written.
+	driverDir := path.Join(sysfsRoot, device.SysfsPCIBuspath, "i915")
+	if err := os.MkdirAll(driverDir, 0750); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if err := os.WriteFile(path.Join(driverDir, "0000:02:00.0"), []byte{}, 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	preflightSRIOV(sysfsRoot, devices)
+
+	if maxVFs := devices["0000-01-00-0-0x56c0"].MaxVFs; maxVFs != 8 {
+		t.Errorf("expected VF provisioning to be kept on writable GPU, got max VFs %v", maxVFs)
+	}
+	if maxVFs := devices["0000-02-00-0-0x56c0"].MaxVFs; maxVFs != 0 {
+		t.Errorf("expected VF provisioning to be disabled on unwritable GPU, got max VFs %v", maxVFs)
+	}
+}
+
+func TestReservedDevices(t *testing.T) {
+	d := &driver{
+		state: &nodeState{
+			Allocatable: map[string]*device.DeviceInfo{
+				"0000-00-02-0-0x56c0": {UID: "0000-00-02-0-0x56c0", Model: "0x56c0", DeviceType: "gpu", Health: device.HealthHealthy},
+				"0000-00-03-0-0x56c0": {UID: "0000-00-03-0-0x56c0", Model: "0x56c0", DeviceType: "gpu", Health: device.HealthHealthy},
+			},
+			NodeName: "node1",
+		},
+		reservations: helpers.NewReservations(device.DriverName),
+	}
+	d.reservations.Update(map[string]string{d.reservations.Annotation(): "0000-00-02-0-0x56c0"})
+
+	for _, dev := range d.GetResources().Pools["node1"].Slices[0].Devices {
+		reserved := dev.Attributes[helpers.ReservedAttribute].BoolValue
+		if (reserved != nil) != (dev.Name == "0000-00-02-0-0x56c0") {
+			t.Errorf("unexpected reserved attribute of device %v: %v", dev.Name, reserved)
+		}
+	}
+
+	claim := testhelpers.NewClaim("namespace1", "claim1", "uid1", "request1", device.DriverName, "node1", []string{"0000-00-02-0-0x56c0"}, false)
+	response, err := d.PrepareResourceClaims(context.TODO(), []*resourceapi.ResourceClaim{claim})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if response["uid1"].Err == nil {
+		t.Error("expected claim with reserved device not to be prepared")
+	}
+}
+
+func TestNewDriverAPIUnavailable(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		timeout     time.Duration
+		expectError bool
+	}{
+		{name: "API server available", timeout: time.Minute},
+		{name: "API server briefly unavailable", failures: 1, timeout: time.Minute},
+		{name: "API server unavailable", failures: -1, timeout: 100 * time.Millisecond, expectError: true},
+		{name: "API server unavailable, no retries", failures: 1, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+			defer testhelpers.CleanupTest(t, "TestNewDriverAPIUnavailable", testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("could not create fake system dirs: %v", err)
+			}
+			t.Setenv("SYSFS_ROOT", testDirs.SysfsRoot)
+
+			reservations := helpers.NewReservations(device.DriverName)
+			node := &core.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:        "node1",
+				Annotations: map[string]string{reservations.Annotation(): "0000-00-02-0-0x56c0"},
+			}}
+			client := kubefake.NewClientset(node)
+			failures := tt.failures
+			client.PrependReactor("get", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if failures == 0 {
+					return false, nil, nil
+				}
+				failures--
+				return true, nil, apierrors.NewServiceUnavailable("starting")
+			})
+
+			config := &helpers.Config{
+				CommonFlags: &helpers.Flags{
+					NodeName:                  "node1",
+					CdiRoot:                   testDirs.CdiRoot,
+					KubeletPluginDir:          testDirs.KubeletPluginDir,
+					KubeletPluginsRegistryDir: testDirs.KubeletPluginRegistryDir,
+					CDISyncTimeout:            helpers.DefaultCDISyncTimeout,
+					APIStartupTimeout:         tt.timeout,
+				},
+				Coreclient:  client,
+				DriverFlags: &GPUFlags{},
+			}
+
+			helperdriver, err := newDriver(context.TODO(), config)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if err != nil {
+				return
+			}
+			defer func() { _ = helperdriver.Shutdown(context.TODO()) }()
+
+			d, ok := helperdriver.(*driver)
+			if !ok {
+				t.Fatalf("type assertion failed: expected driver, got %T", helperdriver)
+			}
+			if !d.reservations.Reserved("0000-00-02-0-0x56c0") {
+				t.Error("expected device reservations to be loaded")
+			}
+		})
+	}
+}
+
 func TestHandleError(t *testing.T) {
 	type testCase struct {
 		name    string
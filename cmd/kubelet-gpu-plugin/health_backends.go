@@ -0,0 +1,342 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+const (
+	XPUMDHealthBackendName = "xpumd"
+	SysfsHealthBackendName = "sysfs"
+
+	HealthBackendsDefault = XPUMDHealthBackendName
+
+	SysfsHealthPollInterval = 30 * time.Second
+
+	// Health types reported by the sysfs health backend.
+	SysfsHealthTemperature = "sysfs.temperature"
+	SysfsHealthHang        = "sysfs.hang"
+
+	// i915 reports this in the error state file when no GPU hang was captured.
+	noErrorStateCollected = "No error state collected"
+)
+
+// healthBackendPrecedence lists health backends from the most to the least
+// trusted one. When several backends report the same device, the report from
+// the backend listed first is used.
+var healthBackendPrecedence = []string{XPUMDHealthBackendName, SysfsHealthBackendName}
+
+// HealthBackend is a source of device health information.
+type HealthBackend interface {
+	// Name identifies the backend, it must be one of healthBackendPrecedence.
+	Name() string
+	// Watch blocks until ctx is canceled, passing every health report to
+	// driver.consumeHealthReport. An error is returned when the backend can no
+	// longer report health.
+	Watch(ctx context.Context) error
+}
+
+type xpumdHealthBackend struct {
+	driver         *driver
+	socketFilePath string
+}
+
+func (b *xpumdHealthBackend) Name() string {
+	return XPUMDHealthBackendName
+}
+
+func (b *xpumdHealthBackend) Watch(ctx context.Context) error {
+	return b.driver.xpumdListen(ctx, b.socketFilePath)
+}
+
+// sysfsHealthBackend periodically checks GPU thermal sensors and the hang error
+// state exposed by the kernel driver in sysfs. It is meant for nodes where
+// xpumd is not available.
+type sysfsHealthBackend struct {
+	driver   *driver
+	interval time.Duration
+}
+
+func (b *sysfsHealthBackend) Name() string {
+	return SysfsHealthBackendName
+}
+
+func (b *sysfsHealthBackend) Watch(ctx context.Context) error {
+	klog.V(3).Info("starting sysfs health monitoring")
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		b.driver.consumeHealthReport(ctx, b.Name(), b.devicesHealth())
+
+		select {
+		case <-ctx.Done():
+			klog.V(5).Info("sysfs health monitoring stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// devicesHealth returns the health of all allocatable devices as seen in sysfs.
+func (b *sysfsHealthBackend) devicesHealth() device.DevicesInfo {
+	b.driver.state.Lock()
+	sysfsRoot := b.driver.state.SysfsRoot
+	//nolint:forcetypeassert // We want the code to panic if our assumption turns out to be wrong.
+	allocatable := b.driver.state.Allocatable.(map[string]*device.DeviceInfo)
+	cards := make(map[string]uint64, len(allocatable))
+	for uid, dev := range allocatable {
+		cards[uid] = dev.CardIdx
+	}
+	b.driver.state.Unlock()
+
+	devicesInfo := device.DevicesInfo{}
+	for uid, cardIdx := range cards {
+		healthStatus := sysfsDeviceHealth(sysfsRoot, cardIdx)
+		overallHealth := device.HealthHealthy
+		for _, health := range healthStatus {
+			if health == device.HealthUnhealthy {
+				overallHealth = device.HealthUnhealthy
+			}
+		}
+
+		devicesInfo[uid] = &device.DeviceInfo{
+			UID:          uid,
+			HealthStatus: healthStatus,
+			Health:       overallHealth,
+		}
+	}
+
+	return devicesInfo
+}
+
+// sysfsDeviceHealth checks the DRM card sysfs directory for critical temperature
+// and captured GPU hangs. Only the health types that could be read are returned.
+func sysfsDeviceHealth(sysfsRoot string, cardIdx uint64) map[string]string {
+	cardDir := path.Join(sysfsRoot, device.SysfsDRMpath, fmt.Sprintf("card%d", cardIdx))
+	healthStatus := map[string]string{}
+
+	if overheated, found := sysfsTemperatureCritical(cardDir); found {
+		healthStatus[SysfsHealthTemperature] = device.HealthHealthy
+		if overheated {
+			healthStatus[SysfsHealthTemperature] = device.HealthUnhealthy
+		}
+	}
+
+	errorState, err := os.ReadFile(path.Join(cardDir, "error"))
+	if err == nil {
+		healthStatus[SysfsHealthHang] = device.HealthHealthy
+		if len(errorState) != 0 && !strings.HasPrefix(string(errorState), noErrorStateCollected) {
+			klog.V(5).Infof("card%d has captured GPU hang error state", cardIdx)
+			healthStatus[SysfsHealthHang] = device.HealthUnhealthy
+		}
+	}
+
+	return healthStatus
+}
+
+// sysfsTemperatureCritical compares hwmon temperature sensors of the card
+// against their critical thresholds. The second return value is false when no
+// sensor with a critical threshold was found.
+func sysfsTemperatureCritical(cardDir string) (bool, bool) {
+	inputFiles, err := filepath.Glob(path.Join(cardDir, "device/hwmon/hwmon*/temp*_input"))
+	if err != nil || len(inputFiles) == 0 {
+		return false, false
+	}
+
+	found := false
+	for _, inputFile := range inputFiles {
+		critFile := strings.TrimSuffix(inputFile, "_input") + "_crit"
+		temperature, inputErr := readSysfsInt(inputFile)
+		critical, critErr := readSysfsInt(critFile)
+		if inputErr != nil || critErr != nil {
+			continue
+		}
+
+		found = true
+		if temperature >= critical {
+			klog.V(5).Infof("%v: temperature %v reached critical threshold %v", inputFile, temperature, critical)
+			return true, true
+		}
+	}
+
+	return false, found
+}
+
+func readSysfsInt(filePath string) (int64, error) {
+	fileBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(string(fileBytes)), 10, 64)
+}
+
+// preflightHealthBackends returns the comma-separated list of health backends
+// without those the driver lacks the privileges for.
+func preflightHealthBackends(backendNames string, xpumdSocketFilePath string) string {
+	failed := helpers.Preflight([]helpers.PreflightCheck{{
+		Feature: XPUMDHealthBackendName + " health backend",
+		Paths:   []string{xpumdSocketFilePath},
+		Hint:    "Mount the xpumd socket directory writable into the driver container, or use the sysfs health backend.",
+	}})
+	if len(failed) == 0 {
+		return backendNames
+	}
+
+	remaining := []string{}
+	for _, name := range strings.Split(backendNames, ",") {
+		if strings.TrimSpace(name) != XPUMDHealthBackendName {
+			remaining = append(remaining, name)
+		}
+	}
+
+	return strings.Join(remaining, ",")
+}
+
+// newHealthBackends creates health backends from the comma-separated list of names.
+func newHealthBackends(d *driver, backendNames string, xpumdSocketFilePath string) ([]HealthBackend, error) {
+	backends := []HealthBackend{}
+	for _, name := range strings.Split(backendNames, ",") {
+		switch strings.TrimSpace(name) {
+		case XPUMDHealthBackendName:
+			backends = append(backends, &xpumdHealthBackend{driver: d, socketFilePath: xpumdSocketFilePath})
+		case SysfsHealthBackendName:
+			backends = append(backends, &sysfsHealthBackend{driver: d, interval: SysfsHealthPollInterval})
+		case "":
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported health backend %q, supported: %v", name, healthBackendPrecedence)
+		}
+	}
+
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no health backends configured")
+	}
+
+	return backends, nil
+}
+
+// watchGPUHealthStatuses starts all registered health backends.
+func (d *driver) watchGPUHealthStatuses(ctx context.Context) {
+	for _, backend := range d.healthBackends {
+		klog.Infof("Starting %v health backend", backend.Name())
+		go d.watchHealthBackend(ctx, backend)
+	}
+}
+
+// watchHealthBackend runs the health backend until ctx is canceled. When the
+// backend fails, its last report is dropped so that other backends take over.
+// Failure of the only backend is fatal.
+func (d *driver) watchHealthBackend(ctx context.Context, backend HealthBackend) {
+	err := backend.Watch(ctx)
+	if err == nil {
+		return
+	}
+
+	d.dropHealthReport(ctx, backend.Name())
+	if len(d.healthBackends) > 1 {
+		klog.Errorf("%v health backend failed, falling back to other health backends: %v", backend.Name(), err)
+		return
+	}
+
+	klog.Errorf("%v health backend failed, no other health backends configured: %v", backend.Name(), err)
+	if d.shutdown != nil {
+		d.shutdown(fmt.Errorf("%v health backend failed: %v", backend.Name(), err))
+	}
+}
+
+// dropHealthReport removes the report of the health backend, e.g. when it lost
+// connection, so that reports from other backends are used instead.
+func (d *driver) dropHealthReport(ctx context.Context, backendName string) {
+	d.healthReportsMutex.Lock()
+	_, found := d.healthReports[backendName]
+	d.healthReportsMutex.Unlock()
+	if !found {
+		return
+	}
+
+	klog.V(5).Infof("dropping %v health report", backendName)
+	d.consumeHealthReport(ctx, backendName, nil)
+}
+
+// consumeHealthReport stores the latest report from the health backend, merges
+// it with reports from other backends, and publishes the updated ResourceSlice
+// if needed.
+func (d *driver) consumeHealthReport(ctx context.Context, backendName string, report device.DevicesInfo) {
+	d.healthReportsMutex.Lock()
+	if d.healthReports == nil {
+		d.healthReports = map[string]device.DevicesInfo{}
+	}
+	if report == nil {
+		delete(d.healthReports, backendName)
+	} else {
+		d.healthReports[backendName] = report
+	}
+	devicesInfoUpdate := mergeHealthReports(d.healthReports)
+	d.healthReportsMutex.Unlock()
+
+	publishResourceSlice, err := d.state.applyDeviceUpdates(devicesInfoUpdate)
+	if err != nil {
+		klog.Errorf("could not apply health deltas: %v", err)
+		return
+	}
+
+	// Exit early if no device updates reported by applyDeviceUpdates().
+	if !publishResourceSlice {
+		return
+	}
+
+	// Health backends are run by go routines, nothing we can do when publishing
+	// resource slice fails, so error is only logged.
+	if err := d.PublishResourceSlice(ctx); err != nil {
+		klog.Errorf("could not publish updated resource slice: %v", err)
+	}
+
+	// Resource Health Pod Status.
+	// Broadcast health state to all connected health streams.
+	response := d.buildHealthResponse()
+	d.broadcastHealthUpdateWithResponse(response)
+}
+
+// mergeHealthReports combines per-backend reports into one. For every device the
+// report of the backend with the highest precedence is used.
+func mergeHealthReports(reports map[string]device.DevicesInfo) device.DevicesInfo {
+	merged := device.DevicesInfo{}
+	for _, backendName := range healthBackendPrecedence {
+		for uid, deviceInfo := range reports[backendName] {
+			if _, found := merged[uid]; !found {
+				merged[uid] = deviceInfo
+			}
+		}
+	}
+
+	return merged
+}
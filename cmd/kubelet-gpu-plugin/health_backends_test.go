@@ -0,0 +1,255 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	testhelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+func TestSysfsDeviceHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected map[string]string
+	}{
+		{
+			name:     "nothing to read",
+			files:    map[string]string{},
+			expected: map[string]string{},
+		},
+		{
+			name: "temperature below critical, no hang",
+			files: map[string]string{
+				"device/hwmon/hwmon3/temp1_input": "45000\n",
+				"device/hwmon/hwmon3/temp1_crit":  "105000\n",
+				"error":                           "No error state collected\n",
+			},
+			expected: map[string]string{
+				SysfsHealthTemperature: device.HealthHealthy,
+				SysfsHealthHang:        device.HealthHealthy,
+			},
+		},
+		{
+			name: "critical temperature and hang",
+			files: map[string]string{
+				"device/hwmon/hwmon3/temp1_input": "45000",
+				"device/hwmon/hwmon3/temp1_crit":  "105000",
+				"device/hwmon/hwmon3/temp2_input": "106000",
+				"device/hwmon/hwmon3/temp2_crit":  "105000",
+				"error":                           "GPU HANG: ecode 12:1:85dffffb",
+			},
+			expected: map[string]string{
+				SysfsHealthTemperature: device.HealthUnhealthy,
+				SysfsHealthHang:        device.HealthUnhealthy,
+			},
+		},
+		{
+			name: "temperature without critical threshold is ignored",
+			files: map[string]string{
+				"device/hwmon/hwmon3/temp1_input": "106000",
+			},
+			expected: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sysfsRoot := t.TempDir()
+			cardDir := path.Join(sysfsRoot, device.SysfsDRMpath, "card1")
+			if err := os.MkdirAll(cardDir, 0750); err != nil {
+				t.Fatalf("setup error: %v", err)
+			}
+			for fileName, content := range tt.files {
+				filePath := path.Join(cardDir, fileName)
+				if err := os.MkdirAll(path.Dir(filePath), 0750); err != nil {
+					t.Fatalf("setup error: %v", err)
+				}
+				if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+					t.Fatalf("setup error: %v", err)
+				}
+			}
+
+			healthStatus := sysfsDeviceHealth(sysfsRoot, 1)
+			if !reflect.DeepEqual(healthStatus, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, healthStatus)
+			}
+		})
+	}
+}
+
+func TestMergeHealthReports(t *testing.T) {
+	xpumdReport := device.DevicesInfo{
+		"0000-00-02-0-0x56c0": {UID: "0000-00-02-0-0x56c0", MemoryMiB: 8192, Health: device.HealthHealthy},
+	}
+	sysfsReport := device.DevicesInfo{
+		"0000-00-02-0-0x56c0": {UID: "0000-00-02-0-0x56c0", Health: device.HealthUnhealthy},
+		"0000-00-03-0-0x56c0": {UID: "0000-00-03-0-0x56c0", Health: device.HealthUnhealthy},
+	}
+
+	merged := mergeHealthReports(map[string]device.DevicesInfo{
+		SysfsHealthBackendName: sysfsReport,
+		XPUMDHealthBackendName: xpumdReport,
+	})
+
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(merged))
+	}
+	if merged["0000-00-02-0-0x56c0"] != xpumdReport["0000-00-02-0-0x56c0"] {
+		t.Errorf("expected xpumd report to take precedence, got %+v", merged["0000-00-02-0-0x56c0"])
+	}
+	if merged["0000-00-03-0-0x56c0"] != sysfsReport["0000-00-03-0-0x56c0"] {
+		t.Errorf("expected sysfs report for device not reported by xpumd, got %+v", merged["0000-00-03-0-0x56c0"])
+	}
+}
+
+func TestNewHealthBackends(t *testing.T) {
+	tests := []struct {
+		name          string
+		backendNames  string
+		expectedNames []string
+		expectError   bool
+	}{
+		{name: "default", backendNames: HealthBackendsDefault, expectedNames: []string{XPUMDHealthBackendName}},
+		{name: "both", backendNames: "sysfs, xpumd", expectedNames: []string{SysfsHealthBackendName, XPUMDHealthBackendName}},
+		{name: "unknown", backendNames: "xpumd,nvml", expectError: true},
+		{name: "empty", backendNames: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends, err := newHealthBackends(&driver{}, tt.backendNames, DefaultXPUMDSocketPath)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			names := []string{}
+			for _, backend := range backends {
+				names = append(names, backend.Name())
+			}
+			if !tt.expectError && !reflect.DeepEqual(names, tt.expectedNames) {
+				t.Errorf("expected backends %v, got %v", tt.expectedNames, names)
+			}
+		})
+	}
+}
+
+func TestPreflightHealthBackends(t *testing.T) {
+	// xpumd may not be up yet, a missing socket is not a privilege problem.
+	missingSocket := path.Join(t.TempDir(), "xpumd.sock")
+	if backends := preflightHealthBackends("xpumd,sysfs", missingSocket); backends != "xpumd,sysfs" {
+		t.Errorf("expected all health backends to be kept, got %q", backends)
+	}
+
+	// Socket path below a regular file cannot be written.
+	notDir := path.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notDir, []byte{}, 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if backends := preflightHealthBackends("xpumd,sysfs", path.Join(notDir, "xpumd.sock")); backends != "sysfs" {
+		t.Errorf("expected only sysfs health backend to be kept, got %q", backends)
+	}
+}
+
+// failingHealthBackend fails right away, as xpumd backend does when xpumd is unreachable.
+type failingHealthBackend struct {
+	name string
+}
+
+func (b *failingHealthBackend) Name() string {
+	return b.name
+}
+
+func (b *failingHealthBackend) Watch(ctx context.Context) error {
+	return fmt.Errorf("%v is unreachable", b.name)
+}
+
+func TestHealthBackendFallback(t *testing.T) {
+	tests := []struct {
+		name           string
+		backends       []HealthBackend
+		expectShutdown bool
+		expectedHealth string
+	}{
+		{
+			name:           "xpumd fails, sysfs takes over",
+			backends:       []HealthBackend{&failingHealthBackend{name: XPUMDHealthBackendName}, &sysfsHealthBackend{}},
+			expectedHealth: device.HealthUnhealthy,
+		},
+		{
+			name:           "only xpumd fails",
+			backends:       []HealthBackend{&failingHealthBackend{name: XPUMDHealthBackendName}},
+			expectShutdown: true,
+			expectedHealth: device.HealthHealthy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+			defer testhelpers.CleanupTest(t, "GPU TestHealthBackendFallback", testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("setup error creating test dirs: %v", err)
+			}
+			uid := "0000-00-02-0-0x56c0"
+			testDevices := device.DevicesInfo{
+				uid: {UID: uid, Model: "0x56c0", DeviceType: "gpu", Driver: "i915", CardIdx: 0, RenderdIdx: 128},
+			}
+			if err := fakesysfs.FakeSysFsGpuContents(testDirs.SysfsRoot, testDirs.DevfsRoot, testDevices, false); err != nil {
+				t.Fatalf("could not create fake sysfs: %v", err)
+			}
+
+			drv, err := getFakeDriver(testDirs)
+			if err != nil {
+				t.Fatalf("could not create fake driver: %v", err)
+			}
+			var shutdownErr error
+			drv.shutdown = func(err error) { shutdownErr = err }
+			drv.healthBackends = tt.backends
+
+			ctx := context.Background()
+			// xpumd still reports the device healthy, shadowing the sysfs report.
+			drv.consumeHealthReport(ctx, SysfsHealthBackendName, device.DevicesInfo{
+				uid: {UID: uid, Health: device.HealthUnhealthy},
+			})
+			drv.consumeHealthReport(ctx, XPUMDHealthBackendName, device.DevicesInfo{
+				uid: {UID: uid, Health: device.HealthHealthy},
+			})
+			if len(tt.backends) == 1 {
+				drv.dropHealthReport(ctx, SysfsHealthBackendName)
+			}
+
+			drv.watchHealthBackend(ctx, tt.backends[0])
+
+			if (shutdownErr != nil) != tt.expectShutdown {
+				t.Errorf("expected shutdown %v, got error %v", tt.expectShutdown, shutdownErr)
+			}
+			//nolint:forcetypeassert // We want the code to panic if our assumption turns out to be wrong.
+			allocatable := drv.state.Allocatable.(map[string]*device.DeviceInfo)
+			if health := allocatable[uid].Health; health != tt.expectedHealth {
+				t.Errorf("expected device health %v, got %v", tt.expectedHealth, health)
+			}
+		})
+	}
+}
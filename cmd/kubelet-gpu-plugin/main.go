@@ -19,6 +19,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
@@ -36,8 +38,33 @@ const (
 type GPUFlags struct {
 	Healthcare          bool
 	IgnoreHealthWarning bool // true if Warning status means healthy, false otherwise. Default: true
+	HealthObserveOnly   bool // true if health changes are only logged and counted, not published.
+	// Comma-separated <health type>=<severity> pairs overriding IgnoreHealthWarning per health type.
+	HealthSeverity      string
 	HealthcheckPort     int
 	XPUMDSocketFilePath string
+	HealthBackends      string
+	// Publish exact memory amount in bytes as a device attribute.
+	MemoryBytesAttribute bool
+	// Publish attributes meant for debugging: allocated, cardIndex and renderdIndex.
+	DiagnosticAttributes bool
+	// Publish one ResourceSlice pool per GPU model instead of a single node pool.
+	PoolPerModel bool
+	// Kernel driver(s) whose devices are discovered: i915, xe or both.
+	KernelDriver string
+	// Maximum number of claims sharing a device, 0 or 1 disables sharing.
+	SharedDeviceClaims int
+	// Comma-separated container runtime config files to verify the CDI root against.
+	RuntimeConfig string
+	// Skip integrated GPUs in discovery.
+	DiscreteOnly bool
+	// Reserve GPUs with a connected display, so that they are not allocated.
+	ReserveDisplayGPUs bool
+	// Command validating each device during discovery, empty disables the self-test.
+	SelfTestCommand string
+	SelfTestTimeout time.Duration
+	// Comma-separated <model>=<millicores> pairs overriding the millicores capacity per GPU model.
+	ModelMillicores string
 }
 
 func main() {
@@ -60,6 +87,18 @@ func main() {
 			Destination: &gpuFlags.IgnoreHealthWarning,
 			EnvVars:     []string{"IGNORE_HEALTH_WARNING"},
 		},
+		&cli.StringFlag{
+			Name:        "health-severity",
+			Usage:       "Comma-separated list of <health type>=<severity> pairs setting the lowest xpumd severity making a device unhealthy per health type: warning, critical or ignore, e.g. 'Memory=warning,FabricPort=ignore'. Other health types follow [-w|--ignore-health-warning].",
+			Destination: &gpuFlags.HealthSeverity,
+			EnvVars:     []string{"HEALTH_SEVERITY"},
+		},
+		&cli.StringFlag{
+			Name:        "model-millicores",
+			Usage:       "Comma-separated list of <model>=<millicores> pairs setting the millicores capacity of GPUs, where model is a PCI device ID, model name or product family, e.g. 'Max=2000,0x56c1=500'. Other GPUs have 1000 millicores.",
+			Destination: &gpuFlags.ModelMillicores,
+			EnvVars:     []string{"MODEL_MILLICORES"},
+		},
 		&cli.IntFlag{
 			Name:        "healthcheck-port",
 			Usage:       "gRPC health check port. Set to -1 to disable.",
@@ -75,6 +114,87 @@ func main() {
 			Destination: &gpuFlags.XPUMDSocketFilePath,
 			EnvVars:     []string{"XPUMD_SOCKET"},
 		},
+		&cli.StringFlag{
+			Name:        "health-backends",
+			Usage:       "Comma-separated list of health information sources: xpumd, sysfs. When both report a device, xpumd takes precedence. Requires [-m|--health-monitoring] to be enabled.",
+			Value:       HealthBackendsDefault,
+			Destination: &gpuFlags.HealthBackends,
+			EnvVars:     []string{"HEALTH_BACKENDS"},
+		},
+		&cli.BoolFlag{
+			Name:        "health-observe-only",
+			Usage:       "Log health status changes and count them in metrics, but do not mark unhealthy devices in ResourceSlice.",
+			Value:       false,
+			Destination: &gpuFlags.HealthObserveOnly,
+			EnvVars:     []string{"HEALTH_OBSERVE_ONLY"},
+		},
+		&cli.BoolFlag{
+			Name:        "memory-bytes-attribute",
+			Usage:       "Publish exact amount of device local memory as 'memoryBytes' attribute, in addition to 'memory' capacity in MiB.",
+			Value:       false,
+			Destination: &gpuFlags.MemoryBytesAttribute,
+			EnvVars:     []string{"MEMORY_BYTES_ATTRIBUTE"},
+		},
+		&cli.BoolFlag{
+			Name:        "diagnostic-attributes",
+			Usage:       "Publish 'allocated', 'cardIndex' and 'renderdIndex' attributes for debugging, on devices with room for them within the ResourceSlice attribute limit.",
+			Value:       false,
+			Destination: &gpuFlags.DiagnosticAttributes,
+			EnvVars:     []string{"DIAGNOSTIC_ATTRIBUTES"},
+		},
+		&cli.BoolFlag{
+			Name:        "pool-per-model",
+			Usage:       "Publish devices in one ResourceSlice pool per GPU model, named after the node and PCI device ID, instead of a single node pool.",
+			Value:       false,
+			Destination: &gpuFlags.PoolPerModel,
+			EnvVars:     []string{"POOL_PER_MODEL"},
+		},
+		&cli.StringFlag{
+			Name:        "gpu-driver",
+			Usage:       "Discover only GPUs bound to the given kernel driver: i915, xe or both.",
+			Value:       device.KernelDriverBoth,
+			Destination: &gpuFlags.KernelDriver,
+			EnvVars:     []string{"GPU_DRIVER"},
+		},
+		&cli.IntFlag{
+			Name:        "shared-device-claims",
+			Usage:       "Allow time-sharing each GPU by up to N claims at the same time. 0 or 1 means exclusive allocation. Requires DRAConsumableCapacity feature gate.",
+			Value:       0,
+			Destination: &gpuFlags.SharedDeviceClaims,
+			EnvVars:     []string{"SHARED_DEVICE_CLAIMS"},
+		},
+		&cli.StringFlag{
+			Name:        "runtime-config",
+			Usage:       "Comma-separated container runtime config files (glob patterns) to check that --cdi-root is one of the runtime CDI spec dirs. Empty disables the check.",
+			Value:       strings.Join(helpers.DefaultRuntimeConfigFiles, ","),
+			Destination: &gpuFlags.RuntimeConfig,
+			EnvVars:     []string{"RUNTIME_CONFIG"},
+		},
+		&cli.BoolFlag{
+			Name:        "discrete-only",
+			Usage:       "Discover only discrete GPUs, integrated GPUs are not published.",
+			Destination: &gpuFlags.DiscreteOnly,
+			EnvVars:     []string{"DISCRETE_ONLY"},
+		},
+		&cli.BoolFlag{
+			Name:        "reserve-display-gpus",
+			Usage:       "Reserve GPUs driving a connected display, so that they are not allocated to workloads disrupting the console.",
+			Destination: &gpuFlags.ReserveDisplayGPUs,
+			EnvVars:     []string{"RESERVE_DISPLAY_GPUS"},
+		},
+		&cli.StringFlag{
+			Name:        "self-test-command",
+			Usage:       "Command run for every device during discovery, devices for which it fails are published unhealthy. " + selfTestPCIAddressPlaceholder + " in arguments is replaced with the PCI address of the device. Empty disables the self-test.",
+			Destination: &gpuFlags.SelfTestCommand,
+			EnvVars:     []string{"SELF_TEST_COMMAND"},
+		},
+		&cli.DurationFlag{
+			Name:        "self-test-timeout",
+			Usage:       "Maximum time the self-test of a single device may take, 0 disables the timeout.",
+			Value:       SelfTestTimeoutDefault,
+			Destination: &gpuFlags.SelfTestTimeout,
+			EnvVars:     []string{"SELF_TEST_TIMEOUT"},
+		},
 	}
 
 	if err := helpers.NewApp(device.DriverName, newDriver, cliFlags, &gpuFlags).Run(os.Args); err != nil {
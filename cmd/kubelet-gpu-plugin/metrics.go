@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const metricsNamespace = "gpu"
+
+var (
+	// healthTransitions counts changes of per-type device health statuses.
+	healthTransitions = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "health_transitions_total",
+			Help:           "Number of device health status changes by device UID, health type and new status.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"device", "type", "status"},
+	)
+
+	registerMetricsOnce sync.Once
+)
+
+// registerMetrics registers GPU driver metrics in the legacyregistry. Metrics
+// that are not registered are not collected.
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		legacyregistry.MustRegister(healthTransitions)
+	})
+}
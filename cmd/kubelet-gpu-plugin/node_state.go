@@ -19,8 +19,12 @@ package main
 import (
 	"context"
 	"fmt"
+	"maps"
 	"path"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -42,6 +46,22 @@ import (
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
 
+const (
+	healthTaintKeyPrefix = "HealthIssues"
+	// Taint key without a prefix is limited to 63 characters.
+	taintKeyMaxLength = 63
+)
+
+// Values of the sharingStrategy attribute.
+const (
+	SharingStrategyExclusive   = "exclusive"
+	SharingStrategyTimeSharing = "timeSharing"
+)
+
+// Health types reported by XPUM Daemon, e.g. "[CoreThermal]", may contain
+// characters not allowed in a taint key.
+var taintKeyUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
 type nodeState struct {
 	sync.Mutex
 	CdiCache               *cdiapi.Cache
@@ -50,26 +70,40 @@ type nodeState struct {
 	PreparedClaimsFilePath string
 	NodeName               string
 	SysfsRoot              string
+	// Publish exact memory amount as memoryBytes device attribute.
+	MemoryBytesAttribute bool
+	// Publish allocated, cardIndex and renderdIndex attributes when there is room for them.
+	DiagnosticAttributes bool
+	// Maximum number of claims a device can be prepared for at the same time
+	// (time-sharing). 0 or 1 means exclusive allocation.
+	MaxClaimsPerDevice int
+	// Record health status changes without changing the published device health.
+	HealthObserveOnly bool
+	// Publish devices in one pool per model instead of a single node pool.
+	PoolPerModel bool
+	// Millicores capacity of GPUs per model, applied also to refreshed devices.
+	ModelMillicores device.ModelMillicores
 }
 
-func newNodeState(detectedDevices map[string]*device.DeviceInfo, cdiRoot string, preparedClaimFilePath string, sysfsRoot string, nodeName string) (*nodeState, error) {
+func newNodeState(detectedDevices map[string]*device.DeviceInfo, cdiRoot string, preparedClaimFilePath string, sysfsRoot string, nodeName string, cdiSyncTimeout time.Duration) (*nodeState, error) {
 	for ddev := range detectedDevices {
 		klog.V(3).Infof("new device: %+v", ddev)
 	}
 
 	klog.V(5).Info("Refreshing CDI registry")
 	if err := cdiapi.Configure(cdiapi.WithSpecDirs(cdiRoot)); err != nil {
-		return nil, fmt.Errorf("unable to refresh the CDI registry: %v", err)
+		return nil, helpers.NewCDIError(helpers.CDIRegistryRefreshFailed, "", err)
 	}
 
 	cdiCache := cdiapi.GetDefaultCache()
 
 	if err := cdihelpers.AddDetectedDevicesToCDIRegistry(cdiCache, detectedDevices); err != nil {
-		return nil, fmt.Errorf("unable to add detected devices to CDI registry: %v", err)
+		return nil, fmt.Errorf("unable to add detected devices to CDI registry: %w", err)
 	}
 
-	// hack for tests on slow machines
-	time.Sleep(250 * time.Millisecond)
+	if err := helpers.WaitForCDIDevices(cdiCache, device.CDIKind, slices.Collect(maps.Keys(detectedDevices)), cdiSyncTimeout); err != nil {
+		klog.Warningf("CDI cache not in sync with written CDI specs: %v", err)
+	}
 
 	klog.V(5).Info("Allocatable devices after CDI registry refresh:")
 	for duid, ddev := range detectedDevices {
@@ -100,19 +134,129 @@ func newNodeState(detectedDevices map[string]*device.DeviceInfo, cdiRoot string,
 		klog.V(5).Infof("Allocatable device: %v : %+v", duid, ddev)
 	}
 
+	if err := state.removeStaleCDIDevices(); err != nil {
+		klog.Errorf("failed to remove stale CDI devices: %v", err)
+	}
+
 	return &state, nil
 }
 
+// removeStaleCDIDevices removes GPU CDI devices that are not backed by an
+// allocatable device.
+func (s *nodeState) removeStaleCDIDevices() error {
+	_, err := helpers.RemoveStaleCDIDevices(s.CdiCache, device.CDIKind, s.IsValidCDIDevice)
+
+	return err
+}
+
+// Snapshot returns the current node state for debugging.
+func (s *nodeState) Snapshot() helpers.NodeStateSnapshot {
+	s.Lock()
+	defer s.Unlock()
+
+	preparedClaims := map[string][]string{}
+	for claimUID, claimPreparation := range s.Prepared {
+		deviceNames := []string{}
+		for _, preparedDevice := range claimPreparation.PreparedDevices {
+			deviceNames = append(deviceNames, preparedDevice.KubeletpluginDevice.DeviceName)
+		}
+		preparedClaims[string(claimUID)] = deviceNames
+	}
+
+	return helpers.NewNodeStateSnapshot(s.NodeName, preparedClaims, s)
+}
+
+// PreparedClaimTimes returns when the prepared claims were prepared.
+func (s *nodeState) PreparedClaimTimes() []time.Time {
+	s.Lock()
+	defer s.Unlock()
+
+	times := make([]time.Time, 0, len(s.Prepared))
+	for _, claimPreparation := range s.Prepared {
+		times = append(times, claimPreparation.PreparedAt)
+	}
+
+	return times
+}
+
+// AllocatableDevices implements helpers.SnapshotAdapter.
+func (s *nodeState) AllocatableDevices() []helpers.DeviceSnapshot {
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	devices := []helpers.DeviceSnapshot{}
+	for uid, gpu := range allocatableDevices {
+		devices = append(devices, helpers.DeviceSnapshot{
+			UID: uid,
+			Attributes: map[string]string{
+				"model":         gpu.ModelName,
+				"pciAddress":    gpu.PCIAddress,
+				"deviceType":    gpu.DeviceType,
+				"memoryMiB":     strconv.FormatUint(gpu.MemoryMiB, 10),
+				"currentDriver": gpu.CurrentDriver,
+				"health":        gpu.Health,
+			},
+		})
+	}
+
+	return devices
+}
+
+// sriovCapable returns true if any of the allocatable GPUs supports SR-IOV.
+func (s *nodeState) sriovCapable() bool {
+	s.Lock()
+	defer s.Unlock()
+
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	for _, gpu := range allocatableDevices {
+		if gpu.MaxVFs > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Topology returns the devices with their location on the node.
+func (s *nodeState) Topology() helpers.Topology {
+	s.Lock()
+	defer s.Unlock()
+
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	devices := []helpers.TopologyDevice{}
+	for uid, gpu := range allocatableDevices {
+		devices = append(devices, helpers.TopologyDevice{
+			UID:        uid,
+			PCIAddress: gpu.PCIAddress,
+			PCIRoot:    gpu.PCIRoot,
+			BoardID:    gpu.BoardID,
+			NUMANode:   helpers.ReadNUMANode(path.Join(s.SysfsRoot, helpers.SysfsPCIDevicesPath, gpu.PCIAddress)),
+			ParentUID:  gpu.ParentUID,
+		})
+	}
+
+	return helpers.NewTopology(s.NodeName, devices)
+}
+
+// Allocations implements helpers.SnapshotAdapter, GPU devices are only
+// tracked through prepared claims.
+func (s *nodeState) Allocations() map[string][]string {
+	return nil
+}
+
+// GetResources returns the devices to publish. Together with the reserved
+// attribute, a device has at most ResourceSliceMaxAttributesAndCapacitiesPerDevice
+// attributes and capacities, diagnostic attributes are published only when
+// there is room left for them.
 func (s *nodeState) GetResources() resourceslice.DriverResources {
 	s.Lock()
 	defer s.Unlock()
 
-	devices := []resourcev1.Device{}
+	pools := map[string][]resourcev1.Device{}
 
 	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
 
 	for gpuUID, gpu := range allocatableDevices {
-		sriovSupported := gpu.MaxVFs > 0
+		poolName := s.poolName(gpu)
+		healthState := gpu.GetHealthState()
 		newDevice := resourcev1.Device{
 			Name: gpuUID,
 			Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
@@ -122,22 +266,24 @@ func (s *nodeState) GetResources() resourceslice.DriverResources {
 				"family": {
 					StringValue: &gpu.FamilyName,
 				},
+				"productFamily": {
+					StringValue: &gpu.ProductFamily,
+				},
 				"driver": {
 					StringValue: &gpu.Driver,
 				},
-				"sriov": {
-					BoolValue: &sriovSupported,
-				},
 				"pciId": {
 					StringValue: &gpu.Model,
 				},
-				// Deprecated: will be removed in 1.0.0 release, use 'resource.kubernetes.io/pciBusID'.
-				"pciAddress": {
-					StringValue: &gpu.PCIAddress,
-				},
 				"health": {
 					StringValue: &gpu.Health,
 				},
+				"healthState": {
+					StringValue: &healthState,
+				},
+				"xpumdMismatch": {
+					BoolValue: &gpu.XPUMDMismatch,
+				},
 				deviceattribute.StandardDeviceAttributePCIeRoot: {
 					StringValue: &gpu.PCIRoot,
 				},
@@ -147,47 +293,82 @@ func (s *nodeState) GetResources() resourceslice.DriverResources {
 			},
 			Capacity: map[resourcev1.QualifiedName]resourcev1.DeviceCapacity{
 				"memory":     {Value: resource.MustParse(fmt.Sprintf("%vMi", gpu.MemoryMiB))},
-				"millicores": {Value: *resource.NewDecimalQuantity(*inf.NewDec(int64(1000), inf.Scale(0)), resource.DecimalSI)},
+				"millicores": {Value: *resource.NewDecimalQuantity(*inf.NewDec(int64(gpu.TotalMillicores()), inf.Scale(0)), resource.DecimalSI)},
 			},
 		}
 
-		// pciRoot Device.DeviceAttribute is deprecated: will be removed in 1.0.0 release, use resource.kubernetes.io/pcieRoot'.
-		// For backwards compatibility, strip domain, only bus was in the value.
-		if len(gpu.PCIRoot) > 0 {
-			parts := strings.Split(gpu.PCIRoot, ":")
-			if len(parts) == 2 {
-				newDevice.Attributes["pciRoot"] = resourcev1.DeviceAttribute{
-					StringValue: &parts[1],
-				}
+		s.addSharingAttributes(&newDevice)
+		if s.sharedMode() {
+			s.addShareCapacity(&newDevice)
+		}
+
+		if s.MemoryBytesAttribute && gpu.MemoryBytes != 0 {
+			newDevice.Attributes["memoryBytes"] = resourcev1.DeviceAttribute{
+				IntValue: &gpu.MemoryBytes,
 			}
 		}
 
-		// FIXME: TODO: K8s 1.33-1.34 only supports plain taint without description.
-		// See https://github.com/kubernetes/enhancements/issues/5055 .
+		// Frequencies are not exposed by all kernel drivers, e.g. for VFs.
+		if gpu.MaxFreqMHz != 0 {
+			newDevice.Attributes["minFreqMHz"] = resourcev1.DeviceAttribute{IntValue: &gpu.MinFreqMHz}
+			newDevice.Attributes["maxFreqMHz"] = resourcev1.DeviceAttribute{IntValue: &gpu.MaxFreqMHz}
+		}
+
+		if gpu.PowerLimitW != 0 {
+			newDevice.Attributes["powerLimitWatts"] = resourcev1.DeviceAttribute{IntValue: &gpu.PowerLimitW}
+		}
+
+		newDevice.Attributes["hasActiveDisplay"] = resourcev1.DeviceAttribute{BoolValue: &gpu.ActiveDisplay}
+
+		// Tells apart functions of multi-function devices, and VFs occupying functions next to their PF.
+		newDevice.Attributes["pciFunction"] = resourcev1.DeviceAttribute{IntValue: &gpu.PCIFunction}
+
+		// Also true for SR-IOV capable devices without VF provisioning, e.g. with autoprobe disabled.
+		newDevice.Attributes["sriovCapable"] = resourcev1.DeviceAttribute{BoolValue: &gpu.SRIOVCapable}
+		if gpu.SRIOVCapable {
+			newDevice.Attributes["autoprobeEnabled"] = resourcev1.DeviceAttribute{BoolValue: &gpu.Autoprobe}
+		}
+
+		if gpu.DeviceType == device.GpuDeviceType && (gpu.MaxVFs != 0 || gpu.NumVFs != 0) {
+			maxVFs := int64(gpu.MaxVFs)
+			numVFs := int64(gpu.NumVFs)
+			newDevice.Attributes["maxVfs"] = resourcev1.DeviceAttribute{IntValue: &maxVFs}
+			newDevice.Attributes["numVfs"] = resourcev1.DeviceAttribute{IntValue: &numVFs}
+		}
+
+		if gpu.GPUType != "" {
+			newDevice.Attributes["gpuType"] = resourcev1.DeviceAttribute{StringValue: &gpu.GPUType}
+		}
+		if gpu.SubsystemID != "" {
+			newDevice.Attributes["subsystemId"] = resourcev1.DeviceAttribute{StringValue: &gpu.SubsystemID}
+		}
+		if gpu.Serial != "" {
+			newDevice.Attributes["serial"] = resourcev1.DeviceAttribute{StringValue: &gpu.Serial}
+		}
+		// Same for GPUs on one multi-GPU board, empty for integrated GPUs.
+		if gpu.BoardID != "" {
+			newDevice.Attributes["boardId"] = resourcev1.DeviceAttribute{StringValue: &gpu.BoardID}
+		}
+		// Omitted when support cannot be determined from the product family and kernel driver.
+		if gpu.LevelZeroSupported() {
+			newDevice.Attributes["levelZeroCapable"] = resourcev1.DeviceAttribute{BoolValue: ptr.To(true)}
+		}
+		if gpu.OpenCLSupported() {
+			newDevice.Attributes["openclCapable"] = resourcev1.DeviceAttribute{BoolValue: ptr.To(true)}
+		}
+
+		if s.DiagnosticAttributes {
+			s.addDiagnosticAttributes(&newDevice, gpu, poolName)
+		}
+
 		if gpu.Health == device.HealthUnhealthy {
-			// e.g. HealthIssues-memorytemperature_coretemperature:NoExecute
-			// The format will change in K8s 1.35+.
-			unhealthyTypes := []string{}
-			for healthType, healthStatus := range gpu.HealthStatus {
-				if healthStatus == device.HealthUnhealthy {
-					unhealthyTypes = append(unhealthyTypes, healthType)
-				}
-			}
-			sort.Strings(unhealthyTypes)
-			key := "HealthIssues-" + strings.Join(unhealthyTypes, "_")
-			key = strings.ReplaceAll(key, "[", "")
-			key = strings.ReplaceAll(key, "]", "")
-			key = strings.ReplaceAll(key, ",", "_")
-			newDevice.Taints = []resourcev1.DeviceTaint{{
-				Key:    key,
-				Effect: resourcev1.DeviceTaintEffectNoExecute,
-			}}
+			newDevice.Taints = []resourcev1.DeviceTaint{healthTaint(gpu)}
 		}
 
 		// If the GPU is neither DRM bound nor prepared, add a taint
 		if !gpu.IsDRMBound() {
 			if s.isDevicePrepared(gpuUID) {
-				devices = append(devices, newDevice)
+				pools[poolName] = append(pools[poolName], newDevice)
 				continue
 			}
 
@@ -201,11 +382,140 @@ func (s *nodeState) GetResources() resourceslice.DriverResources {
 			})
 		}
 
-		devices = append(devices, newDevice)
+		pools[poolName] = append(pools[poolName], newDevice)
+	}
+
+	// Without devices, an empty node pool is published to remove stale slices.
+	if _, found := pools[s.NodeName]; !found && (!s.PoolPerModel || len(pools) == 0) {
+		pools[s.NodeName] = []resourcev1.Device{}
+	}
+
+	resources := resourceslice.DriverResources{Pools: map[string]resourceslice.Pool{}}
+	for poolName, devices := range pools {
+		resources.Pools[poolName] = resourceslice.Pool{Slices: []resourceslice.Slice{{Devices: devices}}}
+	}
+
+	return resources
+}
+
+// poolName returns the name of the ResourceSlice pool the device is published
+// in: the node name, or the node name suffixed with the PCI device ID of the
+// model, e.g. node1-56c0, when publishing one pool per model.
+func (s *nodeState) poolName(gpu *device.DeviceInfo) string {
+	if !s.PoolPerModel {
+		return s.NodeName
+	}
+
+	return s.NodeName + "-" + strings.TrimPrefix(helpers.NormalizePCIDeviceID(gpu.Model), "0x")
+}
+
+// isNodePool returns true if the pool is published by this node.
+func (s *nodeState) isNodePool(poolName string) bool {
+	if poolName == s.NodeName {
+		return true
+	}
+
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	for _, gpu := range allocatableDevices {
+		if s.poolName(gpu) == poolName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// healthTaint returns the taint of an unhealthy device, keyed by its unhealthy
+// health types. The taint is not published anymore once the device recovers.
+// FIXME: TODO: K8s 1.33-1.34 only supports plain taint without description.
+// See https://github.com/kubernetes/enhancements/issues/5055 .
+func healthTaint(gpu *device.DeviceInfo) resourcev1.DeviceTaint {
+	// e.g. HealthIssues-CoreThermal_MemoryThermal:NoExecute
+	// The format will change in K8s 1.35+.
+	unhealthyTypes := []string{}
+	for healthType, healthStatus := range gpu.HealthStatus {
+		if healthStatus == device.HealthUnhealthy {
+			healthType = taintKeyUnsafeChars.ReplaceAllString(strings.Trim(healthType, "[]"), "_")
+			unhealthyTypes = append(unhealthyTypes, healthType)
+		}
+	}
+	sort.Strings(unhealthyTypes)
+
+	key := healthTaintKeyPrefix
+	if len(unhealthyTypes) > 0 {
+		key += "-" + strings.Join(unhealthyTypes, "_")
+	}
+	// Taint key has to be a qualified name, which ends with an alphanumeric character.
+	if len(key) > taintKeyMaxLength {
+		key = key[:taintKeyMaxLength]
+	}
+	key = strings.TrimRight(key, "-_.")
+
+	return resourcev1.DeviceTaint{
+		Key:    key,
+		Effect: resourcev1.DeviceTaintEffectNoExecute,
+	}
+}
+
+// sharedMode returns true if devices can be allocated to multiple claims at the same time.
+func (s *nodeState) sharedMode() bool {
+	return s.MaxClaimsPerDevice > 1
+}
+
+// addSharingAttributes tells how the device is shared between claims, so that
+// claims can be written without knowing the driver flags.
+func (s *nodeState) addSharingAttributes(newDevice *resourcev1.Device) {
+	strategy := SharingStrategyExclusive
+	shareCapacity := int64(1)
+	if s.sharedMode() {
+		strategy = SharingStrategyTimeSharing
+		shareCapacity = int64(s.MaxClaimsPerDevice)
 	}
 
-	return resourceslice.DriverResources{Pools: map[string]resourceslice.Pool{
-		s.NodeName: {Slices: []resourceslice.Slice{{Devices: devices}}}}}
+	newDevice.Attributes["sharingStrategy"] = resourcev1.DeviceAttribute{StringValue: &strategy}
+	newDevice.Attributes["shareCapacity"] = resourcev1.DeviceAttribute{IntValue: &shareCapacity}
+}
+
+// addDiagnosticAttributes publishes attributes meant for debugging rather than
+// for selecting devices, as long as the device has room for them next to the
+// reserved attribute.
+func (s *nodeState) addDiagnosticAttributes(newDevice *resourcev1.Device, gpu *device.DeviceInfo, poolName string) {
+	add := func(name resourcev1.QualifiedName, attribute resourcev1.DeviceAttribute) {
+		// One attribute is left for helpers.ReservedAttribute.
+		if len(newDevice.Attributes)+len(newDevice.Capacity) >= resourcev1.ResourceSliceMaxAttributesAndCapacitiesPerDevice-1 {
+			klog.V(5).Infof("Device %v has no room for diagnostic attribute %v", newDevice.Name, name)
+			return
+		}
+		newDevice.Attributes[name] = attribute
+	}
+
+	// Informational only, mirrors prepared claims for diagnostics. Allocation is tracked by the scheduler.
+	allocated := s.deviceClaims(newDevice.Name, poolName, "") > 0
+	add("allocated", resourcev1.DeviceAttribute{BoolValue: &allocated})
+
+	// DRM device node indices, e.g. 0 for /dev/dri/card0 and 128 for /dev/dri/renderD128.
+	cardIndex := int64(gpu.CardIdx)
+	add("cardIndex", resourcev1.DeviceAttribute{IntValue: &cardIndex})
+	if gpu.RenderdIdx != 0 {
+		renderdIndex := int64(gpu.RenderdIdx)
+		add("renderdIndex", resourcev1.DeviceAttribute{IntValue: &renderdIndex})
+	}
+}
+
+// addShareCapacity allows the scheduler to allocate the device to up to
+// MaxClaimsPerDevice claims. Each claim consumes one share by default, and
+// none of the memory or millicores, since the device is time-shared.
+func (s *nodeState) addShareCapacity(newDevice *resourcev1.Device) {
+	newDevice.AllowMultipleAllocations = ptr.To(true)
+
+	for capacityName, capacity := range newDevice.Capacity {
+		capacity.RequestPolicy = &resourcev1.CapacityRequestPolicy{Default: resource.NewQuantity(0, resource.DecimalSI)}
+		newDevice.Capacity[capacityName] = capacity
+	}
+	newDevice.Capacity["shares"] = resourcev1.DeviceCapacity{
+		Value:         *resource.NewQuantity(int64(s.MaxClaimsPerDevice), resource.DecimalSI),
+		RequestPolicy: &resourcev1.CapacityRequestPolicy{Default: resource.NewQuantity(1, resource.DecimalSI)},
+	}
 }
 
 func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim) (kubeletplugin.PrepareResult, error) {
@@ -219,14 +529,20 @@ func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim
 	preparedDevices := []PreparedDevice{}
 
 	for _, allocatedDevice := range claim.Status.Allocation.Devices.Results {
-		// ATM the only pool is cluster node's pool: all devices on current node.
-		if allocatedDevice.Driver != device.DriverName || allocatedDevice.Pool != s.NodeName {
+		// Pools of this node: the node pool, or per-model pools of the node.
+		if allocatedDevice.Driver != device.DriverName || !s.isNodePool(allocatedDevice.Pool) {
 			klog.FromContext(ctx).Info("ignoring claim allocation device", "device", allocatedDevice, "expected pool", s.NodeName, "expected driver", device.DriverName)
 			continue
 		}
 
 		adminAccess := ptr.Deref(allocatedDevice.AdminAccess, false)
-		if !adminAccess && s.isDeviceUsedExclusivelyAlready(allocatedDevice.Device, allocatedDevice.Pool, claim.UID) {
+		if !adminAccess && s.sharedMode() {
+			if sharers := s.deviceClaims(allocatedDevice.Device, allocatedDevice.Pool, claim.UID); sharers >= s.MaxClaimsPerDevice {
+				return kubeletplugin.PrepareResult{}, fmt.Errorf(
+					"device %v (pool %v) is already shared by %d claims, no share capacity left",
+					allocatedDevice.Device, allocatedDevice.Pool, sharers)
+			}
+		} else if !adminAccess && s.isDeviceUsedExclusivelyAlready(allocatedDevice.Device, allocatedDevice.Pool, claim.UID) {
 			return kubeletplugin.PrepareResult{}, fmt.Errorf(
 				"device %v (pool %v) is already allocated to another claim and cannot be prepared without adminAccess flag",
 				allocatedDevice.Device, allocatedDevice.Pool)
@@ -237,13 +553,28 @@ func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim
 		if !found {
 			return kubeletplugin.PrepareResult{}, fmt.Errorf("could not find allocatable device %v (pool %v)", allocatedDevice.Device, allocatedDevice.Pool)
 		}
+		if poolName := s.poolName(allocatableDevice); allocatedDevice.Pool != poolName {
+			return kubeletplugin.PrepareResult{}, fmt.Errorf("device %v is published in pool %v, not in pool %v", allocatedDevice.Device, poolName, allocatedDevice.Pool)
+		}
+
+		cardNode, err := requestedCardNode(claim, allocatedDevice.Request)
+		if err != nil {
+			return kubeletplugin.PrepareResult{}, err
+		}
+		cdiName := allocatableDevice.CDIName()
+		if !cardNode {
+			cdiName = allocatableDevice.RenderOnlyCDIName()
+			if cdiName == "" {
+				return kubeletplugin.PrepareResult{}, fmt.Errorf("device %v has no render node, cannot prepare it without the card node", allocatedDevice.Device)
+			}
+		}
 
 		newDevice := PreparedDevice{
 			KubeletpluginDevice: kubeletplugin.Device{
 				Requests:     []string{allocatedDevice.Request},
 				PoolName:     allocatedDevice.Pool,
 				DeviceName:   allocatedDevice.Device,
-				CDIDeviceIDs: []string{allocatableDevice.CDIName()},
+				CDIDeviceIDs: []string{cdiName},
 			},
 			AdminAccess: adminAccess,
 		}
@@ -256,7 +587,7 @@ func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim
 		preparedDevices = append(preparedDevices, newDevice)
 	}
 
-	s.Prepared[claim.UID] = ClaimPreparation{PreparedDevices: preparedDevices}
+	s.Prepared[claim.UID] = ClaimPreparation{PreparedDevices: preparedDevices, PreparedAt: time.Now()}
 
 	err := WritePreparedClaimsToFile(s.PreparedClaimsFilePath, s.Prepared)
 	if err != nil {
@@ -292,6 +623,27 @@ func (s *nodeState) isDeviceUsedExclusivelyAlready(deviceName, poolName string,
 	return false
 }
 
+// deviceClaims returns the number of claims other than claimUID the device is
+// prepared for without adminAccess.
+func (s *nodeState) deviceClaims(deviceName, poolName string, claimUID types.UID) int {
+	claims := 0
+	for preparedClaimUID, claimPreparation := range s.Prepared {
+		if preparedClaimUID == claimUID {
+			continue
+		}
+
+		for _, preparedDevice := range claimPreparation.PreparedDevices {
+			if !preparedDevice.AdminAccess &&
+				preparedDevice.KubeletpluginDevice.DeviceName == deviceName && preparedDevice.KubeletpluginDevice.PoolName == poolName {
+				claims++
+				break
+			}
+		}
+	}
+
+	return claims
+}
+
 func (s *nodeState) IsDeviceDRMBound(deviceUID string) bool {
 	s.Lock()
 	defer s.Unlock()
@@ -306,10 +658,14 @@ func (s *nodeState) RefreshDeviceOnDriverEvent(deviceUID, currentDriver string)
 	s.Lock()
 	defer s.Unlock()
 
+	before := s.AllocatableDevices()
+	defer func() { helpers.LogInventoryDiff(before, s.AllocatableDevices()) }()
+
 	// nolint:forcetypeassert
 	allocatable := s.Allocatable.(map[string]*device.DeviceInfo)
 	gpu := allocatable[deviceUID]
 	gpu.CurrentDriver = currentDriver
+	s.ModelMillicores.Apply(gpu)
 	if gpu.CurrentDriver == "" {
 		return nil
 	}
@@ -331,7 +687,7 @@ func (s *nodeState) RefreshDeviceOnDriverEvent(deviceUID, currentDriver string)
 	// Refreshing the CDI registry with updated device information
 	cdiCache := cdiapi.GetDefaultCache()
 	if err := cdihelpers.AddDetectedDevicesToCDIRegistry(cdiCache, allocatable); err != nil {
-		return fmt.Errorf("failed to add detected devices to CDI registry: %v", err)
+		return fmt.Errorf("failed to add detected devices to CDI registry: %w", err)
 	}
 
 	return nil
@@ -341,6 +697,12 @@ func (s *nodeState) Unprepare(ctx context.Context, claimUID types.UID) error {
 	s.Lock()
 	defer s.Unlock()
 
+	return s.removePreparedClaim(claimUID)
+}
+
+// removePreparedClaim removes the claim from prepared claims and persists them.
+// The caller must hold the lock.
+func (s *nodeState) removePreparedClaim(claimUID types.UID) error {
 	if _, found := s.Prepared[claimUID]; !found {
 		return nil
 	}
@@ -406,13 +768,16 @@ func (s *nodeState) devpathContainsGPUPCIAddress(devpath string) bool {
 	return false
 }
 
-// applyDeviceUpdates processes XPUMD-supplied device details and health, and
+// applyDeviceUpdates processes health backends supplied device details and health, and
 // returns a bool of whether ResourceSlice update and publication is needed,
 // and a possible error.
 func (s *nodeState) applyDeviceUpdates(newDevicesInfo device.DevicesInfo) (bool, error) {
 	s.Lock()
 	defer s.Unlock()
 
+	before := s.AllocatableDevices()
+	defer func() { helpers.LogInventoryDiff(before, s.AllocatableDevices()) }()
+
 	needToPublish := false
 
 	//nolint:forcetypeassert // We want the code to panic if our assumption turns out to be wrong.
@@ -422,18 +787,35 @@ func (s *nodeState) applyDeviceUpdates(newDevicesInfo device.DevicesInfo) (bool,
 		klog.V(5).Infof("Checking device %v info", deviceUID)
 		foundDevice, found := allocatable[deviceUID]
 		if !found {
+			// Health backends report also devices filtered out from discovery, e.g. by
+			// --gpu-driver or --discrete-only.
 			// TODO: re-discover to check if new device was hot-plugged.
-			return false, fmt.Errorf("could not find allocatable device with UID %v", deviceUID)
+			klog.V(5).Infof("Ignoring update of device %v, it is not allocatable", deviceUID)
+			continue
+		}
+
+		// Only reports carrying device details, i.e. from xpumd, can be cross-checked.
+		if newDeviceInfo.Model != "" {
+			needToPublish = applyXPUMDMismatch(foundDevice, newDeviceInfo) || needToPublish
 		}
 
 		// Apply memory change if any:
 		// - if DRA driver runs in non-privileged mode, XPUMD info can provide memory info.
 		// - PF can change it's memory amount when VFs are enabled or disabled.
-		if foundDevice.MemoryMiB != newDeviceInfo.MemoryMiB {
+		// - zero means the health backend does not report memory.
+		if newDeviceInfo.MemoryMiB != 0 && foundDevice.MemoryMiB != newDeviceInfo.MemoryMiB {
 			klog.Infof("Device %v memory changed from %v MiB to %v MiB", deviceUID, foundDevice.MemoryMiB, newDeviceInfo.MemoryMiB)
 			foundDevice.MemoryMiB = newDeviceInfo.MemoryMiB
 			needToPublish = true
 		}
+		if newDeviceInfo.MemoryBytes != 0 && foundDevice.MemoryBytes != newDeviceInfo.MemoryBytes {
+			foundDevice.MemoryBytes = newDeviceInfo.MemoryBytes
+			needToPublish = needToPublish || s.MemoryBytesAttribute
+		}
+
+		keepSelfTestHealth(foundDevice, newDeviceInfo)
+
+		healthChanged := false
 
 		// Only overall foundDevice.Health is exposed in the ResourceSlice Device, and not foundDevice.HealshStatus.
 		// Overall health is a logical AND of all HealthStatus elements. If the overall health changes - the new
@@ -445,7 +827,8 @@ func (s *nodeState) applyDeviceUpdates(newDevicesInfo device.DevicesInfo) (bool,
 			// - health was not known before and new status is not healthy
 			if (oldHealthFound && oldHealthValue != newHealthStatus) || (!oldHealthFound && newHealthStatus == device.HealthUnhealthy) {
 				klog.Infof("Device %v health status for %v changed from %v to %v", deviceUID, newHealthType, oldHealthValue, newHealthStatus)
-				needToPublish = true
+				healthTransitions.WithLabelValues(deviceUID, newHealthType, newHealthStatus).Inc()
+				healthChanged = true
 			}
 		}
 
@@ -455,16 +838,56 @@ func (s *nodeState) applyDeviceUpdates(newDevicesInfo device.DevicesInfo) (bool,
 		for oldHealthType, oldHealthValue := range foundDevice.HealthStatus {
 			if _, healthReported := newDeviceInfo.HealthStatus[oldHealthType]; !healthReported && oldHealthValue == device.HealthUnhealthy {
 				klog.Infof("Device %v health status for %v is no longer reported, considered healthy", deviceUID, oldHealthType)
-				needToPublish = true
+				healthTransitions.WithLabelValues(deviceUID, oldHealthType, device.HealthHealthy).Inc()
+				healthChanged = true
 			}
 		}
 
+		if foundDevice.GetHealthState() != newDeviceInfo.GetHealthState() {
+			klog.Infof("Device %v health state changed from %v to %v", deviceUID, foundDevice.GetHealthState(), newDeviceInfo.GetHealthState())
+			healthChanged = true
+		}
+
 		// Finally, overwrite the health status with the new one as a whole.
 		foundDevice.HealthStatus = newDeviceInfo.HealthStatus
-		foundDevice.Health = newDeviceInfo.Health
+		if s.HealthObserveOnly {
+			if healthChanged {
+				klog.Infof("Health observe-only mode: device %v health %v is not published", deviceUID, newDeviceInfo.GetHealthState())
+			}
+		} else {
+			foundDevice.Health = newDeviceInfo.Health
+			foundDevice.HealthState = newDeviceInfo.HealthState
+			needToPublish = needToPublish || healthChanged
+		}
 
 		klog.V(5).Infof("Updated health status for device: %v to: overall: %v; details: %v", deviceUID, foundDevice.Health, foundDevice.HealthStatus)
 	}
 
 	return needToPublish, nil
 }
+
+// applyXPUMDMismatch flags the device when xpumd reports details that
+// contradict the kernel driver, which happens after partial upgrades when
+// xpumd returns stale or zeroed data. xpumd does not report the driver
+// version, so only the reported details can be compared. Returns true if the
+// flag changed.
+func applyXPUMDMismatch(foundDevice *device.DeviceInfo, reported *device.DeviceInfo) bool {
+	reason := ""
+	if reported.MemoryMiB == 0 && foundDevice.MemoryMiB != 0 {
+		reason = fmt.Sprintf("xpumd reports no local memory, %v driver reported %v MiB", foundDevice.Driver, foundDevice.MemoryMiB)
+	}
+
+	mismatch := reason != ""
+	if mismatch == foundDevice.XPUMDMismatch {
+		return false
+	}
+
+	if mismatch {
+		klog.Warningf("Device %v: %v. Check that kernel GPU driver and xpumd versions match", foundDevice.UID, reason)
+	} else {
+		klog.Infof("Device %v: xpumd device details match the kernel driver again", foundDevice.UID)
+	}
+	foundDevice.XPUMDMismatch = mismatch
+
+	return true
+}
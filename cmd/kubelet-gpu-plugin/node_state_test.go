@@ -17,15 +17,24 @@
 package main
 
 import (
+	"context"
+	"os"
+	"path"
 	"reflect"
 	"strings"
 	"testing"
 
 	resourcev1 "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/ptr"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	testhelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
 )
 
 func TestDeviceInfoDeepCopy(t *testing.T) {
@@ -129,6 +138,358 @@ func TestGetResourcesTaintsOnlyUnpreparedNonDRMBoundDevices(t *testing.T) {
 	}
 }
 
+func TestGetResourcesMemoryBytesAttribute(t *testing.T) {
+	for _, memoryBytesAttribute := range []bool{false, true} {
+		state := &nodeState{
+			Allocatable: map[string]*device.DeviceInfo{
+				"gpu": {
+					UID:         "gpu",
+					PCIAddress:  "0000:00:01.0",
+					MemoryMiB:   16384,
+					MemoryBytes: 17180393472,
+					Health:      device.HealthHealthy,
+				},
+			},
+			Prepared:             ClaimPreparations{},
+			NodeName:             "test-node",
+			MemoryBytesAttribute: memoryBytesAttribute,
+		}
+
+		resources := state.GetResources()
+		attribute, found := resources.Pools["test-node"].Slices[0].Devices[0].Attributes["memoryBytes"]
+		if found != memoryBytesAttribute {
+			t.Fatalf("memoryBytesAttribute %v: expected memoryBytes attribute presence %v", memoryBytesAttribute, memoryBytesAttribute)
+		}
+		if found && *attribute.IntValue != 17180393472 {
+			t.Errorf("expected memoryBytes 17180393472, got %v", *attribute.IntValue)
+		}
+	}
+}
+
+func TestGetResourcesPoolPerModel(t *testing.T) {
+	for _, poolPerModel := range []bool{false, true} {
+		state := &nodeState{
+			Allocatable: map[string]*device.DeviceInfo{
+				"card0": {UID: "card0", Model: "0x56C0", PCIAddress: "0000:00:01.0", Health: device.HealthHealthy},
+				"card1": {UID: "card1", Model: "0x56c0", PCIAddress: "0000:00:02.0", Health: device.HealthHealthy},
+				"card2": {UID: "card2", Model: "0xe20b", PCIAddress: "0000:00:03.0", Health: device.HealthHealthy},
+			},
+			Prepared:     ClaimPreparations{},
+			NodeName:     "test-node",
+			PoolPerModel: poolPerModel,
+		}
+
+		expected := map[string]int{"test-node": 3}
+		if poolPerModel {
+			expected = map[string]int{"test-node-56c0": 2, "test-node-e20b": 1}
+		}
+
+		resources := state.GetResources()
+		if len(resources.Pools) != len(expected) {
+			t.Fatalf("poolPerModel %v: expected %v pools, got %v", poolPerModel, len(expected), len(resources.Pools))
+		}
+		for poolName, deviceCount := range expected {
+			pool, found := resources.Pools[poolName]
+			if !found {
+				t.Fatalf("poolPerModel %v: expected pool %v", poolPerModel, poolName)
+			}
+			if len(pool.Slices) != 1 || len(pool.Slices[0].Devices) != deviceCount {
+				t.Errorf("poolPerModel %v: expected %v devices in pool %v, got %+v", poolPerModel, deviceCount, poolName, pool.Slices)
+			}
+		}
+	}
+
+	// Without devices, the empty node pool replaces stale ones.
+	state := &nodeState{Allocatable: map[string]*device.DeviceInfo{}, Prepared: ClaimPreparations{}, NodeName: "test-node", PoolPerModel: true}
+	resources := state.GetResources()
+	if pool, found := resources.Pools["test-node"]; !found || len(resources.Pools) != 1 || len(pool.Slices[0].Devices) != 0 {
+		t.Errorf("expected a single empty node pool, got %+v", resources.Pools)
+	}
+}
+
+func TestGetResourcesAttributes(t *testing.T) {
+	// All optional attributes published, the most a device can have.
+	fullyPopulated := func() *device.DeviceInfo {
+		return &device.DeviceInfo{
+			PCIAddress:    "0000:03:00.0",
+			PCIRoot:       "pci0000:00",
+			Model:         "0x56c0",
+			ModelName:     "Flex 170",
+			FamilyName:    "Data Center Flex",
+			ProductFamily: device.ProductFamilyFlex,
+			DeviceType:    device.GpuDeviceType,
+			GPUType:       "discrete",
+			Driver:        "xe",
+			CurrentDriver: "xe",
+			MemoryMiB:     16384,
+			MemoryBytes:   17180393472,
+			MinFreqMHz:    300,
+			MaxFreqMHz:    2050,
+			PowerLimitW:   120,
+			CardIdx:       1,
+			RenderdIdx:    129,
+			SRIOVCapable:  true,
+			Autoprobe:     true,
+			MaxVFs:        31,
+			NumVFs:        2,
+			SubsystemID:   "0x8086:0x4905",
+			Serial:        "LQAC12345678",
+			BoardID:       "0000:01:00.0",
+		}
+	}
+
+	tests := []struct {
+		name      string
+		device    *device.DeviceInfo
+		attribute resourcev1.QualifiedName
+		// Nil when the attribute is not published.
+		expected             *resourcev1.DeviceAttribute
+		maxClaimsPerDevice   int
+		reserved             bool
+		diagnosticAttributes bool
+	}{
+		{
+			name:      "minimum frequency",
+			device:    &device.DeviceInfo{MinFreqMHz: 300, MaxFreqMHz: 2050},
+			attribute: "minFreqMHz",
+			expected:  &resourcev1.DeviceAttribute{IntValue: ptr.To(int64(300))},
+		},
+		{
+			name:      "maximum frequency",
+			device:    &device.DeviceInfo{MinFreqMHz: 300, MaxFreqMHz: 2050},
+			attribute: "maxFreqMHz",
+			expected:  &resourcev1.DeviceAttribute{IntValue: ptr.To(int64(2050))},
+		},
+		{
+			name:      "no frequency on VF",
+			device:    &device.DeviceInfo{DeviceType: device.VfDeviceType},
+			attribute: "maxFreqMHz",
+		},
+		{
+			name:      "power limit",
+			device:    &device.DeviceInfo{PowerLimitW: 120},
+			attribute: "powerLimitWatts",
+			expected:  &resourcev1.DeviceAttribute{IntValue: ptr.To(int64(120))},
+		},
+		{
+			name:      "no power limit on VF",
+			device:    &device.DeviceInfo{DeviceType: device.VfDeviceType},
+			attribute: "powerLimitWatts",
+		},
+		{
+			name:                 "card index",
+			device:               &device.DeviceInfo{CardIdx: 1, RenderdIdx: 129},
+			attribute:            "cardIndex",
+			expected:             &resourcev1.DeviceAttribute{IntValue: ptr.To(int64(1))},
+			diagnosticAttributes: true,
+		},
+		{
+			name:                 "render node index",
+			device:               &device.DeviceInfo{CardIdx: 1, RenderdIdx: 129},
+			attribute:            "renderdIndex",
+			expected:             &resourcev1.DeviceAttribute{IntValue: ptr.To(int64(129))},
+			diagnosticAttributes: true,
+		},
+		{
+			name:                 "no render node index without render node",
+			device:               &device.DeviceInfo{CardIdx: 2},
+			attribute:            "renderdIndex",
+			diagnosticAttributes: true,
+		},
+		{
+			name:      "no card index without diagnostic attributes",
+			device:    &device.DeviceInfo{CardIdx: 1, RenderdIdx: 129},
+			attribute: "cardIndex",
+		},
+		{
+			name:      "GPU type",
+			device:    &device.DeviceInfo{GPUType: "integrated"},
+			attribute: "gpuType",
+			expected:  &resourcev1.DeviceAttribute{StringValue: ptr.To("integrated")},
+		},
+		{
+			name:      "PCI subsystem ID",
+			device:    &device.DeviceInfo{SubsystemID: "0x8086:0x4905"},
+			attribute: "subsystemId",
+			expected:  &resourcev1.DeviceAttribute{StringValue: ptr.To("0x8086:0x4905")},
+		},
+		{
+			name:      "board ID",
+			device:    &device.DeviceInfo{BoardID: "0000:01:00.0"},
+			attribute: "boardId",
+			expected:  &resourcev1.DeviceAttribute{StringValue: ptr.To("0000:01:00.0")},
+		},
+		{
+			name:      "autoprobe of SR-IOV capable GPU",
+			device:    &device.DeviceInfo{SRIOVCapable: true},
+			attribute: "autoprobeEnabled",
+			expected:  &resourcev1.DeviceAttribute{BoolValue: ptr.To(false)},
+		},
+		{
+			name:      "no autoprobe without SR-IOV",
+			device:    &device.DeviceInfo{},
+			attribute: "autoprobeEnabled",
+		},
+		{
+			name:      "Level Zero capable",
+			device:    &device.DeviceInfo{ProductFamily: device.ProductFamilyFlex, Driver: "xe", CurrentDriver: "xe"},
+			attribute: "levelZeroCapable",
+			expected:  &resourcev1.DeviceAttribute{BoolValue: ptr.To(true)},
+		},
+		{
+			name:      "OpenCL capable",
+			device:    &device.DeviceInfo{ProductFamily: device.ProductFamilyFlex, Driver: "xe", CurrentDriver: "xe"},
+			attribute: "openclCapable",
+			expected:  &resourcev1.DeviceAttribute{BoolValue: ptr.To(true)},
+		},
+		{
+			name:      "no compute APIs for unknown family",
+			device:    &device.DeviceInfo{ProductFamily: device.ProductFamilyUnknown, Driver: "xe", CurrentDriver: "xe"},
+			attribute: "levelZeroCapable",
+		},
+		{
+			name:      "PCI function of PF",
+			device:    &device.DeviceInfo{PCIAddress: "0000:00:02.0", DeviceType: device.GpuDeviceType},
+			attribute: "pciFunction",
+			expected:  &resourcev1.DeviceAttribute{IntValue: ptr.To(int64(0))},
+		},
+		{
+			name:      "PCI function of VF",
+			device:    &device.DeviceInfo{PCIAddress: "0000:00:02.1", PCIFunction: 1, DeviceType: device.VfDeviceType, ParentUID: "pf"},
+			attribute: "pciFunction",
+			expected:  &resourcev1.DeviceAttribute{IntValue: ptr.To(int64(1))},
+		},
+		{
+			name:      "maximum VFs of PF",
+			device:    &device.DeviceInfo{DeviceType: device.GpuDeviceType, MaxVFs: 16, NumVFs: 2},
+			attribute: "maxVfs",
+			expected:  &resourcev1.DeviceAttribute{IntValue: ptr.To(int64(16))},
+		},
+		{
+			name:      "number of VFs of PF",
+			device:    &device.DeviceInfo{DeviceType: device.GpuDeviceType, MaxVFs: 16, NumVFs: 2},
+			attribute: "numVfs",
+			expected:  &resourcev1.DeviceAttribute{IntValue: ptr.To(int64(2))},
+		},
+		{
+			name:      "no VF count on VF",
+			device:    &device.DeviceInfo{DeviceType: device.VfDeviceType, ParentUID: "pf"},
+			attribute: "maxVfs",
+		},
+		{
+			name:      "no VF count without SR-IOV",
+			device:    &device.DeviceInfo{DeviceType: device.GpuDeviceType},
+			attribute: "numVfs",
+		},
+		{
+			name:      "serial",
+			device:    &device.DeviceInfo{Serial: "LQAC12345678"},
+			attribute: "serial",
+			expected:  &resourcev1.DeviceAttribute{StringValue: ptr.To("LQAC12345678")},
+		},
+		{
+			name:      "no serial when unknown",
+			device:    &device.DeviceInfo{},
+			attribute: "serial",
+		},
+		{
+			name:      "fully populated exclusive device",
+			device:    fullyPopulated(),
+			attribute: "sharingStrategy",
+			expected:  &resourcev1.DeviceAttribute{StringValue: ptr.To(SharingStrategyExclusive)},
+			reserved:  true,
+		},
+		{
+			name:               "fully populated time-shared device",
+			device:             fullyPopulated(),
+			attribute:          "sharingStrategy",
+			expected:           &resourcev1.DeviceAttribute{StringValue: ptr.To(SharingStrategyTimeSharing)},
+			maxClaimsPerDevice: 2,
+			reserved:           true,
+		},
+		{
+			name:                 "fully populated device with diagnostic attributes",
+			device:               fullyPopulated(),
+			attribute:            "sharingStrategy",
+			expected:             &resourcev1.DeviceAttribute{StringValue: ptr.To(SharingStrategyExclusive)},
+			reserved:             true,
+			diagnosticAttributes: true,
+		},
+		{
+			name:                 "diagnostic attributes left out of fully populated time-shared device",
+			device:               fullyPopulated(),
+			attribute:            "cardIndex",
+			maxClaimsPerDevice:   2,
+			reserved:             true,
+			diagnosticAttributes: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.device.UID = "gpu"
+			tt.device.Health = device.HealthHealthy
+			state := &nodeState{
+				Allocatable:          map[string]*device.DeviceInfo{"gpu": tt.device},
+				Prepared:             ClaimPreparations{},
+				NodeName:             "test-node",
+				MemoryBytesAttribute: true,
+				MaxClaimsPerDevice:   tt.maxClaimsPerDevice,
+				DiagnosticAttributes: tt.diagnosticAttributes,
+			}
+
+			reservations := helpers.NewReservations(device.DriverName)
+			if tt.reserved {
+				reservations.Pin("gpu")
+			}
+			resourceDevice := reservations.Apply(state.GetResources()).Pools["test-node"].Slices[0].Devices[0]
+
+			attribute, found := resourceDevice.Attributes[tt.attribute]
+			if found != (tt.expected != nil) || (found && !reflect.DeepEqual(attribute, *tt.expected)) {
+				t.Errorf("expected %v attribute %+v, got %+v (published %v)", tt.attribute, tt.expected, attribute, found)
+			}
+			if _, found := resourceDevice.Attributes[helpers.ReservedAttribute]; found != tt.reserved {
+				t.Errorf("expected %v attribute published %v, got %v", helpers.ReservedAttribute, tt.reserved, found)
+			}
+			if count := len(resourceDevice.Attributes) + len(resourceDevice.Capacity); count > resourcev1.ResourceSliceMaxAttributesAndCapacitiesPerDevice {
+				t.Errorf("expected at most %v attributes and capacities, got %v",
+					resourcev1.ResourceSliceMaxAttributesAndCapacitiesPerDevice, count)
+			}
+		})
+	}
+}
+
+func TestTopology(t *testing.T) {
+	sysfsRoot := t.TempDir()
+	deviceDir := path.Join(sysfsRoot, helpers.SysfsPCIDevicesPath, "0000:03:00.0")
+	if err := os.MkdirAll(deviceDir, 0755); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if err := os.WriteFile(path.Join(deviceDir, "numa_node"), []byte("0\n"), 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	state := &nodeState{
+		Allocatable: map[string]*device.DeviceInfo{
+			"0000-03-00-0-0x56c0": {UID: "0000-03-00-0-0x56c0", PCIAddress: "0000:03:00.0", PCIRoot: "pci0000:00"},
+			"0000-03-00-1-0x56c0": {UID: "0000-03-00-1-0x56c0", PCIAddress: "0000:03:00.1", PCIRoot: "pci0000:00", ParentUID: "0000-03-00-0-0x56c0"},
+		},
+		NodeName:  "test-node",
+		SysfsRoot: sysfsRoot,
+	}
+
+	expected := helpers.Topology{
+		NodeName: "test-node",
+		Devices: []helpers.TopologyDevice{
+			{UID: "0000-03-00-0-0x56c0", PCIAddress: "0000:03:00.0", PCIRoot: "pci0000:00", NUMANode: 0},
+			{UID: "0000-03-00-1-0x56c0", PCIAddress: "0000:03:00.1", PCIRoot: "pci0000:00", NUMANode: helpers.NUMANodeUnknown, ParentUID: "0000-03-00-0-0x56c0"},
+		},
+	}
+	if topology := state.Topology(); !reflect.DeepEqual(topology, expected) {
+		t.Errorf("expected topology %+v, got %+v", expected, topology)
+	}
+}
+
 func TestIsDevicePrepared(t *testing.T) {
 	state := &nodeState{
 		Allocatable: map[string]*device.DeviceInfo{
@@ -306,3 +667,538 @@ func TestIsDeviceUsedExclusivelyAlready(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyDeviceUpdatesHealthTransitions(t *testing.T) {
+	registerMetrics()
+	healthTransitions.Reset()
+
+	state := &nodeState{
+		Allocatable: map[string]*device.DeviceInfo{
+			"gpu": {
+				UID:          "gpu",
+				Health:       device.HealthHealthy,
+				HealthStatus: map[string]string{"CoreThermal": device.HealthHealthy, "Power": device.HealthHealthy},
+			},
+		},
+	}
+
+	updates := []map[string]string{
+		{"CoreThermal": device.HealthUnhealthy, "Power": device.HealthHealthy},
+		{"CoreThermal": device.HealthUnhealthy, "Power": device.HealthHealthy},
+		{"Power": device.HealthHealthy},
+	}
+	for _, healthStatus := range updates {
+		if _, err := state.applyDeviceUpdates(device.DevicesInfo{
+			"gpu": {UID: "gpu", HealthStatus: healthStatus},
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	expected := map[[2]string]float64{
+		{"CoreThermal", device.HealthUnhealthy}: 1,
+		{"CoreThermal", device.HealthHealthy}:   1,
+		{"Power", device.HealthUnhealthy}:       0,
+		{"Power", device.HealthHealthy}:         0,
+	}
+	for labels, expectedValue := range expected {
+		value, err := testutil.GetCounterMetricValue(healthTransitions.WithLabelValues("gpu", labels[0], labels[1]))
+		if err != nil {
+			t.Fatalf("could not get counter value: %v", err)
+		}
+		if value != expectedValue {
+			t.Errorf("%v: expected %v transitions, got %v", labels, expectedValue, value)
+		}
+	}
+}
+
+func TestApplyDeviceUpdatesHealthState(t *testing.T) {
+	state := &nodeState{
+		Allocatable: map[string]*device.DeviceInfo{
+			"gpu": {UID: "gpu", Health: device.HealthHealthy},
+		},
+		Prepared: ClaimPreparations{},
+		NodeName: "test-node",
+	}
+
+	healthState := func() string {
+		return *state.GetResources().Pools["test-node"].Slices[0].Devices[0].Attributes["healthState"].StringValue
+	}
+
+	if got := healthState(); got != device.HealthHealthy {
+		t.Errorf("expected health state %v before updates, got %v", device.HealthHealthy, got)
+	}
+
+	updates := []struct {
+		healthState   string
+		expectPublish bool
+	}{
+		{healthState: device.HealthDegraded, expectPublish: true},
+		{healthState: device.HealthDegraded, expectPublish: false},
+		{healthState: device.HealthHealthy, expectPublish: true},
+	}
+	for _, update := range updates {
+		needToPublish, err := state.applyDeviceUpdates(device.DevicesInfo{
+			"gpu": {UID: "gpu", Health: device.HealthHealthy, HealthState: update.healthState, HealthStatus: map[string]string{}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if needToPublish != update.expectPublish {
+			t.Errorf("%v: expected publish %v, got %v", update.healthState, update.expectPublish, needToPublish)
+		}
+		if got := healthState(); got != update.healthState {
+			t.Errorf("expected health state %v, got %v", update.healthState, got)
+		}
+	}
+}
+
+func TestPrepareSharedDevice(t *testing.T) {
+	state := &nodeState{
+		Allocatable: map[string]*device.DeviceInfo{
+			"0000-00-02-0-0x56c0": {
+				UID:        "0000-00-02-0-0x56c0",
+				PCIAddress: "0000:00:02.0",
+				MemoryMiB:  16384,
+				Health:     device.HealthHealthy,
+			},
+		},
+		Prepared:               ClaimPreparations{},
+		PreparedClaimsFilePath: path.Join(t.TempDir(), device.PreparedClaimsFileName),
+		NodeName:               "test-node",
+		MaxClaimsPerDevice:     2,
+	}
+
+	newClaim := func(claimUID string) *resourcev1.ResourceClaim {
+		return testhelpers.NewClaim("default", claimUID, claimUID, "request1", device.DriverName, "test-node", []string{"0000-00-02-0-0x56c0"}, false)
+	}
+
+	for _, claimUID := range []string{"uid1", "uid2"} {
+		if _, err := state.Prepare(context.Background(), newClaim(claimUID)); err != nil {
+			t.Fatalf("unexpected error preparing claim %v: %v", claimUID, err)
+		}
+	}
+
+	_, err := state.Prepare(context.Background(), newClaim("uid3"))
+	errorCheck(t, "third claim", "no share capacity left", err)
+
+	if err := state.Unprepare(context.Background(), "uid1"); err != nil {
+		t.Fatalf("unexpected error unpreparing claim: %v", err)
+	}
+	if _, err := state.Prepare(context.Background(), newClaim("uid3")); err != nil {
+		t.Errorf("unexpected error preparing claim after unprepare: %v", err)
+	}
+
+	resourceDevice := state.GetResources().Pools["test-node"].Slices[0].Devices[0]
+	if resourceDevice.AllowMultipleAllocations == nil || !*resourceDevice.AllowMultipleAllocations {
+		t.Error("expected shared device to allow multiple allocations")
+	}
+	sharesCapacity := resourceDevice.Capacity["shares"].Value
+	if shares := sharesCapacity.Value(); shares != 2 {
+		t.Errorf("expected shares capacity 2, got %v", shares)
+	}
+	if strategy := *resourceDevice.Attributes["sharingStrategy"].StringValue; strategy != SharingStrategyTimeSharing {
+		t.Errorf("expected sharing strategy %v, got %v", SharingStrategyTimeSharing, strategy)
+	}
+	if shares := *resourceDevice.Attributes["shareCapacity"].IntValue; shares != 2 {
+		t.Errorf("expected share capacity attribute 2, got %v", shares)
+	}
+
+	state.MaxClaimsPerDevice = 0
+	resourceDevice = state.GetResources().Pools["test-node"].Slices[0].Devices[0]
+	if strategy := *resourceDevice.Attributes["sharingStrategy"].StringValue; strategy != SharingStrategyExclusive {
+		t.Errorf("expected sharing strategy %v without sharing, got %v", SharingStrategyExclusive, strategy)
+	}
+	if shares := *resourceDevice.Attributes["shareCapacity"].IntValue; shares != 1 {
+		t.Errorf("expected share capacity attribute 1 without sharing, got %v", shares)
+	}
+	if _, found := resourceDevice.Capacity["shares"]; found {
+		t.Error("expected no shares capacity without sharing")
+	}
+}
+
+func TestPreparePoolPerModel(t *testing.T) {
+	state := &nodeState{
+		Allocatable: map[string]*device.DeviceInfo{
+			"0000-03-00-0-0x56c0": {UID: "0000-03-00-0-0x56c0", Model: "0x56c0", Health: device.HealthHealthy},
+		},
+		Prepared:               ClaimPreparations{},
+		PreparedClaimsFilePath: path.Join(t.TempDir(), device.PreparedClaimsFileName),
+		NodeName:               "test-node",
+		PoolPerModel:           true,
+		MaxClaimsPerDevice:     2,
+		DiagnosticAttributes:   true,
+	}
+
+	publishedDevice := func() resourcev1.Device {
+		return state.GetResources().Pools["test-node-56c0"].Slices[0].Devices[0]
+	}
+	claim := testhelpers.NewClaim("default", "uid1", "uid1", "request1", device.DriverName, "test-node-56c0", []string{"0000-03-00-0-0x56c0"}, false)
+	result, err := state.Prepare(context.Background(), claim)
+	if err != nil {
+		t.Fatalf("unexpected error preparing claim from per-model pool: %v", err)
+	}
+	if len(result.Devices) != 1 || result.Devices[0].PoolName != "test-node-56c0" {
+		t.Fatalf("expected device from pool test-node-56c0 prepared, got %+v", result.Devices)
+	}
+	if !*publishedDevice().Attributes["allocated"].BoolValue {
+		t.Error("expected device to be published as allocated")
+	}
+
+	// The device is not published in the node pool.
+	wrongPool := testhelpers.NewClaim("default", "uid2", "uid2", "request1", device.DriverName, "test-node", []string{"0000-03-00-0-0x56c0"}, false)
+	_, err = state.Prepare(context.Background(), wrongPool)
+	errorCheck(t, "node pool", "not in pool test-node", err)
+
+	// Pools of other nodes are ignored.
+	otherNode := testhelpers.NewClaim("default", "uid3", "uid3", "request1", device.DriverName, "other-node-56c0", []string{"0000-03-00-0-0x56c0"}, false)
+	if result, err := state.Prepare(context.Background(), otherNode); err != nil || len(result.Devices) != 0 {
+		t.Errorf("expected devices of other node pool to be ignored, got %+v, %v", result.Devices, err)
+	}
+
+	if err := state.Unprepare(context.Background(), "uid1"); err != nil {
+		t.Fatalf("unexpected error unpreparing claim: %v", err)
+	}
+	if *publishedDevice().Attributes["allocated"].BoolValue {
+		t.Error("expected device not to be published as allocated after unprepare")
+	}
+}
+
+func TestUnprepareRemovedDevice(t *testing.T) {
+	state := &nodeState{
+		Allocatable: map[string]*device.DeviceInfo{
+			"0000-00-02-0-0x56c0": {UID: "0000-00-02-0-0x56c0", Health: device.HealthHealthy},
+		},
+		Prepared:               ClaimPreparations{},
+		PreparedClaimsFilePath: path.Join(t.TempDir(), device.PreparedClaimsFileName),
+		NodeName:               "test-node",
+	}
+
+	claim := testhelpers.NewClaim("default", "uid1", "uid1", "request1", device.DriverName, "test-node", []string{"0000-00-02-0-0x56c0"}, false)
+	if _, err := state.Prepare(context.Background(), claim); err != nil {
+		t.Fatalf("unexpected error preparing claim: %v", err)
+	}
+
+	// The device disappears, e.g. after it was unbound from the kernel driver.
+	allocatableDevices, _ := state.Allocatable.(map[string]*device.DeviceInfo)
+	delete(allocatableDevices, "0000-00-02-0-0x56c0")
+
+	if err := state.Unprepare(context.Background(), "uid1"); err != nil {
+		t.Fatalf("unexpected error unpreparing claim of removed device: %v", err)
+	}
+	if _, found := state.Prepared["uid1"]; found {
+		t.Error("expected claim of removed device to be unprepared")
+	}
+	if resources := state.GetResources(); len(resources.Pools["test-node"].Slices[0].Devices) != 0 {
+		t.Errorf("expected no devices published, got %v", resources.Pools["test-node"].Slices[0].Devices)
+	}
+}
+
+func TestPrepareCardNode(t *testing.T) {
+	newClaim := func(claimUID string, deviceUID string, parameters string) *resourcev1.ResourceClaim {
+		claim := testhelpers.NewClaim("default", claimUID, claimUID, "request1", device.DriverName, "test-node", []string{deviceUID}, false)
+		if parameters != "" {
+			claim.Status.Allocation.Devices.Config = []resourcev1.DeviceAllocationConfiguration{
+				{
+					Source: resourcev1.AllocationConfigSourceClaim,
+					DeviceConfiguration: resourcev1.DeviceConfiguration{
+						Opaque: &resourcev1.OpaqueDeviceConfiguration{
+							Driver:     device.DriverName,
+							Parameters: runtime.RawExtension{Raw: []byte(parameters)},
+						},
+					},
+				},
+			}
+		}
+		return claim
+	}
+
+	tests := []struct {
+		name          string
+		claim         *resourcev1.ResourceClaim
+		expectedCDIID string
+		expectedError string
+	}{
+		{
+			name:          "card node by default",
+			claim:         newClaim("uid1", "gpu-render", ""),
+			expectedCDIID: "intel.com/gpu=gpu-render",
+		},
+		{
+			name:          "card node requested explicitly",
+			claim:         newClaim("uid2", "gpu-render", `{"apiVersion":"gpu.intel.com/v1alpha1","kind":"GPUConfig","cardNode":true}`),
+			expectedCDIID: "intel.com/gpu=gpu-render",
+		},
+		{
+			name:          "render node only",
+			claim:         newClaim("uid3", "gpu-render", `{"apiVersion":"gpu.intel.com/v1alpha1","kind":"GPUConfig","cardNode":false}`),
+			expectedCDIID: "intel.com/gpu=gpu-render-render",
+		},
+		{
+			name:          "render node only on device without render node",
+			claim:         newClaim("uid4", "gpu-card", `{"cardNode":false}`),
+			expectedError: "has no render node",
+		},
+		{
+			name:          "invalid parameters",
+			claim:         newClaim("uid5", "gpu-render", `{"kind":"QATConfig"}`),
+			expectedError: "unsupported kind",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &nodeState{
+				Allocatable: map[string]*device.DeviceInfo{
+					"gpu-render": {UID: "gpu-render", CardIdx: 0, RenderdIdx: 128, Health: device.HealthHealthy},
+					"gpu-card":   {UID: "gpu-card", CardIdx: 1, Health: device.HealthHealthy},
+				},
+				Prepared:               ClaimPreparations{},
+				PreparedClaimsFilePath: path.Join(t.TempDir(), device.PreparedClaimsFileName),
+				NodeName:               "test-node",
+			}
+
+			result, err := state.Prepare(context.Background(), tt.claim)
+			if tt.expectedError != "" {
+				errorCheck(t, tt.name, tt.expectedError, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cdiIDs := result.Devices[0].CDIDeviceIDs; !reflect.DeepEqual(cdiIDs, []string{tt.expectedCDIID}) {
+				t.Errorf("expected CDI device IDs %v, got %v", []string{tt.expectedCDIID}, cdiIDs)
+			}
+		})
+	}
+}
+
+func TestGetResourcesAllocatedAttribute(t *testing.T) {
+	state := &nodeState{
+		Allocatable: map[string]*device.DeviceInfo{
+			"gpu-prepared":       {UID: "gpu-prepared", Health: device.HealthHealthy},
+			"gpu-admin-prepared": {UID: "gpu-admin-prepared", Health: device.HealthHealthy},
+			"gpu-free":           {UID: "gpu-free", Health: device.HealthHealthy},
+		},
+		Prepared: ClaimPreparations{
+			"claim-1": {PreparedDevices: []PreparedDevice{
+				{KubeletpluginDevice: kubeletplugin.Device{DeviceName: "gpu-prepared", PoolName: "test-node"}},
+			}},
+			"claim-2": {PreparedDevices: []PreparedDevice{
+				{KubeletpluginDevice: kubeletplugin.Device{DeviceName: "gpu-admin-prepared", PoolName: "test-node"}, AdminAccess: true},
+			}},
+		},
+		NodeName:             "test-node",
+		DiagnosticAttributes: true,
+	}
+
+	expected := map[string]bool{"gpu-prepared": true, "gpu-admin-prepared": false, "gpu-free": false}
+	for _, dev := range state.GetResources().Pools["test-node"].Slices[0].Devices {
+		if allocated := *dev.Attributes["allocated"].BoolValue; allocated != expected[dev.Name] {
+			t.Errorf("device %v: expected allocated %v, got %v", dev.Name, expected[dev.Name], allocated)
+		}
+	}
+}
+
+func TestApplyDeviceUpdatesXPUMDMismatch(t *testing.T) {
+	registerMetrics()
+
+	state := &nodeState{
+		NodeName: "node1",
+		Allocatable: map[string]*device.DeviceInfo{
+			"0000-03-00-0-0x56c0": {UID: "0000-03-00-0-0x56c0", Model: "0x56c0", Driver: "xe", MemoryMiB: 16384, Health: device.HealthHealthy},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		update           *device.DeviceInfo
+		expectedMismatch bool
+		expectedPublish  bool
+	}{
+		{
+			name:             "xpumd reports memory",
+			update:           &device.DeviceInfo{UID: "0000-03-00-0-0x56c0", Model: "0x56c0", MemoryMiB: 16384, Health: device.HealthHealthy},
+			expectedMismatch: false,
+			expectedPublish:  false,
+		},
+		{
+			name:             "xpumd reports no memory",
+			update:           &device.DeviceInfo{UID: "0000-03-00-0-0x56c0", Model: "0x56c0", Health: device.HealthHealthy},
+			expectedMismatch: true,
+			expectedPublish:  true,
+		},
+		{
+			name:             "sysfs health backend report is not cross-checked",
+			update:           &device.DeviceInfo{UID: "0000-03-00-0-0x56c0", Health: device.HealthHealthy},
+			expectedMismatch: true,
+			expectedPublish:  false,
+		},
+		{
+			name:             "xpumd reports memory again",
+			update:           &device.DeviceInfo{UID: "0000-03-00-0-0x56c0", Model: "0x56c0", MemoryMiB: 16384, Health: device.HealthHealthy},
+			expectedMismatch: false,
+			expectedPublish:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publish, err := state.applyDeviceUpdates(device.DevicesInfo{tt.update.UID: tt.update})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if publish != tt.expectedPublish {
+				t.Errorf("expected publish %v, got %v", tt.expectedPublish, publish)
+			}
+
+			resources := state.GetResources()
+			mismatch := resources.Pools["node1"].Slices[0].Devices[0].Attributes["xpumdMismatch"].BoolValue
+			if mismatch == nil || *mismatch != tt.expectedMismatch {
+				t.Errorf("expected xpumdMismatch attribute %v, got %v", tt.expectedMismatch, mismatch)
+			}
+		})
+	}
+}
+
+func TestHealthTaint(t *testing.T) {
+	tests := []struct {
+		name         string
+		healthStatus map[string]string
+		expectedKey  string
+	}{
+		{
+			name:         "single health type",
+			healthStatus: map[string]string{"CoreThermal": device.HealthUnhealthy, "MemoryThermal": device.HealthHealthy},
+			expectedKey:  "HealthIssues-CoreThermal",
+		},
+		{
+			name:         "sorted health types",
+			healthStatus: map[string]string{"MemoryThermal": device.HealthUnhealthy, "[CoreThermal]": device.HealthUnhealthy},
+			expectedKey:  "HealthIssues-CoreThermal_MemoryThermal",
+		},
+		{
+			name:         "unsafe characters",
+			healthStatus: map[string]string{"[Core Thermal,Power]": device.HealthUnhealthy},
+			expectedKey:  "HealthIssues-Core_Thermal_Power",
+		},
+		{
+			name:         "no unhealthy health type",
+			healthStatus: map[string]string{},
+			expectedKey:  "HealthIssues",
+		},
+		{
+			name: "longest fitting key",
+			healthStatus: map[string]string{
+				"CoreThermal": device.HealthUnhealthy, "MemoryThermal": device.HealthUnhealthy,
+				"Power": device.HealthUnhealthy, "Memory": device.HealthUnhealthy, "FabricPort": device.HealthUnhealthy,
+			},
+			expectedKey: "HealthIssues-CoreThermal_FabricPort_Memory_MemoryThermal_Power",
+		},
+		{
+			name: "truncated",
+			healthStatus: map[string]string{
+				"CoreThermal": device.HealthUnhealthy, "MemoryThermal": device.HealthUnhealthy, "Power": device.HealthUnhealthy,
+				"Memory": device.HealthUnhealthy, "FabricPort": device.HealthUnhealthy, "SelfTest": device.HealthUnhealthy,
+			},
+			expectedKey: "HealthIssues-CoreThermal_FabricPort_Memory_MemoryThermal_Power",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taint := healthTaint(&device.DeviceInfo{Health: device.HealthUnhealthy, HealthStatus: tt.healthStatus})
+			if taint.Key != tt.expectedKey {
+				t.Errorf("expected taint key %v, got %v", tt.expectedKey, taint.Key)
+			}
+			if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+				t.Errorf("invalid taint key %v: %v", taint.Key, errs)
+			}
+			if taint.Effect != resourcev1.DeviceTaintEffectNoExecute {
+				t.Errorf("expected NoExecute taint effect, got %v", taint.Effect)
+			}
+		})
+	}
+}
+
+func TestHealthTaintClearedOnRecovery(t *testing.T) {
+	registerMetrics()
+
+	uid := "0000-03-00-0-0x56c0"
+	state := &nodeState{
+		NodeName: "node1",
+		Allocatable: map[string]*device.DeviceInfo{
+			uid: {UID: uid, Model: "0x56c0", Driver: "xe", CurrentDriver: "xe", Health: device.HealthHealthy},
+		},
+	}
+
+	healthTaints := func() []string {
+		keys := []string{}
+		for _, taint := range state.GetResources().Pools["node1"].Slices[0].Devices[0].Taints {
+			if strings.HasPrefix(taint.Key, healthTaintKeyPrefix) {
+				keys = append(keys, taint.Key)
+			}
+		}
+		return keys
+	}
+
+	updates := []struct {
+		health         string
+		healthStatus   map[string]string
+		expectedTaints []string
+	}{
+		{health: device.HealthUnhealthy, healthStatus: map[string]string{"CoreThermal": device.HealthUnhealthy}, expectedTaints: []string{"HealthIssues-CoreThermal"}},
+		{health: device.HealthHealthy, healthStatus: map[string]string{"CoreThermal": device.HealthHealthy}, expectedTaints: []string{}},
+	}
+
+	for _, update := range updates {
+		if _, err := state.applyDeviceUpdates(device.DevicesInfo{
+			uid: {UID: uid, Health: update.health, HealthStatus: update.healthStatus},
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if taints := healthTaints(); !reflect.DeepEqual(taints, update.expectedTaints) {
+			t.Errorf("health %v: expected taints %v, got %v", update.health, update.expectedTaints, taints)
+		}
+	}
+}
+
+func TestApplyDeviceUpdatesHealthObserveOnly(t *testing.T) {
+	registerMetrics()
+	healthTransitions.Reset()
+
+	uid := "0000-03-00-0-0x56c0"
+	state := &nodeState{
+		NodeName: "node1",
+		Allocatable: map[string]*device.DeviceInfo{
+			uid: {UID: uid, Model: "0x56c0", Driver: "xe", CurrentDriver: "xe", Health: device.HealthHealthy},
+		},
+		HealthObserveOnly: true,
+	}
+
+	publish, err := state.applyDeviceUpdates(device.DevicesInfo{
+		uid: {UID: uid, Health: device.HealthUnhealthy, HealthState: device.HealthUnhealthy, HealthStatus: map[string]string{"CoreThermal": device.HealthUnhealthy}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if publish {
+		t.Error("expected no ResourceSlice publishing in observe-only mode")
+	}
+
+	gpu := state.Allocatable.(map[string]*device.DeviceInfo)[uid]
+	if gpu.Health != device.HealthHealthy || gpu.GetHealthState() != device.HealthHealthy {
+		t.Errorf("expected device health to stay healthy, got %v (%v)", gpu.Health, gpu.GetHealthState())
+	}
+	if gpu.HealthStatus["CoreThermal"] != device.HealthUnhealthy {
+		t.Errorf("expected health status to be recorded, got %v", gpu.HealthStatus)
+	}
+	if taints := state.GetResources().Pools["node1"].Slices[0].Devices[0].Taints; len(taints) != 0 {
+		t.Errorf("expected no taints, got %v", taints)
+	}
+
+	value, err := testutil.GetCounterMetricValue(healthTransitions.WithLabelValues(uid, "CoreThermal", device.HealthUnhealthy))
+	if err != nil || value != 1 {
+		t.Errorf("expected one health transition counted, got %v (err: %v)", value, err)
+	}
+}
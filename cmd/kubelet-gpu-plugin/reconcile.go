@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	cdihelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/cdihelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+// reconcileCDI repairs drift between prepared claims and GPU CDI specs.
+func (s *nodeState) reconcileCDI() (helpers.ReconcileResult, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return helpers.ReconcileCDI(s.CdiCache, device.CDIKind, s)
+}
+
+// PreparedCDIDevices implements helpers.ReconcileAdapter.
+func (s *nodeState) PreparedCDIDevices() map[string][]string {
+	cdiDevices := map[string][]string{}
+	for claimUID, claimPreparation := range s.Prepared {
+		for _, preparedDevice := range claimPreparation.PreparedDevices {
+			cdiDevices[string(claimUID)] = append(cdiDevices[string(claimUID)], preparedDevice.KubeletpluginDevice.CDIDeviceIDs...)
+		}
+	}
+
+	return cdiDevices
+}
+
+// PreparedClaimBacked implements helpers.ReconcileAdapter.
+func (s *nodeState) PreparedClaimBacked(claimUID string) bool {
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	for _, preparedDevice := range s.Prepared[types.UID(claimUID)].PreparedDevices {
+		if _, found := allocatableDevices[preparedDevice.KubeletpluginDevice.DeviceName]; !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RecreateCDIDevices implements helpers.ReconcileAdapter. GPU CDI devices do
+// not depend on claims, so all of them are written again.
+func (s *nodeState) RecreateCDIDevices(claimUID string, missing []string) error {
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	if err := cdihelpers.AddDetectedDevicesToCDIRegistry(s.CdiCache, allocatableDevices); err != nil {
+		return fmt.Errorf("could not write CDI devices of claim %v: %w", claimUID, err)
+	}
+
+	return nil
+}
+
+// DropPreparedClaim implements helpers.ReconcileAdapter.
+func (s *nodeState) DropPreparedClaim(claimUID string) error {
+	delete(s.Prepared, types.UID(claimUID))
+
+	if err := WritePreparedClaimsToFile(s.PreparedClaimsFilePath, s.Prepared); err != nil {
+		return fmt.Errorf("failed to write prepared claims to file: %v", err)
+	}
+
+	return nil
+}
+
+// IsValidCDIDevice implements helpers.ReconcileAdapter, GPU CDI devices are
+// valid when backed by an allocatable device.
+func (s *nodeState) IsValidCDIDevice(deviceName string) bool {
+	allocatableDevices, _ := s.Allocatable.(map[string]*device.DeviceInfo)
+	_, found := allocatableDevices[strings.TrimSuffix(deviceName, device.CDIRenderOnlySuffix)]
+
+	return found
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+)
+
+const (
+	SelfTestTimeoutDefault = time.Minute
+
+	// Replaced with the PCI address of the tested device in self-test command arguments.
+	selfTestPCIAddressPlaceholder = "{pciAddress}"
+)
+
+// selfTest runs a command validating a device before it is advertised.
+type selfTest struct {
+	command []string
+	timeout time.Duration
+}
+
+// newSelfTest returns nil when no self-test command is configured.
+func newSelfTest(command string, timeout time.Duration) *selfTest {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return &selfTest{
+		command: fields,
+		timeout: timeout,
+	}
+}
+
+// run runs the self-test command for the device. The device is passed in
+// the command arguments and in GPU_PCI_ADDRESS, GPU_CARD_IDX and
+// GPU_RENDERD_IDX environment variables. Non-zero exit status fails the test.
+func (t *selfTest) run(ctx context.Context, gpu *device.DeviceInfo) error {
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	args := []string{}
+	for _, arg := range t.command[1:] {
+		args = append(args, strings.ReplaceAll(arg, selfTestPCIAddressPlaceholder, gpu.PCIAddress))
+	}
+
+	cmd := exec.CommandContext(ctx, t.command[0], args...)
+	cmd.Env = append(os.Environ(),
+		"GPU_PCI_ADDRESS="+gpu.PCIAddress,
+		fmt.Sprintf("GPU_CARD_IDX=%d", gpu.CardIdx),
+		fmt.Sprintf("GPU_RENDERD_IDX=%d", gpu.RenderdIdx),
+	)
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("self-test timed out after %v", t.timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("self-test failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// runAll tests the devices one by one and records the result as SelfTest
+// health type. Devices failing the test become unhealthy.
+func (t *selfTest) runAll(ctx context.Context, devices device.DevicesInfo) {
+	for _, gpu := range devices {
+		start := time.Now()
+		err := t.run(ctx, gpu)
+		if gpu.HealthStatus == nil {
+			gpu.HealthStatus = map[string]string{}
+		}
+
+		if err != nil {
+			klog.Errorf("Device %v failed self-test, marking it unhealthy: %v", gpu.UID, err)
+			gpu.HealthStatus[device.HealthTypeSelfTest] = device.HealthUnhealthy
+			gpu.Health = device.HealthUnhealthy
+			continue
+		}
+
+		klog.Infof("Device %v passed self-test in %v", gpu.UID, time.Since(start).Round(time.Millisecond))
+		gpu.HealthStatus[device.HealthTypeSelfTest] = device.HealthHealthy
+	}
+}
+
+// keepSelfTestHealth carries the self-test result over to health updates of
+// the health backends, which do not run the self-test.
+func keepSelfTestHealth(foundDevice *device.DeviceInfo, newDeviceInfo *device.DeviceInfo) {
+	selfTestHealth, tested := foundDevice.HealthStatus[device.HealthTypeSelfTest]
+	if !tested {
+		return
+	}
+	if _, reported := newDeviceInfo.HealthStatus[device.HealthTypeSelfTest]; reported {
+		return
+	}
+
+	healthStatus := maps.Clone(newDeviceInfo.HealthStatus)
+	if healthStatus == nil {
+		healthStatus = map[string]string{}
+	}
+	healthStatus[device.HealthTypeSelfTest] = selfTestHealth
+	newDeviceInfo.HealthStatus = healthStatus
+
+	if selfTestHealth == device.HealthUnhealthy {
+		newDeviceInfo.Health = device.HealthUnhealthy
+		if newDeviceInfo.HealthState != "" {
+			newDeviceInfo.HealthState = device.HealthUnhealthy
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+)
+
+func TestSelfTest(t *testing.T) {
+	if newSelfTest("  ", time.Second) != nil {
+		t.Errorf("expected no self-test without command")
+	}
+
+	tests := []struct {
+		name           string
+		command        string
+		timeout        time.Duration
+		expectedHealth string
+	}{
+		{name: "passing command", command: "true", expectedHealth: device.HealthHealthy},
+		{name: "failing command", command: "false", expectedHealth: device.HealthUnhealthy},
+		{name: "missing command", command: "/nonexistent/self-test", expectedHealth: device.HealthUnhealthy},
+		{name: "PCI address in arguments", command: "test {pciAddress} = 0000:03:00.0", expectedHealth: device.HealthHealthy},
+		{name: "timeout", command: "sleep 10", timeout: 100 * time.Millisecond, expectedHealth: device.HealthUnhealthy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = SelfTestTimeoutDefault
+			}
+			gpu := &device.DeviceInfo{UID: "0000-03-00-0-0x56c0", PCIAddress: "0000:03:00.0", Health: device.HealthHealthy}
+
+			newSelfTest(tt.command, timeout).runAll(context.Background(), device.DevicesInfo{gpu.UID: gpu})
+
+			if gpu.Health != tt.expectedHealth {
+				t.Errorf("expected health %v, got %v", tt.expectedHealth, gpu.Health)
+			}
+			if gpu.HealthStatus[device.HealthTypeSelfTest] != tt.expectedHealth {
+				t.Errorf("expected self-test health %v, got %v", tt.expectedHealth, gpu.HealthStatus[device.HealthTypeSelfTest])
+			}
+		})
+	}
+}
+
+func TestKeepSelfTestHealth(t *testing.T) {
+	tests := []struct {
+		name           string
+		found          *device.DeviceInfo
+		update         *device.DeviceInfo
+		expectedHealth string
+		expectedStatus map[string]string
+	}{
+		{
+			name:           "not tested",
+			found:          &device.DeviceInfo{Health: device.HealthHealthy},
+			update:         &device.DeviceInfo{Health: device.HealthHealthy, HealthStatus: map[string]string{"CoreThermal": device.HealthHealthy}},
+			expectedHealth: device.HealthHealthy,
+			expectedStatus: map[string]string{"CoreThermal": device.HealthHealthy},
+		},
+		{
+			name:           "self-test passed",
+			found:          &device.DeviceInfo{Health: device.HealthHealthy, HealthStatus: map[string]string{device.HealthTypeSelfTest: device.HealthHealthy}},
+			update:         &device.DeviceInfo{Health: device.HealthHealthy, HealthStatus: map[string]string{"CoreThermal": device.HealthHealthy}},
+			expectedHealth: device.HealthHealthy,
+			expectedStatus: map[string]string{"CoreThermal": device.HealthHealthy, device.HealthTypeSelfTest: device.HealthHealthy},
+		},
+		{
+			name:           "self-test failed",
+			found:          &device.DeviceInfo{Health: device.HealthUnhealthy, HealthStatus: map[string]string{device.HealthTypeSelfTest: device.HealthUnhealthy}},
+			update:         &device.DeviceInfo{Health: device.HealthHealthy},
+			expectedHealth: device.HealthUnhealthy,
+			expectedStatus: map[string]string{device.HealthTypeSelfTest: device.HealthUnhealthy},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keepSelfTestHealth(tt.found, tt.update)
+
+			if tt.update.Health != tt.expectedHealth {
+				t.Errorf("expected health %v, got %v", tt.expectedHealth, tt.update.Health)
+			}
+			if !reflect.DeepEqual(tt.update.HealthStatus, tt.expectedStatus) {
+				t.Errorf("expected health status %v, got %v", tt.expectedStatus, tt.update.HealthStatus)
+			}
+		})
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"strings"
 	"time"
 
 	xpumapi "github.com/intel/xpumanager/xpumd/exporter/api/deviceinfo/v1alpha1"
@@ -41,8 +43,71 @@ const (
 	// DRA driver init and result in a graceful exit with an error.
 	ConnectAttemptsMax     = 30
 	ConnectAttemptInterval = 10 * time.Second
+
+	// Health type severity mapping values, see parseHealthSeverities.
+	HealthSeverityWarning  = "warning"
+	HealthSeverityCritical = "critical"
+	HealthSeverityIgnore   = "ignore"
+
+	// severityNever is above all xpumd severity levels, so that a health type
+	// mapped to it never makes the device unhealthy.
+	severityNever xpumapi.SeverityLevel = math.MaxInt32
 )
 
+// healthSeverities maps xpumd health types, e.g. "Memory", to the lowest
+// severity making the device unhealthy. Types not in the map use the
+// threshold given by --ignore-health-warning.
+type healthSeverities map[string]xpumapi.SeverityLevel
+
+// parseHealthSeverities parses a comma-separated list of <health type>=<severity>
+// pairs, where severity is warning, critical or ignore, e.g.
+// "Memory=warning,FabricPort=ignore". Health types are case-insensitive.
+func parseHealthSeverities(mapping string) (healthSeverities, error) {
+	severities := healthSeverities{}
+	for _, item := range strings.Split(mapping, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		healthType, severity, found := strings.Cut(item, "=")
+		healthType = healthTypeKey(healthType)
+		if !found || healthType == "" {
+			return nil, fmt.Errorf("invalid health severity '%s', expected <health type>=<severity>", item)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(severity)) {
+		case HealthSeverityWarning:
+			severities[healthType] = xpumapi.SeverityLevel_SEVERITY_LEVEL_WARNING
+		case HealthSeverityCritical:
+			severities[healthType] = xpumapi.SeverityLevel_SEVERITY_LEVEL_CRITICAL
+		case HealthSeverityIgnore:
+			severities[healthType] = severityNever
+		default:
+			return nil, fmt.Errorf("invalid severity '%s' for health type '%s', expected %s, %s or %s",
+				severity, healthType, HealthSeverityWarning, HealthSeverityCritical, HealthSeverityIgnore)
+		}
+	}
+
+	return severities, nil
+}
+
+// healthTypeKey returns the health type as matched in healthSeverities:
+// lowercase, without the brackets some xpumd versions report, e.g. "[Memory]".
+func healthTypeKey(healthType string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(healthType), "[]"))
+}
+
+// unhealthyThreshold returns the lowest severity of the health type making the
+// device unhealthy.
+func (s healthSeverities) unhealthyThreshold(healthType string, defaultThreshold xpumapi.SeverityLevel) xpumapi.SeverityLevel {
+	if threshold, found := s[healthTypeKey(healthType)]; found {
+		return threshold
+	}
+
+	return defaultThreshold
+}
+
 func (d *driver) waitForXPUMDStream(ctx context.Context, c xpumapi.DeviceInfoClient) (xpumapi.DeviceInfo_WatchDeviceHealthClient, error) {
 	var err error
 	var stream xpumapi.DeviceInfo_WatchDeviceHealthClient
@@ -63,14 +128,14 @@ func (d *driver) waitForXPUMDStream(ctx context.Context, c xpumapi.DeviceInfoCli
 
 // xpumdListen is the entrypoint go routine to receive health status and device details
 // updates from XPUMD stream. The received updates are handled by ConsumeXPUMDDeviceDetails function.
-func (d *driver) xpumdListen(ctx context.Context, socketFilePath string) {
+// An error is returned when xpumd cannot be reached, nil when ctx is canceled.
+func (d *driver) xpumdListen(ctx context.Context, socketFilePath string) error {
 	klog.V(3).Info("starting xpumd listener")
 	var conn *grpc.ClientConn
 
 	conn, err := grpc.NewClient("unix://"+socketFilePath, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		klog.Error("xpumd-client: failed to create GRPC client, health monitoring will be disabled", "error", err)
-		return
+		return fmt.Errorf("xpumd-client: failed to create GRPC client: %v", err)
 	}
 	defer conn.Close() // nolint:errcheck
 
@@ -85,7 +150,7 @@ func (d *driver) xpumdListen(ctx context.Context, socketFilePath string) {
 
 	stream, err := d.waitForXPUMDStream(ctx, c)
 	if err != nil {
-		panic("xpumd-client: failed to connect to xpumd within expected time, exiting")
+		return xpumdListenError(ctx, fmt.Errorf("xpumd-client: failed to connect to xpumd within expected time: %v", err))
 	}
 
 	klog.V(5).Infof("xpumd-client: successfully connected to xpumd at %s", socketFilePath)
@@ -99,106 +164,116 @@ func (d *driver) xpumdListen(ctx context.Context, socketFilePath string) {
 			if errors.Is(err, io.EOF) {
 				// Socket was closed by remote, likely due to xpumd restart.
 				// Try to reconnect same way as on startup..
+				// Until reconnected, the last report must not shadow other backends.
 				klog.Errorf("xpumd-client: error receiving data: %v", err)
+				d.dropHealthReport(ctx, XPUMDHealthBackendName)
 				stream, err = d.waitForXPUMDStream(ctx, c)
 				if err != nil {
-					panic("xpumd-client: failed to reconnect to xpumd, exiting")
+					return xpumdListenError(ctx, fmt.Errorf("xpumd-client: failed to reconnect to xpumd: %v", err))
 				}
 				// Messages need to be fetched, continue to the next loop iteration.
 				continue
 			} else {
-				// Arbitrary error. Retry until maxErrors reached then panic in case the GRPC is incompatible.
+				// Arbitrary error. Retry until maxErrors reached then give up in case the GRPC is incompatible.
 				// If :latest DRA image tag is used chances are new image will fix the issue.
 				if errCounter < maxErrors {
 					klog.Errorf("xpumd-client: error receiving data: %v", err)
+					d.dropHealthReport(ctx, XPUMDHealthBackendName)
 					errCounter++
 					time.Sleep(arbitraryErrorDelay)
 					continue
 				}
 
-				panic(fmt.Sprintf("xpumd-client: %v consecutive errors: %v", maxErrors, err))
+				return xpumdListenError(ctx, fmt.Errorf("xpumd-client: %v consecutive errors: %v", maxErrors, err))
 			}
 		}
 
+		errCounter = 0
 		klog.V(5).Infof("xpumd-client: received %d device info items", len(msg.Devices))
 		d.ConsumeXPUMDDeviceDetails(ctx, msg.GetDevices())
 
 		if d.stopXPUMDListener {
 			klog.Info("xpumd-client: stopping xpumd listener")
-			return
+			return nil
 		}
 	}
 }
 
-// ConsumeXPUMDDeviceDetails passes the received info to the nodeState and publishes
-// updated ResourceSlice if needed.
-func (d *driver) ConsumeXPUMDDeviceDetails(ctx context.Context, devices []*xpumapi.DeviceHealth) {
-	devicesInfoUpdate := xpumDevicesToAllocatableDevicesInfo(devices, d.ignoreHealthWarning)
-
-	publishResourceSlice, err := d.state.applyDeviceUpdates(devicesInfoUpdate)
-	if err != nil {
-		klog.Errorf("could not apply health deltas: %v", err)
-		return
-	}
-
-	// Exit early if no device updates reported by applyDeviceUpdates().
-	if !publishResourceSlice {
-		return
+// xpumdListenError returns nil when the listener failed because ctx was canceled.
+func xpumdListenError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
 	}
 
-	// XPUMD stream is handled by a go routine, nothing we can do when publishing
-	// resource slice fails, so error is only logged.
-	if err := d.PublishResourceSlice(ctx); err != nil {
-		klog.Errorf("could not publish updated resource slice: %v", err)
-	}
+	return err
+}
 
-	// Resource Health Pod Status.
-	// Broadcast health state to all connected health streams.
-	response := d.buildHealthResponse()
-	d.broadcastHealthUpdateWithResponse(response)
+// ConsumeXPUMDDeviceDetails passes the received info to the health reports merge,
+// which updates the nodeState and publishes updated ResourceSlice if needed.
+func (d *driver) ConsumeXPUMDDeviceDetails(ctx context.Context, devices []*xpumapi.DeviceHealth) {
+	devicesInfoUpdate := xpumDevicesToAllocatableDevicesInfo(devices, d.ignoreHealthWarning, d.healthSeverities)
+	d.consumeHealthReport(ctx, XPUMDHealthBackendName, devicesInfoUpdate)
 }
 
-func xpumDevicesToAllocatableDevicesInfo(xpumDevice []*xpumapi.DeviceHealth, ignoreWarning bool) device.DevicesInfo {
+// xpumDevicesToAllocatableDevicesInfo converts the xpumd device health reports.
+// Health types reaching their unhealthy threshold make the device unhealthy,
+// ignored types are still reported in the health status of the device.
+func xpumDevicesToAllocatableDevicesInfo(xpumDevice []*xpumapi.DeviceHealth, ignoreWarning bool, severities healthSeverities) device.DevicesInfo {
 	devicesInfo := device.DevicesInfo{}
-	unhealthyThreshold := xpumapi.SeverityLevel_SEVERITY_LEVEL_WARNING
+	defaultThreshold := xpumapi.SeverityLevel_SEVERITY_LEVEL_WARNING
 	if ignoreWarning {
-		unhealthyThreshold = xpumapi.SeverityLevel_SEVERITY_LEVEL_CRITICAL
+		defaultThreshold = xpumapi.SeverityLevel_SEVERITY_LEVEL_CRITICAL
 	}
 
 	for _, xpumDevice := range xpumDevice {
 		xpumDeviceInfo := xpumDevice.GetInfo()
 		xpumDeviceHealth := xpumDevice.GetHealth()
 		overallHealth := device.HealthHealthy
+		healthState := device.HealthHealthy
 
 		klog.V(5).Infof("xpumd-client: processing device %s: %v\n%v", xpumDeviceInfo.Pci.Bdf, xpumDeviceInfo, xpumDeviceHealth)
 		deviceHealthStatus := make(map[string]string)
 		for _, health := range xpumDeviceHealth {
+			unhealthyThreshold := severities.unhealthyThreshold(health.GetName(), defaultThreshold)
+			// Ignored types are reported as if not ignored, without affecting the device health.
+			reportThreshold := unhealthyThreshold
+			if unhealthyThreshold == severityNever {
+				reportThreshold = defaultThreshold
+			}
 			healthValue := device.HealthHealthy
-			if health.GetSeverity() >= unhealthyThreshold {
+			if health.GetSeverity() >= reportThreshold {
 				klog.V(5).Infof("xpumd-client: device %s health issue: %s severity: %s", xpumDeviceInfo.Pci.Bdf, health.GetName(), health.GetSeverity().String())
 				healthValue = device.HealthUnhealthy
-				overallHealth = device.HealthUnhealthy
 			}
 			deviceHealthStatus[health.Name] = healthValue
-		}
 
-		model := xpumDeviceInfo.Pci.DeviceId
-		if len(model) == 4 {
-			model = "0x" + model
+			if health.GetSeverity() < unhealthyThreshold {
+				continue
+			}
+			overallHealth = device.HealthUnhealthy
+
+			switch {
+			case health.GetSeverity() >= xpumapi.SeverityLevel_SEVERITY_LEVEL_CRITICAL:
+				healthState = device.HealthUnhealthy
+			case healthState != device.HealthUnhealthy:
+				healthState = device.HealthDegraded
+			}
 		}
+
 		// Populate details and overall health.
 		deviceInfo := &device.DeviceInfo{
 			UID:          deviceHelpers.DeviceUIDFromPCIinfo(xpumDeviceInfo.Pci.Bdf, xpumDeviceInfo.Pci.DeviceId),
 			PCIAddress:   xpumDeviceInfo.Pci.Bdf,
-			Model:        model,
+			Model:        deviceHelpers.NormalizePCIDeviceID(xpumDeviceInfo.Pci.DeviceId),
 			ModelName:    xpumDeviceInfo.Model,
 			HealthStatus: deviceHealthStatus,
 			Health:       overallHealth,
+			HealthState:  healthState,
 		}
 
 		klog.V(5).Infof("xpumd-client: device %s has memory info: %v", deviceInfo.UID, xpumDeviceInfo.Memory)
 		if len(xpumDeviceInfo.Memory) > 0 {
-			deviceInfo.MemoryMiB = xpumDeviceInfo.Memory[0].Size / (1024 * 1024)
+			deviceInfo.SetMemory(xpumDeviceInfo.Memory[0].Size)
 		} else {
 			klog.V(5).Infof("xpumd-client: device %s has no memory info", deviceInfo.UID)
 		}
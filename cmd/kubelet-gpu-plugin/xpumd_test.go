@@ -9,6 +9,8 @@ import (
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
 	gpudevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/discovery"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 	testhelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
 )
 
@@ -160,7 +162,7 @@ func TestConsumeXPUMDDeviceDetails(t *testing.T) {
 			expectedHealth:      "Unhealthy",
 		},
 		{
-			// TODO: implement rediscovery. For now this just triggers error log message from the driver.
+			// TODO: implement rediscovery. For now the update of the unknown device is ignored.
 			name: "Unexpected undiscovered device missing from allocatable",
 			updates: []*xpumapi.DeviceHealth{
 				{
@@ -197,7 +199,7 @@ func TestConsumeXPUMDDeviceDetails(t *testing.T) {
 			// Check drv.state.Allocatable has been updated with the new health and memory info.
 			updatedDev, exists := drv.state.Allocatable.(map[string]*gpudevice.DeviceInfo)["0000-00-02-0-0x56c0"]
 			if tt.missingDevice {
-				// Nothing to check, the error must have been logged.
+				// Nothing to check, the update must have been ignored.
 				return
 			}
 			if !exists {
@@ -249,12 +251,14 @@ func TestXpumDevicesToAllocatableDevicesInfo(t *testing.T) {
 			ignoreWarning: true,
 			expectDevices: gpudevice.DevicesInfo{
 				"0000-00-02-0-0x56c0": &gpudevice.DeviceInfo{
-					UID:        "0000-00-02-0-0x56c0",
-					PCIAddress: "0000:00:02.0",
-					Model:      "0x56c0",
-					ModelName:  "Intel Arc A770",
-					MemoryMiB:  16384,
-					Health:     "Healthy",
+					UID:         "0000-00-02-0-0x56c0",
+					PCIAddress:  "0000:00:02.0",
+					Model:       "0x56c0",
+					ModelName:   "Intel Arc A770",
+					MemoryMiB:   16384,
+					MemoryBytes: 17179869184,
+					Health:      "Healthy",
+					HealthState: "Healthy",
 					HealthStatus: map[string]string{
 						"CoreThermal": "Healthy",
 					},
@@ -280,11 +284,12 @@ func TestXpumDevicesToAllocatableDevicesInfo(t *testing.T) {
 			ignoreWarning: false,
 			expectDevices: gpudevice.DevicesInfo{
 				"0000-00-02-0-0x56c0": &gpudevice.DeviceInfo{
-					UID:        "0000-00-02-0-0x56c0",
-					PCIAddress: "0000:00:02.0",
-					Model:      "0x56c0",
-					ModelName:  "Intel Arc A770",
-					Health:     "Unhealthy",
+					UID:         "0000-00-02-0-0x56c0",
+					PCIAddress:  "0000:00:02.0",
+					Model:       "0x56c0",
+					ModelName:   "Intel Arc A770",
+					Health:      "Unhealthy",
+					HealthState: "Degraded",
 					HealthStatus: map[string]string{
 						"CoreThermal": "Unhealthy",
 					},
@@ -310,11 +315,12 @@ func TestXpumDevicesToAllocatableDevicesInfo(t *testing.T) {
 			ignoreWarning: true,
 			expectDevices: gpudevice.DevicesInfo{
 				"0000-00-02-0-0x56c0": &gpudevice.DeviceInfo{
-					UID:        "0000-00-02-0-0x56c0",
-					PCIAddress: "0000:00:02.0",
-					Model:      "0x56c0",
-					ModelName:  "Intel Arc A770",
-					Health:     "Healthy",
+					UID:         "0000-00-02-0-0x56c0",
+					PCIAddress:  "0000:00:02.0",
+					Model:       "0x56c0",
+					ModelName:   "Intel Arc A770",
+					Health:      "Healthy",
+					HealthState: "Healthy",
 					HealthStatus: map[string]string{
 						"CoreThermal": "Healthy",
 					},
@@ -340,17 +346,51 @@ func TestXpumDevicesToAllocatableDevicesInfo(t *testing.T) {
 			ignoreWarning: true,
 			expectDevices: gpudevice.DevicesInfo{
 				"0000-00-02-0-0x56c0": &gpudevice.DeviceInfo{
-					UID:        "0000-00-02-0-0x56c0",
-					PCIAddress: "0000:00:02.0",
-					Model:      "0x56c0",
-					ModelName:  "Intel Arc A770",
-					Health:     "Unhealthy",
+					UID:         "0000-00-02-0-0x56c0",
+					PCIAddress:  "0000:00:02.0",
+					Model:       "0x56c0",
+					ModelName:   "Intel Arc A770",
+					Health:      "Unhealthy",
+					HealthState: "Unhealthy",
 					HealthStatus: map[string]string{
 						"CoreThermal": "Unhealthy",
 					},
 				},
 			},
 		},
+		{
+			name: "Device with WARNING and CRITICAL severity unhealthy state when ignoreWarning=false",
+			xpumDevices: []*xpumapi.DeviceHealth{
+				{
+					Info: &xpumapi.DeviceInformation{
+						Pci: &xpumapi.PciInfo{
+							Bdf:      "0000:00:02.0",
+							DeviceId: "0x56c0",
+						},
+						Model: "Intel Arc A770",
+					},
+					Health: []*xpumapi.HealthStatus{
+						{Name: "CoreThermal", Severity: xpumapi.SeverityLevel_SEVERITY_LEVEL_CRITICAL},
+						{Name: "Memory", Severity: xpumapi.SeverityLevel_SEVERITY_LEVEL_WARNING},
+					},
+				},
+			},
+			ignoreWarning: false,
+			expectDevices: gpudevice.DevicesInfo{
+				"0000-00-02-0-0x56c0": &gpudevice.DeviceInfo{
+					UID:         "0000-00-02-0-0x56c0",
+					PCIAddress:  "0000:00:02.0",
+					Model:       "0x56c0",
+					ModelName:   "Intel Arc A770",
+					Health:      "Unhealthy",
+					HealthState: "Unhealthy",
+					HealthStatus: map[string]string{
+						"CoreThermal": "Unhealthy",
+						"Memory":      "Unhealthy",
+					},
+				},
+			},
+		},
 		{
 			name: "Device with multiple health metrics",
 			xpumDevices: []*xpumapi.DeviceHealth{
@@ -372,11 +412,12 @@ func TestXpumDevicesToAllocatableDevicesInfo(t *testing.T) {
 			ignoreWarning: true,
 			expectDevices: gpudevice.DevicesInfo{
 				"0000-00-02-0-0x56c0": &gpudevice.DeviceInfo{
-					UID:        "0000-00-02-0-0x56c0",
-					PCIAddress: "0000:00:02.0",
-					Model:      "0x56c0",
-					ModelName:  "Intel Arc A770",
-					Health:     "Healthy",
+					UID:         "0000-00-02-0-0x56c0",
+					PCIAddress:  "0000:00:02.0",
+					Model:       "0x56c0",
+					ModelName:   "Intel Arc A770",
+					Health:      "Healthy",
+					HealthState: "Healthy",
 					HealthStatus: map[string]string{
 						"CoreThermal": "Healthy",
 						"Memory":      "Healthy",
@@ -420,11 +461,12 @@ func TestXpumDevicesToAllocatableDevicesInfo(t *testing.T) {
 			ignoreWarning: true,
 			expectDevices: gpudevice.DevicesInfo{
 				"0000-03-00-0-0x56c0": &gpudevice.DeviceInfo{
-					UID:        "0000-03-00-0-0x56c0",
-					PCIAddress: "0000:03:00.0",
-					Model:      "0x56c0",
-					ModelName:  "Intel Arc A770",
-					Health:     "Healthy",
+					UID:         "0000-03-00-0-0x56c0",
+					PCIAddress:  "0000:03:00.0",
+					Model:       "0x56c0",
+					ModelName:   "Intel Arc A770",
+					Health:      "Healthy",
+					HealthState: "Healthy",
 					HealthStatus: map[string]string{
 						"CoreThermal": "Healthy",
 						"Memory":      "Healthy",
@@ -432,11 +474,12 @@ func TestXpumDevicesToAllocatableDevicesInfo(t *testing.T) {
 					},
 				},
 				"0000-05-00-0-0x56c1": &gpudevice.DeviceInfo{
-					UID:        "0000-05-00-0-0x56c1",
-					PCIAddress: "0000:05:00.0",
-					Model:      "0x56c1",
-					ModelName:  "Intel Arc A750",
-					Health:     "Unhealthy",
+					UID:         "0000-05-00-0-0x56c1",
+					PCIAddress:  "0000:05:00.0",
+					Model:       "0x56c1",
+					ModelName:   "Intel Arc A750",
+					Health:      "Unhealthy",
+					HealthState: "Unhealthy",
 					HealthStatus: map[string]string{
 						"CoreThermal": "Healthy",
 						"Memory":      "Healthy",
@@ -449,7 +492,7 @@ func TestXpumDevicesToAllocatableDevicesInfo(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			devicesInfo := xpumDevicesToAllocatableDevicesInfo(tt.xpumDevices, tt.ignoreWarning)
+			devicesInfo := xpumDevicesToAllocatableDevicesInfo(tt.xpumDevices, tt.ignoreWarning, nil)
 
 			if len(devicesInfo) != len(tt.expectDevices) {
 				t.Fatalf("expected %d devices, got %d", len(tt.expectDevices), len(devicesInfo))
@@ -467,3 +510,229 @@ func TestXpumDevicesToAllocatableDevicesInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestParseHealthSeverities(t *testing.T) {
+	severities, err := parseHealthSeverities(" Memory=warning, [FabricPort]=IGNORE,Power=critical,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := healthSeverities{
+		"memory":     xpumapi.SeverityLevel_SEVERITY_LEVEL_WARNING,
+		"fabricport": severityNever,
+		"power":      xpumapi.SeverityLevel_SEVERITY_LEVEL_CRITICAL,
+	}
+	if !reflect.DeepEqual(severities, expected) {
+		t.Errorf("expected %v, got %v", expected, severities)
+	}
+
+	for _, mapping := range []string{"Memory", "=warning", "Memory=fatal"} {
+		if _, err := parseHealthSeverities(mapping); err == nil {
+			t.Errorf("expected error for '%v'", mapping)
+		}
+	}
+}
+
+func TestXpumHealthSeverities(t *testing.T) {
+	severities, err := parseHealthSeverities("Memory=warning,FabricPort=ignore")
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		health        []*xpumapi.HealthStatus
+		expectHealth  string
+		expectState   string
+		expectStatus  map[string]string
+		ignoreWarning bool
+	}{
+		{
+			name: "ignored critical type does not make device unhealthy",
+			health: []*xpumapi.HealthStatus{
+				{Name: "FabricPort", Severity: xpumapi.SeverityLevel_SEVERITY_LEVEL_CRITICAL},
+				{Name: "Power", Severity: xpumapi.SeverityLevel_SEVERITY_LEVEL_WARNING},
+			},
+			ignoreWarning: true,
+			expectHealth:  gpudevice.HealthHealthy,
+			expectState:   gpudevice.HealthHealthy,
+			expectStatus:  map[string]string{"FabricPort": gpudevice.HealthUnhealthy, "Power": gpudevice.HealthHealthy},
+		},
+		{
+			name: "warning of mapped type degrades device despite ignoring warnings",
+			health: []*xpumapi.HealthStatus{
+				{Name: "Memory", Severity: xpumapi.SeverityLevel_SEVERITY_LEVEL_WARNING},
+			},
+			ignoreWarning: true,
+			expectHealth:  gpudevice.HealthUnhealthy,
+			expectState:   gpudevice.HealthDegraded,
+			expectStatus:  map[string]string{"Memory": gpudevice.HealthUnhealthy},
+		},
+		{
+			name: "critical of unmapped type makes device unhealthy",
+			health: []*xpumapi.HealthStatus{
+				{Name: "FabricPort", Severity: xpumapi.SeverityLevel_SEVERITY_LEVEL_CRITICAL},
+				{Name: "CoreThermal", Severity: xpumapi.SeverityLevel_SEVERITY_LEVEL_CRITICAL},
+			},
+			ignoreWarning: true,
+			expectHealth:  gpudevice.HealthUnhealthy,
+			expectState:   gpudevice.HealthUnhealthy,
+			expectStatus:  map[string]string{"FabricPort": gpudevice.HealthUnhealthy, "CoreThermal": gpudevice.HealthUnhealthy},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xpumDevices := []*xpumapi.DeviceHealth{{
+				Info:   &xpumapi.DeviceInformation{Pci: &xpumapi.PciInfo{Bdf: "0000:03:00.0", DeviceId: "0x56c0"}},
+				Health: tt.health,
+			}}
+			deviceInfo := xpumDevicesToAllocatableDevicesInfo(xpumDevices, tt.ignoreWarning, severities)["0000-03-00-0-0x56c0"]
+			if deviceInfo == nil {
+				t.Fatal("expected device info")
+			}
+			if deviceInfo.Health != tt.expectHealth || deviceInfo.HealthState != tt.expectState {
+				t.Errorf("expected health %v and state %v, got %v and %v", tt.expectHealth, tt.expectState, deviceInfo.Health, deviceInfo.HealthState)
+			}
+			if !reflect.DeepEqual(deviceInfo.HealthStatus, tt.expectStatus) {
+				t.Errorf("expected health status %v, got %v", tt.expectStatus, deviceInfo.HealthStatus)
+			}
+		})
+	}
+}
+
+// xpu-smi versions report the PCI device ID in different formats, which must
+// not change the UID health updates are matched to discovered devices by.
+func TestXpumDeviceUIDMatchesDiscoveredUID(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(gpudevice.DriverName)
+	defer testhelpers.CleanupTest(t, "TestXpumDeviceUIDMatchesDiscoveredUID", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		gpudevice.DevicesInfo{
+			"0000-03-00-0-0x56c0": {Model: "0x56c0", PCIAddress: "0000:03:00.0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-03-00-0-0x56c0", Driver: gpudevice.SysfsXeDriverName},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	discoveredDevices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, gpudevice.DefaultNamingStyle, false, []string{gpudevice.SysfsXeDriverName}, false, helpers.DefaultDiscoveryTimeout, nil)
+
+	for _, deviceID := range []string{"56c0", "56C0", "0x56C0", "0x56c0"} {
+		xpumDevices := []*xpumapi.DeviceHealth{
+			{Info: &xpumapi.DeviceInformation{Pci: &xpumapi.PciInfo{Bdf: "0000:03:00.0", DeviceId: deviceID}}},
+		}
+		for uid, xpumDevice := range xpumDevicesToAllocatableDevicesInfo(xpumDevices, true, nil) {
+			discoveredDevice, found := discoveredDevices[uid]
+			if !found {
+				t.Errorf("device ID %v: UID %v does not match any discovered device", deviceID, uid)
+				continue
+			}
+			if xpumDevice.Model != discoveredDevice.Model {
+				t.Errorf("device ID %v: expected model %v, got %v", deviceID, discoveredDevice.Model, xpumDevice.Model)
+			}
+		}
+	}
+}
+
+// xpumdHealthReport returns an xpumd report of the device with the given
+// overall severity.
+func xpumdHealthReport(pciAddress string, deviceID string, severity xpumapi.SeverityLevel) *xpumapi.DeviceHealth {
+	return &xpumapi.DeviceHealth{
+		Info: &xpumapi.DeviceInformation{
+			Pci:    &xpumapi.PciInfo{Bdf: pciAddress, DeviceId: deviceID},
+			Memory: []*xpumapi.MemoryInfo{{Type: "gddr6", Size: uint64(16 * 1024 * 1024 * 1024)}},
+		},
+		Health: []*xpumapi.HealthStatus{
+			{Name: "temperature.core.gpu", Severity: severity, Reason: "test"},
+		},
+	}
+}
+
+func TestXPUMDReportOfFilteredDevices(t *testing.T) {
+	tests := []struct {
+		name     string
+		gpuFlags *GPUFlags
+		devices  gpudevice.DevicesInfo
+		filtered string
+	}{
+		{
+			name:     "device of other kernel driver",
+			gpuFlags: &GPUFlags{KernelDriver: gpudevice.SysfsXeDriverName},
+			devices: gpudevice.DevicesInfo{
+				"0000-03-00-0-0x56c0": {
+					UID: "0000-03-00-0-0x56c0", PCIAddress: "0000:03:00.0", Model: "0x56c0", DeviceType: "gpu",
+					Driver: gpudevice.SysfsXeDriverName, CardIdx: 0, RenderdIdx: 128, MemoryMiB: 16384,
+				},
+				"0000-04-00-0-0x56c0": {
+					UID: "0000-04-00-0-0x56c0", PCIAddress: "0000:04:00.0", Model: "0x56c0", DeviceType: "gpu",
+					Driver: gpudevice.SysfsI915DriverName, CardIdx: 1, RenderdIdx: 129, MemoryMiB: 16384,
+				},
+			},
+			filtered: "0000-04-00-0-0x56c0",
+		},
+		{
+			name:     "integrated GPU with discrete-only discovery",
+			gpuFlags: &GPUFlags{DiscreteOnly: true},
+			devices: gpudevice.DevicesInfo{
+				"0000-00-02-0-0xa7a0": {
+					UID: "0000-00-02-0-0xa7a0", PCIAddress: "0000:00:02.0", Model: "0xa7a0", DeviceType: "gpu",
+					Driver: gpudevice.SysfsXeDriverName, CardIdx: 0, RenderdIdx: 128,
+				},
+				"0000-03-00-0-0x56c0": {
+					UID: "0000-03-00-0-0x56c0", PCIAddress: "0000:03:00.0", Model: "0x56c0", DeviceType: "gpu",
+					Driver: gpudevice.SysfsXeDriverName, CardIdx: 1, RenderdIdx: 129, MemoryMiB: 16384,
+				},
+			},
+			filtered: "0000-00-02-0-0xa7a0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDirs, err := testhelpers.NewTestDirs(gpudevice.DriverName)
+			defer testhelpers.CleanupTest(t, "GPU TestXPUMDReportOfFilteredDevices", testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("setup error creating test dirs: %v", err)
+			}
+			if err := fakesysfs.FakeSysFsGpuContents(testDirs.SysfsRoot, testDirs.DevfsRoot, tt.devices, false); err != nil {
+				t.Fatalf("could not create fake sysfs: %v", err)
+			}
+
+			drv, err := getFakeDriverWithFlags(testDirs, tt.gpuFlags)
+			if err != nil {
+				t.Fatalf("could not create fake driver: %v", err)
+			}
+
+			//nolint:forcetypeassert // We want the code to panic if our assumption turns out to be wrong.
+			allocatable := drv.state.Allocatable.(map[string]*gpudevice.DeviceInfo)
+			if _, found := allocatable[tt.filtered]; found || len(allocatable) != len(tt.devices)-1 {
+				t.Fatalf("expected device %v to be filtered out from discovery, got %v", tt.filtered, allocatable)
+			}
+
+			// xpumd reports all devices, including the filtered out one.
+			updates := []*xpumapi.DeviceHealth{}
+			for _, dev := range tt.devices {
+				updates = append(updates, xpumdHealthReport(dev.PCIAddress, dev.Model, xpumapi.SeverityLevel_SEVERITY_LEVEL_CRITICAL))
+			}
+			report := xpumDevicesToAllocatableDevicesInfo(updates, drv.ignoreHealthWarning, drv.healthSeverities)
+			needToPublish, err := drv.state.applyDeviceUpdates(report)
+			if err != nil {
+				t.Fatalf("unexpected error applying xpumd report: %v", err)
+			}
+			if !needToPublish {
+				t.Errorf("expected health change of allocatable devices to be published")
+			}
+
+			for uid, dev := range allocatable {
+				if dev.Health != gpudevice.HealthUnhealthy {
+					t.Errorf("expected allocatable device %v health to be updated to %v, got %v", uid, gpudevice.HealthUnhealthy, dev.Health)
+				}
+			}
+		})
+	}
+}
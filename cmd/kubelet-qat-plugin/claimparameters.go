@@ -0,0 +1,54 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"fmt"
+
+	resourcev1 "k8s.io/api/resource/v1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
+)
+
+var claimParametersType = helpers.ClaimParametersType{
+	APIVersion: device.DriverName + "/v1alpha1",
+	Kind:       "QATConfig",
+}
+
+// ClaimParameters are QAT-specific opaque device configuration parameters in
+// ResourceClaim or DeviceClass, e.g.
+// {"apiVersion": "qat.intel.com/v1alpha1", "kind": "QATConfig", "services": "sym;asym"}.
+type ClaimParameters struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	// Services requested for the allocated devices, separated with ';'.
+	Services string `json:"services,omitempty"`
+}
+
+// requestedServices returns the services configured for the claim request.
+// DeviceClass configuration comes first in the claim allocation results, so
+// ResourceClaim configuration overrides it. Returns device.Unset when no
+// services are configured.
+func requestedServices(claim *resourcev1.ResourceClaim, request string) (device.Services, error) {
+	var services device.Services = device.Unset
+	parametersList, err := helpers.RequestClaimParameters[ClaimParameters](claim, device.DriverName, claimParametersType, request)
+	if err != nil {
+		return device.Unset, err
+	}
+
+	for _, parameters := range parametersList {
+		if parameters.Services == "" {
+			continue
+		}
+
+		services, err = device.StringToServices(parameters.Services)
+		if err != nil {
+			return device.Unset, fmt.Errorf("invalid services '%s' for request '%s': %v", parameters.Services, request, err)
+		}
+	}
+
+	return services, nil
+}
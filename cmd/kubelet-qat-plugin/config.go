@@ -16,13 +16,37 @@ import (
 
 const defaultConfigFile = "/defaults/qatdefaults.config"
 
-func readConfigFile(hostname string) (map[string]string, error) {
+// pfConfig is the default configuration of a single PF device. In the config
+// file it is either a services string, or an object with services, optional
+// instance counts per VF and optional services to return to when idle.
+type pfConfig struct {
+	Services       string           `json:"services"`
+	Instances      device.Instances `json:"instances"`
+	DefaultService string           `json:"defaultService"`
+}
+
+func (c *pfConfig) UnmarshalJSON(data []byte) error {
+	var services string
+	if err := json.Unmarshal(data, &services); err == nil {
+		c.Services = services
+		return nil
+	}
+
+	type plainConfig pfConfig
+	return json.Unmarshal(data, (*plainConfig)(c))
+}
+
+func readConfigFile(hostname string) (map[string]pfConfig, error) {
 	configBytes, err := os.ReadFile(defaultConfigFile)
 	if err != nil {
 		return nil, err
 	}
 
-	var configFile map[string]map[string]string
+	return parseConfig(configBytes, hostname)
+}
+
+func parseConfig(configBytes []byte, hostname string) (map[string]pfConfig, error) {
+	var configFile map[string]map[string]pfConfig
 	if err := json.Unmarshal(configBytes, &configFile); err != nil {
 		return nil, err
 	}
@@ -42,25 +66,55 @@ func getDefaultConfiguration(hostname string, q device.QATDevices) error {
 		return nil
 	}
 
+	applyDefaultConfiguration(hostname, serviceconfig, q)
+
+	return nil
+}
+
+func applyDefaultConfiguration(hostname string, serviceconfig map[string]pfConfig, q device.QATDevices) {
 	klog.V(5).Infof("Default config for host '%s':", hostname)
 	for _, pf := range q {
-		if servicestr, exists := serviceconfig[pf.Device]; exists {
+		if pfconfig, exists := serviceconfig[pf.Device]; exists {
 			var services device.Services
 			var err error
 
-			if services, err = device.StringToServices(servicestr); err != nil {
+			if pfconfig.DefaultService != "" {
+				defaultService, err := device.StringToServices(pfconfig.DefaultService)
+				if err != nil {
+					klog.Warningf("Error parsing default config default service for PF device '%s': %v", pf.Device, err)
+					continue
+				}
+				if err := pf.SetDefaultService(defaultService); err != nil {
+					klog.Warningf("Error in default config default service '%s' for PF device '%s': %v", pfconfig.DefaultService, pf.Device, err)
+					continue
+				}
+				// PF device without configured services starts with its default services.
+				if pfconfig.Services == "" {
+					pfconfig.Services = pfconfig.DefaultService
+				}
+			}
+
+			if services, err = device.StringToServices(pfconfig.Services); err != nil {
 				klog.Warningf("Error parsing default config services for PF device '%s': %v", pf.Device, err)
 				continue
 			}
 
+			if err := pf.ValidateInstances(pfconfig.Instances, services); err != nil {
+				klog.Errorf("Error in default config instances, leaving PF device '%s' unconfigured: %v", pf.Device, err)
+				continue
+			}
+
 			if err := pf.SetServices([]device.Services{services}); err != nil {
 				klog.Warningf("Error configuring services '%s' for PF device '%s': %v", services.String(), pf.Device, err)
 				continue
 			}
 
-			klog.V(5).Infof("PF device '%s' configured with services %s'", pf.Device, services.String())
+			if err := pf.SetInstances(pfconfig.Instances); err != nil {
+				klog.Errorf("Error configuring instances %+v for PF device '%s': %v", pfconfig.Instances, pf.Device, err)
+				continue
+			}
+
+			klog.V(5).Infof("PF device '%s' configured with services %s', instances %+v", pf.Device, services.String(), pfconfig.Instances)
 		}
 	}
-
-	return nil
 }
@@ -5,25 +5,74 @@
 package main
 
 import (
+	"maps"
+	"slices"
+	"strings"
+
 	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
 	"k8s.io/klog/v2"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
 )
 
-func deviceResources(qatvfdevices device.VFDevices) *[]resourceapi.Device {
+// pfCounter is the counter of the per PF device counter set. Each VF device
+// consumes one of them and the PF device all, so the scheduler cannot allocate
+// a PF device and any of its VFs to different claims.
+const pfCounter = "vfs"
+
+// deviceResources returns the VF devices sorted by name, consuming the shared
+// counter of their PF device when consumeCounters is set.
+func deviceResources(qatvfdevices device.VFDevices, consumeCounters bool) *[]resourceapi.Device {
 	resourcedevices := []resourceapi.Device{}
+	// The VFs of a PF device share its reconfigurable attribute.
+	pfReconfigurable := map[*device.PFDevice]bool{}
 
-	for _, qatvfdevice := range qatvfdevices {
+	for _, uid := range slices.Sorted(maps.Keys(qatvfdevices)) {
+		qatvfdevice := qatvfdevices[uid]
 		services := qatvfdevice.Services()
+		isPF := false
+		healthy := qatvfdevice.Healthy()
+		reconfigurable, found := pfReconfigurable[qatvfdevice.PFDevice()]
+		if !found {
+			reconfigurable = qatvfdevice.PFDevice().Reconfigurable()
+			pfReconfigurable[qatvfdevice.PFDevice()] = reconfigurable
+		}
+		bound := qatvfdevice.Bound()
+		pciAddress := qatvfdevice.PCIDevice()
+		iommu := string(device.GetIOMMUMode())
 		device := resourceapi.Device{
 			Name: qatvfdevice.UID(),
 			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
 				"services": {
 					StringValue: &services,
 				},
+				"isPF": {
+					BoolValue: &isPF,
+				},
+				"deviceHealthy": {
+					BoolValue: &healthy,
+				},
+				"reconfigurable": {
+					BoolValue: &reconfigurable,
+				},
+				"bound": {
+					BoolValue: &bound,
+				},
+				"pciAddress": {
+					StringValue: &pciAddress,
+				},
+				"iommu": {
+					StringValue: &iommu,
+				},
 			},
 		}
+		addModelAttributes(device.Attributes, qatvfdevice.PFDevice())
+		addUnknownServicesAttribute(device.Attributes, qatvfdevice.PFDevice())
+		if consumeCounters {
+			device.ConsumesCounters = pfCounterConsumption(qatvfdevice.PFDevice(), 1)
+		}
 		resourcedevices = append(resourcedevices, device)
 
 		klog.V(5).Infof("Adding Device resource: name '%s', service '%s'", device.Name, *device.Attributes["services"].StringValue)
@@ -31,3 +80,130 @@ func deviceResources(qatvfdevices device.VFDevices) *[]resourceapi.Device {
 
 	return &resourcedevices
 }
+
+// pfDeviceResources returns devices representing whole PF devices, allocating
+// such a device allocates all VFs of the PF. The devices consume the whole
+// shared counter of the PF device.
+func pfDeviceResources(pfdevices device.QATDevices) []resourceapi.Device {
+	resourcedevices := []resourceapi.Device{}
+
+	for _, pf := range pfdevices {
+		services := pf.Services.String()
+		isPF := true
+		vfCount := int64(pf.VFCount())
+		if vfCount == 0 {
+			continue
+		}
+		healthy := !pf.Unhealthy
+		reconfigurable := pf.Reconfigurable()
+		pciAddress := pf.Device
+		iommu := string(device.GetIOMMUMode())
+
+		device := resourceapi.Device{
+			Name: pf.UID(),
+			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				"services": {
+					StringValue: &services,
+				},
+				"isPF": {
+					BoolValue: &isPF,
+				},
+				"vfCount": {
+					IntValue: &vfCount,
+				},
+				"deviceHealthy": {
+					BoolValue: &healthy,
+				},
+				"reconfigurable": {
+					BoolValue: &reconfigurable,
+				},
+				"pciAddress": {
+					StringValue: &pciAddress,
+				},
+				"iommu": {
+					StringValue: &iommu,
+				},
+			},
+		}
+		addModelAttributes(device.Attributes, pf)
+		addUnknownServicesAttribute(device.Attributes, pf)
+		device.ConsumesCounters = pfCounterConsumption(pf, vfCount)
+		resourcedevices = append(resourcedevices, device)
+
+		klog.V(5).Infof("Adding PF Device resource: name '%s', VFs %d", device.Name, vfCount)
+	}
+
+	return resourcedevices
+}
+
+// pfCounterSets returns a counter set for each PF device with VFs, named after
+// the PF device, with as many counters as the PF device has VFs.
+func pfCounterSets(pfdevices device.QATDevices) []resourceapi.CounterSet {
+	counterSets := []resourceapi.CounterSet{}
+	for _, pf := range pfdevices {
+		vfCount := int64(pf.VFCount())
+		if vfCount == 0 {
+			continue
+		}
+
+		counterSets = append(counterSets, resourceapi.CounterSet{
+			Name: pf.UID(),
+			Counters: map[string]resourceapi.Counter{
+				pfCounter: {Value: *resource.NewQuantity(vfCount, resource.DecimalSI)},
+			},
+		})
+	}
+
+	return counterSets
+}
+
+// pfCounterConsumption returns the consumption of count counters from the
+// counter set of the PF device.
+func pfCounterConsumption(pf *device.PFDevice, count int64) []resourceapi.DeviceCounterConsumption {
+	return []resourceapi.DeviceCounterConsumption{{
+		CounterSet: pf.UID(),
+		Counters: map[string]resourceapi.Counter{
+			pfCounter: {Value: *resource.NewQuantity(count, resource.DecimalSI)},
+		},
+	}}
+}
+
+// counterSlices splits the devices and the counter sets they consume into
+// slices within the API limits. A slice cannot have both, so the counter sets
+// follow the device slices, of which there is at least one.
+func counterSlices(devices []resourceapi.Device, counterSets []resourceapi.CounterSet) []resourceslice.Slice {
+	resourceSlices := []resourceslice.Slice{}
+	for chunk := range slices.Chunk(devices, resourceapi.ResourceSliceMaxDevicesWithTaintsOrConsumesCounters) {
+		resourceSlices = append(resourceSlices, resourceslice.Slice{Devices: chunk})
+	}
+	if len(resourceSlices) == 0 {
+		resourceSlices = append(resourceSlices, resourceslice.Slice{Devices: devices})
+	}
+	for chunk := range slices.Chunk(counterSets, resourceapi.ResourceSliceMaxCounterSets) {
+		resourceSlices = append(resourceSlices, resourceslice.Slice{SharedCounters: chunk})
+	}
+
+	return resourceSlices
+}
+
+// addModelAttributes adds the PCI device ID of the PF device as the model
+// attribute and its generation, when known, as the generation attribute.
+func addModelAttributes(attributes map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, pf *device.PFDevice) {
+	if model := pf.DeviceID; model != "" {
+		attributes["model"] = resourceapi.DeviceAttribute{StringValue: &model}
+	}
+	if generation := pf.GenerationName(); generation != "" {
+		attributes["generation"] = resourceapi.DeviceAttribute{StringValue: &generation}
+	}
+}
+
+// addUnknownServicesAttribute adds the services of the PF device the driver
+// does not know, e.g. added by newer firmware, as the unknownServices attribute.
+func addUnknownServicesAttribute(attributes map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, pf *device.PFDevice) {
+	if len(pf.UnknownServices) == 0 {
+		return
+	}
+
+	unknownServices := strings.Join(pf.UnknownServices, ";")
+	attributes["unknownServices"] = resourceapi.DeviceAttribute{StringValue: &unknownServices}
+}
@@ -6,16 +6,17 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"path"
 	"sync"
+	"time"
 
 	resourceapi "k8s.io/api/resource/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/runtime"
 	coreclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
 	"k8s.io/klog/v2"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
@@ -28,6 +29,34 @@ type driver struct {
 	client coreclientset.Interface
 	state  nodeState
 	helper *kubeletplugin.Helper
+	// Records every claim preparation and unpreparation, nil when disabled.
+	auditLog *helpers.AuditLog
+	// Notifies an external system of every claim preparation and unpreparation, nil when disabled.
+	allocationHook *helpers.AllocationHook
+	// Claims with more devices are rejected, 0 means no limit.
+	maxDevicesPerClaim int
+	// Publish attribute names prefixed with the driver name.
+	qualifiedAttributeNames bool
+	// Republishes resources after recoverable kubelet plugin errors.
+	errorHandler *helpers.ErrorHandler
+	// Devices reserved with a Node annotation, nil in oneshot mode.
+	reservations *helpers.Reservations
+	// Withholds devices whose device nodes do not exist yet, nil when disabled and in oneshot mode.
+	readiness *helpers.DeviceReadiness
+	// Republishes resources that changed since last published, nil when disabled and in oneshot mode.
+	republisher *helpers.Republisher
+	// Disable VFs enabled by the driver on shutdown, also with prepared claims when forced.
+	disableVFsOnShutdown bool
+	forceDisableVFs      bool
+	// Keeps track of PF devices with VFs enabled by the driver over restarts.
+	vfsEnabledFilePath string
+	// PF devices health is polled.
+	healthMonitoring bool
+	// Sends reconfiguration Events in the background, nil when disabled.
+	eventBroadcaster record.EventBroadcaster
+	eventRecorder    record.EventRecorder
+	// Stops the goroutines watching devices, nil in oneshot mode.
+	stopWatching context.CancelFunc
 }
 
 func (d *driver) PrepareResourceClaims(ctx context.Context, claims []*resourceapi.ResourceClaim) (map[types.UID]kubeletplugin.PrepareResult, error) {
@@ -35,28 +64,88 @@ func (d *driver) PrepareResourceClaims(ctx context.Context, claims []*resourceap
 
 	response := map[types.UID]kubeletplugin.PrepareResult{}
 
+	// Rejected claims must not reconfigure PF devices for the batch.
+	validClaims := []*resourceapi.ResourceClaim{}
 	for _, claim := range claims {
+		start := time.Now()
+		if err := d.checkClaim(claim); err != nil {
+			response[claim.UID] = kubeletplugin.PrepareResult{
+				Err: fmt.Errorf("error preparing devices for claim %v: %v", claim.UID, err),
+			}
+			helpers.ObserveClaimOperation(helpers.ClaimOperationPrepare, start, err)
+			continue
+		}
+		validClaims = append(validClaims, claim)
+	}
+
+	restoreServices, updateFound := d.state.reconfigureForBatch(validClaims)
+
+	for _, claim := range validClaims {
 		klog.V(5).Infof("NodePrepareResources: claim %s", claim.UID)
-		response[claim.UID] = d.prepareResourceClaim(ctx, claim)
+		start := time.Now()
+		var updated bool
+		response[claim.UID], updated = d.prepareResourceClaim(ctx, claim)
+		updateFound = updateFound || updated
+		helpers.ObserveClaimOperation(helpers.ClaimOperationPrepare, start, response[claim.UID].Err)
+	}
+
+	restoreServices()
+
+	if updateFound {
+		if err := d.PublishResourceSlice(ctx); err != nil {
+			klog.Errorf("could not publish updated resource slice: %v", err)
+		}
 	}
 
 	return response, nil
 }
 
-func (d *driver) prepareResourceClaim(ctx context.Context, claim *resourceapi.ResourceClaim) kubeletplugin.PrepareResult {
+// checkClaim returns an error if the claim is not prepared yet and must be
+// rejected before any device is allocated for it.
+func (d *driver) checkClaim(claim *resourceapi.ResourceClaim) error {
+	d.state.Lock()
+	_, found := d.state.Prepared[string(claim.UID)]
+	d.state.Unlock()
+	if found {
+		return nil
+	}
+
+	if err := helpers.CheckClaimDeviceCount(claim, device.DriverName, d.maxDevicesPerClaim); err != nil {
+		return err
+	}
+
+	return d.reservations.CheckClaim(claim)
+}
+
+// prepareResourceClaim prepares the claim checked with checkClaim, and returns
+// true if preparing it changed the published resources, e.g. PF device
+// configuration.
+func (d *driver) prepareResourceClaim(ctx context.Context, claim *resourceapi.ResourceClaim) (kubeletplugin.PrepareResult, bool) {
 	klog.V(5).Infof("prepareResourceClaim is called for claim %v", claim.UID)
-	if claimPreparation, found := d.state.Prepared[string(claim.UID)]; found {
+	d.state.Lock()
+	claimPreparation, found := d.state.Prepared[string(claim.UID)]
+	d.state.Unlock()
+	if found {
 		klog.V(3).Infof("Claim %v was already prepared, nothing to do", claim.UID)
-		return claimPreparation
+		return claimPreparation, false
 	}
 
-	if err := d.state.Prepare(ctx, claim); err != nil {
+	updated, err := d.state.Prepare(ctx, claim)
+	if err != nil {
 		return kubeletplugin.PrepareResult{
 			Err: fmt.Errorf("error preparing devices for claim %v: %v", claim.UID, err),
-		}
+		}, updated
 	}
 
-	return d.state.Prepared[string(claim.UID)]
+	d.state.Lock()
+	prepareResult := d.state.Prepared[string(claim.UID)]
+	services := d.state.claimServices(prepareResult)
+	d.state.Unlock()
+
+	d.auditLog.RecordPrepareResult(helpers.AuditActionPrepare, string(claim.UID), claim.Namespace, prepareResult, services)
+	d.allocationHook.NotifyPrepareResult(ctx, helpers.AuditActionPrepare, string(claim.UID), claim.Namespace, prepareResult)
+
+	return prepareResult, updated
 }
 
 func (d *driver) UnprepareResourceClaims(ctx context.Context, claims []kubeletplugin.NamespacedObject) (map[types.UID]error, error) {
@@ -67,12 +156,24 @@ func (d *driver) UnprepareResourceClaims(ctx context.Context, claims []kubeletpl
 	for _, claim := range claims {
 		var updated bool
 		var err error
-		if updated, err = d.state.Unprepare(ctx, claim); err != nil {
+		start := time.Now()
+		d.state.Lock()
+		prepareResult, prepared := d.state.Prepared[string(claim.UID)]
+		services := d.state.claimServices(prepareResult)
+		updated, err = d.state.Unprepare(ctx, claim)
+		d.state.Unlock()
+		helpers.ObserveClaimOperation(helpers.ClaimOperationUnprepare, start, err)
+		if err != nil {
 			response[claim.UID] = fmt.Errorf("error freeing devices: %v", err)
 			continue
 		}
 		updateFound = updateFound || updated
 
+		if prepared {
+			d.auditLog.RecordPrepareResult(helpers.AuditActionUnprepare, string(claim.UID), claim.Namespace, prepareResult, services)
+			d.allocationHook.NotifyPrepareResult(ctx, helpers.AuditActionUnprepare, string(claim.UID), claim.Namespace, prepareResult)
+		}
+
 		response[claim.UID] = nil
 		klog.V(3).Infof("Freed devices for claim '%v'", claim.UID)
 	}
@@ -86,62 +187,178 @@ func (d *driver) UnprepareResourceClaims(ctx context.Context, claims []kubeletpl
 	return response, nil
 }
 
+// GetResources returns the resources published in ResourceSlice.
+func (d *driver) GetResources() resourceslice.DriverResources {
+	// Whole PF devices are reserved with their VFs.
+	d.reservations.SetParents(d.state.deviceParents())
+	resources := d.readiness.Apply(d.reservations.Apply(d.state.GetResources()))
+	if d.qualifiedAttributeNames {
+		return helpers.QualifyAttributeNames(resources, device.DriverName)
+	}
+
+	return resources
+}
+
+// Topology returns the device topology served on the metrics port.
+func (d *driver) Topology() helpers.Topology {
+	return d.state.Topology()
+}
+
+// Snapshot returns the node state served on the metrics port.
+func (d *driver) Snapshot() helpers.NodeStateSnapshot {
+	return d.state.Snapshot()
+}
+
+// Capabilities returns the driver capabilities served on the metrics port.
+func (d *driver) Capabilities() helpers.Capabilities {
+	d.state.Lock()
+	defer d.state.Unlock()
+
+	reconfiguration, reconfigurationEvents, forceReconfiguration := false, false, false
+	for _, pf := range d.state.pfDevices {
+		reconfiguration = reconfiguration || pf.AllowReconfiguration
+		reconfigurationEvents = reconfigurationEvents || pf.ReconfigurationHandler != nil
+		forceReconfiguration = forceReconfiguration || pf.ForceReconfiguration
+	}
+
+	return helpers.NewCapabilities(device.DriverName, map[string]bool{
+		helpers.FeatureAuditLog:                d.auditLog != nil,
+		helpers.FeatureAllocationHook:          d.allocationHook != nil,
+		helpers.FeatureQualifiedAttributeNames: d.qualifiedAttributeNames,
+		helpers.FeatureHealthMonitoring:        d.healthMonitoring,
+		"serviceReconfiguration":               reconfiguration,
+		"reconfigurationEvents":                reconfigurationEvents,
+		"forceReconfiguration":                 forceReconfiguration,
+		"wholePFAllocation":                    d.state.wholePFAllocation,
+		"disableVFsOnShutdown":                 d.disableVFsOnShutdown,
+	})
+}
+
+// startupSummary returns the summary of the driver state after startup.
+func (d *driver) startupSummary() helpers.StartupSummary {
+	// Capabilities locks the state itself, so get it before locking.
+	summary := helpers.StartupSummary{
+		NodeName:     d.state.NodeName,
+		Capabilities: d.Capabilities(),
+	}
+
+	d.state.Lock()
+	defer d.state.Unlock()
+
+	allocatableDevices, _ := d.state.Allocatable.(device.VFDevices)
+	for _, vf := range allocatableDevices {
+		summary.Devices = append(summary.Devices, helpers.SummaryDevice{Type: "vf", Model: vf.PFDevice().DeviceID, Health: helpers.SummaryHealth(vf.Healthy())})
+	}
+	summary.CDIDevices = helpers.CountCDIDevices(d.state.CdiCache, device.CDIKind)
+	summary.PreparedClaims = len(d.state.Prepared)
+	summary.Details = []any{"pfDevices", len(d.state.pfDevices), "vfDevices", len(allocatableDevices)}
+
+	return summary
+}
+
 func (d *driver) PublishResourceSlice(ctx context.Context) error {
-	resources := d.state.GetResources()
+	resources := d.GetResources()
 	klog.FromContext(ctx).Info("Publishing resources", "len", len(resources.Pools[d.state.NodeName].Slices[0].Devices))
 	if err := d.helper.PublishResources(ctx, resources); err != nil {
-		return fmt.Errorf("error publishing resources: %v", err)
+		return fmt.Errorf("error publishing resources: %w", err)
 	}
+	d.republisher.Published(resources)
 	return nil
 }
 
+func getQATFlags(someFlags any) (*QATFlags, error) {
+	switch v := someFlags.(type) {
+	case *QATFlags:
+		return v, nil
+	default:
+		return &QATFlags{}, fmt.Errorf("could not parse driver flags as QATFlags (got type: %T)", v)
+	}
+}
+
 func newDriver(ctx context.Context, config *helpers.Config) (helpers.Driver, error) {
 	driverVersion.PrintDriverVersion(device.DriverName)
+
+	qatFlags, err := getQATFlags(config.DriverFlags)
+	if err != nil {
+		return nil, fmt.Errorf("get QAT flags: %w", err)
+	}
+
+	deviceNodePermissions, err := qatFlags.DeviceNode.Permissions()
+	if err != nil {
+		return nil, err
+	}
+
 	preparedClaimsFilePath := path.Join(config.CommonFlags.KubeletPluginDir, device.PreparedClaimsFileName)
+	vfsEnabledFilePath := path.Join(config.CommonFlags.KubeletPluginDir, device.VFsEnabledByDriverFileName)
 
-	pfdevices, err := device.New()
+	pfdevices, err := device.New(ctx, config.CommonFlags.DiscoveryTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("could not find PF devices: %v", err)
 	}
 
 	for _, pf := range pfdevices {
-		if err := pf.EnableVFs(); err != nil {
-			return nil, fmt.Errorf("cannot enable PF device '%s': %v", pf.Device, err)
-		}
+		pf.SetStrictVFCount(qatFlags.StrictVFCount)
+		pf.SetUpRetry(qatFlags.PFUpRetries, qatFlags.PFUpRetryInterval)
+		pf.SetReconfigurationCooldown(qatFlags.ReconfigurationCooldown)
+		pf.SetForceReconfiguration(qatFlags.ForceReconfiguration)
 	}
-	if err := getDefaultConfiguration(config.CommonFlags.NodeName, pfdevices); err != nil {
-		klog.Warningf("Cannot apply default configuration: %vn", err)
+	// Oneshot mode reports the devices as they are and leaves the host alone.
+	if !config.CommonFlags.Oneshot {
+		if err := enableVFs(vfsEnabledFilePath, config.CommonFlags.NodeName, pfdevices); err != nil {
+			return nil, err
+		}
 	}
 
 	detectedVFDevices := device.GetCDIDevices(pfdevices)
 
-	state, err := newNodeState(detectedVFDevices, config.CommonFlags.CdiRoot, preparedClaimsFilePath, config.CommonFlags.NodeName)
+	state, err := newNodeState(pfdevices, detectedVFDevices, config.CommonFlags.CdiRoot, preparedClaimsFilePath, config.CommonFlags.NodeName, config.CommonFlags.CDISyncTimeout, deviceNodePermissions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new NodeState: %v", err)
 	}
+	state.wholePFAllocation = qatFlags.WholePFAllocation
 
 	driver := &driver{
-		state:  *state,
-		client: config.Coreclient,
-	}
-
-	klog.Infof(`Starting DRA resource-driver kubelet-plugin
-RegistrarDirectoryPath: %v
-PluginDataDirectoryPath: %v`,
-		config.CommonFlags.KubeletPluginsRegistryDir,
-		config.CommonFlags.KubeletPluginDir)
-
-	helper, err := kubeletplugin.Start(
-		ctx,
-		driver,
-		kubeletplugin.KubeClient(config.Coreclient),
-		kubeletplugin.NodeName(config.CommonFlags.NodeName),
-		kubeletplugin.DriverName(device.DriverName),
-		kubeletplugin.RegistrarDirectoryPath(config.CommonFlags.KubeletPluginsRegistryDir),
-		kubeletplugin.PluginDataDirectoryPath(config.CommonFlags.KubeletPluginDir),
-	)
+		state:                   *state,
+		client:                  config.Coreclient,
+		auditLog:                helpers.NewAuditLog(config.CommonFlags.AuditLogPath, config.CommonFlags.AuditLogMaxSizeMiB),
+		allocationHook:          helpers.NewAllocationHook(config.CommonFlags.AllocationHook, device.DriverName, config.CommonFlags.AllocationHookTimeout),
+		maxDevicesPerClaim:      config.CommonFlags.MaxDevicesPerClaim,
+		qualifiedAttributeNames: config.CommonFlags.QualifiedAttributeNames,
+		disableVFsOnShutdown:    !config.CommonFlags.Oneshot && (qatFlags.DisableVFsOnShutdown || qatFlags.ForceDisableVFsOnShutdown),
+		forceDisableVFs:         qatFlags.ForceDisableVFsOnShutdown,
+		vfsEnabledFilePath:      vfsEnabledFilePath,
+	}
+
+	driver.errorHandler = helpers.NewErrorHandler(driver.PublishResourceSlice, config.ShutdownOnFatalError())
+
+	if qatFlags.ReconfigurationEvents {
+		driver.enableReconfigurationEvents()
+	}
+
+	// Nothing is started in oneshot mode, resources are only printed.
+	if config.CommonFlags.Oneshot {
+		return driver, nil
+	}
+
+	helpers.RegisterPreparedClaimsMetrics(metricsNamespace, driver.state.PreparedClaimTimes)
+	helpers.RegisterClaimOperationMetrics(metricsNamespace)
+	helpers.RegisterInventoryMetrics(metricsNamespace)
+	registerMetrics(driver.state.availableCapacity)
+
+	startupRetry := helpers.NewAPIStartupRetry(config.CommonFlags.APIStartupTimeout)
+	driver.reservations = helpers.NewReservations(device.DriverName)
+	if err := startupRetry.Do(ctx, "load device reservations", func(ctx context.Context) error {
+		return driver.reservations.Load(ctx, config.Coreclient, config.CommonFlags.NodeName)
+	}); err != nil {
+		return nil, fmt.Errorf("could not load device reservations: %v", err)
+	}
+	driver.reservations.SetParents(driver.state.deviceParents())
+	driver.readiness = helpers.NewDeviceReadiness(driver.state.CdiCache, device.CDIKind, config.CommonFlags.DeviceReadinessInterval)
+	driver.republisher = helpers.NewRepublisher(config.CommonFlags.RepublishInterval)
+
+	helper, err := helpers.StartKubeletPlugin(ctx, driver, device.DriverName, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start kubelet-plugin: %v", err)
+		return nil, err
 	}
 
 	driver.helper = helper
@@ -150,16 +367,79 @@ PluginDataDirectoryPath: %v`,
 		return nil, fmt.Errorf("could not publish ResourceSlice: %v", err)
 	}
 
+	driver.healthMonitoring = qatFlags.HealthMonitoring
+
+	// The goroutines below run until the driver is shut down.
+	ctx, driver.stopWatching = context.WithCancel(ctx)
+	go driver.watchDevices(ctx, deviceCheckInterval)
+
+	go driver.reservations.Watch(ctx, config.Coreclient, config.CommonFlags.NodeName, func() {
+		if err := driver.PublishResourceSlice(ctx); err != nil {
+			klog.Errorf("Could not publish device reservations: %v", err)
+		}
+	})
+
+	go driver.readiness.Watch(ctx, func() {
+		if err := driver.PublishResourceSlice(ctx); err != nil {
+			klog.Errorf("Could not publish devices that became ready: %v", err)
+		}
+	})
+
+	go driver.republisher.Run(ctx, driver.GetResources, driver.PublishResourceSlice)
+
+	go helpers.RunReconciler(ctx, config.CommonFlags.ReconcileInterval, driver.state.reconcileCDI)
+
+	helpers.LogStartupSummary(driver.startupSummary())
+
 	klog.V(3).Info("Finished creating new driver")
 	return driver, nil
 }
 
+// preflightPFDevices returns the PF devices whose VFs and services the driver
+// has the privileges to change. The other PF devices are marked read-only, so
+// they are not reconfigured, and VFs already enabled on them are used as they
+// are.
+func preflightPFDevices(pfdevices device.QATDevices) device.QATDevices {
+	checks := []helpers.PreflightCheck{}
+	for _, pf := range pfdevices {
+		checks = append(checks, helpers.PreflightCheck{
+			Feature: fmt.Sprintf("VF enabling and services configuration of PF device '%s'", pf.Device),
+			Paths:   pf.WrittenPaths(),
+			Hint:    "Run the driver container privileged with /sys mounted writable.",
+		})
+	}
+	failed := helpers.Preflight(checks)
+
+	writable := device.QATDevices{}
+	for i, pf := range pfdevices {
+		if _, found := failed[checks[i].Feature]; found {
+			pf.SetReadOnly(true)
+			continue
+		}
+		writable = append(writable, pf)
+	}
+
+	return writable
+}
+
 func (d *driver) Shutdown(ctx context.Context) error {
 	klog.V(5).Info("Shutting down driver")
 
-	d.helper.Stop()
+	if d.stopWatching != nil {
+		d.stopWatching()
+	}
 
-	return nil
+	return helpers.Drain(ctx, func() {
+		d.helper.Stop()
+
+		if d.disableVFsOnShutdown {
+			d.disableVFs()
+		}
+
+		if d.eventBroadcaster != nil {
+			d.eventBroadcaster.Shutdown()
+		}
+	})
 }
 
 // HandleError is called by Kubelet when an error occures asyncronously, and
@@ -171,12 +451,5 @@ func (d *driver) Shutdown(ctx context.Context) error {
 // - dropped fields (see [resourceslice.DroppedFieldsError])
 // - validation errors (see [apierrors.IsInvalid]).
 func (d *driver) HandleError(ctx context.Context, err error, message string) {
-	if errors.Is(err, kubeletplugin.ErrRecoverable) {
-		// TODO: FIXME: error is ignored ATM, handle it properly.
-		klog.FromContext(ctx).Error(err, "DRAPlugin encountered an error.")
-	} else {
-		klog.FromContext(ctx).Error(err, "Unrecoverable error.")
-	}
-
-	runtime.HandleErrorWithContext(ctx, err, message)
+	d.errorHandler.HandleError(ctx, err, message)
 }
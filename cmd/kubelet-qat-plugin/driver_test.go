@@ -5,19 +5,27 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	resourcev1 "k8s.io/api/resource/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
@@ -32,15 +40,20 @@ const (
 )
 
 func getFakeDriver(testDirs testhelpers.TestDirsType) (*driver, error) {
+	return getFakeDriverWithFlags(testDirs, &QATFlags{})
+}
+
+func getFakeDriverWithFlags(testDirs testhelpers.TestDirsType, qatFlags *QATFlags) (*driver, error) {
 	config := &helpers.Config{
 		CommonFlags: &helpers.Flags{
 			NodeName:                  testNodeName,
 			CdiRoot:                   testDirs.CdiRoot,
 			KubeletPluginDir:          testDirs.KubeletPluginDir,
 			KubeletPluginsRegistryDir: testDirs.KubeletPluginRegistryDir,
+			CDISyncTimeout:            helpers.DefaultCDISyncTimeout,
 		},
 		Coreclient:  kubefake.NewClientset(),
-		DriverFlags: nil,
+		DriverFlags: qatFlags,
 	}
 
 	if err := os.MkdirAll(config.CommonFlags.KubeletPluginDir, 0755); err != nil {
@@ -51,6 +64,7 @@ func getFakeDriver(testDirs testhelpers.TestDirsType) (*driver, error) {
 	}
 
 	os.Setenv("SYSFS_ROOT", testDirs.SysfsRoot)
+	device.ClearSysfsRoot()
 
 	// kubelet-plugin will access node object, it needs to exist.
 	newNode := &core.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName}}
@@ -70,6 +84,50 @@ func getFakeDriver(testDirs testhelpers.TestDirsType) (*driver, error) {
 	return driver, err
 }
 
+func newClaimWithServices(claimUID string, deviceUID string, services string) *resourcev1.ResourceClaim {
+	claim := testhelpers.NewClaim(testNameSpace, "claim1", claimUID, "request1", "qat.intel.com", testNodeName, []string{deviceUID}, false)
+	claim.Status.Allocation.Devices.Config = []resourcev1.DeviceAllocationConfiguration{
+		{
+			Source: resourcev1.AllocationConfigSourceClaim,
+			DeviceConfiguration: resourcev1.DeviceConfiguration{
+				Opaque: &resourcev1.OpaqueDeviceConfiguration{
+					Driver:     device.DriverName,
+					Parameters: runtime.RawExtension{Raw: []byte(`{"apiVersion":"qat.intel.com/v1alpha1","kind":"QATConfig","services":"` + services + `"}`)},
+				},
+			},
+		},
+	}
+
+	return claim
+}
+
+// newMultiServiceClaim returns a claim with a request per device, requesting
+// the services given for the device, none when empty.
+func newMultiServiceClaim(claimUID string, deviceUIDs []string, services []string) *resourcev1.ResourceClaim {
+	claim := testhelpers.NewClaim(testNameSpace, "claim-"+claimUID, claimUID, "request0", device.DriverName, testNodeName, nil, false)
+	for idx, deviceUID := range deviceUIDs {
+		request := fmt.Sprintf("request%d", idx)
+		claim.Status.Allocation.Devices.Results = append(claim.Status.Allocation.Devices.Results, resourcev1.DeviceRequestAllocationResult{
+			Device: deviceUID, Request: request, Driver: device.DriverName, Pool: testNodeName,
+		})
+		if services[idx] == "" {
+			continue
+		}
+		claim.Status.Allocation.Devices.Config = append(claim.Status.Allocation.Devices.Config, resourcev1.DeviceAllocationConfiguration{
+			Source:   resourcev1.AllocationConfigSourceClaim,
+			Requests: []string{request},
+			DeviceConfiguration: resourcev1.DeviceConfiguration{
+				Opaque: &resourcev1.OpaqueDeviceConfiguration{
+					Driver:     device.DriverName,
+					Parameters: runtime.RawExtension{Raw: []byte(`{"apiVersion":"qat.intel.com/v1alpha1","kind":"QATConfig","services":"` + services[idx] + `"}`)},
+				},
+			},
+		})
+	}
+
+	return claim
+}
+
 //nolint:cyclop // test code
 func TestPrepareUnprepareResourceClaims(t *testing.T) {
 	type testCase struct {
@@ -108,6 +166,61 @@ func TestPrepareUnprepareResourceClaims(t *testing.T) {
 			expectedUnprepareErrors:        map[types.UID]bool{},
 			expectedPreparedAfterUnprepare: helpers.ClaimPreparations{},
 		},
+		{
+			name: "whole PF success then unprepare",
+			request: []*resourcev1.ResourceClaim{
+				testhelpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", "qat.intel.com", testNodeName, []string{"qatpf-0000-aa-00-0"}, false),
+			},
+			expectedResponse: map[types.UID]kubeletplugin.PrepareResult{
+				"uid1": {
+					Devices: []kubeletplugin.Device{
+						{Requests: []string{"request1"}, PoolName: testNodeName, DeviceName: "qatpf-0000-aa-00-0", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-1", "intel.com/qat=qatvf-0000-aa-00-2", "intel.com/qat=qatvf-0000-aa-00-3", "intel.com/qat=qatvf-vfio"}},
+					},
+				},
+			},
+			preparedClaims: nil,
+			expectedPreparedClaims: helpers.ClaimPreparations{
+				"uid1": {
+					Devices: []kubeletplugin.Device{
+						{Requests: []string{"request1"}, PoolName: testNodeName, DeviceName: "qatpf-0000-aa-00-0", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-1", "intel.com/qat=qatvf-0000-aa-00-2", "intel.com/qat=qatvf-0000-aa-00-3", "intel.com/qat=qatvf-vfio"}},
+					},
+				},
+			},
+			unprepare:                      []kubeletplugin.NamespacedObject{{UID: "uid1"}},
+			expectedUnprepareErrors:        map[types.UID]bool{},
+			expectedPreparedAfterUnprepare: helpers.ClaimPreparations{},
+		},
+		{
+			name: "whole PF fails when one of its VFs is already taken",
+			request: []*resourcev1.ResourceClaim{
+				testhelpers.NewClaim(testNameSpace, "claim4", "uid4", "request4", "qat.intel.com", testNodeName, []string{"qatvf-0000-aa-00-1"}, false),
+				testhelpers.NewClaim(testNameSpace, "claim5", "uid5", "request5", "qat.intel.com", testNodeName, []string{"qatpf-0000-aa-00-0"}, false),
+			},
+			expectedResponse: map[types.UID]kubeletplugin.PrepareResult{
+				"uid4": {
+					Devices: []kubeletplugin.Device{
+						{Requests: []string{"request4"}, PoolName: testNodeName, DeviceName: "qatvf-0000-aa-00-1", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-1", "intel.com/qat=qatvf-vfio"}},
+					},
+				},
+				"uid5": {Err: fmt.Errorf("error preparing devices for claim uid5: could not allocate device 'qatpf-0000-aa-00-0' for claim 'uid5': PF dev '0000:aa:00.0' has VF devices allocated by 'uid4'")},
+			},
+			expectedPreparedClaims: helpers.ClaimPreparations{
+				"uid4": {
+					Devices: []kubeletplugin.Device{
+						{Requests: []string{"request4"}, PoolName: testNodeName, DeviceName: "qatvf-0000-aa-00-1", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-1", "intel.com/qat=qatvf-vfio"}},
+					},
+				},
+			},
+			unprepare:               []kubeletplugin.NamespacedObject{{UID: "uid1"}},
+			expectedUnprepareErrors: map[types.UID]bool{},
+			expectedPreparedAfterUnprepare: helpers.ClaimPreparations{
+				"uid4": {
+					Devices: []kubeletplugin.Device{
+						{Requests: []string{"request4"}, PoolName: testNodeName, DeviceName: "qatvf-0000-aa-00-1", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-1", "intel.com/qat=qatvf-vfio"}},
+					},
+				},
+			},
+		},
 		{
 			name: "single QAT already prepared (file) then unprepare unknown",
 			request: []*resourcev1.ResourceClaim{
@@ -148,6 +261,53 @@ func TestPrepareUnprepareResourceClaims(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "VF with services from claim parameters",
+			request: []*resourcev1.ResourceClaim{
+				newClaimWithServices("uid1", "qatvf-0000-aa-00-1", "sym"),
+			},
+			expectedResponse: map[types.UID]kubeletplugin.PrepareResult{
+				"uid1": {
+					Devices: []kubeletplugin.Device{
+						{Requests: []string{"request1"}, PoolName: testNodeName, DeviceName: "qatvf-0000-aa-00-1", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-1", "intel.com/qat=qatvf-vfio"}},
+					},
+				},
+			},
+			expectedPreparedClaims: helpers.ClaimPreparations{
+				"uid1": {
+					Devices: []kubeletplugin.Device{
+						{Requests: []string{"request1"}, PoolName: testNodeName, DeviceName: "qatvf-0000-aa-00-1", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-1", "intel.com/qat=qatvf-vfio"}},
+					},
+				},
+			},
+			unprepare:                      []kubeletplugin.NamespacedObject{{UID: "uid1"}},
+			expectedUnprepareErrors:        map[types.UID]bool{},
+			expectedPreparedAfterUnprepare: helpers.ClaimPreparations{},
+		},
+		{
+			name: "VF without services from claim parameters fails",
+			request: []*resourcev1.ResourceClaim{
+				newClaimWithServices("uid1", "qatvf-0000-bb-00-1", "sym"),
+			},
+			expectedResponse: map[types.UID]kubeletplugin.PrepareResult{
+				"uid1": {Err: fmt.Errorf("error preparing devices for claim uid1: could not allocate device 'qatvf-0000-bb-00-1' for claim 'uid1': could not allocate device 'qatvf-0000-bb-00-1', service 'sym' from any device")},
+			},
+			unprepare:                      []kubeletplugin.NamespacedObject{{UID: "uid1"}},
+			expectedUnprepareErrors:        map[types.UID]bool{},
+			expectedPreparedAfterUnprepare: helpers.ClaimPreparations{},
+		},
+		{
+			name: "invalid services in claim parameters",
+			request: []*resourcev1.ResourceClaim{
+				newClaimWithServices("uid1", "qatvf-0000-aa-00-1", "foo"),
+			},
+			expectedResponse: map[types.UID]kubeletplugin.PrepareResult{
+				"uid1": {Err: fmt.Errorf("error preparing devices for claim uid1: invalid services 'foo' for request 'request1': unknown service 'foo'")},
+			},
+			unprepare:                      []kubeletplugin.NamespacedObject{{UID: "uid1"}},
+			expectedUnprepareErrors:        map[types.UID]bool{},
+			expectedPreparedAfterUnprepare: helpers.ClaimPreparations{},
+		},
 		{
 			name: "single unavailable device (no prepare, unprepare noop)",
 			request: []*resourcev1.ResourceClaim{
@@ -199,7 +359,7 @@ func TestPrepareUnprepareResourceClaims(t *testing.T) {
 			continue
 		}
 
-		driver, driverErr := getFakeDriver(testDirs)
+		driver, driverErr := getFakeDriverWithFlags(testDirs, &QATFlags{WholePFAllocation: true})
 		if driverErr != nil {
 			t.Errorf("could not create kubelet-plugin: %v\n", driverErr)
 			continue
@@ -270,3 +430,1518 @@ func TestPrepareUnprepareResourceClaims(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckPFHealth(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestCheckPFHealth", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "dc", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	if driver.state.checkPFHealth() {
+		t.Error("health changed for healthy PF devices")
+	}
+
+	fatalErrorsFile := path.Join(testDirs.SysfsRoot, "bus/pci/devices/0000:aa:00.0/qat_ras/errors_fatal")
+	if err := os.WriteFile(fatalErrorsFile, []byte("1"), 0600); err != nil {
+		t.Fatalf("could not write fake sysfs file: %v", err)
+	}
+
+	if !driver.state.checkPFHealth() {
+		t.Error("health not changed after fatal error")
+	}
+
+	for _, dev := range driver.state.GetResources().Pools[testNodeName].Slices[0].Devices {
+		wantHealthy := !strings.Contains(dev.Name, "0000-aa-")
+		if *dev.Attributes["deviceHealthy"].BoolValue != wantHealthy {
+			t.Errorf("device %s: deviceHealthy want %v", dev.Name, wantHealthy)
+		}
+	}
+
+	claim := testhelpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", "qat.intel.com", testNodeName, []string{"qatvf-0000-aa-00-1"}, false)
+	response, _ := driver.PrepareResourceClaims(context.Background(), []*resourcev1.ResourceClaim{claim})
+	if response["uid1"].Err == nil {
+		t.Error("expected error preparing VF of unhealthy PF")
+	}
+}
+
+func TestUnprepareRemovedDevice(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestUnprepareRemovedDevice", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	claim := testhelpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", "qat.intel.com", testNodeName, []string{"qatvf-0000-aa-00-1"}, false)
+	response, _ := driver.PrepareResourceClaims(context.Background(), []*resourcev1.ResourceClaim{claim})
+	if response["uid1"].Err != nil {
+		t.Fatalf("unexpected error preparing claim: %v", response["uid1"].Err)
+	}
+
+	// The device disappears, e.g. after the PF was reset.
+	allocatableDevices, _ := driver.state.Allocatable.(device.VFDevices)
+	delete(allocatableDevices, "qatvf-0000-aa-00-1")
+
+	unprepareResponse, err := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: "uid1"}})
+	if err != nil || unprepareResponse["uid1"] != nil {
+		t.Fatalf("unexpected error unpreparing claim of removed device: %v, %v", err, unprepareResponse["uid1"])
+	}
+	if _, found := driver.state.Prepared["uid1"]; found {
+		t.Error("expected claim of removed device to be unprepared")
+	}
+}
+
+func TestPrepareDcOnDccDevice(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestPrepareDcOnDccDevice", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "dcc", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	claims := []*resourcev1.ResourceClaim{
+		newClaimWithServices("uid1", "qatvf-0000-aa-00-1", "dc"),
+		newClaimWithServices("uid2", "qatvf-0000-aa-00-2", "dcc"),
+	}
+	response, _ := driver.PrepareResourceClaims(context.Background(), claims)
+	for _, claimUID := range []types.UID{"uid1", "uid2"} {
+		if response[claimUID].Err != nil {
+			t.Errorf("unexpected error preparing claim %v: %v", claimUID, response[claimUID].Err)
+		}
+	}
+
+	if services := driver.state.pfDevices[0].Services; services != device.Dcc {
+		t.Errorf("expected PF services to stay dcc, got '%s'", services.String())
+	}
+}
+
+func TestPrepareMultiServiceClaim(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestPrepareMultiServiceClaim", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "asym", TotalVFs: 2},
+		{Device: "0000:cc:00.0", State: "up", Services: "", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+	driver.state.pfDevices[2].EnableReconfiguration(true)
+
+	claims := []*resourcev1.ResourceClaim{
+		// sym and asym VFs on different PF devices
+		newMultiServiceClaim("uid1", []string{"qatvf-0000-aa-00-1", "qatvf-0000-bb-00-1"}, []string{"sym", "asym"}),
+		// asym is not available on the sym PF device, sym VF is rolled back
+		newMultiServiceClaim("uid2", []string{"qatvf-0000-aa-00-2", "qatvf-0000-aa-00-1"}, []string{"sym", "asym"}),
+		// the PF device is reconfigured for dc before any service VF is taken
+		newMultiServiceClaim("uid3", []string{"qatvf-0000-cc-00-1", "qatvf-0000-cc-00-2"}, []string{"", "dc"}),
+	}
+	response, _ := driver.PrepareResourceClaims(context.Background(), claims)
+
+	if err := response["uid1"].Err; err != nil {
+		t.Fatalf("unexpected error preparing multi-service claim: %v", err)
+	}
+	preparedDevices := []string{}
+	for _, preparedDevice := range response["uid1"].Devices {
+		preparedDevices = append(preparedDevices, preparedDevice.Requests[0]+":"+preparedDevice.DeviceName)
+	}
+	if expected := []string{"request0:qatvf-0000-aa-00-1", "request1:qatvf-0000-bb-00-1"}; !reflect.DeepEqual(preparedDevices, expected) {
+		t.Errorf("expected prepared devices %v, got %v", expected, preparedDevices)
+	}
+
+	if response["uid2"].Err == nil {
+		t.Error("expected claim with unavailable service to fail")
+	}
+	for _, pf := range driver.state.pfDevices {
+		if _, allocated := pf.AllocatedDevices["uid2"]; allocated {
+			t.Errorf("expected devices of failed claim to be freed on PF %v", pf.Device)
+		}
+	}
+	if _, available := driver.state.pfDevices[0].AvailableDevices["qatvf-0000-aa-00-2"]; !available {
+		t.Error("expected sym VF of failed claim to be available again")
+	}
+
+	if err := response["uid3"].Err; err != nil {
+		t.Fatalf("unexpected error preparing claim with service and any service requests: %v", err)
+	}
+	if services := driver.state.pfDevices[2].Services; services.String() != "dc" {
+		t.Errorf("expected PF device to be reconfigured to dc, got '%s'", services.String())
+	}
+}
+
+func TestUnprepareMultiDeviceClaim(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestUnprepareMultiDeviceClaim", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+	for _, pf := range driver.state.pfDevices {
+		pf.EnableReconfiguration(true)
+	}
+
+	claims := []*resourcev1.ResourceClaim{
+		newMultiServiceClaim("uid1", []string{"qatvf-0000-aa-00-1", "qatvf-0000-bb-00-1"}, []string{"sym", "asym"}),
+	}
+	response, _ := driver.PrepareResourceClaims(context.Background(), claims)
+	if err := response["uid1"].Err; err != nil {
+		t.Fatalf("unexpected error preparing claim: %v", err)
+	}
+	if devices := response["uid1"].Devices; len(devices) != 2 {
+		t.Fatalf("expected 2 prepared devices, got %+v", devices)
+	}
+
+	unprepared, _ := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{
+		{UID: "uid1", NamespacedName: types.NamespacedName{Namespace: testNameSpace, Name: "uid1"}},
+	})
+	if unprepared["uid1"] != nil {
+		t.Fatalf("unexpected error unpreparing claim: %v", unprepared["uid1"])
+	}
+
+	for i, vfUID := range []string{"qatvf-0000-aa-00-1", "qatvf-0000-bb-00-1"} {
+		pf := driver.state.pfDevices[i]
+		if _, allocated := pf.AllocatedDevices["uid1"]; allocated {
+			t.Errorf("expected devices of claim to be freed on PF %v", pf.Device)
+		}
+		if _, available := pf.AvailableDevices[vfUID]; !available {
+			t.Errorf("expected VF %v to be available again after unprepare", vfUID)
+		}
+	}
+}
+
+func TestPrepareMaxDevicesPerClaim(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestPrepareMaxDevicesPerClaim", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 3},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+	driver.maxDevicesPerClaim = 2
+
+	claims := []*resourcev1.ResourceClaim{
+		testhelpers.NewClaim("default", "claim1", "uid1", "request1", device.DriverName, "node1", []string{"qatvf-0000-aa-00-1", "qatvf-0000-aa-00-2"}, false),
+		testhelpers.NewClaim("default", "claim2", "uid2", "request2", device.DriverName, "node1", []string{"qatvf-0000-aa-00-3", "qatvf-0000-aa-00-4", "qatvf-0000-aa-00-5"}, false),
+	}
+	response, _ := driver.PrepareResourceClaims(context.Background(), claims)
+	if response["uid1"].Err != nil {
+		t.Errorf("unexpected error preparing claim within limit: %v", response["uid1"].Err)
+	}
+	if err := response["uid2"].Err; err == nil || !strings.Contains(err.Error(), "maximum of 2 devices per claim") {
+		t.Errorf("expected oversized claim to be rejected, got %v", err)
+	}
+	if _, prepared := driver.state.Prepared["uid2"]; prepared {
+		t.Error("expected oversized claim not to be prepared")
+	}
+}
+
+func TestPrepareVerifiesReconfiguration(t *testing.T) {
+	tests := []struct {
+		name           string
+		verifyError    error
+		expectError    bool
+		expectServices device.Services
+	}{
+		{name: "services applied", expectServices: device.Sym},
+		{name: "services not applied", verifyError: fmt.Errorf("services not applied"), expectError: true, expectServices: device.None},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+			defer testhelpers.CleanupTest(t, "TestPrepareVerifiesReconfiguration", testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("setup error: %v", err)
+			}
+
+			fakeQATDevices := fakesysfs.QATDevices{
+				{Device: "0000:aa:00.0", State: "up", Services: "", TotalVFs: 2},
+			}
+			if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			driver, err := getFakeDriver(testDirs)
+			if err != nil {
+				t.Fatalf("could not create kubelet-plugin: %v", err)
+			}
+			defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+			driver.state.pfDevices[0].EnableReconfiguration(true)
+			if tt.verifyError != nil {
+				driver.state.verifyServices = func(*device.VFDevice) error { return tt.verifyError }
+			}
+			// Remembers the published resources.
+			driver.republisher = helpers.NewRepublisher(time.Hour)
+			driver.republisher.Published(driver.GetResources())
+
+			claims := []*resourcev1.ResourceClaim{newClaimWithServices("uid1", "qatvf-0000-aa-00-1", "sym")}
+			response, _ := driver.PrepareResourceClaims(context.Background(), claims)
+			if err := response["uid1"].Err; (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if !tt.expectError && driver.republisher.Changed(driver.GetResources()) {
+				t.Error("expected reconfigured PF services to be published")
+			}
+
+			pf := driver.state.pfDevices[0]
+			if pf.Services.String() != tt.expectServices.String() {
+				t.Errorf("expected PF services '%s', got '%s'", tt.expectServices.String(), pf.Services.String())
+			}
+			if _, allocated := pf.AllocatedDevices["uid1"]; allocated == tt.expectError {
+				t.Errorf("expected device allocated %v", !tt.expectError)
+			}
+		})
+	}
+}
+
+func TestPrepareBatchReconfiguration(t *testing.T) {
+	tests := []struct {
+		name               string
+		maxDevicesPerClaim int
+		// All claims when empty.
+		claimUIDs      []string
+		expectPrepared []string
+		expectServices device.Services
+		expectEvents   int
+	}{
+		{
+			name:           "all claims prepared",
+			expectPrepared: []string{"uid1", "uid2", "uid3"},
+			expectServices: device.Sym | device.Asym,
+			expectEvents:   1,
+		},
+		{
+			// uid3 requests two VFs and fails, the other claims keep their VFs.
+			name:               "later claim fails",
+			maxDevicesPerClaim: 1,
+			expectPrepared:     []string{"uid1", "uid2"},
+			expectServices:     device.Sym | device.Asym,
+			expectEvents:       1,
+		},
+		{
+			// uid3 is rejected before the batch, so the PF device is
+			// configured for uid1 alone.
+			name:               "rejected claim does not reconfigure",
+			maxDevicesPerClaim: 1,
+			claimUIDs:          []string{"uid1", "uid3"},
+			expectPrepared:     []string{"uid1"},
+			expectServices:     device.Sym,
+			expectEvents:       1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+			defer testhelpers.CleanupTest(t, "TestPrepareBatchReconfiguration", testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("setup error: %v", err)
+			}
+
+			fakeQATDevices := fakesysfs.QATDevices{
+				{Device: "0000:aa:00.0", State: "up", Services: "", TotalVFs: 4},
+			}
+			if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			driver, err := getFakeDriver(testDirs)
+			if err != nil {
+				t.Fatalf("could not create kubelet-plugin: %v", err)
+			}
+			defer func() { _ = driver.Shutdown(context.TODO()) }()
+			driver.maxDevicesPerClaim = tt.maxDevicesPerClaim
+
+			pf := driver.state.pfDevices[0]
+			pf.EnableReconfiguration(true)
+			events := 0
+			pf.ReconfigurationHandler = func(device.ReconfigurationEvent) { events++ }
+			// Remembers the published resources.
+			driver.republisher = helpers.NewRepublisher(time.Hour)
+			driver.republisher.Published(driver.GetResources())
+
+			claims := []*resourcev1.ResourceClaim{}
+			for _, claim := range []*resourcev1.ResourceClaim{
+				newClaimWithServices("uid1", "qatvf-0000-aa-00-1", "sym"),
+				newClaimWithServices("uid2", "qatvf-0000-aa-00-2", "asym"),
+				newMultiServiceClaim("uid3", []string{"qatvf-0000-aa-00-3", "qatvf-0000-aa-00-4"}, []string{"sym", "asym"}),
+			} {
+				if len(tt.claimUIDs) == 0 || slices.Contains(tt.claimUIDs, string(claim.UID)) {
+					claims = append(claims, claim)
+				}
+			}
+			response, _ := driver.PrepareResourceClaims(context.Background(), claims)
+
+			for _, claim := range claims {
+				_, prepared := driver.state.Prepared[string(claim.UID)]
+				if expected := slices.Contains(tt.expectPrepared, string(claim.UID)); prepared != expected {
+					t.Errorf("claim %v: expected prepared %v, got %v (error %v)", claim.UID, expected, prepared, response[claim.UID].Err)
+				}
+			}
+			if pf.Services.String() != tt.expectServices.String() {
+				t.Errorf("expected PF services '%s', got '%s'", tt.expectServices.String(), pf.Services.String())
+			}
+			if events != tt.expectEvents {
+				t.Errorf("expected %d reconfigurations, got %d", tt.expectEvents, events)
+			}
+			if driver.republisher.Changed(driver.GetResources()) {
+				t.Error("expected reconfigured PF services to be published")
+			}
+		})
+	}
+}
+
+func TestPrepareBatchReconfigurationRestore(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestPrepareBatchReconfigurationRestore", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "", TotalVFs: 4},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+	driver.maxDevicesPerClaim = 1
+
+	pf := driver.state.pfDevices[0]
+	pf.EnableReconfiguration(true)
+
+	// Both claims fail, the PF device returns to its previous services.
+	claims := []*resourcev1.ResourceClaim{
+		newMultiServiceClaim("uid1", []string{"qatvf-0000-aa-00-1", "qatvf-0000-aa-00-2"}, []string{"sym", "sym"}),
+		newMultiServiceClaim("uid2", []string{"qatvf-0000-aa-00-3", "qatvf-0000-aa-00-4"}, []string{"asym", "asym"}),
+	}
+	response, _ := driver.PrepareResourceClaims(context.Background(), claims)
+	if response["uid1"].Err == nil || response["uid2"].Err == nil {
+		t.Fatalf("expected both claims to fail, got %v and %v", response["uid1"].Err, response["uid2"].Err)
+	}
+	if expected := device.Services(device.None); pf.Services.String() != expected.String() {
+		t.Errorf("expected PF services to be restored to '%s', got '%s'", expected.String(), pf.Services.String())
+	}
+}
+
+func TestReconfigurationEvents(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestReconfigurationEvents", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	pf := driver.state.pfDevices[0]
+	pf.EnableReconfiguration(true)
+	driver.enableReconfigurationEvents()
+
+	response, _ := driver.PrepareResourceClaims(context.Background(), []*resourcev1.ResourceClaim{newClaimWithServices("uid1", "qatvf-0000-aa-00-1", "sym")})
+	if err := response["uid1"].Err; err != nil {
+		t.Fatalf("unexpected error preparing claim: %v", err)
+	}
+	if _, err := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: "uid1"}}); err != nil {
+		t.Fatalf("unexpected error unpreparing claim: %v", err)
+	}
+
+	// Events are sent in the background.
+	var events *core.EventList
+	for range 50 {
+		events, err = driver.client.CoreV1().Events(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("could not list events: %v", err)
+		}
+		if len(events.Items) >= 2 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	expected := map[string]bool{
+		"PF device '0000:aa:00.0' services reconfigured from 'none' to 'sym' for claim 'uid1'": true,
+		"PF device '0000:aa:00.0' services reconfigured from 'sym' to 'none' for claim 'uid1'": true,
+	}
+	if len(events.Items) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(events.Items))
+	}
+	for _, event := range events.Items {
+		if !expected[event.Message] {
+			t.Errorf("unexpected event message: %v", event.Message)
+		}
+		if event.InvolvedObject.Kind != "Node" || event.InvolvedObject.Name != testNodeName || event.Reason != reconfigurationEventReason {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestSnapshot", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	claim := testhelpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", "qat.intel.com", testNodeName, []string{"qatvf-0000-aa-00-1"}, false)
+	response, _ := driver.PrepareResourceClaims(context.Background(), []*resourcev1.ResourceClaim{claim})
+	if response["uid1"].Err != nil {
+		t.Fatalf("unexpected prepare error: %v", response["uid1"].Err)
+	}
+
+	snapshot := driver.Snapshot()
+	allocatableUIDs := []string{}
+	for _, dev := range snapshot.Allocatable {
+		allocatableUIDs = append(allocatableUIDs, dev.UID)
+	}
+	expectedUIDs := []string{"qatpf-0000-aa-00-0", "qatvf-0000-aa-00-1", "qatvf-0000-aa-00-2"}
+	if !reflect.DeepEqual(allocatableUIDs, expectedUIDs) {
+		t.Errorf("expected allocatable %v, got %v", expectedUIDs, allocatableUIDs)
+	}
+	if !reflect.DeepEqual(snapshot.PreparedClaims, map[string][]string{"uid1": {"qatvf-0000-aa-00-1"}}) {
+		t.Errorf("unexpected prepared claims %v", snapshot.PreparedClaims)
+	}
+	if !reflect.DeepEqual(snapshot.Allocations, map[string][]string{"uid1": {"qatvf-0000-aa-00-1"}}) {
+		t.Errorf("unexpected allocations %v", snapshot.Allocations)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestAuditLog", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	auditLogPath := path.Join(testDirs.TestRoot, "audit.jsonl")
+	driver.auditLog = helpers.NewAuditLog(auditLogPath, helpers.DefaultAuditLogMaxSizeMiB)
+
+	claim := testhelpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", "qat.intel.com", testNodeName, []string{"qatvf-0000-aa-00-1"}, false)
+	response, _ := driver.PrepareResourceClaims(context.Background(), []*resourcev1.ResourceClaim{claim})
+	if response["uid1"].Err != nil {
+		t.Fatalf("unexpected prepare error: %v", response["uid1"].Err)
+	}
+	unprepareResponse, _ := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{
+		{NamespacedName: types.NamespacedName{Namespace: testNameSpace, Name: "claim1"}, UID: "uid1"},
+	})
+	if unprepareResponse["uid1"] != nil {
+		t.Fatalf("unexpected unprepare error: %v", unprepareResponse["uid1"])
+	}
+
+	auditLog, err := os.ReadFile(auditLogPath)
+	if err != nil {
+		t.Fatalf("could not read audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(auditLog)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit records, got %v", lines)
+	}
+	for i, action := range []string{helpers.AuditActionPrepare, helpers.AuditActionUnprepare} {
+		var record helpers.AuditRecord
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatalf("could not parse audit record: %v", err)
+		}
+		if record.Action != action || record.ClaimUID != "uid1" || record.Namespace != testNameSpace ||
+			!reflect.DeepEqual(record.Devices, []string{"qatvf-0000-aa-00-1"}) || record.Services != "sym;asym" {
+			t.Errorf("unexpected audit record %+v", record)
+		}
+	}
+}
+
+func TestPCIAddressAttribute(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestPCIAddressAttribute", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriverWithFlags(testDirs, &QATFlags{WholePFAllocation: true})
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	expected := map[string]string{
+		"qatpf-0000-aa-00-0": "0000:aa:00.0",
+		"qatvf-0000-aa-00-1": "0000:aa:00.1",
+		"qatvf-0000-aa-00-2": "0000:aa:00.2",
+	}
+	pciAddresses := map[string]string{}
+	for _, dev := range driver.state.GetResources().Pools[testNodeName].Slices[0].Devices {
+		if pciAddress := dev.Attributes["pciAddress"].StringValue; pciAddress != nil {
+			pciAddresses[dev.Name] = *pciAddress
+		}
+	}
+	if !reflect.DeepEqual(pciAddresses, expected) {
+		t.Errorf("expected PCI addresses %v, got %v", expected, pciAddresses)
+	}
+}
+
+func TestModelAttributes(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestModelAttributes", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 1, DeviceID: "0x4942"},
+		{Device: "0000:bb:00.0", State: "up", Services: "sym;asym", TotalVFs: 1, DeviceID: "0x1234"},
+		{Device: "0000:cc:00.0", State: "up", Services: "sym;asym", TotalVFs: 1},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriverWithFlags(testDirs, &QATFlags{WholePFAllocation: true})
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	expectedModels := map[string]string{
+		"qatpf-0000-aa-00-0": "0x4942",
+		"qatvf-0000-aa-00-1": "0x4942",
+		"qatpf-0000-bb-00-0": "0x1234",
+		"qatvf-0000-bb-00-1": "0x1234",
+	}
+	// unknown device IDs have no generation
+	expectedGenerations := map[string]string{
+		"qatpf-0000-aa-00-0": "401xx",
+		"qatvf-0000-aa-00-1": "401xx",
+	}
+	models := map[string]string{}
+	generations := map[string]string{}
+	for _, dev := range driver.state.GetResources().Pools[testNodeName].Slices[0].Devices {
+		if model := dev.Attributes["model"].StringValue; model != nil {
+			models[dev.Name] = *model
+		}
+		if generation := dev.Attributes["generation"].StringValue; generation != nil {
+			generations[dev.Name] = *generation
+		}
+	}
+	if !reflect.DeepEqual(models, expectedModels) {
+		t.Errorf("expected models %v, got %v", expectedModels, models)
+	}
+	if !reflect.DeepEqual(generations, expectedGenerations) {
+		t.Errorf("expected generations %v, got %v", expectedGenerations, generations)
+	}
+}
+
+func TestUnknownServicesAttribute(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestUnknownServicesAttribute", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;xyz", TotalVFs: 1},
+		{Device: "0000:bb:00.0", State: "up", Services: "sym;asym", TotalVFs: 1},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriverWithFlags(testDirs, &QATFlags{WholePFAllocation: true})
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	expected := map[string]string{
+		"qatpf-0000-aa-00-0": "xyz",
+		"qatvf-0000-aa-00-1": "xyz",
+	}
+	unknownServices := map[string]string{}
+	for _, dev := range driver.state.GetResources().Pools[testNodeName].Slices[0].Devices {
+		if unknown := dev.Attributes["unknownServices"].StringValue; unknown != nil {
+			unknownServices[dev.Name] = *unknown
+		}
+		if dev.Name == "qatvf-0000-aa-00-1" && *dev.Attributes["services"].StringValue != "sym" {
+			t.Errorf("expected known services 'sym', got '%s'", *dev.Attributes["services"].StringValue)
+		}
+	}
+	if !reflect.DeepEqual(unknownServices, expected) {
+		t.Errorf("expected unknown services %v, got %v", expected, unknownServices)
+	}
+}
+
+func TestAvailableCapacityMetric(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestAvailableCapacityMetric", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "asym;dc", TotalVFs: 1},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	expected := `
+# HELP qat_available_vfs [ALPHA] Number of VFs that could be allocated per service right now, including VFs of idle PF devices that could be reconfigured to the service.
+# TYPE qat_available_vfs gauge
+qat_available_vfs{service="asym"} 1
+qat_available_vfs{service="dc"} 1
+qat_available_vfs{service="dcc"} 0
+qat_available_vfs{service="sym"} 2
+`
+	if err := testutil.CustomCollectAndCompare(newAvailableVFsCollector(driver.state.availableCapacity), strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+
+	// Computed on scrape, without publishing resources.
+	if _, err := driver.state.pfDevices[0].Allocate("", "claim1"); err != nil {
+		t.Fatalf("allocate error: %v", err)
+	}
+	expected = strings.Replace(expected, `qat_available_vfs{service="sym"} 2`, `qat_available_vfs{service="sym"} 1`, 1)
+	if err := testutil.CustomCollectAndCompare(newAvailableVFsCollector(driver.state.availableCapacity), strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics after allocation: %v", err)
+	}
+}
+
+func TestReconfigurableAttribute(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestReconfigurableAttribute", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "", TotalVFs: 1},
+		{Device: "0000:bb:00.0", State: "up", Services: "", TotalVFs: 1},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriverWithFlags(testDirs, &QATFlags{WholePFAllocation: true})
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	for _, pf := range driver.state.pfDevices {
+		pf.EnableReconfiguration(pf.Device == "0000:aa:00.0")
+		// The cooldown ends without a republish, so it does not change the attribute.
+		pf.SetReconfigurationCooldown(time.Hour)
+		pf.LastReconfiguration = time.Now()
+	}
+
+	expected := map[string]bool{
+		"qatpf-0000-aa-00-0": true,
+		"qatvf-0000-aa-00-1": true,
+		"qatpf-0000-bb-00-0": false,
+		"qatvf-0000-bb-00-1": false,
+	}
+	reconfigurable := map[string]bool{}
+	for _, dev := range driver.state.GetResources().Pools[testNodeName].Slices[0].Devices {
+		if value := dev.Attributes["reconfigurable"].BoolValue; value != nil {
+			reconfigurable[dev.Name] = *value
+		}
+	}
+	if !reflect.DeepEqual(reconfigurable, expected) {
+		t.Errorf("expected reconfigurable attributes %v, got %v", expected, reconfigurable)
+	}
+}
+
+func TestBoundAttribute(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestBoundAttribute", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	boundAttributes := func() map[string]bool {
+		bound := map[string]bool{}
+		for _, dev := range driver.state.GetResources().Pools[testNodeName].Slices[0].Devices {
+			if value := dev.Attributes["bound"].BoolValue; value != nil {
+				bound[dev.Name] = *value
+			}
+		}
+		return bound
+	}
+
+	expected := map[string]bool{"qatvf-0000-aa-00-1": true, "qatvf-0000-aa-00-2": true}
+	if bound := boundAttributes(); !reflect.DeepEqual(bound, expected) {
+		t.Errorf("expected bound attributes %v, got %v", expected, bound)
+	}
+
+	if err := os.Remove(path.Join(testDirs.SysfsRoot, device.SysfsDevicePath, "0000:aa:00.2", "driver")); err != nil {
+		t.Fatalf("could not unbind VF: %v", err)
+	}
+	if !driver.state.checkVFBinding() {
+		t.Error("expected VF binding change to be detected")
+	}
+	if driver.state.checkVFBinding() {
+		t.Error("expected no VF binding change on second check")
+	}
+
+	expected["qatvf-0000-aa-00-2"] = false
+	if bound := boundAttributes(); !reflect.DeepEqual(bound, expected) {
+		t.Errorf("expected bound attributes %v, got %v", expected, bound)
+	}
+
+	// VF bound to another driver, detected also without health monitoring.
+	otherDriver := path.Join(testDirs.SysfsRoot, "bus/pci/drivers/4xxxvf")
+	if err := os.MkdirAll(otherDriver, 0750); err != nil {
+		t.Fatalf("could not create fake driver: %v", err)
+	}
+	vfDriverLink := path.Join(testDirs.SysfsRoot, device.SysfsDevicePath, "0000:aa:00.1", "driver")
+	if err := os.Remove(vfDriverLink); err != nil {
+		t.Fatalf("could not unbind VF: %v", err)
+	}
+	if err := os.Symlink(otherDriver, vfDriverLink); err != nil {
+		t.Fatalf("could not bind VF to other driver: %v", err)
+	}
+	driver.checkDevices(context.TODO())
+
+	expected["qatvf-0000-aa-00-1"] = false
+	if bound := boundAttributes(); !reflect.DeepEqual(bound, expected) {
+		t.Errorf("expected bound attributes %v, got %v", expected, bound)
+	}
+	if pf := driver.state.pfDevices[0]; len(pf.ExternallyUsedVFs()) != 1 {
+		t.Errorf("expected VF bound to other driver to be used externally, got %v", pf.ExternallyUsedVFs())
+	}
+}
+
+func TestDefaultConfigurationInstances(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDefaultConfigurationInstances", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "", TotalVFs: 2},
+		{Device: "0000:cc:00.0", State: "up", Services: "", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	config, err := parseConfig([]byte(`{"`+testNodeName+`": {
+		"0000:aa:00.0": "dc",
+		"0000:bb:00.0": {"services": "sym;asym", "instances": {"sym": 3, "asym": 1}},
+		"0000:cc:00.0": {"services": "sym", "instances": {"sym": 5}}
+	}}`), testNodeName)
+	if err != nil {
+		t.Fatalf("could not parse config: %v", err)
+	}
+	applyDefaultConfiguration(testNodeName, config, driver.state.pfDevices)
+
+	expected := map[string]device.Instances{
+		"0000:aa:00.0": {},
+		"0000:bb:00.0": {Sym: 3, Asym: 1},
+		"0000:cc:00.0": {},
+	}
+	for _, pf := range driver.state.pfDevices {
+		if pf.Instances != expected[pf.Device] {
+			t.Errorf("PF %v: expected instances %+v, got %+v", pf.Device, expected[pf.Device], pf.Instances)
+		}
+	}
+	if services := driver.state.pfDevices[2].Services; services == device.Sym {
+		t.Errorf("expected PF with instances over hardware limit to be left unconfigured")
+	}
+
+	// The kernel driver splits the ring pairs between the services itself, so
+	// the instance counts are not published as capacity.
+	for _, dev := range driver.state.GetResources().Pools[testNodeName].Slices[0].Devices {
+		if len(dev.Capacity) != 0 {
+			t.Errorf("%v: expected no instance capacity, got %v", dev.Name, dev.Capacity)
+		}
+	}
+}
+
+func TestDefaultConfigurationDefaultService(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDefaultConfigurationDefaultService", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "", TotalVFs: 2},
+		{Device: "0000:cc:00.0", State: "up", Services: "", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	config, err := parseConfig([]byte(`{"`+testNodeName+`": {
+		"0000:aa:00.0": {"defaultService": "sym"},
+		"0000:bb:00.0": {"services": "asym", "defaultService": "dc"},
+		"0000:cc:00.0": {"defaultService": "foo"}
+	}}`), testNodeName)
+	if err != nil {
+		t.Fatalf("could not parse config: %v", err)
+	}
+	applyDefaultConfiguration(testNodeName, config, driver.state.pfDevices)
+
+	expected := map[string]struct {
+		services       device.Services
+		defaultService device.Services
+	}{
+		"0000:aa:00.0": {services: device.Sym, defaultService: device.Sym},
+		"0000:bb:00.0": {services: device.Asym, defaultService: device.Dc},
+		"0000:cc:00.0": {services: device.None, defaultService: device.Unset},
+	}
+	for _, pf := range driver.state.pfDevices {
+		want := expected[pf.Device]
+		if pf.Services.String() != want.services.String() {
+			t.Errorf("PF %v: expected services '%s', got '%s'", pf.Device, want.services.String(), pf.Services.String())
+		}
+		if pf.DefaultService != want.defaultService {
+			t.Errorf("PF %v: expected default service '%s', got '%s'", pf.Device, want.defaultService.String(), pf.DefaultService.String())
+		}
+	}
+}
+
+func TestTopology(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestTopology", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	topology := driver.Topology()
+	if topology.NodeName != testNodeName || len(topology.Devices) != 3 {
+		t.Fatalf("expected 3 devices on %v, got %+v", testNodeName, topology)
+	}
+
+	pf := topology.Devices[0]
+	if pf.UID != "qatpf-0000-aa-00-0" || pf.PCIRoot != "pci0000:aa" || pf.Services != "sym;asym" || pf.NUMANode != helpers.NUMANodeUnknown {
+		t.Errorf("unexpected PF device %+v", pf)
+	}
+	for _, vf := range topology.Devices[1:] {
+		if vf.ParentUID != pf.UID || vf.PCIRoot != pf.PCIRoot || vf.Services != pf.Services {
+			t.Errorf("expected VF %+v to belong to PF %v", vf, pf.UID)
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestCapabilities", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriverWithFlags(testDirs, &QATFlags{DisableVFsOnShutdown: true, WholePFAllocation: true})
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	capabilities := driver.Capabilities()
+	if capabilities.Driver != device.DriverName {
+		t.Errorf("expected driver %v, got %v", device.DriverName, capabilities.Driver)
+	}
+	expected := map[string]bool{
+		helpers.FeatureAuditLog:                false,
+		helpers.FeatureAllocationHook:          false,
+		helpers.FeatureQualifiedAttributeNames: false,
+		helpers.FeatureHealthMonitoring:        false,
+		"serviceReconfiguration":               false,
+		"reconfigurationEvents":                false,
+		"forceReconfiguration":                 false,
+		"wholePFAllocation":                    true,
+		"disableVFsOnShutdown":                 true,
+	}
+	if !reflect.DeepEqual(capabilities.Features, expected) {
+		t.Errorf("expected features %v, got %v", expected, capabilities.Features)
+	}
+}
+
+func TestOneshot(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestOneshot", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2, NumVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+	t.Setenv("SYSFS_ROOT", testDirs.SysfsRoot)
+	device.ClearSysfsRoot()
+
+	// No API server client, oneshot must not need one.
+	config := &helpers.Config{
+		CommonFlags: &helpers.Flags{
+			NodeName:                  testNodeName,
+			CdiRoot:                   testDirs.CdiRoot,
+			KubeletPluginDir:          testDirs.KubeletPluginDir,
+			KubeletPluginsRegistryDir: testDirs.KubeletPluginRegistryDir,
+			CDISyncTimeout:            helpers.DefaultCDISyncTimeout,
+			Oneshot:                   true,
+			OneshotFormat:             helpers.OneshotFormatYAML,
+		},
+		DriverFlags: &QATFlags{WholePFAllocation: true},
+	}
+
+	out := &bytes.Buffer{}
+	if err := helpers.RunOneshot(context.TODO(), config, newDriver, out); err != nil {
+		t.Fatalf("oneshot failed: %v", err)
+	}
+
+	for _, expected := range []string{testNodeName + ":", "name: qatpf-0000-aa-00-0", "name: qatvf-0000-aa-00-2", "string: 0000:aa:00.1"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected oneshot output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+
+	// Oneshot must leave the host as it is.
+	numvfs, err := os.ReadFile(path.Join(testDirs.SysfsRoot, "bus/pci/devices/0000:bb:00.0/sriov_numvfs"))
+	if err != nil {
+		t.Fatalf("could not read sriov_numvfs: %v", err)
+	}
+	if strings.TrimSpace(string(numvfs)) != "0" {
+		t.Errorf("expected VFs of PF without VFs to stay disabled, got sriov_numvfs %s", numvfs)
+	}
+	for _, dir := range []string{testDirs.CdiRoot, testDirs.KubeletPluginDir} {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatalf("could not read %v: %v", dir, err)
+		}
+		if len(entries) > 0 {
+			t.Errorf("expected no files written to %v, got %v", dir, entries)
+		}
+	}
+}
+
+func TestDisableVFsOnShutdown(t *testing.T) {
+	tests := []struct {
+		name           string
+		flags          QATFlags
+		prepareClaim   bool
+		wantNumVFs     string
+		wantPrepared   int
+		wantEnabledPFs string
+	}{
+		{name: "disabled", wantNumVFs: "2", wantEnabledPFs: "0000:aa:00.0"},
+		{name: "no claims", flags: QATFlags{DisableVFsOnShutdown: true}, wantNumVFs: "0"},
+		{name: "prepared claim", flags: QATFlags{DisableVFsOnShutdown: true}, prepareClaim: true, wantNumVFs: "2", wantPrepared: 1, wantEnabledPFs: "0000:aa:00.0"},
+		{name: "prepared claim, forced", flags: QATFlags{ForceDisableVFsOnShutdown: true}, prepareClaim: true, wantNumVFs: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+			defer testhelpers.CleanupTest(t, "TestDisableVFsOnShutdown", testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("setup error: %v", err)
+			}
+
+			fakeQATDevices := fakesysfs.QATDevices{
+				{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+			}
+			if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			driver, err := getFakeDriverWithFlags(testDirs, &tt.flags)
+			if err != nil {
+				t.Fatalf("could not create kubelet-plugin: %v", err)
+			}
+
+			if tt.prepareClaim {
+				claim := testhelpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", "qat.intel.com", testNodeName, []string{"qatvf-0000-aa-00-1"}, false)
+				response, _ := driver.PrepareResourceClaims(context.Background(), []*resourcev1.ResourceClaim{claim})
+				if response["uid1"].Err != nil {
+					t.Fatalf("unexpected error preparing claim: %v", response["uid1"].Err)
+				}
+			}
+
+			if err := driver.Shutdown(context.TODO()); err != nil {
+				t.Fatalf("Shutdown() error: %v", err)
+			}
+
+			numvfs, err := os.ReadFile(path.Join(testDirs.SysfsRoot, "bus/pci/devices/0000:aa:00.0/sriov_numvfs"))
+			if err != nil {
+				t.Fatalf("could not read fake sysfs file: %v", err)
+			}
+			if strings.TrimSpace(string(numvfs)) != tt.wantNumVFs {
+				t.Errorf("expected %s VFs after shutdown, got %s", tt.wantNumVFs, numvfs)
+			}
+
+			preparedClaims, err := helpers.ReadPreparedClaimsFromFile(path.Join(testDirs.KubeletPluginDir, device.PreparedClaimsFileName))
+			if err != nil {
+				t.Fatalf("could not read prepared claims: %v", err)
+			}
+			if len(preparedClaims) != tt.wantPrepared {
+				t.Errorf("expected %d prepared claims after shutdown, got %d", tt.wantPrepared, len(preparedClaims))
+			}
+
+			enabledPFs, err := readVFsEnabledByDriver(path.Join(testDirs.KubeletPluginDir, device.VFsEnabledByDriverFileName))
+			if err != nil {
+				t.Fatalf("could not read PF devices with VFs enabled by driver: %v", err)
+			}
+			if strings.Join(enabledPFs, ",") != tt.wantEnabledPFs {
+				t.Errorf("expected PF devices with VFs enabled by driver '%s', got %v", tt.wantEnabledPFs, enabledPFs)
+			}
+		})
+	}
+}
+
+func TestVFsEnabledByDriverRestored(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestVFsEnabledByDriverRestored", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "dc", NumVFs: 2, TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	firstDriver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	// VFs stay enabled for the restarted driver, like after a driver crash.
+	if err := firstDriver.Shutdown(context.TODO()); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+
+	driver, err := getFakeDriverWithFlags(testDirs, &QATFlags{DisableVFsOnShutdown: true})
+	if err != nil {
+		t.Fatalf("could not create restarted kubelet-plugin: %v", err)
+	}
+
+	for _, pf := range driver.state.pfDevices {
+		wantEnabledByDriver := pf.Device == "0000:aa:00.0"
+		if pf.VFsEnabledByDriver != wantEnabledByDriver {
+			t.Errorf("PF device %s: expected VFs enabled by driver %v, got %v", pf.Device, wantEnabledByDriver, pf.VFsEnabledByDriver)
+		}
+	}
+
+	if err := driver.Shutdown(context.TODO()); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+	for pfDevice, wantNumVFs := range map[string]string{"0000:aa:00.0": "0", "0000:bb:00.0": "2"} {
+		numvfs, err := os.ReadFile(path.Join(testDirs.SysfsRoot, "bus/pci/devices", pfDevice, "sriov_numvfs"))
+		if err != nil {
+			t.Fatalf("could not read fake sysfs file: %v", err)
+		}
+		if strings.TrimSpace(string(numvfs)) != wantNumVFs {
+			t.Errorf("PF device %s: expected %s VFs after shutdown, got %s", pfDevice, wantNumVFs, numvfs)
+		}
+	}
+}
+
+func TestWriteVFsEnabledByDriverError(t *testing.T) {
+	pfdevices := device.QATDevices{{Device: "0000:aa:00.0", VFsEnabledByDriver: true}}
+
+	filePath := path.Join(t.TempDir(), device.VFsEnabledByDriverFileName)
+	if err := writeVFsEnabledByDriver(filePath, pfdevices); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	if pfAddresses, err := readVFsEnabledByDriver(filePath); err != nil || !reflect.DeepEqual(pfAddresses, []string{"0000:aa:00.0"}) {
+		t.Errorf("expected PF device 0000:aa:00.0, got %v, error: %v", pfAddresses, err)
+	}
+
+	// Failures are reported instead of skipped, e.g. in a read-only plugin directory.
+	notDir := path.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notDir, []byte{}, 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if err := writeVFsEnabledByDriver(path.Join(notDir, device.VFsEnabledByDriverFileName), pfdevices); err == nil {
+		t.Error("expected error writing to unwritable path")
+	}
+}
+
+func TestPreflightPFDevices(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestPreflightPFDevices", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 1},
+		{Device: "0000:bb:00.0", State: "up", Services: "sym;asym", TotalVFs: 1},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	os.Setenv("SYSFS_ROOT", testDirs.SysfsRoot)
+	device.ClearSysfsRoot()
+	pfdevices, err := device.New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+	if err != nil || len(pfdevices) != 2 {
+		t.Fatalf("could not discover PF devices: %v", err)
+	}
+
+	// qat/state and qat/cfg_services of the second PF device cannot be written.
+	qatDir := path.Join(testDirs.SysfsRoot, device.SysfsDevicePath, "0000:bb:00.0", "qat")
+	if err := os.RemoveAll(qatDir); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if err := os.WriteFile(qatDir, []byte{}, 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	writable := preflightPFDevices(pfdevices)
+	if len(writable) != 1 || writable[0].Device != "0000:aa:00.0" {
+		t.Errorf("expected only PF device 0000:aa:00.0 to be writable, got %v", writable)
+	}
+
+	for _, pf := range pfdevices {
+		pf.DeviceID = "0x4940"
+		pf.Services = device.None
+		pf.EnableReconfiguration(true)
+
+		writable := pf.Device == "0000:aa:00.0"
+		if pf.ReadOnly == writable || pf.Reconfigurable() != writable {
+			t.Errorf("PF device '%s': expected read-only %v and reconfigurable %v, got %v and %v", pf.Device, !writable, writable, pf.ReadOnly, pf.Reconfigurable())
+		}
+	}
+}
+
+func TestWholePFAllocationCounters(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestWholePFAllocationCounters", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	// PF devices are not announced by default.
+	resourceSlices := driver.state.GetResources().Pools[testNodeName].Slices
+	if len(resourceSlices) != 1 || len(resourceSlices[0].Devices) != 2 {
+		t.Fatalf("expected one slice with 2 VF devices, got %+v", resourceSlices)
+	}
+	for _, dev := range resourceSlices[0].Devices {
+		if strings.HasPrefix(dev.Name, "qatpf-") || dev.ConsumesCounters != nil {
+			t.Errorf("unexpected PF device or counter consumption: %+v", dev)
+		}
+	}
+	claim := testhelpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", device.DriverName, testNodeName, []string{"qatpf-0000-aa-00-0"}, false)
+	if response, _ := driver.PrepareResourceClaims(context.TODO(), []*resourcev1.ResourceClaim{claim}); response["uid1"].Err == nil {
+		t.Errorf("expected preparing PF device to fail without whole PF allocation")
+	}
+
+	driver.state.wholePFAllocation = true
+	resourceSlices = driver.state.GetResources().Pools[testNodeName].Slices
+	if len(resourceSlices) != 2 {
+		t.Fatalf("expected device and counter slices, got %+v", resourceSlices)
+	}
+
+	expectedCounterSets := []resourcev1.CounterSet{{
+		Name:     "qatpf-0000-aa-00-0",
+		Counters: map[string]resourcev1.Counter{pfCounter: {Value: *resource.NewQuantity(2, resource.DecimalSI)}},
+	}}
+	if !apiequality.Semantic.DeepEqual(resourceSlices[1].SharedCounters, expectedCounterSets) || resourceSlices[1].Devices != nil {
+		t.Errorf("expected counter slice with %+v, got %+v", expectedCounterSets, resourceSlices[1])
+	}
+
+	expectedConsumption := map[string]int64{
+		"qatvf-0000-aa-00-1": 1,
+		"qatvf-0000-aa-00-2": 1,
+		"qatpf-0000-aa-00-0": 2,
+	}
+	consumption := map[string]int64{}
+	for _, dev := range resourceSlices[0].Devices {
+		if len(dev.ConsumesCounters) != 1 || dev.ConsumesCounters[0].CounterSet != "qatpf-0000-aa-00-0" {
+			t.Fatalf("device %s: unexpected counter consumption %+v", dev.Name, dev.ConsumesCounters)
+		}
+		counter := dev.ConsumesCounters[0].Counters[pfCounter]
+		consumption[dev.Name] = counter.Value.Value()
+	}
+	if !reflect.DeepEqual(consumption, expectedConsumption) {
+		t.Errorf("expected counter consumption %v, got %v", expectedConsumption, consumption)
+	}
+}
+
+func TestRestoreAllocations(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestRestoreAllocations", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	fakeQATDevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "dc", TotalVFs: 2},
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	preparedClaims := helpers.ClaimPreparations{
+		"uid1": {Devices: []kubeletplugin.Device{{Requests: []string{"request1"}, PoolName: testNodeName, DeviceName: "qatpf-0000-aa-00-0"}}},
+		"uid2": {Devices: []kubeletplugin.Device{{Requests: []string{"request1"}, PoolName: testNodeName, DeviceName: "qatvf-0000-bb-00-1"}}},
+	}
+	if err := helpers.WritePreparedClaimsToFile(path.Join(testDirs.KubeletPluginDir, device.PreparedClaimsFileName), preparedClaims); err != nil {
+		t.Fatalf("setup error: could not write prepared claims: %v", err)
+	}
+
+	driver, err := getFakeDriverWithFlags(testDirs, &QATFlags{WholePFAllocation: true})
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	expected := map[string][]string{
+		"uid1": {"qatvf-0000-aa-00-1", "qatvf-0000-aa-00-2"},
+		"uid2": {"qatvf-0000-bb-00-1"},
+	}
+	allocations := driver.state.Allocations()
+	for claimUID := range allocations {
+		slices.Sort(allocations[claimUID])
+	}
+	if !reflect.DeepEqual(allocations, expected) {
+		t.Errorf("expected restored allocations %v, got %v", expected, allocations)
+	}
+
+	for _, deviceUID := range []string{"qatvf-0000-aa-00-1", "qatpf-0000-bb-00-0"} {
+		claim := testhelpers.NewClaim(testNameSpace, "claim3", "uid3", "request1", device.DriverName, testNodeName, []string{deviceUID}, false)
+		if response, _ := driver.PrepareResourceClaims(context.TODO(), []*resourcev1.ResourceClaim{claim}); response["uid3"].Err == nil {
+			t.Errorf("expected preparing device %s allocated before restart to fail", deviceUID)
+		}
+	}
+}
+
+func TestReservedVF(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestReservedVF", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	// More VFs than a slice with tainted devices can have.
+	fakeQATDevices := fakesysfs.QATDevices{}
+	for _, bus := range []string{"aa", "bb", "cc", "dd", "ee"} {
+		fakeQATDevices = append(fakeQATDevices, &fakesysfs.PFDevice{Device: "0000:" + bus + ":00.0", State: "up", Services: "sym;asym", TotalVFs: 16})
+	}
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakeQATDevices); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriverWithFlags(testDirs, &QATFlags{})
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	defer func() { _ = driver.Shutdown(context.TODO()) }()
+
+	driver.reservations.Update(map[string]string{driver.reservations.Annotation(): "qatvf-0000-aa-00-1"})
+
+	devices := 0
+	for _, slice := range driver.GetResources().Pools[testNodeName].Slices {
+		if len(slice.Devices) > resourcev1.ResourceSliceMaxDevicesWithTaintsOrConsumesCounters {
+			t.Errorf("expected at most %v devices in slice with reserved device, got %v",
+				resourcev1.ResourceSliceMaxDevicesWithTaintsOrConsumesCounters, len(slice.Devices))
+		}
+		devices += len(slice.Devices)
+	}
+	if devices != 80 {
+		t.Errorf("expected 80 VF devices published, got %v", devices)
+	}
+
+	// The whole PF includes the reserved VF.
+	driver.state.wholePFAllocation = true
+	claim := testhelpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", device.DriverName, testNodeName, []string{"qatpf-0000-aa-00-0"}, false)
+	if response, _ := driver.PrepareResourceClaims(context.TODO(), []*resourcev1.ResourceClaim{claim}); response["uid1"].Err == nil {
+		t.Error("expected preparing PF of reserved VF to fail")
+	}
+}
@@ -0,0 +1,44 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
+)
+
+const reconfigurationEventReason = "QATServicesReconfigured"
+
+// enableReconfigurationEvents makes the PF devices record their services
+// reconfigurations as Events of the Node object.
+func (d *driver) enableReconfigurationEvents() {
+	d.eventBroadcaster = record.NewBroadcaster()
+	d.eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: d.client.CoreV1().Events("")})
+	d.eventRecorder = d.eventBroadcaster.NewRecorder(scheme.Scheme, core.EventSource{Component: device.DriverName, Host: d.state.NodeName})
+
+	for _, pf := range d.state.pfDevices {
+		pf.ReconfigurationHandler = d.recordReconfigurationEvent
+	}
+}
+
+// recordReconfigurationEvent records a PF device services reconfiguration as
+// an Event of the Node object. The Event is sent in the background, so that
+// preparing claims does not wait for the API server, and failures are only
+// logged, the reconfiguration has already happened.
+func (d *driver) recordReconfigurationEvent(reconfiguration device.ReconfigurationEvent) {
+	node := &core.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Node",
+		Name:       d.state.NodeName,
+		UID:        types.UID(d.state.NodeName),
+	}
+
+	d.eventRecorder.Event(node, core.EventTypeNormal, reconfigurationEventReason, reconfiguration.String())
+}
@@ -0,0 +1,54 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+const deviceCheckInterval = 10 * time.Second
+
+// watchDevices periodically checks the driver binding of VFs and, with health
+// monitoring, health of PF devices until ctx is canceled.
+func (d *driver) watchDevices(ctx context.Context, interval time.Duration) {
+	klog.V(3).Info("starting device monitoring")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			klog.V(5).Info("device monitoring stopped")
+			return
+		case <-ticker.C:
+			d.checkDevices(ctx)
+		}
+	}
+}
+
+// checkDevices publishes updated ResourceSlice when health of any PF or the
+// driver binding of any VF changed.
+func (d *driver) checkDevices(ctx context.Context) {
+	d.state.Lock()
+	before := d.state.AllocatableDevices()
+	healthChanged := d.healthMonitoring && d.state.checkPFHealth()
+	bindingChanged := d.state.checkVFBinding()
+	changed := healthChanged || bindingChanged
+	helpers.LogInventoryDiff(before, d.state.AllocatableDevices())
+	d.state.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if err := d.PublishResourceSlice(ctx); err != nil {
+		klog.Errorf("could not publish updated resource slice: %v", err)
+	}
+}
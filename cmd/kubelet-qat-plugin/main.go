@@ -7,6 +7,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
@@ -14,8 +15,99 @@ import (
 	qat "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
 )
 
+const (
+	HealthMonitoringFlagDefault        = false
+	ReconfigurationCooldownFlagDefault = 0
+	PFUpRetriesFlagDefault             = 3
+	PFUpRetryIntervalFlagDefault       = 500 * time.Millisecond
+)
+
+type QATFlags struct {
+	HealthMonitoring          bool
+	ReconfigurationCooldown   time.Duration
+	ReconfigurationEvents     bool
+	DisableVFsOnShutdown      bool
+	ForceDisableVFsOnShutdown bool
+	StrictVFCount             bool
+	ForceReconfiguration      bool
+	PFUpRetries               int
+	PFUpRetryInterval         time.Duration
+	WholePFAllocation         bool
+	DeviceNode                helpers.DeviceNodeConfig
+}
+
 func main() {
-	if err := helpers.NewApp(qat.DriverName, newDriver, []cli.Flag{}, nil).Run(os.Args); err != nil {
+	qatFlags := QATFlags{}
+	cliFlags := []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "health-monitoring",
+			Aliases:     []string{"m"},
+			Usage:       "Periodically check PF devices state and fatal error counters, and mark VFs of failed PFs unhealthy.",
+			Value:       HealthMonitoringFlagDefault,
+			Destination: &qatFlags.HealthMonitoring,
+			EnvVars:     []string{"HEALTH_MONITORING"},
+		},
+		&cli.DurationFlag{
+			Name:        "reconfiguration-cooldown",
+			Usage:       "Minimum time between PF device service reconfigurations for claims. Allocations needing reconfiguration of a PF during the cooldown fail, and freed PFs keep their services. 0 disables the cooldown.",
+			Value:       ReconfigurationCooldownFlagDefault,
+			Destination: &qatFlags.ReconfigurationCooldown,
+			EnvVars:     []string{"RECONFIGURATION_COOLDOWN"},
+		},
+		&cli.BoolFlag{
+			Name:        "reconfiguration-events",
+			Usage:       "Record a Kubernetes Event on the Node object every time PF device services are reconfigured for a claim.",
+			Destination: &qatFlags.ReconfigurationEvents,
+			EnvVars:     []string{"RECONFIGURATION_EVENTS"},
+		},
+		&cli.BoolFlag{
+			Name:        "disable-vfs-on-shutdown",
+			Usage:       "Unbind and disable the VFs enabled by the driver when it shuts down, unless claims are prepared. VFs enabled by the operator are kept.",
+			Destination: &qatFlags.DisableVFsOnShutdown,
+			EnvVars:     []string{"DISABLE_VFS_ON_SHUTDOWN"},
+		},
+		&cli.BoolFlag{
+			Name:        "force-disable-vfs-on-shutdown",
+			Usage:       "Like --disable-vfs-on-shutdown, but also when claims are prepared. Devices of the prepared claims are freed first.",
+			Destination: &qatFlags.ForceDisableVFsOnShutdown,
+			EnvVars:     []string{"FORCE_DISABLE_VFS_ON_SHUTDOWN"},
+		},
+		&cli.BoolFlag{
+			Name:        "strict-vf-count",
+			Usage:       "Fail startup when fewer VFs are found than were enabled on a PF device, instead of logging a warning.",
+			Destination: &qatFlags.StrictVFCount,
+			EnvVars:     []string{"STRICT_VF_COUNT"},
+		},
+		&cli.BoolFlag{
+			Name:        "force-reconfiguration",
+			Usage:       "Reconfigure PF device services for claims even when some of its VFs are bound to other drivers than vfio-pci, e.g. on single-tenant nodes.",
+			Destination: &qatFlags.ForceReconfiguration,
+			EnvVars:     []string{"FORCE_RECONFIGURATION"},
+		},
+		&cli.IntFlag{
+			Name:        "pf-up-retries",
+			Usage:       "How many times to retry bringing a PF device up when it fails, e.g. after its services were reconfigured. 0 disables retries.",
+			Value:       PFUpRetriesFlagDefault,
+			Destination: &qatFlags.PFUpRetries,
+			EnvVars:     []string{"PF_UP_RETRIES"},
+		},
+		&cli.DurationFlag{
+			Name:        "pf-up-retry-interval",
+			Usage:       "Wait before the first retry of bringing a PF device up, doubled for every next retry.",
+			Value:       PFUpRetryIntervalFlagDefault,
+			Destination: &qatFlags.PFUpRetryInterval,
+			EnvVars:     []string{"PF_UP_RETRY_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:        "whole-pf-allocation",
+			Usage:       "Announce PF devices that allocate all their VFs to one claim. Requires the DRAPartitionableDevices feature gate, which keeps PF devices and their VFs from being allocated to different claims.",
+			Destination: &qatFlags.WholePFAllocation,
+			EnvVars:     []string{"WHOLE_PF_ALLOCATION"},
+		},
+	}
+	cliFlags = append(cliFlags, qatFlags.DeviceNode.Flags()...)
+
+	if err := helpers.NewApp(qat.DriverName, newDriver, cliFlags, &qatFlags).Run(os.Args); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,55 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
+)
+
+const metricsNamespace = "qat"
+
+var registerMetricsOnce sync.Once
+
+// availableVFsCollector reports the node-level capacity per service on every
+// scrape, accounting for PF devices that could be reconfigured to the service.
+type availableVFsCollector struct {
+	metrics.BaseStableCollector
+
+	availableVFsDesc  *metrics.Desc
+	availableCapacity func() map[device.Services]int
+}
+
+func newAvailableVFsCollector(availableCapacity func() map[device.Services]int) *availableVFsCollector {
+	return &availableVFsCollector{
+		availableVFsDesc: metrics.NewDesc(metricsNamespace+"_available_vfs",
+			"Number of VFs that could be allocated per service right now, including VFs of idle PF devices that could be reconfigured to the service.",
+			[]string{"service"}, nil, metrics.ALPHA, ""),
+		availableCapacity: availableCapacity,
+	}
+}
+
+func (c *availableVFsCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- c.availableVFsDesc
+}
+
+func (c *availableVFsCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	for service, count := range c.availableCapacity() {
+		ch <- metrics.NewLazyConstMetric(c.availableVFsDesc, metrics.GaugeValue, float64(count), service.String())
+	}
+}
+
+// registerMetrics registers QAT driver metrics in the legacyregistry. Metrics
+// that are not registered are not collected. availableCapacity is called on
+// every scrape.
+func registerMetrics(availableCapacity func() map[device.Services]int) {
+	registerMetricsOnce.Do(func() {
+		legacyregistry.CustomMustRegister(newAvailableVFsCollector(availableCapacity))
+	})
+}
@@ -19,6 +19,11 @@ package main
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
@@ -34,33 +39,43 @@ import (
 
 type nodeState struct {
 	*helpers.NodeState
+	// PF devices the allocatable VF devices belong to, for whole PF allocations.
+	pfDevices device.QATDevices
+	// verifyServices checks that a reconfigured PF device applied the services.
+	verifyServices func(vf *device.VFDevice) error
+	// deviceNodePermissions are set on the VF device nodes in CDI specs.
+	deviceNodePermissions helpers.DeviceNodePermissions
+	// wholePFAllocation announces the PF devices, consuming the same shared
+	// counters as their VFs.
+	wholePFAllocation bool
 }
 
-func newNodeState(detectedDevices device.VFDevices, cdiRoot string, preparedClaimFilePath string, nodeName string) (*nodeState, error) {
+func newNodeState(pfDevices device.QATDevices, detectedDevices device.VFDevices, cdiRoot string, preparedClaimFilePath string, nodeName string, cdiSyncTimeout time.Duration, deviceNodePermissions helpers.DeviceNodePermissions) (*nodeState, error) {
 	for ddev := range detectedDevices {
 		klog.V(3).Infof("new device: %+v", ddev)
 	}
 
 	klog.V(5).Info("Refreshing CDI registry")
 	if err := cdiapi.Configure(cdiapi.WithSpecDirs(cdiRoot)); err != nil {
-		return nil, fmt.Errorf("unable to refresh the CDI registry: %v", err)
+		return nil, helpers.NewCDIError(helpers.CDIRegistryRefreshFailed, "", err)
 	}
 
 	cdiCache := cdiapi.GetDefaultCache()
 
-	if err := cdihelpers.AddDetectedDevicesToCDIRegistry(cdiCache, detectedDevices); err != nil {
-		return nil, fmt.Errorf("cannot sync CDI devices: %v", err)
+	if err := cdihelpers.AddDetectedDevicesToCDIRegistry(cdiCache, detectedDevices, deviceNodePermissions); err != nil {
+		return nil, fmt.Errorf("cannot sync CDI devices: %w", err)
 	}
 
-	// hack for tests on slow machines
-	time.Sleep(250 * time.Millisecond)
+	if err := helpers.WaitForCDIDevices(cdiCache, device.CDIKind, slices.Collect(maps.Keys(detectedDevices)), cdiSyncTimeout); err != nil {
+		klog.Warningf("CDI cache not in sync with written CDI specs: %v", err)
+	}
 
 	klog.V(5).Info("Allocatable devices after CDI registry refresh:")
 	for duid, ddev := range detectedDevices {
 		klog.V(5).Infof("CDI device: %v : %+v", duid, ddev)
 	}
 
-	preparedClaims, err := helpers.GetOrCreatePreparedClaims(preparedClaimFilePath)
+	preparedClaims, preparedAt, err := helpers.GetOrCreatePreparedClaims(preparedClaimFilePath)
 	if err != nil {
 		klog.Errorf("Error getting prepared claims: %v", err)
 		return nil, fmt.Errorf("failed to get prepared claims: %v", err)
@@ -72,9 +87,13 @@ func newNodeState(detectedDevices device.VFDevices, cdiRoot string, preparedClai
 			CdiCache:               cdiCache,
 			Allocatable:            detectedDevices,
 			Prepared:               preparedClaims,
+			PreparedAt:             preparedAt,
 			PreparedClaimsFilePath: preparedClaimFilePath,
 			NodeName:               nodeName,
 		},
+		pfDevices:             pfDevices,
+		verifyServices:        (*device.VFDevice).VerifyServices,
+		deviceNodePermissions: deviceNodePermissions,
 	}
 
 	//nolint:forcetypeassert
@@ -83,15 +102,203 @@ func newNodeState(detectedDevices device.VFDevices, cdiRoot string, preparedClai
 		klog.V(5).Infof("Allocatable device: %v : %+v", duid, ddev)
 	}
 
+	if err := state.removeStaleCDIDevices(); err != nil {
+		klog.Errorf("failed to remove stale CDI devices: %v", err)
+	}
+
+	state.restoreAllocations()
+
 	return &state, nil
 }
 
-func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim) error {
+// restoreAllocations allocates the VF and PF devices of the claims prepared
+// before the driver restarted, so that they are not allocated to other claims.
+func (s *nodeState) restoreAllocations() {
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	for claimUID, prepareResult := range s.Prepared {
+		for _, preparedDevice := range prepareResult.Devices {
+			if pf := s.pfDevice(preparedDevice.DeviceName); pf != nil {
+				if _, err := pf.AllocateAll(claimUID); err != nil {
+					klog.Warningf("Could not restore allocation of device %s for claim '%s': %v", pf.UID(), claimUID, err)
+				}
+				continue
+			}
+
+			vf, found := allocatableDevices[preparedDevice.DeviceName]
+			if !found {
+				klog.Warningf("Device %s of prepared claim '%s' no longer exists, not restoring its allocation", preparedDevice.DeviceName, claimUID)
+				continue
+			}
+			if !vf.AllocateFromConfigured(device.Unset, claimUID) {
+				klog.Warningf("Could not restore allocation of device %s for claim '%s'", vf.UID(), claimUID)
+			}
+		}
+	}
+}
+
+// removeStaleCDIDevices removes QAT CDI devices that are not backed by an
+// allocatable VF or the VFIO control node.
+func (s *nodeState) removeStaleCDIDevices() error {
+	_, err := helpers.RemoveStaleCDIDevices(s.CdiCache, device.CDIKind, s.IsValidCDIDevice)
+
+	return err
+}
+
+// requestedDevice is a device allocated to a claim by the scheduler, with the
+// services requested for it in the claim configuration.
+type requestedDevice struct {
+	allocatedDevice resourcev1.DeviceRequestAllocationResult
+	services        device.Services
+}
+
+// Prepare allocates the devices of the claim atomically: the requests may ask
+// for different services, possibly on VFs of different PF devices, and if any
+// of them cannot be satisfied, all devices allocated so far are freed. Returns
+// true if allocating any of them changed the published resources, e.g. PF
+// device configuration, also when the claim could not be prepared.
+func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim) (bool, error) {
 	s.Lock()
 	defer s.Unlock()
 
+	requestedDevices, err := s.requestedDevices(claim)
+	if err != nil {
+		return false, err
+	}
+
+	// Devices of requests for particular services are allocated first, so that
+	// requests for any service do not take VFs of PF devices that have to be
+	// reconfigured for the others.
+	order := make([]int, len(requestedDevices))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return requestedDevices[order[i]].services != device.Unset && requestedDevices[order[j]].services == device.Unset
+	})
+
 	preparedDevices := kubeletplugin.PrepareResult{}
+	if len(requestedDevices) > 0 {
+		preparedDevices.Devices = make([]kubeletplugin.Device, len(requestedDevices))
+	}
+	updated := false
+	for _, idx := range order {
+		newDevice, deviceUpdated, err := s.prepareDevice(requestedDevices[idx], string(claim.UID))
+		updated = updated || deviceUpdated
+		if err != nil {
+			s.freeClaimDevices(string(claim.UID))
+			return updated, err
+		}
+		preparedDevices.Devices[idx] = newDevice
+	}
+
+	s.AddPreparedClaim(string(claim.UID), preparedDevices)
+
+	if err := s.WritePreparedClaims(); err != nil {
+		klog.Errorf("failed to write prepared claims to file: %v", err)
+		return updated, fmt.Errorf("failed to write prepared claims to file: %v", err)
+	}
+
+	klog.V(5).Infof("Created prepared claim %v allocation", claim.UID)
+	return updated, nil
+}
+
+// batchReconfiguration collects the services requested from a PF device by
+// claims prepared together.
+type batchReconfiguration struct {
+	services  device.Services
+	claimUIDs []string
+	vf        *device.VFDevice // any requested VF, to verify the services with
+}
+
+// reconfigureForBatch changes the services of each PF device once for all the
+// services its VFs are requested for by the claims, instead of reconfiguring
+// it for the first claim and failing the others. The claims are prepared one
+// by one afterwards as usual. The returned function returns PF devices none of
+// whose VFs ended up allocated to their previous services. Returns true if any
+// PF device was reconfigured.
+func (s *nodeState) reconfigureForBatch(claims []*resourcev1.ResourceClaim) (func(), bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	batch := map[*device.PFDevice]*batchReconfiguration{}
+	for _, claim := range claims {
+		if _, prepared := s.Prepared[string(claim.UID)]; prepared || claim.Status.Allocation == nil {
+			continue
+		}
+		// Invalid claims fail when they are prepared.
+		requestedDevices, err := s.requestedDevices(claim)
+		if err != nil {
+			continue
+		}
+
+		for _, requested := range requestedDevices {
+			vf, found := allocatableDevices[requested.allocatedDevice.Device]
+			if !found || requested.services == device.Unset {
+				continue
+			}
+
+			pf := vf.PFDevice()
+			if batch[pf] == nil {
+				batch[pf] = &batchReconfiguration{vf: vf}
+			}
+			batch[pf].services |= requested.services
+			if !slices.Contains(batch[pf].claimUIDs, string(claim.UID)) {
+				batch[pf].claimUIDs = append(batch[pf].claimUIDs, string(claim.UID))
+			}
+		}
+	}
+
+	type restore struct {
+		pf        *device.PFDevice
+		services  device.Services
+		claimUIDs []string
+	}
+	restores := []restore{}
+	for _, pf := range s.pfDevices {
+		reconfiguration, found := batch[pf]
+		// A single service is configured by preparing the first claim.
+		if !found || len(reconfiguration.claimUIDs) < 2 ||
+			reconfiguration.services&(reconfiguration.services-1) == 0 ||
+			pf.Services.Supports(reconfiguration.services) {
+			continue
+		}
+
+		previous := pf.Services
+		if err := pf.ReconfigureForClaims(reconfiguration.services, reconfiguration.claimUIDs); err != nil {
+			klog.V(5).Infof("Not reconfiguring PF device '%s' for claims %v together: %v", pf.Device, reconfiguration.claimUIDs, err)
+			continue
+		}
+
+		// The claims are then prepared as if there was no batch.
+		if err := s.verifyServices(reconfiguration.vf); err != nil {
+			klog.Warningf("Reconfiguration of PF device '%s' for claims %v was not applied: %v", pf.Device, reconfiguration.claimUIDs, err)
+			if err := pf.RestoreServices(previous, reconfiguration.claimUIDs); err != nil {
+				klog.Warningf("Could not restore services '%s' of PF device '%s': %v", previous.String(), pf.Device, err)
+			}
+			continue
+		}
 
+		restores = append(restores, restore{pf: pf, services: previous, claimUIDs: reconfiguration.claimUIDs})
+	}
+
+	return func() {
+		s.Lock()
+		defer s.Unlock()
+
+		for _, r := range restores {
+			if err := r.pf.RestoreServices(r.services, r.claimUIDs); err != nil {
+				klog.Warningf("Could not restore services '%s' of PF device '%s': %v", r.services.String(), r.pf.Device, err)
+			}
+		}
+	}, len(restores) > 0
+}
+
+// requestedDevices returns the devices allocated to the claim from this node
+// with their requested services. Nothing is allocated, so invalid claim
+// configuration fails the claim without side effects.
+func (s *nodeState) requestedDevices(claim *resourcev1.ResourceClaim) ([]requestedDevice, error) {
+	requestedDevices := []requestedDevice{}
 	for _, allocatedDevice := range claim.Status.Allocation.Devices.Results {
 		if allocatedDevice.Driver != device.DriverName || allocatedDevice.Pool != s.NodeName {
 			klog.V(5).Infof("Driver/pool '%s/%s' not handled by driver (%s/%s)",
@@ -101,46 +308,174 @@ func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim
 			continue
 		}
 
-		requestedDeviceUID := allocatedDevice.Device
-		klog.V(5).Infof("Requested device UID '%s'", requestedDeviceUID)
+		services, err := requestedServices(claim, allocatedDevice.Request)
+		if err != nil {
+			return nil, err
+		}
+
+		requestedDevices = append(requestedDevices, requestedDevice{allocatedDevice: allocatedDevice, services: services})
+	}
+
+	return requestedDevices, nil
+}
+
+// prepareDevice allocates the requested VF or PF device for the claim.
+// Returns true if the services of the PF device were reconfigured.
+func (s *nodeState) prepareDevice(requested requestedDevice, claimUID string) (kubeletplugin.Device, bool, error) {
+	allocatedDevice := requested.allocatedDevice
+	requestedDeviceUID := allocatedDevice.Device
+	klog.V(5).Infof("Requested device UID '%s'", requestedDeviceUID)
+
+	if pf := s.pfDevice(requestedDeviceUID); pf != nil && s.wholePFAllocation {
+		preparedDevice, err := s.preparePF(pf, requested.services, allocatedDevice, claimUID)
+		return preparedDevice, false, err
+	}
+
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	allocatableDevice, found := allocatableDevices[requestedDeviceUID]
+	if !found {
+		return kubeletplugin.Device{}, false, fmt.Errorf("could not find allocatable device %v (pool %v)", allocatedDevice.Device, allocatedDevice.Pool)
+	}
+
+	if !allocatableDevice.Healthy() {
+		return kubeletplugin.Device{}, false, fmt.Errorf("could not allocate device '%s' for claim '%s': PF device is unhealthy", requestedDeviceUID, claimUID)
+	}
+
+	controlDeviceNode, err := device.GetControlNode()
+	if err != nil {
+		return kubeletplugin.Device{}, false, fmt.Errorf("could not allocate device '%s' for claim '%s': %v", requestedDeviceUID, claimUID, err)
+	}
+
+	_, updated, err := s.Allocate(requestedDeviceUID, requested.services, claimUID)
+	if err != nil {
+		return kubeletplugin.Device{}, false, fmt.Errorf("could not allocate device '%s' for claim '%s': %v", requestedDeviceUID, claimUID, err)
+	}
+
+	cdiDeviceName := allocatableDevice.CDIName()
+	controlDeviceName := device.CDIKind + "=" + controlDeviceNode.UID()
+	klog.V(5).Infof("Allocated CDI devices '%s' and '%s' for claim '%s'", cdiDeviceName, controlDeviceName, claimUID)
+
+	return kubeletplugin.Device{
+		Requests:     []string{allocatedDevice.Request},
+		PoolName:     allocatedDevice.Pool,
+		DeviceName:   requestedDeviceUID,
+		CDIDeviceIDs: []string{cdiDeviceName, controlDeviceName},
+	}, updated, nil
+}
+
+// preparePF allocates all VF devices of the PF device for the claim.
+func (s *nodeState) preparePF(pf *device.PFDevice, services device.Services, allocatedDevice resourcev1.DeviceRequestAllocationResult, claimUID string) (kubeletplugin.Device, error) {
+	if pf.Unhealthy {
+		return kubeletplugin.Device{}, fmt.Errorf("could not allocate device '%s' for claim '%s': PF device is unhealthy", pf.UID(), claimUID)
+	}
+	if services != device.Unset && !pf.Services.Supports(services) {
+		return kubeletplugin.Device{}, fmt.Errorf("could not allocate device '%s' for claim '%s': PF device does not provide service '%s'", pf.UID(), claimUID, services.String())
+	}
+
+	controlDeviceNode, err := device.GetControlNode()
+	if err != nil {
+		return kubeletplugin.Device{}, fmt.Errorf("could not allocate device '%s' for claim '%s': %v", pf.UID(), claimUID, err)
+	}
+
+	vfdevices, err := pf.AllocateAll(claimUID)
+	if err != nil {
+		return kubeletplugin.Device{}, fmt.Errorf("could not allocate device '%s' for claim '%s': %v", pf.UID(), claimUID, err)
+	}
+
+	cdiDeviceNames := []string{}
+	for _, vf := range vfdevices {
+		cdiDeviceNames = append(cdiDeviceNames, vf.CDIName())
+	}
+	sort.Strings(cdiDeviceNames)
+
+	cdiDeviceNames = append(cdiDeviceNames, device.CDIKind+"="+controlDeviceNode.UID())
+	klog.V(5).Infof("Allocated CDI devices '%v' for claim '%s'", cdiDeviceNames, claimUID)
+
+	return kubeletplugin.Device{
+		Requests:     []string{allocatedDevice.Request},
+		PoolName:     allocatedDevice.Pool,
+		DeviceName:   pf.UID(),
+		CDIDeviceIDs: cdiDeviceNames,
+	}, nil
+}
+
+// checkPFHealth checks health of all PF devices, returns true if health of any
+// PF device changed.
+func (s *nodeState) checkPFHealth() bool {
+	changed := false
+	for _, pf := range s.pfDevices {
+		if pf.CheckHealth() {
+			klog.Infof("PF device '%s' health changed, unhealthy: %v", pf.Device, pf.Unhealthy)
+			changed = true
+		}
+	}
+
+	return changed
+}
 
-		allocatableDevices, _ := s.Allocatable.(device.VFDevices)
-		allocatableDevice, found := allocatableDevices[requestedDeviceUID]
-		if !found {
-			return fmt.Errorf("could not find allocatable device %v (pool %v)", allocatedDevice.Device, allocatedDevice.Pool)
+// checkVFBinding re-reads the driver binding of the allocatable VFs and of the
+// unallocated VFs of the PF devices. Returns true if the binding of any VF
+// changed.
+func (s *nodeState) checkVFBinding() bool {
+	changed := false
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	for _, vf := range allocatableDevices {
+		if vf.CheckBinding() {
+			klog.Infof("VF device '%s' binding changed, bound: %v", vf.UID(), vf.Bound())
+			changed = true
 		}
+	}
+	for _, pf := range s.pfDevices {
+		if pf.CheckBinding() {
+			changed = true
+		}
+	}
 
-		if _, _, err := s.Allocate(requestedDeviceUID, device.Unset, string(claim.UID)); err != nil {
-			for _, vf := range allocatableDevices {
-				_, _ = vf.Free(string(claim.UID))
-			}
-			return fmt.Errorf("could not allocate device '%s' for claim '%s': %v", requestedDeviceUID, claim.UID, err)
+	return changed
+}
+
+// pfDevice returns the PF device with given UID, or nil if there is none.
+func (s *nodeState) pfDevice(uid string) *device.PFDevice {
+	for _, pf := range s.pfDevices {
+		if pf.UID() == uid {
+			return pf
 		}
+	}
+	return nil
+}
 
-		cdiDeviceName := allocatableDevice.CDIName()
-		controlDeviceNode, _ := device.GetControlNode()
-		controlDeviceName := device.CDIKind + "=" + controlDeviceNode.UID()
-		klog.V(5).Infof("Allocated CDI devices '%s' and '%s' for claim '%s'", cdiDeviceName, controlDeviceName, claim.GetUID())
+// claimServices returns comma-separated services of the prepared devices.
+func (s *nodeState) claimServices(prepareResult kubeletplugin.PrepareResult) string {
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	services := []string{}
+	for _, preparedDevice := range prepareResult.Devices {
+		deviceServices := ""
+		if vf, found := allocatableDevices[preparedDevice.DeviceName]; found {
+			deviceServices = vf.Services()
+		} else if pf := s.pfDevice(preparedDevice.DeviceName); pf != nil {
+			deviceServices = pf.Services.String()
+		}
 
-		// add device
-		newDevice := kubeletplugin.Device{
-			Requests:     []string{allocatedDevice.Request},
-			PoolName:     allocatedDevice.Pool,
-			DeviceName:   requestedDeviceUID,
-			CDIDeviceIDs: []string{cdiDeviceName, controlDeviceName},
+		if deviceServices != "" && !slices.Contains(services, deviceServices) {
+			services = append(services, deviceServices)
 		}
-		preparedDevices.Devices = append(preparedDevices.Devices, newDevice)
 	}
 
-	s.Prepared[string(claim.UID)] = preparedDevices
+	return strings.Join(services, ",")
+}
 
-	if err := helpers.WritePreparedClaimsToFile(s.PreparedClaimsFilePath, s.Prepared); err != nil {
-		klog.Errorf("failed to write prepared claims to file: %v", err)
-		return fmt.Errorf("failed to write prepared claims to file: %v", err)
+// freeClaimDevices frees all VF devices allocated for the claim.
+func (s *nodeState) freeClaimDevices(claimUID string) {
+	for _, pf := range s.pfDevices {
+		if _, allocated := pf.AllocatedDevices[claimUID]; allocated {
+			_, _ = pf.FreeAll(claimUID)
+		}
 	}
 
-	klog.V(5).Infof("Created prepared claim %v allocation", claim.UID)
-	return nil
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	for _, vf := range allocatableDevices {
+		_, _ = vf.Free(claimUID)
+	}
 }
 
 func (s *nodeState) Allocate(requestedDeviceUID string, requestedService device.Services, requestedBy string) (*device.VFDevice, bool, error) {
@@ -152,52 +487,195 @@ func (s *nodeState) Allocate(requestedDeviceUID string, requestedService device.
 		return allocatableDevice, false, nil
 	}
 
-	if allocatableDevice.AllocateFromConfigured(requestedService, requestedBy) {
-		return allocatableDevice, false, nil
+	// Device already configured with other services can only be used when no particular service is requested.
+	if requestedService == device.Unset || allocatableDevice.Supports(requestedService) {
+		if allocatableDevice.AllocateFromConfigured(requestedService, requestedBy) {
+			return allocatableDevice, false, nil
+		}
 	}
 
 	if allocatableDevice.AllocateWithReconfiguration(requestedService, requestedBy) {
+		if err := s.verifyServices(allocatableDevice); err != nil {
+			// Freeing the only allocated VF sets the PF device back to unconfigured state.
+			if _, freeErr := allocatableDevice.Free(requestedBy); freeErr != nil {
+				klog.Warningf("Could not roll back allocation of device '%s': %v", requestedDeviceUID, freeErr)
+			}
+			return nil, false, fmt.Errorf("reconfiguration of device '%s' to service '%s' was not applied: %v", requestedDeviceUID, requestedService.String(), err)
+		}
 		return allocatableDevice, true, nil
 	}
 
 	return nil, false, fmt.Errorf("could not allocate device '%s', service '%s' from any device", requestedDeviceUID, requestedService.String())
 }
 
+// Unprepare frees all devices of the claim, and returns true if freeing any
+// of them changed the published resources, e.g. PF device configuration.
+// The caller must hold the lock.
 func (s *nodeState) Unprepare(ctx context.Context, claim kubeletplugin.NamespacedObject) (bool, error) {
+	preparedDevices := s.Prepared[string(claim.UID)].Devices
+	if err := s.RemovePreparedClaim(string(claim.UID)); err != nil {
+		return false, fmt.Errorf("error unpreparing claim %s: %v", claim.UID, err)
+	}
 
-	for _, requestedDevice := range s.Prepared[string(claim.UID)].Devices {
-		allocatableDevices, _ := s.Allocatable.(device.VFDevices)
-		requestedDevice := allocatableDevices[requestedDevice.DeviceName]
-
-		var updated bool
+	updated := false
+	for _, preparedDevice := range preparedDevices {
+		var deviceUpdated bool
 		var err error
 
-		if err = s.NodeState.Unprepare(ctx, string(claim.UID)); err != nil {
-			return false, fmt.Errorf("error unpreparing claim %s: %v", claim.UID, err)
+		if pf := s.pfDevice(preparedDevice.DeviceName); pf != nil {
+			if deviceUpdated, err = pf.FreeAll(string(claim.UID)); err != nil {
+				klog.Warningf("Could not free device %s claim '%s': %v", pf.UID(), claim.UID, err)
+			}
+		} else {
+			allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+			requestedDevice, found := allocatableDevices[preparedDevice.DeviceName]
+			if !found || requestedDevice == nil {
+				// The device was removed after the claim was prepared, nothing to free.
+				klog.Warningf("Device %s of claim '%s' no longer exists, skipping", preparedDevice.DeviceName, claim.UID)
+				continue
+			}
+			if deviceUpdated, err = requestedDevice.Free(string(claim.UID)); err != nil {
+				klog.Warningf("Could not free device %s claim '%s': %v", requestedDevice.UID(), claim.UID, err)
+			}
 		}
+		updated = updated || deviceUpdated
+	}
+	klog.V(5).Infof("Claim with uid '%s' freed", claim.UID)
+
+	return updated, nil
+}
+
+// Snapshot returns the current node state for debugging.
+func (s *nodeState) Snapshot() helpers.NodeStateSnapshot {
+	return s.NodeState.Snapshot(s)
+}
+
+// AllocatableDevices implements helpers.SnapshotAdapter.
+func (s *nodeState) AllocatableDevices() []helpers.DeviceSnapshot {
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	devices := []helpers.DeviceSnapshot{}
+	for uid, vf := range allocatableDevices {
+		devices = append(devices, helpers.DeviceSnapshot{
+			UID: uid,
+			Attributes: map[string]string{
+				"services": vf.Services(),
+				"healthy":  strconv.FormatBool(vf.Healthy()),
+			},
+		})
+	}
+
+	for _, pf := range s.pfDevices {
+		devices = append(devices, helpers.DeviceSnapshot{
+			UID: pf.UID(),
+			Attributes: map[string]string{
+				"services": pf.Services.String(),
+				"state":    pf.State.String(),
+				"vfCount":  strconv.Itoa(pf.VFCount()),
+				"healthy":  strconv.FormatBool(!pf.Unhealthy),
+			},
+		})
+	}
+
+	return devices
+}
 
-		if updated, err = requestedDevice.Free(string(claim.UID)); err != nil {
-			klog.Warningf("Could not free device %s claim '%s': %v", requestedDevice.UID(), claim.UID, err)
+// Allocations implements helpers.SnapshotAdapter, returns VF devices
+// allocated on PF devices.
+func (s *nodeState) Allocations() map[string][]string {
+	allocations := map[string][]string{}
+	for _, pf := range s.pfDevices {
+		for claimUID, vfdevices := range pf.AllocatedDevices {
+			for uid := range vfdevices {
+				allocations[claimUID] = append(allocations[claimUID], uid)
+			}
 		}
-		klog.V(5).Infof("Claim with uid '%s' freed", claim.UID)
+	}
 
-		if updated {
-			return updated, nil
+	return allocations
+}
+
+// Topology returns the PF and VF devices with their location on the node.
+func (s *nodeState) Topology() helpers.Topology {
+	s.Lock()
+	defer s.Unlock()
+
+	devices := []helpers.TopologyDevice{}
+	for _, pf := range s.pfDevices {
+		pfDevice := helpers.TopologyDevice{
+			UID:        pf.UID(),
+			PCIAddress: pf.Device,
+			PCIRoot:    pf.PCIRoot(),
+			NUMANode:   pf.NUMANode(),
+			Services:   pf.Services.String(),
+		}
+		devices = append(devices, pfDevice)
+
+		vfdevices := maps.Clone(pf.AvailableDevices)
+		for _, allocated := range pf.AllocatedDevices {
+			maps.Copy(vfdevices, allocated)
+		}
+		for uid, vf := range vfdevices {
+			devices = append(devices, helpers.TopologyDevice{
+				UID:        uid,
+				PCIAddress: vf.PCIDevice(),
+				PCIRoot:    pfDevice.PCIRoot,
+				NUMANode:   pfDevice.NUMANode,
+				ParentUID:  pfDevice.UID,
+				Services:   pfDevice.Services,
+			})
 		}
 	}
-	return false, nil
 
+	return helpers.NewTopology(s.NodeName, devices)
+}
+
+// deviceParents returns the PF device names of the VF devices, mapped by VF
+// device name.
+func (s *nodeState) deviceParents() map[string]string {
+	s.Lock()
+	defer s.Unlock()
+
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	parents := map[string]string{}
+	for uid, vf := range allocatableDevices {
+		parents[uid] = vf.PFDevice().UID()
+	}
+
+	return parents
+}
+
+// availableCapacity returns per service the number of VFs that could be
+// allocated for it right now.
+func (s *nodeState) availableCapacity() map[device.Services]int {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.pfDevices.AvailableCapacity()
 }
 
 func (s *nodeState) GetResources() resourceslice.DriverResources {
+	s.Lock()
+	defer s.Unlock()
+
 	//nolint:forcetypeassert // We want the code to panic if our assumption turns out to be wrong.
 	allocatableDevices := s.Allocatable.(device.VFDevices)
 	klog.V(5).Infof("allocatable devices in GetResources: %v", allocatableDevices)
+
+	if !s.wholePFAllocation {
+		return resourceslice.DriverResources{
+			Pools: map[string]resourceslice.Pool{
+				s.NodeName: {
+					Slices: []resourceslice.Slice{{
+						Devices: *deviceResources(allocatableDevices, false),
+					}}}},
+		}
+	}
+
+	devices := append(*deviceResources(allocatableDevices, true), pfDeviceResources(s.pfDevices)...)
 	return resourceslice.DriverResources{
 		Pools: map[string]resourceslice.Pool{
 			s.NodeName: {
-				Slices: []resourceslice.Slice{{
-					Devices: *deviceResources(allocatableDevices),
-				}}}},
+				Slices: counterSlices(devices, pfCounterSets(s.pfDevices)),
+			}},
 	}
 }
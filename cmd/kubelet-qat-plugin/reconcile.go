@@ -0,0 +1,91 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/cdihelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
+)
+
+// reconcileCDI repairs drift between prepared claims and QAT CDI specs.
+func (s *nodeState) reconcileCDI() (helpers.ReconcileResult, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return helpers.ReconcileCDI(s.CdiCache, device.CDIKind, s)
+}
+
+// PreparedCDIDevices implements helpers.ReconcileAdapter. The VFIO control
+// node is not part of the QAT CDI specs, so it is left out.
+func (s *nodeState) PreparedCDIDevices() map[string][]string {
+	controlDeviceName := ""
+	if controlDeviceNode, err := device.GetControlNode(); err == nil {
+		controlDeviceName = device.CDIKind + "=" + controlDeviceNode.UID()
+	}
+
+	cdiDevices := map[string][]string{}
+	for claimUID, prepareResult := range s.Prepared {
+		for _, preparedDevice := range prepareResult.Devices {
+			for _, cdiDevice := range preparedDevice.CDIDeviceIDs {
+				if cdiDevice != controlDeviceName {
+					cdiDevices[claimUID] = append(cdiDevices[claimUID], cdiDevice)
+				}
+			}
+		}
+	}
+
+	return cdiDevices
+}
+
+// PreparedClaimBacked implements helpers.ReconcileAdapter.
+func (s *nodeState) PreparedClaimBacked(claimUID string) bool {
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	for _, preparedDevice := range s.Prepared[claimUID].Devices {
+		_, isVF := allocatableDevices[preparedDevice.DeviceName]
+		if !isVF && s.pfDevice(preparedDevice.DeviceName) == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RecreateCDIDevices implements helpers.ReconcileAdapter. QAT CDI devices do
+// not depend on claims, so all of them are written again.
+func (s *nodeState) RecreateCDIDevices(claimUID string, missing []string) error {
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	if err := cdihelpers.AddDetectedDevicesToCDIRegistry(s.CdiCache, allocatableDevices, s.deviceNodePermissions); err != nil {
+		return fmt.Errorf("could not write CDI devices of claim %v: %w", claimUID, err)
+	}
+
+	return nil
+}
+
+// DropPreparedClaim implements helpers.ReconcileAdapter.
+func (s *nodeState) DropPreparedClaim(claimUID string) error {
+	s.freeClaimDevices(claimUID)
+	delete(s.Prepared, claimUID)
+
+	if err := s.WritePreparedClaims(); err != nil {
+		return fmt.Errorf("failed to write prepared claims to file: %v", err)
+	}
+
+	return nil
+}
+
+// IsValidCDIDevice implements helpers.ReconcileAdapter, QAT CDI devices are
+// valid when backed by an allocatable VF or the VFIO control node.
+func (s *nodeState) IsValidCDIDevice(deviceName string) bool {
+	allocatableDevices, _ := s.Allocatable.(device.VFDevices)
+	if _, found := allocatableDevices[deviceName]; found {
+		return true
+	}
+
+	controlDeviceNode, err := device.GetControlNode()
+	return err == nil && deviceName == controlDeviceNode.UID()
+}
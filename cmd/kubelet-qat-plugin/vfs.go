@@ -0,0 +1,133 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
+)
+
+// readVFsEnabledByDriver returns the PCI addresses of the PF devices listed in
+// the file, or none if the file does not exist.
+func readVFsEnabledByDriver(filePath string) ([]string, error) {
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %v: %v", filePath, err)
+	}
+
+	pfAddresses := []string{}
+	if err := json.Unmarshal(data, &pfAddresses); err != nil {
+		return nil, fmt.Errorf("could not parse %v: %v", filePath, err)
+	}
+
+	return pfAddresses, nil
+}
+
+// writeVFsEnabledByDriver writes the PCI addresses of the PF devices with VFs
+// enabled by this driver to the file.
+func writeVFsEnabledByDriver(filePath string, pfdevices device.QATDevices) error {
+	pfAddresses := []string{}
+	for _, pf := range pfdevices {
+		if pf.VFsEnabledByDriver {
+			pfAddresses = append(pfAddresses, pf.Device)
+		}
+	}
+
+	data, err := json.MarshalIndent(pfAddresses, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode PF devices: %v", err)
+	}
+
+	// Not skipped when prepared claims are kept in memory, so that a failure
+	// to keep track of the VFs over restarts is reported.
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		return fmt.Errorf("could not write %v: %v", filePath, err)
+	}
+
+	return nil
+}
+
+// enableVFs enables the VFs of the writable PF devices, records the ones the
+// driver enabled and applies the default service configuration.
+func enableVFs(filePath string, nodeName string, pfdevices device.QATDevices) error {
+	restoreVFsEnabledByDriver(filePath, pfdevices)
+	writablePFDevices := preflightPFDevices(pfdevices)
+	for _, pf := range writablePFDevices {
+		if err := pf.EnableVFs(); err != nil {
+			return fmt.Errorf("cannot enable PF device '%s': %v", pf.Device, err)
+		}
+	}
+	if err := writeVFsEnabledByDriver(filePath, pfdevices); err != nil {
+		klog.Warningf("Cannot save PF devices with VFs enabled by the driver: %v", err)
+	}
+	if err := getDefaultConfiguration(nodeName, writablePFDevices); err != nil {
+		klog.Warningf("Cannot apply default configuration: %v", err)
+	}
+
+	return nil
+}
+
+// restoreVFsEnabledByDriver marks the PF devices whose VFs a previous driver
+// instance enabled, so they are disabled on shutdown even after the driver
+// crashed and was restarted.
+func restoreVFsEnabledByDriver(filePath string, pfdevices device.QATDevices) {
+	pfAddresses, err := readVFsEnabledByDriver(filePath)
+	if err != nil {
+		klog.Warningf("Cannot restore PF devices with VFs enabled by the driver: %v", err)
+		return
+	}
+
+	for _, pf := range pfdevices {
+		if slices.Contains(pfAddresses, pf.Device) {
+			klog.V(3).Infof("VFs of PF device '%s' were enabled by the driver", pf.Device)
+			pf.VFsEnabledByDriver = true
+		}
+	}
+}
+
+// disableVFs disables the VFs this driver enabled. VFs enabled by the operator
+// are kept. With prepared claims, the VFs are only disabled when forced, after
+// freeing the devices of the claims.
+func (d *driver) disableVFs() {
+	d.state.Lock()
+	defer d.state.Unlock()
+
+	if len(d.state.Prepared) > 0 {
+		if !d.forceDisableVFs {
+			klog.Infof("Keeping VFs enabled, %d claims are prepared", len(d.state.Prepared))
+			return
+		}
+
+		klog.Warningf("Disabling VFs with %d claims prepared, freeing their devices", len(d.state.Prepared))
+		for claimUID := range d.state.Prepared {
+			d.state.freeClaimDevices(claimUID)
+			delete(d.state.Prepared, claimUID)
+		}
+		if err := d.state.WritePreparedClaims(); err != nil {
+			klog.Errorf("failed to write prepared claims to file: %v", err)
+		}
+	}
+
+	for _, pf := range d.state.pfDevices {
+		if err := pf.DisableVFs(); err != nil {
+			klog.Warningf("Could not disable VFs of PF device '%s': %v", pf.Device, err)
+			continue
+		}
+		klog.V(3).Infof("Disabled VFs of PF device '%s'", pf.Device)
+	}
+
+	if err := writeVFsEnabledByDriver(d.vfsEnabledFilePath, d.state.pfDevices); err != nil {
+		klog.Warningf("Cannot save PF devices with VFs enabled by the driver: %v", err)
+	}
+}
@@ -5,8 +5,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
 )
 
@@ -23,7 +25,7 @@ func printPFDevice(pfdev *device.PFDevice) {
 }
 
 func main() {
-	pfdevices, err := device.New()
+	pfdevices, err := device.New(context.Background(), helpers.DefaultDiscoveryTimeout)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
@@ -86,16 +86,28 @@ func setupPCIDevice(sysfsRoot string, gaudi *device.DeviceInfo) error {
 		return fmt.Errorf("writing PCI device file: %v", writeErr)
 	}
 
+	// /sys/devices/<pciRoot>/<pciAddress>/vendor
+	if writeErr := helpers.WriteFile(path.Join(pciDevDir, "vendor"), helpers.HabanaPCIVendorID); writeErr != nil {
+		return fmt.Errorf("writing PCI device file: %v", writeErr)
+	}
+
 	// /sys/devices/<pciRoot>/<pciAddress>/pci_addr
 	if writeErr := helpers.WriteFile(path.Join(pciDevDir, "pci_addr"), gaudi.PCIAddress); writeErr != nil {
 		return fmt.Errorf("writing PCI device file: %v", writeErr)
 	}
 
 	// /sys/devices/<pciRoot>/<pciAddress>/module_id
-	if writeErr := helpers.WriteFile(path.Join(pciDevDir, "module_id"), fmt.Sprintf("%v", gaudi.DeviceIdx)); writeErr != nil {
+	if writeErr := helpers.WriteFile(path.Join(pciDevDir, "module_id"), fmt.Sprintf("%v", gaudi.ModuleIdx)); writeErr != nil {
 		return fmt.Errorf("creating PCI device file: %v", writeErr)
 	}
 
+	// /sys/devices/<pciRoot>/<pciAddress>/serial_number
+	if gaudi.Serial != "" {
+		if writeErr := helpers.WriteFile(path.Join(pciDevDir, "serial_number"), gaudi.Serial); writeErr != nil {
+			return fmt.Errorf("creating PCI device file: %v", writeErr)
+		}
+	}
+
 	// driver -> /sys/bus/pci/drivers/habanalabs
 	// relative from /sys/devices/pci0000:15/0000:19:00.0/.
 	driverDeviceLinkSource := path.Join(pciDevDir, "driver")
@@ -32,11 +32,12 @@ import (
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
 
+// countVFs returns the amount of VFs in devices, mapped by parent UID.
 func countVFs(devices device.DevicesInfo) map[string]int {
 	perDeviceNumvfs := map[string]int{}
-	for deviceUID, gpu := range devices {
+	for _, gpu := range devices {
 		if gpu.DeviceType == device.VfDeviceType {
-			perDeviceNumvfs[deviceUID] += 1
+			perDeviceNumvfs[gpu.ParentUID] += 1
 		}
 	}
 	return perDeviceNumvfs
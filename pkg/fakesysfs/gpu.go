@@ -22,6 +22,7 @@ import (
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
@@ -89,7 +90,12 @@ func fakeSysfsPF(deviceUID string, gpu *device.DeviceInfo, numvfs int, i915DevDi
 
 	writeErr1 := helpers.WriteFile(path.Join(i915DevDir, "sriov_numvfs"), fmt.Sprint(numvfs))
 	writeErr2 := helpers.WriteFile(path.Join(i915DevDir, "sriov_totalvfs"), fmt.Sprint(gpu.MaxVFs))
-	writeErr3 := helpers.WriteFile(path.Join(i915DevDir, "sriov_drivers_autoprobe"), "1")
+	// Autoprobe is enabled unless the device is explicitly SR-IOV capable without it.
+	autoprobe := "1"
+	if gpu.SRIOVCapable && !gpu.Autoprobe {
+		autoprobe = "0"
+	}
+	writeErr3 := helpers.WriteFile(path.Join(i915DevDir, "sriov_drivers_autoprobe"), autoprobe)
 
 	if writeErr1 != nil || writeErr2 != nil || writeErr3 != nil {
 		return fmt.Errorf("creating fake sysfs, err(s): '%v', '%v', '%v'", writeErr1, writeErr2, writeErr3)
@@ -164,6 +170,14 @@ func fakeGpuDRI(sysfsRoot string, devfsRoot string, gpu *device.DeviceInfo, i915
 		return fmt.Errorf("creating fake sysfs, err: %v", writeErr)
 	}
 
+	if err := fakeGpuFrequencies(gpu, i915DevDir, drmDirLinkTarget); err != nil {
+		return fmt.Errorf("creating fake sysfs, err: %v", err)
+	}
+
+	if err := fakeGpuDisplayConnector(gpu, drmDirLinkTarget); err != nil {
+		return fmt.Errorf("creating fake sysfs, err: %v", err)
+	}
+
 	if err := os.MkdirAll(path.Join(devfsRoot, "dri/by-path"), 0750); err != nil {
 		return fmt.Errorf("creating card symlink, err: %v", err)
 	}
@@ -277,6 +291,18 @@ func fakeSysFsGpuDevices(sysfsRoot string, devfsRoot string, gpus device.Devices
 			return fmt.Errorf("creating fake sysfs driver device contents, err: %v", writeErr)
 		}
 
+		if writeErr := helpers.WriteFile(path.Join(driverDeviceDir, "vendor"), helpers.IntelPCIVendorID); writeErr != nil {
+			return fmt.Errorf("creating fake sysfs driver device contents, err: %v", writeErr)
+		}
+
+		if err := fakeGpuPCIIdentity(gpu, driverDeviceDir); err != nil {
+			return fmt.Errorf("creating fake sysfs driver device contents, err: %v", err)
+		}
+
+		if err := fakeGpuPowerLimit(gpu, driverDeviceDir); err != nil {
+			return fmt.Errorf("creating fake sysfs hwmon contents, err: %v", err)
+		}
+
 		if err := fakeGpuDRI(sysfsRoot, devfsRoot, gpu, driverDeviceDir, realDevices); err != nil {
 			return fmt.Errorf("creating fake sysfs DRI devices, err: %v", err)
 		}
@@ -296,6 +322,89 @@ func fakeSysFsGpuDevices(sysfsRoot string, devfsRoot string, gpus device.Devices
 	return fakeSysfsSRIOVContents(sysfsRoot, gpus)
 }
 
+// fakeGpuPCIIdentity writes PCI subsystem ID and serial number files, when
+// the GPU has them set.
+func fakeGpuPCIIdentity(gpu *device.DeviceInfo, driverDeviceDir string) error {
+	if gpu.SubsystemID != "" {
+		subsystemVendor, subsystemDevice, found := strings.Cut(gpu.SubsystemID, ":")
+		if !found {
+			return fmt.Errorf("invalid subsystem ID %v, expected vendor:device", gpu.SubsystemID)
+		}
+		if writeErr := helpers.WriteFile(path.Join(driverDeviceDir, "subsystem_vendor"), subsystemVendor); writeErr != nil {
+			return writeErr
+		}
+		if writeErr := helpers.WriteFile(path.Join(driverDeviceDir, "subsystem_device"), subsystemDevice); writeErr != nil {
+			return writeErr
+		}
+	}
+
+	if gpu.Serial != "" {
+		return helpers.WriteFile(path.Join(driverDeviceDir, "serial_number"), gpu.Serial)
+	}
+
+	return nil
+}
+
+// fakeGpuPowerLimit writes hwmon power limit file in microwatts, when the GPU
+// has power limit set.
+func fakeGpuPowerLimit(gpu *device.DeviceInfo, driverDeviceDir string) error {
+	if gpu.PowerLimitW == 0 {
+		return nil
+	}
+
+	hwmonDir := path.Join(driverDeviceDir, "hwmon", "hwmon2")
+	if err := os.MkdirAll(hwmonDir, 0750); err != nil {
+		return fmt.Errorf("creating directory %v: %v", hwmonDir, err)
+	}
+
+	return helpers.WriteFile(path.Join(hwmonDir, "power1_max"), fmt.Sprint(gpu.PowerLimitW*1000000))
+}
+
+// fakeGpuDisplayConnector writes a DisplayPort connector of physical GPUs,
+// connected when the GPU has an active display, disconnected otherwise.
+func fakeGpuDisplayConnector(gpu *device.DeviceInfo, drmCardDir string) error {
+	if gpu.DeviceType != device.GpuDeviceType {
+		return nil
+	}
+
+	status := "disconnected"
+	if gpu.ActiveDisplay {
+		status = "connected"
+	}
+
+	connectorDir := path.Join(drmCardDir, fmt.Sprintf("card%v-DP-1", gpu.CardIdx))
+	if err := os.MkdirAll(connectorDir, 0750); err != nil {
+		return fmt.Errorf("creating directory %v: %v", connectorDir, err)
+	}
+
+	return helpers.WriteFile(path.Join(connectorDir, "status"), status)
+}
+
+// fakeGpuFrequencies writes frequency files in the kernel driver specific
+// location, when the GPU has frequencies set.
+func fakeGpuFrequencies(gpu *device.DeviceInfo, driverDeviceDir string, drmCardDir string) error {
+	if gpu.MaxFreqMHz == 0 {
+		return nil
+	}
+
+	minFreqFile := path.Join(drmCardDir, "gt_min_freq_mhz")
+	maxFreqFile := path.Join(drmCardDir, "gt_max_freq_mhz")
+	if gpu.Driver == device.SysfsXeDriverName {
+		freqDir := path.Join(driverDeviceDir, "tile0", "gt0", "freq0")
+		if err := os.MkdirAll(freqDir, 0750); err != nil {
+			return fmt.Errorf("creating directory %v: %v", freqDir, err)
+		}
+		minFreqFile = path.Join(freqDir, "min_freq")
+		maxFreqFile = path.Join(freqDir, "max_freq")
+	}
+
+	if writeErr := helpers.WriteFile(minFreqFile, fmt.Sprint(gpu.MinFreqMHz)); writeErr != nil {
+		return writeErr
+	}
+
+	return helpers.WriteFile(maxFreqFile, fmt.Sprint(gpu.MaxFreqMHz))
+}
+
 func fakeGpuDRIDevices(devfsRoot, cardName, renderdName string, real bool) error {
 	devices := []string{
 		path.Join(devfsRoot, "dri", cardName),
@@ -23,24 +23,37 @@ const (
 	pciDevicePattern = "????:??:??.?"
 	qatState         = "qat/state"
 	qatServices      = "qat/cfg_services"
+	qatNumRPs        = "qat/num_rps"
+	pciDeviceID      = "device"
+	pciVendorID      = "vendor"
+	qatErrorsFatal   = "qat_ras/errors_fatal"
 	driverOverride   = "driver_override"
 	numVFs           = "sriov_numvfs"
 	totalVFs         = "sriov_totalvfs"
+	vfTotalMSIX      = "sriov_vf_total_msix"
 	vfDevicePattern  = "virtfn"
 	vfDriver         = "driver"
 	vfIOMMUpath      = "kernel/iommu_groups"
 	vfIOMMU          = "iommu_group"
 	vfDeviceNode     = "vfio"
+	sysfsIOMMUClass  = "class/iommu"
 )
 
 type QATDevices []*PFDevice
 
 type PFDevice struct {
-	Device   string
-	State    string
-	Services string
-	TotalVFs int
-	NumVFs   int
+	Device      string
+	State       string
+	Services    string
+	TotalVFs    int
+	NumVFs      int
+	ErrorsFatal int
+	// MSI-X vectors available for VFs, sriov_vf_total_msix is not created if 0.
+	VFTotalMSIX int
+	// PCI device ID, e.g. 0x4940, device file is not created if empty.
+	DeviceID string
+	// Ring pairs of the device, qat/num_rps is not created if 0.
+	NumRPs int
 }
 
 type pcidevicefiles struct {
@@ -134,6 +147,11 @@ func FakeSysFsQATContents(sysfsRoot string, qatdevices QATDevices) error {
 		return fmt.Errorf("creating fake sysfs pci driver dir: %v", err)
 	}
 
+	// ...class/iommu/dmar0, IOMMU enabled
+	if err := os.MkdirAll(path.Join(sysfsRoot, sysfsIOMMUClass, "dmar0"), 0755); err != nil {
+		return fmt.Errorf("creating fake sysfs iommu dir: %v", err)
+	}
+
 	// ...bus/pci/devices
 	pcidevicedir := path.Join(sysfsRoot, sysfsDevicePath)
 	if err := os.MkdirAll(pcidevicedir, 0755); err != nil {
@@ -163,10 +181,36 @@ func FakeSysFsQATContents(sysfsRoot string, qatdevices QATDevices) error {
 			{totalVFs, strconv.Itoa(pf.TotalVFs)},
 			{qatState, pf.State},
 			{qatServices, pf.Services},
+			{qatErrorsFatal, strconv.Itoa(pf.ErrorsFatal)},
+			{pciVendorID, helpers.IntelPCIVendorID},
 		}); err != nil {
 			return fmt.Errorf("creating fake sysfs device driver files: %v", err)
 		}
 
+		if pf.DeviceID != "" {
+			if err := writesysfsfiles(devicedir, []pcidevicefiles{
+				{pciDeviceID, pf.DeviceID},
+			}); err != nil {
+				return fmt.Errorf("creating fake sysfs device driver files: %v", err)
+			}
+		}
+
+		if pf.NumRPs > 0 {
+			if err := writesysfsfiles(devicedir, []pcidevicefiles{
+				{qatNumRPs, strconv.Itoa(pf.NumRPs)},
+			}); err != nil {
+				return fmt.Errorf("creating fake sysfs device driver files: %v", err)
+			}
+		}
+
+		if pf.VFTotalMSIX > 0 {
+			if err := writesysfsfiles(devicedir, []pcidevicefiles{
+				{vfTotalMSIX, strconv.Itoa(pf.VFTotalMSIX)},
+			}); err != nil {
+				return fmt.Errorf("creating fake sysfs device driver files: %v", err)
+			}
+		}
+
 		if err := FakeSysFsQATVFContents(sysfsRoot, pcipath(pf.Device), pf.TotalVFs, pf.Device, &iommu); err != nil {
 			return fmt.Errorf("creating fake sysfs VF files: %v", err)
 		}
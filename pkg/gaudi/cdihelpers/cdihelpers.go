@@ -27,6 +27,7 @@ import (
 	cdiSpecs "tags.cncf.io/container-device-interface/specs-go"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
 
 const (
@@ -44,23 +45,24 @@ func getGaudiSpecs(cdiCache *cdiapi.Cache) []*cdiapi.Spec {
 }
 
 // AddDetectedDevicesToCDIRegistry adds detected devices into cdi registry after deleting old specs.
-func AddDetectedDevicesToCDIRegistry(cdiCache *cdiapi.Cache, detectedDevices device.DevicesInfo) error {
+// The permissions are set on the device nodes of the devices.
+func AddDetectedDevicesToCDIRegistry(cdiCache *cdiapi.Cache, detectedDevices device.DevicesInfo, permissions helpers.DeviceNodePermissions) error {
 	gaudiSpecs := getGaudiSpecs(cdiCache)
 	for _, spec := range gaudiSpecs {
 		if err := cdiCache.RemoveSpec(spec.GetPath()); err != nil {
-			return fmt.Errorf("failed to remove old CDI spec %v: %v", spec, err)
+			return helpers.NewCDIError(helpers.CDISpecRemoveFailed, spec.GetPath(), err)
 		}
 	}
 
-	if err := addDevicesToNewSpec(cdiCache, detectedDevices); err != nil {
-		return fmt.Errorf("failed adding devices to new CDI spec: %v", err)
+	if err := addDevicesToNewSpec(cdiCache, detectedDevices, permissions); err != nil {
+		return fmt.Errorf("failed adding devices to new CDI spec: %w", err)
 	}
 
 	return nil
 }
 
 // addDevicesToNewSpec creates new CDI spec and adds devices to it.
-func addDevicesToNewSpec(cdiCache *cdiapi.Cache, devices device.DevicesInfo) error {
+func addDevicesToNewSpec(cdiCache *cdiapi.Cache, devices device.DevicesInfo, permissions helpers.DeviceNodePermissions) error {
 	klog.V(5).Infof("Adding %v devices to new spec", len(devices))
 
 	spec := &cdiSpecs.Spec{
@@ -73,41 +75,58 @@ func addDevicesToNewSpec(cdiCache *cdiapi.Cache, devices device.DevicesInfo) err
 	}
 	klog.V(5).Infof("New name for new CDI spec: %v", specName)
 
-	return addDevicesToSpecAndWrite(cdiCache, devices, spec, specName)
+	return addDevicesToSpecAndWrite(cdiCache, devices, permissions, spec, specName)
 }
 
-func addDevicesToSpecAndWrite(cdiCache *cdiapi.Cache, devices device.DevicesInfo, spec *cdiSpecs.Spec, specName string) error {
-	for name, device := range devices {
+func addDevicesToSpecAndWrite(cdiCache *cdiapi.Cache, devices device.DevicesInfo, permissions helpers.DeviceNodePermissions, spec *cdiSpecs.Spec, specName string) error {
+	for name, gaudi := range devices {
 		// primary / control node (for modesetting)
 		newDevice := cdiSpecs.Device{
 			Name: name,
 			ContainerEdits: cdiSpecs.ContainerEdits{
-				DeviceNodes: newContainerEditsDeviceNodes(device.DeviceIdx, device.UVerbsIdx),
+				DeviceNodes: newContainerEditsDeviceNodes(gaudi.DeviceIdx, gaudi.UVerbsIdx, false, permissions),
 			},
 		}
 		spec.Devices = append(spec.Devices, newDevice)
+
+		// control-only variant for management and monitoring claims
+		spec.Devices = append(spec.Devices, cdiSpecs.Device{
+			Name: name + device.CDIControlOnlySuffix,
+			ContainerEdits: cdiSpecs.ContainerEdits{
+				DeviceNodes: newContainerEditsDeviceNodes(gaudi.DeviceIdx, gaudi.UVerbsIdx, true, permissions),
+			},
+		})
 	}
 
 	if err := writeSpec(cdiCache, spec, specName); err != nil {
-		return fmt.Errorf("failed to save new CDI spec %v: %v", specName, err)
+		return fmt.Errorf("failed to save new CDI spec %v: %w", specName, err)
 	}
 
 	return nil
 }
 
-func newContainerEditsDeviceNodes(deviceIdx uint64, uverbsIdx uint64) []*cdiSpecs.DeviceNode {
+// newContainerEditsDeviceNodes returns the accel, accel_controlD and uverbs
+// device nodes, or only the accel_controlD node when controlOnly is set. The
+// permissions are set on all returned device nodes.
+func newContainerEditsDeviceNodes(deviceIdx uint64, uverbsIdx uint64, controlOnly bool, permissions helpers.DeviceNodePermissions) []*cdiSpecs.DeviceNode {
 	accelDevPath := device.GetAccelDevfsPath()
 	infinibandDevPath := device.GetInfinibandDevfsPath()
+	controlNode := &cdiSpecs.DeviceNode{
+		Path:     path.Join(containerDevfsRoot, device.DevfsAccelPath, fmt.Sprintf("accel_controlD%d", deviceIdx)),
+		HostPath: path.Join(accelDevPath, fmt.Sprintf("accel_controlD%d", deviceIdx)),
+		Type:     "c",
+	}
+	if controlOnly {
+		permissions.Apply(controlNode)
+		return []*cdiSpecs.DeviceNode{controlNode}
+	}
+
 	deviceNodes := []*cdiSpecs.DeviceNode{
 		{
 			Path:     path.Join(containerDevfsRoot, device.DevfsAccelPath, fmt.Sprintf("accel%d", deviceIdx)),
 			HostPath: path.Join(accelDevPath, fmt.Sprintf("accel%d", deviceIdx)),
 			Type:     "c"},
-		{
-			Path:     path.Join(containerDevfsRoot, device.DevfsAccelPath, fmt.Sprintf("accel_controlD%d", deviceIdx)),
-			HostPath: path.Join(accelDevPath, fmt.Sprintf("accel_controlD%d", deviceIdx)),
-			Type:     "c",
-		},
+		controlNode,
 	}
 
 	if uverbsIdx != device.UverbsMissingIdx {
@@ -118,6 +137,10 @@ func newContainerEditsDeviceNodes(deviceIdx uint64, uverbsIdx uint64) []*cdiSpec
 		})
 	}
 
+	for _, deviceNode := range deviceNodes {
+		permissions.Apply(deviceNode)
+	}
+
 	return deviceNodes
 }
 
@@ -132,7 +155,7 @@ func writeSpec(cdiCache *cdiapi.Cache, spec *cdiSpecs.Spec, specName string) err
 	if len(spec.Devices) == 0 {
 		klog.V(5).Infof("No devices in spec %v, deleting it", specName)
 		if err := cdiCache.RemoveSpec(specName); err != nil {
-			return fmt.Errorf("failed to remove empty CDI spec %v: %v", specName, err)
+			return helpers.NewCDIError(helpers.CDISpecRemoveFailed, specName, err)
 		}
 		return nil
 	}
@@ -140,7 +163,7 @@ func writeSpec(cdiCache *cdiapi.Cache, spec *cdiSpecs.Spec, specName string) err
 	klog.V(5).Infof("Writing spec %v", specName)
 	err = cdiCache.WriteSpec(spec, specName)
 	if err != nil {
-		return fmt.Errorf("failed to write CDI spec %v: %v", specName, err)
+		return helpers.NewCDIError(helpers.CDISpecWriteFailed, specName, err)
 	}
 
 	return nil
@@ -149,11 +172,12 @@ func writeSpec(cdiCache *cdiapi.Cache, spec *cdiSpecs.Spec, specName string) err
 // NewBlankDevice adds a special CDI device with no device nodes, but with
 // Gaudi-specific env variables that span multiple devices, and cannot be in a
 // particular Gaudi CDI device. This "blank" device is mutated before saving:
-// a CID hook entry for Gaudi NICs is added here.
+// a CID hook entry for Gaudi NICs is added here, and the claim it is named
+// after is recorded as its owner in the device annotations.
 func NewBlankDevice(cdiCache *cdiapi.Cache, newDevice cdiSpecs.Device, hookPath, gaudinetPath string) error {
 	vendorSpecs := cdiCache.GetVendorSpecs(device.CDIVendor)
 	if len(vendorSpecs) == 0 {
-		return fmt.Errorf("no %v CDI specs found", device.CDIVendor)
+		return helpers.NewCDIError(helpers.CDIDeviceNotFound, "", fmt.Errorf("no %v CDI specs found", device.CDIVendor))
 	}
 	cdiSpec := vendorSpecs[0]
 
@@ -177,6 +201,8 @@ func NewBlankDevice(cdiCache *cdiapi.Cache, newDevice cdiSpecs.Device, hookPath,
 		},
 	}
 
+	helpers.SetCDIClaimOwners(&newDevice, newDevice.Name)
+
 	cdiSpec.Devices = append(cdiSpec.Devices, newDevice)
 	specName := path.Base(cdiSpec.GetPath())
 
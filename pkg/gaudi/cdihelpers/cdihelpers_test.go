@@ -2,12 +2,14 @@ package cdihelpers
 
 import (
 	"os"
+	"reflect"
 	"testing"
 
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 	cdiSpecs "tags.cncf.io/container-device-interface/specs-go"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 	testhelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
 )
 
@@ -92,7 +94,7 @@ func TestAddDetectedDevicesToCDIRegistry(t *testing.T) {
 
 			t.Logf("existing specs: %v", cdiCache.GetVendorSpecs(device.CDIVendor))
 
-			if err := AddDetectedDevicesToCDIRegistry(cdiCache, tt.detectedDevices); (err != nil) != tt.expectedError {
+			if err := AddDetectedDevicesToCDIRegistry(cdiCache, tt.detectedDevices, helpers.DeviceNodePermissions{}); (err != nil) != tt.expectedError {
 				t.Errorf("AddDetectedDevicesToCDIRegistry() error = %v, expectedError %v", err, tt.expectedError)
 			}
 		})
@@ -171,6 +173,9 @@ func TestAddDeviceToAnySpec(t *testing.T) {
 					for _, dev := range spec.Devices {
 						if dev.Name == tt.newDevice.Name {
 							found = true
+							if owners := helpers.CDIClaimOwners(&dev); !reflect.DeepEqual(owners, []string{dev.Name}) {
+								t.Errorf("expected device %v to be owned by claim %v, got %v", dev.Name, dev.Name, owners)
+							}
 							break
 						}
 					}
@@ -282,3 +287,41 @@ func TestDeleteDeviceAndWrite(t *testing.T) {
 		})
 	}
 }
+
+func TestNewContainerEditsDeviceNodes(t *testing.T) {
+	tests := []struct {
+		name        string
+		uverbsIdx   uint64
+		controlOnly bool
+		expected    []string
+	}{
+		{name: "full device", uverbsIdx: 2, expected: []string{"/dev/accel/accel1", "/dev/accel/accel_controlD1", "/dev/infiniband/uverbs2"}},
+		{name: "full device without NIC", uverbsIdx: device.UverbsMissingIdx, expected: []string{"/dev/accel/accel1", "/dev/accel/accel_controlD1"}},
+		{name: "control node only", uverbsIdx: 2, controlOnly: true, expected: []string{"/dev/accel/accel_controlD1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := []string{}
+			for _, deviceNode := range newContainerEditsDeviceNodes(1, tt.uverbsIdx, tt.controlOnly, helpers.DeviceNodePermissions{}) {
+				paths = append(paths, deviceNode.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("expected device nodes %v, got %v", tt.expected, paths)
+			}
+		})
+	}
+
+	permissions, err := helpers.NewDeviceNodePermissions("0660", 1000, 1000)
+	if err != nil {
+		t.Fatalf("could not parse permissions: %v", err)
+	}
+	for _, deviceNode := range newContainerEditsDeviceNodes(1, 2, false, permissions) {
+		if deviceNode.FileMode == nil || *deviceNode.FileMode != os.FileMode(0660) {
+			t.Errorf("expected mode 0660 for %v, got %v", deviceNode.Path, deviceNode.FileMode)
+		}
+		if deviceNode.UID == nil || *deviceNode.UID != 1000 || deviceNode.GID == nil || *deviceNode.GID != 1000 {
+			t.Errorf("expected owner 1000:1000 for %v, got %v:%v", deviceNode.Path, deviceNode.UID, deviceNode.GID)
+		}
+	}
+}
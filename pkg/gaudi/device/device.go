@@ -59,6 +59,9 @@ const (
 
 	PreparedClaimsFileName = "preparedClaims.json"
 
+	// CDI device with only the accel_controlD node, for monitoring and management.
+	CDIControlOnlySuffix = "-control"
+
 	DefaultNamingStyle         = "machine"
 	VisibleDevicesEnvVarName   = "HABANA_VISIBLE_DEVICES"
 	VisibleModulesEnvVarName   = "HABANA_VISIBLE_MODULES"
@@ -91,7 +94,7 @@ type DeviceInfo struct {
 	ModuleIdx  uint64 `json:"moduleidx"`  // OAM slot number, needed for Habana Runtime to set networking
 	PCIRoot    string `json:"pciroot"`    // PCI Root complex ID
 	UVerbsIdx  uint64 `json:"uverbsidx"`  // InfiniBand device uverbs ID
-	Serial     string `json:"serial"`     // Serial number obtained through HLML library
+	Serial     string `json:"serial"`     // Serial number obtained from sysfs or through HLML library
 	Healthy    bool   `json:"healthy"`    // True if device is usable, false otherwise
 }
 
@@ -99,6 +102,11 @@ func (g DeviceInfo) CDIName() string {
 	return fmt.Sprintf("%s=%s", CDIKind, g.UID)
 }
 
+// ControlOnlyCDIName returns the CDI device with only the accel_controlD node.
+func (g DeviceInfo) ControlOnlyCDIName() string {
+	return fmt.Sprintf("%s=%s%s", CDIKind, g.UID, CDIControlOnlySuffix)
+}
+
 func (g *DeviceInfo) DeepCopy() *DeviceInfo {
 	di := *g
 	return &di
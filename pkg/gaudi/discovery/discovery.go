@@ -17,12 +17,15 @@
 package discovery
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
@@ -30,8 +33,77 @@ import (
 	"k8s.io/klog/v2"
 )
 
-// Detect devices from sysfs.
-func DiscoverDevices(sysfsDir, namingStyle string) map[string]*device.DeviceInfo {
+// DeviceFilter lists devices that are withheld from discovery results.
+type DeviceFilter struct {
+	ExcludedModules      map[uint64]bool
+	ExcludedPCIAddresses map[string]bool
+	// PCI addresses of devices excluded during discovery, by either criteria.
+	excludedDevices map[string]bool
+}
+
+// NewDeviceFilter parses comma-separated lists of module IDs and PCI addresses
+// of devices to be excluded.
+func NewDeviceFilter(excludeModules, excludePCIAddresses string) (*DeviceFilter, error) {
+	filter := &DeviceFilter{
+		ExcludedModules:      map[uint64]bool{},
+		ExcludedPCIAddresses: map[string]bool{},
+		excludedDevices:      map[string]bool{},
+	}
+
+	for _, moduleStr := range strings.Split(excludeModules, ",") {
+		moduleStr = strings.TrimSpace(moduleStr)
+		if moduleStr == "" {
+			continue
+		}
+		moduleIdx, err := strconv.ParseUint(moduleStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid module ID %q: %v", moduleStr, err)
+		}
+		filter.ExcludedModules[moduleIdx] = true
+	}
+
+	for _, pciAddress := range strings.Split(excludePCIAddresses, ",") {
+		pciAddress = strings.ToLower(strings.TrimSpace(pciAddress))
+		if pciAddress == "" {
+			continue
+		}
+		if !device.PciRegexp.MatchString(pciAddress) || len(pciAddress) != len("0000:00:00.0") {
+			return nil, fmt.Errorf("invalid PCI address %q, expected DBDF notation, e.g. 0000:0f:00.0", pciAddress)
+		}
+		filter.ExcludedPCIAddresses[pciAddress] = true
+	}
+
+	return filter, nil
+}
+
+// Excluded returns true if the device matches the filter. Nil filter excludes nothing.
+func (f *DeviceFilter) Excluded(info *device.DeviceInfo) bool {
+	if f == nil {
+		return false
+	}
+
+	if f.ExcludedModules[info.ModuleIdx] || f.ExcludedPCIAddresses[info.PCIAddress] {
+		f.excludedDevices[info.PCIAddress] = true
+		return true
+	}
+
+	return false
+}
+
+// ExcludedPCIAddress returns true if the device with given PCI address was
+// excluded during discovery, so it is expected to be missing from allocatable
+// devices even though HLML still reports it.
+func (f *DeviceFilter) ExcludedPCIAddress(pciAddress string) bool {
+	if f == nil {
+		return false
+	}
+
+	return f.excludedDevices[strings.ToLower(pciAddress)] || f.ExcludedPCIAddresses[strings.ToLower(pciAddress)]
+}
+
+// Detect devices from sysfs. Devices matching the exclude filter are not returned.
+// Discovery of a single device gives up after discoveryTimeout, 0 disables the timeout.
+func DiscoverDevices(ctx context.Context, sysfsDir, namingStyle string, exclude *DeviceFilter, discoveryTimeout time.Duration) map[string]*device.DeviceInfo {
 
 	sysfsDriverDir := path.Join(sysfsDir, device.SysfsDriverPath)
 
@@ -47,11 +119,39 @@ func DiscoverDevices(sysfsDir, namingStyle string) map[string]*device.DeviceInfo
 		return devices
 	}
 
-	return scanDevicesFromDriverDirFiles(driverDirFiles, sysfsDriverDir, namingStyle)
+	devices = scanDevicesFromDriverDirFiles(ctx, driverDirFiles, sysfsDriverDir, namingStyle, exclude, discoveryTimeout)
+	if err := ValidateModuleIDs(devices); err != nil {
+		klog.Errorf("invalid Gaudi module IDs: %v", err)
+	}
 
+	return devices
 }
 
-func scanDevicesFromDriverDirFiles(driverDirFiles []os.DirEntry, sysfsDriverDir string, namingStyle string) map[string]*device.DeviceInfo {
+// ValidateModuleIDs returns an error if several devices report the same
+// module_id, i.e. claim the same OAM slot.
+func ValidateModuleIDs(devices map[string]*device.DeviceInfo) error {
+	moduleDevices := map[uint64][]string{}
+	for _, gaudi := range devices {
+		moduleDevices[gaudi.ModuleIdx] = append(moduleDevices[gaudi.ModuleIdx], gaudi.PCIAddress)
+	}
+
+	duplicates := []string{}
+	for moduleIdx, pciAddresses := range moduleDevices {
+		if len(pciAddresses) > 1 {
+			sort.Strings(pciAddresses)
+			duplicates = append(duplicates, fmt.Sprintf("module_id %d: %v", moduleIdx, strings.Join(pciAddresses, ", ")))
+		}
+	}
+
+	if len(duplicates) != 0 {
+		sort.Strings(duplicates)
+		return fmt.Errorf("duplicate module IDs found: %v", strings.Join(duplicates, "; "))
+	}
+
+	return nil
+}
+
+func scanDevicesFromDriverDirFiles(ctx context.Context, driverDirFiles []os.DirEntry, sysfsDriverDir string, namingStyle string, exclude *DeviceFilter, discoveryTimeout time.Duration) map[string]*device.DeviceInfo {
 	devices := map[string]*device.DeviceInfo{}
 	for _, pciAddress := range driverDirFiles {
 		devicePCIAddress := pciAddress.Name()
@@ -61,61 +161,83 @@ func scanDevicesFromDriverDirFiles(driverDirFiles []os.DirEntry, sysfsDriverDir
 		}
 		klog.V(5).Infof("Found Gaudi PCI device: %s", devicePCIAddress)
 
-		driverDeviceDir := path.Join(sysfsDriverDir, devicePCIAddress)
-		// Read PCI device ID.
-		deviceIdFile := path.Join(driverDeviceDir, "device")
-		deviceIdBytes, err := os.ReadFile(deviceIdFile)
+		newDeviceInfo, err := helpers.DiscoverWithTimeout(ctx, discoveryTimeout, devicePCIAddress, func() (*device.DeviceInfo, error) {
+			return discoverDevice(devicePCIAddress, sysfsDriverDir)
+		})
 		if err != nil {
-			klog.Errorf("failed detecting device %v PCI ID: %+v", devicePCIAddress, err)
+			klog.Errorf("Skipping Gaudi device: %v", err)
 			continue
 		}
-		deviceId := strings.TrimSpace(string(deviceIdBytes))
 
-		deviceIdx, err := getAccelIndex(path.Join(driverDeviceDir, "accel"))
-		if err != nil {
-			klog.Errorf("failed detecting device %v accel index: %v", devicePCIAddress, err)
+		// Module IDs of remaining devices are kept as is, they are OAM slot
+		// numbers that the network configuration refers to.
+		if exclude.Excluded(newDeviceInfo) {
+			klog.Infof("Excluding Gaudi device %v (module_id %d)", devicePCIAddress, newDeviceInfo.ModuleIdx)
 			continue
 		}
 
-		moduleIdx, err := getModuleId(driverDeviceDir)
-		if err != nil {
-			klog.Errorf("failed detecting device %v module index: %v", devicePCIAddress, err)
-			continue
-		}
+		devices[determineDeviceName(newDeviceInfo, namingStyle)] = newDeviceInfo
+	}
 
-		uverbsIdx, err := getUverbsId(driverDeviceDir)
-		if err != nil {
-			klog.Warningf("could not detect device %v InfiniBand index: %v", devicePCIAddress, err)
-			uverbsIdx = device.UverbsMissingIdx
-		}
+	return devices
+}
 
-		uid := helpers.DeviceUIDFromPCIinfo(devicePCIAddress, deviceId)
-		klog.V(5).Infof("New gaudi UID: %v", uid)
-		newDeviceInfo := &device.DeviceInfo{
-			UID:        uid,
-			PCIAddress: devicePCIAddress,
-			Model:      deviceId,
-			DeviceIdx:  deviceIdx,
-			ModuleIdx:  moduleIdx,
-			UVerbsIdx:  uverbsIdx,
-			Healthy:    true,
-		}
+// discoverDevice reads details of a single Gaudi from sysfs.
+func discoverDevice(devicePCIAddress string, sysfsDriverDir string) (*device.DeviceInfo, error) {
+	driverDeviceDir := path.Join(sysfsDriverDir, devicePCIAddress)
+	if err := helpers.CheckPCIVendor(driverDeviceDir, helpers.HabanaPCIVendorID); err != nil {
+		return nil, fmt.Errorf("device %v: %v", devicePCIAddress, err)
+	}
 
-		linkSource := path.Join(sysfsDriverDir, devicePCIAddress)
-		pciRoot, err := helpers.DeterminePCIRoot(linkSource)
-		if err != nil {
-			klog.Warningf("could not detect PCI root complex for %v: %v", devicePCIAddress, err)
-		} else {
-			newDeviceInfo.PCIRoot = pciRoot
-		}
+	// Read PCI device ID.
+	deviceIdFile := path.Join(driverDeviceDir, "device")
+	deviceIdBytes, err := os.ReadFile(deviceIdFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed detecting device %v PCI ID: %+v", devicePCIAddress, err)
+	}
+	deviceId := strings.TrimSpace(string(deviceIdBytes))
+
+	deviceIdx, err := getAccelIndex(path.Join(driverDeviceDir, "accel"))
+	if err != nil {
+		return nil, fmt.Errorf("failed detecting device %v accel index: %v", devicePCIAddress, err)
+	}
 
-		// Set user-friendly ModelName field.
-		newDeviceInfo.SetModelName()
+	moduleIdx, err := getModuleId(driverDeviceDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed detecting device %v module index: %v", devicePCIAddress, err)
+	}
 
-		devices[determineDeviceName(newDeviceInfo, namingStyle)] = newDeviceInfo
+	uverbsIdx, err := getUverbsId(driverDeviceDir)
+	if err != nil {
+		klog.Warningf("could not detect device %v InfiniBand index: %v", devicePCIAddress, err)
+		uverbsIdx = device.UverbsMissingIdx
 	}
 
-	return devices
+	uid := helpers.DeviceUIDFromPCIinfo(devicePCIAddress, deviceId)
+	klog.V(5).Infof("New gaudi UID: %v", uid)
+	newDeviceInfo := &device.DeviceInfo{
+		UID:        uid,
+		PCIAddress: devicePCIAddress,
+		Model:      deviceId,
+		DeviceIdx:  deviceIdx,
+		ModuleIdx:  moduleIdx,
+		UVerbsIdx:  uverbsIdx,
+		Serial:     getSerialNumber(driverDeviceDir),
+		Healthy:    true,
+	}
+
+	linkSource := path.Join(sysfsDriverDir, devicePCIAddress)
+	pciRoot, err := helpers.DeterminePCIRoot(linkSource)
+	if err != nil {
+		klog.Warningf("could not detect PCI root complex for %v: %v", devicePCIAddress, err)
+	} else {
+		newDeviceInfo.PCIRoot = pciRoot
+	}
+
+	// Set user-friendly ModelName field.
+	newDeviceInfo.SetModelName()
+
+	return newDeviceInfo, nil
 }
 
 func determineDeviceName(info *device.DeviceInfo, namingStyle string) string {
@@ -157,6 +279,19 @@ func getModuleId(driverDeviceDir string) (uint64, error) {
 	return moduleIdx, nil
 }
 
+// getSerialNumber returns the board serial number, or empty string when the
+// kernel driver does not expose it. HLML reports the same serial later.
+func getSerialNumber(driverDeviceDir string) string {
+	serialFile := path.Join(driverDeviceDir, "serial_number")
+	serialBytes, err := os.ReadFile(serialFile)
+	if err != nil {
+		klog.V(5).Infof("could not read device serial number: %v", err)
+		return ""
+	}
+
+	return strings.TrimSpace(string(serialBytes))
+}
+
 func getUverbsId(driverDeviceDir string) (uint64, error) {
 	targetPath := path.Join(driverDeviceDir, device.InfinibandVerbsDirName, device.InfinibandVerbsPattern)
 	matches, _ := filepath.Glob(targetPath)
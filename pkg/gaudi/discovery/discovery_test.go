@@ -1,9 +1,11 @@
 package discovery
 
 import (
+	"context"
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
@@ -214,6 +216,22 @@ func TestDiscoverDevices(t *testing.T) {
 			expected:   map[string]*device.DeviceInfo{},
 			shouldFail: true,
 		},
+		{
+			name: "non-Intel device bound to the driver",
+			setupFunc: func(sysfsRoot, pciAddress string) error {
+				return os.WriteFile(path.Join(sysfsRoot, "bus/pci/drivers/habanalabs", pciAddress, "vendor"), []byte("0x10de"), 0644)
+			},
+			expected:   map[string]*device.DeviceInfo{},
+			shouldFail: true,
+		},
+		{
+			name: "Intel vendor ID instead of Habana",
+			setupFunc: func(sysfsRoot, pciAddress string) error {
+				return os.WriteFile(path.Join(sysfsRoot, "bus/pci/drivers/habanalabs", pciAddress, "vendor"), []byte(helpers.IntelPCIVendorID), 0644)
+			},
+			expected:   map[string]*device.DeviceInfo{},
+			shouldFail: true,
+		},
 		{
 			name: "accel dir does not exist",
 			setupFunc: func(sysfsRoot, pciAddress string) error {
@@ -246,7 +264,7 @@ func TestDiscoverDevices(t *testing.T) {
 			if err := tt.setupFunc(testDirs.SysfsRoot, "0000:0f:00.0"); err != nil {
 				t.Fatalf("could not set up test: %v", err)
 			}
-			result := DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle)
+			result := DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, nil, helpers.DefaultDiscoveryTimeout)
 			if !tt.shouldFail && !reflect.DeepEqual(result, tt.expected) {
 				t.Errorf("expected %+v, got %+v", tt.expected["0000-0f-00-0-0x1020"], result["0000-0f-00-0-0x1020"])
 			}
@@ -260,3 +278,196 @@ func TestDiscoverDevices(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateModuleIDs(t *testing.T) {
+	tests := []struct {
+		name        string
+		devices     map[string]*device.DeviceInfo
+		expectError bool
+	}{
+		{
+			name:    "no devices",
+			devices: map[string]*device.DeviceInfo{},
+		},
+		{
+			name: "unique module IDs",
+			devices: map[string]*device.DeviceInfo{
+				"0000-0f-00-0-0x1020": {PCIAddress: "0000:0f:00.0", ModuleIdx: 0},
+				"0000-10-00-0-0x1020": {PCIAddress: "0000:10:00.0", ModuleIdx: 1},
+			},
+		},
+		{
+			name: "duplicate module IDs",
+			devices: map[string]*device.DeviceInfo{
+				"0000-0f-00-0-0x1020": {PCIAddress: "0000:0f:00.0", ModuleIdx: 3},
+				"0000-10-00-0-0x1020": {PCIAddress: "0000:10:00.0", ModuleIdx: 3},
+				"0000-11-00-0-0x1020": {PCIAddress: "0000:11:00.0", ModuleIdx: 4},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateModuleIDs(tt.devices)
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestDiscoverDevicesDuplicateModuleIDs(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesDuplicateModuleIDs", testDirs.TestRoot)
+
+	if err := fakesysfs.FakeSysFsGaudiContents(
+		testDirs.TestRoot,
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", PCIRoot: "pci0000:00", DeviceIdx: 0, ModuleIdx: 2, UID: "0000-0f-00-0-0x1020"},
+			"0000-10-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:10:00.0", PCIRoot: "pci0000:00", DeviceIdx: 1, ModuleIdx: 2, UID: "0000-10-00-0-0x1020"},
+		},
+		false); err != nil {
+		t.Fatalf("could not setup fake sysfs for test: %v", err)
+	}
+
+	devices := DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, nil, helpers.DefaultDiscoveryTimeout)
+	if len(devices) != 2 {
+		t.Fatalf("expected both devices to be discovered, got %d", len(devices))
+	}
+	if err := ValidateModuleIDs(devices); err == nil || !strings.Contains(err.Error(), "module_id 2: 0000:0f:00.0, 0000:10:00.0") {
+		t.Errorf("expected duplicate module_id 2 error, got %v", err)
+	}
+}
+
+func TestNewDeviceFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		excludeModules string
+		excludePCI     string
+		expectError    bool
+	}{
+		{name: "nothing excluded"},
+		{name: "modules and PCI addresses", excludeModules: "0, 7", excludePCI: "0000:0F:00.0,0000:10:00.0"},
+		{name: "invalid module ID", excludeModules: "0,x", expectError: true},
+		{name: "negative module ID", excludeModules: "-1", expectError: true},
+		{name: "invalid PCI address", excludePCI: "0f:00.0", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDeviceFilter(tt.excludeModules, tt.excludePCI)
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestDiscoverDevicesExcluded(t *testing.T) {
+	testDevices := device.DevicesInfo{
+		"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", PCIRoot: "pci0000:00", DeviceIdx: 0, ModuleIdx: 0, UID: "0000-0f-00-0-0x1020"},
+		"0000-10-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:10:00.0", PCIRoot: "pci0000:00", DeviceIdx: 1, ModuleIdx: 1, UID: "0000-10-00-0-0x1020"},
+		"0000-11-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:11:00.0", PCIRoot: "pci0000:00", DeviceIdx: 2, ModuleIdx: 2, UID: "0000-11-00-0-0x1020"},
+	}
+
+	tests := []struct {
+		name            string
+		excludeModules  string
+		excludePCI      string
+		expectedDevices []string
+	}{
+		{
+			name:            "nothing excluded",
+			expectedDevices: []string{"0000-0f-00-0-0x1020", "0000-10-00-0-0x1020", "0000-11-00-0-0x1020"},
+		},
+		{
+			name:            "excluded by module ID",
+			excludeModules:  "1",
+			expectedDevices: []string{"0000-0f-00-0-0x1020", "0000-11-00-0-0x1020"},
+		},
+		{
+			name:            "excluded by PCI address",
+			excludePCI:      "0000:0f:00.0",
+			expectedDevices: []string{"0000-10-00-0-0x1020", "0000-11-00-0-0x1020"},
+		},
+		{
+			name:            "excluded by both",
+			excludeModules:  "2",
+			excludePCI:      "0000:0f:00.0",
+			expectedDevices: []string{"0000-10-00-0-0x1020"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+			if err != nil {
+				t.Fatalf("could not create fake system dirs: %v", err)
+			}
+			defer testhelpers.CleanupTest(t, "TestDiscoverDevicesExcluded", testDirs.TestRoot)
+
+			if err := fakesysfs.FakeSysFsGaudiContents(testDirs.TestRoot, testDirs.SysfsRoot, testDirs.DevfsRoot, testDevices, false); err != nil {
+				t.Fatalf("could not setup fake sysfs for test: %v", err)
+			}
+
+			filter, err := NewDeviceFilter(tt.excludeModules, tt.excludePCI)
+			if err != nil {
+				t.Fatalf("could not create device filter: %v", err)
+			}
+
+			devices := DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, filter, helpers.DefaultDiscoveryTimeout)
+			if len(devices) != len(tt.expectedDevices) {
+				t.Fatalf("expected %d devices, got %d: %v", len(tt.expectedDevices), len(devices), devices)
+			}
+			for _, uid := range tt.expectedDevices {
+				if _, found := devices[uid]; !found {
+					t.Errorf("expected device %v to be discovered", uid)
+				}
+			}
+
+			for uid, info := range testDevices {
+				if _, found := devices[uid]; !found && !filter.ExcludedPCIAddress(info.PCIAddress) {
+					t.Errorf("device %v is missing but was not reported as excluded", uid)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscoverDevicesSerialNumber(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesSerialNumber", testDirs.TestRoot)
+
+	if err := fakesysfs.FakeSysFsGaudiContents(
+		testDirs.TestRoot,
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, ModuleIdx: 0, UID: "0000-0f-00-0-0x1020", PCIRoot: "pci0000:01", Serial: "AM12345678"},
+			"0000-1f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:1f:00.0", DeviceIdx: 1, ModuleIdx: 1, UID: "0000-1f-00-0-0x1020", PCIRoot: "pci0000:02"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	result := DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, nil, helpers.DefaultDiscoveryTimeout)
+	if len(result) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(result))
+	}
+	if serial := result["0000-0f-00-0-0x1020"].Serial; serial != "AM12345678" {
+		t.Errorf("expected serial AM12345678, got %q", serial)
+	}
+	if serial := result["0000-1f-00-0-0x1020"].Serial; serial != "" {
+		t.Errorf("expected no serial for device without serial_number file, got %q", serial)
+	}
+}
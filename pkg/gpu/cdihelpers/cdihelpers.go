@@ -62,7 +62,7 @@ func replaceGPUCDISpecs(cdiCache *cdiapi.Cache, devices device.DevicesInfo) erro
 		// Example: /var/run/cdi/intel.com_gpu.yaml -> intel.com_gpu
 		specName := strings.TrimSuffix(filepath.Base(spec.GetPath()), filepath.Ext(spec.GetPath()))
 		if err := cdiCache.RemoveSpec(specName); err != nil {
-			return fmt.Errorf("failed to remove old GPU CDI spec %v: %v", spec, err)
+			return helpers.NewCDIError(helpers.CDISpecRemoveFailed, specName, err)
 		}
 	}
 
@@ -71,7 +71,7 @@ func replaceGPUCDISpecs(cdiCache *cdiapi.Cache, devices device.DevicesInfo) erro
 	AddDevicesToSpec(devices, gpuSpec)
 
 	if err := writeSpec(cdiCache, gpuSpec); err != nil {
-		return fmt.Errorf("failed adding devices to new GPU CDI spec: %v", err)
+		return fmt.Errorf("failed adding devices to new GPU CDI spec: %w", err)
 	}
 
 	return nil
@@ -83,7 +83,7 @@ func replaceMEICDISpecs(cdiCache *cdiapi.Cache, devices device.DevicesInfo) erro
 		// Example: /var/run/cdi/intel.com_gpu-mei.yaml -> intel.com_gpu-mei.yaml -> intel.com_gpu-mei
 		specName := strings.TrimSuffix(filepath.Base(spec.GetPath()), filepath.Ext(spec.GetPath()))
 		if err := cdiCache.RemoveSpec(specName); err != nil {
-			return fmt.Errorf("failed to remove old MEI CDI spec %v: %v", spec, err)
+			return helpers.NewCDIError(helpers.CDISpecRemoveFailed, specName, err)
 		}
 	}
 
@@ -92,7 +92,7 @@ func replaceMEICDISpecs(cdiCache *cdiapi.Cache, devices device.DevicesInfo) erro
 	AddMeiDevicesToSpec(devices, meiSpec)
 
 	if err := writeSpec(cdiCache, meiSpec); err != nil {
-		return fmt.Errorf("failed adding devices to new MEI CDI spec: %v", err)
+		return fmt.Errorf("failed adding devices to new MEI CDI spec: %w", err)
 	}
 
 	return nil
@@ -129,7 +129,7 @@ func writeSpec(cdiCache *cdiapi.Cache, spec *specs.Spec) error {
 
 	err = cdiCache.WriteSpec(spec, specname)
 	if err != nil {
-		return fmt.Errorf("failed to write CDI spec %v: %v", specname, err)
+		return helpers.NewCDIError(helpers.CDISpecWriteFailed, specname, err)
 	}
 
 	return nil
@@ -161,6 +161,7 @@ func AddMeiDevicesToSpec(devices device.DevicesInfo, spec *specs.Spec) {
 
 func AddDevicesToSpec(devices device.DevicesInfo, spec *specs.Spec) {
 	devdriPath := device.GetDriDevPath()
+	renderOnlySuffix := device.CDIRenderOnlySuffix
 
 	for name, device := range devices {
 		// primary / control node (for modesetting)
@@ -188,23 +189,42 @@ func AddDevicesToSpec(devices device.DevicesInfo, spec *specs.Spec) {
 			)
 		}
 
-		addBypathMounts(device, &newDevice, devdriPath)
+		addBypathMounts(device, &newDevice, devdriPath, "card", "render")
 
 		spec.Devices = append(spec.Devices, newDevice)
+
+		// render-only variant for claims that do not need the control node
+		if device.RenderdIdx != 0 {
+			renderDevice := specs.Device{
+				Name: name + renderOnlySuffix,
+				ContainerEdits: specs.ContainerEdits{
+					DeviceNodes: []*specs.DeviceNode{
+						{
+							Path:     path.Join(containerDevdriPath, fmt.Sprintf("renderD%d", device.RenderdIdx)),
+							HostPath: path.Join(devdriPath, fmt.Sprintf("renderD%d", device.RenderdIdx)),
+							Type:     "c",
+						},
+					},
+				},
+			}
+			addBypathMounts(device, &renderDevice, devdriPath, "render")
+
+			spec.Devices = append(spec.Devices, renderDevice)
+		}
 	}
 }
 
 // Add GPU specific by-path mounts to the spec.
-func addBypathMounts(info *device.DeviceInfo, spec *specs.Device, dridevPath string) {
+func addBypathMounts(info *device.DeviceInfo, spec *specs.Device, dridevPath string, nodeTypes ...string) {
 	containerBypathPath := filepath.Join(containerDevdriPath, "by-path")
 	bypathPath := filepath.Join(dridevPath, "by-path")
 
 	basename := filepath.Join(bypathPath, fmt.Sprintf("pci-%s-", info.PCIAddress))
 	containerBasename := filepath.Join(containerBypathPath, fmt.Sprintf("pci-%s-", info.PCIAddress))
 
-	gpuFiles := map[string]string{
-		basename + "card":   containerBasename + "card",
-		basename + "render": containerBasename + "render",
+	gpuFiles := map[string]string{}
+	for _, nodeType := range nodeTypes {
+		gpuFiles[basename+nodeType] = containerBasename + nodeType
 	}
 
 	for gpuFile, containerFile := range gpuFiles {
@@ -18,8 +18,12 @@ package device
 
 import (
 	"fmt"
+	"math"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
@@ -29,6 +33,8 @@ var (
 	CardRegexp    = regexp.MustCompile(`^card[0-9]{1,3}$`)
 	RenderdRegexp = regexp.MustCompile(`^renderD[0-9]{1,3}$`)
 	MEIRegexp     = regexp.MustCompile(`^mei[0-9]+$`)
+
+	SupportedKernelDrivers = []string{SysfsI915DriverName, SysfsXeDriverName}
 )
 
 const (
@@ -39,8 +45,10 @@ const (
 	SysfsPCIBuspath     = "bus/pci/drivers/"
 	SysfsI915DriverName = "i915"
 	SysfsXeDriverName   = "xe"
-	SysfsDRMpath        = "class/drm/"
-	SysfsMEIpath        = "class/mei/"
+	// Selects discovery of devices bound to any of the supported kernel drivers.
+	KernelDriverBoth = "both"
+	SysfsDRMpath     = "class/drm/"
+	SysfsMEIpath     = "class/mei/"
 
 	CDIVendor   = "intel.com"
 	CDIGPUClass = "gpu"
@@ -50,6 +58,8 @@ const (
 	CDIMEIClass = "gpu-mei"
 	CDIMEIKind  = CDIVendor + "/" + CDIMEIClass
 	DriverName  = CDIGPUClass + "." + CDIVendor
+	// CDI device with only the render node has the GPU CDI device name with this suffix.
+	CDIRenderOnlySuffix = "-render"
 
 	UIDLength = len("0000-00-00-0-0x0000")
 
@@ -59,9 +69,20 @@ const (
 	GpuDeviceType      = "gpu"
 	VfDeviceType       = "vf"
 
+	// DefaultMillicores is the millicores capacity of a whole GPU unless
+	// configured otherwise for its model.
+	DefaultMillicores = 1000
+
 	HealthUnknown   = "Unknown"
 	HealthHealthy   = "Healthy"
 	HealthUnhealthy = "Unhealthy"
+	// HealthDegraded is only used as health state, when the device is usable
+	// but has non-fatal health warnings, e.g. thermal throttling.
+	HealthDegraded = "Degraded"
+
+	// HealthTypeSelfTest is the health type of the optional self-test run
+	// during discovery.
+	HealthTypeSelfTest = "SelfTest"
 )
 
 // VfAttributeFiles is a list of filenames that needs to be configured for a VF
@@ -134,22 +155,90 @@ var ModelDetails = map[string]map[string]string{
 	},
 }
 
+// Product families of Intel GPUs, broader than FamilyName.
+const (
+	ProductFamilyArc        = "Arc"
+	ProductFamilyFlex       = "Flex"
+	ProductFamilyMax        = "Max"
+	ProductFamilyIntegrated = "Integrated"
+	ProductFamilyUnknown    = "Unknown"
+)
+
+// GPU types, integrated in the processor or discrete cards.
+const (
+	GPUTypeIntegrated = "integrated"
+	GPUTypeDiscrete   = "discrete"
+
+	// Integrated GPUs are device 2 on the root PCI bus of Intel platforms.
+	integratedGPUPCIBus    = "00"
+	integratedGPUPCIDevice = "02"
+)
+
+// ProductFamilies maps known PCI device IDs to the product family.
+var ProductFamilies = map[string]string{
+	// Arc A-series, Alchemist (DG2).
+	"0x5690": ProductFamilyArc,
+	"0x5691": ProductFamilyArc,
+	"0x5692": ProductFamilyArc,
+	"0x5693": ProductFamilyArc,
+	"0x5694": ProductFamilyArc,
+	"0x5695": ProductFamilyArc,
+	"0x5696": ProductFamilyArc,
+	"0x5697": ProductFamilyArc,
+	"0x56a0": ProductFamilyArc,
+	"0x56a1": ProductFamilyArc,
+	"0x56a2": ProductFamilyArc,
+	"0x56a5": ProductFamilyArc,
+	"0x56a6": ProductFamilyArc,
+	"0x56b0": ProductFamilyArc,
+	"0x56b1": ProductFamilyArc,
+	"0x56b2": ProductFamilyArc,
+	"0x56b3": ProductFamilyArc,
+	// Arc B-series, Battlemage (BMG).
+	"0xe20b": ProductFamilyArc,
+	"0xe20c": ProductFamilyArc,
+	"0xe211": ProductFamilyArc,
+	"0xe212": ProductFamilyArc,
+	// Data Center GPU Flex Series, Arctic Sound-M.
+	"0x56c0": ProductFamilyFlex,
+	"0x56c1": ProductFamilyFlex,
+	"0x56c2": ProductFamilyFlex,
+	// Data Center GPU Max Series, Ponte Vecchio.
+	"0x0b69": ProductFamilyMax,
+	"0x0b6e": ProductFamilyMax,
+	"0x0bd0": ProductFamilyMax,
+	"0x0bd5": ProductFamilyMax,
+	"0x0bd6": ProductFamilyMax,
+	"0x0bd7": ProductFamilyMax,
+	"0x0bd8": ProductFamilyMax,
+	"0x0bd9": ProductFamilyMax,
+	"0x0bda": ProductFamilyMax,
+	"0x0bdb": ProductFamilyMax,
+	// Integrated Iris Xe graphics.
+	"0xa7a0": ProductFamilyIntegrated,
+}
+
 // DeviceInfo is an internal structure type to store info about discovered device.
 type DeviceInfo struct {
 	// UID is a unique identifier on node, used in ResourceSlice K8s API object as RFC1123-compliant identifier.
 	// Consists of PCIAddress and Model with colons and dots replaced with hyphens, e.g. 0000-01-02-0-0x1234.
 	UID           string            `json:"uid"`
 	PCIAddress    string            `json:"pciaddress"`    // PCI address in Linux DBDF notation for use with sysfs, e.g. 0000:00:00.0
+	PCIFunction   int64             `json:"pcifunction"`   // PCI function number from the PCI address, e.g. 1 for 0000:00:02.1
 	Model         string            `json:"model"`         // PCI device ID
 	ModelName     string            `json:"modelname"`     // SKU name, usually Series + Model, e.g. Flex 140
 	FamilyName    string            `json:"familyname"`    // SKU family name, usually Series, e.g. Flex or Max
+	ProductFamily string            `json:"productfamily"` // Product family: Arc, Flex, Max, Integrated or Unknown
+	GPUType       string            `json:"gputype"`       // integrated or discrete
 	MEIName       string            `json:"meiname"`       // MEI name discovered for this GPU, e.g. mei0 for /dev/mei0
 	CardIdx       uint64            `json:"cardidx"`       // card device number (e.g. 0 for /dev/dri/card0)
 	RenderdIdx    uint64            `json:"renderdidx"`    // renderD device number (e.g. 128 for /dev/dri/renderD128)
 	MemoryMiB     uint64            `json:"memorymib"`     // in MiB
-	Millicores    uint64            `json:"millicores"`    // [0-1000] where 1000 means whole GPU.
+	MemoryBytes   int64             `json:"memorybytes"`   // exact amount of local memory in bytes
+	Millicores    uint64            `json:"millicores"`    // millicores capacity of the whole GPU, DefaultMillicores unless configured per model
 	DeviceType    string            `json:"devicetype"`    // gpu, vf, any
 	MaxVFs        uint64            `json:"maxvfs"`        // if enabled, non-zero maximum amount of VFs
+	NumVFs        uint64            `json:"numvfs"`        // amount of VFs currently enabled on the PF
 	ParentUID     string            `json:"parentuid"`     // uid of gpu device where VF is
 	VFProfile     string            `json:"vfprofile"`     // name of the SR-IOV profile
 	VFIndex       uint64            `json:"vfindex"`       // 0-based PCI index of the VF on the GPU, DRM indexing starts with 1
@@ -157,14 +246,45 @@ type DeviceInfo struct {
 	Driver        string            `json:"driver"`        // i915 | xe
 	CurrentDriver string            `json:"currentdriver"` // Current bound driver: xe, i915, vfio-pci, xe-vfio-pci, or empty if unbound
 	PCIRoot       string            `json:"pciroot"`       // PCI Root of the device
+	BoardID       string            `json:"boardid"`       // PCI address of the device below the root port, shared by GPUs on the same board
 	Health        string            `json:"health"`        // Overall health status of the device. One of: Unknown, Healthy, Unhealthy.
 	HealthStatus  map[string]string `json:"healthstatus"`  // Detailed per-category health status information
+	HealthState   string            `json:"healthstate"`   // One of: Unknown, Healthy, Degraded, Unhealthy. Unlike Health, warnings make it Degraded.
+	XPUMDMismatch bool              `json:"xpumdmismatch"` // true if xpumd reports details contradicting the kernel driver
+	MinFreqMHz    int64             `json:"minfreqmhz"`    // minimum GPU frequency in MHz, 0 if unknown
+	MaxFreqMHz    int64             `json:"maxfreqmhz"`    // maximum GPU frequency in MHz, 0 if unknown
+	PowerLimitW   int64             `json:"powerlimitw"`   // sustained power limit (TDP) in watts, 0 if unknown
+	SubsystemID   string            `json:"subsystemid"`   // PCI subsystem vendor and device IDs, e.g. 0x8086:0x4905, empty if unknown
+	Serial        string            `json:"serial"`        // serial number, empty if not exposed by the kernel driver
+	ActiveDisplay bool              `json:"activedisplay"` // true if a display is connected to any output of the GPU
+	SRIOVCapable  bool              `json:"sriovcapable"`  // true if the device has SR-IOV hardware (sriov_totalvfs), regardless of autoprobe
+	Autoprobe     bool              `json:"autoprobe"`     // true if the kernel driver probes new VFs (sriov_drivers_autoprobe)
+}
+
+// GetHealthState returns the health state of the device, falling back to the
+// overall health when the state was not set.
+func (g DeviceInfo) GetHealthState() string {
+	if g.HealthState == "" {
+		return g.Health
+	}
+
+	return g.HealthState
 }
 
 func (g DeviceInfo) CDIName() string {
 	return fmt.Sprintf("%s=%s", CDIKind, g.UID)
 }
 
+// RenderOnlyCDIName returns the CDI device without the card control node, or
+// empty string when the device has no render node.
+func (g DeviceInfo) RenderOnlyCDIName() string {
+	if g.RenderdIdx == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s=%s%s", CDIKind, g.UID, CDIRenderOnlySuffix)
+}
+
 func (g DeviceInfo) MEICDIName() string {
 	if g.MEIName == "" {
 		return ""
@@ -173,6 +293,15 @@ func (g DeviceInfo) MEICDIName() string {
 	return fmt.Sprintf("%s=%s", CDIMEIKind, g.MEIName)
 }
 
+// SetMemory sets both the exact and the MiB-rounded amount of local memory.
+func (g *DeviceInfo) SetMemory(memoryBytes uint64) {
+	g.MemoryMiB = memoryBytes / (1024 * 1024)
+	g.MemoryBytes = math.MaxInt64
+	if memoryBytes < math.MaxInt64 {
+		g.MemoryBytes = int64(memoryBytes)
+	}
+}
+
 func (g *DeviceInfo) DeepCopy() *DeviceInfo {
 	di := *g
 	return &di
@@ -192,9 +321,18 @@ func (g *DeviceInfo) ParentPCIAddress() string {
 }
 
 func (g *DeviceInfo) SetModelInfo() {
+	g.ProductFamily = ProductFamilyUnknown
+	if productFamily, found := ProductFamilies[strings.ToLower(g.Model)]; found {
+		g.ProductFamily = productFamily
+	}
+
 	if deviceDetails, found := ModelDetails[g.Model]; found {
 		g.ModelName = deviceDetails["model"]
 		g.FamilyName = deviceDetails["family"]
+		// Optional, for models more capable than the others.
+		if millicores, err := strconv.ParseUint(deviceDetails["millicores"], 10, 64); err == nil && millicores > 0 {
+			g.Millicores = millicores
+		}
 
 		return
 	}
@@ -203,11 +341,65 @@ func (g *DeviceInfo) SetModelInfo() {
 	g.FamilyName = "Unknown"
 }
 
+// SetGPUType sets the GPU type based on the product family, and for GPUs of
+// unknown family, on the PCI address integrated GPUs have. VFs of integrated
+// GPUs are integrated too. SetModelInfo has to be called first.
+func (g *DeviceInfo) SetGPUType() {
+	switch g.ProductFamily {
+	case ProductFamilyIntegrated:
+		g.GPUType = GPUTypeIntegrated
+		return
+	case ProductFamilyArc, ProductFamilyFlex, ProductFamilyMax:
+		g.GPUType = GPUTypeDiscrete
+		return
+	}
+
+	// Linux DBDF notation, e.g. 0000:00:02.0.
+	g.GPUType = GPUTypeDiscrete
+	parts := strings.Split(g.PCIAddress, ":")
+	if len(parts) == 3 && parts[1] == integratedGPUPCIBus && strings.HasPrefix(parts[2], integratedGPUPCIDevice+".") {
+		g.GPUType = GPUTypeIntegrated
+	}
+}
+
 // IsDRMBound checks if the device is currently bound to its original DRM driver.
 func (g *DeviceInfo) IsDRMBound() bool {
 	return g.CurrentDriver == g.Driver
 }
 
+// levelZeroDrivers lists, per product family, the kernel drivers with which
+// the Level Zero runtime of the Intel compute runtime supports the GPUs. Max
+// GPUs are supported only with i915 for now.
+var levelZeroDrivers = map[string][]string{
+	ProductFamilyArc:        {SysfsI915DriverName, SysfsXeDriverName},
+	ProductFamilyFlex:       {SysfsI915DriverName, SysfsXeDriverName},
+	ProductFamilyMax:        {SysfsI915DriverName},
+	ProductFamilyIntegrated: {SysfsI915DriverName},
+}
+
+// openCLDrivers lists, per product family, the kernel drivers with which the
+// OpenCL runtime of the Intel compute runtime supports the GPUs.
+var openCLDrivers = map[string][]string{
+	ProductFamilyArc:        {SysfsI915DriverName, SysfsXeDriverName},
+	ProductFamilyFlex:       {SysfsI915DriverName, SysfsXeDriverName},
+	ProductFamilyMax:        {SysfsI915DriverName},
+	ProductFamilyIntegrated: {SysfsI915DriverName},
+}
+
+// LevelZeroSupported returns true if the Level Zero runtime is known to
+// support the device bound to its kernel driver. False means it cannot be
+// determined, not that it is unsupported.
+func (g *DeviceInfo) LevelZeroSupported() bool {
+	return g.IsDRMBound() && slices.Contains(levelZeroDrivers[g.ProductFamily], g.Driver)
+}
+
+// OpenCLSupported returns true if the OpenCL runtime is known to support the
+// device bound to its kernel driver. False means it cannot be determined, not
+// that it is unsupported.
+func (g *DeviceInfo) OpenCLSupported() bool {
+	return g.IsDRMBound() && slices.Contains(openCLDrivers[g.ProductFamily], g.Driver)
+}
+
 // DevicesInfo is a dictionary with DeviceInfo.uid being the key.
 type DevicesInfo map[string]*DeviceInfo
 
@@ -222,3 +414,74 @@ func (g *DevicesInfo) DeepCopy() DevicesInfo {
 func GetDriDevPath() string {
 	return filepath.Join(helpers.GetDevfsRoot(helpers.DevfsEnvVarName, DevfsDriPath), DevfsDriPath)
 }
+
+// KernelDriverNames returns the kernel drivers whose devices should be discovered
+// for the given selection: i915, xe, or both. Empty selection means both.
+func KernelDriverNames(selection string) ([]string, error) {
+	switch selection {
+	case SysfsI915DriverName, SysfsXeDriverName:
+		return []string{selection}, nil
+	case KernelDriverBoth, "":
+		return SupportedKernelDrivers, nil
+	default:
+		return nil, fmt.Errorf("unsupported GPU kernel driver %q, supported: %v, %v, %v",
+			selection, SysfsI915DriverName, SysfsXeDriverName, KernelDriverBoth)
+	}
+}
+
+// ModelMillicores maps lowercase PCI device IDs, model names and product
+// families to the millicores capacity of GPUs of that model.
+type ModelMillicores map[string]uint64
+
+// ParseModelMillicores parses a comma-separated list of <model>=<millicores>
+// pairs, where model is a PCI device ID, model name or product family, e.g.
+// "Max=2000,0x56c1=500". Models are case-insensitive.
+func ParseModelMillicores(mapping string) (ModelMillicores, error) {
+	modelMillicores := ModelMillicores{}
+	for _, item := range strings.Split(mapping, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		model, value, found := strings.Cut(item, "=")
+		model = strings.ToLower(strings.TrimSpace(model))
+		if !found || model == "" {
+			return nil, fmt.Errorf("invalid model millicores '%s', expected <model>=<millicores>", item)
+		}
+
+		millicores, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil || millicores == 0 {
+			return nil, fmt.Errorf("invalid millicores '%s' for model '%s', expected a positive integer", value, model)
+		}
+		modelMillicores[model] = millicores
+	}
+
+	return modelMillicores, nil
+}
+
+// Apply sets the millicores of the GPU configured for its PCI device ID,
+// model name or product family, in that order of precedence. VFs are left
+// as is.
+func (m ModelMillicores) Apply(g *DeviceInfo) {
+	if g.DeviceType == VfDeviceType {
+		return
+	}
+
+	for _, model := range []string{g.Model, g.ModelName, g.ProductFamily} {
+		if millicores, found := m[strings.ToLower(model)]; found && model != "" {
+			g.Millicores = millicores
+			return
+		}
+	}
+}
+
+// TotalMillicores returns the millicores capacity of the GPU, the default for
+// devices without one.
+func (g DeviceInfo) TotalMillicores() uint64 {
+	if g.Millicores == 0 {
+		return DefaultMillicores
+	}
+
+	return g.Millicores
+}
@@ -36,6 +36,34 @@ func TestCDIName(t *testing.T) {
 	}
 }
 
+func TestRenderOnlyCDIName(t *testing.T) {
+	tests := []struct {
+		name     string
+		device   DeviceInfo
+		expected string
+	}{
+		{
+			name:     "Device with render node",
+			device:   DeviceInfo{UID: "0000-01-02-0-0x1234", RenderdIdx: 128},
+			expected: "intel.com/gpu=0000-01-02-0-0x1234-render",
+		},
+		{
+			name:     "Device without render node",
+			device:   DeviceInfo{UID: "0000-01-02-0-0x1234"},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.device.RenderOnlyCDIName()
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
 func TestMEICDIName(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -124,6 +152,17 @@ func TestSriovEnabled(t *testing.T) {
 	}
 }
 
+func TestSetMemory(t *testing.T) {
+	device := DeviceInfo{}
+	device.SetMemory(16*1024*1024*1024 + 512*1024)
+	if device.MemoryMiB != 16384 {
+		t.Errorf("expected 16384 MiB, got %v", device.MemoryMiB)
+	}
+	if device.MemoryBytes != 17180393472 {
+		t.Errorf("expected 17180393472 bytes, got %v", device.MemoryBytes)
+	}
+}
+
 func TestParentPCIAddress(t *testing.T) {
 	t.Run("Valid Parent UID", func(t *testing.T) {
 		device := DeviceInfo{
@@ -139,26 +178,56 @@ func TestParentPCIAddress(t *testing.T) {
 
 func TestSetModelInfo(t *testing.T) {
 	tests := []struct {
-		name           string
-		device         DeviceInfo
-		expectedName   string
-		expectedFamily string
+		name                  string
+		device                DeviceInfo
+		expectedName          string
+		expectedFamily        string
+		expectedProductFamily string
 	}{
 		{
 			name: "Known model ID",
 			device: DeviceInfo{
 				Model: "0x56a0",
 			},
-			expectedName:   "A770",
-			expectedFamily: "Arc",
+			expectedName:          "A770",
+			expectedFamily:        "Arc",
+			expectedProductFamily: ProductFamilyArc,
+		},
+		{
+			name: "Flex",
+			device: DeviceInfo{
+				Model: "0x56c1",
+			},
+			expectedName:          "Flex 140",
+			expectedFamily:        "Data Center Flex",
+			expectedProductFamily: ProductFamilyFlex,
+		},
+		{
+			name: "Max",
+			device: DeviceInfo{
+				Model: "0x0bd5",
+			},
+			expectedName:          "Max 1550",
+			expectedFamily:        "Data Center Max",
+			expectedProductFamily: ProductFamilyMax,
+		},
+		{
+			name: "Product family without model details",
+			device: DeviceInfo{
+				Model: "0xE20B",
+			},
+			expectedName:          "Unknown",
+			expectedFamily:        "Unknown",
+			expectedProductFamily: ProductFamilyArc,
 		},
 		{
 			name: "Unknown model ID",
 			device: DeviceInfo{
 				Model: "0x9999",
 			},
-			expectedName:   "Unknown",
-			expectedFamily: "Unknown",
+			expectedName:          "Unknown",
+			expectedFamily:        "Unknown",
+			expectedProductFamily: ProductFamilyUnknown,
 		},
 	}
 
@@ -171,6 +240,33 @@ func TestSetModelInfo(t *testing.T) {
 			if tt.device.FamilyName != tt.expectedFamily {
 				t.Errorf("expected family name %v, got %v", tt.expectedFamily, tt.device.FamilyName)
 			}
+			if tt.device.ProductFamily != tt.expectedProductFamily {
+				t.Errorf("expected product family %v, got %v", tt.expectedProductFamily, tt.device.ProductFamily)
+			}
+		})
+	}
+}
+
+func TestSetGPUType(t *testing.T) {
+	tests := []struct {
+		name         string
+		device       DeviceInfo
+		expectedType string
+	}{
+		{name: "Flex", device: DeviceInfo{Model: "0x56c0", PCIAddress: "0000:03:00.0"}, expectedType: GPUTypeDiscrete},
+		{name: "Integrated model", device: DeviceInfo{Model: "0xa7a0", PCIAddress: "0000:00:02.0"}, expectedType: GPUTypeIntegrated},
+		{name: "Unknown model at integrated GPU address", device: DeviceInfo{Model: "0x7d67", PCIAddress: "0000:00:02.0"}, expectedType: GPUTypeIntegrated},
+		{name: "Unknown model at other address", device: DeviceInfo{Model: "0x7d67", PCIAddress: "0000:03:00.0"}, expectedType: GPUTypeDiscrete},
+		{name: "VF of integrated GPU", device: DeviceInfo{Model: "0x7d67", PCIAddress: "0000:00:02.1"}, expectedType: GPUTypeIntegrated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.device.SetModelInfo()
+			tt.device.SetGPUType()
+			if tt.device.GPUType != tt.expectedType {
+				t.Errorf("expected GPU type %v, got %v", tt.expectedType, tt.device.GPUType)
+			}
 		})
 	}
 }
@@ -207,3 +303,132 @@ func TestGetDevfsRoot(t *testing.T) {
 		t.Errorf("expected %v, got %v", testDevfsRoot, result)
 	}
 }
+
+func TestKernelDriverNames(t *testing.T) {
+	tests := []struct {
+		selection   string
+		expected    []string
+		expectError bool
+	}{
+		{selection: KernelDriverBoth, expected: []string{SysfsI915DriverName, SysfsXeDriverName}},
+		{selection: "", expected: []string{SysfsI915DriverName, SysfsXeDriverName}},
+		{selection: SysfsI915DriverName, expected: []string{SysfsI915DriverName}},
+		{selection: SysfsXeDriverName, expected: []string{SysfsXeDriverName}},
+		{selection: "nouveau", expectError: true},
+	}
+
+	for _, tt := range tests {
+		driverNames, err := KernelDriverNames(tt.selection)
+		if (err != nil) != tt.expectError {
+			t.Errorf("%q: expected error %v, got %v", tt.selection, tt.expectError, err)
+		}
+		if !reflect.DeepEqual(driverNames, tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.selection, tt.expected, driverNames)
+		}
+	}
+}
+
+func TestParseModelMillicores(t *testing.T) {
+	tests := []struct {
+		name        string
+		mapping     string
+		expected    ModelMillicores
+		expectError bool
+	}{
+		{name: "empty", mapping: "", expected: ModelMillicores{}},
+		{
+			name:     "family and device ID",
+			mapping:  "Max=2000, 0x56C1=500,",
+			expected: ModelMillicores{"max": 2000, "0x56c1": 500},
+		},
+		{name: "missing millicores", mapping: "Max", expectError: true},
+		{name: "zero millicores", mapping: "Max=0", expectError: true},
+		{name: "missing model", mapping: "=500", expectError: true},
+		{name: "not a number", mapping: "Max=lots", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelMillicores, err := ParseModelMillicores(tt.mapping)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if !tt.expectError && !reflect.DeepEqual(modelMillicores, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, modelMillicores)
+			}
+		})
+	}
+}
+
+func TestModelMillicoresApply(t *testing.T) {
+	modelMillicores := ModelMillicores{"max": 2000, "0x0bd5": 4000, "flex 140": 500}
+
+	tests := []struct {
+		name     string
+		device   DeviceInfo
+		expected uint64
+	}{
+		{
+			name:     "device ID takes precedence over family",
+			device:   DeviceInfo{Model: "0x0BD5", ProductFamily: ProductFamilyMax, DeviceType: GpuDeviceType},
+			expected: 4000,
+		},
+		{
+			name:     "model name",
+			device:   DeviceInfo{Model: "0x56c1", ModelName: "Flex 140", ProductFamily: ProductFamilyFlex, DeviceType: GpuDeviceType},
+			expected: 500,
+		},
+		{
+			name:     "product family",
+			device:   DeviceInfo{Model: "0x0bd6", ProductFamily: ProductFamilyMax, DeviceType: GpuDeviceType},
+			expected: 2000,
+		},
+		{
+			name:     "unconfigured model",
+			device:   DeviceInfo{Model: "0x56a0", ProductFamily: ProductFamilyArc, DeviceType: GpuDeviceType},
+			expected: DefaultMillicores,
+		},
+		{
+			name:     "VF is left as is",
+			device:   DeviceInfo{Model: "0x0bd5", ProductFamily: ProductFamilyMax, DeviceType: VfDeviceType},
+			expected: DefaultMillicores,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelMillicores.Apply(&tt.device)
+			if got := tt.device.TotalMillicores(); got != tt.expected {
+				t.Errorf("expected %v millicores, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestComputeAPIsSupported(t *testing.T) {
+	tests := []struct {
+		name      string
+		device    DeviceInfo
+		levelZero bool
+		openCL    bool
+	}{
+		{name: "Arc with xe", device: DeviceInfo{ProductFamily: ProductFamilyArc, Driver: SysfsXeDriverName, CurrentDriver: SysfsXeDriverName}, levelZero: true, openCL: true},
+		{name: "Max with i915", device: DeviceInfo{ProductFamily: ProductFamilyMax, Driver: SysfsI915DriverName, CurrentDriver: SysfsI915DriverName}, levelZero: true, openCL: true},
+		{name: "Max with xe", device: DeviceInfo{ProductFamily: ProductFamilyMax, Driver: SysfsXeDriverName, CurrentDriver: SysfsXeDriverName}, levelZero: false, openCL: false},
+		{name: "Integrated with i915", device: DeviceInfo{ProductFamily: ProductFamilyIntegrated, Driver: SysfsI915DriverName, CurrentDriver: SysfsI915DriverName}, levelZero: true, openCL: true},
+		{name: "Integrated with xe", device: DeviceInfo{ProductFamily: ProductFamilyIntegrated, Driver: SysfsXeDriverName, CurrentDriver: SysfsXeDriverName}, levelZero: false, openCL: false},
+		{name: "Unknown family", device: DeviceInfo{ProductFamily: ProductFamilyUnknown, Driver: SysfsI915DriverName, CurrentDriver: SysfsI915DriverName}, levelZero: false, openCL: false},
+		{name: "Bound to vfio-pci", device: DeviceInfo{ProductFamily: ProductFamilyFlex, Driver: SysfsI915DriverName, CurrentDriver: "vfio-pci"}, levelZero: false, openCL: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if supported := tt.device.LevelZeroSupported(); supported != tt.levelZero {
+				t.Errorf("expected Level Zero support %v, got %v", tt.levelZero, supported)
+			}
+			if supported := tt.device.OpenCLSupported(); supported != tt.openCL {
+				t.Errorf("expected OpenCL support %v, got %v", tt.openCL, supported)
+			}
+		})
+	}
+}
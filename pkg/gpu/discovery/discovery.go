@@ -17,6 +17,7 @@
 package discovery
 
 import (
+	"context"
 	"fmt"
 	"maps"
 	"os"
@@ -24,6 +25,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/drm"
@@ -34,19 +36,22 @@ import (
 )
 
 const (
-	initialMillicores = 1000
+	initialMillicores = device.DefaultMillicores
 )
 
 // DiscoverDevices detects devices from sysfs and devfs if it can, and returns a map of
 // device UID:deviceInfo and a bool indicating if device details were successfully discovered.
 // When DRA driver runs in privileged mode, device details are fetched from devfs. Otherwise the
 // xpumd device info stream will be used to get device details including health and memory when
-// xpumd starts later.
-func DiscoverDevices(sysfsDir, namingStyle string, xpumdEnabled bool) map[string]*device.DeviceInfo {
+// xpumd starts later. Only devices bound to one of driverNames kernel drivers are discovered,
+// integrated GPUs are skipped when discreteOnly is true. Discovery of a single device gives up
+// after discoveryTimeout, 0 disables the timeout. GPUs get the millicores configured for their
+// model in modelMillicores, nil keeps the defaults.
+func DiscoverDevices(ctx context.Context, sysfsDir, namingStyle string, xpumdEnabled bool, driverNames []string, discreteOnly bool, discoveryTimeout time.Duration, modelMillicores device.ModelMillicores) map[string]*device.DeviceInfo {
 	sysfsDRMDir := path.Join(sysfsDir, device.SysfsDRMpath)
 	devices := make(map[string]*device.DeviceInfo)
 
-	for _, driverName := range []string{device.SysfsI915DriverName, device.SysfsXeDriverName} {
+	for _, driverName := range driverNames {
 		sysfsDriverDir := path.Join(sysfsDir, device.SysfsPCIBuspath, driverName)
 
 		klog.V(5).Infof("Looking for devices in %v", sysfsDriverDir)
@@ -59,7 +64,7 @@ func DiscoverDevices(sysfsDir, namingStyle string, xpumdEnabled bool) map[string
 			klog.Errorf("could not read sysfs directory: %v", err)
 			continue
 		}
-		moreDevices := processSysfsDriverDir(files, driverName, sysfsDriverDir, sysfsDRMDir, namingStyle)
+		moreDevices := processSysfsDriverDir(ctx, files, driverName, sysfsDriverDir, sysfsDRMDir, namingStyle, discreteOnly, discoveryTimeout)
 		maps.Copy(devices, moreDevices)
 	}
 
@@ -67,6 +72,10 @@ func DiscoverDevices(sysfsDir, namingStyle string, xpumdEnabled bool) map[string
 		klog.Error("Could not get device details. Enable privileged mode or health monitoring for device capability discovery.")
 	}
 
+	for _, gpu := range devices {
+		modelMillicores.Apply(gpu)
+	}
+
 	return devices
 }
 
@@ -75,17 +84,17 @@ func DiscoverDevices(sysfsDir, namingStyle string, xpumdEnabled bool) map[string
 // this should succeed.
 func populateDevicesInfoMemory(devices map[string]*device.DeviceInfo) error {
 	for _, deviceInfo := range devices {
-		memoryMiB, err := getLocalMemoryAmountMiB(deviceInfo.CardIdx, deviceInfo.Driver)
+		memoryBytes, err := getLocalMemoryAmountBytes(deviceInfo.CardIdx, deviceInfo.Driver)
 		if err != nil {
 			return err
 		}
-		deviceInfo.MemoryMiB = memoryMiB
+		deviceInfo.SetMemory(memoryBytes)
 	}
 
 	return nil
 }
 
-func processSysfsDriverDir(files []os.DirEntry, driverName string, sysfsDriverDir string, sysfsDRMDir string, namingStyle string) map[string]*device.DeviceInfo {
+func processSysfsDriverDir(ctx context.Context, files []os.DirEntry, driverName string, sysfsDriverDir string, sysfsDRMDir string, namingStyle string, discreteOnly bool, discoveryTimeout time.Duration) map[string]*device.DeviceInfo {
 	devices := make(map[string]*device.DeviceInfo)
 
 	for _, pciAddress := range files {
@@ -96,56 +105,94 @@ func processSysfsDriverDir(files []os.DirEntry, driverName string, sysfsDriverDi
 		}
 		klog.V(5).Infof("Found GPU PCI device: %s", devicePCIAddress)
 
-		newDeviceInfo := &device.DeviceInfo{
-			PCIAddress:    devicePCIAddress,
-			MemoryMiB:     0,
-			Millicores:    initialMillicores,
-			DeviceType:    device.GpuDeviceType, // presume GPU, detect the physfn / parent later
-			CardIdx:       0,
-			RenderdIdx:    0,
-			Driver:        driverName,
-			CurrentDriver: driverName,
-			Health:        device.HealthHealthy, // Presume healthy until proven otherwise. If healthcare is disabled, after discovery the driver will set this to HealthUnknown.
-		}
-
-		sysfsDeviceDir := path.Join(sysfsDriverDir, devicePCIAddress)
-		deviceIdFile := path.Join(sysfsDeviceDir, "device")
-		deviceIdBytes, err := os.ReadFile(deviceIdFile)
+		newDeviceInfo, err := helpers.DiscoverWithTimeout(ctx, discoveryTimeout, devicePCIAddress, func() (*device.DeviceInfo, error) {
+			return discoverDevice(devicePCIAddress, driverName, sysfsDriverDir)
+		})
 		if err != nil {
-			klog.Errorf("Failed reading device file (%s): %+v", deviceIdFile, err)
+			klog.Errorf("Skipping GPU %v: %v", devicePCIAddress, err)
 			continue
 		}
-		deviceId := strings.TrimSpace(string(deviceIdBytes))
-		uid := helpers.DeviceUIDFromPCIinfo(devicePCIAddress, deviceId)
-		newDeviceInfo.UID = uid
-		klog.V(5).Infof("New gpu UID: %v", uid)
-		newDeviceInfo.Model = deviceId
-		newDeviceInfo.SetModelInfo()
-
-		cardIdx, renderdIdx, err := drm.DeduceCardAndRenderdIndexes(sysfsDeviceDir)
-		if err != nil {
-			continue
-		}
-
-		newDeviceInfo.CardIdx = cardIdx
-		newDeviceInfo.RenderdIdx = renderdIdx
-		newDeviceInfo.MEIName = mei.DiscoverMEIDeviceForGPU(sysfsDriverDir, sysfsDeviceDir)
 
-		linkSource := path.Join(sysfsDriverDir, devicePCIAddress)
-		pciRoot, err := helpers.DeterminePCIRoot(linkSource)
-		if err != nil {
-			klog.Warningf("could not detect PCI root complex for %v: %v", devicePCIAddress, err)
-		} else {
-			newDeviceInfo.PCIRoot = pciRoot
+		if discreteOnly && newDeviceInfo.GPUType == device.GPUTypeIntegrated {
+			klog.Infof("Skipping integrated GPU %v, only discrete GPUs are discovered", devicePCIAddress)
+			continue
 		}
 
-		detectSRIOV(newDeviceInfo, sysfsDriverDir, devicePCIAddress, deviceId)
 		devices[determineDeviceName(newDeviceInfo, namingStyle)] = newDeviceInfo
 	}
 
 	return devices
 }
 
+// discoverDevice reads details of a single GPU from sysfs.
+func discoverDevice(devicePCIAddress string, driverName string, sysfsDriverDir string) (*device.DeviceInfo, error) {
+	newDeviceInfo := &device.DeviceInfo{
+		PCIAddress:    devicePCIAddress,
+		MemoryMiB:     0,
+		Millicores:    initialMillicores,
+		DeviceType:    device.GpuDeviceType, // presume GPU, detect the physfn / parent later
+		CardIdx:       0,
+		RenderdIdx:    0,
+		Driver:        driverName,
+		CurrentDriver: driverName,
+		Health:        device.HealthHealthy, // Presume healthy until proven otherwise. If healthcare is disabled, after discovery the driver will set this to HealthUnknown.
+	}
+
+	sysfsDeviceDir := path.Join(sysfsDriverDir, devicePCIAddress)
+	if err := helpers.CheckPCIVendor(sysfsDeviceDir, helpers.IntelPCIVendorID); err != nil {
+		return nil, err
+	}
+
+	deviceIdFile := path.Join(sysfsDeviceDir, "device")
+	deviceIdBytes, err := os.ReadFile(deviceIdFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading device file (%s): %+v", deviceIdFile, err)
+	}
+	deviceId := helpers.NormalizePCIDeviceID(string(deviceIdBytes))
+	uid := helpers.DeviceUIDFromPCIinfo(devicePCIAddress, deviceId)
+	newDeviceInfo.UID = uid
+	if newDeviceInfo.PCIFunction, err = helpers.PCIFunction(devicePCIAddress); err != nil {
+		return nil, err
+	}
+	klog.V(5).Infof("New gpu UID: %v", uid)
+	newDeviceInfo.Model = deviceId
+	newDeviceInfo.SetModelInfo()
+	newDeviceInfo.SetGPUType()
+
+	cardIdx, renderdIdx, err := drm.DeduceCardAndRenderdIndexes(sysfsDeviceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	newDeviceInfo.CardIdx = cardIdx
+	newDeviceInfo.RenderdIdx = renderdIdx
+	newDeviceInfo.MinFreqMHz, newDeviceInfo.MaxFreqMHz = getFrequenciesMHz(sysfsDeviceDir, cardIdx, driverName)
+	newDeviceInfo.PowerLimitW = getPowerLimitWatts(sysfsDeviceDir)
+	newDeviceInfo.ActiveDisplay = hasActiveDisplay(sysfsDeviceDir, cardIdx)
+	newDeviceInfo.SubsystemID = getSubsystemID(sysfsDeviceDir)
+	newDeviceInfo.Serial = readOptionalFile(path.Join(sysfsDeviceDir, "serial_number"))
+	newDeviceInfo.MEIName = mei.DiscoverMEIDeviceForGPU(sysfsDriverDir, sysfsDeviceDir)
+
+	linkSource := path.Join(sysfsDriverDir, devicePCIAddress)
+	pciRoot, err := helpers.DeterminePCIRoot(linkSource)
+	if err != nil {
+		klog.Warningf("could not detect PCI root complex for %v: %v", devicePCIAddress, err)
+	} else {
+		newDeviceInfo.PCIRoot = pciRoot
+	}
+
+	boardID, err := helpers.DeterminePCIBoard(linkSource)
+	if err != nil {
+		klog.Warningf("could not detect PCI board for %v: %v", devicePCIAddress, err)
+	} else {
+		newDeviceInfo.BoardID = boardID
+	}
+
+	detectSRIOV(newDeviceInfo, sysfsDriverDir, devicePCIAddress, deviceId)
+
+	return newDeviceInfo, nil
+}
+
 func determineDeviceName(info *device.DeviceInfo, namingStyle string) string {
 	if namingStyle == "classic" {
 		return "card" + strconv.FormatUint(info.CardIdx, 10)
@@ -191,6 +238,9 @@ func detectSRIOV(newDeviceInfo *device.DeviceInfo, sysfsDriverDir string, device
 		return
 	}
 
+	// SR-IOV capable even if VFs cannot be provisioned, e.g. without autoprobe.
+	newDeviceInfo.SRIOVCapable = true
+
 	totalvfsInt, err := strconv.ParseUint(strings.TrimSpace(string(totalvfsByte)), 10, 64)
 	if err != nil {
 		klog.Errorf("Could not convert string into int: %s", string(totalvfsByte))
@@ -200,6 +250,15 @@ func detectSRIOV(newDeviceInfo *device.DeviceInfo, sysfsDriverDir string, device
 
 	klog.V(5).Infof("Detected SR-IOV capacity, max VFs: %v", totalvfsInt)
 
+	numvfsFile := path.Join(sysfsDeviceDir, "sriov_numvfs")
+	if numvfsByte, err := os.ReadFile(numvfsFile); err != nil {
+		klog.V(5).Infof("Could not read numvfs file (%s): %v", numvfsFile, err)
+	} else if numvfsInt, err := strconv.ParseUint(strings.TrimSpace(string(numvfsByte)), 10, 64); err != nil {
+		klog.Errorf("Could not convert string into int: %s", string(numvfsByte))
+	} else {
+		newDeviceInfo.NumVFs = numvfsInt
+	}
+
 	// check if driver will pick up new VFs as DRM devices for dynamic provisioning
 	driversAutoprobeFile := path.Join(sysfsDriverDir, devicePCIAddress, "sriov_drivers_autoprobe")
 	driversAutoprobeByte, err := os.ReadFile(driversAutoprobeFile)
@@ -215,6 +274,7 @@ func detectSRIOV(newDeviceInfo *device.DeviceInfo, sysfsDriverDir string, device
 		return
 	}
 	klog.V(5).Info("Driver autoprobe is enabled, enabling SR-IOV")
+	newDeviceInfo.Autoprobe = true
 	newDeviceInfo.MaxVFs = totalvfsInt
 }
 
@@ -253,14 +313,128 @@ func deduceVfIdx(sysfsDriverDir string, parentDBDF string, vfDBDF string) (uint6
 	return 0, fmt.Errorf("could not find PF %v symlink to VF %v", parentDBDF, vfDBDF)
 }
 
-// Return the amount of local memory the GPU has in MiB.
-func getLocalMemoryAmountMiB(cardIdx uint64, driver string) (uint64, error) {
+// getSubsystemID returns PCI subsystem vendor and device IDs separated with
+// a colon, distinguishing OEM variants of the same GPU model, or empty string
+// if either cannot be read.
+func getSubsystemID(sysfsDeviceDir string) string {
+	subsystemVendor := readOptionalFile(path.Join(sysfsDeviceDir, "subsystem_vendor"))
+	subsystemDevice := readOptionalFile(path.Join(sysfsDeviceDir, "subsystem_device"))
+	if subsystemVendor == "" || subsystemDevice == "" {
+		return ""
+	}
+
+	return subsystemVendor + ":" + subsystemDevice
+}
+
+// readOptionalFile returns trimmed contents of the sysfs file, or empty string
+// if it cannot be read.
+func readOptionalFile(sysfsFile string) string {
+	content, err := os.ReadFile(sysfsFile)
+	if err != nil {
+		klog.V(5).Infof("could not read optional sysfs file: %v", err)
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+// getFrequenciesMHz returns the minimum and maximum GPU frequency, or zeros
+// when the kernel driver does not expose them, which is common for VFs.
+func getFrequenciesMHz(sysfsDeviceDir string, cardIdx uint64, driver string) (int64, int64) {
+	var minFreqFile, maxFreqFile string
+
+	switch driver {
+	case device.SysfsXeDriverName:
+		freqDir := path.Join(sysfsDeviceDir, "tile0", "gt0", "freq0")
+		minFreqFile = path.Join(freqDir, "min_freq")
+		maxFreqFile = path.Join(freqDir, "max_freq")
+	case device.SysfsI915DriverName:
+		cardDir := path.Join(sysfsDeviceDir, "drm", fmt.Sprintf("card%d", cardIdx))
+		minFreqFile = path.Join(cardDir, "gt_min_freq_mhz")
+		maxFreqFile = path.Join(cardDir, "gt_max_freq_mhz")
+	default:
+		return 0, 0
+	}
+
+	minFreq, err := readFrequencyMHz(minFreqFile)
+	if err != nil {
+		klog.V(5).Infof("could not read minimum frequency: %v", err)
+		return 0, 0
+	}
+	maxFreq, err := readFrequencyMHz(maxFreqFile)
+	if err != nil {
+		klog.V(5).Infof("could not read maximum frequency: %v", err)
+		return 0, 0
+	}
+
+	return minFreq, maxFreq
+}
+
+func readFrequencyMHz(freqFile string) (int64, error) {
+	freqBytes, err := os.ReadFile(freqFile)
+	if err != nil {
+		return 0, err
+	}
+
+	freq, err := strconv.ParseInt(strings.TrimSpace(string(freqBytes)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %v: %v", freqFile, err)
+	}
+
+	return freq, nil
+}
+
+// getPowerLimitWatts returns the sustained power limit of the GPU from its
+// hwmon power1_max file in microwatts, or zero when the kernel driver does not
+// expose it, e.g. for integrated GPUs and VFs, or the limit is disabled.
+func getPowerLimitWatts(sysfsDeviceDir string) int64 {
+	powerFiles, err := filepath.Glob(path.Join(sysfsDeviceDir, "hwmon", "hwmon*", "power1_max"))
+	if err != nil || len(powerFiles) == 0 {
+		return 0
+	}
+
+	powerBytes, err := os.ReadFile(powerFiles[0])
+	if err != nil {
+		klog.V(5).Infof("could not read power limit: %v", err)
+		return 0
+	}
+
+	powerMicroWatts, err := strconv.ParseInt(strings.TrimSpace(string(powerBytes)), 10, 64)
+	if err != nil {
+		klog.V(5).Infof("could not parse %v: %v", powerFiles[0], err)
+		return 0
+	}
+
+	return powerMicroWatts / 1000000
+}
+
+// hasActiveDisplay returns true if any DRM connector of the card reports a
+// connected display, e.g. in drm/card0/card0-DP-1/status.
+func hasActiveDisplay(sysfsDeviceDir string, cardIdx uint64) bool {
+	cardName := fmt.Sprintf("card%d", cardIdx)
+	statusFiles, err := filepath.Glob(path.Join(sysfsDeviceDir, "drm", cardName, cardName+"-*", "status"))
+	if err != nil {
+		return false
+	}
+
+	for _, statusFile := range statusFiles {
+		if readOptionalFile(statusFile) == "connected" {
+			klog.V(5).Infof("display connected to %v", path.Dir(statusFile))
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the amount of local memory the GPU has in bytes.
+func getLocalMemoryAmountBytes(cardIdx uint64, driver string) (uint64, error) {
 	klog.V(5).Infof("Getting local memory for card%d with driver %v", cardIdx, driver)
 	switch driver {
 	case device.SysfsXeDriverName:
-		return GetXeDeviceMemoryMiB(path.Join(helpers.GetDevfsRoot(helpers.DevfsEnvVarName, device.DevfsDriPath), device.DevfsDriPath, fmt.Sprintf("card%d", cardIdx)))
+		return GetXeDeviceMemoryBytes(path.Join(helpers.GetDevfsRoot(helpers.DevfsEnvVarName, device.DevfsDriPath), device.DevfsDriPath, fmt.Sprintf("card%d", cardIdx)))
 	case device.SysfsI915DriverName:
-		return GetI915DeviceMemoryMiB(path.Join(helpers.GetDevfsRoot(helpers.DevfsEnvVarName, device.DevfsDriPath), device.DevfsDriPath, fmt.Sprintf("card%d", cardIdx)))
+		return GetI915DeviceMemoryBytes(path.Join(helpers.GetDevfsRoot(helpers.DevfsEnvVarName, device.DevfsDriPath), device.DevfsDriPath, fmt.Sprintf("card%d", cardIdx)))
 	}
 
 	return 0, fmt.Errorf("unknown driver %v, cannot query local memory", driver)
@@ -5,6 +5,7 @@
 package discovery_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
@@ -14,6 +15,7 @@ import (
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/discovery"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 	testhelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
 )
 
@@ -26,19 +28,21 @@ func createFakeSysfsWithSingleGpu(sysfsRoot, devfsRoot string, driver string) er
 		devfsRoot,
 		device.DevicesInfo{
 			"0000-0f-00-0-0x56c0": {
-				Model:      "0x56c0",
-				ModelName:  "Flex 170",
-				FamilyName: "Data Center Flex",
-				PCIAddress: "0000:0f:00.0",
-				MemoryMiB:  8192,
-				DeviceType: "gpu",
-				CardIdx:    0,
-				MEIName:    "mei0",
-				RenderdIdx: 128,
-				Millicores: 1000,
-				UID:        "0000-0f-00-0-0x56c0",
-				MaxVFs:     16,
-				Driver:     driver,
+				Model:         "0x56c0",
+				ModelName:     "Flex 170",
+				FamilyName:    "Data Center Flex",
+				ProductFamily: "Flex",
+				GPUType:       "discrete",
+				PCIAddress:    "0000:0f:00.0",
+				MemoryMiB:     8192,
+				DeviceType:    "gpu",
+				CardIdx:       0,
+				MEIName:       "mei0",
+				RenderdIdx:    128,
+				Millicores:    1000,
+				UID:           "0000-0f-00-0-0x56c0",
+				MaxVFs:        16,
+				Driver:        driver,
 			},
 		},
 		false,
@@ -69,6 +73,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Model:         "0x56c0",
 					ModelName:     "Flex 170",
 					FamilyName:    "Data Center Flex",
+					ProductFamily: "Flex",
+					GPUType:       "discrete",
 					PCIAddress:    "0000:0f:00.0",
 					PCIRoot:       "pci0000:00",
 					MemoryMiB:     0,
@@ -79,6 +85,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Millicores:    1000,
 					UID:           "0000-0f-00-0-0x56c0",
 					MaxVFs:        16,
+					SRIOVCapable:  true,
+					Autoprobe:     true,
 					Driver:        device.SysfsI915DriverName,
 					CurrentDriver: device.SysfsI915DriverName,
 					Health:        device.HealthHealthy,
@@ -96,34 +104,40 @@ func TestDiscoverDevices(t *testing.T) {
 					devfsRoot,
 					device.DevicesInfo{
 						"0000-0f-00-0-0x56c0": {
-							Model:      "0x56c0",
-							ModelName:  "Flex 170",
-							FamilyName: "Data Center Flex",
-							PCIAddress: "0000:0f:00.0",
-							MemoryMiB:  8192,
-							DeviceType: "gpu",
-							CardIdx:    0,
-							MEIName:    "mei0",
-							RenderdIdx: 128,
-							Millicores: 1000,
-							UID:        "0000-0f-00-0-0x56c0",
-							MaxVFs:     16,
-							Driver:     driver,
+							Model:         "0x56c0",
+							ModelName:     "Flex 170",
+							FamilyName:    "Data Center Flex",
+							ProductFamily: "Flex",
+							GPUType:       "discrete",
+							PCIAddress:    "0000:0f:00.0",
+							MemoryMiB:     8192,
+							DeviceType:    "gpu",
+							CardIdx:       0,
+							MEIName:       "mei0",
+							RenderdIdx:    128,
+							Millicores:    1000,
+							UID:           "0000-0f-00-0-0x56c0",
+							MaxVFs:        16,
+							SRIOVCapable:  true,
+							Autoprobe:     true,
+							Driver:        driver,
 						},
 						"0000-0f-00-1-0x56c0": {
-							Model:      "0x56c0",
-							ModelName:  "Flex 170",
-							FamilyName: "Data Center Flex",
-							PCIAddress: "0000:0f:00.1",
-							MemoryMiB:  8192,
-							DeviceType: "vf",
-							ParentUID:  "0000-0f-00-0-0x56c0",
-							CardIdx:    1,
-							RenderdIdx: 129,
-							Millicores: 1000,
-							UID:        "0000-0f-00-1-0x56c0",
-							MaxVFs:     0,
-							Driver:     driver,
+							Model:         "0x56c0",
+							ModelName:     "Flex 170",
+							FamilyName:    "Data Center Flex",
+							ProductFamily: "Flex",
+							GPUType:       "discrete",
+							PCIAddress:    "0000:0f:00.1",
+							MemoryMiB:     8192,
+							DeviceType:    "vf",
+							ParentUID:     "0000-0f-00-0-0x56c0",
+							CardIdx:       1,
+							RenderdIdx:    129,
+							Millicores:    1000,
+							UID:           "0000-0f-00-1-0x56c0",
+							MaxVFs:        0,
+							Driver:        driver,
 						},
 					},
 					false,
@@ -137,6 +151,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Model:         "0x56c0",
 					ModelName:     "Flex 170",
 					FamilyName:    "Data Center Flex",
+					ProductFamily: "Flex",
+					GPUType:       "discrete",
 					PCIAddress:    "0000:0f:00.0",
 					PCIRoot:       "pci0000:00",
 					MemoryMiB:     0,
@@ -147,6 +163,9 @@ func TestDiscoverDevices(t *testing.T) {
 					Millicores:    1000,
 					UID:           "0000-0f-00-0-0x56c0",
 					MaxVFs:        16,
+					SRIOVCapable:  true,
+					Autoprobe:     true,
+					NumVFs:        1,
 					Driver:        device.SysfsI915DriverName,
 					CurrentDriver: device.SysfsI915DriverName,
 					Health:        device.HealthHealthy,
@@ -155,7 +174,10 @@ func TestDiscoverDevices(t *testing.T) {
 					Model:         "0x56c0",
 					ModelName:     "Flex 170",
 					FamilyName:    "Data Center Flex",
+					ProductFamily: "Flex",
+					GPUType:       "discrete",
 					PCIAddress:    "0000:0f:00.1",
+					PCIFunction:   1,
 					PCIRoot:       "pci0000:00",
 					MemoryMiB:     0,
 					DeviceType:    "vf",
@@ -184,6 +206,19 @@ func TestDiscoverDevices(t *testing.T) {
 			},
 			expected: map[string]*device.DeviceInfo{},
 		},
+		{
+			name: "non-Intel device bound to the driver",
+			setupFunc: func(sysfsRoot, devfsRoot string, driver string) error {
+				if driver == "" {
+					driver = device.SysfsI915DriverName
+				}
+				if err := createFakeSysfsWithSingleGpu(sysfsRoot, devfsRoot, driver); err != nil {
+					return err
+				}
+				return os.WriteFile(path.Join(sysfsRoot, device.SysfsPCIBuspath, driver, "0000:0f:00.0", "vendor"), []byte("0x1002"), 0644)
+			},
+			expected: map[string]*device.DeviceInfo{},
+		},
 		{
 			name: "totalvfs read error",
 			setupFunc: func(sysfsRoot, devfsRoot string, driver string) error {
@@ -200,6 +235,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Model:         "0x56c0",
 					ModelName:     "Flex 170",
 					FamilyName:    "Data Center Flex",
+					ProductFamily: "Flex",
+					GPUType:       "discrete",
 					PCIAddress:    "0000:0f:00.0",
 					PCIRoot:       "pci0000:00",
 					MemoryMiB:     0,
@@ -232,6 +269,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Model:         "0x56c0",
 					ModelName:     "Flex 170",
 					FamilyName:    "Data Center Flex",
+					ProductFamily: "Flex",
+					GPUType:       "discrete",
 					PCIAddress:    "0000:0f:00.0",
 					PCIRoot:       "pci0000:00",
 					MemoryMiB:     0,
@@ -242,6 +281,7 @@ func TestDiscoverDevices(t *testing.T) {
 					Millicores:    1000,
 					UID:           "0000-0f-00-0-0x56c0",
 					MaxVFs:        0,
+					SRIOVCapable:  true,
 					Driver:        device.SysfsI915DriverName,
 					CurrentDriver: device.SysfsI915DriverName,
 					Health:        device.HealthHealthy,
@@ -290,6 +330,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Model:         "0x56c0",
 					ModelName:     "Flex 170",
 					FamilyName:    "Data Center Flex",
+					ProductFamily: "Flex",
+					GPUType:       "discrete",
 					PCIAddress:    "0000:0f:00.0",
 					PCIRoot:       "pci0000:00",
 					MemoryMiB:     0,
@@ -300,6 +342,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Millicores:    1000,
 					UID:           "0000-0f-00-0-0x56c0",
 					MaxVFs:        16,
+					SRIOVCapable:  true,
+					Autoprobe:     true,
 					Driver:        device.SysfsI915DriverName,
 					CurrentDriver: device.SysfsI915DriverName,
 					Health:        device.HealthHealthy,
@@ -322,6 +366,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Model:         "0x56c0",
 					ModelName:     "Flex 170",
 					FamilyName:    "Data Center Flex",
+					ProductFamily: "Flex",
+					GPUType:       "discrete",
 					PCIAddress:    "0000:0f:00.0",
 					PCIRoot:       "pci0000:00",
 					MemoryMiB:     0,
@@ -332,6 +378,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Millicores:    1000,
 					UID:           "0000-0f-00-0-0x56c0",
 					MaxVFs:        16,
+					SRIOVCapable:  true,
+					Autoprobe:     true,
 					Driver:        device.SysfsI915DriverName,
 					CurrentDriver: device.SysfsI915DriverName,
 					Health:        device.HealthHealthy,
@@ -347,6 +395,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Model:         "0x56c0",
 					ModelName:     "Flex 170",
 					FamilyName:    "Data Center Flex",
+					ProductFamily: "Flex",
+					GPUType:       "discrete",
 					PCIAddress:    "0000:0f:00.0",
 					PCIRoot:       "pci0000:00",
 					MemoryMiB:     0,
@@ -357,6 +407,8 @@ func TestDiscoverDevices(t *testing.T) {
 					Millicores:    1000,
 					UID:           "0000-0f-00-0-0x56c0",
 					MaxVFs:        16,
+					SRIOVCapable:  true,
+					Autoprobe:     true,
 					Driver:        device.SysfsI915DriverName,
 					CurrentDriver: device.SysfsI915DriverName,
 					Health:        device.HealthHealthy,
@@ -382,7 +434,7 @@ func TestDiscoverDevices(t *testing.T) {
 			}
 
 			// Discover devices.
-			devices := discovery.DiscoverDevices(testDirs.SysfsRoot, tt.namingStyle, false)
+			devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, tt.namingStyle, false, device.SupportedKernelDrivers, false, helpers.DefaultDiscoveryTimeout, nil)
 
 			// Validate results
 			if len(devices) != len(tt.expected) {
@@ -401,3 +453,504 @@ func TestDiscoverDevices(t *testing.T) {
 		})
 	}
 }
+
+func TestDiscoverDevicesKernelDriverSelection(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesKernelDriverSelection", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+
+	if err := createFakeSysfsWithSingleGpu(testDirs.SysfsRoot, testDirs.DevfsRoot, device.SysfsXeDriverName); err != nil {
+		t.Fatalf("could not set up test: %v", err)
+	}
+
+	if devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsI915DriverName}, false, helpers.DefaultDiscoveryTimeout, nil); len(devices) != 0 {
+		t.Errorf("expected no devices with i915-only discovery, got %d", len(devices))
+	}
+	if devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsXeDriverName}, false, helpers.DefaultDiscoveryTimeout, nil); len(devices) != 1 {
+		t.Errorf("expected 1 device with xe-only discovery, got %d", len(devices))
+	}
+}
+
+func TestDiscoverDevicesFrequencies(t *testing.T) {
+	for _, driver := range []string{device.SysfsI915DriverName, device.SysfsXeDriverName} {
+		t.Run(driver, func(t *testing.T) {
+			testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+			defer testhelpers.CleanupTest(t, "TestDiscoverDevicesFrequencies", testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("could not create fake system dirs: %v", err)
+			}
+
+			if err := fakesysfs.FakeSysFsGpuContents(
+				testDirs.SysfsRoot,
+				testDirs.DevfsRoot,
+				device.DevicesInfo{
+					"0000-0f-00-0-0x56c0": {
+						Model: "0x56c0", PCIAddress: "0000:0f:00.0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128,
+						UID: "0000-0f-00-0-0x56c0", Driver: driver, MinFreqMHz: 300, MaxFreqMHz: 2050,
+					},
+					"0000-1f-00-0-0x56c0": {
+						Model: "0x56c0", PCIAddress: "0000:1f:00.0", DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129,
+						UID: "0000-1f-00-0-0x56c0", Driver: driver,
+					},
+				},
+				false,
+			); err != nil {
+				t.Fatalf("could not set up fake sysfs: %v", err)
+			}
+
+			devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{driver}, false, helpers.DefaultDiscoveryTimeout, nil)
+
+			withFreq, found := devices["0000-0f-00-0-0x56c0"]
+			if !found {
+				t.Fatalf("expected device with frequencies not found")
+			}
+			if withFreq.MinFreqMHz != 300 || withFreq.MaxFreqMHz != 2050 {
+				t.Errorf("expected frequencies 300-2050 MHz, got %v-%v MHz", withFreq.MinFreqMHz, withFreq.MaxFreqMHz)
+			}
+
+			withoutFreq, found := devices["0000-1f-00-0-0x56c0"]
+			if !found {
+				t.Fatalf("expected device without frequencies not found")
+			}
+			if withoutFreq.MinFreqMHz != 0 || withoutFreq.MaxFreqMHz != 0 {
+				t.Errorf("expected no frequencies, got %v-%v MHz", withoutFreq.MinFreqMHz, withoutFreq.MaxFreqMHz)
+			}
+		})
+	}
+}
+
+func TestDiscoverDevicesPowerLimit(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesPowerLimit", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x56c0": {
+				Model: "0x56c0", PCIAddress: "0000:0f:00.0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128,
+				UID: "0000-0f-00-0-0x56c0", Driver: device.SysfsXeDriverName, PowerLimitW: 120,
+			},
+			"0000-1f-00-0-0x56c0": {
+				Model: "0x56c0", PCIAddress: "0000:1f:00.0", DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129,
+				UID: "0000-1f-00-0-0x56c0", Driver: device.SysfsXeDriverName,
+			},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("could not set up fake sysfs: %v", err)
+	}
+
+	devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsXeDriverName}, false, helpers.DefaultDiscoveryTimeout, nil)
+
+	withLimit, found := devices["0000-0f-00-0-0x56c0"]
+	if !found {
+		t.Fatalf("expected device with power limit not found")
+	}
+	if withLimit.PowerLimitW != 120 {
+		t.Errorf("expected power limit 120 W, got %v W", withLimit.PowerLimitW)
+	}
+
+	withoutLimit, found := devices["0000-1f-00-0-0x56c0"]
+	if !found {
+		t.Fatalf("expected device without power limit not found")
+	}
+	if withoutLimit.PowerLimitW != 0 {
+		t.Errorf("expected no power limit, got %v W", withoutLimit.PowerLimitW)
+	}
+	// DRM device node indices are published as cardIndex and renderdIndex attributes.
+	if withoutLimit.CardIdx != 1 || withoutLimit.RenderdIdx != 129 {
+		t.Errorf("expected card 1 and renderD 129, got card %v and renderD %v", withoutLimit.CardIdx, withoutLimit.RenderdIdx)
+	}
+}
+
+func TestDiscoverDevicesActiveDisplay(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesActiveDisplay", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x56a0": {
+				Model: "0x56a0", PCIAddress: "0000:0f:00.0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128,
+				UID: "0000-0f-00-0-0x56a0", Driver: device.SysfsXeDriverName, ActiveDisplay: true,
+			},
+			"0000-1f-00-0-0x56a0": {
+				Model: "0x56a0", PCIAddress: "0000:1f:00.0", DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129,
+				UID: "0000-1f-00-0-0x56a0", Driver: device.SysfsXeDriverName,
+			},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("could not set up fake sysfs: %v", err)
+	}
+
+	devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsXeDriverName}, false, helpers.DefaultDiscoveryTimeout, nil)
+
+	for uid, expected := range map[string]bool{"0000-0f-00-0-0x56a0": true, "0000-1f-00-0-0x56a0": false} {
+		gpu, found := devices[uid]
+		if !found {
+			t.Fatalf("expected device %v not found", uid)
+		}
+		if gpu.ActiveDisplay != expected {
+			t.Errorf("expected active display %v for %v, got %v", expected, uid, gpu.ActiveDisplay)
+		}
+	}
+}
+
+func TestDiscoverDevicesModelMillicores(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesModelMillicores", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x56a0": {
+				Model: "0x56a0", PCIAddress: "0000:0f:00.0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128,
+				UID: "0000-0f-00-0-0x56a0", Driver: device.SysfsXeDriverName,
+			},
+			"0000-1f-00-0-0x56c0": {
+				Model: "0x56c0", PCIAddress: "0000:1f:00.0", DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129,
+				UID: "0000-1f-00-0-0x56c0", Driver: device.SysfsXeDriverName,
+			},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("could not set up fake sysfs: %v", err)
+	}
+
+	devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsXeDriverName}, false, helpers.DefaultDiscoveryTimeout, device.ModelMillicores{"0x56a0": 500})
+
+	for uid, expected := range map[string]uint64{"0000-0f-00-0-0x56a0": 500, "0000-1f-00-0-0x56c0": device.DefaultMillicores} {
+		gpu, found := devices[uid]
+		if !found {
+			t.Fatalf("expected device %v not found", uid)
+		}
+		if gpu.Millicores != expected {
+			t.Errorf("expected %v millicores for %v, got %v", expected, uid, gpu.Millicores)
+		}
+	}
+}
+
+func TestDiscoverDevicesSRIOVCapable(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesSRIOVCapable", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x56c0": {
+				Model: "0x56c0", PCIAddress: "0000:0f:00.0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128,
+				UID: "0000-0f-00-0-0x56c0", Driver: device.SysfsI915DriverName, MaxVFs: 16, SRIOVCapable: true,
+			},
+			"0000-1f-00-0-0x56c0": {
+				Model: "0x56c0", PCIAddress: "0000:1f:00.0", DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129,
+				UID: "0000-1f-00-0-0x56c0", Driver: device.SysfsI915DriverName,
+			},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("could not set up fake sysfs: %v", err)
+	}
+
+	devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsI915DriverName}, false, helpers.DefaultDiscoveryTimeout, nil)
+
+	// autoprobe disabled: no VFs can be provisioned, but the device is still SR-IOV capable
+	withoutAutoprobe, found := devices["0000-0f-00-0-0x56c0"]
+	if !found {
+		t.Fatalf("expected SR-IOV capable device not found")
+	}
+	if !withoutAutoprobe.SRIOVCapable || withoutAutoprobe.Autoprobe || withoutAutoprobe.MaxVFs != 0 {
+		t.Errorf("expected SR-IOV capable device without autoprobe and VFs, got capable %v, autoprobe %v, max VFs %v",
+			withoutAutoprobe.SRIOVCapable, withoutAutoprobe.Autoprobe, withoutAutoprobe.MaxVFs)
+	}
+
+	withoutSRIOV, found := devices["0000-1f-00-0-0x56c0"]
+	if !found {
+		t.Fatalf("expected device without SR-IOV not found")
+	}
+	if withoutSRIOV.SRIOVCapable || withoutSRIOV.Autoprobe {
+		t.Errorf("expected device without SR-IOV, got capable %v, autoprobe %v", withoutSRIOV.SRIOVCapable, withoutSRIOV.Autoprobe)
+	}
+}
+
+func TestDiscoverDevicesPCIIdentity(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesPCIIdentity", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x56c0": {
+				Model: "0x56c0", PCIAddress: "0000:0f:00.0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128,
+				UID: "0000-0f-00-0-0x56c0", Driver: device.SysfsXeDriverName, SubsystemID: "0x8086:0x4905", Serial: "LQAC12345678",
+			},
+			"0000-1f-00-0-0x56c0": {
+				Model: "0x56c0", PCIAddress: "0000:1f:00.0", DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129,
+				UID: "0000-1f-00-0-0x56c0", Driver: device.SysfsXeDriverName,
+			},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("could not set up fake sysfs: %v", err)
+	}
+
+	devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsXeDriverName}, false, helpers.DefaultDiscoveryTimeout, nil)
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(devices))
+	}
+
+	withIdentity := devices["0000-0f-00-0-0x56c0"]
+	if withIdentity.SubsystemID != "0x8086:0x4905" || withIdentity.Serial != "LQAC12345678" {
+		t.Errorf("expected subsystem ID 0x8086:0x4905 and serial LQAC12345678, got %q and %q", withIdentity.SubsystemID, withIdentity.Serial)
+	}
+
+	withoutIdentity := devices["0000-1f-00-0-0x56c0"]
+	if withoutIdentity.SubsystemID != "" || withoutIdentity.Serial != "" {
+		t.Errorf("expected no subsystem ID and serial, got %q and %q", withoutIdentity.SubsystemID, withoutIdentity.Serial)
+	}
+}
+
+func TestDiscoverDevicesDiscreteOnly(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesDiscreteOnly", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-00-02-0-0xa7a0": {
+				Model: "0xa7a0", PCIAddress: "0000:00:02.0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128,
+				UID: "0000-00-02-0-0xa7a0", Driver: device.SysfsXeDriverName,
+			},
+			"0000-03-00-0-0x56c0": {
+				Model: "0x56c0", PCIAddress: "0000:03:00.0", DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129,
+				UID: "0000-03-00-0-0x56c0", Driver: device.SysfsXeDriverName,
+			},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("could not set up fake sysfs: %v", err)
+	}
+
+	devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsXeDriverName}, false, helpers.DefaultDiscoveryTimeout, nil)
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(devices))
+	}
+	if gpuType := devices["0000-00-02-0-0xa7a0"].GPUType; gpuType != device.GPUTypeIntegrated {
+		t.Errorf("expected integrated GPU type, got %q", gpuType)
+	}
+	if gpuType := devices["0000-03-00-0-0x56c0"].GPUType; gpuType != device.GPUTypeDiscrete {
+		t.Errorf("expected discrete GPU type, got %q", gpuType)
+	}
+
+	devices = discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsXeDriverName}, true, helpers.DefaultDiscoveryTimeout, nil)
+	if len(devices) != 1 {
+		t.Fatalf("expected 1 device with discrete-only discovery, got %d", len(devices))
+	}
+	if _, found := devices["0000-03-00-0-0x56c0"]; !found {
+		t.Errorf("expected discrete device to be discovered, got %v", devices)
+	}
+}
+
+func TestDiscoverDevicesBoardIDBehindPlatformSwitch(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesBoardIDBehindPlatformSwitch", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-1b-00-0-0x56c1": {
+				Model: "0x56c1", PCIAddress: "0000:1b:00.0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128,
+				UID: "0000-1b-00-0-0x56c1", Driver: device.SysfsXeDriverName,
+			},
+			"0000-1e-00-0-0x56c1": {
+				Model: "0x56c1", PCIAddress: "0000:1e:00.0", DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129,
+				UID: "0000-1e-00-0-0x56c1", Driver: device.SysfsXeDriverName,
+			},
+			"0000-20-00-0-0x56c1": {
+				Model: "0x56c1", PCIAddress: "0000:20:00.0", DeviceType: "gpu", CardIdx: 2, RenderdIdx: 130,
+				UID: "0000-20-00-0-0x56c1", Driver: device.SysfsXeDriverName,
+			},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("could not set up fake sysfs: %v", err)
+	}
+
+	// Two cards with their own PCIe switch, and a card without one, all behind
+	// one platform PCIe switch of another vendor.
+	for pciAddress, bridges := range map[string][]string{
+		"0000:1b:00.0": {"0000:00:02.0", "0000:17:00.0", "0000:18:00.0", "0000:19:00.0", "0000:1a:00.0"},
+		"0000:1e:00.0": {"0000:00:02.0", "0000:17:00.0", "0000:18:01.0", "0000:1c:00.0", "0000:1d:00.0"},
+		"0000:20:00.0": {"0000:00:02.0", "0000:17:00.0", "0000:18:02.0"},
+	} {
+		if err := moveBehindBridges(testDirs.SysfsRoot, device.SysfsXeDriverName, pciAddress, bridges...); err != nil {
+			t.Fatalf("could not move fake GPU %v behind PCI bridges: %v", pciAddress, err)
+		}
+	}
+	for vendor, bridgesList := range map[string][][]string{
+		"0x10b5": {
+			{"0000:00:02.0", "0000:17:00.0"},
+			{"0000:00:02.0", "0000:17:00.0", "0000:18:00.0"},
+			{"0000:00:02.0", "0000:17:00.0", "0000:18:01.0"},
+			{"0000:00:02.0", "0000:17:00.0", "0000:18:02.0"},
+		},
+		helpers.IntelPCIVendorID: {
+			{"0000:00:02.0"},
+			{"0000:00:02.0", "0000:17:00.0", "0000:18:00.0", "0000:19:00.0"},
+			{"0000:00:02.0", "0000:17:00.0", "0000:18:00.0", "0000:19:00.0", "0000:1a:00.0"},
+			{"0000:00:02.0", "0000:17:00.0", "0000:18:01.0", "0000:1c:00.0"},
+			{"0000:00:02.0", "0000:17:00.0", "0000:18:01.0", "0000:1c:00.0", "0000:1d:00.0"},
+		},
+	} {
+		for _, bridges := range bridgesList {
+			if err := setBridgeVendor(testDirs.SysfsRoot, vendor, bridges...); err != nil {
+				t.Fatalf("could not set fake PCI bridge vendor: %v", err)
+			}
+		}
+	}
+
+	devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsXeDriverName}, false, helpers.DefaultDiscoveryTimeout, nil)
+	if len(devices) != 3 {
+		t.Fatalf("expected 3 devices, got %d", len(devices))
+	}
+
+	for uid, expected := range map[string]string{
+		"0000-1b-00-0-0x56c1": "0000:19:00.0",
+		"0000-1e-00-0-0x56c1": "0000:1c:00.0",
+		"0000-20-00-0-0x56c1": "0000:20:00.0",
+	} {
+		if devices[uid].BoardID != expected {
+			t.Errorf("expected board ID %v for %v, got %q", expected, uid, devices[uid].BoardID)
+		}
+	}
+}
+
+// setBridgeVendor sets the PCI vendor of the last of the fake PCI bridges.
+func setBridgeVendor(sysfsRoot string, vendor string, bridges ...string) error {
+	vendorFile := path.Join(sysfsRoot, "devices", "pci0000:00", path.Join(bridges...), "vendor")
+
+	return os.WriteFile(vendorFile, []byte(vendor+"\n"), 0600)
+}
+
+// moveBehindBridges moves the fake PCI device of the GPU behind the given
+// PCI bridges, e.g. ports of a PCIe switch on a multi-GPU board.
+func moveBehindBridges(sysfsRoot string, driver string, pciAddress string, bridges ...string) error {
+	devicesDir := path.Join(sysfsRoot, "devices", "pci0000:00")
+	bridgesPath := path.Join(bridges...)
+	if err := os.MkdirAll(path.Join(devicesDir, bridgesPath), 0750); err != nil {
+		return err
+	}
+	if err := os.Rename(path.Join(devicesDir, pciAddress), path.Join(devicesDir, bridgesPath, pciAddress)); err != nil {
+		return err
+	}
+
+	for linkSource, linkTarget := range map[string]string{
+		path.Join(sysfsRoot, "bus/pci/devices", pciAddress):         path.Join("../../../devices/pci0000:00", bridgesPath, pciAddress),
+		path.Join(sysfsRoot, "bus/pci/drivers", driver, pciAddress): path.Join("../../../../devices/pci0000:00", bridgesPath, pciAddress),
+	} {
+		if err := os.Remove(linkSource); err != nil {
+			return err
+		}
+		if err := os.Symlink(linkTarget, linkSource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestDiscoverDevicesBoardID(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	defer testhelpers.CleanupTest(t, "TestDiscoverDevicesBoardID", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-19-00-0-0x56c1": {
+				Model: "0x56c1", PCIAddress: "0000:19:00.0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128,
+				UID: "0000-19-00-0-0x56c1", Driver: device.SysfsXeDriverName,
+			},
+			"0000-1b-00-0-0x56c1": {
+				Model: "0x56c1", PCIAddress: "0000:1b:00.0", DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129,
+				UID: "0000-1b-00-0-0x56c1", Driver: device.SysfsXeDriverName,
+			},
+			"0000-3a-00-0-0x56c1": {
+				Model: "0x56c1", PCIAddress: "0000:3a:00.0", DeviceType: "gpu", CardIdx: 2, RenderdIdx: 130,
+				UID: "0000-3a-00-0-0x56c1", Driver: device.SysfsXeDriverName,
+			},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("could not set up fake sysfs: %v", err)
+	}
+
+	// Two GPUs sharing the upstream port of the board PCIe switch, and a GPU on another board.
+	for pciAddress, bridges := range map[string][]string{
+		"0000:19:00.0": {"0000:00:02.0", "0000:17:00.0", "0000:18:00.0"},
+		"0000:1b:00.0": {"0000:00:02.0", "0000:17:00.0", "0000:18:01.0"},
+		"0000:3a:00.0": {"0000:00:03.0", "0000:39:00.0"},
+	} {
+		if err := moveBehindBridges(testDirs.SysfsRoot, device.SysfsXeDriverName, pciAddress, bridges...); err != nil {
+			t.Fatalf("could not move fake GPU %v behind PCI bridges: %v", pciAddress, err)
+		}
+	}
+	for _, bridges := range [][]string{
+		{"0000:00:02.0", "0000:17:00.0"},
+		{"0000:00:02.0", "0000:17:00.0", "0000:18:00.0"},
+		{"0000:00:02.0", "0000:17:00.0", "0000:18:01.0"},
+		{"0000:00:03.0", "0000:39:00.0"},
+	} {
+		if err := setBridgeVendor(testDirs.SysfsRoot, helpers.IntelPCIVendorID, bridges...); err != nil {
+			t.Fatalf("could not set fake PCI bridge vendor: %v", err)
+		}
+	}
+
+	devices := discovery.DiscoverDevices(context.TODO(), testDirs.SysfsRoot, device.DefaultNamingStyle, false, []string{device.SysfsXeDriverName}, false, helpers.DefaultDiscoveryTimeout, nil)
+	if len(devices) != 3 {
+		t.Fatalf("expected 3 devices, got %d", len(devices))
+	}
+
+	for uid, expected := range map[string]string{
+		"0000-19-00-0-0x56c1": "0000:17:00.0",
+		"0000-1b-00-0-0x56c1": "0000:17:00.0",
+		"0000-3a-00-0-0x56c1": "0000:39:00.0",
+	} {
+		if devices[uid].BoardID != expected {
+			t.Errorf("expected board ID %v for %v, got %q", expected, uid, devices[uid].BoardID)
+		}
+	}
+}
@@ -109,7 +109,7 @@ func xeDeviceQueryBuf(fd uintptr, queryType uint32) ([]byte, error) {
 	return buf, nil
 }
 
-func xeReadMemoryMiB(fd uintptr) (uint64, error) {
+func xeReadMemoryBytes(fd uintptr) (uint64, error) {
 	klog.V(5).Info("xeReadMemory")
 
 	buf, err := xeDeviceQueryBuf(fd, XeQueryTypeMemRegions)
@@ -137,10 +137,10 @@ func xeReadMemoryMiB(fd uintptr) (uint64, error) {
 		}
 	}
 
-	return totalMemoryBytes / (1024 * 1024), nil
+	return totalMemoryBytes, nil
 }
 
-func i915ReadMemoryMiB(fd uintptr) (uint64, error) {
+func i915ReadMemoryBytes(fd uintptr) (uint64, error) {
 	klog.V(5).Info("i915ReadMemory")
 
 	// Step 1: ask for size with length=0.
@@ -184,12 +184,12 @@ func i915ReadMemoryMiB(fd uintptr) (uint64, error) {
 		}
 	}
 
-	return totalMemoryBytes / (1024 * 1024), nil
+	return totalMemoryBytes, nil
 }
 
-// GetI915DeviceMemoryMiB queries memory for an i915-driver GPU.
+// GetI915DeviceMemoryBytes queries memory in bytes for an i915-driver GPU.
 // Argument drmCardDev is a full path to the DRM device, e.g. /dev/dri/card0.
-func GetI915DeviceMemoryMiB(drmCardDev string) (uint64, error) {
+func GetI915DeviceMemoryBytes(drmCardDev string) (uint64, error) {
 	f, err := openDRMDevice(drmCardDev)
 	if err != nil {
 		return 0, err
@@ -197,12 +197,12 @@ func GetI915DeviceMemoryMiB(drmCardDev string) (uint64, error) {
 	defer f.Close() //nolint:errcheck // DRM device Close does not return meaningful errors
 
 	fd := f.Fd()
-	return i915ReadMemoryMiB(fd)
+	return i915ReadMemoryBytes(fd)
 }
 
-// GetXeDeviceMemoryMiB queries memory for an xe-driver GPU.
+// GetXeDeviceMemoryBytes queries memory in bytes for an xe-driver GPU.
 // Argument drmCardDev is a full path to the DRM device, e.g. /dev/dri/card0.
-func GetXeDeviceMemoryMiB(drmCardDev string) (uint64, error) {
+func GetXeDeviceMemoryBytes(drmCardDev string) (uint64, error) {
 	f, err := openDRMDevice(drmCardDev)
 	if err != nil {
 		return 0, err
@@ -210,7 +210,7 @@ func GetXeDeviceMemoryMiB(drmCardDev string) (uint64, error) {
 	defer f.Close() //nolint:errcheck // DRM device Close does not return meaningful errors
 
 	fd := f.Fd()
-	return xeReadMemoryMiB(fd)
+	return xeReadMemoryBytes(fd)
 }
 
 // openDRMDevice opens the card DRM device node directly.
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+)
+
+const DefaultAllocationHookTimeout = 5 * time.Second
+
+// AllocationHookEvent is the JSON payload sent to the allocation hook.
+type AllocationHookEvent struct {
+	Time      time.Time              `json:"time"`
+	Action    string                 `json:"action"`
+	Driver    string                 `json:"driver"`
+	ClaimUID  string                 `json:"claimUID"`
+	Namespace string                 `json:"namespace,omitempty"`
+	Devices   []AllocationHookDevice `json:"devices"`
+}
+
+// AllocationHookDevice is a device of the prepared or unprepared claim.
+type AllocationHookDevice struct {
+	UID  string `json:"uid"`
+	Pool string `json:"pool"`
+}
+
+// AllocationHook notifies an external system, e.g. billing or quota, when
+// claims are prepared and unprepared. The target is either an http(s) URL,
+// which the event is POSTed to, or an executable, which gets the event on
+// its standard input. A nil AllocationHook does nothing.
+type AllocationHook struct {
+	target     string
+	driverName string
+	timeout    time.Duration
+	client     *http.Client
+}
+
+// NewAllocationHook returns nil if the target is empty, disabling the hook.
+func NewAllocationHook(target string, driverName string, timeout time.Duration) *AllocationHook {
+	if target == "" {
+		return nil
+	}
+
+	return &AllocationHook{
+		target:     target,
+		driverName: driverName,
+		timeout:    timeout,
+		client:     &http.Client{},
+	}
+}
+
+// NotifyPrepareResult invokes the hook with devices of the prepared or
+// unprepared claim. The hook is best-effort: errors are only logged and
+// must not fail device preparation.
+func (h *AllocationHook) NotifyPrepareResult(ctx context.Context, action string, claimUID string, namespace string, result kubeletplugin.PrepareResult) {
+	if h == nil {
+		return
+	}
+
+	devices := []AllocationHookDevice{}
+	for _, preparedDevice := range result.Devices {
+		devices = append(devices, AllocationHookDevice{UID: preparedDevice.DeviceName, Pool: preparedDevice.PoolName})
+	}
+
+	if err := h.Notify(ctx, AllocationHookEvent{
+		Action:    action,
+		ClaimUID:  claimUID,
+		Namespace: namespace,
+		Devices:   devices,
+	}); err != nil {
+		klog.Errorf("allocation hook failed for claim %v: %v", claimUID, err)
+	}
+}
+
+// Notify sends the event to the hook within the hook timeout. The time and
+// the driver name are set if empty.
+func (h *AllocationHook) Notify(ctx context.Context, event AllocationHookEvent) error {
+	if h == nil {
+		return nil
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Driver == "" {
+		event.Driver = h.driverName
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("could not serialize allocation hook event: %v", err)
+	}
+
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	klog.V(5).Infof("Calling allocation hook %v for %v of claim %v", h.target, event.Action, event.ClaimUID)
+	if strings.HasPrefix(h.target, "http://") || strings.HasPrefix(h.target, "https://") {
+		return h.post(ctx, payload)
+	}
+
+	return h.exec(ctx, payload)
+}
+
+func (h *AllocationHook) post(ctx context.Context, payload []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, h.target, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("could not create request to %v: %v", h.target, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not post to %v: %v", h.target, err)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%v responded with %v", h.target, response.Status)
+	}
+
+	return nil
+}
+
+func (h *AllocationHook) exec(ctx context.Context, payload []byte) error {
+	cmd := exec.CommandContext(ctx, h.target)
+	cmd.Stdin = bytes.NewReader(payload)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v failed: %v: %s", h.target, err, bytes.TrimSpace(output))
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+)
+
+func TestAllocationHookHTTP(t *testing.T) {
+	if NewAllocationHook("", "gpu.intel.com", DefaultAllocationHookTimeout) != nil {
+		t.Errorf("expected nil allocation hook for empty target")
+	}
+	var disabled *AllocationHook
+	if err := disabled.Notify(context.Background(), AllocationHookEvent{ClaimUID: "uid0"}); err != nil {
+		t.Errorf("unexpected error from disabled allocation hook: %v", err)
+	}
+
+	events := make(chan AllocationHookEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event AllocationHookEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("could not parse allocation hook event: %v", err)
+		}
+		events <- event
+	}))
+	defer server.Close()
+
+	hook := NewAllocationHook(server.URL, "gpu.intel.com", DefaultAllocationHookTimeout)
+	hook.NotifyPrepareResult(context.Background(), AuditActionPrepare, "uid1", "default", kubeletplugin.PrepareResult{
+		Devices: []kubeletplugin.Device{{DeviceName: "dev1", PoolName: "node1"}},
+	})
+
+	event := <-events
+	if event.Time.IsZero() {
+		t.Errorf("expected time to be set")
+	}
+	expected := AllocationHookEvent{
+		Time:      event.Time,
+		Action:    AuditActionPrepare,
+		Driver:    "gpu.intel.com",
+		ClaimUID:  "uid1",
+		Namespace: "default",
+		Devices:   []AllocationHookDevice{{UID: "dev1", Pool: "node1"}},
+	}
+	if !reflect.DeepEqual(event, expected) {
+		t.Errorf("expected %+v, got %+v", expected, event)
+	}
+}
+
+func TestAllocationHookErrors(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	if err := NewAllocationHook(server.URL, "gpu.intel.com", time.Second).Notify(context.Background(), AllocationHookEvent{}); err == nil {
+		t.Errorf("expected error for non-2xx response")
+	}
+
+	start := time.Now()
+	if err := NewAllocationHook(server.URL+"/slow", "gpu.intel.com", 10*time.Millisecond).Notify(context.Background(), AllocationHookEvent{}); err == nil {
+		t.Errorf("expected error for timed out hook")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hook was not time-bounded, took %v", elapsed)
+	}
+}
+
+func TestAllocationHookExec(t *testing.T) {
+	testDir := t.TempDir()
+	outputPath := path.Join(testDir, "event.json")
+	hookPath := path.Join(testDir, "hook.sh")
+	if err := os.WriteFile(hookPath, []byte("#!/bin/sh\ncat > "+outputPath+"\n"), 0700); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	hook := NewAllocationHook(hookPath, "qat.intel.com", DefaultAllocationHookTimeout)
+	if err := hook.Notify(context.Background(), AllocationHookEvent{Action: AuditActionUnprepare, ClaimUID: "uid1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("hook did not get the event: %v", err)
+	}
+	var event AllocationHookEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("could not parse allocation hook event %q: %v", data, err)
+	}
+	if event.Action != AuditActionUnprepare || event.ClaimUID != "uid1" || event.Driver != "qat.intel.com" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	failing := NewAllocationHook(path.Join(testDir, "missing"), "qat.intel.com", DefaultAllocationHookTimeout)
+	if err := failing.Notify(context.Background(), AllocationHookEvent{}); err == nil {
+		t.Errorf("expected error for missing hook executable")
+	}
+}
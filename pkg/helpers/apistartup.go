@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// DefaultAPIStartupTimeout is how long API calls during driver startup are
+// retried in total by default while the API server is unavailable.
+const DefaultAPIStartupTimeout = 2 * time.Minute
+
+var (
+	apiStartupBaseDelay = time.Second
+	apiStartupMaxDelay  = 15 * time.Second
+)
+
+// APIStartupRetry retries API calls made during driver startup while the API
+// server is unavailable, e.g. during node boot, so that the driver waits out
+// the outage instead of crash-looping. All calls share one deadline, capping
+// the total startup wait. Nil APIStartupRetry calls once without retrying.
+type APIStartupRetry struct {
+	deadline time.Time
+}
+
+// NewAPIStartupRetry returns nil if the timeout is 0, disabling retries.
+func NewAPIStartupRetry(timeout time.Duration) *APIStartupRetry {
+	if timeout <= 0 {
+		return nil
+	}
+
+	return &APIStartupRetry{deadline: time.Now().Add(timeout)}
+}
+
+// Do calls fn until it succeeds, fails with an error other than the API
+// server being unavailable, the startup deadline passes or the context is
+// done. The description tells in logs and errors what was attempted.
+func (r *APIStartupRetry) Do(ctx context.Context, description string, fn func(context.Context) error) error {
+	if r == nil {
+		return fn(ctx)
+	}
+
+	delay := apiStartupBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !IsAPIUnavailable(err) {
+			return err
+		}
+
+		retryDelay := wait.Jitter(delay, republishJitterFactor)
+		if time.Now().Add(retryDelay).After(r.deadline) {
+			return fmt.Errorf("API server unavailable, could not %v after %d attempts: %w", description, attempt, err)
+		}
+
+		klog.Warningf("API server unavailable, retrying to %v in %v: %v", description, retryDelay, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not %v: %v (last error: %w)", description, ctx.Err(), err)
+		case <-time.After(retryDelay):
+		}
+
+		delay = min(2*delay, apiStartupMaxDelay)
+	}
+}
+
+// IsAPIUnavailable returns true for errors of API calls that are likely to
+// succeed when retried later: the API server not being reachable, timing out,
+// throttling or failing internally.
+func IsAPIUnavailable(err error) bool {
+	var netErr net.Error
+	switch {
+	case apierrors.IsServiceUnavailable(err), apierrors.IsServerTimeout(err), apierrors.IsTimeout(err),
+		apierrors.IsTooManyRequests(err), apierrors.IsInternalError(err):
+		return true
+	case utilnet.IsConnectionRefused(err), utilnet.IsConnectionReset(err), utilnet.IsProbableEOF(err):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsTemporary
+}
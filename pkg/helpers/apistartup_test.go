@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestIsAPIUnavailable(t *testing.T) {
+	nodes := schema.GroupResource{Resource: "nodes"}
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "service unavailable", err: apierrors.NewServiceUnavailable("starting"), expected: true},
+		{name: "too many requests", err: apierrors.NewTooManyRequests("throttled", 1), expected: true},
+		{name: "internal error", err: apierrors.NewInternalError(fmt.Errorf("etcd")), expected: true},
+		{name: "connection refused", err: fmt.Errorf("get node: %w", syscall.ECONNREFUSED), expected: true},
+		{name: "not found", err: apierrors.NewNotFound(nodes, "node1"), expected: false},
+		{name: "forbidden", err: apierrors.NewForbidden(nodes, "node1", fmt.Errorf("rbac")), expected: false},
+		{name: "other", err: fmt.Errorf("invalid resources"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if unavailable := IsAPIUnavailable(tt.err); unavailable != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, unavailable)
+			}
+		})
+	}
+}
+
+func TestAPIStartupRetry(t *testing.T) {
+	origBaseDelay := apiStartupBaseDelay
+	t.Cleanup(func() { apiStartupBaseDelay = origBaseDelay })
+	apiStartupBaseDelay = time.Millisecond
+
+	if NewAPIStartupRetry(0) != nil {
+		t.Errorf("expected nil retry for zero timeout")
+	}
+
+	// Fake client with a Node that cannot be fetched twice while the API server is starting.
+	client := kubefake.NewClientset(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	failures := 2
+	client.PrependReactor("get", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, apierrors.NewServiceUnavailable("starting")
+		}
+		return false, nil, nil
+	})
+
+	var disabled *APIStartupRetry
+	reservations := NewReservations("test.intel.com")
+	load := func(ctx context.Context) error {
+		return reservations.Load(ctx, client, "node1")
+	}
+	if err := disabled.Do(context.Background(), "load device reservations", load); err == nil {
+		t.Errorf("expected error without retries")
+	}
+
+	if err := NewAPIStartupRetry(time.Minute).Do(context.Background(), "load device reservations", load); err != nil {
+		t.Errorf("expected node to be fetched after retries, got %v", err)
+	}
+	if failures != 0 {
+		t.Errorf("expected all failures to be retried, %v left", failures)
+	}
+
+	// Errors other than API server unavailability are not retried.
+	attempts := 0
+	notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, "node2")
+	err := NewAPIStartupRetry(time.Minute).Do(context.Background(), "get node", func(context.Context) error {
+		attempts++
+		return notFound
+	})
+	if !apierrors.IsNotFound(err) || attempts != 1 {
+		t.Errorf("expected a single attempt returning not found, got %v attempts and %v", attempts, err)
+	}
+
+	// Total wait is capped by the timeout.
+	attempts = 0
+	err = NewAPIStartupRetry(50*time.Millisecond).Do(context.Background(), "get node", func(context.Context) error {
+		attempts++
+		return apierrors.NewServiceUnavailable("starting")
+	})
+	if !apierrors.IsServiceUnavailable(err) || attempts < 2 {
+		t.Errorf("expected service unavailable after several attempts, got %v attempts and %v", attempts, err)
+	}
+
+	// Canceled context stops retrying.
+	apiStartupBaseDelay = time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = NewAPIStartupRetry(time.Minute).Do(ctx, "get node", func(context.Context) error {
+		return apierrors.NewServiceUnavailable("starting")
+	})
+	if err == nil {
+		t.Error("expected error with canceled context")
+	}
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"strings"
+
+	resourcev1 "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+)
+
+// QualifyAttributeNames prefixes bare attribute names of all devices in the
+// resources with the domain, e.g. model becomes gpu.intel.com/model. Names
+// which already have a domain, e.g. resource.kubernetes.io/pcieRoot, are kept.
+// Bare names are in the driver domain, so CEL selectors keep matching when
+// the domain is the driver name.
+func QualifyAttributeNames(resources resourceslice.DriverResources, domain string) resourceslice.DriverResources {
+	for _, pool := range resources.Pools {
+		for _, slice := range pool.Slices {
+			for i := range slice.Devices {
+				slice.Devices[i].Attributes = qualifyAttributes(slice.Devices[i].Attributes, domain)
+			}
+		}
+	}
+
+	return resources
+}
+
+func qualifyAttributes(attributes map[resourcev1.QualifiedName]resourcev1.DeviceAttribute, domain string) map[resourcev1.QualifiedName]resourcev1.DeviceAttribute {
+	if attributes == nil {
+		return nil
+	}
+
+	qualified := make(map[resourcev1.QualifiedName]resourcev1.DeviceAttribute, len(attributes))
+	for name, attribute := range attributes {
+		if !strings.Contains(string(name), "/") {
+			name = resourcev1.QualifiedName(domain + "/" + string(name))
+		}
+		qualified[name] = attribute
+	}
+
+	return qualified
+}
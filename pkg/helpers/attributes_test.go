@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"reflect"
+	"testing"
+
+	resourcev1 "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+	"k8s.io/utils/ptr"
+)
+
+func TestQualifyAttributeNames(t *testing.T) {
+	resources := resourceslice.DriverResources{Pools: map[string]resourceslice.Pool{
+		"node1": {Slices: []resourceslice.Slice{{Devices: []resourcev1.Device{
+			{
+				Name: "dev1",
+				Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+					"model":                           {StringValue: ptr.To("0x56c0")},
+					"resource.kubernetes.io/pcieRoot": {StringValue: ptr.To("pci0000:00")},
+				},
+			},
+			{Name: "dev2"},
+		}}}},
+	}}
+
+	QualifyAttributeNames(resources, "gpu.intel.com")
+
+	devices := resources.Pools["node1"].Slices[0].Devices
+	expected := map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+		"gpu.intel.com/model":             {StringValue: ptr.To("0x56c0")},
+		"resource.kubernetes.io/pcieRoot": {StringValue: ptr.To("pci0000:00")},
+	}
+	if !reflect.DeepEqual(devices[0].Attributes, expected) {
+		t.Errorf("expected attributes %v, got %v", expected, devices[0].Attributes)
+	}
+	if devices[1].Attributes != nil {
+		t.Errorf("expected no attributes, got %v", devices[1].Attributes)
+	}
+}
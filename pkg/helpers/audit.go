@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+)
+
+const (
+	AuditActionPrepare   = "prepare"
+	AuditActionUnprepare = "unprepare"
+
+	DefaultAuditLogMaxSizeMiB = 10
+)
+
+// AuditRecord is a single line of the allocation audit log.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	ClaimUID  string    `json:"claimUID"`
+	Namespace string    `json:"namespace,omitempty"`
+	Devices   []string  `json:"devices"`
+	// Services of the devices, QAT only.
+	Services string `json:"services,omitempty"`
+}
+
+// AuditLog appends allocation records to a JSONL file. When the file would
+// exceed the maximum size, it is rotated to <path>.1 replacing the previous
+// rotated file. A nil AuditLog does nothing.
+type AuditLog struct {
+	mutex   sync.Mutex
+	path    string
+	maxSize int64
+}
+
+// NewAuditLog returns nil if the path is empty, disabling the audit log.
+func NewAuditLog(path string, maxSizeMiB int) *AuditLog {
+	if path == "" {
+		return nil
+	}
+
+	return &AuditLog{
+		path:    path,
+		maxSize: int64(maxSizeMiB) * 1024 * 1024,
+	}
+}
+
+// RecordPrepareResult records devices of the prepared or unprepared claim.
+// Errors are only logged, audit log must not fail device preparation.
+func (a *AuditLog) RecordPrepareResult(action string, claimUID string, namespace string, result kubeletplugin.PrepareResult, services string) {
+	if a == nil {
+		return
+	}
+
+	devices := []string{}
+	for _, preparedDevice := range result.Devices {
+		devices = append(devices, preparedDevice.DeviceName)
+	}
+
+	if err := a.Record(AuditRecord{
+		Action:    action,
+		ClaimUID:  claimUID,
+		Namespace: namespace,
+		Devices:   devices,
+		Services:  services,
+	}); err != nil {
+		klog.Errorf("could not write audit log: %v", err)
+	}
+}
+
+// Record appends the record to the audit log, the time is set if empty.
+func (a *AuditLog) Record(record AuditRecord) error {
+	if a == nil {
+		return nil
+	}
+
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("could not serialize audit record: %v", err)
+	}
+	line = append(line, '\n')
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.rotateIfNeeded(int64(len(line))); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open audit log %v: %v", a.path, err)
+	}
+
+	if _, err := file.Write(line); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not write audit log %v: %v", a.path, err)
+	}
+
+	return file.Close()
+}
+
+func (a *AuditLog) rotateIfNeeded(lineSize int64) error {
+	if a.maxSize <= 0 {
+		return nil
+	}
+
+	info, err := os.Stat(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("could not stat audit log %v: %v", a.path, err)
+	}
+
+	if info.Size()+lineSize <= a.maxSize {
+		return nil
+	}
+
+	klog.V(5).Infof("Rotating audit log %v", a.path)
+	if err := os.Rename(a.path, a.path+".1"); err != nil {
+		return fmt.Errorf("could not rotate audit log %v: %v", a.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+)
+
+func readAuditRecords(t *testing.T, filePath string) []AuditRecord {
+	t.Helper()
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("could not open audit log: %v", err)
+	}
+	defer file.Close()
+
+	records := []AuditRecord{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("could not parse audit record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func TestAuditLog(t *testing.T) {
+	if NewAuditLog("", DefaultAuditLogMaxSizeMiB) != nil {
+		t.Errorf("expected nil audit log for empty path")
+	}
+	var disabled *AuditLog
+	if err := disabled.Record(AuditRecord{ClaimUID: "uid0"}); err != nil {
+		t.Errorf("unexpected error from disabled audit log: %v", err)
+	}
+
+	auditLogPath := path.Join(t.TempDir(), "audit.jsonl")
+	auditLog := NewAuditLog(auditLogPath, DefaultAuditLogMaxSizeMiB)
+	prepareResult := kubeletplugin.PrepareResult{
+		Devices: []kubeletplugin.Device{{DeviceName: "dev1"}, {DeviceName: "dev2"}},
+	}
+	auditLog.RecordPrepareResult(AuditActionPrepare, "uid1", "default", prepareResult, "sym")
+	auditLog.RecordPrepareResult(AuditActionUnprepare, "uid1", "default", prepareResult, "sym")
+
+	records := readAuditRecords(t, auditLogPath)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 audit records, got %d", len(records))
+	}
+	for i, action := range []string{AuditActionPrepare, AuditActionUnprepare} {
+		if records[i].Time.IsZero() {
+			t.Errorf("record %d: expected time to be set", i)
+		}
+		records[i].Time = records[0].Time
+		expected := AuditRecord{
+			Time:      records[0].Time,
+			Action:    action,
+			ClaimUID:  "uid1",
+			Namespace: "default",
+			Devices:   []string{"dev1", "dev2"},
+			Services:  "sym",
+		}
+		if !reflect.DeepEqual(records[i], expected) {
+			t.Errorf("record %d: expected %+v, got %+v", i, expected, records[i])
+		}
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	auditLogPath := path.Join(t.TempDir(), "audit.jsonl")
+	auditLog := NewAuditLog(auditLogPath, 0)
+	// Room for a single record only.
+	auditLog.maxSize = 150
+
+	for _, claimUID := range []string{"uid1", "uid2", "uid3"} {
+		if err := auditLog.Record(AuditRecord{Action: AuditActionPrepare, ClaimUID: claimUID, Devices: []string{"dev1"}}); err != nil {
+			t.Fatalf("could not record: %v", err)
+		}
+	}
+
+	current := readAuditRecords(t, auditLogPath)
+	if len(current) != 1 || current[0].ClaimUID != "uid3" {
+		t.Errorf("expected only uid3 record in audit log, got %+v", current)
+	}
+	rotated := readAuditRecords(t, auditLogPath+".1")
+	if len(rotated) != 1 || rotated[0].ClaimUID != "uid2" {
+		t.Errorf("expected only uid2 record in rotated audit log, got %+v", rotated)
+	}
+}
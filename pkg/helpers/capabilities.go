@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"k8s.io/klog/v2"
+
+	driverVersion "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/version"
+)
+
+const (
+	CapabilitiesPath = "/capabilities"
+
+	// Features common to all drivers.
+	FeatureAuditLog                = "auditLog"
+	FeatureAllocationHook          = "allocationHook"
+	FeatureQualifiedAttributeNames = "qualifiedAttributeNames"
+	FeatureHealthMonitoring        = "healthMonitoring"
+)
+
+// Capabilities is a self-describing report of the features a running driver
+// supports, for fleet management to reason about mixed driver versions
+// without inspecting the flags on every node.
+type Capabilities struct {
+	Driver    string `json:"driver"`
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	// Features supported by the driver, mapped to whether they are enabled
+	// on this node.
+	Features map[string]bool `json:"features"`
+}
+
+// CapabilitiesGetter is implemented by drivers that can report their
+// capabilities, which are then served on the metrics port.
+type CapabilitiesGetter interface {
+	Capabilities() Capabilities
+}
+
+// NewCapabilities returns the capabilities report of the driver build with
+// given features.
+func NewCapabilities(driverName string, features map[string]bool) Capabilities {
+	return Capabilities{
+		Driver:    driverName,
+		Version:   driverVersion.GetVersion(),
+		GitCommit: driverVersion.GetGitCommit(),
+		Features:  features,
+	}
+}
+
+// WriteCapabilities writes the capabilities as JSON.
+func WriteCapabilities(out io.Writer, capabilities Capabilities) error {
+	data, err := json.MarshalIndent(capabilities, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal capabilities: %v", err)
+	}
+
+	if _, err := out.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("could not write capabilities: %v", err)
+	}
+
+	return nil
+}
+
+// capabilitiesHandler serves the capabilities reported by the getter.
+func capabilitiesHandler(getter CapabilitiesGetter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := WriteCapabilities(w, getter.Capabilities()); err != nil {
+			klog.Errorf("could not serve capabilities: %v", err)
+		}
+	})
+}
@@ -0,0 +1,367 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdiSpecs "tags.cncf.io/container-device-interface/specs-go"
+)
+
+const (
+	// DefaultCDISyncTimeout is how long to wait by default for written CDI
+	// specs to become visible in the CDI cache.
+	DefaultCDISyncTimeout = 5 * time.Second
+
+	cdiSyncPollInterval = 10 * time.Millisecond
+)
+
+var (
+	// DefaultRuntimeConfigFiles are container runtime configuration files that
+	// may set the CDI spec directories.
+	DefaultRuntimeConfigFiles = []string{
+		"/etc/containerd/config.toml",
+		"/etc/crio/crio.conf",
+		"/etc/crio/crio.conf.d/*.conf",
+	}
+
+	// Directories containerd and CRI-O watch when cdi_spec_dirs is not set.
+	defaultRuntimeCDISpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+	cdiSpecDirsRegexp = regexp.MustCompile(`(?s)cdi_spec_dirs\s*=\s*\[(.*?)\]`)
+	quotedRegexp      = regexp.MustCompile(`"([^"]*)"|'([^']*)'`)
+)
+
+// RuntimeCDISpecDirs returns the CDI spec directories configured in the
+// container runtime configuration files matching the glob patterns. The
+// runtime defaults are returned when a configuration file exists without
+// cdi_spec_dirs. Returns false if no configuration file could be read.
+func RuntimeCDISpecDirs(configFiles []string) ([]string, bool) {
+	found := false
+	specDirs := []string{}
+	for _, pattern := range configFiles {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			klog.V(5).Infof("invalid runtime config file pattern %v: %v", pattern, err)
+			continue
+		}
+
+		for _, configFile := range matches {
+			configBytes, err := os.ReadFile(configFile)
+			if err != nil {
+				klog.V(5).Infof("could not read runtime config %v: %v", configFile, err)
+				continue
+			}
+			found = true
+			specDirs = append(specDirs, parseCDISpecDirs(string(configBytes))...)
+		}
+	}
+
+	if found && len(specDirs) == 0 {
+		specDirs = defaultRuntimeCDISpecDirs
+	}
+
+	return specDirs, found
+}
+
+// parseCDISpecDirs returns the cdi_spec_dirs values of a TOML configuration,
+// ignoring commented lines.
+func parseCDISpecDirs(config string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(config, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines = append(lines, line)
+		}
+	}
+
+	specDirs := []string{}
+	for _, match := range cdiSpecDirsRegexp.FindAllStringSubmatch(strings.Join(lines, "\n"), -1) {
+		for _, quoted := range quotedRegexp.FindAllStringSubmatch(match[1], -1) {
+			specDirs = append(specDirs, quoted[1]+quoted[2])
+		}
+	}
+
+	return specDirs
+}
+
+// normalizeCDIDir cleans the path and treats /var/run as /run, which it links
+// to on most distributions.
+func normalizeCDIDir(dir string) string {
+	dir = filepath.Clean(dir)
+	if rest, found := strings.CutPrefix(dir, "/var/run/"); found {
+		return "/run/" + rest
+	}
+	return dir
+}
+
+// CheckCDIRoot warns when the CDI root is not among the spec directories the
+// container runtime watches, in which case containers fail to start with CDI
+// devices not found. Returns false only when a mismatch was detected.
+func CheckCDIRoot(cdiRoot string, runtimeConfigFiles []string) bool {
+	specDirs, found := RuntimeCDISpecDirs(runtimeConfigFiles)
+	if !found {
+		klog.V(3).Infof("Container runtime configuration not found, cannot verify CDI root %v", cdiRoot)
+		return true
+	}
+
+	normalizedSpecDirs := []string{}
+	for _, specDir := range specDirs {
+		normalizedSpecDirs = append(normalizedSpecDirs, normalizeCDIDir(specDir))
+	}
+
+	if slices.Contains(normalizedSpecDirs, normalizeCDIDir(cdiRoot)) {
+		return true
+	}
+
+	klog.Warningf("CDI root %v is not among the CDI spec directories of the container runtime %v, containers will fail to find CDI devices", cdiRoot, specDirs)
+	return false
+}
+
+// CDIErrorReason tells which CDI operation failed.
+type CDIErrorReason string
+
+const (
+	CDISpecWriteFailed       CDIErrorReason = "SpecWriteFailed"
+	CDISpecRemoveFailed      CDIErrorReason = "SpecRemoveFailed"
+	CDIDeviceNotFound        CDIErrorReason = "DeviceNotFound"
+	CDIRegistryRefreshFailed CDIErrorReason = "RegistryRefreshFailed"
+)
+
+var cdiErrorMessages = map[CDIErrorReason]string{
+	CDISpecWriteFailed:       "failed to write CDI spec",
+	CDISpecRemoveFailed:      "failed to remove CDI spec",
+	CDIDeviceNotFound:        "CDI device not found",
+	CDIRegistryRefreshFailed: "failed to refresh CDI registry",
+}
+
+// Sentinel errors to check the reason of a CDIError with errors.Is.
+var (
+	ErrCDISpecWriteFailed       = &CDIError{Reason: CDISpecWriteFailed}
+	ErrCDISpecRemoveFailed      = &CDIError{Reason: CDISpecRemoveFailed}
+	ErrCDIDeviceNotFound        = &CDIError{Reason: CDIDeviceNotFound}
+	ErrCDIRegistryRefreshFailed = &CDIError{Reason: CDIRegistryRefreshFailed}
+)
+
+// CDIError is returned by CDI operations of the CDI helpers, so that callers
+// can tell failure modes apart, e.g. to decide whether to retry. The cause is
+// kept for errors.Is and errors.As.
+type CDIError struct {
+	Reason CDIErrorReason
+	Name   string // CDI spec or device name, empty if not known
+	Err    error
+}
+
+// NewCDIError returns a CDIError for the CDI spec or device name.
+func NewCDIError(reason CDIErrorReason, name string, err error) error {
+	return &CDIError{Reason: reason, Name: name, Err: err}
+}
+
+func (e *CDIError) Error() string {
+	message := cdiErrorMessages[e.Reason]
+	if e.Name != "" {
+		message = fmt.Sprintf("%v %v", message, e.Name)
+	}
+	if e.Err != nil {
+		message = fmt.Sprintf("%v: %v", message, e.Err)
+	}
+
+	return message
+}
+
+func (e *CDIError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any CDIError with the same reason, e.g. ErrCDISpecWriteFailed.
+func (e *CDIError) Is(target error) bool {
+	cdiError, ok := target.(*CDIError)
+	return ok && cdiError.Reason == e.Reason
+}
+
+// RemoveStaleCDIDevices removes CDI devices of given kind (vendor/class) for
+// which isValid returns false. Specs left without devices are deleted. Returns
+// the number of removed devices.
+func RemoveStaleCDIDevices(cdiCache *cdiapi.Cache, cdiKind string, isValid func(deviceName string) bool) (int, error) {
+	vendor, _, found := strings.Cut(cdiKind, "/")
+	if !found {
+		return 0, fmt.Errorf("invalid CDI kind %q, expected vendor/class", cdiKind)
+	}
+
+	removed := 0
+	for _, spec := range cdiCache.GetVendorSpecs(vendor) {
+		if spec.Kind != cdiKind {
+			continue
+		}
+
+		validDevices := []cdiSpecs.Device{}
+		for _, cdiDevice := range spec.Devices {
+			if isValid(cdiDevice.Name) {
+				validDevices = append(validDevices, cdiDevice)
+				continue
+			}
+			klog.V(3).Infof("Removing stale CDI device %v=%v from %v", cdiKind, cdiDevice.Name, spec.GetPath())
+		}
+
+		if len(validDevices) == len(spec.Devices) {
+			continue
+		}
+		removed += len(spec.Devices) - len(validDevices)
+
+		specName := path.Base(spec.GetPath())
+		if len(validDevices) == 0 {
+			if err := cdiCache.RemoveSpec(specName); err != nil {
+				return removed, NewCDIError(CDISpecRemoveFailed, specName, err)
+			}
+			continue
+		}
+
+		spec.Spec.Devices = validDevices
+		if err := cdiCache.WriteSpec(spec.Spec, specName); err != nil {
+			return removed, NewCDIError(CDISpecWriteFailed, specName, err)
+		}
+	}
+
+	return removed, nil
+}
+
+// WaitForCDIDevices waits until the CDI devices with given names of given
+// kind (vendor/class) are visible in the CDI cache, which picks up written
+// specs asynchronously. Returns an error listing the devices still missing
+// once the timeout expires. Zero timeout returns without waiting.
+func WaitForCDIDevices(cdiCache *cdiapi.Cache, cdiKind string, deviceNames []string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		missing := []string{}
+		for _, deviceName := range deviceNames {
+			if cdiCache.GetDevice(cdiKind+"="+deviceName) == nil {
+				missing = append(missing, deviceName)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return NewCDIError(CDIDeviceNotFound, "", fmt.Errorf("CDI devices %v of kind %v not visible in CDI cache after %v", missing, cdiKind, timeout))
+		}
+		time.Sleep(cdiSyncPollInterval)
+	}
+}
+
+// CDIClaimUIDsAnnotation is the CDI device annotation listing the UIDs of the
+// claims a per-claim CDI device was created for, comma-separated.
+const CDIClaimUIDsAnnotation = "intel.com/claim-uids"
+
+// SetCDIClaimOwners records the claims owning the CDI device in its
+// annotations, so that operators inspecting CDI specs can tell which claim a
+// per-claim device belongs to. Annotations do not affect container edits.
+func SetCDIClaimOwners(cdiDevice *cdiSpecs.Device, claimUIDs ...string) {
+	if cdiDevice.Annotations == nil {
+		cdiDevice.Annotations = map[string]string{}
+	}
+	cdiDevice.Annotations[CDIClaimUIDsAnnotation] = strings.Join(claimUIDs, ",")
+}
+
+// CDIClaimOwners returns the UIDs of the claims owning the CDI device, empty
+// for devices not created for particular claims.
+func CDIClaimOwners(cdiDevice *cdiSpecs.Device) []string {
+	claimUIDs := []string{}
+	for _, claimUID := range strings.Split(cdiDevice.Annotations[CDIClaimUIDsAnnotation], ",") {
+		if claimUID != "" {
+			claimUIDs = append(claimUIDs, claimUID)
+		}
+	}
+
+	return claimUIDs
+}
+
+// DeviceNodePermissions are set on the device nodes of CDI devices, e.g. to
+// make them accessible to non-root container users. Unset fields keep the
+// container runtime defaults.
+type DeviceNodePermissions struct {
+	FileMode *os.FileMode
+	UID      *uint32
+	GID      *uint32
+}
+
+// NewDeviceNodePermissions parses the octal file mode and the owner of device
+// nodes. Empty mode and negative UID and GID are left unset.
+func NewDeviceNodePermissions(fileMode string, uid int64, gid int64) (DeviceNodePermissions, error) {
+	permissions := DeviceNodePermissions{}
+
+	if fileMode != "" {
+		mode, err := strconv.ParseUint(fileMode, 8, 32)
+		if err != nil || mode > 0777 {
+			return permissions, fmt.Errorf("invalid device node mode %q, expected octal permission bits, e.g. 0660", fileMode)
+		}
+		deviceNodeMode := os.FileMode(mode)
+		permissions.FileMode = &deviceNodeMode
+	}
+
+	var err error
+	if permissions.UID, err = deviceNodeOwner("UID", uid); err != nil {
+		return permissions, err
+	}
+	if permissions.GID, err = deviceNodeOwner("GID", gid); err != nil {
+		return permissions, err
+	}
+
+	return permissions, nil
+}
+
+// deviceNodeOwner returns nil for negative IDs, which keep the default owner.
+func deviceNodeOwner(name string, id int64) (*uint32, error) {
+	if id < 0 {
+		return nil, nil
+	}
+	if id > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid device node %v %v", name, id)
+	}
+	owner := uint32(id)
+
+	return &owner, nil
+}
+
+// Apply sets the permissions on the CDI device node.
+func (p DeviceNodePermissions) Apply(deviceNode *cdiSpecs.DeviceNode) {
+	if p.FileMode != nil {
+		fileMode := *p.FileMode
+		deviceNode.FileMode = &fileMode
+	}
+	if p.UID != nil {
+		uid := *p.UID
+		deviceNode.UID = &uid
+	}
+	if p.GID != nil {
+		gid := *p.GID
+		deviceNode.GID = &gid
+	}
+}
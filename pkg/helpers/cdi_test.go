@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdiSpecs "tags.cncf.io/container-device-interface/specs-go"
+)
+
+const staleTestSpec = `cdiVersion: 0.5.0
+kind: intel.com/test
+devices:
+- name: device1
+  containerEdits:
+    deviceNodes:
+    - path: /dev/null
+- name: stale1
+  containerEdits:
+    deviceNodes:
+    - path: /dev/null
+`
+
+const onlyStaleTestSpec = `cdiVersion: 0.5.0
+kind: intel.com/test
+devices:
+- name: stale2
+  containerEdits:
+    deviceNodes:
+    - path: /dev/null
+`
+
+const otherKindTestSpec = `cdiVersion: 0.5.0
+kind: intel.com/other
+devices:
+- name: stale3
+  containerEdits:
+    deviceNodes:
+    - path: /dev/null
+`
+
+func TestRemoveStaleCDIDevices(t *testing.T) {
+	cdiRoot := t.TempDir()
+	specs := map[string]string{
+		"intel.com-test.yaml":   staleTestSpec,
+		"intel.com-test-2.yaml": onlyStaleTestSpec,
+		"intel.com-other.yaml":  otherKindTestSpec,
+	}
+	for fileName, content := range specs {
+		if err := os.WriteFile(path.Join(cdiRoot, fileName), []byte(content), 0600); err != nil {
+			t.Fatalf("setup error: %v", err)
+		}
+	}
+
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(cdiRoot), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("could not create CDI cache: %v", err)
+	}
+
+	removed, err := RemoveStaleCDIDevices(cdiCache, "intel.com/test", func(deviceName string) bool {
+		return deviceName == "device1"
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 removed devices, got %d", removed)
+	}
+
+	if err := cdiCache.Refresh(); err != nil {
+		t.Fatalf("could not refresh CDI cache: %v", err)
+	}
+
+	devices := cdiCache.ListDevices()
+	expected := []string{"intel.com/other=stale3", "intel.com/test=device1"}
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("expected CDI devices %v, got %v", expected, devices)
+	}
+
+	if _, err := os.Stat(path.Join(cdiRoot, "intel.com-test-2.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected spec without valid devices to be removed, got %v", err)
+	}
+
+	if _, err := RemoveStaleCDIDevices(cdiCache, "invalid", func(string) bool { return true }); err == nil {
+		t.Errorf("expected error for invalid CDI kind")
+	}
+}
+
+func TestWaitForCDIDevices(t *testing.T) {
+	cdiRoot := t.TempDir()
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(cdiRoot))
+	if err != nil {
+		t.Fatalf("could not create CDI cache: %v", err)
+	}
+
+	// the spec is written after the cache was created and is picked up asynchronously
+	if err := os.WriteFile(path.Join(cdiRoot, "intel.com-test.yaml"), []byte(staleTestSpec), 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if err := WaitForCDIDevices(cdiCache, "intel.com/test", []string{"device1", "stale1"}, DefaultCDISyncTimeout); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = WaitForCDIDevices(cdiCache, "intel.com/test", []string{"device1", "device2"}, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "[device2]") || !errors.Is(err, ErrCDIDeviceNotFound) {
+		t.Errorf("expected device not found error about missing device2, got %v", err)
+	}
+
+	if err := WaitForCDIDevices(cdiCache, "intel.com/test", []string{"device2"}, 0); err != nil {
+		t.Errorf("expected no waiting with zero timeout, got %v", err)
+	}
+}
+
+func TestCDIError(t *testing.T) {
+	cause := os.ErrPermission
+	err := fmt.Errorf("could not sync devices: %w", NewCDIError(CDISpecWriteFailed, "intel.com-test.yaml", cause))
+
+	if expected := "could not sync devices: failed to write CDI spec intel.com-test.yaml: permission denied"; err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err.Error())
+	}
+	if !errors.Is(err, ErrCDISpecWriteFailed) || errors.Is(err, ErrCDISpecRemoveFailed) {
+		t.Errorf("expected only spec write failure to match, got %v", err)
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		t.Error("expected cause to be preserved")
+	}
+
+	var cdiError *CDIError
+	if !errors.As(err, &cdiError) || cdiError.Reason != CDISpecWriteFailed || cdiError.Name != "intel.com-test.yaml" {
+		t.Errorf("expected CDIError with spec name, got %+v", cdiError)
+	}
+}
+
+func TestCheckCDIRoot(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        string
+		cdiRoot       string
+		expectMatch   bool
+		expectDirs    []string
+		noConfigFound bool
+	}{
+		{
+			name:        "runtime defaults",
+			config:      "version = 2\n",
+			cdiRoot:     "/etc/cdi",
+			expectMatch: true,
+			expectDirs:  []string{"/etc/cdi", "/var/run/cdi"},
+		},
+		{
+			name:        "runtime defaults, /run alias",
+			config:      "version = 2\n",
+			cdiRoot:     "/run/cdi/",
+			expectMatch: true,
+			expectDirs:  []string{"/etc/cdi", "/var/run/cdi"},
+		},
+		{
+			name:        "configured dirs match",
+			config:      "[plugins.\"io.containerd.grpc.v1.cri\"]\n  enable_cdi = true\n  cdi_spec_dirs = [\n    \"/opt/cdi\",\n    '/etc/cdi-extra',\n  ]\n",
+			cdiRoot:     "/etc/cdi-extra",
+			expectMatch: true,
+			expectDirs:  []string{"/opt/cdi", "/etc/cdi-extra"},
+		},
+		{
+			name:        "configured dirs mismatch",
+			config:      "cdi_spec_dirs = [\"/opt/cdi\"]\n",
+			cdiRoot:     "/etc/cdi",
+			expectMatch: false,
+			expectDirs:  []string{"/opt/cdi"},
+		},
+		{
+			name:        "commented out dirs",
+			config:      "# cdi_spec_dirs = [\"/opt/cdi\"]\n",
+			cdiRoot:     "/etc/cdi",
+			expectMatch: true,
+			expectDirs:  []string{"/etc/cdi", "/var/run/cdi"},
+		},
+		{
+			name:          "no runtime config",
+			cdiRoot:       "/opt/cdi",
+			expectMatch:   true,
+			expectDirs:    []string{},
+			noConfigFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := path.Join(t.TempDir(), "config.toml")
+			if !tt.noConfigFound {
+				if err := os.WriteFile(configFile, []byte(tt.config), 0600); err != nil {
+					t.Fatalf("setup error: %v", err)
+				}
+			}
+
+			specDirs, found := RuntimeCDISpecDirs([]string{configFile})
+			if found == tt.noConfigFound {
+				t.Errorf("expected config found %v, got %v", !tt.noConfigFound, found)
+			}
+			if !reflect.DeepEqual(specDirs, tt.expectDirs) {
+				t.Errorf("expected spec dirs %v, got %v", tt.expectDirs, specDirs)
+			}
+
+			if match := CheckCDIRoot(tt.cdiRoot, []string{configFile}); match != tt.expectMatch {
+				t.Errorf("expected match %v, got %v", tt.expectMatch, match)
+			}
+		})
+	}
+}
+
+func TestNewDeviceNodePermissions(t *testing.T) {
+	permissions, err := NewDeviceNodePermissions("", -1, -1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deviceNode := &cdiSpecs.DeviceNode{Path: "/dev/test", Type: "c"}
+	permissions.Apply(deviceNode)
+	if deviceNode.FileMode != nil || deviceNode.UID != nil || deviceNode.GID != nil {
+		t.Errorf("expected runtime defaults to be kept, got %+v", deviceNode)
+	}
+
+	permissions, err = NewDeviceNodePermissions("0666", 1000, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	permissions.Apply(deviceNode)
+	if deviceNode.FileMode == nil || *deviceNode.FileMode != 0666 {
+		t.Errorf("expected mode 0666, got %v", deviceNode.FileMode)
+	}
+	if deviceNode.UID == nil || *deviceNode.UID != 1000 {
+		t.Errorf("expected UID 1000, got %v", deviceNode.UID)
+	}
+	if deviceNode.GID == nil || *deviceNode.GID != 0 {
+		t.Errorf("expected GID 0, got %v", deviceNode.GID)
+	}
+
+	for _, invalid := range []struct {
+		fileMode string
+		uid      int64
+	}{{"rw-rw-rw-", -1}, {"1777", -1}, {"", 1 << 32}} {
+		if _, err := NewDeviceNodePermissions(invalid.fileMode, invalid.uid, -1); err == nil {
+			t.Errorf("expected error for mode %q and UID %v", invalid.fileMode, invalid.uid)
+		}
+	}
+}
+
+func TestCDIClaimOwners(t *testing.T) {
+	cdiDevice := &cdiSpecs.Device{Name: "device1"}
+	if owners := CDIClaimOwners(cdiDevice); len(owners) != 0 {
+		t.Errorf("expected no owners, got %v", owners)
+	}
+
+	SetCDIClaimOwners(cdiDevice, "uid1", "uid2")
+	if cdiDevice.Annotations[CDIClaimUIDsAnnotation] != "uid1,uid2" {
+		t.Errorf("unexpected annotations %v", cdiDevice.Annotations)
+	}
+	if owners := CDIClaimOwners(cdiDevice); !reflect.DeepEqual(owners, []string{"uid1", "uid2"}) {
+		t.Errorf("expected owners uid1 and uid2, got %v", owners)
+	}
+
+	spec := &cdiSpecs.Spec{Kind: "intel.com/test", Devices: []cdiSpecs.Device{*cdiDevice}}
+	spec.Devices[0].ContainerEdits.Env = []string{"A=B"}
+	version, err := cdiapi.MinimumRequiredVersion(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	spec.Version = version
+
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(t.TempDir()), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("could not create CDI cache: %v", err)
+	}
+	if err := cdiCache.WriteSpec(spec, "intel.com-test"); err != nil {
+		t.Errorf("annotated CDI spec is invalid: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+// DefaultMaxDevicesPerClaim is well above the number of devices of any single
+// node, while keeping CDI specs and environment variables of a claim bounded.
+const DefaultMaxDevicesPerClaim = 128
+
+// ClaimDeviceCount returns the number of devices of the driver allocated to
+// the claim on any node.
+func ClaimDeviceCount(claim *resourceapi.ResourceClaim, driverName string) int {
+	if claim.Status.Allocation == nil {
+		return 0
+	}
+
+	count := 0
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver == driverName {
+			count++
+		}
+	}
+
+	return count
+}
+
+// CheckClaimDeviceCount returns an error if more than maxDevices devices of
+// the driver are allocated to the claim. Zero maxDevices disables the check.
+func CheckClaimDeviceCount(claim *resourceapi.ResourceClaim, driverName string, maxDevices int) error {
+	if maxDevices <= 0 {
+		return nil
+	}
+
+	if count := ClaimDeviceCount(claim, driverName); count > maxDevices {
+		return fmt.Errorf("claim %v has %d %v devices allocated, more than the maximum of %d devices per claim", claim.UID, count, driverName, maxDevices)
+	}
+
+	return nil
+}
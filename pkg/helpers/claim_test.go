@@ -0,0 +1,46 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+func TestCheckClaimDeviceCount(t *testing.T) {
+	newClaim := func(drivers ...string) *resourceapi.ResourceClaim {
+		claim := &resourceapi.ResourceClaim{}
+		claim.UID = "uid1"
+		claim.Status.Allocation = &resourceapi.AllocationResult{}
+		for _, driver := range drivers {
+			claim.Status.Allocation.Devices.Results = append(claim.Status.Allocation.Devices.Results,
+				resourceapi.DeviceRequestAllocationResult{Driver: driver, Pool: "node1", Device: "dev", Request: "request1"})
+		}
+		return claim
+	}
+
+	tests := []struct {
+		name        string
+		claim       *resourceapi.ResourceClaim
+		maxDevices  int
+		expectError bool
+	}{
+		{name: "no allocation", claim: &resourceapi.ResourceClaim{}, maxDevices: 1},
+		{name: "within limit", claim: newClaim("test.intel.com", "test.intel.com"), maxDevices: 2},
+		{name: "over limit", claim: newClaim("test.intel.com", "test.intel.com", "test.intel.com"), maxDevices: 2, expectError: true},
+		{name: "other driver devices not counted", claim: newClaim("test.intel.com", "other.intel.com", "other.intel.com"), maxDevices: 1},
+		{name: "limit disabled", claim: newClaim("test.intel.com", "test.intel.com", "test.intel.com"), maxDevices: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckClaimDeviceCount(tt.claim, "test.intel.com", tt.maxDevices)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "maximum of 2 devices per claim") {
+				t.Errorf("unexpected error message: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+// ClaimParametersType identifies the opaque device configuration parameters
+// of a driver, e.g. apiVersion "qat.intel.com/v1alpha1" and kind "QATConfig".
+type ClaimParametersType struct {
+	APIVersion string
+	Kind       string
+}
+
+// RequestClaimParameters returns the opaque device configuration parameters of
+// the driver that apply to the claim request, decoded into T. DeviceClass
+// configuration comes first in the claim allocation results, so parameters
+// later in the list override earlier ones.
+func RequestClaimParameters[T any](claim *resourceapi.ResourceClaim, driverName string, parametersType ClaimParametersType, request string) ([]*T, error) {
+	parametersList := []*T{}
+	if claim.Status.Allocation == nil {
+		return parametersList, nil
+	}
+
+	for _, config := range claim.Status.Allocation.Devices.Config {
+		if config.Opaque == nil || config.Opaque.Driver != driverName {
+			continue
+		}
+		if len(config.Requests) > 0 && !slices.Contains(config.Requests, request) {
+			continue
+		}
+
+		parameters, err := ParseClaimParameters[T](config.Opaque.Parameters.Raw, parametersType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v parameters for request '%s': %v", driverName, request, err)
+		}
+		parametersList = append(parametersList, parameters)
+	}
+
+	return parametersList, nil
+}
+
+// ParseClaimParameters decodes the opaque device configuration parameters into
+// T, which must have the apiVersion and kind fields. Unknown fields, and an
+// apiVersion or kind other than of the parameters type, are rejected. Empty
+// apiVersion and kind are accepted.
+func ParseClaimParameters[T any](raw []byte, parametersType ClaimParametersType) (*T, error) {
+	typeMeta := struct {
+		APIVersion string `json:"apiVersion,omitempty"`
+		Kind       string `json:"kind,omitempty"`
+	}{}
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return nil, err
+	}
+	if typeMeta.APIVersion != "" && typeMeta.APIVersion != parametersType.APIVersion {
+		return nil, fmt.Errorf("unsupported apiVersion '%s', expected '%s'", typeMeta.APIVersion, parametersType.APIVersion)
+	}
+	if typeMeta.Kind != "" && typeMeta.Kind != parametersType.Kind {
+		return nil, fmt.Errorf("unsupported kind '%s', expected '%s'", typeMeta.Kind, parametersType.Kind)
+	}
+
+	parameters := new(T)
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(parameters); err != nil {
+		return nil, err
+	}
+
+	return parameters, nil
+}
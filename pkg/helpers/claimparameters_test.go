@@ -0,0 +1,96 @@
+package helpers
+
+import (
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type testClaimParameters struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Option     *bool  `json:"option,omitempty"`
+}
+
+var testClaimParametersType = ClaimParametersType{APIVersion: "test.intel.com/v1alpha1", Kind: "TestConfig"}
+
+func TestRequestClaimParameters(t *testing.T) {
+	opaque := func(driver string, requests []string, raw string) resourceapi.DeviceAllocationConfiguration {
+		return resourceapi.DeviceAllocationConfiguration{
+			Requests: requests,
+			DeviceConfiguration: resourceapi.DeviceConfiguration{
+				Opaque: &resourceapi.OpaqueDeviceConfiguration{Driver: driver, Parameters: runtime.RawExtension{Raw: []byte(raw)}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		configs     []resourceapi.DeviceAllocationConfiguration
+		expected    []bool
+		expectError bool
+	}{
+		{name: "no configuration", expected: []bool{}},
+		{
+			name: "class and claim configuration in order",
+			configs: []resourceapi.DeviceAllocationConfiguration{
+				opaque("test.intel.com", nil, `{"apiVersion": "test.intel.com/v1alpha1", "kind": "TestConfig", "option": true}`),
+				opaque("test.intel.com", []string{"request1"}, `{"option": false}`),
+			},
+			expected: []bool{true, false},
+		},
+		{
+			name: "other drivers and requests skipped",
+			configs: []resourceapi.DeviceAllocationConfiguration{
+				opaque("other.intel.com", nil, `{"other": true}`),
+				opaque("test.intel.com", []string{"request2"}, `{"option": true}`),
+			},
+			expected: []bool{},
+		},
+		{
+			name:        "unknown field",
+			configs:     []resourceapi.DeviceAllocationConfiguration{opaque("test.intel.com", nil, `{"other": true}`)},
+			expectError: true,
+		},
+		{
+			name:        "wrong kind",
+			configs:     []resourceapi.DeviceAllocationConfiguration{opaque("test.intel.com", nil, `{"kind": "OtherConfig"}`)},
+			expectError: true,
+		},
+		{
+			name:        "wrong apiVersion",
+			configs:     []resourceapi.DeviceAllocationConfiguration{opaque("test.intel.com", nil, `{"apiVersion": "test.intel.com/v2"}`)},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := &resourceapi.ResourceClaim{}
+			claim.Status.Allocation = &resourceapi.AllocationResult{}
+			claim.Status.Allocation.Devices.Config = tt.configs
+
+			parametersList, err := RequestClaimParameters[testClaimParameters](claim, "test.intel.com", testClaimParametersType, "request1")
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if err != nil {
+				return
+			}
+
+			options := []bool{}
+			for _, parameters := range parametersList {
+				options = append(options, parameters.Option != nil && *parameters.Option)
+			}
+			if len(options) != len(tt.expected) {
+				t.Fatalf("expected options %v, got %v", tt.expected, options)
+			}
+			for i := range options {
+				if options[i] != tt.expected[i] {
+					t.Errorf("expected options %v, got %v", tt.expected, options)
+				}
+			}
+		})
+	}
+}
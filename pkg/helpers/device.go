@@ -21,6 +21,8 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"k8s.io/klog/v2"
@@ -34,6 +36,17 @@ const (
 	devfsDefaultRoot = "/dev"
 
 	PCIAddressLength = len("0000:00:00.0")
+
+	// SysfsPCIDevicesPath is the sysfs directory of all PCI devices, relative
+	// to the sysfs root.
+	SysfsPCIDevicesPath = "bus/pci/devices"
+
+	// IntelPCIVendorID is the content of the sysfs vendor file of Intel PCI devices.
+	IntelPCIVendorID = "0x8086"
+	// HabanaPCIVendorID is the content of the sysfs vendor file of Habana Labs
+	// (Intel Gaudi) PCI devices.
+	HabanaPCIVendorID = "0x1da3"
+	pciVendorFile     = "vendor"
 )
 
 // GetSysfsRoot tries to get path where sysfs is mounted from the env var,
@@ -71,6 +84,24 @@ func GetDevfsRoot(devfsRootEnvVarName string, devPath string) string {
 	return devfsDefaultRoot
 }
 
+// CheckPCIVendor returns an error if the vendor of the PCI device in the
+// given sysfs device directory is not one of vendorIDs, e.g. when a device of
+// another vendor was bound to the kernel driver.
+func CheckPCIVendor(sysfsDeviceDir string, vendorIDs ...string) error {
+	vendorFile := path.Join(sysfsDeviceDir, pciVendorFile)
+	vendorBytes, err := os.ReadFile(vendorFile)
+	if err != nil {
+		return fmt.Errorf("failed reading PCI vendor file (%s): %v", vendorFile, err)
+	}
+
+	vendor := strings.ToLower(strings.TrimSpace(string(vendorBytes)))
+	if !slices.Contains(vendorIDs, vendor) {
+		return fmt.Errorf("unsupported PCI vendor %v, expected one of %v", vendor, vendorIDs)
+	}
+
+	return nil
+}
+
 func PciInfoFromDeviceUID(deviceUID string) (string, string) {
 	// 0000-00-01-0-0x0000 -> 0000:00:01.0, 0x0000
 	rfc1123PCIaddress := deviceUID[:PCIAddressLength]
@@ -80,24 +111,95 @@ func PciInfoFromDeviceUID(deviceUID string) (string, string) {
 	return pciAddress, deviceId
 }
 
+// NormalizePCIDeviceID returns the PCI device ID in the sysfs format, e.g.
+// 0x56a0. Tools report the ID also without the 0x prefix or in upper case,
+// e.g. 56A0, which would otherwise result in different device UIDs.
+func NormalizePCIDeviceID(pciid string) string {
+	deviceId := strings.ToLower(strings.TrimSpace(pciid))
+	if !strings.HasPrefix(deviceId, "0x") {
+		deviceId = "0x" + deviceId
+	}
+
+	return deviceId
+}
+
 func DeviceUIDFromPCIinfo(pciAddress string, pciid string) string {
 	// 0000:00:01.0, 0x0000 -> 0000-00-01-0-0x0000
 	// Replace colons and the dot in PCI address with hyphens.
 	rfc1123PCIaddress := strings.ReplaceAll(strings.ReplaceAll(pciAddress, ":", "-"), ".", "-")
-	deviceId := pciid
-	if len(deviceId) == 4 {
-		deviceId = "0x" + deviceId
-	}
-	newUID := fmt.Sprintf("%v-%v", rfc1123PCIaddress, deviceId)
+	newUID := fmt.Sprintf("%v-%v", rfc1123PCIaddress, NormalizePCIDeviceID(pciid))
 
 	return newUID
 }
 
+// PCIFunction returns the function number of the PCI address in DBDF
+// notation, e.g. 1 for 0000:00:02.1.
+func PCIFunction(pciAddress string) (int64, error) {
+	_, function, found := strings.Cut(pciAddress, ".")
+	if !found {
+		return 0, fmt.Errorf("no function in PCI address '%v'", pciAddress)
+	}
+
+	functionNumber, err := strconv.ParseInt(function, 10, 64)
+	if err != nil || functionNumber < 0 || functionNumber > 7 {
+		return 0, fmt.Errorf("invalid function in PCI address '%v'", pciAddress)
+	}
+
+	return functionNumber, nil
+}
+
 func DeterminePCIRoot(link string) (string, error) {
+	parts, err := pciDevicePath(link)
+	if err != nil {
+		return "", err
+	}
+
+	return parts[2], nil
+}
+
+// DeterminePCIBoard returns the PCI address of the topmost of the Intel PCI
+// bridges directly above the PCI device, e.g. the upstream port of the PCIe
+// switch of a board hosting multiple GPUs, so that devices on the same board
+// get the same value, also when several boards sit behind one PCIe switch of
+// the platform. The root port is never the board. Returns the device itself
+// when there are no such bridges, and empty string for devices integrated in
+// the root complex.
+func DeterminePCIBoard(link string) (string, error) {
+	parts, err := pciDevicePath(link)
+	if err != nil {
+		return "", err
+	}
+
+	// e.g. [0000:16:02.0 0000:17:00.0 0000:18:00.0 0000:19:00.0], root port first
+	pciDevices := parts[3:]
+	if len(pciDevices) < 2 {
+		return "", nil
+	}
+
+	deviceDir, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return "", fmt.Errorf("could not determine PCI board from '%v': %v", link, err)
+	}
+
+	board := len(pciDevices) - 1
+	for bridgeDir := filepath.Dir(deviceDir); board > 1; bridgeDir = filepath.Dir(bridgeDir) {
+		if CheckPCIVendor(bridgeDir, IntelPCIVendorID) != nil {
+			break
+		}
+		board--
+	}
+
+	return pciDevices[board], nil
+}
+
+// pciDevicePath returns the sysfs path elements of the PCI device, starting
+// from the element before devices, followed by the PCI root and the PCI
+// devices on the path from the root port to the device.
+func pciDevicePath(link string) ([]string, error) {
 	// e.g. /sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/0000:18:00.0/0000:19:00.0
 	linkTarget, err := filepath.EvalSymlinks(link)
 	if err != nil {
-		return "", fmt.Errorf("could not determine PCI root complex ID from '%v': %v", link, err)
+		return nil, fmt.Errorf("could not determine PCI root complex ID from '%v': %v", link, err)
 	}
 	klog.V(5).Infof("PCI device location: %v", linkTarget)
 	parts := strings.Split(linkTarget, "/")
@@ -116,8 +218,8 @@ func DeterminePCIRoot(link string) (string, error) {
 	}
 
 	if len(parts) > 2 && parts[1] == "devices" {
-		return parts[2], nil
+		return parts, nil
 	}
 
-	return "", fmt.Errorf("could not parse sysfs link target %v: %v", linkTarget, parts)
+	return nil, fmt.Errorf("could not parse sysfs link target %v: %v", linkTarget, parts)
 }
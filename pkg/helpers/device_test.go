@@ -154,6 +154,24 @@ func TestDeviceUIDFromPCIinfo(t *testing.T) {
 			pciid:      "0x0000",
 			expected:   "0000-00-01-0-0x0000",
 		},
+		{
+			name:       "PCI ID without prefix",
+			pciAddress: "0000:03:00.0",
+			pciid:      "56a0",
+			expected:   "0000-03-00-0-0x56a0",
+		},
+		{
+			name:       "Upper case PCI ID",
+			pciAddress: "0000:03:00.0",
+			pciid:      "56A0",
+			expected:   "0000-03-00-0-0x56a0",
+		},
+		{
+			name:       "PCI ID with upper case prefix and newline",
+			pciAddress: "0000:03:00.0",
+			pciid:      "0X56A0\n",
+			expected:   "0000-03-00-0-0x56a0",
+		},
 	}
 
 	for _, tt := range tests {
@@ -165,3 +183,63 @@ func TestDeviceUIDFromPCIinfo(t *testing.T) {
 		})
 	}
 }
+
+func TestPCIFunction(t *testing.T) {
+	tests := []struct {
+		name        string
+		pciAddress  string
+		expected    int64
+		expectError bool
+	}{
+		{name: "Function 0", pciAddress: "0000:03:00.0", expected: 0},
+		{name: "Function of integrated GPU VF", pciAddress: "0000:00:02.1", expected: 1},
+		{name: "Last function", pciAddress: "0000:0f:00.7", expected: 7},
+		{name: "No function", pciAddress: "0000:00:02", expectError: true},
+		{name: "Function out of range", pciAddress: "0000:00:02.8", expectError: true},
+		{name: "Not a number", pciAddress: "0000:00:02.x", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := PCIFunction(tt.pciAddress)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCheckPCIVendor(t *testing.T) {
+	tests := []struct {
+		name        string
+		vendor      string
+		vendorIDs   []string
+		expectError bool
+	}{
+		{name: "Intel device", vendor: "0x8086\n", vendorIDs: []string{IntelPCIVendorID}, expectError: false},
+		{name: "Habana device", vendor: "0x1da3\n", vendorIDs: []string{HabanaPCIVendorID}, expectError: false},
+		{name: "Habana device, Intel expected", vendor: "0x1da3\n", vendorIDs: []string{IntelPCIVendorID}, expectError: true},
+		{name: "one of multiple vendors", vendor: "0x1DA3\n", vendorIDs: []string{IntelPCIVendorID, HabanaPCIVendorID}, expectError: false},
+		{name: "other vendor", vendor: "0x10de\n", vendorIDs: []string{IntelPCIVendorID}, expectError: true},
+		{name: "missing vendor file", vendor: "", vendorIDs: []string{IntelPCIVendorID}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deviceDir := t.TempDir()
+			if tt.vendor != "" {
+				if err := os.WriteFile(path.Join(deviceDir, "vendor"), []byte(tt.vendor), 0644); err != nil {
+					t.Fatalf("could not write vendor file: %v", err)
+				}
+			}
+
+			err := CheckPCIVendor(deviceDir, tt.vendorIDs...)
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DefaultRepublishBaseDelay = time.Second
+	DefaultRepublishMaxDelay  = 5 * time.Minute
+	republishJitterFactor     = 0.5
+)
+
+// ErrorHandler implements kubeletplugin.DRAPlugin.HandleError for all drivers.
+// Recoverable errors, e.g. from ResourceSlice publishing, schedule a republish
+// with exponential, jittered backoff. Several errors arriving before the
+// republish happens result in a single republish.
+type ErrorHandler struct {
+	mutex     sync.Mutex
+	republish func(ctx context.Context) error
+	shutdown  func(err error)
+	pending   bool
+	attempts  int
+	lastError time.Time
+
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// NewErrorHandler returns a handler calling republish after recoverable errors,
+// and shutdown, when not nil, after unrecoverable errors.
+func NewErrorHandler(republish func(ctx context.Context) error, shutdown func(err error)) *ErrorHandler {
+	return &ErrorHandler{
+		republish: republish,
+		shutdown:  shutdown,
+		BaseDelay: DefaultRepublishBaseDelay,
+		MaxDelay:  DefaultRepublishMaxDelay,
+	}
+}
+
+// HandleError logs the error and reacts to it depending on whether it is
+// recoverable. Nil handler only logs.
+func (h *ErrorHandler) HandleError(ctx context.Context, err error, message string) {
+	runtime.HandleErrorWithContext(ctx, err, message)
+
+	if h == nil {
+		return
+	}
+
+	if errors.Is(err, kubeletplugin.ErrRecoverable) {
+		h.scheduleRepublish(ctx)
+		return
+	}
+
+	klog.FromContext(ctx).Error(err, "Unrecoverable DRA kubelet plugin error", "message", message)
+	if h.shutdown != nil {
+		h.shutdown(fmt.Errorf("unrecoverable DRA kubelet plugin error: %s: %v", message, err))
+	}
+}
+
+// nextDelay returns the backoff before the next republish. Attempts are reset
+// once no errors were reported for twice the maximum delay.
+func (h *ErrorHandler) nextDelay(now time.Time) time.Duration {
+	if !h.lastError.IsZero() && now.Sub(h.lastError) > 2*h.MaxDelay {
+		h.attempts = 0
+	}
+	h.lastError = now
+
+	delay := h.BaseDelay
+	for i := 0; i < h.attempts && delay < h.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, h.MaxDelay)
+	h.attempts++
+
+	return wait.Jitter(delay, republishJitterFactor)
+}
+
+func (h *ErrorHandler) scheduleRepublish(ctx context.Context) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.pending || h.republish == nil {
+		return
+	}
+	h.pending = true
+
+	delay := h.nextDelay(time.Now())
+	klog.FromContext(ctx).Info("Republishing resources after recoverable error", "delay", delay)
+
+	time.AfterFunc(delay, func() {
+		h.mutex.Lock()
+		h.pending = false
+		h.mutex.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if err := h.republish(ctx); err != nil {
+			klog.FromContext(ctx).Error(err, "Could not republish resources")
+		}
+	})
+}
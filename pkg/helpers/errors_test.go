@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+)
+
+func TestErrorHandlerRepublishesOnce(t *testing.T) {
+	var republished atomic.Int32
+	handler := NewErrorHandler(func(ctx context.Context) error {
+		republished.Add(1)
+		return nil
+	}, nil)
+	handler.BaseDelay = 20 * time.Millisecond
+
+	recoverable := fmt.Errorf("publish failed: %w", kubeletplugin.ErrRecoverable)
+	for i := 0; i < 3; i++ {
+		handler.HandleError(context.Background(), recoverable, "publishing ResourceSlice")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if count := republished.Load(); count != 1 {
+		t.Errorf("expected a single republish for errors within the backoff, got %d", count)
+	}
+
+	handler.HandleError(context.Background(), recoverable, "publishing ResourceSlice")
+	time.Sleep(200 * time.Millisecond)
+	if count := republished.Load(); count != 2 {
+		t.Errorf("expected another republish after a new error, got %d", count)
+	}
+}
+
+func TestErrorHandlerBackoff(t *testing.T) {
+	handler := NewErrorHandler(nil, nil)
+	handler.BaseDelay = time.Second
+	handler.MaxDelay = 8 * time.Second
+
+	now := time.Now()
+	expectedMin := []time.Duration{1, 2, 4, 8, 8}
+	for i, minDelay := range expectedMin {
+		delay := handler.nextDelay(now)
+		minDelay *= time.Second
+		if delay < minDelay || delay > minDelay+minDelay/2 {
+			t.Errorf("attempt %d: expected delay in [%v, %v], got %v", i, minDelay, minDelay+minDelay/2, delay)
+		}
+	}
+
+	// Quiet period longer than twice the maximum delay resets the backoff.
+	if delay := handler.nextDelay(now.Add(time.Minute)); delay > time.Second+time.Second/2 {
+		t.Errorf("expected backoff to be reset, got %v", delay)
+	}
+}
+
+func TestErrorHandlerUnrecoverable(t *testing.T) {
+	var republished atomic.Int32
+	var shutdownErr error
+	handler := NewErrorHandler(func(ctx context.Context) error {
+		republished.Add(1)
+		return nil
+	}, func(err error) {
+		shutdownErr = err
+	})
+	handler.BaseDelay = time.Millisecond
+
+	handler.HandleError(context.Background(), fmt.Errorf("invalid slice"), "publishing ResourceSlice")
+	time.Sleep(50 * time.Millisecond)
+	if count := republished.Load(); count != 0 {
+		t.Errorf("expected no republish for unrecoverable error, got %d", count)
+	}
+	if shutdownErr == nil || !strings.Contains(shutdownErr.Error(), "invalid slice") {
+		t.Errorf("expected shutdown with the unrecoverable error, got %v", shutdownErr)
+	}
+
+	shutdownErr = nil
+	handler.HandleError(context.Background(), fmt.Errorf("publish failed: %w", kubeletplugin.ErrRecoverable), "publishing ResourceSlice")
+	if shutdownErr != nil {
+		t.Errorf("unexpected shutdown for recoverable error: %v", shutdownErr)
+	}
+
+	// Without shutdown, and with nil handler, unrecoverable errors are only logged.
+	NewErrorHandler(nil, nil).HandleError(context.Background(), fmt.Errorf("invalid slice"), "publishing ResourceSlice")
+	var nilHandler *ErrorHandler
+	nilHandler.HandleError(context.Background(), fmt.Errorf("invalid slice"), "publishing ResourceSlice")
+}
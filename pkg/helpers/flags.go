@@ -112,6 +112,49 @@ func (k *KubeClientConfig) NewClientSets() (ClientSets, error) {
 	}, nil
 }
 
+// DeviceNodeConfig holds the flags setting the permissions of device nodes
+// in CDI specs.
+type DeviceNodeConfig struct {
+	FileMode string
+	UID      int64
+	GID      int64
+}
+
+func (d *DeviceNodeConfig) Flags() []cli.Flag {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Category:    "Device nodes:",
+			Name:        "device-node-mode",
+			Usage:       "Octal file `MODE` of device nodes in containers, e.g. 0666. Empty keeps the container runtime default.",
+			Destination: &d.FileMode,
+			EnvVars:     []string{"DEVICE_NODE_MODE"},
+		},
+		&cli.Int64Flag{
+			Category:    "Device nodes:",
+			Name:        "device-node-uid",
+			Usage:       "`UID` owning device nodes in containers. -1 keeps the container runtime default.",
+			Value:       -1,
+			Destination: &d.UID,
+			EnvVars:     []string{"DEVICE_NODE_UID"},
+		},
+		&cli.Int64Flag{
+			Category:    "Device nodes:",
+			Name:        "device-node-gid",
+			Usage:       "`GID` owning device nodes in containers. -1 keeps the container runtime default.",
+			Value:       -1,
+			Destination: &d.GID,
+			EnvVars:     []string{"DEVICE_NODE_GID"},
+		},
+	}
+
+	return flags
+}
+
+// Permissions parses the flags into device node permissions.
+func (d *DeviceNodeConfig) Permissions() (DeviceNodePermissions, error) {
+	return NewDeviceNodePermissions(d.FileMode, d.UID, d.GID)
+}
+
 type LoggingConfig struct {
 	featureGate featuregate.MutableFeatureGate
 	config      *logsapi.LoggingConfiguration
@@ -25,6 +25,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	coreclientset "k8s.io/client-go/kubernetes"
@@ -54,34 +55,90 @@ type Flags struct {
 	KubeletPluginsRegistryDir string
 
 	CdiRoot string
+
+	MetricsPort int
+
+	AuditLogPath       string
+	AuditLogMaxSizeMiB int
+
+	// Executable or http(s) URL notified of every claim preparation and unpreparation.
+	AllocationHook        string
+	AllocationHookTimeout time.Duration
+
+	DiscoveryTimeout time.Duration
+
+	// Claims with more devices are rejected in Prepare, 0 disables the limit.
+	MaxDevicesPerClaim int
+
+	// Shut the driver down on unrecoverable kubelet plugin errors.
+	ExitOnFatalError bool
+
+	// Keep prepared claims in memory only if the kubelet plugin directory is read-only.
+	InMemoryFallback bool
+
+	// Publish device attribute names prefixed with the driver name.
+	QualifiedAttributeNames bool
+
+	// How often prepared claims are reconciled with CDI specs, 0 disables it.
+	ReconcileInterval time.Duration
+
+	// How often device nodes of devices withheld from ResourceSlice are checked, 0 disables the readiness gate.
+	DeviceReadinessInterval time.Duration
+
+	// How often resources are compared with the published ones and republished if changed, 0 disables it.
+	RepublishInterval time.Duration
+
+	// Maximum time to wait for written CDI specs to show up in the CDI cache, 0 does not wait.
+	CDISyncTimeout time.Duration
+
+	// Maximum time the driver cleanup may take on shutdown, 0 disables the timeout.
+	ShutdownTimeout time.Duration
+
+	// How long starting the kubelet plugin is retried, 0 disables retries.
+	KubeletPluginStartTimeout time.Duration
+
+	// How long API calls during startup are retried in total while the API server is unavailable, 0 disables retries.
+	APIStartupTimeout time.Duration
+
+	// Print resources that would be published and exit.
+	Oneshot       bool
+	OneshotFormat string
 }
 
 type Config struct {
 	CommonFlags *Flags
 	Coreclient  coreclientset.Interface
 	DriverFlags interface{}
+
+	// Cancels the context of the driver with the cause, set by StartPlugin.
+	shutdown context.CancelCauseFunc
 }
 
 func NewApp(driverName string, newDriver func(ctx context.Context, config *Config) (Driver, error), driverCliFlags []cli.Flag, driverConfigFlags interface{}) *cli.App {
-	nodeName, nodeNameFound := os.LookupEnv("NODE_NAME")
-	if !nodeNameFound {
-		nodeName = "127.0.0.1"
-	}
-
 	flags := &Flags{
 		loggingConfig:             NewLoggingConfig(),
-		NodeName:                  nodeName,
 		CdiRoot:                   DefaultCDIRoot,
 		KubeletPluginDir:          filepath.Join(DefaultKubeletPluginDir, driverName),
 		KubeletPluginsRegistryDir: DefaultKubeletPluginsRegistryDir,
+		AuditLogMaxSizeMiB:        DefaultAuditLogMaxSizeMiB,
+		DiscoveryTimeout:          DefaultDiscoveryTimeout,
+		MaxDevicesPerClaim:        DefaultMaxDevicesPerClaim,
+		ReconcileInterval:         DefaultReconcileInterval,
+		DeviceReadinessInterval:   DefaultDeviceReadinessInterval,
+		RepublishInterval:         DefaultRepublishInterval,
+		CDISyncTimeout:            DefaultCDISyncTimeout,
+		ShutdownTimeout:           DefaultShutdownTimeout,
+		KubeletPluginStartTimeout: DefaultKubeletPluginStartTimeout,
+		APIStartupTimeout:         DefaultAPIStartupTimeout,
+		AllocationHookTimeout:     DefaultAllocationHookTimeout,
+		OneshotFormat:             OneshotFormatYAML,
 	}
 	cliFlags := []cli.Flag{
 		&cli.StringFlag{
 			Name:        "node-name",
-			Usage:       "The name of the node to be worked on.",
-			Required:    true,
+			Usage:       "The name of the node to be worked on. Defaults to the hostname.",
 			Destination: &flags.NodeName,
-			EnvVars:     []string{"NODE_NAME"},
+			EnvVars:     []string{NodeNameEnvVarName},
 		},
 		&cli.StringFlag{
 			Name:        "cdi-root",
@@ -90,6 +147,133 @@ func NewApp(driverName string, newDriver func(ctx context.Context, config *Confi
 			Destination: &flags.CdiRoot,
 			EnvVars:     []string{"CDI_ROOT"},
 		},
+		&cli.IntFlag{
+			Name:        "metrics-port",
+			Usage:       "Port to serve Prometheus metrics on at " + MetricsPath + ". Set to 0 to disable.",
+			Value:       0,
+			Destination: &flags.MetricsPort,
+			EnvVars:     []string{"METRICS_PORT"},
+		},
+		&cli.StringFlag{
+			Name:        "audit-log",
+			Usage:       "Path to the JSONL file where every claim preparation and unpreparation is recorded. Empty disables the audit log.",
+			Destination: &flags.AuditLogPath,
+			EnvVars:     []string{"AUDIT_LOG"},
+		},
+		&cli.IntFlag{
+			Name:        "audit-log-max-size",
+			Usage:       "Maximum size of the audit log in MiB, after which it is rotated to <audit-log>.1.",
+			Value:       DefaultAuditLogMaxSizeMiB,
+			Destination: &flags.AuditLogMaxSizeMiB,
+			EnvVars:     []string{"AUDIT_LOG_MAX_SIZE"},
+		},
+		&cli.StringFlag{
+			Name:        "allocation-hook",
+			Usage:       "Executable or http(s) URL notified of every claim preparation and unpreparation, e.g. for billing or quota. The executable gets the JSON event on its standard input, the URL gets it POSTed. Failures are logged and do not fail the claim. Empty disables the hook.",
+			Destination: &flags.AllocationHook,
+			EnvVars:     []string{"ALLOCATION_HOOK"},
+		},
+		&cli.DurationFlag{
+			Name:        "allocation-hook-timeout",
+			Usage:       "Maximum time a single allocation hook call may take. 0 disables the timeout.",
+			Value:       DefaultAllocationHookTimeout,
+			Destination: &flags.AllocationHookTimeout,
+			EnvVars:     []string{"ALLOCATION_HOOK_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "discovery-timeout",
+			Usage:       "Maximum time discovery of a single device may take, devices not responding in time are skipped. 0 disables the timeout.",
+			Value:       DefaultDiscoveryTimeout,
+			Destination: &flags.DiscoveryTimeout,
+			EnvVars:     []string{"DISCOVERY_TIMEOUT"},
+		},
+		&cli.IntFlag{
+			Name:        "max-devices-per-claim",
+			Usage:       "Reject claims with more devices of the driver allocated than this. 0 disables the limit.",
+			Value:       DefaultMaxDevicesPerClaim,
+			Destination: &flags.MaxDevicesPerClaim,
+			EnvVars:     []string{"MAX_DEVICES_PER_CLAIM"},
+		},
+		&cli.BoolFlag{
+			Name:        "exit-on-fatal-error",
+			Usage:       "Shut the driver down gracefully and exit with an error when the kubelet plugin reports an unrecoverable error, e.g. ResourceSlice failing validation.",
+			Destination: &flags.ExitOnFatalError,
+			EnvVars:     []string{"EXIT_ON_FATAL_ERROR"},
+		},
+		&cli.BoolFlag{
+			Name:        "in-memory-fallback",
+			Usage:       "Keep prepared claims in memory only when the kubelet plugin directory is on a read-only filesystem, instead of failing. Prepared claims are lost on driver restart.",
+			Destination: &flags.InMemoryFallback,
+			EnvVars:     []string{"IN_MEMORY_FALLBACK"},
+		},
+		&cli.BoolFlag{
+			Name:        "qualified-attribute-names",
+			Usage:       "Publish device attribute names prefixed with the driver name, e.g. '" + driverName + "/model' instead of 'model'. Selectors using the driver name as attribute domain match both.",
+			Destination: &flags.QualifiedAttributeNames,
+			EnvVars:     []string{"QUALIFIED_ATTRIBUTE_NAMES"},
+		},
+		&cli.DurationFlag{
+			Name:        "reconcile-interval",
+			Usage:       "How often to repair drift between prepared claims and CDI specs: recreate missing CDI devices, drop claims whose devices are gone and remove stale CDI devices. 0 disables it.",
+			Value:       DefaultReconcileInterval,
+			Destination: &flags.ReconcileInterval,
+			EnvVars:     []string{"RECONCILE_INTERVAL"},
+		},
+		&cli.DurationFlag{
+			Name:        "device-readiness-interval",
+			Usage:       "How often to check device nodes of devices withheld from ResourceSlice because their CDI device nodes do not exist yet, and republish them once they do. 0 disables withholding devices.",
+			Value:       DefaultDeviceReadinessInterval,
+			Destination: &flags.DeviceReadinessInterval,
+			EnvVars:     []string{"DEVICE_READINESS_INTERVAL"},
+		},
+		&cli.DurationFlag{
+			Name:        "republish-interval",
+			Usage:       "How often to recompute published resources and republish ResourceSlice if they changed since last published, in case a republish was missed. 0 disables it.",
+			Value:       DefaultRepublishInterval,
+			Destination: &flags.RepublishInterval,
+			EnvVars:     []string{"REPUBLISH_INTERVAL"},
+		},
+		&cli.DurationFlag{
+			Name:        "cdi-sync-timeout",
+			Usage:       "Maximum time to wait for written CDI specs to become visible in the CDI cache before using them. 0 does not wait.",
+			Value:       DefaultCDISyncTimeout,
+			Destination: &flags.CDISyncTimeout,
+			EnvVars:     []string{"CDI_SYNC_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "shutdown-timeout",
+			Usage:       "Maximum time the driver cleanup may take on shutdown, e.g. disabling VFs, after which it is abandoned so that the process exits within the termination grace period. 0 disables the timeout.",
+			Value:       DefaultShutdownTimeout,
+			Destination: &flags.ShutdownTimeout,
+			EnvVars:     []string{"SHUTDOWN_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "kubelet-plugin-start-timeout",
+			Usage:       "How long to retry starting the kubelet plugin, e.g. while the kubelet plugin registry is not ready during node boot, before giving up. 0 disables retries.",
+			Value:       DefaultKubeletPluginStartTimeout,
+			Destination: &flags.KubeletPluginStartTimeout,
+			EnvVars:     []string{"KUBELET_PLUGIN_START_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "api-startup-timeout",
+			Usage:       "How long to retry API calls during startup in total, e.g. while the API server is unavailable during node boot, before giving up. 0 disables retries.",
+			Value:       DefaultAPIStartupTimeout,
+			Destination: &flags.APIStartupTimeout,
+			EnvVars:     []string{"API_STARTUP_TIMEOUT"},
+		},
+		&cli.BoolFlag{
+			Name:        "oneshot",
+			Usage:       "Discover devices, print the resources that would be published in ResourceSlice and exit, without contacting the API server.",
+			Destination: &flags.Oneshot,
+			EnvVars:     []string{"ONESHOT"},
+		},
+		&cli.StringFlag{
+			Name:        "oneshot-format",
+			Usage:       fmt.Sprintf("Output format of --oneshot: %v or %v.", OneshotFormatYAML, OneshotFormatJSON),
+			Value:       OneshotFormatYAML,
+			Destination: &flags.OneshotFormat,
+			EnvVars:     []string{"ONESHOT_FORMAT"},
+		},
 	}
 	cliFlags = append(cliFlags, driverCliFlags...)
 	cliFlags = append(cliFlags, flags.kubeClientConfig.Flags()...)
@@ -109,6 +293,22 @@ func NewApp(driverName string, newDriver func(ctx context.Context, config *Confi
 		},
 		Action: func(c *cli.Context) error {
 			ctx := c.Context
+
+			nodeName, err := ResolveNodeName(flags.NodeName)
+			if err != nil {
+				return err
+			}
+			flags.NodeName = nodeName
+
+			if flags.Oneshot {
+				config := &Config{
+					CommonFlags: flags,
+					DriverFlags: driverConfigFlags,
+				}
+
+				return RunOneshot(ctx, config, newDriver, os.Stdout)
+			}
+
 			clientSets, err := flags.kubeClientConfig.NewClientSets()
 			if err != nil {
 				return fmt.Errorf("create client: %v", err)
@@ -128,39 +328,70 @@ func NewApp(driverName string, newDriver func(ctx context.Context, config *Confi
 }
 
 func StartPlugin(ctx context.Context, config *Config, newDriver func(ctx context.Context, config *Config) (Driver, error)) error {
-	err := os.MkdirAll(config.CommonFlags.KubeletPluginDir, 0750)
-	if err != nil {
+	if err := prepareDirectories(config); err != nil {
 		return err
 	}
 
-	info, err := os.Stat(config.CommonFlags.CdiRoot)
-	switch {
-	case err != nil && os.IsNotExist(err):
-		err := os.MkdirAll(config.CommonFlags.CdiRoot, 0750)
-		if err != nil {
-			return err
-		}
-	case err != nil:
+	if err := config.Validate(); err != nil {
 		return err
-	case !info.IsDir():
-		return fmt.Errorf("path for CDI file generation is not a directory: '%v'", err)
 	}
 
+	ctx, config.shutdown = context.WithCancelCause(ctx)
+	defer config.shutdown(nil)
+
 	driver, err := newDriver(ctx, config)
 	if err != nil {
 		return err
 	}
 
+	metricsCtx, stopMetrics := context.WithCancel(ctx)
+	defer stopMetrics()
+	if err := StartMetricsServer(metricsCtx, config.CommonFlags.MetricsPort, driver); err != nil {
+		klog.Errorf("Could not start metrics server: %v", err)
+	}
+
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	signum := <-sigc
 
-	klog.Infof("Received signal %d, exiting.", signum)
-	err = driver.Shutdown(ctx)
+	var fatalErr error
+	select {
+	case signum := <-sigc:
+		klog.Infof("Received signal %d, exiting.", signum)
+	case <-ctx.Done():
+		fatalErr = context.Cause(ctx)
+		klog.Errorf("Shutting down: %v", fatalErr)
+	}
+
+	shutdownCtx, cancel := shutdownContext(ctx, config.CommonFlags.ShutdownTimeout)
+	defer cancel()
+	err = driver.Shutdown(shutdownCtx)
 	if err != nil {
 		klog.FromContext(ctx).Error(err, "Unable to cleanly shutdown driver")
 	}
 
+	return fatalErr
+}
+
+// prepareDirectories creates the kubelet plugin and CDI directories if needed.
+func prepareDirectories(config *Config) error {
+	err := os.MkdirAll(config.CommonFlags.KubeletPluginDir, 0750)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(config.CommonFlags.CdiRoot)
+	switch {
+	case err != nil && os.IsNotExist(err):
+		err := os.MkdirAll(config.CommonFlags.CdiRoot, 0750)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case !info.IsDir():
+		return fmt.Errorf("path for CDI file generation is not a directory: '%v'", err)
+	}
+
 	return nil
 }
 
@@ -159,3 +159,48 @@ func TestStartPlugin(t *testing.T) {
 		})
 	}
 }
+
+func TestStartPluginExitOnFatalError(t *testing.T) {
+	for _, exitOnFatalError := range []bool{false, true} {
+		config := &Config{
+			CommonFlags: &Flags{
+				KubeletPluginDir: t.TempDir(),
+				CdiRoot:          t.TempDir(),
+				ExitOnFatalError: exitOnFatalError,
+			},
+		}
+
+		var shutdownDriver bool
+		newDriver := func(ctx context.Context, config *Config) (Driver, error) {
+			shutdown := config.ShutdownOnFatalError()
+			if (shutdown != nil) != exitOnFatalError {
+				t.Fatalf("exitOnFatalError %v: unexpected shutdown function %v", exitOnFatalError, shutdown != nil)
+			}
+			if shutdown == nil {
+				return nil, fmt.Errorf("not started")
+			}
+			shutdown(fmt.Errorf("invalid slice"))
+			return &shutdownTrackingDriver{shutdown: &shutdownDriver}, nil
+		}
+
+		err := StartPlugin(context.Background(), config, newDriver)
+		if !exitOnFatalError {
+			continue
+		}
+		if err == nil || err.Error() != "invalid slice" {
+			t.Errorf("expected StartPlugin to return the fatal error, got %v", err)
+		}
+		if !shutdownDriver {
+			t.Error("expected driver to be shut down")
+		}
+	}
+}
+
+type shutdownTrackingDriver struct {
+	shutdown *bool
+}
+
+func (d *shutdownTrackingDriver) Shutdown(ctx context.Context) error {
+	*d.shutdown = true
+	return nil
+}
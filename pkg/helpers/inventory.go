@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	InventoryChangeAdded         = "added"
+	InventoryChangeRemoved       = "removed"
+	InventoryChangeHealthChanged = "healthChanged"
+	InventoryChangeChanged       = "changed"
+)
+
+// inventoryHealthAttributes are the DeviceSnapshot attributes holding device
+// health, changes of those are reported separately from other changes.
+var inventoryHealthAttributes = []string{"health", "healthy"}
+
+var (
+	// inventoryChanges is nil until RegisterInventoryMetrics is called.
+	inventoryChanges atomic.Pointer[metrics.CounterVec]
+
+	registerInventoryMetricsOnce sync.Once
+)
+
+// InventoryDiff lists UIDs of devices that changed between two snapshots of
+// the allocatable devices.
+type InventoryDiff struct {
+	Added         []string
+	Removed       []string
+	HealthChanged []string
+	// Devices with other attributes changed, e.g. the bound kernel driver.
+	Changed []string
+}
+
+// RegisterInventoryMetrics registers the device inventory changes counter
+// under the metrics namespace of the driver, e.g.
+// gpu_device_inventory_changes_total. Only the first registration in the
+// process takes effect.
+func RegisterInventoryMetrics(namespace string) {
+	registerInventoryMetricsOnce.Do(func() {
+		counter := metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      namespace,
+				Name:           "device_inventory_changes_total",
+				Help:           "Number of allocatable devices added, removed, or changed health or other attributes.",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"change"},
+		)
+		legacyregistry.MustRegister(counter)
+		inventoryChanges.Store(counter)
+	})
+}
+
+// DiffInventory compares two snapshots of the allocatable devices.
+func DiffInventory(before, after []DeviceSnapshot) InventoryDiff {
+	diff := InventoryDiff{}
+
+	beforeByUID := make(map[string]DeviceSnapshot, len(before))
+	for _, device := range before {
+		beforeByUID[device.UID] = device
+	}
+
+	for _, device := range after {
+		previous, found := beforeByUID[device.UID]
+		delete(beforeByUID, device.UID)
+		if !found {
+			diff.Added = append(diff.Added, device.UID)
+			continue
+		}
+
+		healthChanged := false
+		for _, attribute := range inventoryHealthAttributes {
+			healthChanged = healthChanged || previous.Attributes[attribute] != device.Attributes[attribute]
+		}
+		if healthChanged {
+			diff.HealthChanged = append(diff.HealthChanged, device.UID)
+		}
+
+		previousOther, other := maps.Clone(previous.Attributes), maps.Clone(device.Attributes)
+		for _, attribute := range inventoryHealthAttributes {
+			delete(previousOther, attribute)
+			delete(other, attribute)
+		}
+		if !maps.Equal(previousOther, other) {
+			diff.Changed = append(diff.Changed, device.UID)
+		}
+	}
+
+	for uid := range beforeByUID {
+		diff.Removed = append(diff.Removed, uid)
+	}
+
+	for _, uids := range [][]string{diff.Added, diff.Removed, diff.HealthChanged, diff.Changed} {
+		sort.Strings(uids)
+	}
+
+	return diff
+}
+
+// Empty returns true if no device changed.
+func (d InventoryDiff) Empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.HealthChanged)+len(d.Changed) == 0
+}
+
+// String returns a concise description of the non-empty changes.
+func (d InventoryDiff) String() string {
+	changes := []string{}
+	for _, change := range []struct {
+		name string
+		uids []string
+	}{
+		{InventoryChangeAdded, d.Added},
+		{InventoryChangeRemoved, d.Removed},
+		{InventoryChangeHealthChanged, d.HealthChanged},
+		{InventoryChangeChanged, d.Changed},
+	} {
+		if len(change.uids) > 0 {
+			changes = append(changes, fmt.Sprintf("%v: %v", change.name, strings.Join(change.uids, ", ")))
+		}
+	}
+
+	return strings.Join(changes, "; ")
+}
+
+// LogInventoryDiff logs the changes between two snapshots of the allocatable
+// devices and counts them in the inventory metrics, so that device churn is
+// observable instead of silent. Returns the diff.
+func LogInventoryDiff(before, after []DeviceSnapshot) InventoryDiff {
+	diff := DiffInventory(before, after)
+	if diff.Empty() {
+		return diff
+	}
+
+	klog.Infof("Device inventory changed: %v", diff)
+
+	if counter := inventoryChanges.Load(); counter != nil {
+		counter.WithLabelValues(InventoryChangeAdded).Add(float64(len(diff.Added)))
+		counter.WithLabelValues(InventoryChangeRemoved).Add(float64(len(diff.Removed)))
+		counter.WithLabelValues(InventoryChangeHealthChanged).Add(float64(len(diff.HealthChanged)))
+		counter.WithLabelValues(InventoryChangeChanged).Add(float64(len(diff.Changed)))
+	}
+
+	return diff
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestDiffInventory(t *testing.T) {
+	before := []DeviceSnapshot{
+		{UID: "dev0", Attributes: map[string]string{"model": "A", "healthy": "true"}},
+		{UID: "dev1", Attributes: map[string]string{"model": "A", "healthy": "true"}},
+		{UID: "dev2", Attributes: map[string]string{"currentDriver": "xe", "health": "Healthy"}},
+		{UID: "dev3", Attributes: map[string]string{"model": "A"}},
+	}
+	after := []DeviceSnapshot{
+		{UID: "dev1", Attributes: map[string]string{"model": "A", "healthy": "false"}},
+		{UID: "dev2", Attributes: map[string]string{"currentDriver": "vfio-pci", "health": "Unhealthy"}},
+		{UID: "dev3", Attributes: map[string]string{"model": "A"}},
+		{UID: "dev4", Attributes: map[string]string{"model": "B"}},
+	}
+
+	diff := DiffInventory(before, after)
+	expected := InventoryDiff{
+		Added:         []string{"dev4"},
+		Removed:       []string{"dev0"},
+		HealthChanged: []string{"dev1", "dev2"},
+		Changed:       []string{"dev2"},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("expected %+v, got %+v", expected, diff)
+	}
+	if diff.String() != "added: dev4; removed: dev0; healthChanged: dev1, dev2; changed: dev2" {
+		t.Errorf("unexpected diff description %q", diff.String())
+	}
+
+	if !DiffInventory(after, after).Empty() {
+		t.Errorf("expected no changes between identical snapshots")
+	}
+}
+
+func TestLogInventoryDiff(t *testing.T) {
+	before := []DeviceSnapshot{{UID: "dev0"}}
+	after := []DeviceSnapshot{{UID: "dev1"}, {UID: "dev2"}}
+
+	// not registered yet, nothing to count into
+	LogInventoryDiff(before, after)
+
+	RegisterInventoryMetrics("test")
+	counter := inventoryChanges.Load()
+	if counter == nil {
+		t.Fatal("expected counter to be registered")
+	}
+	counter.Reset()
+
+	LogInventoryDiff(before, after)
+
+	for change, expected := range map[string]float64{
+		InventoryChangeAdded:         2,
+		InventoryChangeRemoved:       1,
+		InventoryChangeHealthChanged: 0,
+	} {
+		value, err := testutil.GetCounterMetricValue(counter.WithLabelValues(change))
+		if err != nil {
+			t.Fatalf("could not get counter value: %v", err)
+		}
+		if value != expected {
+			t.Errorf("expected %v %v devices, got %v", expected, change, value)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+)
+
+// DefaultKubeletPluginStartTimeout is how long starting the kubelet plugin is
+// retried by default, e.g. while the kubelet is still starting on node boot.
+const DefaultKubeletPluginStartTimeout = 2 * time.Minute
+
+var (
+	kubeletPluginStartBaseDelay = time.Second
+	kubeletPluginStartMaxDelay  = 15 * time.Second
+
+	// startKubeletPlugin is replaced in tests.
+	startKubeletPlugin = kubeletplugin.Start
+)
+
+// StartKubeletPlugin starts the kubelet plugin of the driver and registers it
+// with the kubelet. Failed starts are retried with exponential, jittered
+// backoff within the kubelet plugin start timeout, so that the driver waits
+// for the kubelet plugin registry instead of crash-looping.
+func StartKubeletPlugin(ctx context.Context, plugin kubeletplugin.DRAPlugin, driverName string, config *Config) (*kubeletplugin.Helper, error) {
+	klog.Infof(`Starting DRA kubelet-plugin
+RegistrarDirectoryPath: %v
+PluginDataDirectoryPath: %v`,
+		config.CommonFlags.KubeletPluginsRegistryDir,
+		config.CommonFlags.KubeletPluginDir)
+
+	opts := []kubeletplugin.Option{
+		kubeletplugin.KubeClient(config.Coreclient),
+		kubeletplugin.NodeName(config.CommonFlags.NodeName),
+		kubeletplugin.DriverName(driverName),
+		kubeletplugin.RegistrarDirectoryPath(config.CommonFlags.KubeletPluginsRegistryDir),
+		kubeletplugin.PluginDataDirectoryPath(config.CommonFlags.KubeletPluginDir),
+	}
+
+	deadline := time.Now().Add(config.CommonFlags.KubeletPluginStartTimeout)
+	delay := kubeletPluginStartBaseDelay
+	for attempt := 1; ; attempt++ {
+		helper, err := startKubeletPlugin(ctx, plugin, opts...)
+		if err == nil {
+			return helper, nil
+		}
+
+		retryDelay := wait.Jitter(delay, republishJitterFactor)
+		if time.Now().Add(retryDelay).After(deadline) {
+			return nil, fmt.Errorf("failed to start kubelet-plugin after %d attempts: %v", attempt, err)
+		}
+
+		klog.Warningf("Could not start kubelet-plugin, retrying in %v: %v", retryDelay, err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to start kubelet-plugin: %v (last error: %v)", ctx.Err(), err)
+		case <-time.After(retryDelay):
+		}
+
+		delay = min(2*delay, kubeletPluginStartMaxDelay)
+	}
+}
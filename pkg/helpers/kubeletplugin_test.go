@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+)
+
+func stubKubeletPluginStart(t *testing.T, failures int) *int {
+	origStart, origBaseDelay := startKubeletPlugin, kubeletPluginStartBaseDelay
+	t.Cleanup(func() { startKubeletPlugin, kubeletPluginStartBaseDelay = origStart, origBaseDelay })
+	kubeletPluginStartBaseDelay = time.Millisecond
+
+	attempts := 0
+	startKubeletPlugin = func(ctx context.Context, plugin kubeletplugin.DRAPlugin, opts ...kubeletplugin.Option) (*kubeletplugin.Helper, error) {
+		attempts++
+		if attempts <= failures {
+			return nil, fmt.Errorf("registration socket not ready")
+		}
+		return &kubeletplugin.Helper{}, nil
+	}
+
+	return &attempts
+}
+
+func TestStartKubeletPlugin(t *testing.T) {
+	config := &Config{CommonFlags: &Flags{KubeletPluginStartTimeout: time.Minute}}
+
+	attempts := stubKubeletPluginStart(t, 2)
+	if helper, err := StartKubeletPlugin(context.Background(), nil, "test.intel.com", config); err != nil || helper == nil {
+		t.Fatalf("expected kubelet plugin to start after retries, got %v", err)
+	}
+	if *attempts != 3 {
+		t.Errorf("expected 3 attempts, got %v", *attempts)
+	}
+
+	// Without timeout, the first failure is returned.
+	config.CommonFlags.KubeletPluginStartTimeout = 0
+	attempts = stubKubeletPluginStart(t, 1)
+	if _, err := StartKubeletPlugin(context.Background(), nil, "test.intel.com", config); err == nil {
+		t.Error("expected error without retries")
+	}
+	if *attempts != 1 {
+		t.Errorf("expected a single attempt, got %v", *attempts)
+	}
+
+	// Canceled context stops retrying.
+	config.CommonFlags.KubeletPluginStartTimeout = time.Minute
+	stubKubeletPluginStart(t, 100)
+	kubeletPluginStartBaseDelay = time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := StartKubeletPlugin(ctx, nil, "test.intel.com", config); err == nil {
+		t.Error("expected error with canceled context")
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	ClaimOperationPrepare   = "prepare"
+	ClaimOperationUnprepare = "unprepare"
+
+	claimOperationSuccess = "success"
+	claimOperationError   = "error"
+)
+
+var (
+	// claimOperationDuration is nil until RegisterClaimOperationMetrics is called.
+	claimOperationDuration atomic.Pointer[metrics.HistogramVec]
+
+	registerClaimOperationMetricsOnce sync.Once
+)
+
+// newClaimOperationDuration returns the histogram of claim operation
+// durations. Buckets reach up to minutes, which device reconfiguration and
+// SR-IOV provisioning may take.
+func newClaimOperationDuration(namespace string) *metrics.HistogramVec {
+	return metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      namespace,
+			Name:           "claim_operation_duration_seconds",
+			Help:           "Duration of preparing and unpreparing claims by operation and result.",
+			Buckets:        []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation", "result"},
+	)
+}
+
+// RegisterClaimOperationMetrics registers the claim operation duration
+// histogram under the metrics namespace of the driver, e.g.
+// gpu_claim_operation_duration_seconds. Only the first registration in the
+// process takes effect.
+func RegisterClaimOperationMetrics(namespace string) {
+	registerClaimOperationMetricsOnce.Do(func() {
+		histogram := newClaimOperationDuration(namespace)
+		legacyregistry.MustRegister(histogram)
+		claimOperationDuration.Store(histogram)
+	})
+}
+
+// ObserveClaimOperation records the time since start as the duration of the
+// claim operation, failed if err is not nil. Nothing is recorded before the
+// metrics are registered.
+func ObserveClaimOperation(operation string, start time.Time, err error) {
+	histogram := claimOperationDuration.Load()
+	if histogram == nil {
+		return
+	}
+
+	result := claimOperationSuccess
+	if err != nil {
+		result = claimOperationError
+	}
+	histogram.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
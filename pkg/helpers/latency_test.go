@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestObserveClaimOperation(t *testing.T) {
+	// not registered yet, nothing to record into
+	ObserveClaimOperation(ClaimOperationPrepare, time.Now(), nil)
+
+	RegisterClaimOperationMetrics("test")
+	histogram := claimOperationDuration.Load()
+	if histogram == nil {
+		t.Fatal("expected histogram to be registered")
+	}
+	histogram.Reset()
+
+	ObserveClaimOperation(ClaimOperationPrepare, time.Now().Add(-2*time.Second), nil)
+	ObserveClaimOperation(ClaimOperationPrepare, time.Now(), fmt.Errorf("failed"))
+	ObserveClaimOperation(ClaimOperationUnprepare, time.Now(), nil)
+
+	for _, tt := range []struct {
+		operation string
+		result    string
+		count     uint64
+		minSum    float64
+	}{
+		{ClaimOperationPrepare, claimOperationSuccess, 1, 2},
+		{ClaimOperationPrepare, claimOperationError, 1, 0},
+		{ClaimOperationUnprepare, claimOperationSuccess, 1, 0},
+		{ClaimOperationUnprepare, claimOperationError, 0, 0},
+	} {
+		sum, err := testutil.GetHistogramMetricValue(histogram.WithLabelValues(tt.operation, tt.result))
+		if err != nil {
+			t.Fatalf("could not get histogram value: %v", err)
+		}
+		count, err := testutil.GetHistogramMetricCount(histogram.WithLabelValues(tt.operation, tt.result))
+		if err != nil {
+			t.Fatalf("could not get histogram count: %v", err)
+		}
+		if count != tt.count || sum < tt.minSum {
+			t.Errorf("%v %v: expected %v observations summing to at least %v, got %v summing to %v",
+				tt.operation, tt.result, tt.count, tt.minSum, count, sum)
+		}
+	}
+}
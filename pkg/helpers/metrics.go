@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	MetricsPath = "/metrics"
+
+	metricsReadHeaderTimeout = 5 * time.Second
+	metricsShutdownTimeout   = 5 * time.Second
+)
+
+// StartMetricsServer serves metrics registered in the legacyregistry on given
+// port until ctx is canceled. Port 0 disables the server. If the driver
+// implements TopologyGetter, CapabilitiesGetter or SnapshotGetter, the device
+// topology, the driver capabilities or the node state are served as well.
+func StartMetricsServer(ctx context.Context, port int, driver Driver) error {
+	if port == 0 {
+		klog.V(5).Info("Metrics server disabled")
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("could not listen on metrics port %d: %v", port, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, legacyregistry.Handler())
+	if getter, ok := driver.(TopologyGetter); ok {
+		mux.Handle(TopologyPath, topologyHandler(getter))
+	}
+	if getter, ok := driver.(CapabilitiesGetter); ok {
+		mux.Handle(CapabilitiesPath, capabilitiesHandler(getter))
+	}
+	if getter, ok := driver.(SnapshotGetter); ok {
+		mux.Handle(StatePath, snapshotHandler(getter))
+	}
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadHeaderTimeout,
+	}
+
+	go func() {
+		klog.Infof("Serving metrics on %v%v", listener.Addr(), MetricsPath)
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("metrics server failed: %v", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			klog.Errorf("could not shut down metrics server: %v", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStartMetricsServer(t *testing.T) {
+	if err := StartMetricsServer(context.Background(), 0, nil); err != nil {
+		t.Errorf("unexpected error for disabled metrics server: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	//nolint:forcetypeassert // TCP listener always has TCP address.
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	driver := &fakeTopologyDriver{
+		topology:     NewTopology("node1", []TopologyDevice{{UID: "card0", NUMANode: 1}}),
+		capabilities: NewCapabilities("gpu.intel.com", map[string]bool{FeatureHealthMonitoring: true, FeatureAuditLog: false}),
+		snapshot: NodeStateSnapshot{
+			NodeName:       "node1",
+			Allocatable:    []DeviceSnapshot{{UID: "card0", Attributes: map[string]string{"model": "A770"}}},
+			PreparedClaims: map[string][]string{"uid1": {"card0"}},
+		},
+	}
+	if err := StartMetricsServer(ctx, port, driver); err != nil {
+		t.Fatalf("could not start metrics server: %v", err)
+	}
+
+	client := &http.Client{Timeout: time.Second}
+	response, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, MetricsPath))
+	if err != nil {
+		t.Fatalf("could not get metrics: %v", err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("expected status %v, got %v", http.StatusOK, response.StatusCode)
+	}
+
+	response, err = client.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, TopologyPath))
+	if err != nil {
+		t.Fatalf("could not get topology: %v", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	topology := Topology{}
+	if err := json.NewDecoder(response.Body).Decode(&topology); err != nil {
+		t.Fatalf("could not parse topology: %v", err)
+	}
+	if !reflect.DeepEqual(topology, driver.topology) {
+		t.Errorf("expected topology %+v, got %+v", driver.topology, topology)
+	}
+
+	response, err = client.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, CapabilitiesPath))
+	if err != nil {
+		t.Fatalf("could not get capabilities: %v", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	capabilities := Capabilities{}
+	if err := json.NewDecoder(response.Body).Decode(&capabilities); err != nil {
+		t.Fatalf("could not parse capabilities: %v", err)
+	}
+	if !reflect.DeepEqual(capabilities, driver.capabilities) {
+		t.Errorf("expected capabilities %+v, got %+v", driver.capabilities, capabilities)
+	}
+
+	response, err = client.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, StatePath))
+	if err != nil {
+		t.Fatalf("could not get node state: %v", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	snapshot := NodeStateSnapshot{}
+	if err := json.NewDecoder(response.Body).Decode(&snapshot); err != nil {
+		t.Fatalf("could not parse node state: %v", err)
+	}
+	if !reflect.DeepEqual(snapshot, driver.snapshot) {
+		t.Errorf("expected node state %+v, got %+v", driver.snapshot, snapshot)
+	}
+}
+
+type fakeTopologyDriver struct {
+	fakeDriver
+	topology     Topology
+	capabilities Capabilities
+	snapshot     NodeStateSnapshot
+}
+
+func (d *fakeTopologyDriver) Topology() Topology {
+	return d.topology
+}
+
+func (d *fakeTopologyDriver) Capabilities() Capabilities {
+	return d.capabilities
+}
+
+func (d *fakeTopologyDriver) Snapshot() NodeStateSnapshot {
+	return d.snapshot
+}
@@ -21,29 +21,122 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/klog/v2"
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 )
 
+const (
+	PreparedClaimsCheckpointKind       = "PreparedClaimsCheckpoint"
+	PreparedClaimsCheckpointAPIVersion = "checkpoint.resource.intel.com/v1"
+)
+
 type ClaimPreparations map[string]kubeletplugin.PrepareResult
 
+// PreparedClaimsCheckpoint is the versioned content of the prepared claims
+// file. Files without Kind hold unversioned ClaimPreparations.
+type PreparedClaimsCheckpoint struct {
+	metav1.TypeMeta
+	PreparedClaims ClaimPreparations
+	// PreparedAt is when the claims were prepared, by claim UID.
+	PreparedAt map[string]time.Time `json:",omitempty"`
+}
+
 type NodeState struct {
 	sync.Mutex
-	CdiCache               *cdiapi.Cache
-	Allocatable            interface{}
-	Prepared               ClaimPreparations
+	CdiCache    *cdiapi.Cache
+	Allocatable interface{}
+	Prepared    ClaimPreparations
+	// PreparedAt is when the prepared claims were prepared, by claim UID.
+	PreparedAt             map[string]time.Time
 	PreparedClaimsFilePath string
 	NodeName               string
 	SysfsRoot              string
 }
 
+// DeviceSnapshot is a driver-independent view of an allocatable device.
+type DeviceSnapshot struct {
+	UID        string            `json:"uid"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// NodeStateSnapshot is a serializable view of the node state for debugging.
+type NodeStateSnapshot struct {
+	NodeName    string           `json:"nodeName"`
+	Allocatable []DeviceSnapshot `json:"allocatable"`
+	// Prepared device names mapped by claim UID.
+	PreparedClaims map[string][]string `json:"preparedClaims"`
+	// Driver-specific allocations, device UIDs mapped by claim UID.
+	Allocations map[string][]string `json:"allocations,omitempty"`
+}
+
+// SnapshotAdapter converts driver-specific node state into snapshot parts.
+// Its methods are called with the node state lock held.
+type SnapshotAdapter interface {
+	// AllocatableDevices returns the allocatable devices of the driver.
+	AllocatableDevices() []DeviceSnapshot
+	// Allocations returns driver-specific allocations, or nil if the driver
+	// does not track allocations beyond prepared claims.
+	Allocations() map[string][]string
+}
+
+// Snapshot returns the current state of the node, the adapter converts the
+// driver-specific Allocatable contents.
+func (s *NodeState) Snapshot(adapter SnapshotAdapter) NodeStateSnapshot {
+	s.Lock()
+	defer s.Unlock()
+
+	preparedClaims := map[string][]string{}
+	for claimUID, preparation := range s.Prepared {
+		deviceNames := []string{}
+		for _, preparedDevice := range preparation.Devices {
+			deviceNames = append(deviceNames, preparedDevice.DeviceName)
+		}
+		preparedClaims[claimUID] = deviceNames
+	}
+
+	return NewNodeStateSnapshot(s.NodeName, preparedClaims, adapter)
+}
+
+// NewNodeStateSnapshot assembles the snapshot and sorts its contents for stable
+// output. It is used directly by drivers with their own node state type.
+func NewNodeStateSnapshot(nodeName string, preparedClaims map[string][]string, adapter SnapshotAdapter) NodeStateSnapshot {
+	allocatable := adapter.AllocatableDevices()
+	sort.Slice(allocatable, func(i, j int) bool { return allocatable[i].UID < allocatable[j].UID })
+
+	for _, deviceNames := range preparedClaims {
+		sort.Strings(deviceNames)
+	}
+
+	allocations := adapter.Allocations()
+	for _, deviceUIDs := range allocations {
+		sort.Strings(deviceUIDs)
+	}
+
+	return NodeStateSnapshot{
+		NodeName:       nodeName,
+		Allocatable:    allocatable,
+		PreparedClaims: preparedClaims,
+		Allocations:    allocations,
+	}
+}
+
 func (s *NodeState) Unprepare(ctx context.Context, claimUID string) error {
 	s.Lock()
 	defer s.Unlock()
 
+	return s.RemovePreparedClaim(claimUID)
+}
+
+// RemovePreparedClaim removes the claim from prepared claims and persists them.
+// The caller must hold the lock.
+func (s *NodeState) RemovePreparedClaim(claimUID string) error {
 	if _, found := s.Prepared[claimUID]; !found {
 		return nil
 	}
@@ -52,62 +145,181 @@ func (s *NodeState) Unprepare(ctx context.Context, claimUID string) error {
 	delete(s.Prepared, claimUID)
 
 	// write prepared claims to file
-	if err := WritePreparedClaimsToFile(s.PreparedClaimsFilePath, s.Prepared); err != nil {
+	if err := s.WritePreparedClaims(); err != nil {
 		return fmt.Errorf("failed to write prepared claims to file: %v", err)
 	}
 
 	return nil
 }
 
-// GetOrCreatePreparedClaims reads a PreparedClaim from a file and deserializes it or creates the file.
-func GetOrCreatePreparedClaims(preparedClaimFilePath string) (ClaimPreparations, error) {
-	if _, err := os.Stat(preparedClaimFilePath); os.IsNotExist(err) {
-		klog.V(5).Infof("could not find file %v. Creating file", preparedClaimFilePath)
-		f, err := os.OpenFile(preparedClaimFilePath, os.O_CREATE|os.O_WRONLY, 0600)
-		if err != nil {
-			return nil, fmt.Errorf("failed creating file %v. Err: %v", preparedClaimFilePath, err)
+// AddPreparedClaim records the claim as prepared now. The caller must hold
+// the lock and write the prepared claims.
+func (s *NodeState) AddPreparedClaim(claimUID string, prepareResult kubeletplugin.PrepareResult) {
+	if s.PreparedAt == nil {
+		s.PreparedAt = map[string]time.Time{}
+	}
+	s.Prepared[claimUID] = prepareResult
+	s.PreparedAt[claimUID] = time.Now()
+}
+
+// WritePreparedClaims persists the prepared claims with the times they were
+// prepared, forgetting the times of claims no longer prepared. The caller must
+// hold the lock.
+func (s *NodeState) WritePreparedClaims() error {
+	for claimUID := range s.PreparedAt {
+		if _, found := s.Prepared[claimUID]; !found {
+			delete(s.PreparedAt, claimUID)
 		}
-		defer f.Close()
+	}
 
-		if _, err := f.WriteString("{}"); err != nil {
-			return nil, fmt.Errorf("failed writing to file %v. Err: %v", preparedClaimFilePath, err)
+	return WritePreparedClaimsCheckpoint(s.PreparedClaimsFilePath, s.Prepared, s.PreparedAt)
+}
+
+// GetOrCreatePreparedClaims reads a PreparedClaim from a file and deserializes it or creates the file.
+// An existing file is never overwritten, so when several callers race, all of
+// them get the content of the file that won. Also returns when the claims were
+// prepared, claims from files without prepare times are counted as prepared now.
+func GetOrCreatePreparedClaims(preparedClaimFilePath string) (ClaimPreparations, map[string]time.Time, error) {
+	if PreparedClaimsInMemory() {
+		if _, err := os.Stat(preparedClaimFilePath); os.IsNotExist(err) {
+			return make(ClaimPreparations), map[string]time.Time{}, nil
 		}
+	}
 
+	emptyCheckpoint, err := encodePreparedClaims(ClaimPreparations{}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	created, err := CreateFileIfNotExists(preparedClaimFilePath, emptyCheckpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	if created {
 		klog.V(5).Infof("empty prepared claims file created %v", preparedClaimFilePath)
+		return make(ClaimPreparations), map[string]time.Time{}, nil
+	}
 
-		return make(ClaimPreparations), nil
+	checkpoint, err := readPreparedClaimsCheckpoint(preparedClaimFilePath)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return ReadPreparedClaimsFromFile(preparedClaimFilePath)
+	preparedAt := map[string]time.Time{}
+	now := time.Now()
+	for claimUID := range checkpoint.PreparedClaims {
+		preparedAt[claimUID] = now
+		if checkpointTime, found := checkpoint.PreparedAt[claimUID]; found {
+			preparedAt[claimUID] = checkpointTime
+		}
+	}
+
+	return checkpoint.PreparedClaims, preparedAt, nil
 }
 
-// ReadPreparedClaimToFile returns unmarshaled content for given prepared claims JSON file.
+// CreateFileIfNotExists atomically creates the file with given content, unless
+// it already exists. The content is written to a temporary file first and then
+// hard-linked to the final path, so the file is never seen half-written and an
+// existing file is never truncated. Returns true if the file was created.
+func CreateFileIfNotExists(filePath string, content []byte) (bool, error) {
+	if _, err := os.Stat(filePath); err == nil {
+		return false, nil
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return false, fmt.Errorf("failed creating temporary file for %v: %v", filePath, err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return false, fmt.Errorf("failed writing temporary file for %v: %v", filePath, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return false, fmt.Errorf("failed closing temporary file for %v: %v", filePath, err)
+	}
+	if err := os.Chmod(tmpFile.Name(), 0600); err != nil {
+		return false, fmt.Errorf("failed setting permissions of temporary file for %v: %v", filePath, err)
+	}
+
+	// Link fails if the file exists, e.g. because another caller created it meanwhile.
+	if err := os.Link(tmpFile.Name(), filePath); err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed creating file %v: %v", filePath, err)
+	}
+
+	return true, nil
+}
+
+// ReadPreparedClaimsFromFile returns unmarshaled content for given prepared claims JSON file.
 func ReadPreparedClaimsFromFile(preparedClaimFilePath string) (ClaimPreparations, error) {
+	checkpoint, err := readPreparedClaimsCheckpoint(preparedClaimFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoint.PreparedClaims, nil
+}
 
-	preparedClaims := make(ClaimPreparations)
+// readPreparedClaimsCheckpoint reads the prepared claims file, versioned or
+// unversioned.
+func readPreparedClaimsCheckpoint(preparedClaimFilePath string) (PreparedClaimsCheckpoint, error) {
+	checkpoint := PreparedClaimsCheckpoint{PreparedClaims: ClaimPreparations{}}
 
 	preparedClaimsBytes, err := os.ReadFile(preparedClaimFilePath)
 	if err != nil {
 		klog.V(5).Infof("could not read prepared claims configuration from file %v. Err: %v", preparedClaimFilePath, err)
-		return nil, fmt.Errorf("failed reading file %v. Err: %v", preparedClaimFilePath, err)
+		return checkpoint, fmt.Errorf("failed reading file %v. Err: %v", preparedClaimFilePath, err)
+	}
+
+	if err := json.Unmarshal(preparedClaimsBytes, &checkpoint); err == nil && checkpoint.Kind == PreparedClaimsCheckpointKind {
+		return checkpoint, nil
 	}
 
-	if err := json.Unmarshal(preparedClaimsBytes, &preparedClaims); err != nil {
+	klog.V(5).Info("Falling back to parsing prepared claims file as unversioned.")
+	checkpoint = PreparedClaimsCheckpoint{PreparedClaims: ClaimPreparations{}}
+	if err := json.Unmarshal(preparedClaimsBytes, &checkpoint.PreparedClaims); err != nil {
 		klog.V(5).Infof("Could not parse default prepared claims configuration from file %v. Err: %v", preparedClaimFilePath, err)
-		return nil, fmt.Errorf("failed parsing file %v. Err: %v", preparedClaimFilePath, err)
+		return checkpoint, fmt.Errorf("failed parsing file %v. Err: %v", preparedClaimFilePath, err)
 	}
 
-	return preparedClaims, nil
+	return checkpoint, nil
 }
 
 // WritePreparedClaimsToFile serializes PreparedClaims and writes it to a file.
 func WritePreparedClaimsToFile(preparedClaimFilePath string, preparedClaims ClaimPreparations) error {
+	return WritePreparedClaimsCheckpoint(preparedClaimFilePath, preparedClaims, nil)
+}
+
+// WritePreparedClaimsCheckpoint serializes PreparedClaims with the times they
+// were prepared into a versioned checkpoint and writes it to a file.
+func WritePreparedClaimsCheckpoint(preparedClaimFilePath string, preparedClaims ClaimPreparations, preparedAt map[string]time.Time) error {
+	encodedPreparedClaims, err := encodePreparedClaims(preparedClaims, preparedAt)
+	if err != nil {
+		return err
+	}
+	return WritePreparedClaimsBytes(preparedClaimFilePath, encodedPreparedClaims)
+}
+
+func encodePreparedClaims(preparedClaims ClaimPreparations, preparedAt map[string]time.Time) ([]byte, error) {
 	if preparedClaims == nil {
 		preparedClaims = ClaimPreparations{}
 	}
-	encodedPreparedClaims, err := json.MarshalIndent(preparedClaims, "", "  ")
+	checkpoint := PreparedClaimsCheckpoint{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       PreparedClaimsCheckpointKind,
+			APIVersion: PreparedClaimsCheckpointAPIVersion,
+		},
+		PreparedClaims: preparedClaims,
+		PreparedAt:     preparedAt,
+	}
+
+	encodedPreparedClaims, err := json.MarshalIndent(checkpoint, "", "  ")
 	if err != nil {
-		return fmt.Errorf("prepared claims JSON encoding failed. Err: %v", err)
+		return nil, fmt.Errorf("prepared claims JSON encoding failed. Err: %v", err)
 	}
-	return os.WriteFile(preparedClaimFilePath, encodedPreparedClaims, 0600)
+	return encodedPreparedClaims, nil
 }
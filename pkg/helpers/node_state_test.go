@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 )
@@ -16,7 +20,18 @@ func TestGetOrCreatePreparedClaims(t *testing.T) {
 		initialContent string
 		expectError    bool
 		expectedClaims ClaimPreparations
+		expectedTime   time.Time
 	}{
+		{
+			name:           "VersionedFileExists",
+			initialContent: `{"kind":"PreparedClaimsCheckpoint","apiVersion":"checkpoint.resource.intel.com/v1","PreparedClaims":{"claim1":{"devices":[{"devicename":"device1"}]}},"PreparedAt":{"claim1":"2026-01-01T00:00:00Z"}}`,
+			expectedClaims: ClaimPreparations{
+				"claim1": {
+					Devices: []kubeletplugin.Device{{DeviceName: "device1"}},
+				},
+			},
+			expectedTime: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
 		{
 			name:           "FileExists",
 			initialContent: `{"claim1": {"devices":[{"devicename": "device1"}]}}`,
@@ -53,7 +68,8 @@ func TestGetOrCreatePreparedClaims(t *testing.T) {
 				}
 			}
 
-			preparedClaims, err := GetOrCreatePreparedClaims(filePath)
+			start := time.Now()
+			preparedClaims, preparedAt, err := GetOrCreatePreparedClaims(filePath)
 
 			if tt.expectError {
 				if err == nil {
@@ -72,6 +88,15 @@ func TestGetOrCreatePreparedClaims(t *testing.T) {
 				if !reflect.DeepEqual(tt.expectedClaims, preparedClaims) {
 					t.Fatalf("expected %v but got %v", tt.expectedClaims, preparedClaims)
 				}
+				// Claims without prepare time count as prepared on reading.
+				for claimUID := range preparedClaims {
+					if !tt.expectedTime.IsZero() && !preparedAt[claimUID].Equal(tt.expectedTime) {
+						t.Errorf("expected claim %v prepared at %v, got %v", claimUID, tt.expectedTime, preparedAt[claimUID])
+					}
+					if tt.expectedTime.IsZero() && preparedAt[claimUID].Before(start) {
+						t.Errorf("expected claim %v prepared after %v, got %v", claimUID, start, preparedAt[claimUID])
+					}
+				}
 
 				// Verify file creation
 				if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -82,6 +107,57 @@ func TestGetOrCreatePreparedClaims(t *testing.T) {
 	}
 }
 
+func TestGetOrCreatePreparedClaimsConcurrent(t *testing.T) {
+	const callers = 20
+
+	filePath := path.Join(t.TempDir(), "prepared_claims.json")
+	claims := ClaimPreparations{
+		"claim1": {Devices: []kubeletplugin.Device{{DeviceName: "device1"}}},
+	}
+
+	// The first caller to create the file writes claims right away, the
+	// others must not clobber them.
+	var (
+		wg        sync.WaitGroup
+		writeOnce sync.Once
+		errs      = make(chan error, callers)
+	)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := GetOrCreatePreparedClaims(filePath); err != nil {
+				errs <- err
+				return
+			}
+			writeOnce.Do(func() {
+				if err := WritePreparedClaimsToFile(filePath, claims); err != nil {
+					errs <- err
+				}
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	preparedClaims, _, err := GetOrCreatePreparedClaims(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(claims, preparedClaims) {
+		t.Errorf("expected %v but got %v", claims, preparedClaims)
+	}
+
+	leftovers, _ := filepath.Glob(filePath + ".tmp-*")
+	if len(leftovers) != 0 {
+		t.Errorf("expected no temporary files left, got %v", leftovers)
+	}
+}
+
 func TestWritePreparedClaimsToFile(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -97,13 +173,13 @@ func TestWritePreparedClaimsToFile(t *testing.T) {
 				},
 			},
 			expectedError:  false,
-			expectedOutput: `{"claim1":{"Devices":[{"DeviceName":"device1","PoolName":"","Requests":null,"CDIDeviceIDs":null,"ShareID":null}], "Err":null}}`,
+			expectedOutput: `{"kind":"PreparedClaimsCheckpoint","apiVersion":"checkpoint.resource.intel.com/v1","PreparedClaims":{"claim1":{"Devices":[{"DeviceName":"device1","PoolName":"","Requests":null,"CDIDeviceIDs":null,"ShareID":null}], "Err":null}}}`,
 		},
 		{
 			name:           "EmptyClaims",
 			claims:         ClaimPreparations{},
 			expectedError:  false,
-			expectedOutput: `{}`,
+			expectedOutput: `{"kind":"PreparedClaimsCheckpoint","apiVersion":"checkpoint.resource.intel.com/v1","PreparedClaims":{}}`,
 		},
 	}
 
@@ -215,16 +291,11 @@ func TestUnprepare(t *testing.T) {
 				}
 
 				// Verify file content
-				content, err := os.ReadFile(filePath)
+				actualOutput, err := ReadPreparedClaimsFromFile(filePath)
 				if err != nil {
 					t.Fatalf("failed to read file: %v", err)
 				}
 
-				var actualOutput ClaimPreparations
-				if err := json.Unmarshal(content, &actualOutput); err != nil {
-					t.Fatalf("failed to unmarshal actual output: %v", err)
-				}
-
 				if !reflect.DeepEqual(tt.expectedPrepared, actualOutput) {
 					t.Fatalf("expected %v but got %v", tt.expectedPrepared, actualOutput)
 				}
@@ -232,3 +303,74 @@ func TestUnprepare(t *testing.T) {
 		})
 	}
 }
+
+func TestPreparedClaimTimesPersisted(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "prepared_claims.json")
+	nodeState := &NodeState{Prepared: ClaimPreparations{}, PreparedClaimsFilePath: filePath}
+
+	start := time.Now()
+	nodeState.AddPreparedClaim("claim1", kubeletplugin.PrepareResult{})
+	nodeState.AddPreparedClaim("claim2", kubeletplugin.PrepareResult{})
+	if err := nodeState.RemovePreparedClaim("claim2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	preparedClaims, preparedAt, err := GetOrCreatePreparedClaims(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(preparedClaims) != 1 || len(preparedAt) != 1 {
+		t.Fatalf("expected one prepared claim with prepare time, got %v and %v", preparedClaims, preparedAt)
+	}
+	if !preparedAt["claim1"].Equal(nodeState.PreparedAt["claim1"]) || preparedAt["claim1"].Before(start) {
+		t.Errorf("expected claim1 prepare time %v to be kept, got %v", nodeState.PreparedAt["claim1"], preparedAt["claim1"])
+	}
+	if _, found := nodeState.PreparedAt["claim2"]; found {
+		t.Error("expected prepare time of unprepared claim to be forgotten")
+	}
+}
+
+type fakeSnapshotAdapter struct{}
+
+func (fakeSnapshotAdapter) AllocatableDevices() []DeviceSnapshot {
+	return []DeviceSnapshot{
+		{UID: "device2", Attributes: map[string]string{"model": "b"}},
+		{UID: "device1", Attributes: map[string]string{"model": "a"}},
+	}
+}
+
+func (fakeSnapshotAdapter) Allocations() map[string][]string {
+	return map[string][]string{"claim1": {"vf2", "vf1"}}
+}
+
+func TestNodeStateSnapshot(t *testing.T) {
+	state := &NodeState{
+		NodeName: "node1",
+		Prepared: ClaimPreparations{
+			"claim1": {Devices: []kubeletplugin.Device{{DeviceName: "device2"}, {DeviceName: "device1"}}},
+			"claim2": {},
+		},
+	}
+
+	expected := NodeStateSnapshot{
+		NodeName: "node1",
+		Allocatable: []DeviceSnapshot{
+			{UID: "device1", Attributes: map[string]string{"model": "a"}},
+			{UID: "device2", Attributes: map[string]string{"model": "b"}},
+		},
+		PreparedClaims: map[string][]string{
+			"claim1": {"device1", "device2"},
+			"claim2": {},
+		},
+		Allocations: map[string][]string{"claim1": {"vf1", "vf2"}},
+	}
+
+	snapshot := state.Snapshot(fakeSnapshotAdapter{})
+	if !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("expected snapshot %+v, got %+v", expected, snapshot)
+	}
+
+	if _, err := json.Marshal(snapshot); err != nil {
+		t.Errorf("could not serialize snapshot: %v", err)
+	}
+}
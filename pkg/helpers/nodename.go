@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+const NodeNameEnvVarName = "NODE_NAME"
+
+// hostname is replaced in tests.
+var hostname = os.Hostname
+
+// ResolveNodeName returns the node name the driver runs on: nodeName if set,
+// otherwise the NODE_NAME environment variable, otherwise the hostname the
+// same way kubelet derives the node name from it. Node name is used for the
+// ResourceSlice pool, so an error is returned instead of guessing when none of
+// them is a valid node name.
+func ResolveNodeName(nodeName string) (string, error) {
+	source := "--node-name"
+	if nodeName == "" {
+		nodeName = os.Getenv(NodeNameEnvVarName)
+		source = NodeNameEnvVarName + " environment variable"
+	}
+
+	if nodeName == "" {
+		host, err := hostname()
+		if err != nil {
+			return "", fmt.Errorf("node name not set with --node-name or %v, and hostname cannot be read: %v", NodeNameEnvVarName, err)
+		}
+		// kubelet lowercases the hostname for the node name.
+		nodeName = strings.ToLower(strings.TrimSpace(host))
+		source = "hostname"
+		klog.Warningf("Node name not set with --node-name or %v, using hostname '%v'", NodeNameEnvVarName, nodeName)
+	}
+
+	if errs := validation.IsDNS1123Subdomain(nodeName); len(errs) > 0 {
+		return "", fmt.Errorf("invalid node name '%v' from %v: %v", nodeName, source, strings.Join(errs, ", "))
+	}
+
+	return nodeName, nil
+}
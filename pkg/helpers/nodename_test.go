@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolveNodeName(t *testing.T) {
+	origHostname := hostname
+	t.Cleanup(func() { hostname = origHostname })
+
+	tests := []struct {
+		name        string
+		flag        string
+		env         string
+		host        string
+		hostErr     error
+		expected    string
+		expectError bool
+	}{
+		{name: "flag", flag: "node1", env: "node2", host: "node3", expected: "node1"},
+		{name: "environment variable", env: "node2", host: "node3", expected: "node2"},
+		{name: "hostname", host: "Node3.Example.com\n", expected: "node3.example.com"},
+		{name: "hostname error", hostErr: fmt.Errorf("no hostname"), expectError: true},
+		{name: "invalid flag", flag: "Node_1", host: "node3", expectError: true},
+		{name: "invalid environment variable", env: "node 2", host: "node3", expectError: true},
+		{name: "empty hostname", host: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(NodeNameEnvVarName, tt.env)
+			hostname = func() (string, error) { return tt.host, tt.hostErr }
+
+			nodeName, err := ResolveNodeName(tt.flag)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if nodeName != tt.expected {
+				t.Errorf("expected node name '%v', got '%v'", tt.expected, nodeName)
+			}
+		})
+	}
+}
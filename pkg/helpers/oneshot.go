@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OneshotFormatYAML = "yaml"
+	OneshotFormatJSON = "json"
+)
+
+// ResourcesGetter is implemented by drivers that can report the resources
+// they would publish, needed for the oneshot mode.
+type ResourcesGetter interface {
+	GetResources() resourceslice.DriverResources
+}
+
+// RunOneshot creates the driver without connecting to the API server or
+// starting the kubelet plugin, writes the resources it would publish to out,
+// and returns. The driver uses a scratch CDI root and plugin directory, so the
+// CDI specs and prepared claims of a running driver are left untouched.
+func RunOneshot(ctx context.Context, config *Config, newDriver func(ctx context.Context, config *Config) (Driver, error), out io.Writer) error {
+	if err := validateOneshotFormat(config.CommonFlags.OneshotFormat); err != nil {
+		return err
+	}
+
+	scratchDir, err := os.MkdirTemp("", "oneshot-")
+	if err != nil {
+		return fmt.Errorf("could not create scratch directory: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(scratchDir); err != nil {
+			klog.Warningf("Could not remove scratch directory %v: %v", scratchDir, err)
+		}
+	}()
+
+	flags := *config.CommonFlags
+	flags.CdiRoot = filepath.Join(scratchDir, "cdi")
+	flags.KubeletPluginDir = filepath.Join(scratchDir, "plugin")
+	scratchConfig := *config
+	scratchConfig.CommonFlags = &flags
+
+	if err := prepareDirectories(&scratchConfig); err != nil {
+		return err
+	}
+
+	driver, err := newDriver(ctx, &scratchConfig)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := driver.Shutdown(ctx); err != nil {
+			klog.Warningf("Could not shut down driver: %v", err)
+		}
+	}()
+
+	getter, ok := driver.(ResourcesGetter)
+	if !ok {
+		return fmt.Errorf("driver does not support oneshot mode")
+	}
+
+	return WriteResources(out, getter.GetResources(), flags.OneshotFormat)
+}
+
+func validateOneshotFormat(format string) error {
+	switch format {
+	case OneshotFormatYAML, OneshotFormatJSON, "":
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, supported: %v, %v", format, OneshotFormatYAML, OneshotFormatJSON)
+	}
+}
+
+// WriteResources marshals driver resources in the given format, yaml or json.
+func WriteResources(out io.Writer, resources resourceslice.DriverResources, format string) error {
+	if err := validateOneshotFormat(format); err != nil {
+		return err
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+
+	switch format {
+	case OneshotFormatYAML, "":
+		data, err = yaml.Marshal(resources)
+	case OneshotFormatJSON:
+		data, err = json.MarshalIndent(resources, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return fmt.Errorf("could not marshal resources: %v", err)
+	}
+
+	if _, err := out.Write(data); err != nil {
+		return fmt.Errorf("could not write resources: %v", err)
+	}
+
+	return nil
+}
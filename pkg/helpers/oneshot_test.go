@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+)
+
+type fakeResourcesDriver struct {
+	resources resourceslice.DriverResources
+	shutdown  bool
+}
+
+func (d *fakeResourcesDriver) Shutdown(ctx context.Context) error {
+	d.shutdown = true
+	return nil
+}
+
+func (d *fakeResourcesDriver) GetResources() resourceslice.DriverResources {
+	return d.resources
+}
+
+type fakeDriver struct{}
+
+func (d *fakeDriver) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestRunOneshot(t *testing.T) {
+	resources := resourceslice.DriverResources{
+		Pools: map[string]resourceslice.Pool{
+			"node1": {
+				Slices: []resourceslice.Slice{{Devices: []resourceapi.Device{{Name: "card0"}}}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		format      string
+		driver      Driver
+		expected    string
+		expectError bool
+	}{
+		{name: "yaml", format: OneshotFormatYAML, driver: &fakeResourcesDriver{resources: resources}, expected: "- name: card0"},
+		{name: "json", format: OneshotFormatJSON, driver: &fakeResourcesDriver{resources: resources}, expected: `"name": "card0"`},
+		{name: "unsupported format", format: "xml", driver: nil, expectError: true},
+		{name: "driver without resources", format: OneshotFormatYAML, driver: &fakeDriver{}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testRoot := t.TempDir()
+			config := &Config{
+				CommonFlags: &Flags{
+					KubeletPluginDir: path.Join(testRoot, "plugin"),
+					CdiRoot:          path.Join(testRoot, "cdi"),
+					OneshotFormat:    tt.format,
+				},
+			}
+			driverCreated := false
+			newDriver := func(ctx context.Context, config *Config) (Driver, error) {
+				if tt.driver == nil {
+					t.Fatal("driver must not be created")
+				}
+				driverCreated = true
+				// Oneshot must not touch the CDI specs and files of a running driver.
+				if strings.HasPrefix(config.CommonFlags.CdiRoot, testRoot) || strings.HasPrefix(config.CommonFlags.KubeletPluginDir, testRoot) {
+					t.Errorf("expected scratch directories, got CDI root %v and plugin dir %v", config.CommonFlags.CdiRoot, config.CommonFlags.KubeletPluginDir)
+				}
+				for _, dir := range []string{config.CommonFlags.CdiRoot, config.CommonFlags.KubeletPluginDir} {
+					if _, err := os.Stat(dir); err != nil {
+						t.Errorf("expected scratch directory %v to exist: %v", dir, err)
+					}
+				}
+				return tt.driver, nil
+			}
+
+			out := &bytes.Buffer{}
+			err := RunOneshot(context.Background(), config, newDriver, out)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if !strings.Contains(out.String(), tt.expected) {
+				t.Errorf("expected output to contain %q, got:\n%s", tt.expected, out.String())
+			}
+			if resourcesDriver, ok := tt.driver.(*fakeResourcesDriver); ok && driverCreated && !resourcesDriver.shutdown {
+				t.Error("expected driver to be shut down")
+			}
+			for _, dir := range []string{config.CommonFlags.CdiRoot, config.CommonFlags.KubeletPluginDir} {
+				if _, err := os.Stat(dir); !os.IsNotExist(err) {
+					t.Errorf("expected %v not to be created, got %v", dir, err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteResourcesJSON(t *testing.T) {
+	resources := resourceslice.DriverResources{
+		Pools: map[string]resourceslice.Pool{
+			"node1": {Slices: []resourceslice.Slice{{Devices: []resourceapi.Device{{Name: "qatvf-0000-4b-00-1"}}}}},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	if err := WriteResources(out, resources, OneshotFormatJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parsed := resourceslice.DriverResources{}
+	if err := json.Unmarshal(out.Bytes(), &parsed); err != nil {
+		t.Fatalf("could not parse output: %v", err)
+	}
+	if parsed.Pools["node1"].Slices[0].Devices[0].Name != "qatvf-0000-4b-00-1" {
+		t.Errorf("unexpected resources after round trip: %+v", parsed)
+	}
+}
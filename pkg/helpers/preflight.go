@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+// PreflightCheck describes the privileges a driver feature needs, checked on
+// startup so that the feature can be disabled with a clear message instead of
+// failing obscurely when it is first used.
+type PreflightCheck struct {
+	Feature string   // feature disabled when the check fails, e.g. "xpumd health backend"
+	Paths   []string // files or sockets the feature writes to
+	Hint    string   // how to grant the privileges, logged when the check fails
+}
+
+// checkWritable is replaced in tests, as root passes most permission checks.
+var checkWritable = func(path string) error {
+	return unix.Access(path, unix.W_OK)
+}
+
+// Preflight runs the checks and returns the features lacking privileges with
+// the reason, logging an actionable message for each of them. Missing paths
+// pass the check, the feature reports those itself when it is used.
+func Preflight(checks []PreflightCheck) map[string]error {
+	failed := map[string]error{}
+
+	for _, check := range checks {
+		for _, path := range check.Paths {
+			err := checkWritable(path)
+			if err == nil || errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+
+			failed[check.Feature] = fmt.Errorf("%v is not writable: %v", path, err)
+			klog.Errorf("Insufficient privileges, disabling %v: %v is not writable: %v. %v", check.Feature, path, err, check.Hint)
+			break
+		}
+	}
+
+	return failed
+}
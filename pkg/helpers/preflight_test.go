@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	dir := t.TempDir()
+	writable := filepath.Join(dir, "writable")
+	if err := WriteFile(writable, "0"); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	readOnly := filepath.Join(dir, "read-only")
+
+	origCheckWritable := checkWritable
+	defer func() { checkWritable = origCheckWritable }()
+	checkWritable = func(path string) error {
+		if path == readOnly {
+			return syscall.EROFS
+		}
+		return origCheckWritable(path)
+	}
+
+	failed := Preflight([]PreflightCheck{
+		{Feature: "writable", Paths: []string{writable}},
+		{Feature: "missing", Paths: []string{filepath.Join(dir, "missing")}},
+		{Feature: "read-only", Paths: []string{writable, readOnly}, Hint: "run privileged"},
+	})
+
+	if len(failed) != 1 || failed["read-only"] == nil {
+		t.Errorf("expected only read-only feature to fail, got %v", failed)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var registerPreparedClaimsMetricsOnce sync.Once
+
+// preparedClaimsCollector reports the number of prepared claims and the age of
+// the oldest one on every scrape. Prepared claims living much longer than the
+// workloads on the node hint at leaked devices.
+type preparedClaimsCollector struct {
+	metrics.BaseStableCollector
+
+	countDesc          *metrics.Desc
+	oldestAgeDesc      *metrics.Desc
+	preparedClaimTimes func() []time.Time
+	now                func() time.Time
+}
+
+func newPreparedClaimsCollector(namespace string, preparedClaimTimes func() []time.Time) *preparedClaimsCollector {
+	return &preparedClaimsCollector{
+		countDesc: metrics.NewDesc(namespace+"_prepared_claims",
+			"Number of claims prepared on the node.",
+			nil, nil, metrics.ALPHA, ""),
+		oldestAgeDesc: metrics.NewDesc(namespace+"_oldest_prepared_claim_age_seconds",
+			"Time since the oldest claim prepared on the node was prepared.",
+			nil, nil, metrics.ALPHA, ""),
+		preparedClaimTimes: preparedClaimTimes,
+		now:                time.Now,
+	}
+}
+
+func (c *preparedClaimsCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- c.countDesc
+	ch <- c.oldestAgeDesc
+}
+
+func (c *preparedClaimsCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	times := c.preparedClaimTimes()
+	now := c.now()
+
+	oldestAge := time.Duration(0)
+	for _, preparedAt := range times {
+		oldestAge = max(oldestAge, now.Sub(preparedAt))
+	}
+
+	ch <- metrics.NewLazyConstMetric(c.countDesc, metrics.GaugeValue, float64(len(times)))
+	ch <- metrics.NewLazyConstMetric(c.oldestAgeDesc, metrics.GaugeValue, oldestAge.Seconds())
+}
+
+// RegisterPreparedClaimsMetrics registers the number of prepared claims and
+// the age of the oldest one under the metrics namespace of the driver, e.g.
+// gpu_prepared_claims. preparedClaimTimes returns when each prepared claim was
+// prepared and is called on every scrape. Only the first registration in the
+// process takes effect.
+func RegisterPreparedClaimsMetrics(namespace string, preparedClaimTimes func() []time.Time) {
+	registerPreparedClaimsMetricsOnce.Do(func() {
+		legacyregistry.CustomMustRegister(newPreparedClaimsCollector(namespace, preparedClaimTimes))
+	})
+}
+
+// PreparedClaimTimes returns when the prepared claims were prepared.
+func (s *NodeState) PreparedClaimTimes() []time.Time {
+	s.Lock()
+	defer s.Unlock()
+
+	times := make([]time.Time, 0, len(s.Prepared))
+	for claimUID := range s.Prepared {
+		if preparedAt, found := s.PreparedAt[claimUID]; found {
+			times = append(times, preparedAt)
+		}
+	}
+
+	return times
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestPreparedClaimsCollector(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := &NodeState{
+		Prepared: ClaimPreparations{"uid1": {}, "uid2": {}},
+		PreparedAt: map[string]time.Time{
+			"uid1": now.Add(-90 * time.Second),
+			"uid2": now.Add(-time.Second),
+			// Times of unprepared claims are ignored.
+			"uid3": now.Add(-time.Hour),
+		},
+	}
+
+	collector := newPreparedClaimsCollector("test", state.PreparedClaimTimes)
+	collector.now = func() time.Time { return now }
+
+	expected := `
+# HELP test_oldest_prepared_claim_age_seconds [ALPHA] Time since the oldest claim prepared on the node was prepared.
+# TYPE test_oldest_prepared_claim_age_seconds gauge
+test_oldest_prepared_claim_age_seconds 90
+# HELP test_prepared_claims [ALPHA] Number of claims prepared on the node.
+# TYPE test_prepared_claims gauge
+test_prepared_claims 2
+`
+	if err := testutil.CustomCollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	resourcev1 "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+	"k8s.io/klog/v2"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+)
+
+// DefaultDeviceReadinessInterval is how often device nodes of withheld
+// devices are checked by default. The gate needs the host /dev visible to the
+// driver under the devfs root, so it is disabled unless the interval is set.
+const DefaultDeviceReadinessInterval = time.Duration(0)
+
+// DeviceReadiness withholds devices from the published resources until the
+// device nodes of their CDI devices exist, e.g. VFs not yet created or bound,
+// so that the scheduler does not allocate devices whose container edits
+// would fail. Devices without a CDI device are not withheld. Nil
+// DeviceReadiness withholds nothing.
+type DeviceReadiness struct {
+	sync.Mutex
+	cdiCache  *cdiapi.Cache
+	cdiKind   string
+	devfsRoot string
+	interval  time.Duration
+	withheld  map[string]bool
+}
+
+// NewDeviceReadiness returns nil if the interval is 0, disabling the gate.
+// CDI devices of given kind (vendor/class) are looked up from the cache.
+func NewDeviceReadiness(cdiCache *cdiapi.Cache, cdiKind string, interval time.Duration) *DeviceReadiness {
+	if interval <= 0 {
+		klog.V(3).Info("Device readiness gate disabled")
+		return nil
+	}
+
+	return &DeviceReadiness{
+		cdiCache:  cdiCache,
+		cdiKind:   cdiKind,
+		devfsRoot: GetDevfsRoot(DevfsEnvVarName, ""),
+		interval:  interval,
+		withheld:  map[string]bool{},
+	}
+}
+
+// Ready returns false if any device node of the CDI device is missing.
+func (r *DeviceReadiness) Ready(deviceName string) bool {
+	cdiDevice := r.cdiCache.GetDevice(r.cdiKind + "=" + deviceName)
+	if cdiDevice == nil {
+		return true
+	}
+
+	for _, deviceNode := range cdiDevice.ContainerEdits.DeviceNodes {
+		if _, err := os.Stat(r.hostPath(deviceNode.HostPath, deviceNode.Path)); err != nil {
+			klog.V(5).Infof("Device node %v of device %v is not ready: %v", deviceNode.Path, deviceName, err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// hostPath returns the device node path on the host. Without explicit host
+// path the container path is looked up under the devfs root.
+func (r *DeviceReadiness) hostPath(hostPath string, containerPath string) string {
+	if hostPath != "" {
+		return hostPath
+	}
+
+	if relative, found := strings.CutPrefix(containerPath, devfsDefaultRoot+"/"); found {
+		return path.Join(r.devfsRoot, relative)
+	}
+
+	return containerPath
+}
+
+// Withheld returns the names of withheld devices, sorted.
+func (r *DeviceReadiness) Withheld() []string {
+	if r == nil {
+		return nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	withheld := []string{}
+	for deviceName := range r.withheld {
+		withheld = append(withheld, deviceName)
+	}
+	slices.Sort(withheld)
+
+	return withheld
+}
+
+// Apply removes devices that are not ready from the resources, and
+// remembers them until they are published.
+func (r *DeviceReadiness) Apply(resources resourceslice.DriverResources) resourceslice.DriverResources {
+	if r == nil {
+		return resources
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	withheld := map[string]bool{}
+	for _, pool := range resources.Pools {
+		for i := range pool.Slices {
+			pool.Slices[i].Devices = slices.DeleteFunc(pool.Slices[i].Devices, func(device resourcev1.Device) bool {
+				if r.Ready(device.Name) {
+					return false
+				}
+				withheld[device.Name] = true
+				return true
+			})
+		}
+	}
+
+	for deviceName := range withheld {
+		if !r.withheld[deviceName] {
+			klog.Warningf("Device nodes of device %v are missing, not publishing it until they exist", deviceName)
+		}
+	}
+	for deviceName := range r.withheld {
+		if !withheld[deviceName] {
+			klog.Infof("Device nodes of device %v exist, publishing it", deviceName)
+		}
+	}
+	r.withheld = withheld
+
+	return resources
+}
+
+// Watch checks device nodes of the withheld devices every interval, and calls
+// onReady when any of them became ready, until the context is done.
+func (r *DeviceReadiness) Watch(ctx context.Context, onReady func()) {
+	if r == nil {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if slices.ContainsFunc(r.Withheld(), r.Ready) {
+				onReady()
+			}
+		}
+	}
+}
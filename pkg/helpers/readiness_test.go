@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	resourcev1 "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+)
+
+const readinessTestSpec = `cdiVersion: 0.5.0
+kind: intel.com/test
+devices:
+- name: ready
+  containerEdits:
+    deviceNodes:
+    - path: /dev/dri/card0
+      hostPath: HOSTPATH
+- name: pending
+  containerEdits:
+    deviceNodes:
+    - path: /dev/vfio/7
+`
+
+func TestDeviceReadiness(t *testing.T) {
+	if NewDeviceReadiness(nil, "intel.com/test", 0) != nil {
+		t.Errorf("expected nil device readiness for zero interval")
+	}
+	var disabled *DeviceReadiness
+	resources := readinessTestResources("pending")
+	if disabled.Apply(resources).Pools["node1"].Slices[0].Devices[0].Name != "pending" {
+		t.Errorf("expected disabled device readiness to withhold nothing")
+	}
+
+	testDir := t.TempDir()
+	devfsRoot := path.Join(testDir, "dev")
+	hostPath := path.Join(testDir, "host", "card0")
+	for _, dirPath := range []string{path.Join(devfsRoot, "vfio"), path.Dir(hostPath)} {
+		if err := os.MkdirAll(dirPath, 0750); err != nil {
+			t.Fatalf("setup error: %v", err)
+		}
+	}
+	if err := os.WriteFile(hostPath, nil, 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	t.Setenv(DevfsEnvVarName, devfsRoot)
+
+	cdiRoot := path.Join(testDir, "cdi")
+	if err := os.MkdirAll(cdiRoot, 0750); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if err := os.WriteFile(path.Join(cdiRoot, "intel.com-test.yaml"), []byte(strings.Replace(readinessTestSpec, "HOSTPATH", hostPath, 1)), 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(cdiRoot), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("could not create CDI cache: %v", err)
+	}
+
+	readiness := NewDeviceReadiness(cdiCache, "intel.com/test", 10*time.Millisecond)
+	resources = readiness.Apply(readinessTestResources("ready", "pending", "plain"))
+
+	published := []string{}
+	for _, device := range resources.Pools["node1"].Slices[0].Devices {
+		published = append(published, device.Name)
+	}
+	if !reflect.DeepEqual(published, []string{"ready", "plain"}) {
+		t.Errorf("expected devices ready and without CDI device to be published, got %v", published)
+	}
+	if !reflect.DeepEqual(readiness.Withheld(), []string{"pending"}) {
+		t.Errorf("expected pending device to be withheld, got %v", readiness.Withheld())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ready := make(chan struct{})
+	go readiness.Watch(ctx, func() {
+		cancel()
+		close(ready)
+	})
+
+	if err := os.WriteFile(path.Join(devfsRoot, "vfio", "7"), nil, 0600); err != nil {
+		t.Fatalf("could not create device node: %v", err)
+	}
+
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("withheld device becoming ready was not noticed")
+	}
+
+	readiness.Apply(readinessTestResources("pending"))
+	if len(readiness.Withheld()) != 0 {
+		t.Errorf("expected no withheld devices, got %v", readiness.Withheld())
+	}
+}
+
+func TestDeviceReadinessDeviceNodeCreatedAfterStartup(t *testing.T) {
+	testDir := t.TempDir()
+	devfsRoot := path.Join(testDir, "dev")
+	if err := os.MkdirAll(path.Join(devfsRoot, "vfio"), 0750); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	t.Setenv(DevfsEnvVarName, devfsRoot)
+
+	cdiRoot := path.Join(testDir, "cdi")
+	if err := os.MkdirAll(cdiRoot, 0750); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if err := os.WriteFile(path.Join(cdiRoot, "intel.com-test.yaml"), []byte(readinessTestSpec), 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(cdiRoot), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("could not create CDI cache: %v", err)
+	}
+
+	readiness := NewDeviceReadiness(cdiCache, "intel.com/test", time.Second)
+	resources := readiness.Apply(readinessTestResources("pending"))
+	if devices := resources.Pools["node1"].Slices[0].Devices; len(devices) != 0 {
+		t.Errorf("expected device without device node to be withheld at startup, got %v", devices)
+	}
+
+	// The device node is created on the host after the driver started.
+	if err := os.WriteFile(path.Join(devfsRoot, "vfio", "7"), nil, 0600); err != nil {
+		t.Fatalf("could not create device node: %v", err)
+	}
+
+	resources = readiness.Apply(readinessTestResources("pending"))
+	if devices := resources.Pools["node1"].Slices[0].Devices; len(devices) != 1 || devices[0].Name != "pending" {
+		t.Errorf("expected device to be published once its device node exists, got %v", devices)
+	}
+	if len(readiness.Withheld()) != 0 {
+		t.Errorf("expected no withheld devices, got %v", readiness.Withheld())
+	}
+}
+
+func readinessTestResources(deviceNames ...string) resourceslice.DriverResources {
+	devices := []resourcev1.Device{}
+	for _, deviceName := range deviceNames {
+		devices = append(devices, resourcev1.Device{Name: deviceName})
+	}
+
+	return resourceslice.DriverResources{
+		Pools: map[string]resourceslice.Pool{
+			"node1": {Slices: []resourceslice.Slice{{Devices: devices}}},
+		},
+	}
+}
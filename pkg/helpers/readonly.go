@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+
+	"k8s.io/klog/v2"
+)
+
+const writeCheckFile = ".write-check"
+
+// ErrReadOnlyFilesystem is returned when the prepared claims cannot be stored
+// because the kubelet plugin directory is on a read-only filesystem.
+var ErrReadOnlyFilesystem = errors.New("kubelet plugin directory is on a read-only filesystem")
+
+var (
+	// writeFile is replaced in tests to simulate a read-only filesystem.
+	writeFile = os.WriteFile
+
+	// Keep prepared claims only in memory when the plugin directory is read-only.
+	inMemoryFallbackAllowed atomic.Bool
+	// Prepared claims are no longer written to the file.
+	preparedClaimsInMemory atomic.Bool
+)
+
+// SetInMemoryFallback allows keeping prepared claims in memory only when the
+// kubelet plugin directory turns out to be read-only.
+func SetInMemoryFallback(allowed bool) {
+	inMemoryFallbackAllowed.Store(allowed)
+}
+
+// PreparedClaimsInMemory returns true if prepared claims are not persisted
+// because the kubelet plugin directory is read-only.
+func PreparedClaimsInMemory() bool {
+	return preparedClaimsInMemory.Load()
+}
+
+func isReadOnlyError(err error) bool {
+	return errors.Is(err, syscall.EROFS)
+}
+
+// enablePreparedClaimsInMemory switches to in-memory prepared claims, if
+// allowed. Returns false when the fallback is not allowed.
+func enablePreparedClaimsInMemory(cause error) bool {
+	if !inMemoryFallbackAllowed.Load() {
+		return false
+	}
+
+	if !preparedClaimsInMemory.Swap(true) {
+		klog.Errorf("WARNING: %v, prepared claims are kept in memory only and will be LOST on driver restart: %v", ErrReadOnlyFilesystem, cause)
+	}
+
+	return true
+}
+
+// CheckDirWritable returns ErrReadOnlyFilesystem if files cannot be created in
+// the directory because its filesystem is mounted read-only.
+func CheckDirWritable(dir string) error {
+	checkFile := filepath.Join(dir, writeCheckFile)
+	if err := writeFile(checkFile, []byte{}, 0600); err != nil {
+		if isReadOnlyError(err) {
+			return fmt.Errorf("%w: %v", ErrReadOnlyFilesystem, err)
+		}
+		return fmt.Errorf("could not write to directory %v: %v", dir, err)
+	}
+
+	if err := os.Remove(checkFile); err != nil {
+		klog.Warningf("could not remove %v: %v", checkFile, err)
+	}
+
+	return nil
+}
+
+// WritePreparedClaimsBytes writes encoded prepared claims to the file. On a
+// read-only filesystem it either returns ErrReadOnlyFilesystem or, when the
+// in-memory fallback is allowed, skips writing.
+func WritePreparedClaimsBytes(preparedClaimFilePath string, data []byte) error {
+	if PreparedClaimsInMemory() {
+		klog.V(5).Infof("prepared claims kept in memory, not writing %v", preparedClaimFilePath)
+		return nil
+	}
+
+	err := writeFile(preparedClaimFilePath, data, 0600)
+	if err == nil || !isReadOnlyError(err) {
+		return err
+	}
+
+	if enablePreparedClaimsInMemory(err) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %v", ErrReadOnlyFilesystem, err)
+}
+
+// Validate checks that the common configuration is usable. A read-only kubelet
+// plugin directory is an error, unless the in-memory fallback is enabled.
+func (c *Config) Validate() error {
+	SetInMemoryFallback(c.CommonFlags.InMemoryFallback)
+
+	err := CheckDirWritable(c.CommonFlags.KubeletPluginDir)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, ErrReadOnlyFilesystem) && enablePreparedClaimsInMemory(err) {
+		return nil
+	}
+
+	return err
+}
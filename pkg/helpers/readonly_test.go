@@ -0,0 +1,95 @@
+package helpers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// simulateReadOnly makes writes fail with EROFS and resets the in-memory
+// fallback state after the test.
+func simulateReadOnly(t *testing.T) {
+	origWriteFile := writeFile
+	t.Cleanup(func() {
+		writeFile = origWriteFile
+		inMemoryFallbackAllowed.Store(false)
+		preparedClaimsInMemory.Store(false)
+	})
+
+	writeFile = func(name string, _ []byte, _ os.FileMode) error {
+		return &os.PathError{Op: "open", Path: name, Err: syscall.EROFS}
+	}
+}
+
+func TestReadOnlyPluginDir(t *testing.T) {
+	tests := []struct {
+		name             string
+		inMemoryFallback bool
+	}{
+		{name: "fallback disabled", inMemoryFallback: false},
+		{name: "fallback enabled", inMemoryFallback: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginDir := t.TempDir()
+			simulateReadOnly(t)
+
+			config := &Config{CommonFlags: &Flags{KubeletPluginDir: pluginDir, InMemoryFallback: tt.inMemoryFallback}}
+			err := config.Validate()
+			if tt.inMemoryFallback {
+				if err != nil {
+					t.Fatalf("unexpected validation error: %v", err)
+				}
+				if !PreparedClaimsInMemory() {
+					t.Fatal("expected prepared claims to be kept in memory")
+				}
+			} else {
+				if !errors.Is(err, ErrReadOnlyFilesystem) {
+					t.Fatalf("expected ErrReadOnlyFilesystem, got %v", err)
+				}
+				if PreparedClaimsInMemory() {
+					t.Fatal("expected prepared claims not to be kept in memory")
+				}
+			}
+
+			filePath := filepath.Join(pluginDir, "preparedClaims.json")
+			err = WritePreparedClaimsToFile(filePath, ClaimPreparations{})
+			if tt.inMemoryFallback {
+				if err != nil {
+					t.Fatalf("unexpected write error: %v", err)
+				}
+				preparedClaims, _, err := GetOrCreatePreparedClaims(filePath)
+				if err != nil || len(preparedClaims) != 0 {
+					t.Fatalf("expected empty prepared claims, got %v, error: %v", preparedClaims, err)
+				}
+			} else if !errors.Is(err, ErrReadOnlyFilesystem) {
+				t.Fatalf("expected ErrReadOnlyFilesystem, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadOnlyFallbackOnWrite(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "preparedClaims.json")
+	config := &Config{CommonFlags: &Flags{KubeletPluginDir: filepath.Dir(filePath), InMemoryFallback: true}}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if PreparedClaimsInMemory() {
+		t.Fatal("expected prepared claims to be written to file")
+	}
+
+	// Filesystem remounted read-only after startup.
+	simulateReadOnly(t)
+	inMemoryFallbackAllowed.Store(true)
+
+	if err := WritePreparedClaimsToFile(filePath, ClaimPreparations{}); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+	if !PreparedClaimsInMemory() {
+		t.Fatal("expected prepared claims to be kept in memory after read-only write")
+	}
+}
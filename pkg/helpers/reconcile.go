@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+)
+
+// DefaultReconcileInterval is how often prepared claims are reconciled with
+// the CDI specs by default. Reconciliation drops claims and removes CDI devices,
+// so it is disabled unless the interval is set explicitly.
+const DefaultReconcileInterval = time.Duration(0)
+
+// ReconcileAdapter provides the driver-specific parts of reconciling prepared
+// claims with the CDI registry. Its methods are called with the node state
+// lock held.
+type ReconcileAdapter interface {
+	// PreparedCDIDevices returns the qualified names of the CDI devices the
+	// driver created for the prepared claims, mapped by claim UID.
+	PreparedCDIDevices() map[string][]string
+	// PreparedClaimBacked returns false if devices of the prepared claim no
+	// longer exist on the node.
+	PreparedClaimBacked(claimUID string) bool
+	// RecreateCDIDevices recreates the CDI devices of the prepared claim that
+	// are missing from the CDI registry.
+	RecreateCDIDevices(claimUID string, missing []string) error
+	// DropPreparedClaim frees the devices of the prepared claim and forgets it.
+	DropPreparedClaim(claimUID string) error
+	// IsValidCDIDevice returns false for CDI devices of the driver that are
+	// backed by neither an allocatable device nor a prepared claim.
+	IsValidCDIDevice(deviceName string) bool
+}
+
+// ReconcileResult counts the repairs done by ReconcileCDI.
+type ReconcileResult struct {
+	// Prepared claims with missing CDI devices recreated.
+	RecreatedClaims int
+	// Prepared claims dropped because their devices are gone.
+	DroppedClaims int
+	// CDI devices removed because nothing backs them.
+	RemovedCDIDevices int
+}
+
+// Changed returns true if anything was repaired.
+func (r ReconcileResult) Changed() bool {
+	return r.RecreatedClaims > 0 || r.DroppedClaims > 0 || r.RemovedCDIDevices > 0
+}
+
+// ReconcileCDI repairs drift between prepared claims and the CDI registry,
+// e.g. after a crash or manual edits: missing CDI devices of prepared claims
+// are recreated, prepared claims whose devices are gone are dropped, and CDI
+// devices of given kind (vendor/class) backed by nothing are removed.
+func ReconcileCDI(cdiCache *cdiapi.Cache, cdiKind string, adapter ReconcileAdapter) (ReconcileResult, error) {
+	result := ReconcileResult{}
+
+	if err := cdiCache.Refresh(); err != nil {
+		klog.V(5).Infof("CDI registry refresh reported errors: %v", err)
+	}
+
+	for claimUID, cdiDevices := range adapter.PreparedCDIDevices() {
+		if !adapter.PreparedClaimBacked(claimUID) {
+			klog.Warningf("Devices of prepared claim %v are gone, dropping the claim", claimUID)
+			if err := adapter.DropPreparedClaim(claimUID); err != nil {
+				klog.Errorf("Could not drop prepared claim %v: %v", claimUID, err)
+				continue
+			}
+			result.DroppedClaims++
+			continue
+		}
+
+		missing := []string{}
+		for _, cdiDevice := range cdiDevices {
+			if cdiCache.GetDevice(cdiDevice) == nil {
+				missing = append(missing, cdiDevice)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		klog.Warningf("CDI devices %v of prepared claim %v are missing, recreating them", missing, claimUID)
+		if err := adapter.RecreateCDIDevices(claimUID, missing); err != nil {
+			klog.Errorf("Could not recreate CDI devices of prepared claim %v: %v", claimUID, err)
+			continue
+		}
+		result.RecreatedClaims++
+	}
+
+	removed, err := RemoveStaleCDIDevices(cdiCache, cdiKind, adapter.IsValidCDIDevice)
+	result.RemovedCDIDevices = removed
+
+	return result, err
+}
+
+// RunReconciler calls reconcile every interval until the context is done.
+// Zero interval disables reconciliation.
+func RunReconciler(ctx context.Context, interval time.Duration, reconcile func() (ReconcileResult, error)) {
+	if interval <= 0 {
+		klog.V(3).Info("Reconciliation of prepared claims with CDI specs disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := reconcile()
+			if err != nil {
+				klog.Errorf("Reconciling prepared claims with CDI specs: %v", err)
+			}
+			if result.Changed() {
+				klog.Infof("Reconciled prepared claims with CDI specs: %d claims with CDI devices recreated, %d claims dropped, %d stale CDI devices removed",
+					result.RecreatedClaims, result.DroppedClaims, result.RemovedCDIDevices)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+)
+
+type fakeReconcileAdapter struct {
+	prepared  map[string][]string
+	unbacked  map[string]bool
+	failing   map[string]bool
+	recreated map[string][]string
+	dropped   []string
+}
+
+func (a *fakeReconcileAdapter) PreparedCDIDevices() map[string][]string {
+	return a.prepared
+}
+
+func (a *fakeReconcileAdapter) PreparedClaimBacked(claimUID string) bool {
+	return !a.unbacked[claimUID]
+}
+
+func (a *fakeReconcileAdapter) RecreateCDIDevices(claimUID string, missing []string) error {
+	if a.failing[claimUID] {
+		return fmt.Errorf("write failed")
+	}
+	a.recreated[claimUID] = missing
+	return nil
+}
+
+func (a *fakeReconcileAdapter) DropPreparedClaim(claimUID string) error {
+	a.dropped = append(a.dropped, claimUID)
+	delete(a.prepared, claimUID)
+	return nil
+}
+
+func (a *fakeReconcileAdapter) IsValidCDIDevice(deviceName string) bool {
+	return deviceName == "device1"
+}
+
+func TestReconcileCDI(t *testing.T) {
+	cdiRoot := t.TempDir()
+	if err := os.WriteFile(path.Join(cdiRoot, "intel.com-test.yaml"), []byte(staleTestSpec), 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(cdiRoot), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("could not create CDI cache: %v", err)
+	}
+
+	adapter := &fakeReconcileAdapter{
+		prepared: map[string][]string{
+			"uid1": {"intel.com/test=device1"},
+			"uid2": {"intel.com/test=device1", "intel.com/test=device2"},
+			"uid3": {"intel.com/test=device3"},
+			"uid4": {"intel.com/test=device4"},
+		},
+		unbacked:  map[string]bool{"uid3": true},
+		failing:   map[string]bool{"uid4": true},
+		recreated: map[string][]string{},
+	}
+
+	result, err := ReconcileCDI(cdiCache, "intel.com/test", adapter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedResult := ReconcileResult{RecreatedClaims: 1, DroppedClaims: 1, RemovedCDIDevices: 1}
+	if result != expectedResult {
+		t.Errorf("expected result %+v, got %+v", expectedResult, result)
+	}
+	if !result.Changed() {
+		t.Error("expected result to report changes")
+	}
+
+	expectedRecreated := map[string][]string{"uid2": {"intel.com/test=device2"}}
+	if !reflect.DeepEqual(adapter.recreated, expectedRecreated) {
+		t.Errorf("expected recreated CDI devices %v, got %v", expectedRecreated, adapter.recreated)
+	}
+	if !reflect.DeepEqual(adapter.dropped, []string{"uid3"}) {
+		t.Errorf("expected dropped claims [uid3], got %v", adapter.dropped)
+	}
+
+	if err := cdiCache.Refresh(); err != nil {
+		t.Fatalf("could not refresh CDI cache: %v", err)
+	}
+	if devices := cdiCache.ListDevices(); !reflect.DeepEqual(devices, []string{"intel.com/test=device1"}) {
+		t.Errorf("expected stale CDI devices to be removed, got %v", devices)
+	}
+
+	if (ReconcileResult{}).Changed() {
+		t.Error("expected empty result to report no changes")
+	}
+}
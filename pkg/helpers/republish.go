@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+	"k8s.io/klog/v2"
+)
+
+// DefaultRepublishInterval is how often resources are compared with the
+// published ones by default.
+const DefaultRepublishInterval = 5 * time.Minute
+
+// Republisher periodically recomputes the resources, and republishes them
+// when they differ from the last published ones, in case a republish after
+// a device change was missed. Nil Republisher does nothing.
+type Republisher struct {
+	sync.Mutex
+	interval  time.Duration
+	published *resourceslice.DriverResources
+}
+
+// NewRepublisher returns nil if the interval is 0, disabling periodic
+// republishing.
+func NewRepublisher(interval time.Duration) *Republisher {
+	if interval <= 0 {
+		klog.V(3).Info("Periodic ResourceSlice republishing disabled")
+		return nil
+	}
+
+	return &Republisher{interval: interval}
+}
+
+// Published remembers the resources as the last published ones.
+func (r *Republisher) Published(resources resourceslice.DriverResources) {
+	if r == nil {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.published = resources.DeepCopy()
+}
+
+// Changed returns true if the resources differ from the last published ones,
+// or nothing was published yet.
+func (r *Republisher) Changed(resources resourceslice.DriverResources) bool {
+	if r == nil {
+		return false
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	return r.published == nil || !apiequality.Semantic.DeepEqual(*r.published, resources)
+}
+
+// Run recomputes the resources every interval, and calls publish when they
+// changed since last published, until the context is done.
+func (r *Republisher) Run(ctx context.Context, getResources func() resourceslice.DriverResources, publish func(context.Context) error) {
+	if r == nil {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.Changed(getResources()) {
+				klog.V(5).Info("Resources unchanged since last published")
+				continue
+			}
+
+			klog.Warning("Resources changed since last published, republishing")
+			if err := publish(ctx); err != nil {
+				klog.Errorf("Could not republish resources: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	resourcev1 "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+)
+
+func TestRepublisher(t *testing.T) {
+	if NewRepublisher(0) != nil {
+		t.Errorf("expected nil republisher for zero interval")
+	}
+	var disabled *Republisher
+	disabled.Published(readinessTestResources("device1"))
+	if disabled.Changed(readinessTestResources("device2")) {
+		t.Errorf("expected disabled republisher to never report changes")
+	}
+
+	republisher := NewRepublisher(10 * time.Millisecond)
+	resources := readinessTestResources("device1")
+	if !republisher.Changed(resources) {
+		t.Errorf("expected change before anything was published")
+	}
+
+	republisher.Published(resources)
+	if republisher.Changed(readinessTestResources("device1")) {
+		t.Errorf("expected no change for identical resources")
+	}
+
+	// The published state must not follow later changes of the published resources.
+	resources.Pools["node1"].Slices[0].Devices[0].Name = "device2"
+	if !republisher.Changed(resources) {
+		t.Errorf("expected change for renamed device")
+	}
+
+	withCapacity := func(quantity resource.Quantity) resourceslice.DriverResources {
+		resources := readinessTestResources("device1")
+		resources.Pools["node1"].Slices[0].Devices[0].Capacity = map[resourcev1.QualifiedName]resourcev1.DeviceCapacity{
+			"memory": {Value: quantity},
+		}
+		return resources
+	}
+	quantity := resource.MustParse("1Gi")
+	_ = quantity.String()
+	republisher.Published(withCapacity(quantity))
+	if republisher.Changed(withCapacity(resource.MustParse("1024Mi"))) {
+		t.Errorf("expected no change for semantically equal capacity")
+	}
+}
+
+func TestRepublisherRun(t *testing.T) {
+	republisher := NewRepublisher(10 * time.Millisecond)
+	republisher.Published(readinessTestResources("device1"))
+
+	var lock sync.Mutex
+	current := readinessTestResources("device1")
+	getResources := func() resourceslice.DriverResources {
+		lock.Lock()
+		defer lock.Unlock()
+		return *current.DeepCopy()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	published := make(chan struct{}, 1)
+	go republisher.Run(ctx, getResources, func(context.Context) error {
+		resources := getResources()
+		republisher.Published(resources)
+		published <- struct{}{}
+		return nil
+	})
+
+	select {
+	case <-published:
+		t.Fatal("unchanged resources were republished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	lock.Lock()
+	current = readinessTestResources("device1", "device2")
+	lock.Unlock()
+
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("changed resources were not republished")
+	}
+
+	select {
+	case <-published:
+		t.Fatal("resources were republished again without changes")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
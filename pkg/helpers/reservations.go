@@ -0,0 +1,360 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	resourcev1 "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	coreclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ReservedDevicesAnnotationSuffix follows the driver name in the Node
+	// annotation listing reserved devices, e.g. gpu.intel.com/reserved-devices.
+	ReservedDevicesAnnotationSuffix = "/reserved-devices"
+	// ReservedAttribute is published as true for reserved devices.
+	ReservedAttribute = "reserved"
+	// ReservedTaintKey taints reserved devices, so that they are not scheduled.
+	ReservedTaintKey = "Reserved"
+	// MaintenanceAnnotationSuffix follows the driver name in the Node
+	// annotation enabling maintenance mode, e.g. gpu.intel.com/maintenance.
+	MaintenanceAnnotationSuffix = "/maintenance"
+
+	reservationsWatchRetryInterval = 10 * time.Second
+)
+
+// Reservations tracks devices the cluster operator reserved with a Node
+// annotation, e.g. for maintenance. Reserved devices stay published, but are
+// tainted and claims allocating them are not prepared. Reserving a device also
+// reserves its parent and child devices, e.g. the PF device of a QAT VF. In
+// maintenance mode no devices are published and no new claims are prepared.
+// Nil Reservations reserve nothing.
+type Reservations struct {
+	sync.Mutex
+	driverName  string
+	devices     map[string]bool
+	pinned      map[string]bool
+	parents     map[string]string
+	maintenance bool
+}
+
+// NewReservations returns reservations of the driver devices, empty until
+// loaded from the Node.
+func NewReservations(driverName string) *Reservations {
+	return &Reservations{
+		driverName: driverName,
+		devices:    map[string]bool{},
+		pinned:     map[string]bool{},
+		parents:    map[string]string{},
+	}
+}
+
+// Annotation returns the Node annotation listing reserved devices.
+func (r *Reservations) Annotation() string {
+	return r.driverName + ReservedDevicesAnnotationSuffix
+}
+
+// MaintenanceAnnotation returns the Node annotation enabling maintenance mode.
+func (r *Reservations) MaintenanceAnnotation() string {
+	return r.driverName + MaintenanceAnnotationSuffix
+}
+
+// Maintenance returns true in maintenance mode.
+func (r *Reservations) Maintenance() bool {
+	if r == nil {
+		return false
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	return r.maintenance
+}
+
+// SetParents sets the parent device of the devices that are part of another
+// published device, mapped by device name.
+func (r *Reservations) SetParents(parents map[string]string) {
+	if r == nil {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.parents = parents
+}
+
+// Reserved returns true if the device, its parent device or any of its child
+// devices is reserved.
+func (r *Reservations) Reserved(deviceName string) bool {
+	if r == nil {
+		return false
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.listed(deviceName) {
+		return true
+	}
+	if parent, found := r.parents[deviceName]; found && r.listed(parent) {
+		return true
+	}
+	for child, parent := range r.parents {
+		if parent == deviceName && r.listed(child) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listed returns true if the device itself is reserved. Must be called with
+// the lock held.
+func (r *Reservations) listed(deviceName string) bool {
+	return r.devices[deviceName] || r.pinned[deviceName]
+}
+
+// Devices returns the names of reserved devices, sorted.
+func (r *Reservations) Devices() []string {
+	if r == nil {
+		return nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	devices := map[string]bool{}
+	maps.Copy(devices, r.devices)
+	maps.Copy(devices, r.pinned)
+
+	return slices.Sorted(maps.Keys(devices))
+}
+
+// Pin reserves the devices independent of the Node annotation, e.g. devices
+// the driver keeps from workloads by itself.
+func (r *Reservations) Pin(deviceNames ...string) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, deviceName := range deviceNames {
+		r.pinned[deviceName] = true
+	}
+}
+
+// Update sets the reserved devices from the comma-separated device names in
+// the Node annotations, and maintenance mode from the boolean maintenance
+// annotation. Returns true if the reservations changed.
+func (r *Reservations) Update(annotations map[string]string) bool {
+	devices := map[string]bool{}
+	for _, deviceName := range strings.Split(annotations[r.Annotation()], ",") {
+		if deviceName = strings.TrimSpace(deviceName); deviceName != "" {
+			devices[deviceName] = true
+		}
+	}
+
+	maintenance := false
+	if value, found := annotations[r.MaintenanceAnnotation()]; found {
+		var err error
+		if maintenance, err = strconv.ParseBool(value); err != nil {
+			klog.Warningf("Invalid %v annotation value '%v', maintenance mode stays disabled", r.MaintenanceAnnotation(), value)
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	changed := false
+	if !maps.Equal(devices, r.devices) {
+		r.devices = devices
+		klog.Infof("Reserved devices: %v", slices.Sorted(maps.Keys(devices)))
+		changed = true
+	}
+
+	if maintenance != r.maintenance {
+		r.maintenance = maintenance
+		klog.Infof("Maintenance mode enabled: %v", maintenance)
+		changed = true
+	}
+
+	return changed
+}
+
+// Load reads the reserved devices and maintenance mode from the Node annotations.
+func (r *Reservations) Load(ctx context.Context, client coreclientset.Interface, nodeName string) error {
+	node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get node %v: %w", nodeName, err)
+	}
+
+	r.Update(node.Annotations)
+
+	return nil
+}
+
+// Watch updates the reserved devices when the Node annotations change, and
+// calls onChange after they changed, until the context is done.
+func (r *Reservations) Watch(ctx context.Context, client coreclientset.Interface, nodeName string, onChange func()) {
+	listOptions := metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", nodeName).String()}
+
+	for {
+		watcher, err := client.CoreV1().Nodes().Watch(ctx, listOptions)
+		if err != nil {
+			klog.Errorf("Could not watch node %v for device reservations: %v", nodeName, err)
+		} else {
+			r.consumeEvents(ctx, watcher, onChange)
+			watcher.Stop()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reservationsWatchRetryInterval):
+		}
+	}
+}
+
+// consumeEvents handles Node events until the watch or the context ends.
+func (r *Reservations) consumeEvents(ctx context.Context, watcher watch.Interface, onChange func()) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				klog.V(5).Info("Node watch for device reservations ended, restarting")
+				return
+			}
+			node, isNode := event.Object.(*corev1.Node)
+			if !isNode || (event.Type != watch.Added && event.Type != watch.Modified) {
+				continue
+			}
+			if r.Update(node.Annotations) {
+				onChange()
+			}
+		}
+	}
+}
+
+// CheckClaim returns an error if reserved devices of the driver are allocated
+// to the claim, or any devices of the driver in maintenance mode.
+func (r *Reservations) CheckClaim(claim *resourcev1.ResourceClaim) error {
+	if r == nil || claim.Status.Allocation == nil {
+		return nil
+	}
+
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver != r.driverName {
+			continue
+		}
+		if r.Maintenance() {
+			return fmt.Errorf("driver %v is in maintenance mode, not preparing claim %v", r.driverName, claim.UID)
+		}
+		if r.Reserved(result.Device) {
+			return fmt.Errorf("device %v allocated to claim %v is reserved", result.Device, claim.UID)
+		}
+	}
+
+	return nil
+}
+
+// Apply publishes the reserved devices in the resources with the reserved
+// attribute and a NoSchedule taint. Slices with tainted devices are split to
+// stay within ResourceSliceMaxDevicesWithTaintsOrConsumesCounters devices. In
+// maintenance mode the slices are published without devices.
+func (r *Reservations) Apply(resources resourceslice.DriverResources) resourceslice.DriverResources {
+	if r == nil {
+		return resources
+	}
+
+	if r.Maintenance() {
+		for _, pool := range resources.Pools {
+			for i := range pool.Slices {
+				pool.Slices[i].Devices = []resourcev1.Device{}
+			}
+		}
+
+		return resources
+	}
+
+	for poolName, pool := range resources.Pools {
+		tainted := false
+		for _, slice := range pool.Slices {
+			for i := range slice.Devices {
+				if !r.Reserved(slice.Devices[i].Name) {
+					continue
+				}
+				tainted = true
+				reserved := true
+				if slice.Devices[i].Attributes == nil {
+					slice.Devices[i].Attributes = map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{}
+				}
+				slice.Devices[i].Attributes[ReservedAttribute] = resourcev1.DeviceAttribute{BoolValue: &reserved}
+				slice.Devices[i].Taints = append(slice.Devices[i].Taints, resourcev1.DeviceTaint{
+					Key:    ReservedTaintKey,
+					Effect: resourcev1.DeviceTaintEffectNoSchedule,
+				})
+			}
+		}
+		if tainted {
+			pool.Slices = splitTaintedSlices(pool.Slices)
+			resources.Pools[poolName] = pool
+		}
+	}
+
+	return resources
+}
+
+// splitTaintedSlices splits slices with tainted devices into slices of at most
+// ResourceSliceMaxDevicesWithTaintsOrConsumesCounters devices. Slices with
+// shared counters are left as they are, their devices are split by the driver.
+func splitTaintedSlices(resourceSlices []resourceslice.Slice) []resourceslice.Slice {
+	split := []resourceslice.Slice{}
+	for _, slice := range resourceSlices {
+		if len(slice.Devices) <= resourcev1.ResourceSliceMaxDevicesWithTaintsOrConsumesCounters ||
+			len(slice.SharedCounters) != 0 || !hasTaints(slice.Devices) {
+			split = append(split, slice)
+			continue
+		}
+		for chunk := range slices.Chunk(slice.Devices, resourcev1.ResourceSliceMaxDevicesWithTaintsOrConsumesCounters) {
+			split = append(split, resourceslice.Slice{Devices: chunk, PerDeviceNodeSelection: slice.PerDeviceNodeSelection})
+		}
+	}
+
+	return split
+}
+
+// hasTaints returns true if any of the devices is tainted.
+func hasTaints(devices []resourcev1.Device) bool {
+	return slices.ContainsFunc(devices, func(device resourcev1.Device) bool {
+		return len(device.Taints) != 0
+	})
+}
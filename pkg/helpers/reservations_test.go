@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	resourcev1 "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+)
+
+func TestReservations(t *testing.T) {
+	reservations := NewReservations("gpu.intel.com")
+	if reservations.Annotation() != "gpu.intel.com/reserved-devices" {
+		t.Errorf("unexpected annotation %v", reservations.Annotation())
+	}
+
+	if !reservations.Update(map[string]string{"gpu.intel.com/reserved-devices": " card1, card0,,"}) {
+		t.Error("expected reservations to change")
+	}
+	if reservations.Update(map[string]string{"gpu.intel.com/reserved-devices": "card0,card1"}) {
+		t.Error("expected reservations not to change")
+	}
+	if devices := reservations.Devices(); !reflect.DeepEqual(devices, []string{"card0", "card1"}) {
+		t.Errorf("expected reserved devices [card0 card1], got %v", devices)
+	}
+
+	claim := &resourcev1.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{UID: "uid1"},
+		Status: resourcev1.ResourceClaimStatus{Allocation: &resourcev1.AllocationResult{
+			Devices: resourcev1.DeviceAllocationResult{Results: []resourcev1.DeviceRequestAllocationResult{
+				{Driver: "gpu.intel.com", Device: "card2"},
+				{Driver: "other.intel.com", Device: "card0"},
+			}},
+		}},
+	}
+	if err := reservations.CheckClaim(claim); err != nil {
+		t.Errorf("unexpected error for claim without reserved devices: %v", err)
+	}
+	claim.Status.Allocation.Devices.Results[0].Device = "card1"
+	if err := reservations.CheckClaim(claim); err == nil {
+		t.Error("expected error for claim with reserved device")
+	}
+
+	resources := resourceslice.DriverResources{Pools: map[string]resourceslice.Pool{
+		"node1": {Slices: []resourceslice.Slice{{Devices: []resourcev1.Device{{Name: "card0"}, {Name: "card2"}}}}},
+	}}
+	devices := reservations.Apply(resources).Pools["node1"].Slices[0].Devices
+	if reserved := devices[0].Attributes[ReservedAttribute].BoolValue; reserved == nil || !*reserved || len(devices[0].Taints) != 1 {
+		t.Errorf("expected reserved device to have attribute and taint, got %+v", devices[0])
+	}
+	if len(devices[1].Attributes) != 0 || len(devices[1].Taints) != 0 {
+		t.Errorf("expected device without reservation to be unchanged, got %+v", devices[1])
+	}
+
+	if reservations.Update(nil) != true || len(reservations.Devices()) != 0 {
+		t.Error("expected reservations to be cleared")
+	}
+
+	reservations.Pin("card3")
+	if !reservations.Reserved("card3") || reservations.Update(nil) || !reflect.DeepEqual(reservations.Devices(), []string{"card3"}) {
+		t.Error("expected pinned device to stay reserved without annotation")
+	}
+
+	var noReservations *Reservations
+	if noReservations.Reserved("card0") || noReservations.CheckClaim(claim) != nil {
+		t.Error("expected nil reservations to reserve nothing")
+	}
+}
+
+func TestReservationsParents(t *testing.T) {
+	reservations := NewReservations("qat.intel.com")
+	reservations.SetParents(map[string]string{"qatvf-0000-aa-00-1": "qatpf-0000-aa-00-0", "qatvf-0000-aa-00-2": "qatpf-0000-aa-00-0"})
+	reservations.Update(map[string]string{"qat.intel.com/reserved-devices": "qatvf-0000-aa-00-1"})
+
+	claim := &resourcev1.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{UID: "uid1"},
+		Status: resourcev1.ResourceClaimStatus{Allocation: &resourcev1.AllocationResult{
+			Devices: resourcev1.DeviceAllocationResult{Results: []resourcev1.DeviceRequestAllocationResult{
+				{Driver: "qat.intel.com", Device: "qatpf-0000-aa-00-0"},
+			}},
+		}},
+	}
+	if err := reservations.CheckClaim(claim); err == nil {
+		t.Error("expected error for claim with PF of reserved VF")
+	}
+	if reservations.Reserved("qatvf-0000-aa-00-2") {
+		t.Error("expected VF next to reserved VF not to be reserved")
+	}
+
+	reservations.Update(map[string]string{"qat.intel.com/reserved-devices": "qatpf-0000-aa-00-0"})
+	if !reservations.Reserved("qatvf-0000-aa-00-2") {
+		t.Error("expected VF of reserved PF to be reserved")
+	}
+}
+
+func TestReservationsSplitTaintedSlices(t *testing.T) {
+	reservations := NewReservations("qat.intel.com")
+	reservations.Update(map[string]string{"qat.intel.com/reserved-devices": "qatvf-100"})
+
+	devices := []resourcev1.Device{}
+	for i := range resourcev1.ResourceSliceMaxDevices {
+		devices = append(devices, resourcev1.Device{Name: fmt.Sprintf("qatvf-%d", i)})
+	}
+	resources := resourceslice.DriverResources{Pools: map[string]resourceslice.Pool{
+		"node1": {Slices: []resourceslice.Slice{{Devices: devices}}},
+		"node2": {Slices: []resourceslice.Slice{{Devices: devices[:resourcev1.ResourceSliceMaxDevicesWithTaintsOrConsumesCounters+1]}}},
+	}}
+
+	resources = reservations.Apply(resources)
+	resourceSlices := resources.Pools["node1"].Slices
+	if len(resourceSlices) != 2 {
+		t.Fatalf("expected slices with reserved device split in 2, got %v", len(resourceSlices))
+	}
+	for _, slice := range resourceSlices {
+		if len(slice.Devices) > resourcev1.ResourceSliceMaxDevicesWithTaintsOrConsumesCounters {
+			t.Errorf("expected at most %v devices in slice with taints, got %v",
+				resourcev1.ResourceSliceMaxDevicesWithTaintsOrConsumesCounters, len(slice.Devices))
+		}
+	}
+	if len(resourceSlices[1].Devices[100-resourcev1.ResourceSliceMaxDevicesWithTaintsOrConsumesCounters].Taints) != 1 {
+		t.Error("expected reserved device to be tainted after split")
+	}
+	if len(resources.Pools["node2"].Slices) != 1 {
+		t.Error("expected slice without reserved devices not to be split")
+	}
+}
+
+func TestReservationsMaintenance(t *testing.T) {
+	reservations := NewReservations("gaudi.intel.com")
+	if reservations.MaintenanceAnnotation() != "gaudi.intel.com/maintenance" {
+		t.Errorf("unexpected annotation %v", reservations.MaintenanceAnnotation())
+	}
+
+	if reservations.Update(map[string]string{"gaudi.intel.com/maintenance": "invalid"}) || reservations.Maintenance() {
+		t.Error("expected invalid maintenance annotation to be ignored")
+	}
+	if !reservations.Update(map[string]string{"gaudi.intel.com/maintenance": "true"}) || !reservations.Maintenance() {
+		t.Error("expected maintenance mode to be enabled")
+	}
+
+	resources := resourceslice.DriverResources{Pools: map[string]resourceslice.Pool{
+		"node1": {Slices: []resourceslice.Slice{{Devices: []resourcev1.Device{{Name: "gaudi0"}}}}},
+	}}
+	if devices := reservations.Apply(resources).Pools["node1"].Slices[0].Devices; len(devices) != 0 {
+		t.Errorf("expected no devices published in maintenance mode, got %v", devices)
+	}
+
+	claim := &resourcev1.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{UID: "uid1"},
+		Status: resourcev1.ResourceClaimStatus{Allocation: &resourcev1.AllocationResult{
+			Devices: resourcev1.DeviceAllocationResult{Results: []resourcev1.DeviceRequestAllocationResult{
+				{Driver: "gaudi.intel.com", Device: "gaudi0"},
+			}},
+		}},
+	}
+	if err := reservations.CheckClaim(claim); err == nil {
+		t.Error("expected error preparing claim in maintenance mode")
+	}
+
+	if !reservations.Update(map[string]string{"gaudi.intel.com/maintenance": "false"}) || reservations.Maintenance() {
+		t.Error("expected maintenance mode to be disabled")
+	}
+	if err := reservations.CheckClaim(claim); err != nil {
+		t.Errorf("unexpected error after maintenance mode: %v", err)
+	}
+}
+
+func TestReservationsWatch(t *testing.T) {
+	client := kubefake.NewClientset()
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:        "node1",
+		Annotations: map[string]string{"qat.intel.com/reserved-devices": "qatvf-0000-aa-00-1"},
+	}}
+	if _, err := client.CoreV1().Nodes().Create(context.TODO(), node, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	reservations := NewReservations("qat.intel.com")
+	if err := reservations.Load(context.TODO(), client, "node1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reservations.Reserved("qatvf-0000-aa-00-1") {
+		t.Error("expected device to be reserved after load")
+	}
+	if err := reservations.Load(context.TODO(), client, "node2"); err == nil {
+		t.Error("expected error loading reservations of missing node")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 10)
+	go reservations.Watch(ctx, client, "node1", func() { changed <- struct{}{} })
+
+	deadline := time.After(5 * time.Second)
+	for !reservations.Reserved("qatvf-0000-aa-00-2") {
+		node.Annotations["qat.intel.com/reserved-devices"] = "qatvf-0000-aa-00-2"
+		if _, err := client.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("could not update node: %v", err)
+		}
+		select {
+		case <-changed:
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("reservations were not updated from node annotation")
+		}
+	}
+	if reservations.Reserved("qatvf-0000-aa-00-1") {
+		t.Error("expected device to be released")
+	}
+}
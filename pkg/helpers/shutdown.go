@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// DefaultShutdownTimeout is how long the driver cleanup may take on shutdown
+// by default, safely under the default termination grace period of 30s.
+const DefaultShutdownTimeout = 20 * time.Second
+
+// shutdownContext returns the context passed to Driver.Shutdown, which
+// expires after the shutdown timeout, 0 meaning no timeout. The context is
+// not canceled together with the parent, which may already be done.
+func shutdownContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := context.WithoutCancel(parent)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Drain runs the cleanup of the driver shutdown until it finishes or the
+// context is done. A cleanup blocked e.g. on a hung sysfs write is abandoned
+// with a warning, so that the process can exit before the kubelet kills it.
+func Drain(ctx context.Context, cleanup func()) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cleanup()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		klog.Warningf("Abandoning driver cleanup on shutdown: %v", ctx.Err())
+		return fmt.Errorf("driver cleanup did not finish: %v", ctx.Err())
+	}
+}
+
+// Shutdown shuts the driver down gracefully, with StartPlugin returning the
+// error. No-op when the driver was not started with StartPlugin.
+func (c *Config) Shutdown(err error) {
+	if c.shutdown != nil {
+		c.shutdown(err)
+	}
+}
+
+// ShutdownOnFatalError returns the function shutting the driver down
+// gracefully on unrecoverable errors, with StartPlugin returning the error.
+// Nil unless enabled with --exit-on-fatal-error.
+func (c *Config) ShutdownOnFatalError() func(err error) {
+	if c.shutdown == nil || !c.CommonFlags.ExitOnFatalError {
+		return nil
+	}
+
+	return c.shutdown
+}
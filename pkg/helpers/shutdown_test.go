@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	cleanedUp := false
+	if err := Drain(context.Background(), func() { cleanedUp = true }); err != nil || !cleanedUp {
+		t.Errorf("expected cleanup to finish, got error %v, cleaned up %v", err, cleanedUp)
+	}
+
+	ctx, cancel := shutdownContext(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	hung := make(chan struct{})
+	defer close(hung)
+	if err := Drain(ctx, func() { <-hung }); err == nil {
+		t.Error("expected hung cleanup to be abandoned")
+	}
+}
+
+func TestShutdownContext(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	cancelParent()
+
+	ctx, cancel := shutdownContext(parent, 0)
+	defer cancel()
+	if ctx.Err() != nil {
+		t.Errorf("expected shutdown context to outlive its parent, got %v", ctx.Err())
+	}
+	if _, found := ctx.Deadline(); found {
+		t.Error("expected no deadline with 0 timeout")
+	}
+
+	ctx, cancel = shutdownContext(parent, time.Minute)
+	defer cancel()
+	if _, found := ctx.Deadline(); !found {
+		t.Error("expected deadline with shutdown timeout")
+	}
+}
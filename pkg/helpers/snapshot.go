@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+const StatePath = "/state"
+
+// SnapshotGetter is implemented by drivers that can report a snapshot of
+// their node state, which is then served on the metrics port.
+type SnapshotGetter interface {
+	Snapshot() NodeStateSnapshot
+}
+
+// WriteSnapshot writes the node state snapshot as JSON.
+func WriteSnapshot(out io.Writer, snapshot NodeStateSnapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal node state: %v", err)
+	}
+
+	if _, err := out.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("could not write node state: %v", err)
+	}
+
+	return nil
+}
+
+// snapshotHandler serves the node state snapshot reported by the getter.
+func snapshotHandler(getter SnapshotGetter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := WriteSnapshot(w, getter.Snapshot()); err != nil {
+			klog.Errorf("could not serve node state: %v", err)
+		}
+	})
+}
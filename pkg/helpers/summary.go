@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+)
+
+// Health of devices in the startup summary for drivers that only know
+// whether a device is healthy or not.
+const (
+	SummaryHealthy   = "Healthy"
+	SummaryUnhealthy = "Unhealthy"
+)
+
+// SummaryDevice is a device counted in the startup summary. Empty fields are
+// not counted.
+type SummaryDevice struct {
+	Type   string
+	Model  string
+	Health string
+}
+
+// StartupSummary describes the state of the driver after startup, logged as
+// a single structured line as a per-node health check of the deployment.
+type StartupSummary struct {
+	NodeName       string
+	Devices        []SummaryDevice
+	CDIDevices     int
+	PreparedClaims int
+	Capabilities   Capabilities
+	// Driver specific details as alternating keys and values.
+	Details []any
+}
+
+// SummaryHealth returns the summary health of a device.
+func SummaryHealth(healthy bool) string {
+	if healthy {
+		return SummaryHealthy
+	}
+
+	return SummaryUnhealthy
+}
+
+// KeysAndValues returns the summary as structured logging key-value pairs,
+// with devices counted by type, model and health, and enabled features sorted.
+func (s StartupSummary) KeysAndValues() []any {
+	devicesByType := map[string]int{}
+	devicesByModel := map[string]int{}
+	devicesByHealth := map[string]int{}
+	for _, summaryDevice := range s.Devices {
+		if summaryDevice.Type != "" {
+			devicesByType[summaryDevice.Type]++
+		}
+		if summaryDevice.Model != "" {
+			devicesByModel[summaryDevice.Model]++
+		}
+		if summaryDevice.Health != "" {
+			devicesByHealth[summaryDevice.Health]++
+		}
+	}
+
+	enabledFeatures := []string{}
+	for feature, enabled := range s.Capabilities.Features {
+		if enabled {
+			enabledFeatures = append(enabledFeatures, feature)
+		}
+	}
+	sort.Strings(enabledFeatures)
+
+	keysAndValues := []any{
+		"driver", s.Capabilities.Driver,
+		"version", s.Capabilities.Version,
+		"node", s.NodeName,
+		"devices", len(s.Devices),
+		"devicesByType", devicesByType,
+		"devicesByModel", devicesByModel,
+		"devicesByHealth", devicesByHealth,
+		"cdiDevices", s.CDIDevices,
+		"preparedClaims", s.PreparedClaims,
+		"enabledFeatures", enabledFeatures,
+	}
+
+	return append(keysAndValues, s.Details...)
+}
+
+// LogStartupSummary logs the startup summary as a single structured line.
+func LogStartupSummary(summary StartupSummary) {
+	klog.InfoS("Driver started", summary.KeysAndValues()...)
+}
+
+// CountCDIDevices returns the number of CDI devices of given kind
+// (vendor/class) in the CDI cache.
+func CountCDIDevices(cdiCache *cdiapi.Cache, cdiKind string) int {
+	count := 0
+	for _, cdiDevice := range cdiCache.ListDevices() {
+		if strings.HasPrefix(cdiDevice, cdiKind+"=") {
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+)
+
+func TestStartupSummaryKeysAndValues(t *testing.T) {
+	summary := StartupSummary{
+		NodeName: "node1",
+		Devices: []SummaryDevice{
+			{Type: "gpu", Model: "Flex 170", Health: "Healthy"},
+			{Type: "gpu", Model: "Flex 170", Health: "Unhealthy"},
+			{Type: "vf", Health: "Healthy"},
+		},
+		CDIDevices:     4,
+		PreparedClaims: 1,
+		Capabilities:   Capabilities{Driver: "gpu.intel.com", Version: "v1", Features: map[string]bool{"sriov": true, FeatureAuditLog: false, FeatureHealthMonitoring: true}},
+		Details:        []any{"xpumdAvailable", false},
+	}
+
+	expected := []any{
+		"driver", "gpu.intel.com",
+		"version", "v1",
+		"node", "node1",
+		"devices", 3,
+		"devicesByType", map[string]int{"gpu": 2, "vf": 1},
+		"devicesByModel", map[string]int{"Flex 170": 2},
+		"devicesByHealth", map[string]int{"Healthy": 2, "Unhealthy": 1},
+		"cdiDevices", 4,
+		"preparedClaims", 1,
+		"enabledFeatures", []string{FeatureHealthMonitoring, "sriov"},
+		"xpumdAvailable", false,
+	}
+	if keysAndValues := summary.KeysAndValues(); !reflect.DeepEqual(keysAndValues, expected) {
+		t.Errorf("expected %v, got %v", expected, keysAndValues)
+	}
+}
+
+func TestCountCDIDevices(t *testing.T) {
+	cdiRoot := t.TempDir()
+	for fileName, content := range map[string]string{
+		"intel.com-test.yaml":  staleTestSpec,
+		"intel.com-other.yaml": otherKindTestSpec,
+	} {
+		if err := os.WriteFile(path.Join(cdiRoot, fileName), []byte(content), 0600); err != nil {
+			t.Fatalf("setup error: %v", err)
+		}
+	}
+
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(cdiRoot), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("could not create CDI cache: %v", err)
+	}
+
+	if count := CountCDIDevices(cdiCache, "intel.com/test"); count != 2 {
+		t.Errorf("expected 2 CDI devices, got %v", count)
+	}
+}
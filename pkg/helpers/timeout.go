@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const DefaultDiscoveryTimeout = 10 * time.Second
+
+// DiscoveryContext returns a context canceled after the timeout, the maximum
+// time discovery of a single device may take. 0 or negative value disables
+// the timeout.
+func DiscoveryContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// DiscoverWithTimeout runs discover for a single device within the device
+// discovery timeout, so that a hung sysfs read does not block discovery of
+// other devices. Blocking reads cannot be interrupted, so on timeout discover
+// keeps running in the background and its result is discarded.
+func DiscoverWithTimeout[T any](ctx context.Context, timeout time.Duration, deviceName string, discover func() (T, error)) (T, error) {
+	ctx, cancel := DiscoveryContext(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		value T
+		err   error
+	}
+	// Buffered, so that abandoned discover does not leak blocked on send.
+	done := make(chan result, 1)
+	go func() {
+		value, err := discover()
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		var empty T
+		return empty, fmt.Errorf("discovery of device %v did not complete: %v", deviceName, ctx.Err())
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDiscoverWithTimeout(t *testing.T) {
+	timeout := 50 * time.Millisecond
+
+	value, err := DiscoverWithTimeout(context.Background(), timeout, "dev1", func() (string, error) { return "ok", nil })
+	if err != nil || value != "ok" {
+		t.Errorf("expected ok, got %v, error: %v", value, err)
+	}
+
+	_, err = DiscoverWithTimeout(context.Background(), timeout, "dev2", func() (string, error) { return "", fmt.Errorf("read error") })
+	if err == nil || err.Error() != "read error" {
+		t.Errorf("expected discovery error, got %v", err)
+	}
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	start := time.Now()
+	_, err = DiscoverWithTimeout(context.Background(), timeout, "dev3", func() (string, error) {
+		<-unblock
+		return "late", nil
+	})
+	if err == nil {
+		t.Error("expected timeout error for hung device")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("discovery of hung device blocked for %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := DiscoverWithTimeout(ctx, 0, "dev4", func() (string, error) {
+		<-unblock
+		return "late", nil
+	}); err == nil {
+		t.Error("expected error for canceled context")
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	TopologyPath = "/topology"
+
+	// NUMANodeUnknown is reported for devices without NUMA affinity, same as
+	// the kernel does in the numa_node sysfs file.
+	NUMANodeUnknown = -1
+
+	numaNodeFile = "numa_node"
+)
+
+// TopologyDevice describes where a device is located on the node. Fields not
+// applicable to the driver are left empty.
+type TopologyDevice struct {
+	UID        string `json:"uid"`
+	PCIAddress string `json:"pciAddress,omitempty"`
+	PCIRoot    string `json:"pciRoot,omitempty"`
+	NUMANode   int    `json:"numaNode"`
+	// UID of the PF device for SR-IOV VF devices.
+	ParentUID string `json:"parentUID,omitempty"`
+	// PCI address of the board the GPU device is on, shared by GPUs on the same board.
+	BoardID string `json:"boardId,omitempty"`
+	// OAM module index of Gaudi devices.
+	Module *uint64 `json:"module,omitempty"`
+	// Configured services of QAT devices.
+	Services string `json:"services,omitempty"`
+}
+
+// Topology is a machine-readable map of the devices of a driver on the node.
+type Topology struct {
+	NodeName string           `json:"nodeName"`
+	Devices  []TopologyDevice `json:"devices"`
+}
+
+// TopologyGetter is implemented by drivers that can report the device
+// topology, which is then served on the metrics port.
+type TopologyGetter interface {
+	Topology() Topology
+}
+
+// NewTopology assembles the topology and sorts devices by UID for stable output.
+func NewTopology(nodeName string, devices []TopologyDevice) Topology {
+	sort.Slice(devices, func(i, j int) bool { return devices[i].UID < devices[j].UID })
+
+	return Topology{
+		NodeName: nodeName,
+		Devices:  devices,
+	}
+}
+
+// ReadNUMANode returns the NUMA node of the PCI device in the given sysfs
+// device directory, or NUMANodeUnknown if it cannot be determined.
+func ReadNUMANode(sysfsDeviceDir string) int {
+	numaNodeBytes, err := os.ReadFile(path.Join(sysfsDeviceDir, numaNodeFile))
+	if err != nil {
+		klog.V(5).Infof("could not read NUMA node of %v: %v", sysfsDeviceDir, err)
+		return NUMANodeUnknown
+	}
+
+	numaNode, err := strconv.Atoi(strings.TrimSpace(string(numaNodeBytes)))
+	if err != nil || numaNode < 0 {
+		return NUMANodeUnknown
+	}
+
+	return numaNode
+}
+
+// WriteTopology writes the topology as JSON.
+func WriteTopology(out io.Writer, topology Topology) error {
+	data, err := json.MarshalIndent(topology, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal topology: %v", err)
+	}
+
+	if _, err := out.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("could not write topology: %v", err)
+	}
+
+	return nil
+}
+
+// topologyHandler serves the topology reported by the getter.
+func topologyHandler(getter TopologyGetter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := WriteTopology(w, getter.Topology()); err != nil {
+			klog.Errorf("could not serve topology: %v", err)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2026, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestReadNUMANode(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected int
+	}{
+		{name: "NUMA node 1", content: "1\n", expected: 1},
+		{name: "no NUMA affinity", content: "-1\n", expected: NUMANodeUnknown},
+		{name: "garbage", content: "abc", expected: NUMANodeUnknown},
+		{name: "missing file", expected: NUMANodeUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deviceDir := t.TempDir()
+			if tt.content != "" {
+				if err := os.WriteFile(path.Join(deviceDir, numaNodeFile), []byte(tt.content), 0600); err != nil {
+					t.Fatalf("setup error: %v", err)
+				}
+			}
+			if numaNode := ReadNUMANode(deviceDir); numaNode != tt.expected {
+				t.Errorf("expected NUMA node %v, got %v", tt.expected, numaNode)
+			}
+		})
+	}
+}
+
+func TestWriteTopology(t *testing.T) {
+	module := uint64(3)
+	topology := NewTopology("node1", []TopologyDevice{
+		{UID: "b", PCIRoot: "pci0000:01", NUMANode: 1, Module: &module},
+		{UID: "a", PCIAddress: "0000:00:02.0", NUMANode: NUMANodeUnknown, ParentUID: "pf"},
+	})
+	if topology.Devices[0].UID != "a" {
+		t.Errorf("expected devices sorted by UID, got %+v", topology.Devices)
+	}
+
+	out := &bytes.Buffer{}
+	if err := WriteTopology(out, topology); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{`"nodeName": "node1"`, `"module": 3`, `"numaNode": -1`, `"parentUID": "pf"`} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "services") {
+		t.Errorf("expected empty fields to be omitted, got:\n%s", out.String())
+	}
+}
@@ -23,6 +23,7 @@ import (
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 	cdiSpecs "tags.cncf.io/container-device-interface/specs-go"
 
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
 )
 
@@ -37,18 +38,18 @@ func getQatSpecs(cdiCache *cdiapi.Cache) []*cdiapi.Spec {
 }
 
 // AddDetectedDevicesToCDIRegistry adds detected devices into cdi registry after
-// deleting old specs.
-func AddDetectedDevicesToCDIRegistry(cdiCache *cdiapi.Cache, vfDevices device.VFDevices) error {
+// deleting old specs. The permissions are set on the VF device nodes.
+func AddDetectedDevicesToCDIRegistry(cdiCache *cdiapi.Cache, vfDevices device.VFDevices, permissions helpers.DeviceNodePermissions) error {
 	qatSpecs := getQatSpecs(cdiCache)
 	// delete all existing QAT specs.
 	for _, spec := range qatSpecs {
 		if err := cdiCache.RemoveSpec(spec.GetPath()); err != nil {
-			return fmt.Errorf("failed to remove old CDI spec %v: %v", spec, err)
+			return helpers.NewCDIError(helpers.CDISpecRemoveFailed, spec.GetPath(), err)
 		}
 	}
 
-	if err := addDevicesToNewSpec(cdiCache, vfDevices); err != nil {
-		return fmt.Errorf("failed adding devices to new CDI spec: %v", err)
+	if err := addDevicesToNewSpec(cdiCache, vfDevices, permissions); err != nil {
+		return fmt.Errorf("failed adding devices to new CDI spec: %w", err)
 	}
 
 	return nil
@@ -56,7 +57,7 @@ func AddDetectedDevicesToCDIRegistry(cdiCache *cdiapi.Cache, vfDevices device.VF
 
 // addDevicesToNewSpec creates new CDI spec, adds devices to it and calls writeSpec.
 // Old specs are expected to be deleted before writing new spec.
-func addDevicesToNewSpec(cdiCache *cdiapi.Cache, devices device.VFDevices) error {
+func addDevicesToNewSpec(cdiCache *cdiapi.Cache, devices device.VFDevices, permissions helpers.DeviceNodePermissions) error {
 	klog.V(5).Infof("Adding %v devices to new spec", len(devices))
 
 	spec := &cdiSpecs.Spec{
@@ -69,25 +70,29 @@ func addDevicesToNewSpec(cdiCache *cdiapi.Cache, devices device.VFDevices) error
 	}
 	klog.V(5).Infof("New name for new CDI spec: %v", specName)
 
-	return addDevicesToSpecAndWrite(cdiCache, devices, spec, specName)
+	return addDevicesToSpecAndWrite(cdiCache, devices, permissions, spec, specName)
 }
 
-func addDevicesToSpecAndWrite(cdiCache *cdiapi.Cache, vfDevices device.VFDevices, spec *cdiSpecs.Spec, specName string) error {
+func addDevicesToSpecAndWrite(cdiCache *cdiapi.Cache, vfDevices device.VFDevices, permissions helpers.DeviceNodePermissions, spec *cdiSpecs.Spec, specName string) error {
 	for _, vf := range vfDevices {
+		deviceNode := &cdiSpecs.DeviceNode{Path: vf.DeviceNode(), Type: "c"}
+		if hostPath := vf.HostDeviceNode(); hostPath != deviceNode.Path {
+			deviceNode.HostPath = hostPath
+		}
+		permissions.Apply(deviceNode)
+
 		// primary / control node (for modesetting)
 		newDevice := cdiSpecs.Device{
 			Name: vf.UID(),
 			ContainerEdits: cdiSpecs.ContainerEdits{
-				DeviceNodes: []*cdiSpecs.DeviceNode{
-					{Path: vf.DeviceNode(), Type: "c"},
-				},
+				DeviceNodes: []*cdiSpecs.DeviceNode{deviceNode},
 			},
 		}
 		spec.Devices = append(spec.Devices, newDevice)
 	}
 
 	if err := writeSpec(cdiCache, spec, specName); err != nil {
-		return fmt.Errorf("failed to save new CDI spec %v: %v", specName, err)
+		return fmt.Errorf("failed to save new CDI spec %v: %w", specName, err)
 	}
 	return nil
 }
@@ -103,7 +108,7 @@ func writeSpec(cdiCache *cdiapi.Cache, spec *cdiSpecs.Spec, specName string) err
 	if len(spec.Devices) == 0 {
 		klog.V(5).Infof("No devices in spec %v, deleting it", specName)
 		if err := cdiCache.RemoveSpec(specName); err != nil {
-			return fmt.Errorf("failed to remove empty CDI spec %v: %v", specName, err)
+			return helpers.NewCDIError(helpers.CDISpecRemoveFailed, specName, err)
 		}
 		return nil
 	}
@@ -111,7 +116,7 @@ func writeSpec(cdiCache *cdiapi.Cache, spec *cdiSpecs.Spec, specName string) err
 	klog.V(5).Infof("Writing spec %v", specName)
 	err = cdiCache.WriteSpec(spec, specName)
 	if err != nil {
-		return fmt.Errorf("failed to write CDI spec %v: %v", specName, err)
+		return helpers.NewCDIError(helpers.CDISpecWriteFailed, specName, err)
 	}
 
 	return nil
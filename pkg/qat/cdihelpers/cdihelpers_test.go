@@ -17,6 +17,9 @@
 package cdihelpers
 
 import (
+	"context"
+	"os"
+	"path"
 	"sort"
 	"testing"
 
@@ -24,6 +27,7 @@ import (
 	cdiSpecs "tags.cncf.io/container-device-interface/specs-go"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 	testhelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
 )
@@ -124,7 +128,7 @@ func TestSyncDetectedDevicesWithRegistry(t *testing.T) {
 				t.Errorf("setup error: could not create fake sysfs: %v", err)
 			}
 
-			devs, err := device.New()
+			devs, err := device.New(context.TODO(), helpers.DefaultDiscoveryTimeout)
 			if err != nil {
 				t.Fatalf("New error: %v", err)
 			}
@@ -133,7 +137,7 @@ func TestSyncDetectedDevicesWithRegistry(t *testing.T) {
 
 			t.Logf("existing specs: %v", cdiCache.GetVendorSpecs(device.CDIVendor))
 
-			if err := AddDetectedDevicesToCDIRegistry(cdiCache, vfDevices); (err != nil) != tt.expectedError {
+			if err := AddDetectedDevicesToCDIRegistry(cdiCache, vfDevices, helpers.DeviceNodePermissions{}); (err != nil) != tt.expectedError {
 				t.Errorf("SyncDetectedDevicesWithRegistry() error = %v, expectedError %v", err, tt.expectedError)
 			}
 
@@ -160,3 +164,98 @@ func TestSyncDetectedDevicesWithRegistry(t *testing.T) {
 		})
 	}
 }
+
+func TestAddDetectedDevicesDeviceNodePermissions(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer testhelpers.CleanupTest(t, "TestAddDetectedDevicesDeviceNodePermissions", testDirs.TestRoot)
+
+	t.Setenv("SYSFS_ROOT", testDirs.SysfsRoot)
+	defer device.ClearSysfsRoot()
+
+	if err := fakesysfs.FakeSysFsQATContents(testDirs.SysfsRoot, fakesysfs.QATDevices{
+		{Device: "0000:4b:00.0", State: "up", NumVFs: 1, TotalVFs: 1},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	devs, err := device.New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(testDirs.CdiRoot), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("failed to create CDI cache: %v", err)
+	}
+
+	permissions, err := helpers.NewDeviceNodePermissions("0660", -1, 1000)
+	if err != nil {
+		t.Fatalf("could not parse permissions: %v", err)
+	}
+	if err := AddDetectedDevicesToCDIRegistry(cdiCache, device.GetCDIDevices(devs), permissions); err != nil {
+		t.Fatalf("could not add devices to CDI registry: %v", err)
+	}
+	if err := cdiCache.Refresh(); err != nil {
+		t.Fatalf("could not refresh CDI cache: %v", err)
+	}
+
+	cdiDevice := cdiCache.GetDevice(device.CDIKind + "=qatvf-0000-4b-00-1")
+	if cdiDevice == nil {
+		t.Fatalf("CDI device not found")
+	}
+	deviceNode := cdiDevice.ContainerEdits.DeviceNodes[0]
+	if deviceNode.FileMode == nil || *deviceNode.FileMode != os.FileMode(0660) {
+		t.Errorf("expected device node mode 0660, got %v", deviceNode.FileMode)
+	}
+	if deviceNode.UID != nil {
+		t.Errorf("expected default device node UID, got %v", *deviceNode.UID)
+	}
+	if deviceNode.GID == nil || *deviceNode.GID != 1000 {
+		t.Errorf("expected device node GID 1000, got %v", deviceNode.GID)
+	}
+}
+
+func TestAddControlNodeCustomDevfsRoot(t *testing.T) {
+	testDirs, err := testhelpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer testhelpers.CleanupTest(t, "TestAddControlNodeCustomDevfsRoot", testDirs.TestRoot)
+
+	hostControlNode := path.Join(testDirs.DevfsRoot, device.DevfsVfioPath, "vfio")
+	if err := os.MkdirAll(path.Dir(hostControlNode), 0750); err != nil {
+		t.Fatalf("setup error: could not create fake devfs: %v", err)
+	}
+	if err := os.WriteFile(hostControlNode, nil, 0600); err != nil {
+		t.Fatalf("setup error: could not create fake control node: %v", err)
+	}
+	t.Setenv(helpers.DevfsEnvVarName, testDirs.DevfsRoot)
+
+	ctrl, err := device.GetControlNode()
+	if err != nil {
+		t.Fatalf("GetControlNode error: %v", err)
+	}
+
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(testDirs.CdiRoot), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("failed to create CDI cache: %v", err)
+	}
+	if err := AddDetectedDevicesToCDIRegistry(cdiCache, device.VFDevices{ctrl.UID(): ctrl}, helpers.DeviceNodePermissions{}); err != nil {
+		t.Fatalf("could not add control node to CDI registry: %v", err)
+	}
+	if err := cdiCache.Refresh(); err != nil {
+		t.Fatalf("could not refresh CDI cache: %v", err)
+	}
+
+	cdiDevice := cdiCache.GetDevice(device.CDIKind + "=" + ctrl.UID())
+	if cdiDevice == nil {
+		t.Fatalf("CDI device not found")
+	}
+	deviceNode := cdiDevice.ContainerEdits.DeviceNodes[0]
+	if deviceNode.Path != "/dev/vfio/vfio" || deviceNode.HostPath != hostControlNode {
+		t.Errorf("expected control node '/dev/vfio/vfio' from host path '%s', got '%s' from '%s'", hostControlNode, deviceNode.Path, deviceNode.HostPath)
+	}
+}
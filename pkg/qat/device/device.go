@@ -5,13 +5,20 @@
 package device
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
 
 const (
@@ -24,6 +31,8 @@ const (
 	DriverName = CDIClass + "." + CDIVendor
 
 	PreparedClaimsFileName = "preparedClaims.json"
+	// Lists PF devices this driver enabled the VFs of, kept over driver restarts.
+	VFsEnabledByDriverFileName = "vfsEnabledByDriver.json"
 
 	moduleName       = "4xxx"
 	vfioPCI          = "vfio-pci"
@@ -32,22 +41,48 @@ const (
 	pciDevicePattern = "????:??:??.?"
 	qatState         = "qat/state"
 	qatServices      = "qat/cfg_services"
+	pciDeviceID      = "device"
+	qatErrorsFatal   = "qat_ras/errors_fatal"
 	driverOverride   = "driver_override"
 	numVFs           = "sriov_numvfs"
 	totalVFs         = "sriov_totalvfs"
+	vfTotalMSIX      = "sriov_vf_total_msix"
 	vfDevicePattern  = "virtfn*"
 	vfDriver         = "driver"
 	vfIOMMU          = "iommu_group"
 	vfDeviceNode     = "/dev/vfio"
+
+	// DevfsVfioPath is the VFIO device node directory relative to devfs root.
+	DevfsVfioPath = "vfio"
+
+	// MSI-X vectors used by a single VF.
+	msixVectorsPerVF = 1
 )
 
-var sysfsRoot string = ""
+var (
+	sysfsRoot      string = ""
+	sysfsRootMutex sync.Mutex
+)
+
+// writeSysfsFile writes the PF device configuration to sysfs, replaceable in
+// tests to simulate failures of the kernel driver.
+var writeSysfsFile = func(filePath string, value string) error {
+	return os.WriteFile(filePath, []byte(value), 0600)
+}
 
 func ClearSysfsRoot() {
+	sysfsRootMutex.Lock()
+	defer sysfsRootMutex.Unlock()
+
 	sysfsRoot = ""
 }
 
+// getSysfsRoot returns the sysfs root, SYSFS_ROOT environment variable or
+// /sys/. Safe to call from the goroutines watching devices.
 func getSysfsRoot() string {
+	sysfsRootMutex.Lock()
+	defer sysfsRootMutex.Unlock()
+
 	if sysfsRoot != "" {
 		return sysfsRoot
 	}
@@ -114,14 +149,48 @@ func (s *Services) String() string {
 	return str
 }
 
+// serviceImplications lists services implicitly provided by a configured
+// service. Compression chaining runs the compression service as well, so VFs
+// of a PF configured with dcc can serve dc requests.
+var serviceImplications = map[Services]Services{
+	Dcc: Dc,
+}
+
+// Supports returns true if the configured services, including the services
+// they imply, provide all of the given services.
 func (s *Services) Supports(service Services) bool {
-	return *s&service == service
+	capabilities := *s
+	for configured, implied := range serviceImplications {
+		if capabilities&configured != 0 {
+			capabilities |= implied
+		}
+	}
+
+	return capabilities&service == service
 }
 
 func StringToServices(servicestr string) (Services, error) {
+	service, unknown := ParseServices(servicestr)
+	if len(unknown) > 0 {
+		return Unset, fmt.Errorf("unknown service '%s'", servicestr)
+	}
+
+	return service, nil
+}
+
+// serviceSeparators replaces the service separators used by different
+// driver versions and configuration files with the canonical ';'.
+var serviceSeparators = strings.NewReplacer("+", ";", ",", ";")
+
+// ParseServices returns the known services of the services string, and the
+// unknown ones separately, e.g. services added by a newer firmware. Services
+// may be separated with ';', '+' or ',', and surrounded by whitespace.
+func ParseServices(servicestr string) (Services, []string) {
 	var service Services = Unset
+	unknown := []string{}
 
-	for _, str := range strings.Split(servicestr, ";") {
+	for _, str := range strings.Split(serviceSeparators.Replace(servicestr), ";") {
+		str = strings.TrimSpace(str)
 		exists := false
 
 		for i, strtoservice := range servicetostring {
@@ -131,8 +200,8 @@ func StringToServices(servicestr string) (Services, error) {
 				break
 			}
 		}
-		if !exists {
-			return Unset, fmt.Errorf("unknown service '%s'", servicestr)
+		if !exists && !slices.Contains(unknown, str) {
+			unknown = append(unknown, str)
 		}
 	}
 
@@ -140,11 +209,38 @@ func StringToServices(servicestr string) (Services, error) {
 		service &= ^None
 	}
 
-	return service, nil
+	return service, unknown
 }
 
 type QATDevices []*PFDevice
 
+// FindVFByUID returns the VF device with given UID, allocated or not, or nil
+// if none of the PF devices has it.
+func (q QATDevices) FindVFByUID(uid string) *VFDevice {
+	for _, pf := range q {
+		if vf, found := pf.AvailableDevices[uid]; found {
+			return vf
+		}
+		for _, allocated := range pf.AllocatedDevices {
+			if vf, found := allocated[uid]; found {
+				return vf
+			}
+		}
+	}
+
+	return nil
+}
+
+// FindPFByVFUID returns the PF device of the VF device with given UID, or nil
+// if none of the PF devices has it, e.g. for the VFIO control node.
+func (q QATDevices) FindPFByVFUID(uid string) *PFDevice {
+	if vf := q.FindVFByUID(uid); vf != nil {
+		return vf.PFDevice()
+	}
+
+	return nil
+}
+
 // Available devices mapped by UID (PCI address minus colons and dots).
 type VFDevices map[string]*VFDevice
 
@@ -152,14 +248,53 @@ type VFDevices map[string]*VFDevice
 type AllocatedDevices map[string]VFDevices
 
 type PFDevice struct {
-	AllowReconfiguration bool // enable dynamic service reconfiguration
-	Device               string
-	State                State
-	Services             Services
-	NumVFs               int
-	TotalVFs             int
-	AvailableDevices     VFDevices        // mapped by device uid
-	AllocatedDevices     AllocatedDevices // mapped by claim id
+	AllowReconfiguration    bool                       // enable dynamic service reconfiguration
+	ReconfigurationCooldown time.Duration              // minimum time between service reconfigurations
+	LastReconfiguration     time.Time                  // last successful services change for a claim, zero before the first one
+	ServicesKept            bool                       // services of a freed claim kept during the cooldown
+	DefaultService          Services                   // services to return to when all VFs are freed, Unset for none
+	ReconfigurationHandler  func(ReconfigurationEvent) // called after services are changed for a claim, nil for none
+	Device                  string
+	DeviceID                string // PCI device ID, e.g. 0x4940, empty if unknown
+	State                   State
+	Services                Services
+	UnknownServices         []string  // services reported by sysfs the driver does not know, e.g. added by newer firmware
+	Instances               Instances // service instances per VF, validated only, see Instances
+	NumVFs                  int
+	TotalVFs                int
+	MSIXVFLimit             int              // number of VFs MSI-X vectors suffice for, 0 if not limited
+	VFsEnabledByDriver      bool             // VFs were enabled by this driver, not by the operator
+	StrictVFCount           bool             // fail enabling VFs when fewer VFs are found than enabled
+	ForceReconfiguration    bool             // reconfigure even when VFs are used outside of the driver
+	ReadOnly                bool             // driver lacks the privileges to change VFs and services
+	UpRetries               int              // further attempts to bring the PF device up when it fails
+	UpRetryInterval         time.Duration    // wait before the first retry, doubled for every next one
+	Unhealthy               bool             // fatal error reported or device is being recovered
+	AvailableDevices        VFDevices        // mapped by device uid
+	AllocatedDevices        AllocatedDevices // mapped by claim id
+}
+
+// ReconfigurationEvent describes a change of PF device services for a claim.
+// All VFs of the PF device are disabled and re-enabled during the change.
+type ReconfigurationEvent struct {
+	Device   string // PF device PCI address
+	Before   Services
+	After    Services
+	ClaimUID string // claim the VF was allocated to or freed from
+}
+
+// String returns a human readable description of the reconfiguration.
+func (e ReconfigurationEvent) String() string {
+	return fmt.Sprintf("PF device '%s' services reconfigured from '%s' to '%s' for claim '%s'", e.Device, servicesName(e.Before), servicesName(e.After), e.ClaimUID)
+}
+
+// servicesName returns the services string, or "none" for an unconfigured device.
+func servicesName(services Services) string {
+	if name := services.String(); name != "" {
+		return name
+	}
+
+	return "none"
 }
 
 type VFDriver int
@@ -175,6 +310,16 @@ var stringToDriver = map[string]VFDriver{
 	"vfio-pci": VfioPci,
 }
 
+// driverByName returns the VFDriver for the name of the bound driver, Unknown for
+// other drivers than vfio-pci.
+func driverByName(name string) VFDriver {
+	if driver, found := stringToDriver[name]; found {
+		return driver
+	}
+
+	return Unknown
+}
+
 func (s *VFDriver) String() string {
 	if *s == Unbound {
 		return ""
@@ -192,9 +337,14 @@ type VFDevice struct {
 	VFIommu  string
 }
 
-func New() (QATDevices, error) {
+// New discovers the QAT PF devices and their VFs. Discovery of a single PF
+// device gives up after discoveryTimeout, 0 disables the timeout, or when ctx
+// is done.
+func New(ctx context.Context, discoveryTimeout time.Duration) (QATDevices, error) {
 	pcidevices := make(QATDevices, 0)
 
+	detectIOMMUMode()
+
 	pattern := filepath.Join(sysfsDriverPath(), moduleName, pciDevicePattern)
 	paths, err := filepath.Glob(pattern)
 	if err != nil {
@@ -208,19 +358,12 @@ func New() (QATDevices, error) {
 			continue
 		}
 
-		newdevice := &PFDevice{
-			AllowReconfiguration: false,
-			Device:               filepath.Base(symlinktarget),
-			AvailableDevices:     make(map[string]*VFDevice, 0),
-			AllocatedDevices:     make(map[string]VFDevices, 0),
-		}
-
-		if err = newdevice.syncConfig(); err != nil {
-			klog.Warningf("Could not sync config for '%s': %v", newdevice.Device, err)
-			continue
-		}
-		if err := newdevice.getVFs(); err != nil {
-			klog.Warningf("Could not find VFs for '%s': %v", newdevice.Device, err)
+		pciAddress := filepath.Base(symlinktarget)
+		newdevice, err := helpers.DiscoverWithTimeout(ctx, discoveryTimeout, pciAddress, func() (*PFDevice, error) {
+			return discoverPF(pciAddress)
+		})
+		if err != nil {
+			klog.Warningf("Skipping PF device '%s': %v", pciAddress, err)
 			continue
 		}
 		pcidevices = append(pcidevices, newdevice)
@@ -230,7 +373,34 @@ func New() (QATDevices, error) {
 	return pcidevices, nil
 }
 
+// discoverPF reads configuration and VFs of a single PF device from sysfs.
+func discoverPF(pciAddress string) (*PFDevice, error) {
+	newdevice := &PFDevice{
+		AllowReconfiguration: false,
+		Device:               pciAddress,
+		AvailableDevices:     make(map[string]*VFDevice, 0),
+		AllocatedDevices:     make(map[string]VFDevices, 0),
+	}
+
+	if err := helpers.CheckPCIVendor(filepath.Join(sysfsDevicePath(), pciAddress), helpers.IntelPCIVendorID); err != nil {
+		return nil, err
+	}
+
+	if err := newdevice.syncConfig(); err != nil {
+		return nil, fmt.Errorf("could not sync config: %v", err)
+	}
+	if err := newdevice.getVFs(); err != nil {
+		return nil, fmt.Errorf("could not find VFs: %v", err)
+	}
+
+	return newdevice, nil
+}
+
 func GetControlNode() (*VFDevice, error) {
+	if err := checkVFIOUsable(); err != nil {
+		return nil, fmt.Errorf("no VFIO control node: %v", err)
+	}
+
 	return &VFDevice{
 		VFDevice: "vfio",
 		VFDriver: VfioPci,
@@ -277,11 +447,22 @@ func (p *PFDevice) read(file string) (string, error) {
 }
 
 func (p *PFDevice) write(file string, value string) error {
-	err := os.WriteFile(filepath.Join(sysfsDevicePath(), p.Device, file), []byte(value), 0600)
+	err := writeSysfsFile(filepath.Join(sysfsDevicePath(), p.Device, file), value)
 
 	return err
 }
 
+// WrittenPaths returns the sysfs files of the PF device written when enabling
+// VFs and configuring services.
+func (p *PFDevice) WrittenPaths() []string {
+	paths := []string{}
+	for _, file := range []string{numVFs, qatState, qatServices} {
+		paths = append(paths, filepath.Join(sysfsDevicePath(), p.Device, file))
+	}
+
+	return paths
+}
+
 func (p *PFDevice) syncConfig() error {
 	qatstate, err := p.read(qatState)
 	if err != nil {
@@ -292,10 +473,13 @@ func (p *PFDevice) syncConfig() error {
 		return fmt.Errorf("unknown QAT state %s", qatstate)
 	}
 
-	qatservices, err := p.getServices()
+	qatservices, unknownservices, err := p.getServices()
 	if err != nil {
 		return fmt.Errorf("cannot read QAT services: %v", err)
 	}
+	if len(unknownservices) > 0 {
+		klog.Warningf("PF device '%s' has services unknown to the driver: '%s', using known services '%s'", p.Device, strings.Join(unknownservices, ";"), qatservices.String())
+	}
 
 	numvfs, err := p.read(numVFs)
 	if err != nil {
@@ -315,28 +499,57 @@ func (p *PFDevice) syncConfig() error {
 		return fmt.Errorf("cannot read value from %s: %v", totalVFs, err)
 	}
 
+	// Device ID is only needed to validate services configurations.
+	if deviceid, err := p.read(pciDeviceID); err == nil {
+		p.DeviceID = deviceid
+	}
+
 	p.State = state
 	p.Services = qatservices
+	p.UnknownServices = unknownservices
 	p.NumVFs = vfs
 	p.TotalVFs = total
+	p.MSIXVFLimit = p.readMSIXVFLimit()
 
 	return nil
 }
 
-func (p *PFDevice) getServices() (Services, error) {
-	var services Services
-
-	servicestr, err := p.read(qatServices)
+// readMSIXVFLimit returns the number of VFs the MSI-X vectors available for
+// VFs are enough for, or 0 if the kernel does not report the vectors.
+func (p *PFDevice) readMSIXVFLimit() int {
+	totalmsix, err := p.read(vfTotalMSIX)
 	if err != nil {
-		return 0, err
+		return 0
+	}
+	msix, err := strconv.Atoi(totalmsix)
+	if err != nil || msix <= 0 {
+		return 0
 	}
 
-	services, err = StringToServices(servicestr)
+	return msix / msixVectorsPerVF
+}
+
+// vfCountToEnable returns TotalVFs capped by the MSI-X vector limit.
+func (p *PFDevice) vfCountToEnable(total int) int {
+	if p.MSIXVFLimit > 0 && p.MSIXVFLimit < total {
+		klog.Infof("PF device '%s': MSI-X vectors suffice for %d VFs only, enabling %d of %d VFs", p.Device, p.MSIXVFLimit, p.MSIXVFLimit, total)
+		return p.MSIXVFLimit
+	}
+
+	return total
+}
+
+// getServices returns the PF device services from sysfs, with the services
+// the driver does not know separately.
+func (p *PFDevice) getServices() (Services, []string, error) {
+	servicestr, err := p.read(qatServices)
 	if err != nil {
-		return Unset, fmt.Errorf("'%s' is not a supported service", servicestr)
+		return Unset, nil, err
 	}
 
-	return services, nil
+	services, unknown := ParseServices(servicestr)
+
+	return services, unknown, nil
 }
 
 func (p *PFDevice) SetServices(srv []Services) error {
@@ -350,6 +563,10 @@ func (p *PFDevice) SetServices(srv []Services) error {
 		config |= s
 	}
 
+	if err := p.ValidateServices(config); err != nil {
+		return err
+	}
+
 	deviceState := p.State
 
 	if err := p.down(); err != nil {
@@ -369,6 +586,56 @@ func (p *PFDevice) SetServices(srv []Services) error {
 	}
 
 	p.Services = config
+	p.UnknownServices = nil
+	p.resetInvalidInstances()
+	return nil
+}
+
+// VerifyServices re-reads the PF device services from sysfs and returns an
+// error if they do not match the configured services, e.g. when the device
+// silently rejected or partially applied a service change.
+func (p *PFDevice) VerifyServices() error {
+	services, _, err := p.getServices()
+	if err != nil {
+		return fmt.Errorf("cannot read QAT services: %v", err)
+	}
+
+	// Configured services may carry the None bit next to the other services.
+	if services.String() != p.Services.String() {
+		return fmt.Errorf("PF device '%s' has services '%s' instead of configured '%s'", p.Device, services.String(), p.Services.String())
+	}
+
+	return nil
+}
+
+// reconfigure sets the PF device services for the claim, logs the change and
+// passes it to the reconfiguration handler.
+func (p *PFDevice) reconfigure(services Services, claimUID string) error {
+	event := ReconfigurationEvent{
+		Device:   p.Device,
+		Before:   p.Services,
+		After:    services,
+		ClaimUID: claimUID,
+	}
+
+	if err := p.reconfigurationSafe(p.boundVFsInUse()); err != nil {
+		klog.Warningf("PF device '%s' services reconfiguration from '%s' to '%s' for claim '%s' refused: %v", p.Device, servicesName(event.Before), servicesName(services), claimUID, err)
+		return err
+	}
+
+	if err := p.SetServices([]Services{services}); err != nil {
+		klog.Warningf("PF device '%s' services reconfiguration from '%s' to '%s' for claim '%s' failed: %v", p.Device, servicesName(event.Before), servicesName(services), claimUID, err)
+		return err
+	}
+
+	p.LastReconfiguration = time.Now()
+	p.ServicesKept = false
+
+	klog.Info(event.String())
+	if p.ReconfigurationHandler != nil {
+		p.ReconfigurationHandler(event)
+	}
+
 	return nil
 }
 
@@ -426,15 +693,31 @@ func findVFDevice(devices VFDevices, target string) *VFDevice {
 	return nil
 }
 
+// up brings the PF device up, e.g. after its services were changed. Failed
+// attempts are retried UpRetries times with exponential backoff, as the
+// device may transiently refuse to come up.
 func (p *PFDevice) up() error {
 	state := Up
 
-	if p.State != Up {
-		if err := p.write(qatState, state.String()); err != nil {
-			return err
+	if p.State == Up {
+		return nil
+	}
+
+	interval := p.UpRetryInterval
+	for attempt := 0; ; attempt++ {
+		err := p.write(qatState, state.String())
+		if err == nil {
+			break
 		}
-		p.State = Up
+		if attempt >= p.UpRetries {
+			return fmt.Errorf("cannot bring PF device '%s' up after %d attempts: %v", p.Device, attempt+1, err)
+		}
+
+		klog.Warningf("Bringing PF device '%s' up failed (attempt %d of %d), retrying in %v: %v", p.Device, attempt+1, p.UpRetries+1, interval, err)
+		time.Sleep(interval)
+		interval *= 2
 	}
+	p.State = Up
 
 	return nil
 }
@@ -456,6 +739,33 @@ func (p *PFDevice) down() error {
 	return nil
 }
 
+// CheckHealth re-reads the PF state and the RAS fatal error counter. The PF is
+// unhealthy when it is not up, e.g. while the kernel driver is recovering it,
+// or when it has reported fatal errors. Returns true if the health changed.
+func (p *PFDevice) CheckHealth() bool {
+	healthy := true
+
+	qatstate, err := p.read(qatState)
+	if state, exists := stringToState[qatstate]; err != nil || !exists || state != Up {
+		klog.V(5).Infof("PF '%s' is not up (state '%s', err: %v)", p.Device, qatstate, err)
+		healthy = false
+	}
+
+	// RAS counters are not available on all kernels, missing file is not an error.
+	if fatalstr, err := p.read(qatErrorsFatal); err == nil {
+		fatal, err := strconv.Atoi(fatalstr)
+		if err != nil || fatal > 0 {
+			klog.V(5).Infof("PF '%s' reports fatal errors '%s'", p.Device, fatalstr)
+			healthy = false
+		}
+	}
+
+	changed := p.Unhealthy == healthy
+	p.Unhealthy = !healthy
+
+	return changed
+}
+
 func (p *PFDevice) EnableVFs() error {
 	var (
 		totalvfs string
@@ -467,17 +777,51 @@ func (p *PFDevice) EnableVFs() error {
 	if totalvfs, err = p.read(totalVFs); err != nil {
 		return err
 	}
+	total, err := strconv.Atoi(totalvfs)
+	if err != nil {
+		return fmt.Errorf("cannot read value from %s: %v", totalVFs, err)
+	}
 
-	if err = p.write(numVFs, totalvfs); err != nil {
+	enabled, err := p.enabledVFs()
+	if err != nil {
 		return err
 	}
 
+	// VFs can only be enabled when there are none, and existing ones may have
+	// been enabled by the operator for another purpose, so they are kept as is.
+	wanted := p.vfCountToEnable(total)
+	switch {
+	case enabled == 0:
+		if err = p.write(numVFs, strconv.Itoa(wanted)); err != nil {
+			return err
+		}
+		p.NumVFs = wanted
+		p.VFsEnabledByDriver = true
+	case enabled != wanted && !p.VFsEnabledByDriver:
+		klog.Infof("PF device '%s' already has %d VFs enabled, keeping them instead of %d", p.Device, enabled, wanted)
+		p.NumVFs = enabled
+	default:
+		p.NumVFs = enabled
+	}
+
 	_ = p.getVFs()
-	for _, vf := range p.AvailableDevices {
-		if err := vf.enableVFIO(); err != nil {
-			klog.Errorf("Enabling VF '%s': %v", vf.UID(), err)
+	if err := p.verifyVFCount(); err != nil {
+		if p.StrictVFCount {
 			return err
 		}
+		klog.Warning(err)
+	}
+
+	if err := checkVFIOUsable(); err != nil {
+		// Binding would fail, claims get a clear error in Prepare instead.
+		klog.Warningf("PF device '%s': not binding VFs to %s: %v", p.Device, vfioPCI, err)
+	} else {
+		for _, vf := range p.AvailableDevices {
+			if err := vf.enableVFIO(); err != nil {
+				klog.Errorf("Enabling VF '%s': %v", vf.UID(), err)
+				return err
+			}
+		}
 	}
 
 	if err := p.up(); err != nil {
@@ -487,12 +831,262 @@ func (p *PFDevice) EnableVFs() error {
 	return nil
 }
 
+// verifyVFCount returns an error if fewer VFs were found than enabled, e.g.
+// when some of them failed to probe, so the node advertises less capacity.
+func (p *PFDevice) verifyVFCount() error {
+	if found := p.VFCount(); found < p.NumVFs {
+		return fmt.Errorf("PF device '%s' has %d VFs instead of %d enabled", p.Device, found, p.NumVFs)
+	}
+
+	return nil
+}
+
+func (p *PFDevice) enabledVFs() (int, error) {
+	numvfs, err := p.read(numVFs)
+	if err != nil {
+		return 0, err
+	}
+	enabled, err := strconv.Atoi(numvfs)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read value from %s: %v", numVFs, err)
+	}
+
+	return enabled, nil
+}
+
+// DisableVFs disables the VFs of the PF device if this driver enabled them.
+// VFs enabled by the operator are left untouched.
+func (p *PFDevice) DisableVFs() error {
+	if !p.VFsEnabledByDriver {
+		return nil
+	}
+
+	if len(p.AllocatedDevices) > 0 {
+		return fmt.Errorf("cannot disable VFs of QAT device '%s' while VF devices are allocated", p.Device)
+	}
+
+	for _, vf := range p.AvailableDevices {
+		if err := vf.unbindVFIODriver(); err != nil {
+			klog.Warningf("Could not unbind VF '%s' from %s: %v", vf.UID(), vfioPCI, err)
+		}
+	}
+
+	if err := p.write(numVFs, "0"); err != nil {
+		return err
+	}
+
+	p.NumVFs = 0
+	p.AvailableDevices = VFDevices{}
+	p.VFsEnabledByDriver = false
+
+	return nil
+}
+
 // Whether to allow dynamic reconfiguration of PF device services on Free()
 // and Allocate() forcing the caller to update further device resources in K8s.
 func (p *PFDevice) EnableReconfiguration(allow bool) {
 	p.AllowReconfiguration = allow
 }
 
+// SetReadOnly marks the PF device as one whose VFs and services the driver
+// lacks the privileges to change, so its services are never reconfigured.
+func (p *PFDevice) SetReadOnly(readOnly bool) {
+	p.ReadOnly = readOnly
+}
+
+// SetStrictVFCount makes enabling VFs fail instead of logging a warning when
+// fewer VFs are found than enabled.
+func (p *PFDevice) SetStrictVFCount(strict bool) {
+	p.StrictVFCount = strict
+}
+
+// SetUpRetry sets how many times bringing the PF device up is retried, and
+// the wait before the first retry.
+func (p *PFDevice) SetUpRetry(retries int, interval time.Duration) {
+	p.UpRetries = retries
+	p.UpRetryInterval = interval
+}
+
+// SetForceReconfiguration makes the PF device services reconfigurable for a
+// claim even when some of its VFs are used outside of the driver, e.g. on
+// single-tenant nodes.
+func (p *PFDevice) SetForceReconfiguration(force bool) {
+	p.ForceReconfiguration = force
+}
+
+// reconfigurationSafe returns an error if taking the PF device down would
+// disrupt in-flight DMA of co-tenant workloads using the externally used VFs
+// outside of Kubernetes, unless reconfiguration is forced.
+func (p *PFDevice) reconfigurationSafe(externallyUsed []string) error {
+	if p.ForceReconfiguration {
+		return nil
+	}
+
+	if len(externallyUsed) > 0 {
+		return fmt.Errorf("VFs %v are bound to other drivers than %s", externallyUsed, vfioPCI)
+	}
+
+	return nil
+}
+
+// ExternallyUsedVFs returns the sorted PCI addresses of the unallocated VFs
+// bound to another driver than vfio-pci, e.g. the kernel QAT VF driver, which
+// are used by consumers outside of the driver. The binding as of the last
+// CheckBinding is used, sysfs is not read.
+func (p *PFDevice) ExternallyUsedVFs() []string {
+	return p.externallyUsedVFs(func(vf *VFDevice) VFDriver { return vf.VFDriver })
+}
+
+// boundVFsInUse returns the sorted PCI addresses of the unallocated VFs
+// currently bound to another driver than vfio-pci in sysfs. It is checked
+// right before taking the PF device down, the cached binding may be stale.
+func (p *PFDevice) boundVFsInUse() []string {
+	return p.externallyUsedVFs(func(vf *VFDevice) VFDriver { return driverByName(vf.boundDriver()) })
+}
+
+// CheckBinding re-reads the driver the unallocated VFs of the PF device are
+// bound to, which ExternallyUsedVFs uses. Returns true if any binding changed.
+func (p *PFDevice) CheckBinding() bool {
+	changed := false
+	for _, vf := range p.AvailableDevices {
+		if vf.CheckBinding() {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func (p *PFDevice) externallyUsedVFs(driver func(*VFDevice) VFDriver) []string {
+	externallyUsed := []string{}
+	for _, vf := range p.AvailableDevices {
+		if driver(vf) == Unknown {
+			externallyUsed = append(externallyUsed, vf.VFDevice)
+		}
+	}
+	sort.Strings(externallyUsed)
+
+	return externallyUsed
+}
+
+// SetReconfigurationCooldown sets the minimum time after the last services
+// configuration change, during which the PF device is not reconfigured for
+// another allocation.
+func (p *PFDevice) SetReconfigurationCooldown(cooldown time.Duration) {
+	p.ReconfigurationCooldown = cooldown
+}
+
+// SetDefaultService sets the services the PF device returns to when its last
+// VF is freed. Unset disables returning to a default.
+func (p *PFDevice) SetDefaultService(service Services) error {
+	if err := p.ValidateServices(service); err != nil {
+		return err
+	}
+
+	p.DefaultService = service
+	return nil
+}
+
+// reconfigurable returns true if the PF device services can be changed for
+// a claim: reconfiguration is allowed, the PF device is writable and it is
+// unconfigured, runs its default services, or kept the services of a freed
+// claim.
+func (p *PFDevice) reconfigurable() bool {
+	if !p.AllowReconfiguration || p.ReadOnly {
+		return false
+	}
+
+	return p.Services == None || (p.DefaultService != Unset && p.Services.String() == p.DefaultService.String()) ||
+		(p.ServicesKept && len(p.AllocatedDevices) == 0)
+}
+
+// InReconfigurationCooldown returns true if the PF device services were
+// changed for a claim less than ReconfigurationCooldown ago. The services
+// configured at startup do not start the cooldown.
+func (p *PFDevice) InReconfigurationCooldown() bool {
+	return p.ReconfigurationCooldown > 0 && time.Since(p.LastReconfiguration) < p.ReconfigurationCooldown
+}
+
+// CanReconfigureTo returns true if the PF device services could be changed
+// to the service for a claim right now: no VFs are allocated, reconfiguration
+// is allowed, the device generation supports the service, no cooldown is
+// active and no VFs are used outside of the driver. The PF device is not
+// changed.
+func (p *PFDevice) CanReconfigureTo(service Services) bool {
+	return p.reconfigurableTo(service) && !p.InReconfigurationCooldown()
+}
+
+// reconfigurableTo is CanReconfigureTo without the cooldown, which ends
+// without any change of the PF device.
+func (p *PFDevice) reconfigurableTo(service Services) bool {
+	return len(p.AllocatedDevices) == 0 &&
+		p.reconfigurable() &&
+		p.ValidateServices(service) == nil &&
+		p.reconfigurationSafe(p.ExternallyUsedVFs()) == nil
+}
+
+// ReconfigureForClaims changes the PF device services once for VFs of several
+// claims prepared together, e.g. to sym and asym when one claim requests sym
+// and another asym, which could otherwise not both get VFs of the PF device.
+// It fails when the services could not be changed for a claim right now.
+func (p *PFDevice) ReconfigureForClaims(services Services, claimUIDs []string) error {
+	if !p.CanReconfigureTo(services) {
+		return fmt.Errorf("PF device '%s' cannot be reconfigured to '%s' right now", p.Device, services.String())
+	}
+
+	return p.reconfigure(services, strings.Join(claimUIDs, ","))
+}
+
+// RestoreServices returns the PF device to the services it had before
+// ReconfigureForClaims, unless VFs of the PF device are allocated or the
+// services already changed back.
+func (p *PFDevice) RestoreServices(services Services, claimUIDs []string) error {
+	if len(p.AllocatedDevices) != 0 || p.Services.String() == services.String() {
+		return nil
+	}
+
+	return p.reconfigure(services, strings.Join(claimUIDs, ","))
+}
+
+// Reconfigurable returns true if the PF device services could be changed to
+// any of the services once a reconfiguration cooldown is over. The cooldown is
+// left out, so that the result only changes with the PF device state.
+func (p *PFDevice) Reconfigurable() bool {
+	for _, service := range []Services{Sym, Asym, Dc, Dcc} {
+		if p.reconfigurableTo(service) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AvailableCapacity returns per service the number of VFs that could be
+// allocated for it right now: free VFs of PF devices whose services support
+// it, and free VFs of idle PF devices that could be reconfigured to it.
+// Unhealthy PF devices are not counted.
+func (q QATDevices) AvailableCapacity() map[Services]int {
+	capacity := map[Services]int{}
+	for _, service := range []Services{Sym, Asym, Dc, Dcc} {
+		capacity[service] = 0
+	}
+
+	for _, pf := range q {
+		if pf.Unhealthy {
+			continue
+		}
+
+		free := len(pf.AvailableDevices)
+		for service := range capacity {
+			if pf.Services.Supports(service) || pf.CanReconfigureTo(service) {
+				capacity[service] += free
+			}
+		}
+	}
+
+	return capacity
+}
+
 func (p *PFDevice) Allocate(deviceUID string, allocatedBy string) (*VFDevice, error) {
 	var vf *VFDevice = nil
 	exists := false
@@ -525,6 +1119,100 @@ func (p *PFDevice) Allocate(deviceUID string, allocatedBy string) (*VFDevice, er
 	return vf, nil
 }
 
+// AllocateAll allocates all VFs of the PF device to allocatedBy. Allocation
+// fails without side effects if any of the VFs is allocated by someone else.
+func (p *PFDevice) AllocateAll(allocatedBy string) (VFDevices, error) {
+	if allocatedBy == "" {
+		return nil, fmt.Errorf("no allocator ID given")
+	}
+
+	for requester, vfdevices := range p.AllocatedDevices {
+		if requester != allocatedBy && len(vfdevices) > 0 {
+			return nil, fmt.Errorf("PF dev '%s' has VF devices allocated by '%s'", p.Device, requester)
+		}
+	}
+
+	uids := make([]string, 0, len(p.AvailableDevices))
+	for uid := range p.AvailableDevices {
+		uids = append(uids, uid)
+	}
+
+	allocated := make(VFDevices, 0)
+	for _, uid := range uids {
+		vf, err := p.Allocate(uid, allocatedBy)
+		if err != nil {
+			// roll back partial allocation
+			for vfuid, vf := range allocated {
+				p.AvailableDevices[vfuid] = vf
+				delete(p.AllocatedDevices[allocatedBy], vfuid)
+			}
+			if len(p.AllocatedDevices[allocatedBy]) == 0 {
+				delete(p.AllocatedDevices, allocatedBy)
+			}
+			return nil, fmt.Errorf("could not allocate all VF devices of PF dev '%s': %v", p.Device, err)
+		}
+		allocated[uid] = vf
+	}
+
+	return p.AllocatedDevices[allocatedBy], nil
+}
+
+// FreeAll frees all VFs of the PF device allocated by requestedBy.
+func (p *PFDevice) FreeAll(requestedBy string) (bool, error) {
+	vfdevices, exists := p.AllocatedDevices[requestedBy]
+	if !exists {
+		return false, fmt.Errorf("no devices allocated by '%s' in PF dev '%s'", requestedBy, p.Device)
+	}
+
+	uids := make([]string, 0, len(vfdevices))
+	for uid := range vfdevices {
+		uids = append(uids, uid)
+	}
+
+	updated := false
+	for _, uid := range uids {
+		update, err := p.freePF(uid, requestedBy)
+		if err != nil {
+			return updated, err
+		}
+		updated = updated || update
+	}
+
+	return updated, nil
+}
+
+// VFCount returns the number of VF devices of the PF device, allocated or not.
+func (p *PFDevice) VFCount() int {
+	count := len(p.AvailableDevices)
+	for _, vfdevices := range p.AllocatedDevices {
+		count += len(vfdevices)
+	}
+	return count
+}
+
+// UID returns the PF device identifier, PCI address with colons and dots
+// replaced by dashes.
+// NUMANode returns the NUMA node of the PF device, or helpers.NUMANodeUnknown.
+func (p *PFDevice) NUMANode() int {
+	return helpers.ReadNUMANode(filepath.Join(sysfsDevicePath(), p.Device))
+}
+
+// PCIRoot returns the PCI root complex of the PF device, or empty string if
+// it cannot be determined.
+func (p *PFDevice) PCIRoot() string {
+	pciRoot, err := helpers.DeterminePCIRoot(filepath.Join(sysfsDevicePath(), p.Device))
+	if err != nil {
+		klog.V(5).Infof("PF device '%s': %v", p.Device, err)
+		return ""
+	}
+
+	return pciRoot
+}
+
+func (p *PFDevice) UID() string {
+	return pfdeviceuid(p.Device)
+}
+
 func (v VFDevice) CheckAlreadyAllocated(service Services, requester string) bool {
 	// check for already allocated service mapped by request ID
 	if !v.pfdevice.Services.Supports(service) {
@@ -549,10 +1237,15 @@ func (v VFDevice) AllocateFromConfigured(service Services, requester string) boo
 }
 
 func (v VFDevice) AllocateWithReconfiguration(service Services, requester string) bool {
-	if v.pfdevice.Services != None || !v.pfdevice.AllowReconfiguration {
+	if !v.pfdevice.reconfigurable() {
 		return false
 	}
-	if err := v.pfdevice.SetServices([]Services{service}); err != nil {
+	if v.pfdevice.InReconfigurationCooldown() {
+		klog.V(5).Infof("PF device '%s' was reconfigured less than %v ago, not reconfiguring", v.pfdevice.Device, v.pfdevice.ReconfigurationCooldown)
+		return false
+	}
+	if err := v.pfdevice.reconfigure(service, requester); err != nil {
+		klog.Warningf("Could not reconfigure PF device '%s': %v", v.pfdevice.Device, err)
 		_, _ = v.pfdevice.free(v.UID(), requester)
 		return false
 	}
@@ -562,6 +1255,15 @@ func (v VFDevice) AllocateWithReconfiguration(service Services, requester string
 	return true
 }
 
+// VerifyServices verifies the services of the PF device the VF belongs to.
+func (v *VFDevice) VerifyServices() error {
+	if v.pfdevice == nil {
+		return nil
+	}
+
+	return v.pfdevice.VerifyServices()
+}
+
 func (v *VFDevice) Free(requestedBy string) (bool, error) {
 	return v.pfdevice.free(v.UID(), requestedBy)
 }
@@ -575,12 +1277,18 @@ func (p *PFDevice) freePF(requestedDeviceUID string, requestedBy string) (bool,
 				delete(p.AllocatedDevices, requestedBy)
 			}
 
+			if len(p.AllocatedDevices) == 0 && p.DefaultService != Unset {
+				// Returning to the default services is not a reconfiguration for a
+				// claim, so it does not depend on AllowReconfiguration.
+				if p.Services.String() == p.DefaultService.String() {
+					return false, nil
+				}
+				return p.resetServices(p.DefaultService, requestedBy)
+			}
+
 			if len(p.AllocatedDevices) == 0 && p.AllowReconfiguration {
 				// set PF device configuration back to an unconfigured state
-				if err := p.SetServices([]Services{None}); err != nil {
-					return false, err
-				}
-				return true, nil
+				return p.resetServices(None, requestedBy)
 			}
 
 			return false, nil
@@ -590,6 +1298,24 @@ func (p *PFDevice) freePF(requestedDeviceUID string, requestedBy string) (bool,
 	return false, fmt.Errorf("device '%s' could not be found", requestedDeviceUID)
 }
 
+// resetServices returns the PF device to the services after the last VF of the
+// claim was freed. During the reconfiguration cooldown the services of the
+// claim are kept instead, and the PF device stays reconfigurable for the next
+// claim once the cooldown is over.
+func (p *PFDevice) resetServices(services Services, claimUID string) (bool, error) {
+	if p.InReconfigurationCooldown() {
+		klog.V(5).Infof("PF device '%s' was reconfigured less than %v ago, keeping services '%s'", p.Device, p.ReconfigurationCooldown, p.Services.String())
+		p.ServicesKept = true
+		return false, nil
+	}
+
+	if err := p.reconfigure(services, claimUID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 func (p *PFDevice) free(requestedDeviceUID string, requestedBy string) (bool, error) {
 	if requestedDeviceUID == "" {
 		return false, fmt.Errorf("no device UID for request '%s'", requestedBy)
@@ -612,8 +1338,7 @@ func (v *VFDevice) update() {
 	driverpath := filepath.Join(sysfsDevicePath(), v.VFDevice, vfDriver)
 	driver, err := filepath.EvalSymlinks(driverpath)
 	if err == nil {
-		driver = filepath.Base(driver)
-		v.VFDriver = stringToDriver[driver]
+		v.VFDriver = driverByName(filepath.Base(driver))
 	}
 
 	iommupath := filepath.Join(sysfsDevicePath(), v.VFDevice, vfIOMMU)
@@ -665,10 +1390,31 @@ func (v *VFDevice) enableVFIO() error {
 	return nil
 }
 
+// PFDevice returns the PF device the VF belongs to, or nil for the VFIO
+// control node.
+func (v *VFDevice) PFDevice() *PFDevice {
+	return v.pfdevice
+}
+
 func (v *VFDevice) DeviceNode() string {
+	// The control node is /dev/vfio/vfio in all modes.
+	if iommuMode == IOMMUNoIOMMU && v.VFIommu != "vfio" {
+		return vfDeviceNode + "/" + noIOMMUPrefix + v.VFIommu
+	}
 	return vfDeviceNode + "/" + v.VFIommu
 }
 
+// HostDeviceNode returns the device node path on the host, which differs
+// from DeviceNode only when the devfs root is overridden, e.g. in tests.
+func (v *VFDevice) HostDeviceNode() string {
+	return filepath.Join(GetVfioDevPath(), filepath.Base(v.DeviceNode()))
+}
+
+// GetVfioDevPath returns the VFIO device node directory on the host.
+func GetVfioDevPath() string {
+	return filepath.Join(helpers.GetDevfsRoot(helpers.DevfsEnvVarName, DevfsVfioPath), DevfsVfioPath)
+}
+
 func (v *VFDevice) PCIDevice() string {
 	return v.VFDevice
 }
@@ -681,10 +1427,53 @@ func deviceuid(device string) string {
 	return "qatvf-" + strings.ReplaceAll(strings.ReplaceAll(device, ":", "-"), ".", "-")
 }
 
+func pfdeviceuid(device string) string {
+	return "qatpf-" + strings.ReplaceAll(strings.ReplaceAll(device, ":", "-"), ".", "-")
+}
+
 func (v *VFDevice) UID() string {
 	return deviceuid(v.VFDevice)
 }
 
+// Bound returns true if the VF is bound to vfio-pci, so that it is ready to
+// be used in containers.
+func (v *VFDevice) Bound() bool {
+	return v.VFDriver == VfioPci
+}
+
+// CheckBinding re-reads the driver the VF is bound to, e.g. after it was
+// unbound or rebound outside of the driver. Returns true if the binding
+// changed.
+func (v *VFDevice) CheckBinding() bool {
+	driver := driverByName(v.boundDriver())
+
+	changed := v.VFDriver != driver
+	v.VFDriver = driver
+
+	return changed
+}
+
+// boundDriver returns the name of the driver the VF is currently bound to in
+// sysfs, empty if unbound.
+func (v *VFDevice) boundDriver() string {
+	driverPath, err := filepath.EvalSymlinks(filepath.Join(sysfsDevicePath(), v.VFDevice, vfDriver))
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Base(driverPath)
+}
+
+// Healthy returns false if the PF device of the VF is unhealthy.
+func (v *VFDevice) Healthy() bool {
+	return v.pfdevice == nil || !v.pfdevice.Unhealthy
+}
+
+// Supports returns true if the PF device of the VF is configured with the service.
+func (v *VFDevice) Supports(service Services) bool {
+	return v.pfdevice.Services.Supports(service)
+}
+
 func (v *VFDevice) Services() string {
 	return v.pfdevice.Services.String()
 }
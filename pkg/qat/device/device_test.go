@@ -5,12 +5,17 @@
 package device
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 	testhelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
 )
 
@@ -47,6 +52,19 @@ func TestNew(t *testing.T) {
 			},
 			wantPFs: 1, wantTotalVFs: 3,
 		},
+		{
+			name: "one device with services unknown to the driver",
+			qatDevices: fakesysfs.QATDevices{
+				{
+					Device:   "0000:4b:00.0",
+					State:    "up",
+					Services: "sym;xyz",
+					NumVFs:   2,
+					TotalVFs: 2,
+				},
+			},
+			wantPFs: 1, wantTotalVFs: 2,
+		},
 		{
 			name: "one device with broken VF symlink ignored",
 			qatDevices: fakesysfs.QATDevices{
@@ -101,7 +119,7 @@ func TestNew(t *testing.T) {
 				}
 			}
 
-			devs, err := New()
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
 			if err != nil {
 				t.Fatalf("New error: %v", err)
 			}
@@ -225,8 +243,17 @@ func TestStringToServices(t *testing.T) {
 		{"dc;dcc;sym;asym;sym;asym", Dc | Dcc | Sym | Asym, true},
 		{"sym;asym;xyz", Unset, false},
 		{"", None, true},
-		{"   ", Unset, false},
+		{"   ", None, true},
 		{";;;", None, true},
+		{"sym+asym", Sym | Asym, true},
+		{"sym,dc", Sym | Dc, true},
+		{"asym+dc;sym", Sym | Asym | Dc, true},
+		{"sym; asym", Sym | Asym, true},
+		{" dc \n", Dc, true},
+		{"sym + asym", Sym | Asym, true},
+		{"sym asym", Unset, false},
+		{"sym+xyz", Unset, false},
+		{"SYM", Unset, false},
 	}
 
 	for _, test := range testcases {
@@ -241,6 +268,31 @@ func TestStringToServices(t *testing.T) {
 	}
 }
 
+func TestParseServices(t *testing.T) {
+	type testCase struct {
+		str     string
+		service Services
+		unknown []string
+	}
+
+	testcases := []testCase{
+		{"sym;asym", Sym | Asym, []string{}},
+		{"", None, []string{}},
+		{"xyz", Unset, []string{"xyz"}},
+		{"sym;xyz;dc", Sym | Dc, []string{"xyz"}},
+		{"dccc;sym;dccc;abc", Sym, []string{"dccc", "abc"}},
+		{"sym+xyz, dc", Sym | Dc, []string{"xyz"}},
+	}
+
+	for _, test := range testcases {
+		service, unknown := ParseServices(test.str)
+		if service != test.service || !reflect.DeepEqual(unknown, test.unknown) {
+			t.Errorf("test string '%s': expected '%s' and unknown %v, got '%s' and %v",
+				test.str, test.service.String(), test.unknown, service.String(), unknown)
+		}
+	}
+}
+
 func TestServicesSupport(t *testing.T) {
 	type testCase struct {
 		service  Services
@@ -260,6 +312,12 @@ func TestServicesSupport(t *testing.T) {
 		{None, None, true},
 		{None, Unset, true},
 		{Unset, None, false},
+		{Dcc, Dc, true},
+		{Dcc, Dcc, true},
+		{Dcc, Dc | Dcc, true},
+		{Dc, Dcc, false},
+		{Dc | Dcc, Dcc, true},
+		{Dcc, Sym, false},
 	}
 
 	for _, test := range testcases {
@@ -448,7 +506,7 @@ func TestCheckAlreadyAllocated(t *testing.T) {
 				t.Errorf("setup error: could not create fake sysfs: %v", err)
 			}
 
-			devs, err := New()
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
 			if err != nil {
 				t.Fatalf("New error: %v", err)
 			}
@@ -539,7 +597,7 @@ func TestAllocateWithReconfiguration(t *testing.T) {
 				t.Errorf("setup error: could not create fake sysfs: %v", err)
 			}
 
-			devs, err := New()
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
 			if err != nil {
 				t.Fatalf("New error: %v", err)
 			}
@@ -616,6 +674,22 @@ func TestAllocateFromConfigured(t *testing.T) {
 			preAllocate:     false,
 			wantSuccess:     false,
 		},
+		{
+			name:            "success when PF has dcc and request dc (dcc implies dc)",
+			servicesInitial: "dcc",
+			requestService:  Dc,
+			requester:       "claimC",
+			preAllocate:     false,
+			wantSuccess:     true,
+		},
+		{
+			name:            "success when PF has dcc and request dcc",
+			servicesInitial: "dcc",
+			requestService:  Dcc,
+			requester:       "claimD",
+			preAllocate:     false,
+			wantSuccess:     true,
+		},
 		{
 			name:            "fail when VF is already allocated to another requester",
 			servicesInitial: "sym;asym",
@@ -644,7 +718,7 @@ func TestAllocateFromConfigured(t *testing.T) {
 				t.Errorf("setup error: could not create fake sysfs: %v", err)
 			}
 
-			devs, err := New()
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
 			if err != nil {
 				t.Fatalf("New error: %v", err)
 			}
@@ -744,6 +818,34 @@ func TestGetControlNode(t *testing.T) {
 	if ctrl.PCIDevice() != "vfio" {
 		t.Fatalf("PCIDevice() want 'vfio' got '%s'", ctrl.PCIDevice())
 	}
+
+	devfsRoot := t.TempDir()
+	hostControlNode := filepath.Join(devfsRoot, DevfsVfioPath, "vfio")
+	if err := os.MkdirAll(filepath.Dir(hostControlNode), 0750); err != nil {
+		t.Fatalf("could not create fake devfs: %v", err)
+	}
+	if err := os.WriteFile(hostControlNode, nil, 0600); err != nil {
+		t.Fatalf("could not create fake control node: %v", err)
+	}
+	t.Setenv(helpers.DevfsEnvVarName, devfsRoot)
+
+	if ctrl.DeviceNode() != "/dev/vfio/vfio" {
+		t.Fatalf("DeviceNode() with custom devfs root want '/dev/vfio/vfio' got '%s'", ctrl.DeviceNode())
+	}
+	if ctrl.HostDeviceNode() != hostControlNode {
+		t.Fatalf("HostDeviceNode() want '%s' got '%s'", hostControlNode, ctrl.HostDeviceNode())
+	}
+	if _, err := os.Stat(ctrl.HostDeviceNode()); err != nil {
+		t.Fatalf("fake control node not found: %v", err)
+	}
+}
+
+func TestHostDeviceNodeDefaultDevfs(t *testing.T) {
+	t.Setenv(helpers.DevfsEnvVarName, "")
+	vf := &VFDevice{VFDevice: "0000:3d:00.1", VFIommu: "123"}
+	if vf.HostDeviceNode() != vf.DeviceNode() {
+		t.Errorf("HostDeviceNode() want '%s' got '%s'", vf.DeviceNode(), vf.HostDeviceNode())
+	}
 }
 
 func TestGetCDIDevices(t *testing.T) {
@@ -766,7 +868,7 @@ func TestGetCDIDevices(t *testing.T) {
 		t.Errorf("setup error: could not create fake sysfs: %v", err)
 	}
 
-	devs, err := New()
+	devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
 	if err != nil {
 		t.Fatalf("New error: %v", err)
 	}
@@ -879,7 +981,7 @@ func TestFree(t *testing.T) {
 				t.Errorf("setup error: could not create fake sysfs: %v", err)
 			}
 
-			devs, err := New()
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
 			if err != nil {
 				t.Fatalf("New error: %v", err)
 			}
@@ -999,3 +1101,806 @@ func TestCDIName(t *testing.T) {
 		})
 	}
 }
+
+func TestAllocateAllFreeAll(t *testing.T) {
+	subtests := []struct {
+		name          string
+		preAllocateBy string
+		wantErr       bool
+		wantAllocated int
+	}{
+		{
+			name:          "all VFs available",
+			wantAllocated: 3,
+		},
+		{
+			name:          "one VF already allocated by same requester",
+			preAllocateBy: "claimX",
+			wantAllocated: 3,
+		},
+		{
+			name:          "one VF already allocated by another requester",
+			preAllocateBy: "claimY",
+			wantErr:       true,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			orig := sysfsRoot
+			t.Cleanup(func() { sysfsRoot = orig })
+
+			root := t.TempDir()
+			sysfsRoot = ""
+			t.Setenv("SYSFS_ROOT", root)
+
+			if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+				{
+					Device:   "0000:4b:00.0",
+					State:    "up",
+					Services: "sym",
+					NumVFs:   3,
+					TotalVFs: 3,
+				},
+			}); err != nil {
+				t.Errorf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+			if err != nil {
+				t.Fatalf("New error: %v", err)
+			}
+			pf := devs[0]
+
+			if pf.UID() != "qatpf-0000-4b-00-0" {
+				t.Fatalf("PF UID want 'qatpf-0000-4b-00-0' got '%s'", pf.UID())
+			}
+			if pf.VFCount() != 3 {
+				t.Fatalf("VF count want 3 got %d", pf.VFCount())
+			}
+
+			if st.preAllocateBy != "" {
+				if _, err := pf.Allocate("", st.preAllocateBy); err != nil {
+					t.Fatalf("pre-allocate: %v", err)
+				}
+			}
+			availableBefore := len(pf.AvailableDevices)
+
+			allocated, err := pf.AllocateAll("claimX")
+			if st.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got none")
+				}
+				if len(pf.AvailableDevices) != availableBefore {
+					t.Fatalf("available VFs changed on failure %d -> %d", availableBefore, len(pf.AvailableDevices))
+				}
+				if _, exists := pf.AllocatedDevices["claimX"]; exists {
+					t.Fatal("VFs allocated to claimX on failure")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AllocateAll error: %v", err)
+			}
+			if len(allocated) != st.wantAllocated {
+				t.Fatalf("allocated VFs want %d got %d", st.wantAllocated, len(allocated))
+			}
+			if len(pf.AvailableDevices) != 0 {
+				t.Fatalf("want no available VFs, got %d", len(pf.AvailableDevices))
+			}
+			if pf.VFCount() != 3 {
+				t.Fatalf("VF count after allocation want 3 got %d", pf.VFCount())
+			}
+
+			if _, err := pf.FreeAll("claimY"); err == nil {
+				t.Fatal("expected error freeing with wrong claim ID")
+			}
+			if _, err := pf.FreeAll("claimX"); err != nil {
+				t.Fatalf("FreeAll error: %v", err)
+			}
+			if len(pf.AvailableDevices) != 3 || len(pf.AllocatedDevices) != 0 {
+				t.Fatalf("want all VFs available after FreeAll, got %d available, %d allocations",
+					len(pf.AvailableDevices), len(pf.AllocatedDevices))
+			}
+		})
+	}
+}
+
+func TestFindPFByVFUID(t *testing.T) {
+	orig := sysfsRoot
+	t.Cleanup(func() { sysfsRoot = orig })
+
+	root := t.TempDir()
+	sysfsRoot = ""
+	t.Setenv("SYSFS_ROOT", root)
+
+	if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+		{Device: "0000:4b:00.0", State: "up", Services: "sym", NumVFs: 2, TotalVFs: 2},
+		{Device: "0000:4d:00.0", State: "up", Services: "dc", NumVFs: 2, TotalVFs: 2},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	// allocated VFs are found as well
+	if _, err := devs[1].Allocate("qatvf-0000-4d-00-2", "claimX"); err != nil {
+		t.Fatalf("could not allocate VF: %v", err)
+	}
+
+	for uid, expected := range map[string]string{
+		"qatvf-0000-4b-00-1": "0000:4b:00.0",
+		"qatvf-0000-4b-00-2": "0000:4b:00.0",
+		"qatvf-0000-4d-00-1": "0000:4d:00.0",
+		"qatvf-0000-4d-00-2": "0000:4d:00.0",
+	} {
+		pf := devs.FindPFByVFUID(uid)
+		if pf == nil || pf.Device != expected {
+			t.Errorf("VF '%s': expected PF device '%s', got %v", uid, expected, pf)
+		}
+		if vf := devs.FindVFByUID(uid); vf == nil || vf.UID() != uid || vf.PFDevice() != pf {
+			t.Errorf("VF '%s': unexpected VF device %v", uid, vf)
+		}
+	}
+
+	for _, uid := range []string{"qatvf-0000-4f-00-1", "qatpf-0000-4b-00-0", ""} {
+		if pf := devs.FindPFByVFUID(uid); pf != nil {
+			t.Errorf("VF '%s': expected no PF device, got '%s'", uid, pf.Device)
+		}
+	}
+
+	ctrl, err := GetControlNode()
+	if err != nil {
+		t.Fatalf("GetControlNode error: %v", err)
+	}
+	if ctrl.PFDevice() != nil {
+		t.Error("expected no PF device for the control node")
+	}
+	if pf := devs.FindPFByVFUID(ctrl.UID()); pf != nil {
+		t.Errorf("expected no PF device for the control node UID, got '%s'", pf.Device)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	subtests := []struct {
+		name          string
+		state         string
+		errorsFatal   int
+		wantUnhealthy bool
+	}{
+		{name: "up without errors", state: "up"},
+		{name: "down", state: "down", wantUnhealthy: true},
+		{name: "fatal errors reported", state: "up", errorsFatal: 1, wantUnhealthy: true},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			orig := sysfsRoot
+			t.Cleanup(func() { sysfsRoot = orig })
+
+			root := t.TempDir()
+			sysfsRoot = ""
+			t.Setenv("SYSFS_ROOT", root)
+
+			if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+				{
+					Device:      "0000:4b:00.0",
+					State:       st.state,
+					Services:    "sym",
+					NumVFs:      1,
+					TotalVFs:    1,
+					ErrorsFatal: st.errorsFatal,
+				},
+			}); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+			if err != nil {
+				t.Fatalf("New error: %v", err)
+			}
+			pf := devs[0]
+
+			if changed := pf.CheckHealth(); changed != st.wantUnhealthy {
+				t.Errorf("health changed want %v got %v", st.wantUnhealthy, changed)
+			}
+			if pf.Unhealthy != st.wantUnhealthy {
+				t.Errorf("unhealthy want %v got %v", st.wantUnhealthy, pf.Unhealthy)
+			}
+			for _, vf := range pf.AvailableDevices {
+				if vf.Healthy() == st.wantUnhealthy {
+					t.Errorf("VF '%s' healthy want %v", vf.UID(), !st.wantUnhealthy)
+				}
+			}
+			if changed := pf.CheckHealth(); changed {
+				t.Error("health changed on repeated check without sysfs changes")
+			}
+		})
+	}
+}
+
+func TestReconfigurationCooldown(t *testing.T) {
+	orig := sysfsRoot
+	t.Cleanup(func() { sysfsRoot = orig })
+
+	root := t.TempDir()
+	sysfsRoot = ""
+	t.Setenv("SYSFS_ROOT", root)
+
+	if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+		{Device: "0000:4b:00.0", State: "up", Services: "", NumVFs: 2, TotalVFs: 2},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+	}
+	pf := devs[0]
+	pf.EnableReconfiguration(true)
+	pf.SetReconfigurationCooldown(time.Hour)
+
+	vf := pf.AvailableDevices["qatvf-0000-4b-00-1"]
+	if vf == nil {
+		t.Fatal("no VF available to test")
+	}
+
+	// Services configured at startup do not start the cooldown.
+	if err := pf.SetServices([]Services{Dc}); err != nil {
+		t.Fatalf("SetServices error: %v", err)
+	}
+	if pf.InReconfigurationCooldown() {
+		t.Error("expected initial configuration not to start the cooldown")
+	}
+	if err := pf.SetServices([]Services{None}); err != nil {
+		t.Fatalf("SetServices error: %v", err)
+	}
+
+	if !vf.AllocateWithReconfiguration(Sym, "claim1") {
+		t.Fatal("first reconfiguration failed")
+	}
+	if !pf.InReconfigurationCooldown() {
+		t.Error("expected PF to be in reconfiguration cooldown")
+	}
+	// Freeing the last VF during the cooldown keeps the PF services.
+	if updated, err := vf.Free("claim1"); err != nil || updated {
+		t.Fatalf("expected free without update, got %v, error: %v", updated, err)
+	}
+	if pf.Services.String() != "sym" {
+		t.Errorf("PF services changed during cooldown to '%s'", pf.Services.String())
+	}
+
+	if vf.AllocateWithReconfiguration(Asym, "claim2") {
+		t.Fatal("reconfiguration within cooldown succeeded")
+	}
+	if pf.Services.String() != "sym" {
+		t.Errorf("PF services changed during cooldown to '%s'", pf.Services.String())
+	}
+
+	pf.LastReconfiguration = time.Now().Add(-2 * time.Hour)
+	if !vf.AllocateWithReconfiguration(Asym, "claim2") {
+		t.Fatal("reconfiguration after cooldown failed")
+	}
+	pf.LastReconfiguration = time.Now().Add(-2 * time.Hour)
+	// Freeing the last VF after the cooldown resets the PF services.
+	if updated, err := vf.Free("claim2"); err != nil || !updated {
+		t.Fatalf("expected free with update, got %v, error: %v", updated, err)
+	}
+	if pf.Services != None {
+		t.Errorf("expected PF services reset after cooldown, got '%s'", pf.Services.String())
+	}
+}
+
+func TestReconfigurationWithExternallyUsedVFs(t *testing.T) {
+	orig := sysfsRoot
+	t.Cleanup(func() { sysfsRoot = orig })
+
+	root := t.TempDir()
+	sysfsRoot = ""
+	t.Setenv("SYSFS_ROOT", root)
+
+	if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+		{Device: "0000:4b:00.0", State: "up", Services: "", NumVFs: 2, TotalVFs: 2},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+	}
+	pf := devs[0]
+	pf.EnableReconfiguration(true)
+
+	vf := pf.AvailableDevices["qatvf-0000-4b-00-1"]
+	if vf == nil {
+		t.Fatal("no VF available to test")
+	}
+
+	// Sibling VF taken over by the kernel QAT VF driver for a host workload.
+	kernelDriverDir := filepath.Join(root, SysfsDriverPath, "4xxxvf")
+	if err := os.MkdirAll(kernelDriverDir, 0755); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	vfDriverLink := filepath.Join(root, SysfsDevicePath, "0000:4b:00.2", vfDriver)
+	if err := os.Remove(vfDriverLink); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if err := os.Symlink(kernelDriverDir, vfDriverLink); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if externallyUsed := pf.ExternallyUsedVFs(); len(externallyUsed) != 0 {
+		t.Errorf("expected binding not to be re-read before CheckBinding, got %v", externallyUsed)
+	}
+	if vf.AllocateWithReconfiguration(Sym, "claim1") {
+		t.Fatal("reconfiguration with externally used VFs not yet checked succeeded")
+	}
+	if !pf.CheckBinding() {
+		t.Error("expected binding change")
+	}
+	if externallyUsed := pf.ExternallyUsedVFs(); !reflect.DeepEqual(externallyUsed, []string{"0000:4b:00.2"}) {
+		t.Errorf("expected VF 0000:4b:00.2 to be used externally, got %v", externallyUsed)
+	}
+	if pf.CanReconfigureTo(Sym) {
+		t.Error("expected PF not to be reconfigurable with externally used VFs")
+	}
+	if vf.AllocateWithReconfiguration(Sym, "claim1") {
+		t.Fatal("reconfiguration with externally used VFs succeeded")
+	}
+	if pf.Services != None {
+		t.Errorf("PF services changed to '%s'", pf.Services.String())
+	}
+
+	pf.SetForceReconfiguration(true)
+	if !pf.CanReconfigureTo(Sym) {
+		t.Error("expected forced PF to be reconfigurable")
+	}
+	if !vf.AllocateWithReconfiguration(Sym, "claim1") {
+		t.Error("forced reconfiguration failed")
+	}
+}
+
+func TestCanReconfigureTo(t *testing.T) {
+	orig := sysfsRoot
+	t.Cleanup(func() { sysfsRoot = orig })
+
+	root := t.TempDir()
+	sysfsRoot = ""
+	t.Setenv("SYSFS_ROOT", root)
+
+	if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+		{Device: "0000:4b:00.0", State: "up", Services: "", NumVFs: 2, TotalVFs: 2},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+	}
+	pf := devs[0]
+	pf.DeviceID = "0x4940"
+
+	if pf.CanReconfigureTo(Sym) || pf.Reconfigurable() {
+		t.Error("expected PF without reconfiguration allowed not to be reconfigurable")
+	}
+
+	pf.EnableReconfiguration(true)
+	if !pf.CanReconfigureTo(Sym) || !pf.Reconfigurable() {
+		t.Error("expected idle PF to be reconfigurable")
+	}
+	if pf.CanReconfigureTo(Dcc | Sym) {
+		t.Error("expected PF not to be reconfigurable to services unsupported by its generation")
+	}
+
+	if _, err := pf.Allocate("", "claim1"); err != nil {
+		t.Fatalf("allocate error: %v", err)
+	}
+	if pf.CanReconfigureTo(Sym) || pf.Reconfigurable() {
+		t.Error("expected PF with allocated VFs not to be reconfigurable")
+	}
+	if _, err := pf.FreeAll("claim1"); err != nil {
+		t.Fatalf("free error: %v", err)
+	}
+
+	pf.SetReconfigurationCooldown(time.Hour)
+	pf.LastReconfiguration = time.Now()
+	if pf.CanReconfigureTo(Sym) {
+		t.Error("expected PF in reconfiguration cooldown not to be reconfigurable right now")
+	}
+	if !pf.Reconfigurable() {
+		t.Error("expected PF in reconfiguration cooldown to be reconfigurable once the cooldown is over")
+	}
+
+	if pf.Services != None || len(pf.AvailableDevices) != 2 {
+		t.Errorf("expected PF to stay unchanged, got services '%s' and %d available VFs", pf.Services.String(), len(pf.AvailableDevices))
+	}
+}
+
+func TestAvailableCapacity(t *testing.T) {
+	orig := sysfsRoot
+	t.Cleanup(func() { sysfsRoot = orig })
+
+	root := t.TempDir()
+	sysfsRoot = ""
+	t.Setenv("SYSFS_ROOT", root)
+
+	if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+		// configured
+		{Device: "0000:4b:00.0", State: "up", Services: "sym", NumVFs: 2, TotalVFs: 2},
+		// idle and reconfigurable
+		{Device: "0000:4c:00.0", State: "up", Services: "", NumVFs: 3, TotalVFs: 3},
+		// busy, one VF allocated
+		{Device: "0000:4d:00.0", State: "up", Services: "asym;dc", NumVFs: 3, TotalVFs: 3},
+		// unhealthy
+		{Device: "0000:4e:00.0", State: "up", Services: "sym", NumVFs: 2, TotalVFs: 2},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+	if err != nil || len(devs) != 4 {
+		t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+	}
+	pfs := map[string]*PFDevice{}
+	for _, pf := range devs {
+		pf.DeviceID = "0x4940"
+		pf.EnableReconfiguration(true)
+		pfs[pf.Device] = pf
+	}
+	if _, err := pfs["0000:4d:00.0"].Allocate("", "claim1"); err != nil {
+		t.Fatalf("allocate error: %v", err)
+	}
+	pfs["0000:4e:00.0"].Unhealthy = true
+
+	expected := map[Services]int{
+		Sym:  2 + 3,
+		Asym: 3 + 2,
+		Dc:   3 + 2,
+		Dcc:  3,
+	}
+	if capacity := devs.AvailableCapacity(); !reflect.DeepEqual(capacity, expected) {
+		t.Errorf("expected capacity %v, got %v", expected, capacity)
+	}
+
+	// configured PF cannot be reconfigured, idle PF is in cooldown
+	pfs["0000:4b:00.0"].EnableReconfiguration(false)
+	pfs["0000:4c:00.0"].SetReconfigurationCooldown(time.Hour)
+	pfs["0000:4c:00.0"].LastReconfiguration = time.Now()
+
+	expected = map[Services]int{Sym: 2, Asym: 2, Dc: 2, Dcc: 0}
+	if capacity := devs.AvailableCapacity(); !reflect.DeepEqual(capacity, expected) {
+		t.Errorf("expected capacity %v, got %v", expected, capacity)
+	}
+}
+
+func TestVerifyServices(t *testing.T) {
+	orig := sysfsRoot
+	t.Cleanup(func() { sysfsRoot = orig })
+
+	root := t.TempDir()
+	sysfsRoot = ""
+	t.Setenv("SYSFS_ROOT", root)
+
+	if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+		{Device: "0000:4b:00.0", State: "up", Services: "", NumVFs: 2, TotalVFs: 2},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+	}
+	pf := devs[0]
+
+	if err := pf.SetServices([]Services{Sym, Asym}); err != nil {
+		t.Fatalf("SetServices error: %v", err)
+	}
+	if err := pf.VerifyServices(); err != nil {
+		t.Errorf("unexpected error verifying applied services: %v", err)
+	}
+
+	// The device applied the configuration only partially.
+	if err := pf.write(qatServices, "sym"); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if err := pf.VerifyServices(); err == nil {
+		t.Error("expected error verifying partially applied services")
+	}
+}
+
+func TestUpRetry(t *testing.T) {
+	origRoot, origWrite := sysfsRoot, writeSysfsFile
+	t.Cleanup(func() { sysfsRoot, writeSysfsFile = origRoot, origWrite })
+
+	for _, tt := range []struct {
+		name         string
+		retries      int
+		wantAllocate bool
+	}{
+		{name: "failed first attempt retried", retries: 1, wantAllocate: true},
+		{name: "no retries", retries: 0, wantAllocate: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			sysfsRoot = ""
+			t.Setenv("SYSFS_ROOT", root)
+
+			if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+				{Device: "0000:4b:00.0", State: "up", Services: "", NumVFs: 2, TotalVFs: 2},
+			}); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+			if err != nil || len(devs) != 1 {
+				t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+			}
+			pf := devs[0]
+			pf.EnableReconfiguration(true)
+			pf.SetUpRetry(tt.retries, time.Millisecond)
+
+			// The first attempt to bring the PF device up fails.
+			upAttempts := 0
+			writeSysfsFile = func(filePath string, value string) error {
+				if strings.HasSuffix(filePath, qatState) && value == "up" {
+					upAttempts++
+					if upAttempts == 1 {
+						return fmt.Errorf("device busy")
+					}
+				}
+				return origWrite(filePath, value)
+			}
+
+			vf := pf.AvailableDevices["qatvf-0000-4b-00-1"]
+			if vf == nil {
+				t.Fatal("no VF available to test")
+			}
+
+			if allocated := vf.AllocateWithReconfiguration(Sym, "claim1"); allocated != tt.wantAllocate {
+				t.Fatalf("expected allocation %v, got %v", tt.wantAllocate, allocated)
+			}
+			if expected := tt.retries + 1; upAttempts != expected {
+				t.Errorf("expected %d attempts to bring PF up, got %d", expected, upAttempts)
+			}
+			if !tt.wantAllocate {
+				if len(pf.AllocatedDevices) != 0 || pf.AvailableDevices[vf.UID()] == nil {
+					t.Errorf("expected failed allocation to be rolled back, allocated: %v", pf.AllocatedDevices)
+				}
+				return
+			}
+			if pf.State != Up || pf.Services.String() != "sym" {
+				t.Errorf("expected PF up with sym services, got state %v and services '%s'", pf.State, pf.Services.String())
+			}
+		})
+	}
+}
+
+func TestDefaultService(t *testing.T) {
+	orig := sysfsRoot
+	t.Cleanup(func() { sysfsRoot = orig })
+
+	tests := []struct {
+		name            string
+		allowReconfig   bool
+		configured      Services
+		requested       Services
+		expectReconfig  bool
+		expectUpdate    bool
+		expectAfterFree Services
+	}{
+		{name: "default services kept", configured: Asym, requested: Asym, expectAfterFree: Asym},
+		{name: "return to default without reconfiguration", configured: Sym, requested: Sym, expectUpdate: true, expectAfterFree: Asym},
+		{name: "reconfigure from default", allowReconfig: true, configured: Asym, requested: Sym, expectReconfig: true, expectUpdate: true, expectAfterFree: Asym},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			sysfsRoot = ""
+			t.Setenv("SYSFS_ROOT", root)
+
+			if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+				{Device: "0000:4b:00.0", State: "up", Services: "", NumVFs: 2, TotalVFs: 2},
+			}); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+			if err != nil || len(devs) != 1 {
+				t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+			}
+			pf := devs[0]
+			pf.EnableReconfiguration(tt.allowReconfig)
+			if err := pf.SetDefaultService(Asym); err != nil {
+				t.Fatalf("SetDefaultService error: %v", err)
+			}
+			if err := pf.SetServices([]Services{tt.configured}); err != nil {
+				t.Fatalf("SetServices error: %v", err)
+			}
+
+			vf := pf.AvailableDevices["qatvf-0000-4b-00-1"]
+			if vf == nil {
+				t.Fatal("no VF available to test")
+			}
+			if tt.expectReconfig {
+				if !vf.AllocateWithReconfiguration(tt.requested, "claim1") {
+					t.Fatal("reconfiguration from default services failed")
+				}
+			} else if !vf.AllocateFromConfigured(tt.requested, "claim1") {
+				t.Fatal("allocation from configured services failed")
+			}
+
+			updated, err := vf.Free("claim1")
+			if err != nil {
+				t.Fatalf("free error: %v", err)
+			}
+			if updated != tt.expectUpdate {
+				t.Errorf("expected update %v, got %v", tt.expectUpdate, updated)
+			}
+			if pf.Services.String() != tt.expectAfterFree.String() {
+				t.Errorf("expected services '%s' after free, got '%s'", tt.expectAfterFree.String(), pf.Services.String())
+			}
+		})
+	}
+}
+
+func TestEnableVFsMSIXLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		vfTotalMSIX int
+		wantNumVFs  string
+		wantLimit   int
+	}{
+		{name: "no MSI-X limit reported", vfTotalMSIX: 0, wantNumVFs: "16", wantLimit: 0},
+		{name: "MSI-X limit below total VFs", vfTotalMSIX: 4, wantNumVFs: "4", wantLimit: 4},
+		{name: "MSI-X limit above total VFs", vfTotalMSIX: 64, wantNumVFs: "16", wantLimit: 64},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			orig := sysfsRoot
+			t.Cleanup(func() { sysfsRoot = orig })
+
+			root := t.TempDir()
+			sysfsRoot = ""
+			t.Setenv("SYSFS_ROOT", root)
+
+			if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+				{Device: "0000:4b:00.0", State: "down", Services: "sym", NumVFs: 0, TotalVFs: 16, VFTotalMSIX: tc.vfTotalMSIX},
+			}); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+			if err != nil || len(devs) != 1 {
+				t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+			}
+			pf := devs[0]
+			if pf.MSIXVFLimit != tc.wantLimit {
+				t.Errorf("want MSI-X VF limit %d, got %d", tc.wantLimit, pf.MSIXVFLimit)
+			}
+
+			if err := pf.EnableVFs(); err != nil {
+				t.Fatalf("EnableVFs error: %v", err)
+			}
+
+			numvfs, err := pf.read(numVFs)
+			if err != nil {
+				t.Fatalf("could not read %s: %v", numVFs, err)
+			}
+			if numvfs != tc.wantNumVFs {
+				t.Errorf("want %s VFs enabled, got %s", tc.wantNumVFs, numvfs)
+			}
+		})
+	}
+}
+
+func TestEnableVFsVerifiesVFCount(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict %v", strict), func(t *testing.T) {
+			orig := sysfsRoot
+			t.Cleanup(func() { sysfsRoot = orig })
+
+			root := t.TempDir()
+			sysfsRoot = ""
+			t.Setenv("SYSFS_ROOT", root)
+
+			if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+				{Device: "0000:4b:00.0", State: "down", Services: "sym", NumVFs: 0, TotalVFs: 4},
+			}); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+			// One of the enabled VFs does not show up.
+			if err := os.Remove(filepath.Join(root, SysfsDevicePath, "0000:4b:00.0", "virtfn4")); err != nil {
+				t.Fatalf("setup error: %v", err)
+			}
+
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+			if err != nil || len(devs) != 1 {
+				t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+			}
+			pf := devs[0]
+			pf.SetStrictVFCount(strict)
+
+			err = pf.EnableVFs()
+			if strict && err == nil {
+				t.Error("expected error enabling VFs with missing VF in strict mode")
+			}
+			if !strict && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if pf.VFCount() != 3 {
+				t.Errorf("expected 3 VFs, got %d", pf.VFCount())
+			}
+		})
+	}
+}
+
+func TestEnableDisableVFsOwnership(t *testing.T) {
+	tests := []struct {
+		name                string
+		numVFs              int
+		wantEnabledByDriver bool
+		wantNumVFs          string
+		wantAfterDisable    string
+	}{
+		{name: "VFs enabled by driver", numVFs: 0, wantEnabledByDriver: true, wantNumVFs: "16", wantAfterDisable: "0"},
+		{name: "VFs enabled by operator", numVFs: 4, wantEnabledByDriver: false, wantNumVFs: "4", wantAfterDisable: "4"},
+		{name: "all VFs enabled by operator", numVFs: 16, wantEnabledByDriver: false, wantNumVFs: "16", wantAfterDisable: "16"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			orig := sysfsRoot
+			t.Cleanup(func() { sysfsRoot = orig })
+
+			root := t.TempDir()
+			sysfsRoot = ""
+			t.Setenv("SYSFS_ROOT", root)
+
+			if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+				{Device: "0000:4b:00.0", State: "up", Services: "sym", NumVFs: tc.numVFs, TotalVFs: 16},
+			}); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+			if err != nil || len(devs) != 1 {
+				t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+			}
+			pf := devs[0]
+
+			if err := pf.EnableVFs(); err != nil {
+				t.Fatalf("EnableVFs error: %v", err)
+			}
+			if pf.VFsEnabledByDriver != tc.wantEnabledByDriver {
+				t.Errorf("want VFs enabled by driver %v, got %v", tc.wantEnabledByDriver, pf.VFsEnabledByDriver)
+			}
+			if numvfs, _ := pf.read(numVFs); numvfs != tc.wantNumVFs {
+				t.Errorf("want %s VFs enabled, got %s", tc.wantNumVFs, numvfs)
+			}
+
+			// Enabling again, e.g. after services reconfiguration, keeps the ownership.
+			if err := pf.EnableVFs(); err != nil {
+				t.Fatalf("second EnableVFs error: %v", err)
+			}
+			if pf.VFsEnabledByDriver != tc.wantEnabledByDriver {
+				t.Errorf("want VFs enabled by driver %v after second enable, got %v", tc.wantEnabledByDriver, pf.VFsEnabledByDriver)
+			}
+
+			if err := pf.DisableVFs(); err != nil {
+				t.Fatalf("DisableVFs error: %v", err)
+			}
+			if numvfs, _ := pf.read(numVFs); numvfs != tc.wantAfterDisable {
+				t.Errorf("want %s VFs after disable, got %s", tc.wantAfterDisable, numvfs)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Generation lists the service configurations a QAT device generation can run.
+type Generation struct {
+	Name     string
+	Services []Services
+}
+
+// Service configurations accepted by cfg_services of QAT Gen4 devices. At most
+// two services can run at the same time and compression chaining runs alone.
+var gen4Services = []Services{
+	Sym,
+	Asym,
+	Dc,
+	Dcc,
+	Sym | Asym,
+	Sym | Dc,
+	Asym | Dc,
+}
+
+// Generations maps PF PCI device IDs to their generation. Devices with IDs
+// missing from the table are not validated, new entries can be added here.
+var Generations = map[string]Generation{
+	"0x4940": {Name: "4xxx", Services: gen4Services},
+	"0x4942": {Name: "401xx", Services: gen4Services},
+	"0x4944": {Name: "402xx", Services: gen4Services},
+	"0x4946": {Name: "420xx", Services: gen4Services},
+}
+
+// GenerationName returns the generation of the PF device, e.g. 4xxx, or an
+// empty string if the device ID is unknown.
+func (p *PFDevice) GenerationName() string {
+	return Generations[p.DeviceID].Name
+}
+
+// ValidateServices returns an error if the PF device generation cannot run the
+// services configuration. Unconfiguring the device is always allowed.
+func (p *PFDevice) ValidateServices(config Services) error {
+	if config == None {
+		return nil
+	}
+	// SetServices starts from None, it carries no meaning next to other services.
+	config &^= None
+
+	generation, found := Generations[p.DeviceID]
+	if !found {
+		return nil
+	}
+
+	if !slices.Contains(generation.Services, config) {
+		return fmt.Errorf("QAT %s device '%s' does not support services configuration '%s'", generation.Name, p.Device, config.String())
+	}
+
+	return nil
+}
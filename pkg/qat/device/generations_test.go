@@ -0,0 +1,82 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"context"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+func TestValidateServices(t *testing.T) {
+	tests := []struct {
+		name        string
+		deviceID    string
+		config      Services
+		expectError bool
+	}{
+		{name: "sym only", deviceID: "0x4940", config: Sym},
+		{name: "asym only", deviceID: "0x4942", config: Asym},
+		{name: "sym and asym", deviceID: "0x4940", config: Sym | Asym},
+		{name: "compression chaining alone", deviceID: "0x4944", config: Dcc},
+		{name: "unconfigure", deviceID: "0x4940", config: None},
+		{name: "three services", deviceID: "0x4940", config: Sym | Asym | Dc, expectError: true},
+		{name: "compression chaining with sym", deviceID: "0x4946", config: Dcc | Sym, expectError: true},
+		{name: "unknown generation is not validated", deviceID: "0x1234", config: Sym | Asym | Dc},
+		{name: "unknown device ID is not validated", deviceID: "", config: Sym | Asym | Dc},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pf := &PFDevice{Device: "0000:4b:00.0", DeviceID: tt.deviceID}
+			err := pf.ValidateServices(tt.config)
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestSetServicesUnsupported(t *testing.T) {
+	orig := sysfsRoot
+	t.Cleanup(func() { sysfsRoot = orig })
+
+	root := t.TempDir()
+	sysfsRoot = ""
+	t.Setenv("SYSFS_ROOT", root)
+
+	if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+		{Device: "0000:4b:00.0", DeviceID: "0x4940", State: "up", Services: "sym", NumVFs: 2, TotalVFs: 2},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+	if err != nil || len(devs) != 1 {
+		t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+	}
+	pf := devs[0]
+	if pf.DeviceID != "0x4940" || pf.GenerationName() != "4xxx" {
+		t.Errorf("expected device ID 0x4940 of generation 4xxx, got '%s' of '%s'", pf.DeviceID, pf.GenerationName())
+	}
+
+	if err := pf.SetServices([]Services{Sym, Asym, Dc}); err == nil {
+		t.Fatal("expected unsupported services configuration to be rejected")
+	}
+
+	services, err := pf.read(qatServices)
+	if err != nil {
+		t.Fatalf("could not read %s: %v", qatServices, err)
+	}
+	if services != "sym" || pf.State != Up {
+		t.Errorf("rejected configuration changed the device: services '%s', state %v", services, pf.State.String())
+	}
+
+	if err := pf.SetServices([]Services{Asym}); err != nil {
+		t.Errorf("supported services configuration failed: %v", err)
+	}
+}
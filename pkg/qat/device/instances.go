@@ -0,0 +1,98 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	qatNumRPs = "qat/num_rps"
+
+	// Ring pairs of a single VF on QAT Gen4 devices, used when qat/num_rps
+	// cannot be read.
+	defaultRingPairsPerVF = 4
+)
+
+// Instances is the number of service instances, i.e. ring pairs, per VF. The
+// kernel driver splits the ring pairs between the services itself, so the
+// counts are only validated against the hardware, not applied.
+type Instances struct {
+	Sym  int `json:"sym,omitempty"`
+	Asym int `json:"asym,omitempty"`
+	Dc   int `json:"dc,omitempty"`
+}
+
+// Total returns the number of ring pairs the instances need.
+func (i Instances) Total() int {
+	return i.Sym + i.Asym + i.Dc
+}
+
+// IsSet returns true if any instance count was configured.
+func (i Instances) IsSet() bool {
+	return i != Instances{}
+}
+
+// RingPairsPerVF returns the number of ring pairs a single VF of the PF has.
+func (p *PFDevice) RingPairsPerVF() int {
+	numrps, err := p.read(qatNumRPs)
+	if err != nil {
+		return defaultRingPairsPerVF
+	}
+	rps, err := strconv.Atoi(numrps)
+	if err != nil || rps <= 0 || p.TotalVFs <= 0 {
+		return defaultRingPairsPerVF
+	}
+
+	return max(rps/p.TotalVFs, 1)
+}
+
+// ValidateInstances returns an error if the instance counts exceed the ring
+// pairs of a VF or use services that are not configured on the PF.
+func (p *PFDevice) ValidateInstances(instances Instances, services Services) error {
+	if !instances.IsSet() {
+		return nil
+	}
+
+	if instances.Sym < 0 || instances.Asym < 0 || instances.Dc < 0 {
+		return fmt.Errorf("PF device '%s': negative instance count in %+v", p.Device, instances)
+	}
+
+	if limit := p.RingPairsPerVF(); instances.Total() > limit {
+		return fmt.Errorf("PF device '%s': %d service instances requested per VF, hardware supports %d", p.Device, instances.Total(), limit)
+	}
+
+	for service, count := range map[Services]int{Sym: instances.Sym, Asym: instances.Asym, Dc: instances.Dc} {
+		if count > 0 && !services.Supports(service) {
+			return fmt.Errorf("PF device '%s': instances requested for service '%s' not configured in '%s'", p.Device, servicetostring[service], services.String())
+		}
+	}
+
+	return nil
+}
+
+// SetInstances validates and stores the instance counts for the currently
+// configured services.
+func (p *PFDevice) SetInstances(instances Instances) error {
+	if err := p.ValidateInstances(instances, p.Services); err != nil {
+		return err
+	}
+
+	p.Instances = instances
+
+	return nil
+}
+
+// resetInvalidInstances clears instance counts that no longer match the
+// configured services, e.g. after a services reconfiguration.
+func (p *PFDevice) resetInvalidInstances() {
+	if err := p.ValidateInstances(p.Instances, p.Services); err != nil {
+		klog.Infof("Resetting service instances after reconfiguration: %v", err)
+		p.Instances = Instances{}
+	}
+}
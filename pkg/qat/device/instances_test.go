@@ -0,0 +1,76 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"context"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+func TestSetInstances(t *testing.T) {
+	orig := sysfsRoot
+	t.Cleanup(func() { sysfsRoot = orig })
+
+	root := t.TempDir()
+	sysfsRoot = ""
+	t.Setenv("SYSFS_ROOT", root)
+
+	if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+		{Device: "0000:4b:00.0", DeviceID: "0x4940", State: "up", Services: "sym;asym", NumVFs: 2, TotalVFs: 2, NumRPs: 8},
+		{Device: "0000:4d:00.0", DeviceID: "0x4940", State: "up", Services: "sym;asym", NumVFs: 2, TotalVFs: 2},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+	if err != nil || len(devs) != 2 {
+		t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+	}
+
+	tests := []struct {
+		name        string
+		pf          *PFDevice
+		instances   Instances
+		expectError bool
+	}{
+		{name: "kernel default", pf: devs[0], instances: Instances{}},
+		{name: "within num_rps limit", pf: devs[0], instances: Instances{Sym: 3, Asym: 1}},
+		{name: "exceeds num_rps limit", pf: devs[0], instances: Instances{Sym: 4, Asym: 1}, expectError: true},
+		{name: "within default limit", pf: devs[1], instances: Instances{Sym: 2, Asym: 2}},
+		{name: "exceeds default limit", pf: devs[1], instances: Instances{Sym: 3, Asym: 2}, expectError: true},
+		{name: "service not configured", pf: devs[0], instances: Instances{Sym: 2, Dc: 1}, expectError: true},
+		{name: "negative count", pf: devs[0], instances: Instances{Sym: -1, Asym: 1}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.pf.Instances = Instances{}
+			err := tt.pf.SetInstances(tt.instances)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if !tt.expectError && tt.pf.Instances != tt.instances {
+				t.Errorf("expected instances %+v, got %+v", tt.instances, tt.pf.Instances)
+			}
+			if tt.expectError && tt.pf.Instances.IsSet() {
+				t.Errorf("expected instances to stay unset, got %+v", tt.pf.Instances)
+			}
+		})
+	}
+
+	pf := devs[0]
+	if err := pf.SetInstances(Instances{Sym: 2, Asym: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pf.SetServices([]Services{Dc}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pf.Instances.IsSet() {
+		t.Errorf("expected instances to be reset after reconfiguration, got %+v", pf.Instances)
+	}
+}
@@ -0,0 +1,77 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// IOMMUMode is the DMA remapping mode VFIO devices are used in on the node.
+type IOMMUMode string
+
+const (
+	// IOMMU is enabled, VFs are passed through as /dev/vfio/<group>.
+	IOMMUEnabled IOMMUMode = "enabled"
+	// IOMMU is off and VFIO runs in unsafe no-IOMMU mode, VFs are passed
+	// through as /dev/vfio/noiommu-<group>.
+	IOMMUNoIOMMU IOMMUMode = "noiommu"
+	// IOMMU is off and no-IOMMU mode is not enabled, VFIO cannot be used.
+	IOMMUDisabled IOMMUMode = "disabled"
+
+	sysfsIOMMUClass = "class/iommu"
+	vfioNoIOMMUMode = "module/vfio/parameters/enable_unsafe_noiommu_mode"
+	noIOMMUPrefix   = "noiommu-"
+)
+
+// iommuMode is detected by New().
+var iommuMode = IOMMUEnabled
+
+// DetectIOMMUMode returns the IOMMU mode based on the IOMMU units and the VFIO
+// module parameters in sysfs.
+func DetectIOMMUMode() IOMMUMode {
+	iommus, err := os.ReadDir(filepath.Join(getSysfsRoot(), sysfsIOMMUClass))
+	if err == nil && len(iommus) > 0 {
+		return IOMMUEnabled
+	}
+
+	noiommu, err := os.ReadFile(filepath.Join(getSysfsRoot(), vfioNoIOMMUMode))
+	if err == nil && strings.TrimSpace(string(noiommu)) == "Y" {
+		return IOMMUNoIOMMU
+	}
+
+	return IOMMUDisabled
+}
+
+// GetIOMMUMode returns the IOMMU mode detected during device discovery.
+func GetIOMMUMode() IOMMUMode {
+	return iommuMode
+}
+
+func detectIOMMUMode() {
+	iommuMode = DetectIOMMUMode()
+
+	switch iommuMode {
+	case IOMMUEnabled:
+		klog.V(3).Info("IOMMU enabled")
+	case IOMMUNoIOMMU:
+		klog.Warning("IOMMU disabled, using VFIO in unsafe no-IOMMU mode")
+	case IOMMUDisabled:
+		klog.Error("IOMMU disabled and VFIO no-IOMMU mode not enabled, QAT VFs cannot be passed through to containers. Enable IOMMU in the kernel command line (intel_iommu=on)")
+	}
+}
+
+// checkVFIOUsable returns an error if VFIO cannot be used in the IOMMU mode.
+func checkVFIOUsable() error {
+	if iommuMode == IOMMUDisabled {
+		return fmt.Errorf("VFIO requires IOMMU or no-IOMMU mode, both are disabled")
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+/* Copyright (C) 2026 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+func TestIOMMUMode(t *testing.T) {
+	orig := sysfsRoot
+	origMode := iommuMode
+	t.Cleanup(func() {
+		sysfsRoot = orig
+		iommuMode = origMode
+	})
+
+	tests := []struct {
+		name               string
+		removeIOMMU        bool
+		noIOMMUParam       string
+		expectMode         IOMMUMode
+		expectDeviceNode   string
+		expectControlError bool
+	}{
+		{name: "IOMMU enabled", expectMode: IOMMUEnabled, expectDeviceNode: "/dev/vfio/351"},
+		{name: "no-IOMMU mode", removeIOMMU: true, noIOMMUParam: "Y\n", expectMode: IOMMUNoIOMMU, expectDeviceNode: "/dev/vfio/noiommu-351"},
+		{name: "IOMMU disabled", removeIOMMU: true, noIOMMUParam: "N\n", expectMode: IOMMUDisabled, expectDeviceNode: "/dev/vfio/351", expectControlError: true},
+		{name: "IOMMU disabled, vfio not loaded", removeIOMMU: true, expectMode: IOMMUDisabled, expectDeviceNode: "/dev/vfio/351", expectControlError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			sysfsRoot = ""
+			t.Setenv("SYSFS_ROOT", root)
+
+			if err := fakesysfs.FakeSysFsQATContents(root, fakesysfs.QATDevices{
+				{Device: "0000:6b:00.0", State: "up", Services: "sym;asym", NumVFs: 1, TotalVFs: 1},
+			}); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+			if tt.removeIOMMU {
+				if err := os.RemoveAll(filepath.Join(root, sysfsIOMMUClass)); err != nil {
+					t.Fatalf("setup error: %v", err)
+				}
+			}
+			if tt.noIOMMUParam != "" {
+				paramFile := filepath.Join(root, vfioNoIOMMUMode)
+				if err := os.MkdirAll(filepath.Dir(paramFile), 0755); err != nil {
+					t.Fatalf("setup error: %v", err)
+				}
+				if err := os.WriteFile(paramFile, []byte(tt.noIOMMUParam), 0600); err != nil {
+					t.Fatalf("setup error: %v", err)
+				}
+			}
+
+			devs, err := New(context.TODO(), helpers.DefaultDiscoveryTimeout)
+			if err != nil || len(devs) != 1 {
+				t.Fatalf("New error: %v, PFs: %d", err, len(devs))
+			}
+
+			if mode := GetIOMMUMode(); mode != tt.expectMode {
+				t.Errorf("expected IOMMU mode %v, got %v", tt.expectMode, mode)
+			}
+
+			for _, vf := range devs[0].AvailableDevices {
+				if deviceNode := vf.DeviceNode(); deviceNode != tt.expectDeviceNode {
+					t.Errorf("expected device node %v, got %v", tt.expectDeviceNode, deviceNode)
+				}
+			}
+
+			ctrl, err := GetControlNode()
+			if (err != nil) != tt.expectControlError {
+				t.Fatalf("expected control node error %v, got %v", tt.expectControlError, err)
+			}
+			if err == nil && ctrl.DeviceNode() != "/dev/vfio/vfio" {
+				t.Errorf("expected control node '/dev/vfio/vfio', got %v", ctrl.DeviceNode())
+			}
+		})
+	}
+}